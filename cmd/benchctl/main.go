@@ -5,13 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/luccadibe/benchctl/internal"
 	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/server"
 	"github.com/luccadibe/benchctl/pkg/bench"
 	"github.com/luccadibe/benchctl/pkg/run"
 	"github.com/urfave/cli/v3"
@@ -19,11 +27,16 @@ import (
 
 var configFlag = &cli.StringFlag{
 	Name:    "config",
-	Usage:   "path to the configuration file",
+	Usage:   "path, URL, or git reference (<repository>//<path>@<ref>) of the configuration file",
 	Value:   "benchmark.yaml",
 	Aliases: []string{"c"},
 }
 
+var profileFlag = &cli.StringSliceFlag{
+	Name:  "profile",
+	Usage: "Merge the named profile of the config over it; repeat to apply several in order",
+}
+
 var timeoutFlag = &cli.DurationFlag{
 	Name:    "timeout",
 	Usage:   "timeout for the benchmark (default: no timeout)",
@@ -51,6 +64,43 @@ var skipFlag = &cli.StringSliceFlag{
 	Name:  "skip",
 	Usage: "Skip stages by name (can be used multiple times)",
 }
+var noCacheFlag = &cli.BoolFlag{
+	Name:  "no-cache",
+	Usage: "Ignore stage caches and execute every stage",
+}
+var skipAnalysisFlag = &cli.BoolFlag{
+	Name:  "skip-analysis",
+	Usage: "Only execute stages and collect outputs; derive metrics and check expectations later with benchctl analyze",
+}
+var debugExecFlag = &cli.BoolFlag{
+	Name:  "debug-exec",
+	Usage: "Write every executed command with its host, timing, and exit code to trace.log in the run directory",
+}
+var shuffleFlag = &cli.BoolFlag{
+	Name:  "shuffle",
+	Usage: "Run cases in a random order (the seed is recorded in metadata)",
+}
+var seedFlag = &cli.Int64Flag{
+	Name:  "seed",
+	Usage: "Seed for a reproducible random case order (implies --shuffle)",
+}
+var trialsFlag = &cli.IntFlag{
+	Name:  "trials",
+	Usage: "Execute the stage pipeline this many times and aggregate the metrics (overrides benchmark.trials)",
+}
+var setFlag = &cli.StringSliceFlag{
+	Name:  "set",
+	Usage: "Override a config value by path, e.g. 'stages[2].command=./bench' (can be used multiple times)",
+}
+var varFlag = &cli.StringSliceFlag{
+	Name:  "var",
+	Usage: "Set a config variable substituted for ${name} in the format 'name=value' (can be used multiple times)",
+}
+var chdirFlag = &cli.StringFlag{
+	Name:    "chdir",
+	Usage:   "Change to this directory before doing anything else",
+	Aliases: []string{"C"},
+}
 var caseFlag = &cli.StringSliceFlag{
 	Name:  "case",
 	Usage: "Run only the named case(s); repeat to select multiple",
@@ -64,19 +114,30 @@ func main() {
 		Usage: "Manage benchmark workflows",
 		Flags: []cli.Flag{
 			configFlag,
+			profileFlag,
 			verboseFlag,
+			chdirFlag,
+		},
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			if dir := cmd.String(chdirFlag.Name); dir != "" {
+				if err := os.Chdir(dir); err != nil {
+					return ctx, fmt.Errorf("--chdir: %w", err)
+				}
+			}
+			return ctx, nil
 		},
 		Commands: []*cli.Command{
 			// run
 			{
-				Name:  "run",
-				Usage: "Run a benchmark",
+				Name:   "run",
+				Usage:  "Run a benchmark",
+				Before: enterWorkspace,
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					cfgFile := cmd.String(configFlag.Name)
 					if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
 						cfgFile = env
 					}
-					bench, err := parseBench(cfgFile)
+					bench, configData, configSum, err := loadBench(cfgFile, cmd.StringSlice(profileFlag.Name), cmd.StringSlice(varFlag.Name), cmd.StringSlice(setFlag.Name))
 					if err != nil {
 						return err
 					}
@@ -86,6 +147,11 @@ func main() {
 					if err != nil {
 						return err
 					}
+					if config.IsRemoteSource(cfgFile) {
+						// Record which shared definition the run used.
+						customMetadata["config_source"] = cfgFile
+						customMetadata["config_sha256"] = configSum
+					}
 					envEntries := cmd.StringSlice(environmentFlag.Name)
 					envVars, err := parseEnvironment(envEntries)
 					if err != nil {
@@ -104,19 +170,54 @@ func main() {
 					for _, caseName := range cmd.StringSlice(caseFlag.Name) {
 						runOptions = append(runOptions, run.OnlyCase(caseName))
 					}
+					if cmd.Bool(noCacheFlag.Name) {
+						runOptions = append(runOptions, run.NoCache())
+					}
+					if cmd.Bool(skipAnalysisFlag.Name) {
+						runOptions = append(runOptions, run.SkipAnalysis())
+					}
+					if cmd.Bool(verboseFlag.Name) {
+						runOptions = append(runOptions, run.Verbose())
+					}
+					if cmd.Bool(debugExecFlag.Name) {
+						runOptions = append(runOptions, run.TraceCommands())
+					}
+					if cmd.IsSet(seedFlag.Name) {
+						runOptions = append(runOptions, run.WithSeed(cmd.Int64(seedFlag.Name)))
+					} else if cmd.Bool(shuffleFlag.Name) {
+						runOptions = append(runOptions, run.ShuffleCases())
+					}
 					if cmd.IsSet(timeoutFlag.Name) {
 						runOptions = append(runOptions, run.WithTimeout(cmd.Duration(timeoutFlag.Name)))
 					}
+					if cmd.IsSet(trialsFlag.Name) {
+						runOptions = append(runOptions, run.WithTrials(cmd.Int(trialsFlag.Name)))
+					}
 
-					_, err = run.Run(ctx, bench, runOptions...)
+					ctx, stop := interruptContext(ctx)
+					defer stop()
+					_, err = run.RunMatrix(ctx, bench, runOptions...)
+					if err != nil && run.InGitHubActions() {
+						for _, annotation := range run.GitHubAnnotations(err, cfgFile, configData) {
+							fmt.Println(annotation)
+						}
+					}
 					return err
 				},
 				Flags: []cli.Flag{
+					setFlag,
+					varFlag,
 					metadataFlag,
 					environmentFlag,
 					skipFlag,
 					caseFlag,
+					noCacheFlag,
+					skipAnalysisFlag,
+					debugExecFlag,
+					shuffleFlag,
+					seedFlag,
 					timeoutFlag,
+					trialsFlag,
 				},
 			},
 			// init
@@ -147,16 +248,161 @@ func main() {
 					},
 				},
 			},
+			// configs
+			{
+				Name:      "configs",
+				Usage:     "List the benchmark configs of the repository with their names and output directories",
+				ArgsUsage: "[dir]",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					root := cmd.Args().Get(0)
+					if root == "" {
+						root = repositoryRoot(ctx)
+					}
+					configs, err := config.ListConfigs(root)
+					if err != nil {
+						return err
+					}
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "CONFIG\tNAME\tOUTPUT DIR")
+					for _, file := range configs {
+						fmt.Fprintf(w, "%s\t%s\t%s\n", file.Path, file.Name, file.OutputDir)
+					}
+					return w.Flush()
+				},
+			},
+			// config
+			{
+				Name:   "config",
+				Usage:  "Work with benchmark configurations",
+				Before: enterWorkspace,
+				Commands: []*cli.Command{
+					{
+						Name:  "render",
+						Usage: "Print the effective config a run would execute",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							cfgFile := cmd.String(configFlag.Name)
+							if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
+								cfgFile = env
+							}
+							bench, err := parseBenchVars(cfgFile, cmd.StringSlice(profileFlag.Name), cmd.StringSlice(varFlag.Name), cmd.StringSlice(setFlag.Name))
+							if err != nil {
+								return err
+							}
+							envVars, err := parseEnvironment(cmd.StringSlice(environmentFlag.Name))
+							if err != nil {
+								return err
+							}
+							var runOptions []run.Option
+							if len(envVars) > 0 {
+								runOptions = append(runOptions, run.WithEnvMap(envVars))
+							}
+							for _, stageName := range cmd.StringSlice(skipFlag.Name) {
+								runOptions = append(runOptions, run.Skip(stageName))
+							}
+							for _, caseName := range cmd.StringSlice(caseFlag.Name) {
+								runOptions = append(runOptions, run.OnlyCase(caseName))
+							}
+							if cmd.Bool(noCacheFlag.Name) {
+								runOptions = append(runOptions, run.NoCache())
+							}
+							rendered, err := run.Render(bench, runOptions...)
+							if err != nil {
+								return err
+							}
+							logWarnings(bench)
+							_, err = os.Stdout.Write(rendered)
+							return err
+						},
+						Flags: []cli.Flag{
+							setFlag,
+							varFlag,
+							environmentFlag,
+							skipFlag,
+							caseFlag,
+							noCacheFlag,
+						},
+					},
+					{
+						Name:  "validate",
+						Usage: "Check the config and report stage order warnings without running it",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							cfgFile := cmd.String(configFlag.Name)
+							if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
+								cfgFile = env
+							}
+							bench, err := parseBenchVars(cfgFile, cmd.StringSlice(profileFlag.Name), cmd.StringSlice(varFlag.Name), cmd.StringSlice(setFlag.Name))
+							if err != nil {
+								return err
+							}
+							logWarnings(bench)
+							fmt.Printf("%s is valid\n", cfgFile)
+							return nil
+						},
+						Flags: []cli.Flag{
+							setFlag,
+							varFlag,
+						},
+					},
+				},
+			},
+			// env
+			{
+				Name:   "env",
+				Usage:  "Print the environment variables exported to stages, as export lines for eval",
+				Before: enterWorkspace,
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					cfgFile := cmd.String(configFlag.Name)
+					if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
+						cfgFile = env
+					}
+					bench, err := parseBenchVars(cfgFile, cmd.StringSlice(profileFlag.Name), cmd.StringSlice(varFlag.Name), cmd.StringSlice(setFlag.Name))
+					if err != nil {
+						return err
+					}
+					envVars, err := parseEnvironment(cmd.StringSlice(environmentFlag.Name))
+					if err != nil {
+						return err
+					}
+					var runOptions []run.Option
+					if len(envVars) > 0 {
+						runOptions = append(runOptions, run.WithEnvMap(envVars))
+					}
+					for _, caseName := range cmd.StringSlice(caseFlag.Name) {
+						runOptions = append(runOptions, run.OnlyCase(caseName))
+					}
+					env, err := run.StageEnv(bench, cmd.String("run-id"), cmd.String("host"), runOptions...)
+					if err != nil {
+						return err
+					}
+					fmt.Print(env)
+					return nil
+				},
+				Flags: []cli.Flag{
+					setFlag,
+					varFlag,
+					environmentFlag,
+					caseFlag,
+					&cli.StringFlag{
+						Name:  "run-id",
+						Usage: "Existing run to print the variables of (default: the next run)",
+					},
+					&cli.StringFlag{
+						Name:  "host",
+						Usage: "Host alias of the stage (default: local)",
+					},
+				},
+			},
 			// inspect
 			{
-				Name:  "inspect",
-				Usage: "Inspect a benchmark run",
+				Name:   "inspect",
+				Usage:  "Inspect a benchmark run",
+				Before: enterWorkspace,
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					cfgFile := cmd.String(configFlag.Name)
 					if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
 						cfgFile = env
 					}
-					bench, err := parseBench(cfgFile)
+					bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
 					if err != nil {
 						return err
 					}
@@ -164,24 +410,144 @@ func main() {
 					if runId == "" {
 						return fmt.Errorf("run-id is required")
 					}
-					runPath := filepath.Join(bench.Config().Benchmark.OutputDir, runId)
-					fmt.Println(run.Inspect(runPath, cmd.Bool(verboseFlag.Name)))
+					fmt.Println(run.InspectStored(ctx, run.Results(bench), runId, cmd.Bool(verboseFlag.Name)))
 					return nil
 				},
 				Flags: []cli.Flag{
 					configFlag,
+					profileFlag,
+				},
+			},
+			// list
+			{
+				Name:   "list",
+				Usage:  "List the stored runs of a benchmark",
+				Before: enterWorkspace,
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					cfgFile := cmd.String(configFlag.Name)
+					if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
+						cfgFile = env
+					}
+					bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
+					if err != nil {
+						return err
+					}
+					store := run.Results(bench)
+					runIDs, err := store.ListRuns(ctx)
+					if err != nil {
+						return err
+					}
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "RUN\tSTATUS\tSTARTED\tDURATION")
+					for _, runID := range runIDs {
+						runmd, err := store.LoadMetadata(ctx, runID)
+						if err != nil {
+							fmt.Fprintf(w, "%s\terror: %v\t\t\n", runID, err)
+							continue
+						}
+						duration := runmd.EndTime.Sub(runmd.StartTime).Round(time.Second)
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", runID, runmd.Status, runmd.StartTime.Format(time.RFC3339), duration)
+					}
+					return w.Flush()
+				},
+				Flags: []cli.Flag{
+					configFlag,
+					profileFlag,
+				},
+			},
+			// history
+			{
+				Name:   "history",
+				Usage:  "Show the final metrics of every run of a benchmark",
+				Before: enterWorkspace,
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					cfgFile := cmd.String(configFlag.Name)
+					if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
+						cfgFile = env
+					}
+					bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
+					if err != nil {
+						return err
+					}
+					entries, err := run.History(bench)
+					if err != nil {
+						return err
+					}
+					metrics := cmd.StringSlice("metric")
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					header := []string{"RUN", "STATUS", "STARTED", "COMMIT"}
+					if len(metrics) == 0 {
+						header = append(header, "METRICS")
+					}
+					for _, name := range metrics {
+						header = append(header, strings.ToUpper(name))
+					}
+					fmt.Fprintln(w, strings.Join(header, "\t"))
+					for _, entry := range entries {
+						row := []string{entry.RunID, entry.Status, entry.StartTime.Format(time.RFC3339), entry.Commit}
+						if len(metrics) == 0 {
+							var pairs []string
+							for _, name := range slices.Sorted(maps.Keys(entry.Metrics)) {
+								pairs = append(pairs, name+"="+entry.Metrics[name])
+							}
+							row = append(row, strings.Join(pairs, " "))
+						}
+						for _, name := range metrics {
+							row = append(row, entry.Metrics[name])
+						}
+						fmt.Fprintln(w, strings.Join(row, "\t"))
+					}
+					return w.Flush()
+				},
+				Flags: []cli.Flag{
+					configFlag,
+					profileFlag,
+					&cli.StringSliceFlag{
+						Name:  "metric",
+						Usage: "Show only these metrics, one column each (repeatable)",
+					},
+				},
+			},
+			// analyze
+			{
+				Name:   "analyze",
+				Usage:  "Derive the metrics and check the expectations of a run again from its collected data",
+				Before: enterWorkspace,
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					cfgFile := cmd.String(configFlag.Name)
+					if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
+						cfgFile = env
+					}
+					bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
+					if err != nil {
+						return err
+					}
+					runId := cmd.Args().Get(0)
+					if runId == "" {
+						return fmt.Errorf("run-id is required")
+					}
+					runmd, err := run.AnalyzeStored(ctx, run.Results(bench), runId, bench)
+					if runmd != nil {
+						fmt.Printf("Run %s analyzed, status %s\n", runId, runmd.Status)
+					}
+					return err
+				},
+				Flags: []cli.Flag{
+					configFlag,
+					profileFlag,
 				},
 			},
 			// annotate
 			{
-				Name:  "annotate",
-				Usage: "Annotate a completed benchmark run's metadata",
+				Name:   "annotate",
+				Usage:  "Annotate a completed benchmark run's metadata",
+				Before: enterWorkspace,
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					cfgFile := cmd.String(configFlag.Name)
 					if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
 						cfgFile = env
 					}
-					bench, err := parseBench(cfgFile)
+					bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
 					if err != nil {
 						return err
 					}
@@ -189,13 +555,12 @@ func main() {
 					if runId == "" {
 						return fmt.Errorf("run-id is required")
 					}
-					runPath := filepath.Join(bench.Config().Benchmark.OutputDir, runId)
 					md := cmd.StringSlice(metadataFlag.Name)
 					extraMd, err := parseMetadata(md)
 					if err != nil {
 						return err
 					}
-					err = run.Annotate(runPath, extraMd)
+					err = run.AnnotateStored(ctx, run.Results(bench), runId, extraMd)
 					if err != nil {
 						return err
 					}
@@ -206,31 +571,73 @@ func main() {
 					metadataFlag,
 				},
 			},
+			// note
+			{
+				Name:   "note",
+				Usage:  "Add a timestamped note to a benchmark run",
+				Before: enterWorkspace,
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					cfgFile := cmd.String(configFlag.Name)
+					if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
+						cfgFile = env
+					}
+					bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
+					if err != nil {
+						return err
+					}
+					runId := cmd.Args().Get(0)
+					if runId == "" {
+						return fmt.Errorf("run-id is required")
+					}
+					text := strings.Join(cmd.Args().Slice()[1:], " ")
+					if strings.TrimSpace(text) == "" {
+						return fmt.Errorf("note text is required")
+					}
+					if err := run.NoteStored(ctx, run.Results(bench), runId, text); err != nil {
+						return err
+					}
+					fmt.Println("Note added")
+					return nil
+				},
+			},
 			// compare
 			{
-				Name:  "compare",
-				Usage: "Compare two benchmark runs",
+				Name:   "compare",
+				Usage:  "Compare two benchmark runs",
+				Before: enterWorkspace,
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					runId1 := cmd.Args().Get(0)
 					runId2 := cmd.Args().Get(1)
+					against := cmd.String("against")
 					if runId1 == "" {
 						return fmt.Errorf("first run-id is required")
 					}
-					if runId2 == "" {
-						return fmt.Errorf("second run-id is required")
+					if runId2 == "" && against == "" {
+						return fmt.Errorf("second run-id or --against is required")
+					}
+					if runId2 != "" && against != "" {
+						return fmt.Errorf("second run-id and --against are mutually exclusive")
 					}
 					cfgFile := cmd.String(configFlag.Name)
-					bench, err := parseBench(cfgFile)
+					bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
 					if err != nil {
 						return err
 					}
-					runPath1 := filepath.Join(bench.Config().Benchmark.OutputDir, runId1)
-					runPath2 := filepath.Join(bench.Config().Benchmark.OutputDir, runId2)
-					runmd1, err := run.LoadMetadata(runPath1)
+					store := run.Results(bench)
+					if against != "" {
+						// The baseline is the first run; the run given is compared against it.
+						runId2 = runId1
+						runId1, err = run.SelectRun(ctx, store, against, runId2)
+						if err != nil {
+							return err
+						}
+						fmt.Printf("Comparing run %s against run %s\n", runId2, runId1)
+					}
+					runmd1, err := store.LoadMetadata(ctx, runId1)
 					if err != nil {
 						return err
 					}
-					runmd2, err := run.LoadMetadata(runPath2)
+					runmd2, err := store.LoadMetadata(ctx, runId2)
 					if err != nil {
 						return err
 					}
@@ -238,14 +645,194 @@ func main() {
 					if err != nil {
 						return err
 					}
+					regressed := run.ApplyComparisonRules(results, bench.Config().Benchmark.Compare)
 					fmt.Println(run.FormatComparison(results))
+					tables, err := run.CompareGoBenchmarks(ctx, store, runId1, runId2)
+					if err != nil {
+						return err
+					}
+					if len(tables) > 0 {
+						fmt.Print(run.FormatGoBenchmarks(tables))
+					}
+					if len(regressed) > 0 {
+						return fmt.Errorf("%d metrics regressed: %s", len(regressed), strings.Join(regressed, ", "))
+					}
+					return nil
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "against",
+						Usage: "Compare against the latest successful run matching a query such as 'latest tag=nightly branch=main'",
+					},
+				},
+			},
+			// diff-output
+			{
+				Name:   "diff-output",
+				Usage:  "Compare the distribution of a CSV output across two runs",
+				Before: enterWorkspace,
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					runId1 := cmd.Args().Get(0)
+					runId2 := cmd.Args().Get(1)
+					output := cmd.Args().Get(2)
+					if runId1 == "" || runId2 == "" {
+						return fmt.Errorf("two run-ids are required")
+					}
+					if output == "" {
+						return fmt.Errorf("output name is required")
+					}
+					cfgFile := cmd.String(configFlag.Name)
+					bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
+					if err != nil {
+						return err
+					}
+					diff, err := run.DiffStoredOutput(ctx, run.Results(bench), runId1, runId2, output, cmd.Int("top"))
+					if err != nil {
+						return err
+					}
+					fmt.Print(run.FormatOutputDiff(diff))
+					return nil
+				},
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "top",
+						Usage: "Number of most changed buckets to show per column",
+						Value: 5,
+					},
+				},
+			},
+			// ab
+			{
+				Name:  "ab",
+				Usage: "Alternate runs of two configurations and compare their metrics",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					benchA, err := parseBench(cmd.String("config-a"), cmd.StringSlice(profileFlag.Name))
+					if err != nil {
+						return err
+					}
+					benchB, err := parseBench(cmd.String("config-b"), cmd.StringSlice(profileFlag.Name))
+					if err != nil {
+						return err
+					}
+
+					md := cmd.StringSlice(metadataFlag.Name)
+					customMetadata, err := parseMetadata(md)
+					if err != nil {
+						return err
+					}
+					envEntries := cmd.StringSlice(environmentFlag.Name)
+					envVars, err := parseEnvironment(envEntries)
+					if err != nil {
+						return err
+					}
+					var runOptions []run.Option
+					if len(customMetadata) > 0 {
+						runOptions = append(runOptions, run.WithMetadataMap(customMetadata))
+					}
+					if len(envVars) > 0 {
+						runOptions = append(runOptions, run.WithEnvMap(envVars))
+					}
+					if cmd.IsSet(timeoutFlag.Name) {
+						runOptions = append(runOptions, run.WithTimeout(cmd.Duration(timeoutFlag.Name)))
+					}
+					if cmd.Bool(verboseFlag.Name) {
+						runOptions = append(runOptions, run.Verbose())
+					}
+					if cmd.Bool(debugExecFlag.Name) {
+						runOptions = append(runOptions, run.TraceCommands())
+					}
+
+					ctx, stop := interruptContext(ctx)
+					defer stop()
+					result, err := run.RunAB(ctx, benchA, benchB, cmd.Int("repeat"), runOptions...)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("A: %s runs %s\n", cmd.String("config-a"), strings.Join(runIDs(result.A), ", "))
+					fmt.Printf("B: %s runs %s\n\n", cmd.String("config-b"), strings.Join(runIDs(result.B), ", "))
+					fmt.Print(run.FormatABComparison(result.Comparison))
+					return nil
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "config-a",
+						Usage:    "path to the configuration file of variant A",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "config-b",
+						Usage:    "path to the configuration file of variant B",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  "repeat",
+						Usage: "number of runs per configuration",
+						Value: 5,
+					},
+					metadataFlag,
+					environmentFlag,
+					timeoutFlag,
+					debugExecFlag,
+				},
+			},
+			// export
+			{
+				Name:   "export",
+				Usage:  "Export a run's numeric metadata as OpenMetrics or push it to a Prometheus Pushgateway",
+				Before: enterWorkspace,
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					cfgFile := cmd.String(configFlag.Name)
+					if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
+						cfgFile = env
+					}
+					bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
+					if err != nil {
+						return err
+					}
+					runId := cmd.Args().Get(0)
+					if runId == "" {
+						return fmt.Errorf("run-id is required")
+					}
+					runmd, err := run.Results(bench).LoadMetadata(ctx, runId)
+					if err != nil {
+						return err
+					}
+					if gateway := cmd.String("pushgateway"); gateway != "" {
+						if err := run.PushMetrics(ctx, gateway, cmd.String("job"), runmd); err != nil {
+							return err
+						}
+						fmt.Println("Metrics pushed successfully")
+					}
+					if path := cmd.String("openmetrics"); path != "" {
+						return os.WriteFile(path, []byte(run.FormatOpenMetrics(runmd)), 0644)
+					}
+					if cmd.String("pushgateway") == "" {
+						fmt.Print(run.FormatOpenMetrics(runmd))
+					}
 					return nil
 				},
+				Flags: []cli.Flag{
+					configFlag,
+					profileFlag,
+					&cli.StringFlag{
+						Name:  "openmetrics",
+						Usage: "write OpenMetrics text to this file instead of stdout",
+					},
+					&cli.StringFlag{
+						Name:  "pushgateway",
+						Usage: "Prometheus Pushgateway base URL to push metrics to",
+					},
+					&cli.StringFlag{
+						Name:  "job",
+						Usage: "Pushgateway job name (default: benchmark name)",
+					},
+				},
 			},
 			// sync
 			{
-				Name:  "sync",
-				Usage: "Sync benchmark results using rclone",
+				Name:   "sync",
+				Usage:  "Sync benchmark results using rclone",
+				Before: enterWorkspace,
 				Commands: []*cli.Command{
 					{
 						Name:  "push",
@@ -255,7 +842,7 @@ func main() {
 							if env := os.Getenv("BENCHCTL_CONFIG_PATH"); strings.TrimSpace(env) != "" {
 								cfgFile = env
 							}
-							bench, err := parseBench(cfgFile)
+							bench, err := parseBench(cfgFile, cmd.StringSlice(profileFlag.Name))
 							if err != nil {
 								return err
 							}
@@ -263,10 +850,58 @@ func main() {
 						},
 						Flags: []cli.Flag{
 							configFlag,
+							profileFlag,
 						},
 					},
 				},
 			},
+			// server
+			{
+				Name:  "server",
+				Usage: "Serve an HTTP API to submit, follow, and cancel runs and fetch their artifacts",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					token := cmd.String("token")
+					if env := os.Getenv("BENCHCTL_SERVER_TOKEN"); strings.TrimSpace(env) != "" {
+						token = env
+					}
+					ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+					s := server.New(token, cmd.Int("concurrency"), slog.Default())
+					s.SetResultsDir(cmd.String("results-dir"))
+					s.WatchResults(cmd.StringSlice("results")...)
+					s.SetDownloadRate(cmd.Int64("download-rate"))
+					return s.ListenAndServe(ctx, cmd.String("listen"))
+				},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Usage: "address to listen on",
+						Value: "127.0.0.1:8080",
+					},
+					&cli.StringFlag{
+						Name:  "token",
+						Usage: "bearer token clients must send (or set BENCHCTL_SERVER_TOKEN)",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Usage: "number of jobs that may run at the same time on one host",
+						Value: 1,
+					},
+					&cli.StringFlag{
+						Name:  "results-dir",
+						Usage: "directory the runs of submitted jobs are stored in, one directory per benchmark",
+						Value: server.DefaultResultsDir,
+					},
+					&cli.StringSliceFlag{
+						Name:  "results",
+						Usage: "output directory whose stored runs /metrics reports, besides those of the server's jobs (repeatable)",
+					},
+					&cli.Int64Flag{
+						Name:  "download-rate",
+						Usage: "limit each artifact or archive download to this many bytes per second (0 for no limit)",
+					},
+				},
+			},
 		},
 	}
 
@@ -276,12 +911,101 @@ func main() {
 	}
 }
 
-func parseBench(cfgFile string) (*bench.Bench, error) {
-	b, err := bench.FromFile(cfgFile)
+// interruptContext cancels ctx on the first SIGINT or SIGTERM, so that a run stops
+// its background stages and runs its cleanup steps before exiting. A second signal
+// exits at once.
+func interruptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	return ctx, stop
+}
+
+// enterWorkspace changes to the nearest parent directory holding the default
+// config when the current one has none and no config was named, so that the
+// relative paths of the config resolve as if benchctl had been started there.
+func enterWorkspace(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	if cmd.IsSet(configFlag.Name) || strings.TrimSpace(os.Getenv("BENCHCTL_CONFIG_PATH")) != "" {
+		return ctx, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return ctx, err
+	}
+	dir, err := config.FindConfig(wd, configFlag.Value)
+	if err != nil || dir == "" || dir == wd {
+		return ctx, err
+	}
+	slog.Info("using config of parent directory", "config", filepath.Join(dir, configFlag.Value))
+	return ctx, os.Chdir(dir)
+}
+
+// repositoryRoot returns the top-level directory of the git repository of the
+// current directory, or the current directory outside of one.
+func repositoryRoot(ctx context.Context) string {
+	out, err := exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel").Output()
+	if root := strings.TrimSpace(string(out)); err == nil && root != "" {
+		return root
+	}
+	return "."
+}
+
+// parseBench loads cfgFile after merging the named profiles and applying --set
+// style overrides to it.
+func parseBench(cfgFile string, profiles []string, overrides ...string) (*bench.Bench, error) {
+	return parseBenchVars(cfgFile, profiles, nil, overrides)
+}
+
+// logWarnings logs the warnings of a valid benchmark definition.
+func logWarnings(b *bench.Bench) {
+	for _, warning := range b.Warnings() {
+		slog.Warn("stage order warning", "warning", warning)
+	}
+}
+
+// parseBenchVars loads a config after merging --profile overlays and applying
+// --set overrides, then substitutes its variables with --var entries taking
+// precedence.
+func parseBenchVars(cfgFile string, profiles, varEntries, overrides []string) (*bench.Bench, error) {
+	b, _, _, err := loadBench(cfgFile, profiles, varEntries, overrides)
+	return b, err
+}
+
+// loadBench is parseBenchVars that also returns the content of the config file,
+// which may be a URL or git reference, as read before profiles and overrides were
+// applied, and its SHA-256 checksum.
+func loadBench(cfgFile string, profiles, varEntries, overrides []string) (*bench.Bench, []byte, string, error) {
+	source, sum, err := config.ReadSource(context.Background(), cfgFile)
+	if err != nil {
+		return nil, nil, "", errors.New("Error parsing configuration file: " + err.Error())
+	}
+	data, err := config.ApplyProfiles(source, profiles)
 	if err != nil {
-		return nil, errors.New("Error parsing configuration file: " + err.Error())
+		return nil, nil, "", errors.New("Error parsing configuration file: " + err.Error())
 	}
-	return b, nil
+	data, err = config.ApplyOverrides(data, overrides)
+	if err != nil {
+		return nil, nil, "", errors.New("Error parsing configuration file: " + err.Error())
+	}
+	vars, err := parseVars(varEntries)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	b, err := bench.FromYAMLWithVars(data, vars)
+	if err != nil {
+		return nil, nil, "", errors.New("Error parsing configuration file: " + err.Error())
+	}
+	if !config.IsRemoteSource(cfgFile) {
+		config.ResolveCacheInputs(b.Config(), filepath.Dir(cfgFile))
+	}
+	return b, source, sum, nil
+}
+
+func runIDs(results []*run.Result) []string {
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.RunID)
+	}
+	return ids
 }
 
 var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
@@ -298,6 +1022,19 @@ func parseMetadata(md []string) (map[string]string, error) {
 	return customMetadata, nil
 }
 
+// used to parse the --var flag
+func parseVars(entries []string) (map[string]string, error) {
+	vars := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("Invalid var format: %s. Expected format: name=value", entry)
+		}
+		vars[strings.TrimSpace(name)] = value
+	}
+	return vars, nil
+}
+
 // used to parse the --environment / -e flag
 func parseEnvironment(entries []string) (map[string]string, error) {
 	envVars := make(map[string]string)
@@ -8,6 +8,7 @@ require (
 	github.com/goccy/go-yaml v1.18.0
 	github.com/goforj/godump v1.6.0
 	github.com/invopop/jsonschema v0.13.0
+	github.com/klauspost/compress v1.18.0
 	github.com/urfave/cli/v3 v3.4.1
 	golang.org/x/crypto v0.42.0
 	golang.org/x/term v0.35.0
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ABComparison summarizes one numeric custom metadata key across the runs of two configurations.
+type ABComparison struct {
+	Key string `json:"key"`
+	A   Sample `json:"a"`
+	B   Sample `json:"b"`
+	// Relative change of the B mean over the A mean; nil when the A mean is zero.
+	DeltaPercent *float64 `json:"delta_percent,omitempty"`
+	// Two-sided Welch's t-test p-value; nil when a side has fewer than two runs.
+	PValue *float64 `json:"p_value,omitempty"`
+}
+
+// CompareAB compares every custom metadata key that is numeric in at least one run
+// of each group. Keys are returned in lexical order.
+func CompareAB(a, b []*RunMetadata) []ABComparison {
+	valuesA := numericCustomValues(a)
+	valuesB := numericCustomValues(b)
+
+	keys := make([]string, 0, len(valuesA))
+	for key := range valuesA {
+		if _, ok := valuesB[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	comparisons := make([]ABComparison, 0, len(keys))
+	for _, key := range keys {
+		comparison := ABComparison{
+			Key: key,
+			A:   summarize(valuesA[key]),
+			B:   summarize(valuesB[key]),
+		}
+		if comparison.A.Mean != 0 {
+			delta := (comparison.B.Mean - comparison.A.Mean) / comparison.A.Mean * 100
+			comparison.DeltaPercent = &delta
+		}
+		if p, ok := welchTTest(comparison.A, comparison.B); ok {
+			comparison.PValue = &p
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	return comparisons
+}
+
+// FormatABComparison renders comparisons as an aligned table of mean ± stddev per side.
+func FormatABComparison(comparisons []ABComparison) string {
+	if len(comparisons) == 0 {
+		return "No numeric metadata shared by both configurations\n"
+	}
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "metric\tA\tB\tdelta\tp")
+	for _, comparison := range comparisons {
+		delta, p := "-", "-"
+		if comparison.DeltaPercent != nil {
+			delta = fmt.Sprintf("%+.1f%%", *comparison.DeltaPercent)
+		}
+		if comparison.PValue != nil {
+			p = fmt.Sprintf("%.3f", *comparison.PValue)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", comparison.Key, formatSample(comparison.A), formatSample(comparison.B), delta, p)
+	}
+	_ = w.Flush()
+	return out.String()
+}
+
+func formatSample(sample Sample) string {
+	return fmt.Sprintf("%.4g ± %.2g (n=%d)", sample.Mean, sample.StdDev, sample.N)
+}
+
+func numericCustomValues(runs []*RunMetadata) map[string][]float64 {
+	values := map[string][]float64{}
+	for _, run := range runs {
+		for key, raw := range run.Custom {
+			if value, ok := parseFloat(raw); ok {
+				values[key] = append(values[key], *value)
+			}
+		}
+	}
+	return values
+}
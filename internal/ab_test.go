@@ -0,0 +1,52 @@
+//go:build unit
+
+package internal
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCompareAB(t *testing.T) {
+	runs := func(variant string, values ...string) []*RunMetadata {
+		var out []*RunMetadata
+		for _, value := range values {
+			out = append(out, &RunMetadata{Custom: map[string]string{"latency_ms": value, "ab_variant": variant}})
+		}
+		return out
+	}
+	a := runs("a", "10", "11", "12", "10", "11")
+	b := runs("b", "20", "21", "19", "20", "22")
+
+	comparisons := CompareAB(a, b)
+	if len(comparisons) != 1 || comparisons[0].Key != "latency_ms" {
+		t.Fatalf("expected only the numeric key to be compared, got %+v", comparisons)
+	}
+	comparison := comparisons[0]
+	if comparison.A.N != 5 || comparison.A.Mean != 10.8 || comparison.B.Mean != 20.4 {
+		t.Fatalf("unexpected samples: %+v", comparison)
+	}
+	if comparison.DeltaPercent == nil || math.Abs(*comparison.DeltaPercent-88.888) > 0.01 {
+		t.Fatalf("unexpected delta: %v", comparison.DeltaPercent)
+	}
+	if comparison.PValue == nil || *comparison.PValue > 0.001 {
+		t.Fatalf("expected a significant p-value, got %v", comparison.PValue)
+	}
+	if out := FormatABComparison(comparisons); !strings.Contains(out, "latency_ms") || !strings.Contains(out, "+88.9%") {
+		t.Fatalf("unexpected table:\n%s", out)
+	}
+}
+
+func TestWelchTTest(t *testing.T) {
+	// Welch's example data: t = -2.46, df = 24.99.
+	a := summarize([]float64{27.5, 21.0, 19.0, 23.6, 17.0, 17.9, 16.9, 20.1, 21.9, 22.6, 23.1, 19.6, 19.0, 21.7, 21.4})
+	b := summarize([]float64{27.1, 22.0, 20.8, 23.4, 23.4, 23.5, 25.8, 22.0, 24.8, 20.2, 21.9, 22.1, 22.9, 20.5, 24.4})
+	p, ok := welchTTest(a, b)
+	if !ok || math.Abs(p-0.02138) > 0.0001 {
+		t.Fatalf("welchTTest() = %v, %v; want ~0.02138", p, ok)
+	}
+	if _, ok := welchTTest(summarize([]float64{1}), b); ok {
+		t.Fatalf("expected single-value samples to be rejected")
+	}
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// consoleDir holds the console output of stages with metrics_from_output.
+const consoleDir = "console"
+
+// Analysis records the analysis phase of a run: the stored files metrics are
+// derived from and the stages whose expectations apply, so AnalyzeStoredRun can
+// repeat it on the collected data.
+type Analysis struct {
+	// Skipped is set while a run made with benchmark.skip_analysis is unanalyzed.
+	Skipped bool `json:"skipped,omitempty"`
+	// Inputs are the files to derive metrics from, in the order the run stored them.
+	Inputs []AnalysisInput `json:"inputs,omitempty"`
+	// Stages names the stages that ran, whose expect entries are checked.
+	Stages []string `json:"stages,omitempty"`
+	// Metrics names the custom metadata derived by the analysis, which a repeated
+	// analysis replaces.
+	Metrics []string `json:"metrics,omitempty"`
+	// Error is why the last analysis failed.
+	Error string `json:"error,omitempty"`
+	// AnalyzedAt is when benchctl analyze last ran.
+	AnalyzedAt *time.Time `json:"analyzed_at,omitempty"`
+}
+
+// AnalysisInput is a stored file to derive run metrics from: an output of the
+// stage when Output is set, and its console output otherwise.
+type AnalysisInput struct {
+	Stage  string `json:"stage"`
+	Output string `json:"output,omitempty"`
+	File   string `json:"file"`
+	// Host is the host alias of a console output.
+	Host string `json:"host,omitempty"`
+}
+
+// skipped reports whether the run defers its analysis. Runs without an analysis
+// record, as in tests of single phases, analyze as they go.
+func (a *Analysis) skipped() bool {
+	return a != nil && a.Skipped
+}
+
+// addOutputs records the collected outputs of stage.
+func (a *Analysis) addOutputs(stage config.Stage, outputs []collectedOutput) {
+	if a == nil {
+		return
+	}
+	for _, output := range outputs {
+		a.Inputs = append(a.Inputs, AnalysisInput{Stage: stage.Name, Output: output.name, File: output.file})
+	}
+}
+
+// addStage records that stage ran.
+func (a *Analysis) addStage(stage config.Stage) {
+	if a != nil && !slices.Contains(a.Stages, stage.Name) {
+		a.Stages = append(a.Stages, stage.Name)
+	}
+}
+
+// addDerivedMetrics records metrics derived by the analysis in the custom metadata.
+func addDerivedMetrics(metadata *RunMetadata, metrics map[string]string) {
+	addRunMetrics(metadata, metrics)
+	if metadata.Analysis == nil {
+		return
+	}
+	for name := range metrics {
+		if !slices.Contains(metadata.Analysis.Metrics, name) {
+			metadata.Analysis.Metrics = append(metadata.Analysis.Metrics, name)
+		}
+	}
+	slices.Sort(metadata.Analysis.Metrics)
+}
+
+// saveConsoleOutput stores the console output of a stage on a host below
+// console/<stage>/, named like the stage cache keys.
+func saveConsoleOutput(runDir string, stage config.Stage, benchmarkCase config.Case, hostAlias, output string) (AnalysisInput, error) {
+	name := cacheFileName(hostAlias)
+	if benchmarkCase.Name != "" {
+		name = cacheFileName(benchmarkCase.Name) + "." + name
+	}
+	file := path.Join(consoleDir, cacheFileName(stage.Name), name+".log")
+	localPath := filepath.Join(runDir, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return AnalysisInput{}, fmt.Errorf("save console output of stage %s: %w", stage.Name, err)
+	}
+	if err := os.WriteFile(localPath, []byte(output), 0644); err != nil {
+		return AnalysisInput{}, fmt.Errorf("save console output of stage %s: %w", stage.Name, err)
+	}
+	return AnalysisInput{Stage: stage.Name, File: file, Host: hostAlias}, nil
+}
+
+// AnalyzeStoredRun runs the analysis phase of a stored run again on its collected
+// data, with the metrics_from_output rules, output formats, and expectations of
+// the stages of cfg, or of the config snapshot of the run when cfg is nil. The
+// metrics of an earlier analysis are replaced, and the metadata is saved.
+//
+// A failed analysis marks the run as failed and is returned. A passing analysis
+// marks a run successful again only when an earlier analysis failed it.
+func AnalyzeStoredRun(ctx context.Context, store ResultStore, runID string, cfg *config.Config) (*RunMetadata, error) {
+	metadata, err := store.LoadMetadata(ctx, runID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading run metadata: %w", err)
+	}
+	if len(metadata.Trials) > 0 {
+		return nil, fmt.Errorf("run %s ran %d trials, whose metrics benchctl analyze cannot derive again", runID, len(metadata.Trials))
+	}
+	analysis := metadata.Analysis
+	if analysis == nil {
+		return nil, fmt.Errorf("run %s recorded no analysis inputs", runID)
+	}
+	if cfg == nil {
+		cfg = metadata.Config
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("run %s has no config snapshot", runID)
+	}
+	stages := make(map[string]config.Stage, len(cfg.Stages))
+	for _, stage := range cfg.Stages {
+		stages[stage.Name] = stage
+	}
+
+	for _, name := range analysis.Metrics {
+		delete(metadata.Custom, name)
+	}
+	analysis.Metrics = nil
+
+	logger := slog.Default()
+	var errs []error
+	derived := map[string]string{}
+	fanOut := fanOutMetrics{}
+	for _, input := range analysis.Inputs {
+		stage, ok := stages[input.Stage]
+		if !ok {
+			logger.Warn("analysis input skipped: stage not in config", "stage", input.Stage, "file", input.File)
+			continue
+		}
+		metrics, err := analyzeInput(ctx, store, runID, stage, input, logger)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if input.Output == "" && input.Host != "" {
+			metrics = fanOut.add(stage, resolveStageHosts(stage), input.Host, metrics)
+		}
+		maps.Copy(derived, metrics)
+	}
+	addDerivedMetrics(metadata, derived)
+	for _, name := range analysis.Stages {
+		if stage, ok := stages[name]; ok {
+			if err := checkExpectations(stage, metadata); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	previous := analysis.Error
+	now := clockFrom(ctx).Now()
+	analysis.Skipped = false
+	analysis.Error = ""
+	analysis.AnalyzedAt = &now
+	analysisErr := errors.Join(errs...)
+	switch {
+	case analysisErr != nil:
+		analysis.Error = analysisErr.Error()
+		if metadata.Status != "failed" || metadata.Error == analysisFailure(previous) {
+			metadata.Error = analysisFailure(analysis.Error)
+		}
+		metadata.Status = "failed"
+	case previous != "" && metadata.Error == analysisFailure(previous):
+		metadata.Status = "success"
+		metadata.Error = ""
+	}
+	if err := store.SaveMetadata(ctx, runID, metadata); err != nil {
+		return nil, fmt.Errorf("error writing run metadata: %w", err)
+	}
+	if local, ok := store.(*LocalStore); ok {
+		if err := appendHistory(local.dir, metadata); err != nil {
+			logError(logger, "history append failed", err, "run_id", runID)
+		}
+	}
+	return metadata, analysisErr
+}
+
+func analysisFailure(message string) string {
+	return "analysis failed: " + message
+}
+
+func analyzeInput(ctx context.Context, store ResultStore, runID string, stage config.Stage, input AnalysisInput, logger *slog.Logger) (map[string]string, error) {
+	if input.Output != "" {
+		output, ok := stageOutput(stage, input.Output)
+		if !ok || !isPrometheusOutput(output, output.RemotePath) {
+			return nil, nil
+		}
+	}
+	file, err := store.OpenArtifact(ctx, runID, input.File)
+	if err != nil {
+		return nil, fmt.Errorf("analysis input %s: %w", input.File, err)
+	}
+	if input.Output != "" {
+		metrics, err := readPrometheusMetrics(input.Output, path.Base(input.File), file)
+		if err != nil {
+			return nil, fmt.Errorf("output %s for stage %s: %w", input.Output, stage.Name, err)
+		}
+		logger.Info("output metrics parsed", "output", input.Output, "metrics", len(metrics))
+		return metrics, nil
+	}
+	defer file.Close()
+	output, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("analysis input %s: %w", input.File, err)
+	}
+	return scrapeOutputMetrics(stage, string(output), logger), nil
+}
+
+// stageOutput returns the output of stage whose name, with templates matching any
+// text, matches the resolved name of a collected output. The files of a remote_path
+// pattern are named <name>.<file>.
+func stageOutput(stage config.Stage, name string) (config.Output, bool) {
+	for _, output := range stage.Outputs {
+		pattern := outputTemplatePattern.ReplaceAllString(output.Name, "*")
+		if ok, _ := path.Match(pattern, name); ok {
+			return output, true
+		}
+		if hasGlob(output.RemotePath) {
+			if ok, _ := path.Match(pattern+".*", name); ok {
+				return output, true
+			}
+		}
+	}
+	return config.Output{}, false
+}
@@ -0,0 +1,104 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestAnalyzeStoredRunCompletesSkippedAnalysis(t *testing.T) {
+	remoteDir := t.TempDir()
+	promPath := filepath.Join(remoteDir, "server.prom")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "deferred", OutputDir: t.TempDir(), SkipAnalysis: true},
+		Stages: []config.Stage{
+			{
+				Name:              "load",
+				Command:           "echo 'Requests/sec: 1500'; printf 'errors_total 3\\n' > '" + promPath + "'",
+				MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}},
+				Outputs:           []config.Output{{Name: "server", RemotePath: promPath}},
+				Expect:            []string{"rps >= 1000", "server_errors_total < 1"},
+			},
+		},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	store, runID := localRun(result.RunDir)
+	metadata, err := store.LoadMetadata(context.Background(), runID)
+	if err != nil {
+		t.Fatalf("LoadMetadata: %v", err)
+	}
+	if metadata.Status != "success" || len(metadata.Custom) != 0 {
+		t.Fatalf("expected an unanalyzed successful run, got status %s metrics %v", metadata.Status, metadata.Custom)
+	}
+	analysis := metadata.Analysis
+	if analysis == nil || !analysis.Skipped || len(analysis.Inputs) != 2 || len(analysis.Stages) != 1 {
+		t.Fatalf("analysis = %+v", analysis)
+	}
+	if analysis.Inputs[0].File != "console/load/local.log" || analysis.Inputs[1].Output != "server" {
+		t.Fatalf("analysis inputs = %+v", analysis.Inputs)
+	}
+
+	analyzed, err := AnalyzeStoredRun(context.Background(), store, runID, nil)
+	if err == nil || !strings.Contains(err.Error(), "server_errors_total < 1 (got 3)") {
+		t.Fatalf("expected the deferred expectation to fail, got %v", err)
+	}
+	if analyzed.Custom["rps"] != "1500" || analyzed.Custom["server_errors_total"] != "3" {
+		t.Fatalf("metrics = %v", analyzed.Custom)
+	}
+	saved, err := store.LoadMetadata(context.Background(), runID)
+	if err != nil {
+		t.Fatalf("LoadMetadata: %v", err)
+	}
+	if saved.Analysis.Skipped || saved.Analysis.AnalyzedAt == nil || saved.Status != "failed" || !strings.HasPrefix(saved.Error, "analysis failed: ") {
+		t.Fatalf("saved metadata: status %s error %q analysis %+v", saved.Status, saved.Error, saved.Analysis)
+	}
+}
+
+func TestAnalyzeStoredRunAppliesChangedAnalysis(t *testing.T) {
+	stage := config.Stage{
+		Name:              "load",
+		Command:           "echo 'Requests/sec: 1500'",
+		MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}},
+		Expect:            []string{"rps >= 1000"},
+	}
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "reanalyze", OutputDir: t.TempDir()},
+		Stages:    []config.Stage{stage},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, map[string]string{"branch": "main"}, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	store, runID := localRun(result.RunDir)
+
+	changed := cfg.Clone()
+	changed.Stages[0].MetricsFromOutput = []config.OutputMetric{{Name: "throughput", Pattern: `Requests/sec:\s+(\d+)`}}
+	changed.Stages[0].Expect = []string{"throughput >= 2000"}
+	metadata, err := AnalyzeStoredRun(context.Background(), store, runID, changed)
+	if err == nil || !strings.Contains(err.Error(), "throughput >= 2000 (got 1500)") {
+		t.Fatalf("expected the changed expectation to fail, got %v", err)
+	}
+	if _, ok := metadata.Custom["rps"]; ok || metadata.Custom["throughput"] != "1500" || metadata.Custom["branch"] != "main" {
+		t.Fatalf("expected rps to be replaced by throughput, got %v", metadata.Custom)
+	}
+	if metadata.Status != "failed" {
+		t.Fatalf("status = %s", metadata.Status)
+	}
+
+	changed.Stages[0].Expect = []string{"throughput >= 1000"}
+	metadata, err = AnalyzeStoredRun(context.Background(), store, runID, changed)
+	if err != nil {
+		t.Fatalf("AnalyzeStoredRun: %v", err)
+	}
+	if metadata.Status != "success" || metadata.Error != "" || metadata.Analysis.Error != "" {
+		t.Fatalf("expected the passing analysis to restore success, got %s %q %+v", metadata.Status, metadata.Error, metadata.Analysis)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/luccadibe/benchctl/internal/config"
@@ -18,18 +20,42 @@ const BackgroundTerminationGrace = 2 * time.Second
 
 const backgroundCheckInterval = 200 * time.Millisecond
 
+// TeardownGrace defines how long the teardown of a cancelled run may take to
+// stop its background stages and run its cleanup steps.
+const TeardownGrace = 2 * time.Minute
+
+// teardownContext returns the context stopping the background stages and running
+// the cleanup steps of a run. It outlives the cancellation of ctx, e.g. by an
+// interrupt or the run timeout, so that a cancelled run does not leave services
+// running on its hosts, and then ends TeardownGrace later.
+func teardownContext(ctx context.Context, logger *slog.Logger) (context.Context, context.CancelFunc) {
+	teardownCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		logger.Warn("run cancelled; tearing down", "grace", TeardownGrace)
+		time.AfterFunc(TeardownGrace, cancel)
+	})
+	return teardownCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
 // backgroundStage tracks a running background stage.
 type backgroundStage struct {
 	stage     config.Stage
 	host      config.Host
 	outputEnv map[string]string
 	pid       string
+	startedAt time.Time
 }
 
 // backgroundManager coordinates background stages
 type backgroundManager struct {
-	logger *slog.Logger
-	stages []backgroundStage
+	mu       sync.Mutex
+	logger   *slog.Logger
+	stages   []backgroundStage
+	metrics  map[string]string // parsed from collected outputs
+	analysis *Analysis         // records the collected outputs
 }
 
 func newBackgroundManager(logger *slog.Logger) *backgroundManager {
@@ -37,6 +63,8 @@ func newBackgroundManager(logger *slog.Logger) *backgroundManager {
 }
 
 func (m *backgroundManager) Add(record backgroundStage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.stages = append(m.stages, record)
 }
 
@@ -57,7 +85,7 @@ func (m *backgroundManager) StopAll(ctx context.Context, runDir string) error {
 func (m *backgroundManager) stopStage(ctx context.Context, runDir string, record backgroundStage) error {
 	m.logger.Info("stopping background stage", "stage", record.stage.Name, "pid", record.pid)
 
-	client, err := openExecutionClient(record.host)
+	client, err := openExecutionClient(ctx, record.host)
 	if err != nil {
 		err = fmt.Errorf("background stage %s: %w", record.stage.Name, err)
 		m.logger.Error("background stage stop failed", "stage", record.stage.Name, "error", err)
@@ -65,13 +93,23 @@ func (m *backgroundManager) stopStage(ctx context.Context, runDir string, record
 	}
 	defer client.Close()
 
-	if err := terminatePID(ctx, client, record.stage.Name, record.pid, m.logger); err != nil {
+	if err := terminatePID(ctx, client, record.stage.Name, record.pid, killCommand(record.stage), m.logger); err != nil {
 		m.logger.Error("background stage stop failed", "stage", record.stage.Name, "pid", record.pid, "error", err)
 		return err
 	}
 
 	if len(record.stage.Outputs) > 0 {
-		if err := collectStageOutputs(ctx, client, runDir, record.stage, m.logger, record.outputEnv); err != nil {
+		collected, err := collectStageOutputs(ctx, client, runDir, record.stage, m.logger, record.outputEnv, record.startedAt)
+		m.analysis.addOutputs(record.stage, collected)
+		if !m.analysis.skipped() {
+			metrics, parseErr := outputMetrics(runDir, record.stage, collected, m.logger)
+			err = errors.Join(err, parseErr)
+			if m.metrics == nil {
+				m.metrics = map[string]string{}
+			}
+			maps.Copy(m.metrics, metrics)
+		}
+		if err != nil {
 			m.logger.Warn("background stage outputs failed to collect", "stage", record.stage.Name, "error", err)
 		}
 	}
@@ -79,26 +117,35 @@ func (m *backgroundManager) stopStage(ctx context.Context, runDir string, record
 	return nil
 }
 
-// terminatePID sends a SIGTERM to the process and waits for it to exit.
-func terminatePID(ctx context.Context, client execution.ExecutionClient, stageName, pid string, logger *slog.Logger) error {
-	termCmd := fmt.Sprintf("kill -TERM -%s >/dev/null 2>&1 || true", pid)
+// killCommand is the command signalling the processes of a background stage,
+// through sudo when the stage runs with become.
+func killCommand(stage config.Stage) string {
+	if stage.Become {
+		return "sudo -n kill"
+	}
+	return "kill"
+}
+
+// terminatePID sends a SIGTERM to the process with kill and waits for it to exit.
+func terminatePID(ctx context.Context, client execution.ExecutionClient, stageName, pid, kill string, logger *slog.Logger) error {
+	termCmd := fmt.Sprintf("%s -TERM -%s >/dev/null 2>&1 || true", kill, pid)
 	_, _ = client.RunCommand(ctx, execution.CommandRequest{Command: termCmd, DisableCapture: true})
 
 	select {
-	case <-time.After(BackgroundTerminationGrace):
+	case <-clockFrom(ctx).After(BackgroundTerminationGrace):
 	case <-ctx.Done():
 		return ctx.Err()
 	}
 
-	alive, err := processAlive(ctx, client, pid)
+	alive, err := processAlive(ctx, client, pid, kill)
 	if err != nil {
 		return fmt.Errorf("background stage %s: %w", stageName, err)
 	}
 
 	if alive {
-		killCmd := fmt.Sprintf("kill -KILL -%s >/dev/null 2>&1 || true", pid)
+		killCmd := fmt.Sprintf("%s -KILL -%s >/dev/null 2>&1 || true", kill, pid)
 		_, _ = client.RunCommand(ctx, execution.CommandRequest{Command: killCmd, DisableCapture: true})
-		if err := waitForExit(ctx, client, pid); err != nil {
+		if err := waitForExit(ctx, client, pid, kill); err != nil {
 			logger.Warn("background stage still running", "stage", stageName, "error", err)
 		}
 	}
@@ -106,20 +153,11 @@ func terminatePID(ctx context.Context, client execution.ExecutionClient, stageNa
 	return nil
 }
 
-// processAlive checks if a process is still running by sending a SIG0.
-func processAlive(ctx context.Context, client execution.ExecutionClient, pid string) (bool, error) {
+// processAlive checks if a process group, or else the process, is still running
+// by sending a SIG0. Both checks run in one command to poll with one session.
+func processAlive(ctx context.Context, client execution.ExecutionClient, pid, kill string) (bool, error) {
 	res, err := client.RunCommand(ctx, execution.CommandRequest{
-		Command:        fmt.Sprintf("kill -0 -%s >/dev/null 2>&1", pid),
-		DisableCapture: true,
-	})
-	if err != nil && res.ExitCode == -1 {
-		return false, err
-	}
-	if res.ExitCode == 0 {
-		return true, nil
-	}
-	res, err = client.RunCommand(ctx, execution.CommandRequest{
-		Command:        fmt.Sprintf("kill -0 %s >/dev/null 2>&1", pid),
+		Command:        fmt.Sprintf("%s -0 -%s >/dev/null 2>&1 || %s -0 %s >/dev/null 2>&1", kill, pid, kill, pid),
 		DisableCapture: true,
 	})
 	if err != nil && res.ExitCode == -1 {
@@ -129,10 +167,11 @@ func processAlive(ctx context.Context, client execution.ExecutionClient, pid str
 }
 
 // waitForExit waits for a process to exit.
-func waitForExit(ctx context.Context, client execution.ExecutionClient, pid string) error {
-	deadline := time.Now().Add(BackgroundTerminationGrace)
-	for time.Now().Before(deadline) {
-		alive, err := processAlive(ctx, client, pid)
+func waitForExit(ctx context.Context, client execution.ExecutionClient, pid, kill string) error {
+	clock := clockFrom(ctx)
+	deadline := clock.Now().Add(BackgroundTerminationGrace)
+	for clock.Now().Before(deadline) {
+		alive, err := processAlive(ctx, client, pid, kill)
 		if err != nil {
 			return err
 		}
@@ -140,7 +179,7 @@ func waitForExit(ctx context.Context, client execution.ExecutionClient, pid stri
 			return nil
 		}
 		select {
-		case <-time.After(backgroundCheckInterval):
+		case <-clock.After(backgroundCheckInterval):
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -148,10 +187,51 @@ func waitForExit(ctx context.Context, client execution.ExecutionClient, pid stri
 	return fmt.Errorf("process %s still running after SIGKILL", pid)
 }
 
-func openExecutionClient(host config.Host) (execution.ExecutionClient, error) {
-	if strings.TrimSpace(host.IP) == "" {
+// ClientFactory opens the execution client of a host; the host of local stages
+// has no IP.
+type ClientFactory func(host config.Host) (execution.ExecutionClient, error)
+
+type clientFactoryKey struct{}
+
+// WithClientFactory returns a context whose runs open every execution client,
+// local ones included, with factory instead of running commands locally or over SSH.
+func WithClientFactory(ctx context.Context, factory ClientFactory) context.Context {
+	return context.WithValue(ctx, clientFactoryKey{}, factory)
+}
+
+func openExecutionClient(ctx context.Context, host config.Host) (execution.ExecutionClient, error) {
+	client, err := dialExecutionClient(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if isWindowsHost(host) {
+		client = execution.NewWindowsClient(client, strings.TrimSpace(host.Shell))
+	}
+	return traceClient(ctx, client, host), nil
+}
+
+// isLocalHost reports whether the commands on host run on this machine: it has no
+// IP and is neither a kubernetes nor a provisioned host.
+func isLocalHost(host config.Host) bool {
+	return strings.TrimSpace(host.IP) == "" && host.Type != "kubernetes" && host.Provision == nil
+}
+
+func dialExecutionClient(ctx context.Context, host config.Host) (execution.ExecutionClient, error) {
+	if factory, ok := ctx.Value(clientFactoryKey{}).(ClientFactory); ok && factory != nil {
+		return factory(host)
+	}
+	if host.Type == "kubernetes" {
+		return execution.NewKubernetesClient(ctx, host)
+	}
+	if host.Provision != nil && strings.TrimSpace(host.IP) == "" {
+		return nil, errors.New("provisioned host has no instance outside of benchctl run")
+	}
+	if isLocalHost(host) {
 		return execution.NewLocalClient(), nil
 	}
-	return execution.NewSSHClient(host)
+	if pool, ok := ctx.Value(connectionPoolKey{}).(*connectionPool); ok {
+		return pool.client(ctx, host)
+	}
+	return execution.DialSSH(host, runLogger(ctx))
 }
 
@@ -52,7 +52,7 @@ func TestTerminatePIDStopsProcess(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := terminatePID(ctx, client, "sleep-stage", pid, logger); err != nil {
+	if err := terminatePID(ctx, client, "sleep-stage", pid, "kill", logger); err != nil {
 		t.Fatalf("terminatePID returned error: %v", err)
 	}
 
@@ -92,7 +92,7 @@ func TestTerminatePIDStopsProcessGroup(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := terminatePID(ctx, client, "bg-stage", pid, logger); err != nil {
+	if err := terminatePID(ctx, client, "bg-stage", pid, "kill", logger); err != nil {
 		t.Fatalf("terminatePID returned error: %v", err)
 	}
 
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SelectRun returns the ID of the latest stored run matching query, such as
+// "latest tag=nightly branch=main", other than exclude, so CI can compare a run
+// against a baseline without knowing its ID. Each key=value term must hold:
+// status, branch, and commit (by prefix) match the run and its git metadata, and
+// any other key matches the custom metadata given with --metadata. Only
+// successful runs match unless the query sets a status.
+func SelectRun(ctx context.Context, store ResultStore, query, exclude string) (string, error) {
+	terms := strings.Fields(query)
+	if len(terms) > 0 && terms[0] == "latest" {
+		terms = terms[1:]
+	}
+	filters := make(map[string]string, len(terms))
+	for _, term := range terms {
+		key, value, ok := strings.Cut(term, "=")
+		if !ok || key == "" {
+			return "", fmt.Errorf("invalid run query term %q: expected key=value", term)
+		}
+		filters[key] = value
+	}
+	if _, ok := filters["status"]; !ok {
+		filters["status"] = "success"
+	}
+
+	runIDs, err := store.ListRuns(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, runID := range slices.Backward(runIDs) {
+		if runID == exclude {
+			continue
+		}
+		metadata, err := store.LoadMetadata(ctx, runID)
+		if err != nil {
+			continue // a run still being written or damaged cannot be a baseline
+		}
+		if runMatches(metadata, filters) {
+			return runID, nil
+		}
+	}
+	return "", fmt.Errorf("no run matches %q", query)
+}
+
+// runMatches reports whether metadata satisfies every filter of a run query.
+func runMatches(metadata *RunMetadata, filters map[string]string) bool {
+	for key, value := range filters {
+		switch key {
+		case "status":
+			if metadata.Status != value {
+				return false
+			}
+		case "branch":
+			if metadata.Git == nil || metadata.Git.Branch != value {
+				return false
+			}
+		case "commit":
+			if metadata.Git == nil || value == "" || !strings.HasPrefix(metadata.Git.Commit, value) {
+				return false
+			}
+		default:
+			if actual, ok := metadata.Custom[key]; !ok || actual != value {
+				return false
+			}
+		}
+	}
+	return true
+}
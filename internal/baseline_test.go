@@ -0,0 +1,56 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelectRunMatchesMetadata(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStore(dir)
+	runs := []*RunMetadata{
+		{RunID: "1", Status: "success", Git: &GitMetadata{Branch: "main", Commit: "aaa111"}, Custom: map[string]string{"tag": "nightly"}},
+		{RunID: "2", Status: "success", Git: &GitMetadata{Branch: "main", Commit: "bbb222"}, Custom: map[string]string{"tag": "nightly"}},
+		{RunID: "3", Status: "failed", Git: &GitMetadata{Branch: "main", Commit: "ccc333"}, Custom: map[string]string{"tag": "nightly"}},
+		{RunID: "4", Status: "success", Git: &GitMetadata{Branch: "feature", Commit: "ddd444"}},
+	}
+	for _, metadata := range runs {
+		if err := os.Mkdir(filepath.Join(dir, metadata.RunID), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveMetadata(context.Background(), metadata.RunID, metadata); err != nil {
+			t.Fatalf("SaveMetadata: %v", err)
+		}
+	}
+
+	tests := []struct {
+		query, exclude, want string
+	}{
+		{query: "latest", exclude: "4", want: "2"},
+		{query: "latest tag=nightly branch=main", want: "2"},
+		{query: "latest tag=nightly branch=main status=failed", want: "3"},
+		{query: "branch=main", exclude: "3", want: "2"},
+		{query: "commit=aaa", want: "1"},
+	}
+	for _, tt := range tests {
+		got, err := SelectRun(context.Background(), store, tt.query, tt.exclude)
+		if err != nil || got != tt.want {
+			t.Fatalf("SelectRun(%q, exclude %q) = %q, %v; want %q", tt.query, tt.exclude, got, err, tt.want)
+		}
+	}
+
+	if _, err := SelectRun(context.Background(), store, "latest tag=weekly", ""); err == nil || !strings.Contains(err.Error(), `no run matches "latest tag=weekly"`) {
+		t.Fatalf("expected no match, got %v", err)
+	}
+	if _, err := SelectRun(context.Background(), store, "commit=ccc", ""); err == nil {
+		t.Fatalf("expected the failed run to need status=failed")
+	}
+	if _, err := SelectRun(context.Background(), store, "latest main", ""); err == nil || !strings.Contains(err.Error(), "expected key=value") {
+		t.Fatalf("expected an invalid term error, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// checkBecome verifies that sudo lets the stage become its user on the host and
+// returns the password to send to sudo, which is empty when sudo allows NOPASSWD.
+func checkBecome(ctx context.Context, client execution.ExecutionClient, stage config.Stage, host config.Host, hostAlias string) (string, error) {
+	if host.BecomePassword == "" {
+		result, err := client.RunCommand(ctx, execution.CommandRequest{Command: sudoCommand(stage, false) + " true"})
+		if err != nil || result.ExitCode != 0 {
+			return "", fmt.Errorf("stage %s: sudo on host %s requires a password: allow NOPASSWD in sudoers or set hosts.%s.become_password: %s",
+				stage.Name, hostAlias, hostAlias, sudoFailure(result, err))
+		}
+		return "", nil
+	}
+	if stage.Background {
+		return "", fmt.Errorf("stage %s: background stages can only become with NOPASSWD sudo, but hosts.%s.become_password is set", stage.Name, hostAlias)
+	}
+	if stage.PipeFrom != "" {
+		return "", fmt.Errorf("stage %s: stages reading pipe_from can only become with NOPASSWD sudo, but hosts.%s.become_password is set", stage.Name, hostAlias)
+	}
+	if stage.Duration != "" {
+		return "", fmt.Errorf("stage %s: stages with a duration can only become with NOPASSWD sudo, but hosts.%s.become_password is set", stage.Name, hostAlias)
+	}
+	password, err := config.ResolveSecret(host.BecomePassword)
+	if err != nil {
+		return "", fmt.Errorf("stage %s: hosts.%s.become_password: %w", stage.Name, hostAlias, err)
+	}
+	result, err := client.RunCommand(ctx, execution.CommandRequest{
+		Command: sudoCommand(stage, true) + " true",
+		Stdin:   strings.NewReader(password + "\n"),
+	})
+	if err != nil || result.ExitCode != 0 {
+		return "", fmt.Errorf("stage %s: sudo on host %s rejected hosts.%s.become_password: %s", stage.Name, hostAlias, hostAlias, sudoFailure(result, err))
+	}
+	return password, nil
+}
+
+// becomeCommand runs the shell invocation of a stage through sudo. sudo resets
+// the environment, so the stage environment is passed again through env.
+func becomeCommand(commandBody string, stage config.Stage, env map[string]string, password bool) string {
+	return fmt.Sprintf("%s env %s %s", sudoCommand(stage, password), strings.Join(envAssignments(env), " "), commandBody)
+}
+
+// sudoCommand is the sudo invocation of a stage: non-interactive with NOPASSWD,
+// or reading the password from stdin without a prompt.
+func sudoCommand(stage config.Stage, password bool) string {
+	command := "sudo -n"
+	if password {
+		command = "sudo -S -p ''"
+	}
+	if user := strings.TrimSpace(stage.BecomeUser); user != "" {
+		command += " -u " + shellQuote(user)
+	}
+	return command + " --"
+}
+
+func sudoFailure(result execution.CommandResult, err error) string {
+	if output := strings.TrimSpace(result.Output); output != "" {
+		return output
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("exit code %d", result.ExitCode)
+}
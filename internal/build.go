@@ -0,0 +1,403 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// ArtifactMetadata records the artifact of a build stage and the hosts it was installed on.
+type ArtifactMetadata struct {
+	Stage      string `json:"stage"`
+	Platform   string `json:"platform,omitempty"` // "<os>/<arch>" of per_platform artifacts
+	Path       string `json:"path,omitempty"`
+	Image      string `json:"image,omitempty"`
+	RemotePath string `json:"remote_path,omitempty"`
+	Digest     string `json:"digest"`
+	SizeBytes  int64  `json:"size_bytes"`
+	// StartupMS is the median startup time of the binary on StartupHost, the
+	// first host it was installed on.
+	StartupMS   *float64 `json:"startup_ms,omitempty"`
+	StartupHost string   `json:"startup_host,omitempty"`
+	Hosts       []string `json:"hosts,omitempty"`
+}
+
+// metrics returns the artifact measurements as numeric custom metadata entries,
+// so they take part in compare and export like any other run metric.
+// Per-platform artifacts are keyed by stage and platform, e.g. agent_linux_arm64.
+func (a ArtifactMetadata) metrics() map[string]string {
+	prefix := a.Stage
+	if a.Platform != "" {
+		prefix += "_" + strings.ReplaceAll(a.Platform, "/", "_")
+	}
+	metrics := map[string]string{
+		prefix + "_artifact_size_bytes": strconv.FormatInt(a.SizeBytes, 10),
+	}
+	if a.StartupMS != nil {
+		metrics[prefix+"_startup_ms"] = strconv.FormatFloat(*a.StartupMS, 'f', 3, 64)
+	}
+	return metrics
+}
+
+// buildStageRun carries what a build stage needs from the surrounding workflow.
+type buildStageRun struct {
+	cfg           *config.Config
+	stage         config.Stage
+	benchmarkCase config.Case
+	runID, runDir string
+	envVars       map[string]string
+	logger        *slog.Logger
+	console       io.Writer
+	logOutput     bool
+}
+
+// executeBuildStage runs the build command locally, records the artifact digest,
+// and installs the artifact on every stage host. A per_platform artifact is built
+// once for every OS/architecture among the stage hosts and installed on the hosts
+// of that platform.
+func executeBuildStage(ctx context.Context, build buildStageRun) ([]ArtifactMetadata, error) {
+	hostAliases := resolveStageHosts(build.stage)
+	if !build.stage.Artifact.PerPlatform {
+		artifact, err := buildArtifact(ctx, build, *build.stage.Artifact, hostAliases, "")
+		return []ArtifactMetadata{artifact}, err
+	}
+
+	platforms, hostsByPlatform, err := detectHostPlatforms(ctx, build, hostAliases)
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []ArtifactMetadata
+	for _, platform := range platforms {
+		artifact, err := buildArtifact(ctx, build, *build.stage.Artifact, hostsByPlatform[platform], platform)
+		artifacts = append(artifacts, artifact)
+		if err != nil {
+			return artifacts, err
+		}
+	}
+	return artifacts, nil
+}
+
+// buildArtifact builds spec and installs it on hostAliases. For a per_platform
+// artifact, platform is the target "<os>/<arch>": the build command gets it as
+// GOOS/GOARCH and BENCHCTL_GOOS/BENCHCTL_GOARCH, and the artifact paths may
+// reference those variables.
+func buildArtifact(ctx context.Context, build buildStageRun, spec config.Artifact, hostAliases []string, platform string) (ArtifactMetadata, error) {
+	stage := build.stage
+	env := buildStageEnv(build.runID, build.runDir, build.cfg, build.envVars, build.benchmarkCase, "local")
+	if platform != "" {
+		goos, goarch, _ := strings.Cut(platform, "/")
+		env["GOOS"], env[EnvGOOS] = goos, goos
+		env["GOARCH"], env[EnvGOARCH] = goarch, goarch
+		var err error
+		if spec.Path, err = expandTemplate(spec.Path, env); err != nil {
+			return ArtifactMetadata{Stage: stage.Name, Platform: platform}, fmt.Errorf("stage %s artifact.path: %w", stage.Name, err)
+		}
+		if spec.RemotePath, err = expandTemplate(spec.RemotePath, env); err != nil {
+			return ArtifactMetadata{Stage: stage.Name, Platform: platform}, fmt.Errorf("stage %s artifact.remote_path: %w", stage.Name, err)
+		}
+	}
+	artifact := ArtifactMetadata{
+		Stage:      stage.Name,
+		Platform:   platform,
+		Path:       spec.Path,
+		Image:      spec.Image,
+		RemotePath: spec.RemotePath,
+	}
+
+	local, err := openExecutionClient(ctx, config.Host{})
+	if err != nil {
+		return artifact, err
+	}
+	defer local.Close()
+	commandBody, err := prepareStageCommand(ctx, stage, config.Host{}, build.runID, local, build.logger)
+	if err != nil {
+		return artifact, err
+	}
+	commandBody = wrapWithShell(commandBody, resolveStageShell(build.cfg, stage, "local"))
+
+	result, err := local.RunCommand(ctx, execution.CommandRequest{
+		Command: envPrefixFromMap(env) + commandBody,
+		Stdout:  build.console,
+		Stderr:  build.console,
+		UsePTY:  build.console != nil,
+	})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("command exited with code %d", result.ExitCode)
+	}
+	if build.logOutput && strings.TrimSpace(result.Output) != "" {
+		build.logger.Info("stage output", "stage", stage.Name, "output", result.Output)
+	}
+	if err != nil {
+		return artifact, fmt.Errorf("stage %s failed: %w (exit code: %d)", stage.Name, err, result.ExitCode)
+	}
+
+	artifact.Digest, err = artifactDigest(ctx, local, &spec)
+	if err != nil {
+		return artifact, fmt.Errorf("stage %s artifact: %w", stage.Name, err)
+	}
+	artifact.SizeBytes, err = artifactSize(ctx, local, &spec)
+	if err != nil {
+		return artifact, fmt.Errorf("stage %s artifact: %w", stage.Name, err)
+	}
+	builtArgs := []any{"stage", stage.Name, "digest", artifact.Digest, "size_bytes", artifact.SizeBytes}
+	if platform != "" {
+		builtArgs = append(builtArgs, "platform", platform)
+	}
+	build.logger.Info("artifact built", builtArgs...)
+
+	for _, hostAlias := range hostAliases {
+		host, ok := build.cfg.Hosts[hostAlias]
+		if !ok && hostAlias != "local" {
+			return artifact, fmt.Errorf("stage %s references unknown host %s", stage.Name, hostAlias)
+		}
+		if err := installArtifact(ctx, build, &spec, host); err != nil {
+			return artifact, fmt.Errorf("stage %s: install artifact on %s: %w", stage.Name, hostAlias, err)
+		}
+		artifact.Hosts = append(artifact.Hosts, hostAlias)
+		build.logger.Info("artifact installed", "stage", stage.Name, "host", hostAlias)
+	}
+
+	if startup := spec.Startup; startup != nil && len(artifact.Hosts) > 0 {
+		hostAlias := artifact.Hosts[0]
+		median, err := measureStartup(ctx, build.cfg.Hosts[hostAlias], spec.RemotePath, startup)
+		if err != nil {
+			return artifact, fmt.Errorf("stage %s startup on %s: %w", stage.Name, hostAlias, err)
+		}
+		artifact.StartupMS = &median
+		artifact.StartupHost = hostAlias
+		build.logger.Info("artifact startup measured", "stage", stage.Name, "host", hostAlias, "startup_ms", median)
+	}
+	return artifact, nil
+}
+
+// detectHostPlatforms returns the distinct platforms of hostAliases in the order
+// they first appear, and the hosts of each.
+func detectHostPlatforms(ctx context.Context, build buildStageRun, hostAliases []string) ([]string, map[string][]string, error) {
+	var platforms []string
+	hostsByPlatform := map[string][]string{}
+	for _, hostAlias := range hostAliases {
+		host, ok := build.cfg.Hosts[hostAlias]
+		if !ok && hostAlias != "local" {
+			return nil, nil, fmt.Errorf("stage %s references unknown host %s", build.stage.Name, hostAlias)
+		}
+		client, err := openExecutionClient(ctx, host)
+		if err != nil {
+			return nil, nil, fmt.Errorf("stage %s: detect platform of %s: %w", build.stage.Name, hostAlias, err)
+		}
+		result, err := client.RunCommand(ctx, execution.CommandRequest{Command: "uname -s -m"})
+		_ = client.Close()
+		if err == nil && result.ExitCode != 0 {
+			err = fmt.Errorf("uname exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+		}
+		var platform string
+		if err == nil {
+			platform, err = parseUnamePlatform(result.Output)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("stage %s: detect platform of %s: %w", build.stage.Name, hostAlias, err)
+		}
+		build.logger.Info("host platform detected", "stage", build.stage.Name, "host", hostAlias, "platform", platform)
+		if _, ok := hostsByPlatform[platform]; !ok {
+			platforms = append(platforms, platform)
+		}
+		hostsByPlatform[platform] = append(hostsByPlatform[platform], hostAlias)
+	}
+	return platforms, hostsByPlatform, nil
+}
+
+// unameArchs maps uname -m machine names to GOARCH values.
+var unameArchs = map[string]string{
+	"x86_64":  "amd64",
+	"amd64":   "amd64",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"armv6l":  "arm",
+	"armv7l":  "arm",
+	"i386":    "386",
+	"i686":    "386",
+	"riscv64": "riscv64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+// parseUnamePlatform converts the output of "uname -s -m" into "<GOOS>/<GOARCH>".
+func parseUnamePlatform(output string) (string, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 2 {
+		return "", fmt.Errorf("unexpected uname output %q", strings.TrimSpace(output))
+	}
+	kernel, machine := fields[len(fields)-2], fields[len(fields)-1]
+	goos := strings.ToLower(kernel)
+	switch goos {
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd":
+	default:
+		return "", fmt.Errorf("unsupported operating system %q", kernel)
+	}
+	goarch, ok := unameArchs[machine]
+	if !ok {
+		return "", fmt.Errorf("unsupported architecture %q", machine)
+	}
+	return goos + "/" + goarch, nil
+}
+
+func artifactDigest(ctx context.Context, local execution.ExecutionClient, artifact *config.Artifact) (string, error) {
+	if artifact.Image != "" {
+		result, err := local.RunCommand(ctx, execution.CommandRequest{
+			Command: "docker image inspect --format '{{.Id}}' " + shellQuote(artifact.Image),
+		})
+		if err != nil || result.ExitCode != 0 {
+			return "", fmt.Errorf("inspect image %s: %s", artifact.Image, strings.TrimSpace(result.Output))
+		}
+		return strings.TrimSpace(result.Output), nil
+	}
+	return fileDigest(artifact.Path)
+}
+
+func artifactSize(ctx context.Context, local execution.ExecutionClient, artifact *config.Artifact) (int64, error) {
+	if artifact.Image != "" {
+		result, err := local.RunCommand(ctx, execution.CommandRequest{
+			Command: "docker image inspect --format '{{.Size}}' " + shellQuote(artifact.Image),
+		})
+		if err != nil || result.ExitCode != 0 {
+			return 0, fmt.Errorf("inspect image %s: %s", artifact.Image, strings.TrimSpace(result.Output))
+		}
+		return strconv.ParseInt(strings.TrimSpace(result.Output), 10, 64)
+	}
+	info, err := os.Stat(artifact.Path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// measureStartup runs the installed binary startup.Runs times on host and returns
+// the median duration in milliseconds. The runs are timed on the host, so the
+// connection to it takes no part, and follow one another, so only the first may
+// start with a cold page cache.
+func measureStartup(ctx context.Context, host config.Host, binary string, startup *config.StartupCheck) (float64, error) {
+	client, err := openExecutionClient(ctx, host)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+	runs := max(startup.Runs, 1)
+	command := fmt.Sprintf(`errors=$(mktemp) || exit 1
+i=0
+while [ $i -lt %d ]; do
+  start=$(date +%%s%%N)
+  %s %s >/dev/null 2>"$errors" || { code=$?; cat "$errors"; rm -f "$errors"; exit $code; }
+  end=$(date +%%s%%N)
+  echo "$((end - start))"
+  i=$((i + 1))
+done
+rm -f "$errors"`, runs, shellQuote(binary), startup.Args)
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: command})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("exited with code %d", result.ExitCode)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("run %s: %w: %s", binary, err, strings.TrimSpace(result.Output))
+	}
+	durations := make([]float64, 0, runs)
+	for line := range strings.FieldsSeq(result.Output) {
+		nanoseconds, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("time %s: date +%%s%%N printed %q, the host clock needs nanoseconds", binary, line)
+		}
+		durations = append(durations, float64(nanoseconds)/1e6)
+	}
+	if len(durations) != runs {
+		return 0, fmt.Errorf("time %s: expected %d durations, got %q", binary, runs, strings.TrimSpace(result.Output))
+	}
+	sort.Float64s(durations)
+	if runs%2 == 1 {
+		return durations[runs/2], nil
+	}
+	return (durations[runs/2-1] + durations[runs/2]) / 2, nil
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func installArtifact(ctx context.Context, build buildStageRun, artifact *config.Artifact, host config.Host) error {
+	isLocal := isLocalHost(host)
+	if artifact.Image != "" && isLocal {
+		return nil // the image already lives in the local docker daemon
+	}
+	if artifact.Path != "" && isLocal && sameFile(artifact.Path, artifact.RemotePath) {
+		return nil
+	}
+
+	client, err := openExecutionClient(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if artifact.Path != "" {
+		return retryTransfer(ctx, build.logger, "artifact "+artifact.Path, func(ctx context.Context) error {
+			return client.Upload(ctx, artifact.Path, artifact.RemotePath)
+		})
+	}
+
+	archive, err := os.CreateTemp("", "benchctl-image-*.tar")
+	if err != nil {
+		return fmt.Errorf("create image archive: %w", err)
+	}
+	archivePath := archive.Name()
+	_ = archive.Close()
+	defer os.Remove(archivePath)
+
+	local, err := openExecutionClient(ctx, config.Host{})
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+	save, err := local.RunCommand(ctx, execution.CommandRequest{
+		Command: fmt.Sprintf("docker save -o %s %s", shellQuote(archivePath), shellQuote(artifact.Image)),
+	})
+	if err != nil || save.ExitCode != 0 {
+		return fmt.Errorf("save image %s: %s", artifact.Image, strings.TrimSpace(save.Output))
+	}
+	remoteArchive := fmt.Sprintf("/tmp/benchctl-%s-%s.tar", build.runID, cacheFileName(build.stage.Name))
+	err = retryTransfer(ctx, build.logger, "image "+artifact.Image, func(ctx context.Context) error {
+		return client.Upload(ctx, archivePath, remoteArchive)
+	})
+	if err != nil {
+		return err
+	}
+	load, err := client.RunCommand(ctx, execution.CommandRequest{
+		Command: fmt.Sprintf("docker load -i %s; status=$?; rm -f %s; exit $status", shellQuote(remoteArchive), shellQuote(remoteArchive)),
+	})
+	if err != nil || load.ExitCode != 0 {
+		return fmt.Errorf("load image %s: %s", artifact.Image, strings.TrimSpace(load.Output))
+	}
+	return nil
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,172 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestExecuteStagesBuildStageInstallsArtifact(t *testing.T) {
+	tempDir := t.TempDir()
+	runDir := filepath.Join(tempDir, "run")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatalf("create run dir: %v", err)
+	}
+	artifactPath := filepath.Join(tempDir, "server")
+	installPath := filepath.Join(tempDir, "opt", "server")
+
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "build", OutputDir: tempDir},
+		Hosts:     map[string]config.Host{"local": {}},
+		Stages: []config.Stage{{
+			Name:     "build-server",
+			Type:     "build",
+			Command:  "printf 'binary' > '" + artifactPath + "'",
+			Artifact: &config.Artifact{Path: artifactPath, RemotePath: installPath},
+		}},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metadata := &RunMetadata{RunID: "1"}
+	if err := executeStages(context.Background(), cfg, "1", runDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+
+	installed, err := os.ReadFile(installPath)
+	if err != nil {
+		t.Fatalf("read installed artifact: %v", err)
+	}
+	if string(installed) != "binary" {
+		t.Fatalf("installed artifact = %q", installed)
+	}
+	if len(metadata.Artifacts) != 1 {
+		t.Fatalf("expected one artifact in metadata, got %#v", metadata.Artifacts)
+	}
+	artifact := metadata.Artifacts[0]
+	// sha256("binary")
+	if artifact.Digest != "sha256:9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd" {
+		t.Fatalf("digest = %s", artifact.Digest)
+	}
+	if len(artifact.Hosts) != 1 || artifact.Hosts[0] != "local" {
+		t.Fatalf("hosts = %v", artifact.Hosts)
+	}
+	if artifact.SizeBytes != 6 || metadata.Custom["build-server_artifact_size_bytes"] != "6" {
+		t.Fatalf("size = %d, custom = %v", artifact.SizeBytes, metadata.Custom)
+	}
+}
+
+func TestExecuteStagesBuildStageMeasuresStartup(t *testing.T) {
+	tempDir := t.TempDir()
+	artifactPath := filepath.Join(tempDir, "tool")
+
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "build", OutputDir: tempDir},
+		Hosts:     map[string]config.Host{"local": {}},
+		Stages: []config.Stage{{
+			Name:    "build-tool",
+			Type:    "build",
+			Command: "printf '#!/bin/sh\\nexit 0\\n' > '" + artifactPath + "' && chmod +x '" + artifactPath + "'",
+			Artifact: &config.Artifact{
+				Path:       artifactPath,
+				RemotePath: artifactPath,
+				Startup:    &config.StartupCheck{Args: "--version", Runs: 3},
+			},
+		}},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metadata := &RunMetadata{RunID: "1"}
+	if err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+	artifact := metadata.Artifacts[0]
+	if artifact.StartupMS == nil || *artifact.StartupMS <= 0 || artifact.StartupHost != "local" {
+		t.Fatalf("expected startup time to be measured on local, got %v on %q", artifact.StartupMS, artifact.StartupHost)
+	}
+	if _, ok := metadata.Custom["build-tool_startup_ms"]; !ok {
+		t.Fatalf("expected startup metric in custom metadata, got %v", metadata.Custom)
+	}
+}
+
+func TestExecuteStagesBuildStageMissingArtifact(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "build", OutputDir: tempDir},
+		Hosts:     map[string]config.Host{"local": {}},
+		Stages: []config.Stage{{
+			Name:     "build-server",
+			Type:     "build",
+			Command:  "true",
+			Artifact: &config.Artifact{Path: filepath.Join(tempDir, "missing"), RemotePath: filepath.Join(tempDir, "out")},
+		}},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, &RunMetadata{}, newBackgroundManager(logger), newNetemManager(logger), nil)
+	if err == nil || !strings.Contains(err.Error(), "stage build-server artifact") {
+		t.Fatalf("expected artifact error, got %v", err)
+	}
+}
+
+func TestExecuteStagesBuildStagePerPlatform(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "build", OutputDir: tempDir},
+		Hosts:     map[string]config.Host{"local": {}},
+		Stages: []config.Stage{{
+			Name:    "agent",
+			Type:    "build",
+			Command: `printf '%s-%s' "$GOOS" "$BENCHCTL_GOARCH" > "` + tempDir + `/agent-$GOOS-$GOARCH"`,
+			Artifact: &config.Artifact{
+				Path:        filepath.Join(tempDir, "agent-${BENCHCTL_GOOS}-${BENCHCTL_GOARCH}"),
+				RemotePath:  filepath.Join(tempDir, "opt", "agent"),
+				PerPlatform: true,
+			},
+		}},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metadata := &RunMetadata{RunID: "1"}
+	if err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	installed, err := os.ReadFile(filepath.Join(tempDir, "opt", "agent"))
+	if err != nil || string(installed) != runtime.GOOS+"-"+runtime.GOARCH {
+		t.Fatalf("installed artifact = %q, %v", installed, err)
+	}
+	if len(metadata.Artifacts) != 1 || metadata.Artifacts[0].Platform != platform || metadata.Artifacts[0].Path != filepath.Join(tempDir, "agent-"+runtime.GOOS+"-"+runtime.GOARCH) {
+		t.Fatalf("artifacts = %+v", metadata.Artifacts)
+	}
+	if _, ok := metadata.Custom["agent_"+runtime.GOOS+"_"+runtime.GOARCH+"_artifact_size_bytes"]; !ok {
+		t.Fatalf("custom = %v", metadata.Custom)
+	}
+}
+
+func TestParseUnamePlatform(t *testing.T) {
+	for output, want := range map[string]string{
+		"Linux x86_64\n":  "linux/amd64",
+		"Linux aarch64\n": "linux/arm64",
+		"Darwin arm64":    "darwin/arm64",
+		"Linux armv7l":    "linux/arm",
+	} {
+		if got, err := parseUnamePlatform(output); err != nil || got != want {
+			t.Fatalf("parseUnamePlatform(%q) = %q, %v; want %q", output, got, err, want)
+		}
+	}
+	for _, output := range []string{"", "Linux", "SunOS i86pc", "Linux mips"} {
+		if _, err := parseUnamePlatform(output); err == nil {
+			t.Fatalf("parseUnamePlatform(%q): expected error", output)
+		}
+	}
+}
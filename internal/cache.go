@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+const stageCacheDir = ".cache"
+
+var unsafeCacheNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// stageCacheKey hashes everything that determines the result of a cached stage.
+// Per-run values such as BENCHCTL_RUN_ID are deliberately not part of the key.
+func stageCacheKey(cfg *config.Config, stage config.Stage, benchmarkCase config.Case, hostAlias string, envVars map[string]string) (string, error) {
+	hash := sha256.New()
+	writeKeyPart := func(name, value string) {
+		fmt.Fprintf(hash, "%s=%d:%s\n", name, len(value), value)
+	}
+
+	writeKeyPart("stage", stage.Name)
+	writeKeyPart("host", hostAlias)
+	writeKeyPart("shell", resolveStageShell(cfg, stage, hostAlias))
+	if stage.Become {
+		writeKeyPart("become_user", stage.BecomeUser)
+	}
+	writeKeyPart("command", stage.Command)
+	if stage.Container != nil {
+		writeKeyPart("image", stage.Container.Image)
+	}
+	writeKeyPart("key", stage.Cache.Key)
+	if strings.TrimSpace(stage.Script) != "" {
+		if err := hashFile(hash, "script", stage.Script); err != nil {
+			return "", fmt.Errorf("stage %s cache: %w", stage.Name, err)
+		}
+	}
+	for _, file := range stage.Files {
+		writeKeyPart("file", file.RemotePath)
+		if err := hashFile(hash, "file", file.LocalPath); err != nil {
+			return "", fmt.Errorf("stage %s cache: %w", stage.Name, err)
+		}
+	}
+	writeKeyPart("case", benchmarkCase.Name)
+	for _, key := range sortedKeys(benchmarkCase.Env) {
+		writeKeyPart("case_env."+key, benchmarkCase.Env[key])
+	}
+	for _, key := range sortedKeys(envVars) {
+		writeKeyPart("env."+key, envVars[key])
+	}
+
+	inputs, err := expandCacheInputs(stage.Cache.Inputs)
+	if err != nil {
+		return "", fmt.Errorf("stage %s cache: %w", stage.Name, err)
+	}
+	for _, input := range inputs {
+		if err := hashFile(hash, "input", input); err != nil {
+			return "", fmt.Errorf("stage %s cache: %w", stage.Name, err)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// expandCacheInputs resolves glob patterns; a pattern that matches nothing is an error.
+func expandCacheInputs(patterns []string) ([]string, error) {
+	var inputs []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("input %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("input %q matches no files", pattern)
+		}
+		inputs = append(inputs, matches...)
+	}
+	sort.Strings(inputs)
+	return inputs, nil
+}
+
+func hashFile(w io.Writer, kind, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("read %s %s: %w", kind, path, err)
+	}
+	defer file.Close()
+	fmt.Fprintf(w, "%s=%s\n", kind, path)
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("read %s %s: %w", kind, path, err)
+	}
+	return nil
+}
+
+// stageCachePath returns where the key of the last successful execution is stored.
+func stageCachePath(outputDir string, stage config.Stage, benchmarkCase config.Case, hostAlias string) string {
+	name := cacheFileName(hostAlias)
+	if benchmarkCase.Name != "" {
+		name = cacheFileName(benchmarkCase.Name) + "." + name
+	}
+	return filepath.Join(outputDir, stageCacheDir, cacheFileName(stage.Name), name+".key")
+}
+
+func cacheFileName(name string) string {
+	return unsafeCacheNameChars.ReplaceAllString(name, "_")
+}
+
+// stageCacheHit reports whether the stored key matches key.
+func stageCacheHit(path, key string) bool {
+	stored, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(stored)) == key
+}
+
+func writeStageCache(path, key string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create stage cache directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(key+"\n"), 0644); err != nil {
+		return fmt.Errorf("write stage cache: %w", err)
+	}
+	return nil
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,104 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestExecuteStagesSkipsCachedStage(t *testing.T) {
+	tempDir := t.TempDir()
+	outputDir := filepath.Join(tempDir, "results")
+	inputPath := filepath.Join(tempDir, "dataset.conf")
+	if err := os.WriteFile(inputPath, []byte("rows=10\n"), 0644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	counterPath := filepath.Join(tempDir, "counter.txt")
+	command := "count=0; if [ -f '" + counterPath + "' ]; then count=$(cat '" + counterPath + "'); fi; count=$((count+1)); echo $count > '" + counterPath + "'"
+
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "cache", OutputDir: outputDir},
+		Hosts:     map[string]config.Host{"local": {}},
+		Stages: []config.Stage{{
+			Name:    "prepare",
+			Command: command,
+			Cache:   &config.StageCache{Inputs: []string{inputPath}},
+		}},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	execute := func(runID string) *RunMetadata {
+		t.Helper()
+		runDir := filepath.Join(outputDir, runID)
+		if err := os.MkdirAll(runDir, 0755); err != nil {
+			t.Fatalf("create run dir: %v", err)
+		}
+		metadata := &RunMetadata{RunID: runID}
+		if err := executeStages(context.Background(), cfg, runID, runDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+			t.Fatalf("executeStages: %v", err)
+		}
+		return metadata
+	}
+	readCount := func() string {
+		t.Helper()
+		data, err := os.ReadFile(counterPath)
+		if err != nil {
+			t.Fatalf("read counter: %v", err)
+		}
+		return string(data)
+	}
+
+	if metadata := execute("1"); len(metadata.CachedStages) != 0 {
+		t.Fatalf("expected first run to execute, cached = %v", metadata.CachedStages)
+	}
+	if metadata := execute("2"); len(metadata.CachedStages) != 1 || metadata.CachedStages[0] != "prepare" {
+		t.Fatalf("expected second run to hit the cache, cached = %v", metadata.CachedStages)
+	}
+	if got := readCount(); got != "1\n" {
+		t.Fatalf("expected one execution, got %q", got)
+	}
+
+	if err := os.WriteFile(inputPath, []byte("rows=20\n"), 0644); err != nil {
+		t.Fatalf("update input: %v", err)
+	}
+	execute("3")
+	if got := readCount(); got != "2\n" {
+		t.Fatalf("expected changed input to re-execute, got %q", got)
+	}
+}
+
+func TestStageCacheKeyMissingInput(t *testing.T) {
+	cfg := config.New("cache", t.TempDir())
+	stage := config.Stage{
+		Name:    "prepare",
+		Command: "true",
+		Cache:   &config.StageCache{Inputs: []string{filepath.Join(t.TempDir(), "*.missing")}},
+	}
+	if _, err := stageCacheKey(cfg, stage, config.Case{}, "local", nil); err == nil {
+		t.Fatal("expected error for input matching no files")
+	}
+}
+
+func TestStageCacheKeyDependsOnEnv(t *testing.T) {
+	cfg := config.New("cache", t.TempDir())
+	stage := config.Stage{Name: "prepare", Command: "true", Cache: &config.StageCache{}}
+	first, err := stageCacheKey(cfg, stage, config.Case{}, "local", map[string]string{"ROWS": "10"})
+	if err != nil {
+		t.Fatalf("stageCacheKey: %v", err)
+	}
+	second, err := stageCacheKey(cfg, stage, config.Case{}, "local", map[string]string{"ROWS": "20"})
+	if err != nil {
+		t.Fatalf("stageCacheKey: %v", err)
+	}
+	if first == second {
+		t.Fatal("expected env change to change the cache key")
+	}
+}
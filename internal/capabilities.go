@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// capabilityPrefix starts the names of the variables holding detected host
+// capabilities, e.g. BENCHCTL_CAP_SHELL or BENCHCTL_CAP_PERF.
+const capabilityPrefix = "BENCHCTL_CAP_"
+
+// capabilityScript prints the capabilities of a host as NAME=value lines. It is
+// POSIX sh, so it runs on hosts without bash, and detects everything in one command.
+const capabilityScript = `if command -v bash >/dev/null 2>&1; then echo SHELL=bash; else echo SHELL=sh; fi
+if ls --help 2>&1 | grep -qi busybox; then echo USERLAND=busybox
+elif sed --version 2>/dev/null | grep -q GNU; then echo USERLAND=gnu
+else echo USERLAND=bsd; fi
+if [ -f /sys/fs/cgroup/cgroup.controllers ]; then echo CGROUP=v2
+elif [ -d /sys/fs/cgroup ]; then echo CGROUP=v1
+else echo CGROUP=none; fi
+echo OS=$(uname -s | tr '[:upper:]' '[:lower:]')
+echo ARCH=$(uname -m)
+`
+
+// detectCapabilities runs the capability detection on every stage host and
+// returns the BENCHCTL_CAP_* variables of each host alias.
+func detectCapabilities(ctx context.Context, cfg *config.Config, logger *slog.Logger) (map[string]map[string]string, error) {
+	detection := cfg.Benchmark.Capabilities
+	if detection == nil {
+		return nil, nil
+	}
+	hostAliases := stageHostAliases(cfg)
+
+	script := capabilityScript
+	for _, tool := range detection.Tools {
+		script += fmt.Sprintf("if command -v %s >/dev/null 2>&1; then echo %s=true; else echo %s=false; fi\n",
+			shellQuote(tool), config.CapabilityName(tool), config.CapabilityName(tool))
+	}
+	capabilities := make(map[string]map[string]string, len(hostAliases))
+	for _, hostAlias := range hostAliases {
+		client, err := openExecutionClient(ctx, cfg.Hosts[hostAlias])
+		if err != nil {
+			return nil, fmt.Errorf("detect capabilities of host %s: %w", hostAlias, err)
+		}
+		result, err := client.RunCommand(ctx, execution.CommandRequest{Command: "sh -c " + shellQuote(script)})
+		_ = client.Close()
+		if err == nil && result.ExitCode != 0 {
+			err = fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("detect capabilities of host %s: %w", hostAlias, err)
+		}
+		capabilities[hostAlias] = parseCapabilities(result.Output)
+		logger.Info("host capabilities detected", "host", hostAlias, "capabilities", capabilities[hostAlias])
+	}
+	return capabilities, nil
+}
+
+// stageHostAliases returns the hosts the stages run on, in stage order.
+func stageHostAliases(cfg *config.Config) []string {
+	var hostAliases []string
+	for _, stage := range cfg.Stages {
+		for _, hostAlias := range resolveStageHosts(stage) {
+			if !slices.Contains(hostAliases, hostAlias) {
+				hostAliases = append(hostAliases, hostAlias)
+			}
+		}
+	}
+	return hostAliases
+}
+
+// parseCapabilities reads the NAME=value lines of the detection output into
+// BENCHCTL_CAP_NAME variables, ignoring anything else a login shell printed.
+func parseCapabilities(output string) map[string]string {
+	capabilities := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || name == "" || config.CapabilityName(name) != name {
+			continue
+		}
+		capabilities[capabilityPrefix+name] = value
+	}
+	return capabilities
+}
+
+// stageCapabilities returns the capabilities shared by all hostAliases, with the
+// value they agree on, so when conditions of multi-host stages only see a
+// capability that holds on every host.
+func stageCapabilities(capabilities map[string]map[string]string, hostAliases []string) map[string]string {
+	if len(capabilities) == 0 || len(hostAliases) == 0 {
+		return nil
+	}
+	shared := maps.Clone(capabilities[hostAliases[0]])
+	for _, hostAlias := range hostAliases[1:] {
+		for name, value := range shared {
+			if capabilities[hostAlias][name] != value {
+				delete(shared, name)
+			}
+		}
+	}
+	return shared
+}
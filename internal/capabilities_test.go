@@ -0,0 +1,71 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestCapabilitiesReachStagesAndConditions(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "capabilities.txt")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{
+			Name:         "capabilities",
+			OutputDir:    t.TempDir(),
+			Capabilities: &config.Capabilities{Tools: []string{"sh", "benchctl-missing-tool"}},
+		},
+		Stages: []config.Stage{
+			{Name: "with-sh", When: "${BENCHCTL_CAP_SH} == 'true'", Command: "echo $BENCHCTL_CAP_OS >> '" + outputPath + "'"},
+			{Name: "with-missing", When: "$BENCHCTL_CAP_BENCHCTL_MISSING_TOOL == true", Command: "echo missing >> '" + outputPath + "'"},
+		},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	local := result.Metadata.Capabilities["local"]
+	if local["BENCHCTL_CAP_SH"] != "true" || local["BENCHCTL_CAP_BENCHCTL_MISSING_TOOL"] != "false" || local["BENCHCTL_CAP_OS"] != runtime.GOOS {
+		t.Fatalf("capabilities = %v", local)
+	}
+	for _, name := range []string{"BENCHCTL_CAP_SHELL", "BENCHCTL_CAP_USERLAND", "BENCHCTL_CAP_CGROUP", "BENCHCTL_CAP_ARCH"} {
+		if local[name] == "" {
+			t.Fatalf("%s not detected: %v", name, local)
+		}
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if strings.TrimSpace(string(data)) != runtime.GOOS {
+		t.Fatalf("executed stages wrote %q", data)
+	}
+}
+
+func TestParseAndShareCapabilities(t *testing.T) {
+	parsed := parseCapabilities("Welcome to the lab!\nSHELL=sh\nUSERLAND=busybox\nPERF=false\nnot a capability\n")
+	if want := map[string]string{"BENCHCTL_CAP_SHELL": "sh", "BENCHCTL_CAP_USERLAND": "busybox", "BENCHCTL_CAP_PERF": "false"}; !reflect.DeepEqual(parsed, want) {
+		t.Fatalf("parseCapabilities() = %v, want %v", parsed, want)
+	}
+	if got := config.CapabilityName("numa-ctl.v2"); got != "NUMA_CTL_V2" {
+		t.Fatalf("CapabilityName() = %q", got)
+	}
+
+	capabilities := map[string]map[string]string{
+		"a": {"BENCHCTL_CAP_SHELL": "bash", "BENCHCTL_CAP_PERF": "true"},
+		"b": {"BENCHCTL_CAP_SHELL": "bash", "BENCHCTL_CAP_PERF": "false"},
+	}
+	if got, want := stageCapabilities(capabilities, []string{"a", "b"}), map[string]string{"BENCHCTL_CAP_SHELL": "bash"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stageCapabilities() = %v, want %v", got, want)
+	}
+	if got := stageCapabilities(capabilities, []string{"b"}); got["BENCHCTL_CAP_PERF"] != "false" {
+		t.Fatalf("stageCapabilities() = %v", got)
+	}
+}
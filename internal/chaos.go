@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// chaosHealTimeout bounds how long healing a partition may take once the stage has ended.
+const chaosHealTimeout = 30 * time.Second
+
+// ChaosEvent records one fault injected while a stage was running.
+type ChaosEvent struct {
+	Stage      string     `json:"stage"`
+	Case       string     `json:"case,omitempty"`
+	Type       string     `json:"type"`
+	Host       string     `json:"host"`
+	Target     string     `json:"target"`
+	InjectedAt time.Time  `json:"injected_at"`
+	HealedAt   *time.Time `json:"healed_at,omitempty"` // partitions only
+	Error      string     `json:"error,omitempty"`
+}
+
+// chaosRun schedules the chaos actions of one stage execution relative to its start.
+type chaosRun struct {
+	cfg    *config.Config
+	stage  config.Stage
+	caseID string
+	logger *slog.Logger
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	events []ChaosEvent
+	errs   error
+}
+
+// startChaos starts the timers of the stage's chaos actions. It returns nil when
+// the stage has none.
+func startChaos(ctx context.Context, cfg *config.Config, stage config.Stage, benchmarkCase config.Case, logger *slog.Logger) *chaosRun {
+	if len(stage.Chaos) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	run := &chaosRun{cfg: cfg, stage: stage, caseID: benchmarkCase.Name, logger: logger, cancel: cancel}
+	start := clockFrom(ctx).Now()
+	for _, action := range stage.Chaos {
+		run.wg.Go(func() {
+			run.execute(ctx, start, action)
+		})
+	}
+	return run
+}
+
+// Stop cancels actions that have not fired yet, heals active partitions, and
+// returns the injected events together with any injection failure.
+func (r *chaosRun) Stop() ([]ChaosEvent, error) {
+	if r == nil {
+		return nil, nil
+	}
+	r.cancel()
+	r.wg.Wait()
+	return r.events, r.errs
+}
+
+func (r *chaosRun) execute(ctx context.Context, start time.Time, action config.ChaosAction) {
+	clock := clockFrom(ctx)
+	after, _ := time.ParseDuration(action.After)
+	select {
+	case <-clock.After(start.Add(after).Sub(clock.Now())):
+	case <-ctx.Done():
+		return
+	}
+
+	hostAlias := chaosHostAlias(action)
+	event := ChaosEvent{
+		Stage:  r.stage.Name,
+		Case:   r.caseID,
+		Type:   action.Type,
+		Host:   hostAlias,
+		Target: action.Target,
+	}
+	client, err := openExecutionClient(ctx, r.cfg.Hosts[hostAlias])
+	if err != nil {
+		r.record(event, fmt.Errorf("stage %s: chaos %s on %s: %w", r.stage.Name, action.Type, hostAlias, err))
+		return
+	}
+	defer client.Close()
+
+	event.InjectedAt = clock.Now()
+	if err := runChaosCommand(ctx, client, chaosInjectCommand(r.cfg, action)); err != nil {
+		r.record(event, fmt.Errorf("stage %s: chaos %s on %s: %w", r.stage.Name, action.Type, hostAlias, err))
+		return
+	}
+	r.logger.Info("chaos injected", "stage", r.stage.Name, "type", action.Type, "host", hostAlias, "target", action.Target)
+
+	if action.Type != "partition" {
+		r.record(event, nil)
+		return
+	}
+
+	// Partitions heal after their duration, or when the stage ends, whichever comes first.
+	var heal <-chan time.Time
+	if duration, err := time.ParseDuration(action.Duration); err == nil && duration > 0 {
+		heal = clock.After(duration)
+	}
+	select {
+	case <-heal:
+	case <-ctx.Done():
+	}
+	healCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), chaosHealTimeout)
+	defer cancel()
+	err = runChaosCommand(healCtx, client, chaosHealCommand(r.cfg, action))
+	healedAt := clock.Now()
+	event.HealedAt = &healedAt
+	if err != nil {
+		r.record(event, fmt.Errorf("stage %s: heal partition on %s: %w", r.stage.Name, hostAlias, err))
+		return
+	}
+	r.logger.Info("chaos healed", "stage", r.stage.Name, "type", action.Type, "host", hostAlias, "target", action.Target)
+	r.record(event, nil)
+}
+
+func (r *chaosRun) record(event ChaosEvent, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		event.Error = err.Error()
+		r.errs = errors.Join(r.errs, err)
+		r.logger.Error("chaos failed", "stage", r.stage.Name, "type", event.Type, "host", event.Host, "error", err)
+	}
+	r.events = append(r.events, event)
+}
+
+func runChaosCommand(ctx context.Context, client execution.ExecutionClient, command string) error {
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: command})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("command exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	return err
+}
+
+func chaosHostAlias(action config.ChaosAction) string {
+	if action.Host == "" {
+		return "local"
+	}
+	return action.Host
+}
+
+func chaosInjectCommand(cfg *config.Config, action config.ChaosAction) string {
+	var command string
+	switch action.Type {
+	case "kill":
+		command = fmt.Sprintf("pkill -%s -f %s", action.Signal, shellQuote(selfExcludingPattern(action.Target)))
+	case "restart_container":
+		command = "docker restart " + shellQuote(action.Target)
+	case "partition":
+		ip := shellQuote(cfg.Hosts[action.Target].IP)
+		command = fmt.Sprintf("iptables -I INPUT -s %s -j DROP && %siptables -I OUTPUT -d %s -j DROP", ip, chaosSudo(action), ip)
+	}
+	return chaosSudo(action) + command
+}
+
+// selfExcludingPattern rewrites a leading character c of a pkill pattern as [c], which
+// still matches the target but no longer matches the shell and sudo processes whose
+// command lines contain the pattern itself.
+func selfExcludingPattern(pattern string) string {
+	if pattern == "" {
+		return pattern
+	}
+	first := pattern[0]
+	if (first >= 'a' && first <= 'z') || (first >= 'A' && first <= 'Z') || (first >= '0' && first <= '9') {
+		return "[" + string(first) + "]" + pattern[1:]
+	}
+	return pattern
+}
+
+func chaosHealCommand(cfg *config.Config, action config.ChaosAction) string {
+	ip := shellQuote(cfg.Hosts[action.Target].IP)
+	sudo := chaosSudo(action)
+	return fmt.Sprintf("%siptables -D INPUT -s %s -j DROP; status=$?; %siptables -D OUTPUT -d %s -j DROP || status=$?; exit $status", sudo, ip, sudo, ip)
+}
+
+func chaosSudo(action config.ChaosAction) string {
+	if action.Sudo {
+		return "sudo -n "
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestExecuteStagesInjectsChaos(t *testing.T) {
+	victim := exec.Command("sleep", "313")
+	if err := victim.Start(); err != nil {
+		t.Fatalf("start victim: %v", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- victim.Wait() }()
+	t.Cleanup(func() { _ = victim.Process.Kill() })
+
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "chaos", OutputDir: tempDir},
+		Hosts:     map[string]config.Host{"local": {}},
+		Stages: []config.Stage{{
+			Name:    "measure",
+			Command: "sleep 1",
+			Chaos: []config.ChaosAction{
+				{Type: "kill", After: "100ms", Target: "sleep 313", Signal: "KILL"},
+				{Type: "kill", After: "1h", Target: "never", Signal: "KILL"},
+			},
+		}},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metadata := &RunMetadata{RunID: "1"}
+	if err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected chaos to kill the target process")
+	}
+	if len(metadata.Chaos) != 1 {
+		t.Fatalf("expected only the due action to be recorded, got %+v", metadata.Chaos)
+	}
+	event := metadata.Chaos[0]
+	if event.Stage != "measure" || event.Host != "local" || event.InjectedAt.IsZero() || event.Error != "" {
+		t.Fatalf("unexpected chaos event: %+v", event)
+	}
+}
+
+func TestExecuteStagesInjectsChaosOncePerStage(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "chaos", OutputDir: tempDir},
+		Hosts:     map[string]config.Host{"local": {}, "a": {}, "b": {}},
+		Stages: []config.Stage{{
+			Name:    "measure",
+			Hosts:   []string{"a", "b"},
+			Command: "sleep 0.5",
+			Chaos:   []config.ChaosAction{{Type: "kill", After: "100ms", Target: "sleep 314", Signal: "KILL"}},
+		}},
+	}
+	victim := exec.Command("sleep", "314")
+	if err := victim.Start(); err != nil {
+		t.Fatalf("start victim: %v", err)
+	}
+	go func() { _ = victim.Wait() }()
+	t.Cleanup(func() { _ = victim.Process.Kill() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metadata := &RunMetadata{RunID: "1"}
+	if err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+	if len(metadata.Chaos) != 1 {
+		t.Fatalf("expected the action to be injected once for both hosts, got %+v", metadata.Chaos)
+	}
+}
+
+func TestSelfExcludingPattern(t *testing.T) {
+	tests := map[string]string{
+		"server --port": "[s]erver --port",
+		"^java":         "^java",
+		"":              "",
+	}
+	for pattern, want := range tests {
+		if got := selfExcludingPattern(pattern); got != want {
+			t.Fatalf("selfExcludingPattern(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"time"
+)
+
+// StageRecord is the execution of a stage in a case of a run, recorded when the
+// stage returns. Background stages end when they have been started.
+type StageRecord struct {
+	Stage     string    `json:"stage"`
+	Case      string    `json:"case,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// checkpoints saves the metadata of a run in progress.
+type checkpoints struct {
+	runID, runDir string
+	envVars       map[string]string
+	transfers     *transferLog
+	logger        *slog.Logger
+}
+
+type checkpointsKey struct{}
+
+// withCheckpoints returns a context whose stages save the metadata of the run
+// after they return.
+func withCheckpoints(ctx context.Context, runID, runDir string, envVars map[string]string, transfers *transferLog, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, checkpointsKey{}, &checkpoints{runID: runID, runDir: runDir, envVars: envVars, transfers: transfers, logger: logger})
+}
+
+// recordStage adds record to metadata and saves a checkpoint of it when ctx has
+// checkpoints. Callers hold the lock of the metadata.
+func recordStage(ctx context.Context, metadata *RunMetadata, record StageRecord) {
+	metadata.Stages = append(metadata.Stages, record)
+	saveCheckpoint(ctx, metadata)
+}
+
+// saveCheckpoint writes a copy of metadata with status "running" to the run
+// directory, so that metadata.json records the stages completed so far should
+// benchctl crash or the machine lose power before the run ends. The copy is
+// prepared for saving like the final metadata while the run keeps using its
+// unredacted config.
+func saveCheckpoint(ctx context.Context, metadata *RunMetadata) {
+	cp, ok := ctx.Value(checkpointsKey{}).(*checkpoints)
+	if !ok {
+		return
+	}
+	snapshot := *metadata
+	snapshot.Status = "running"
+	snapshot.Custom = maps.Clone(metadata.Custom)
+	if metadata.Config != nil {
+		snapshot.Config = metadata.Config.Clone()
+	}
+	if cp.transfers != nil {
+		snapshot.Transfers = cp.transfers.records()
+	}
+	prepareMetadataForSave(&snapshot, cp.runID, cp.runDir, cp.envVars)
+	if err := saveMetadata(&snapshot, cp.runDir); err != nil {
+		logError(cp.logger, "metadata checkpoint failed", err, "run_id", cp.runID)
+	}
+}
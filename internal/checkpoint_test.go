@@ -0,0 +1,49 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestRunWorkflowCheckpointsMetadataAfterStages(t *testing.T) {
+	tempDir := t.TempDir()
+	checkpoint := filepath.Join(tempDir, "checkpoint.json")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "checkpoint", OutputDir: filepath.Join(tempDir, "results")},
+		Stages: []config.Stage{
+			{Name: "first", Command: "echo 'Requests/sec: 42'", MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}}},
+			{Name: "second", Command: `cp "$BENCHCTL_RUN_DIR/metadata.json" '` + checkpoint + `'`},
+		},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+
+	data, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var partial RunMetadata
+	if err := json.Unmarshal(data, &partial); err != nil {
+		t.Fatal(err)
+	}
+	if partial.Status != "running" || len(partial.Stages) != 1 || partial.Stages[0].Stage != "first" || partial.Custom["rps"] != "42" {
+		t.Fatalf("checkpoint = status %q, stages %+v, custom %v", partial.Status, partial.Stages, partial.Custom)
+	}
+	if partial.Stages[0].EndedAt.Before(partial.Stages[0].StartedAt) {
+		t.Errorf("stage ended before it started: %+v", partial.Stages[0])
+	}
+
+	final := result.Metadata
+	if final.Status != "success" || len(final.Stages) != 2 || final.Stages[1].Stage != "second" {
+		t.Fatalf("final metadata = status %q, stages %+v", final.Status, final.Stages)
+	}
+}
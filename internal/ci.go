@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// CIMetadata traces a run back to the CI pipeline that produced it.
+type CIMetadata struct {
+	Provider    string `json:"provider"`
+	JobURL      string `json:"job_url,omitempty"`
+	PipelineID  string `json:"pipeline_id,omitempty"`
+	Branch      string `json:"branch,omitempty"`
+	PullRequest string `json:"pull_request,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+}
+
+// DetectCI reads the environment of GitHub Actions, GitLab CI, Jenkins, CircleCI,
+// and Buildkite. It returns nil outside of those systems.
+func DetectCI() *CIMetadata {
+	return detectCI(os.Getenv)
+}
+
+func detectCI(getenv func(string) string) *CIMetadata {
+	switch {
+	case getenv("GITHUB_ACTIONS") == "true":
+		ci := &CIMetadata{
+			Provider:   "github-actions",
+			PipelineID: getenv("GITHUB_RUN_ID"),
+			Branch:     firstNonEmpty(getenv("GITHUB_HEAD_REF"), getenv("GITHUB_REF_NAME")),
+			Commit:     getenv("GITHUB_SHA"),
+		}
+		if server, repo := getenv("GITHUB_SERVER_URL"), getenv("GITHUB_REPOSITORY"); server != "" && repo != "" && ci.PipelineID != "" {
+			ci.JobURL = server + "/" + repo + "/actions/runs/" + ci.PipelineID
+		}
+		// Pull request workflows check out refs/pull/<number>/merge.
+		if ref, ok := strings.CutPrefix(getenv("GITHUB_REF"), "refs/pull/"); ok {
+			ci.PullRequest, _, _ = strings.Cut(ref, "/")
+		}
+		return ci
+	case getenv("GITLAB_CI") == "true":
+		return &CIMetadata{
+			Provider:    "gitlab-ci",
+			JobURL:      getenv("CI_JOB_URL"),
+			PipelineID:  getenv("CI_PIPELINE_ID"),
+			Branch:      firstNonEmpty(getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"), getenv("CI_COMMIT_REF_NAME")),
+			PullRequest: getenv("CI_MERGE_REQUEST_IID"),
+			Commit:      getenv("CI_COMMIT_SHA"),
+		}
+	case getenv("JENKINS_URL") != "":
+		return &CIMetadata{
+			Provider:    "jenkins",
+			JobURL:      getenv("BUILD_URL"),
+			PipelineID:  getenv("BUILD_NUMBER"),
+			Branch:      firstNonEmpty(getenv("CHANGE_BRANCH"), getenv("BRANCH_NAME"), getenv("GIT_BRANCH")),
+			PullRequest: getenv("CHANGE_ID"),
+			Commit:      getenv("GIT_COMMIT"),
+		}
+	case getenv("CIRCLECI") == "true":
+		ci := &CIMetadata{
+			Provider:   "circleci",
+			JobURL:     getenv("CIRCLE_BUILD_URL"),
+			PipelineID: getenv("CIRCLE_WORKFLOW_ID"),
+			Branch:     getenv("CIRCLE_BRANCH"),
+			Commit:     getenv("CIRCLE_SHA1"),
+		}
+		if pr := getenv("CIRCLE_PULL_REQUEST"); pr != "" {
+			ci.PullRequest = path.Base(pr)
+		}
+		return ci
+	case getenv("BUILDKITE") == "true":
+		ci := &CIMetadata{
+			Provider:   "buildkite",
+			JobURL:     getenv("BUILDKITE_BUILD_URL"),
+			PipelineID: getenv("BUILDKITE_BUILD_ID"),
+			Branch:     getenv("BUILDKITE_BRANCH"),
+			Commit:     getenv("BUILDKITE_COMMIT"),
+		}
+		if job := getenv("BUILDKITE_JOB_ID"); ci.JobURL != "" && job != "" {
+			ci.JobURL += "#" + job
+		}
+		if pr := getenv("BUILDKITE_PULL_REQUEST"); pr != "" && pr != "false" {
+			ci.PullRequest = pr
+		}
+		return ci
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
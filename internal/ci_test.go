@@ -0,0 +1,96 @@
+//go:build unit
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectCI(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want *CIMetadata
+	}{
+		{
+			name: "outside ci",
+			env:  map[string]string{"HOME": "/root"},
+		},
+		{
+			name: "github actions pull request",
+			env: map[string]string{
+				"GITHUB_ACTIONS":    "true",
+				"GITHUB_SERVER_URL": "https://github.com",
+				"GITHUB_REPOSITORY": "luccadibe/benchctl",
+				"GITHUB_RUN_ID":     "4242",
+				"GITHUB_REF":        "refs/pull/17/merge",
+				"GITHUB_REF_NAME":   "17/merge",
+				"GITHUB_HEAD_REF":   "feature",
+				"GITHUB_SHA":        "abc123",
+			},
+			want: &CIMetadata{
+				Provider:    "github-actions",
+				JobURL:      "https://github.com/luccadibe/benchctl/actions/runs/4242",
+				PipelineID:  "4242",
+				Branch:      "feature",
+				PullRequest: "17",
+				Commit:      "abc123",
+			},
+		},
+		{
+			name: "gitlab branch pipeline",
+			env: map[string]string{
+				"GITLAB_CI":          "true",
+				"CI_JOB_URL":         "https://gitlab.com/group/bench/-/jobs/9",
+				"CI_PIPELINE_ID":     "77",
+				"CI_COMMIT_REF_NAME": "main",
+				"CI_COMMIT_SHA":      "def456",
+			},
+			want: &CIMetadata{
+				Provider:   "gitlab-ci",
+				JobURL:     "https://gitlab.com/group/bench/-/jobs/9",
+				PipelineID: "77",
+				Branch:     "main",
+				Commit:     "def456",
+			},
+		},
+		{
+			name: "circleci pull request",
+			env: map[string]string{
+				"CIRCLECI":            "true",
+				"CIRCLE_BUILD_URL":    "https://circleci.com/gh/org/bench/12",
+				"CIRCLE_BRANCH":       "fix",
+				"CIRCLE_PULL_REQUEST": "https://github.com/org/bench/pull/5",
+			},
+			want: &CIMetadata{
+				Provider:    "circleci",
+				JobURL:      "https://circleci.com/gh/org/bench/12",
+				Branch:      "fix",
+				PullRequest: "5",
+			},
+		},
+		{
+			name: "buildkite without pull request",
+			env: map[string]string{
+				"BUILDKITE":              "true",
+				"BUILDKITE_BUILD_URL":    "https://buildkite.com/org/bench/builds/3",
+				"BUILDKITE_JOB_ID":       "j1",
+				"BUILDKITE_PULL_REQUEST": "false",
+			},
+			want: &CIMetadata{
+				Provider: "buildkite",
+				JobURL:   "https://buildkite.com/org/bench/builds/3#j1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detectCI(func(key string) string { return tt.env[key] })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("detectCI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
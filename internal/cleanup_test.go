@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/luccadibe/benchctl/internal/config"
 )
@@ -55,7 +56,7 @@ func TestExecuteCleanupRunsAfterStageFailure(t *testing.T) {
 	backgroundMgr := newBackgroundManager(logger)
 	ctx := context.Background()
 
-	stageErr := executeStages(ctx, cfg, "1", runDir, logger, io.Discard, metadata, backgroundMgr, nil)
+	stageErr := executeStages(ctx, cfg, "1", runDir, logger, io.Discard, metadata, backgroundMgr, newNetemManager(logger), nil)
 	if stageErr == nil {
 		t.Fatal("expected stage failure")
 	}
@@ -144,6 +145,30 @@ func TestRunWorkflowJoinsStageAndCleanupErrors(t *testing.T) {
 	}
 }
 
+func TestCancelledRunStillTearsDown(t *testing.T) {
+	tempDir := t.TempDir()
+	stopped := filepath.Join(tempDir, "server.stopped")
+	marker := filepath.Join(tempDir, "cleanup.ran")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "cancelled", OutputDir: filepath.Join(tempDir, "results")},
+		Stages: []config.Stage{
+			{Name: "server", Command: "trap 'touch " + stopped + "; exit 0' TERM; while true; do sleep 0.1; done", Shell: "sh -c", Background: true},
+			{Name: "load", Command: "sleep 30"},
+		},
+		Cleanup: []config.Cleanup{{Name: "mark", Command: "touch '" + marker + "'"}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+	if _, err := RunWorkflow(ctx, cfg, nil, nil); err == nil {
+		t.Fatal("expected the cancelled run to fail")
+	}
+	for _, path := range []string{stopped, marker} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected the teardown to create %s: %v", filepath.Base(path), err)
+		}
+	}
+}
+
 func TestExecuteCleanupUsesRunLevelEnvOnly(t *testing.T) {
 	tempDir := t.TempDir()
 	runDir := filepath.Join(tempDir, "run")
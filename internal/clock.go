@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the time source of runs: the timestamps of run metadata, and the waits
+// of cooldowns, chaos actions, retries, and background stage termination.
+type Clock interface {
+	Now() time.Time
+	// After sends the current time after d has passed, like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type clockKey struct{}
+
+// WithClock returns a context whose runs read the time from clock instead of the
+// system clock, so tests get deterministic timestamps and waits.
+func WithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+func clockFrom(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok && clock != nil {
+		return clock
+	}
+	return systemClock{}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-clockFrom(ctx).After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -2,8 +2,12 @@ package internal
 
 import (
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
 )
 
 // CompareRunMetadata compares two run metadata and returns a list of differences
@@ -76,6 +80,9 @@ type StringComparisonResult struct {
 	Key    string
 	Value1 *string
 	Value2 *string
+	// Verdict and Reason are set by ApplyComparisonRules, see FloatComparisonResult.
+	Verdict string
+	Reason  string
 }
 
 func (r *StringComparisonResult) GetKey() string {
@@ -100,18 +107,23 @@ func (r *StringComparisonResult) Format() string {
 	v1 := r.GetValue1()
 	v2 := r.GetValue2()
 	if v1 == "" {
-		return fmt.Sprintf("%s: (missing) -> %s", r.Key, v2)
+		return fmt.Sprintf("%s: (missing) -> %s", r.Key, v2) + formatVerdict(r.Verdict, r.Reason)
 	}
 	if v2 == "" {
-		return fmt.Sprintf("%s: %s -> (missing)", r.Key, v1)
+		return fmt.Sprintf("%s: %s -> (missing)", r.Key, v1) + formatVerdict(r.Verdict, r.Reason)
 	}
-	return fmt.Sprintf("%s: %s -> %s", r.Key, v1, v2)
+	return fmt.Sprintf("%s: %s -> %s", r.Key, v1, v2) + formatVerdict(r.Verdict, r.Reason)
 }
 
 type FloatComparisonResult struct {
 	Key    string
 	Value1 *float64
 	Value2 *float64
+	// Verdict is "ok", "improved", or "regressed" once ApplyComparisonRules has
+	// judged the change, and empty for metrics without a rule.
+	Verdict string
+	// Reason explains a regressed verdict.
+	Reason string
 }
 
 func (r *FloatComparisonResult) GetKey() string {
@@ -135,19 +147,122 @@ func (r *FloatComparisonResult) GetValue2() string {
 func (r *FloatComparisonResult) Format() string {
 	v1 := r.GetValue1()
 	v2 := r.GetValue2()
+	verdict := formatVerdict(r.Verdict, r.Reason)
 	if v1 == "" {
-		return fmt.Sprintf("%s: (missing) -> %s", r.Key, v2)
+		return fmt.Sprintf("%s: (missing) -> %s", r.Key, v2) + verdict
 	}
 	if v2 == "" {
-		return fmt.Sprintf("%s: %s -> (missing)", r.Key, v1)
+		return fmt.Sprintf("%s: %s -> (missing)", r.Key, v1) + verdict
 	}
 
 	// Calculate percentage change if both values exist
 	if r.Value1 != nil && r.Value2 != nil && *r.Value1 != 0 {
 		change := ((*r.Value2 - *r.Value1) / *r.Value1) * 100
-		return fmt.Sprintf("%s: %s -> %s (%.1f%% change)", r.Key, v1, v2, change)
+		return fmt.Sprintf("%s: %s -> %s (%.1f%% change)", r.Key, v1, v2, change) + verdict
+	}
+	return fmt.Sprintf("%s: %s -> %s", r.Key, v1, v2) + verdict
+}
+
+// ApplyComparisonRules judges every result that a benchmark.compare rule matches,
+// with the first run as the baseline, and returns the keys of the regressed
+// metrics in order. A metric missing from the second run, or not numeric in it,
+// counts as regressed; one missing from the baseline is judged only by an absolute
+// rule.
+func ApplyComparisonRules(results []ComparisonResult, rules []config.MetricComparison) []string {
+	var regressed []string
+	for _, result := range results {
+		index := slices.IndexFunc(rules, func(rule config.MetricComparison) bool { return rule.Matches(result.GetKey()) })
+		if index < 0 {
+			continue
+		}
+		rule := rules[index]
+		switch r := result.(type) {
+		case *FloatComparisonResult:
+			r.Verdict, r.Reason = judgeChange(rule, r.Value1, r.Value2)
+			if r.Verdict == "regressed" {
+				regressed = append(regressed, r.Key)
+			}
+		case *StringComparisonResult:
+			switch {
+			case r.Value2 == nil:
+				r.Verdict, r.Reason = "regressed", "missing"
+			case r.Value1 == nil && rule.Strategy != "absolute":
+				continue
+			default:
+				r.Verdict, r.Reason = "regressed", "not numeric"
+			}
+			regressed = append(regressed, r.Key)
+		}
+	}
+	slices.Sort(regressed)
+	return regressed
+}
+
+// judgeChange returns the verdict of rule on the change from baseline to value and
+// the reason for a regression. Without a baseline, relative rules give no verdict.
+func judgeChange(rule config.MetricComparison, baseline, value *float64) (string, string) {
+	if value == nil {
+		return "regressed", "missing"
+	}
+	v := *value
+	if rule.Strategy == "absolute" {
+		if rule.Min != nil && v < *rule.Min {
+			return "regressed", fmt.Sprintf("below min %g", *rule.Min)
+		}
+		if rule.Max != nil && v > *rule.Max {
+			return "regressed", fmt.Sprintf("above max %g", *rule.Max)
+		}
+		return "ok", ""
+	}
+	if baseline == nil {
+		return "", ""
+	}
+	b := *baseline
+	// A zero baseline has no relative change; any change counts as unbounded.
+	change := math.Inf(int(math.Copysign(1, v-b)))
+	if v == b {
+		change = 0
+	} else if b != 0 {
+		change = (v - b) / math.Abs(b) * 100
+	}
+	switch rule.Strategy {
+	case "higher_is_better":
+		change = -change
+	case "within_percent":
+		if math.Abs(change) > rule.Tolerance {
+			return "regressed", fmt.Sprintf("changed %s, tolerance ±%g%%", formatPercent(change), rule.Tolerance)
+		}
+		return "ok", ""
+	}
+	// change is now positive in the direction of a regression.
+	switch {
+	case change > rule.Tolerance:
+		word := "rose"
+		if rule.Strategy == "higher_is_better" {
+			word = "dropped"
+		}
+		return "regressed", fmt.Sprintf("%s %s, tolerance %g%%", word, formatPercent(math.Abs(change)), rule.Tolerance)
+	case change < -rule.Tolerance:
+		return "improved", ""
+	}
+	return "ok", ""
+}
+
+func formatPercent(change float64) string {
+	if math.IsInf(change, 0) {
+		return "from 0"
+	}
+	return fmt.Sprintf("%.1f%%", change)
+}
+
+func formatVerdict(verdict, reason string) string {
+	switch {
+	case verdict == "":
+		return ""
+	case reason == "":
+		return " [" + verdict + "]"
 	}
-	return fmt.Sprintf("%s: %s -> %s", r.Key, v1, v2)
+	return " [" + verdict + ": " + reason + "]"
 }
 
 // getAllKeys returns all unique keys from both maps
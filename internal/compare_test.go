@@ -0,0 +1,58 @@
+//go:build unit
+
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestApplyComparisonRulesFollowsMetricSemantics(t *testing.T) {
+	baseline := &RunMetadata{Custom: map[string]string{
+		"throughput_rps": "1000", "latency_p99_ms": "20", "cpu_util": "50",
+		"error_rate": "0.001", "dropped_total": "0", "memory_mb": "512", "build": "abc",
+	}}
+	current := &RunMetadata{Custom: map[string]string{
+		"throughput_rps": "940", "latency_p99_ms": "15", "cpu_util": "54",
+		"error_rate": "0.02", "dropped_total": "3", "build": "def",
+	}}
+	limit := 0.01
+	rules := []config.MetricComparison{
+		{Metric: "throughput_rps", Strategy: "higher_is_better", Tolerance: 5},
+		{Metric: "latency_*_ms", Strategy: "lower_is_better", Tolerance: 5},
+		{Metric: "cpu_util", Strategy: "within_percent", Tolerance: 10},
+		{Metric: "error_rate", Strategy: "absolute", Max: &limit},
+		{Metric: "dropped_total", Strategy: "lower_is_better"},
+		{Metric: "memory_mb", Strategy: "within_percent", Tolerance: 10},
+	}
+	results, err := CompareRunMetadata(baseline, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regressed := ApplyComparisonRules(results, rules)
+	if want := []string{"dropped_total", "error_rate", "memory_mb", "throughput_rps"}; !reflect.DeepEqual(regressed, want) {
+		t.Fatalf("regressed = %v, want %v", regressed, want)
+	}
+	lines := map[string]string{}
+	for _, result := range results {
+		lines[result.GetKey()] = result.Format()
+	}
+	for key, want := range map[string]string{
+		"throughput_rps": "[regressed: dropped 6.0%, tolerance 5%]",
+		"latency_p99_ms": "[improved]",
+		"cpu_util":       "[ok]",
+		"error_rate":     "[regressed: above max 0.01]",
+		"dropped_total":  "[regressed: rose from 0, tolerance 0%]",
+		"memory_mb":      "[regressed: missing]",
+	} {
+		if !strings.HasSuffix(lines[key], want) {
+			t.Errorf("%s: got %q, want suffix %q", key, lines[key], want)
+		}
+	}
+	if strings.Contains(lines["build"], "[") {
+		t.Errorf("metric without a rule was judged: %q", lines["build"])
+	}
+}
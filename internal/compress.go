@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// compressionSuffixes maps output compress formats to the suffix of the stored file.
+var compressionSuffixes = map[string]string{
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// compressRemote compresses remotePath on the host next to the original and returns
+// the path of the compressed copy.
+func compressRemote(ctx context.Context, client execution.ExecutionClient, remotePath, format string) (string, error) {
+	compressedPath := remotePath + compressionSuffixes[format]
+	var command string
+	switch format {
+	case "gzip":
+		command = fmt.Sprintf("gzip -c -- %s > %s", shellQuote(remotePath), shellQuote(compressedPath))
+	case "zstd":
+		command = fmt.Sprintf("zstd -q -c -- %s > %s", shellQuote(remotePath), shellQuote(compressedPath))
+	default:
+		return "", fmt.Errorf("unknown compression %q", format)
+	}
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: command})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", format, remotePath, err)
+	}
+	return compressedPath, nil
+}
+
+// decompressFile replaces the compressed file at path with its uncompressed
+// content, stored without the compression suffix, and returns the new path.
+func decompressFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	content, err := decompressed(path, file)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+	target := trimCompressionSuffix(path)
+	temp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := io.Copy(temp, content); err != nil {
+		temp.Close()
+		return "", fmt.Errorf("decompress %s: %w", path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(temp.Name(), target); err != nil {
+		return "", err
+	}
+	return target, os.Remove(path)
+}
+
+// trimCompressionSuffix returns name without a .gz or .zst suffix.
+func trimCompressionSuffix(name string) string {
+	for _, suffix := range compressionSuffixes {
+		if trimmed, ok := strings.CutSuffix(name, suffix); ok {
+			return trimmed
+		}
+	}
+	return name
+}
+
+// decompressed returns the uncompressed content of file when name has a .gz or
+// .zst suffix, and file itself otherwise. Closing the result closes file.
+func decompressed(name string, file io.ReadCloser) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(name, compressionSuffixes["gzip"]):
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("gunzip %s: %w", name, err)
+		}
+		return &decompressedFile{Reader: reader, close: reader.Close, file: file}, nil
+	case strings.HasSuffix(name, compressionSuffixes["zstd"]):
+		decoder, err := zstd.NewReader(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("zstd %s: %w", name, err)
+		}
+		return &decompressedFile{Reader: decoder, close: func() error { decoder.Close(); return nil }, file: file}, nil
+	}
+	return file, nil
+}
+
+type decompressedFile struct {
+	io.Reader
+	close func() error
+	file  io.Closer
+}
+
+func (f *decompressedFile) Close() error {
+	return errors.Join(f.close(), f.file.Close())
+}
+
+// openOutputArtifact opens the collected file name of a run, falling back to its
+// compressed variants, and returns its uncompressed content.
+func openOutputArtifact(ctx context.Context, store ResultStore, runID, name string) (io.ReadCloser, error) {
+	file, err := store.OpenArtifact(ctx, runID, name)
+	if err == nil {
+		return file, nil
+	}
+	for _, suffix := range []string{compressionSuffixes["gzip"], compressionSuffixes["zstd"]} {
+		compressed, compressedErr := store.OpenArtifact(ctx, runID, name+suffix)
+		if errors.Is(compressedErr, fs.ErrNotExist) {
+			continue
+		}
+		if compressedErr != nil {
+			return nil, compressedErr
+		}
+		return decompressed(name+suffix, compressed)
+	}
+	return nil, err
+}
@@ -0,0 +1,116 @@
+//go:build unit
+
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+func TestDecompressed(t *testing.T) {
+	const csv = "latency_ms\n1\n2\n"
+	var gz bytes.Buffer
+	writer := gzip.NewWriter(&gz)
+	_, _ = writer.Write([]byte(csv))
+	_ = writer.Close()
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("zstd writer: %v", err)
+	}
+	zst := encoder.EncodeAll([]byte(csv), nil)
+
+	for name, data := range map[string][]byte{"latency.csv": []byte(csv), "latency.csv.gz": gz.Bytes(), "latency.csv.zst": zst} {
+		t.Run(name, func(t *testing.T) {
+			content, err := decompressed(name, io.NopCloser(bytes.NewReader(data)))
+			if err != nil {
+				t.Fatalf("decompressed: %v", err)
+			}
+			got, err := io.ReadAll(content)
+			if err != nil || string(got) != csv {
+				t.Fatalf("content = %q, %v", got, err)
+			}
+			if err := content.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+		})
+	}
+}
+
+func TestCollectStageOutputsCompresses(t *testing.T) {
+	remoteDir := t.TempDir()
+	runDir := t.TempDir()
+	remotePath := filepath.Join(remoteDir, "latency.csv")
+	if err := os.WriteFile(remotePath, []byte("latency_ms\n1\n2\n3\n"), 0644); err != nil {
+		t.Fatalf("write remote file: %v", err)
+	}
+	stage := config.Stage{
+		Name:    "run",
+		Outputs: []config.Output{{Name: "latency", RemotePath: remotePath, Compress: "gzip"}},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	collected, err := collectStageOutputs(context.Background(), execution.NewLocalClient(), runDir, stage, logger, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("collectStageOutputs: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(runDir, "latency.csv.gz")); err != nil {
+		t.Fatalf("expected compressed output: %v", err)
+	}
+	if _, err := os.Stat(remotePath + ".gz"); !os.IsNotExist(err) {
+		t.Fatalf("expected the compressed copy on the host to be removed, got %v", err)
+	}
+
+	// Readers of the run see the uncompressed CSV.
+	store, runID := localRun(runDir)
+	header, rows, err := readOutputCSV(context.Background(), store, runID, "latency")
+	if err != nil || len(header) != 1 || len(rows) != 3 {
+		t.Fatalf("readOutputCSV = %v %v, %v", header, rows, err)
+	}
+	metadata := &RunMetadata{Analysis: &Analysis{}}
+	metadata.Analysis.addOutputs(stage, collected)
+	if files := influxOutputFiles(runDir, metadata, []string{"latency"}); len(files) != 1 {
+		t.Fatalf("influxOutputFiles = %v", files)
+	}
+}
+
+func TestCollectStageOutputsDecompressesTransfers(t *testing.T) {
+	remoteDir := t.TempDir()
+	runDir := t.TempDir()
+	remotePath := filepath.Join(remoteDir, "latency.csv")
+	if err := os.WriteFile(remotePath, []byte("latency_ms\n1\n2\n3\n"), 0644); err != nil {
+		t.Fatalf("write remote file: %v", err)
+	}
+	stage := config.Stage{
+		Name:    "run",
+		Outputs: []config.Output{{Name: "latency", RemotePath: remotePath, Compress: "gzip", Decompress: true, CleanupRemote: true}},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	collected, err := collectStageOutputs(context.Background(), execution.NewLocalClient(), runDir, stage, logger, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("collectStageOutputs: %v", err)
+	}
+	if len(collected) != 1 || collected[0].file != "latency.csv" {
+		t.Fatalf("collected = %+v", collected)
+	}
+	content, err := os.ReadFile(filepath.Join(runDir, "latency.csv"))
+	if err != nil || string(content) != "latency_ms\n1\n2\n3\n" {
+		t.Fatalf("stored output = %q, %v", content, err)
+	}
+	if entries, _ := os.ReadDir(runDir); len(entries) != 1 {
+		t.Fatalf("expected only the uncompressed output in the run directory, found %v", entries)
+	}
+	if entries, _ := os.ReadDir(remoteDir); len(entries) != 0 {
+		t.Fatalf("expected the output and its compressed copy to be removed from the host, found %v", entries)
+	}
+}
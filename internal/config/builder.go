@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // Option configures a Config created with New.
 type Option func(*Config)
 
@@ -18,6 +20,27 @@ func New(name, outputDir string, options ...Option) *Config {
 	return cfg
 }
 
+// WithDescription sets what the benchmark measures.
+func WithDescription(description string) Option {
+	return func(cfg *Config) {
+		cfg.Benchmark.Description = description
+	}
+}
+
+// WithOwner sets who to ask about the benchmark.
+func WithOwner(owner string) Option {
+	return func(cfg *Config) {
+		cfg.Benchmark.Owner = owner
+	}
+}
+
+// WithLink adds a named link to a document related to the benchmark.
+func WithLink(name, url string) Option {
+	return func(cfg *Config) {
+		cfg.Benchmark.Links = append(cfg.Benchmark.Links, Link{Name: name, URL: url})
+	}
+}
+
 // WithShell sets the default shell used by stages.
 func WithShell(shell string) Option {
 	return func(cfg *Config) {
@@ -46,6 +69,27 @@ func WithSync(sync SyncConfig) Option {
 	}
 }
 
+// WithWebhook adds an endpoint that receives the result of every run.
+func WithWebhook(webhook Webhook) Option {
+	return func(cfg *Config) {
+		cfg.Benchmark.Webhooks = append(cfg.Benchmark.Webhooks, webhook)
+	}
+}
+
+// WithComparison adds a rule deciding how compare judges the metrics it matches.
+func WithComparison(rule MetricComparison) Option {
+	return func(cfg *Config) {
+		cfg.Benchmark.Compare = append(cfg.Benchmark.Compare, rule)
+	}
+}
+
+// WithInflux sets the benchmark InfluxDB results sink configuration.
+func WithInflux(influx InfluxConfig) Option {
+	return func(cfg *Config) {
+		cfg.Benchmark.Influx = &influx
+	}
+}
+
 // Bool returns a pointer to value for optional config booleans.
 func Bool(value bool) *bool {
 	return &value
@@ -61,6 +105,30 @@ func WithHost(alias string, host Host) Option {
 	}
 }
 
+// WithHostGroup names a group of host aliases.
+func WithHostGroup(name string, aliases ...string) Option {
+	return func(cfg *Config) {
+		if cfg.HostGroups == nil {
+			cfg.HostGroups = map[string][]string{}
+		}
+		cfg.HostGroups[name] = append([]string(nil), aliases...)
+	}
+}
+
+// WithHostsFrom imports the hosts and groups of an Ansible inventory.
+func WithHostsFrom(path string) Option {
+	return func(cfg *Config) {
+		cfg.HostsFrom = path
+	}
+}
+
+// WithTerraformHosts imports hosts whose addresses are Terraform outputs.
+func WithTerraformHosts(tf TerraformHosts) Option {
+	return func(cfg *Config) {
+		cfg.HostsFromTerraform = &tf
+	}
+}
+
 // WithCase appends a comparison benchmark case.
 func WithCase(name string, env map[string]string) Option {
 	return func(cfg *Config) {
@@ -75,6 +143,13 @@ func WithCase(name string, env map[string]string) Option {
 	}
 }
 
+// WithParameter appends a matrix parameter swept over values.
+func WithParameter(name string, values ...string) Option {
+	return func(cfg *Config) {
+		cfg.Matrix = append(cfg.Matrix, Parameter{Name: name, Values: append([]string(nil), values...)})
+	}
+}
+
 // WithStage appends a workflow stage.
 func WithStage(stage Stage) Option {
 	return func(cfg *Config) {
@@ -94,6 +169,32 @@ func SSHHost(ip, username, keyFile string) Host {
 	return Host{IP: ip, Username: username, KeyFile: keyFile}
 }
 
+// SSHAliasHost creates a remote host configuration resolved from a Host entry of
+// ~/.ssh/config.
+func SSHAliasHost(alias string) Host {
+	return Host{SSHAlias: alias}
+}
+
+// WindowsHost creates a remote Windows host configuration reached through its
+// OpenSSH server, whose commands run as PowerShell scripts.
+func WindowsHost(ip, username, keyFile string) Host {
+	host := SSHHost(ip, username, keyFile)
+	host.OS = "windows"
+	return host
+}
+
+// HetznerHost creates a host provisioned as a Hetzner Cloud server of serverType in
+// location when the run starts, which sshKeys may log in to, and deleted when it ends.
+func HetznerHost(serverType, location, image string, sshKeys ...string) Host {
+	return Host{Provision: &Provision{Provider: "hetzner", Type: serverType, Region: location, Image: image, SSHKeys: append([]string(nil), sshKeys...)}}
+}
+
+// KubernetesPodHost creates a host configuration running commands in a pod of a
+// cluster through kubectl.
+func KubernetesPodHost(pod KubernetesHost) Host {
+	return Host{Type: "kubernetes", Kubernetes: &pod}
+}
+
 // StageOption configures a Stage created with NewStage.
 type StageOption func(*Stage)
 
@@ -141,6 +242,14 @@ func StageShell(shell string) StageOption {
 	}
 }
 
+// Become runs the stage command through sudo, as user or as root when user is empty.
+func Become(user string) StageOption {
+	return func(stage *Stage) {
+		stage.Become = true
+		stage.BecomeUser = user
+	}
+}
+
 // Skip marks a stage as skipped.
 func Skip() StageOption {
 	return func(stage *Stage) {
@@ -155,6 +264,20 @@ func ExecuteOnlyFor(caseName string) StageOption {
 	}
 }
 
+// Describe sets what the stage does.
+func Describe(description string) StageOption {
+	return func(stage *Stage) {
+		stage.Description = description
+	}
+}
+
+// When skips the stage unless the condition holds.
+func When(condition string) StageOption {
+	return func(stage *Stage) {
+		stage.When = condition
+	}
+}
+
 // Background marks a stage as a background stage.
 func Background() StageOption {
 	return func(stage *Stage) {
@@ -162,6 +285,20 @@ func Background() StageOption {
 	}
 }
 
+// Warmup keeps the outputs and metrics of the stage apart from the run's.
+func Warmup() StageOption {
+	return func(stage *Stage) {
+		stage.Warmup = true
+	}
+}
+
+// RunFor stops the stage command after d, counting it as a success.
+func RunFor(d time.Duration) StageOption {
+	return func(stage *Stage) {
+		stage.Duration = d.String()
+	}
+}
+
 // WithHealthCheck sets the stage health check.
 func WithHealthCheck(healthCheck HealthCheck) StageOption {
 	return func(stage *Stage) {
@@ -176,9 +313,192 @@ func WithOutput(output Output) StageOption {
 	}
 }
 
+// WithUploadFile uploads the local file to remotePath on the stage hosts before the
+// stage runs.
+func WithUploadFile(localPath, remotePath string) StageOption {
+	return func(stage *Stage) {
+		stage.Files = append(stage.Files, StageFile{LocalPath: localPath, RemotePath: remotePath})
+	}
+}
+
+// WithFailureLogs appends remote log files whose last lines are saved when the stage fails.
+func WithFailureLogs(paths ...string) StageOption {
+	return func(stage *Stage) {
+		stage.FailureLogs = append(stage.FailureLogs, paths...)
+	}
+}
+
+// WithCache caches the stage on its command, the given input files, and key.
+func WithCache(key string, inputs ...string) StageOption {
+	return func(stage *Stage) {
+		stage.Cache = &StageCache{Key: key, Inputs: append([]string(nil), inputs...)}
+	}
+}
+
+// WithDocker runs the stage command inside a fresh container on the stage hosts.
+func WithDocker(container Container) StageOption {
+	return func(stage *Stage) {
+		stage.Runtime = "docker"
+		stage.Container = &container
+	}
+}
+
+// WithNetem emulates network conditions on the stage hosts while the stage runs.
+func WithNetem(netem Netem) StageOption {
+	return func(stage *Stage) {
+		stage.Netem = &netem
+	}
+}
+
+// WithChaos injects the given faults while the stage command runs.
+func WithChaos(actions ...ChaosAction) StageOption {
+	return func(stage *Stage) {
+		stage.Chaos = append(stage.Chaos, actions...)
+	}
+}
+
+// WithDependsOn makes the stage wait until the named stages have completed. Without
+// names, the stage starts right away instead of after the stage before it.
+func WithDependsOn(stages ...string) StageOption {
+	return func(stage *Stage) {
+		stage.DependsOn = append(StageNames{}, append(stage.DependsOn, stages...)...)
+	}
+}
+
+// WithPipeFrom streams the stdout of the named earlier stage into the stdin of the stage.
+func WithPipeFrom(producer string) StageOption {
+	return func(stage *Stage) {
+		stage.PipeFrom = producer
+	}
+}
+
+// WithSession drives the stage command interactively: it waits for the prompt, sends
+// the steps one after the other, and closes the stdin of the command.
+func WithSession(session Session) StageOption {
+	return func(stage *Stage) {
+		stage.Session = &session
+	}
+}
+
+// SessionSend creates a session step sending line and waiting for output matching
+// expect, if set.
+func SessionSend(line, expect string) SessionStep {
+	return SessionStep{Send: line, Expect: expect}
+}
+
+// WithParallel adds the stage to the named group of consecutive stages that start together.
+func WithParallel(group string) StageOption {
+	return func(stage *Stage) {
+		stage.Parallel = group
+	}
+}
+
+// WithExpect adds expectations checked against the run metrics after the stage completes.
+func WithExpect(exprs ...string) StageOption {
+	return func(stage *Stage) {
+		stage.Expect = append(stage.Expect, exprs...)
+	}
+}
+
+// WithMetricFromOutput records the first capture group of the last match of pattern
+// in the stage output as the run metric name.
+func WithMetricFromOutput(name, pattern string) StageOption {
+	return func(stage *Stage) {
+		stage.MetricsFromOutput = append(stage.MetricsFromOutput, OutputMetric{Name: name, Pattern: pattern})
+	}
+}
+
+// WithConsoleThrottle shows at most linesPerSecond lines of the stage output on the console.
+func WithConsoleThrottle(linesPerSecond int) StageOption {
+	return func(stage *Stage) {
+		stage.Console = &ConsoleThrottle{MaxLinesPerSecond: linesPerSecond}
+	}
+}
+
+// BuildArtifact turns the stage into a build stage producing a local file that is
+// installed at remotePath on every stage host.
+func BuildArtifact(path, remotePath string) StageOption {
+	return func(stage *Stage) {
+		stage.Type = "build"
+		stage.Artifact = &Artifact{Path: path, RemotePath: remotePath}
+	}
+}
+
+// BuildPerPlatformArtifact turns the stage into a build stage that runs once for
+// every OS and architecture among the stage hosts, with GOOS and GOARCH set for the
+// command. path and remotePath may reference ${BENCHCTL_GOOS} and ${BENCHCTL_GOARCH}.
+func BuildPerPlatformArtifact(path, remotePath string) StageOption {
+	return func(stage *Stage) {
+		stage.Type = "build"
+		stage.Artifact = &Artifact{Path: path, RemotePath: remotePath, PerPlatform: true}
+	}
+}
+
+// BuildImage turns the stage into a build stage producing a local container image
+// that is loaded into docker on every remote stage host.
+func BuildImage(image string) StageOption {
+	return func(stage *Stage) {
+		stage.Type = "build"
+		stage.Artifact = &Artifact{Image: image}
+	}
+}
+
+// OutputOption configures an Output created with NewOutput.
+type OutputOption func(*Output)
+
 // NewOutput creates an output collection rule.
-func NewOutput(name, remotePath string) Output {
-	return Output{Name: name, RemotePath: remotePath}
+func NewOutput(name, remotePath string, options ...OutputOption) Output {
+	output := Output{Name: name, RemotePath: remotePath}
+	for _, option := range options {
+		option(&output)
+	}
+	return output
+}
+
+// OutputLocalPath stores the collected file at path relative to the run directory.
+func OutputLocalPath(path string) OutputOption {
+	return func(output *Output) {
+		output.LocalPath = path
+	}
+}
+
+// OutputFormat sets how the collected file is read: "prometheus", "raw", or "gobench".
+func OutputFormat(format string) OutputOption {
+	return func(output *Output) {
+		output.Format = format
+	}
+}
+
+// OutputCompress compresses the output on the host with "gzip" or "zstd" before the
+// transfer and stores it compressed.
+func OutputCompress(format string) OutputOption {
+	return func(output *Output) {
+		output.Compress = format
+	}
+}
+
+// OutputDecompress stores a compressed output uncompressed, so OutputCompress only
+// shrinks the transfer.
+func OutputDecompress() OutputOption {
+	return func(output *Output) {
+		output.Decompress = true
+	}
+}
+
+// OutputCleanupRemote deletes the output from the host after it was collected and
+// its checksum verified.
+func OutputCleanupRemote() OutputOption {
+	return func(output *Output) {
+		output.CleanupRemote = true
+	}
+}
+
+// OutputOnStale sets what happens when the output on the host predates its stage:
+// "warn" (default), "fail", or "ignore".
+func OutputOnStale(action string) OutputOption {
+	return func(output *Output) {
+		output.OnStale = action
+	}
 }
 
 // CleanupOption configures a Cleanup created with NewCleanup.
@@ -2,7 +2,11 @@
 
 package config
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestBuilderCreatesValidConfig(t *testing.T) {
 	cfg := New("builder", "./results",
@@ -23,3 +27,387 @@ func TestBuilderCreatesValidConfig(t *testing.T) {
 		t.Fatalf("expected remote path to be set")
 	}
 }
+
+func TestBuilderWarmupStage(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("warmup", RunCommand("./bench --warmup"), Warmup())),
+		WithStage(NewStage("bench", RunCommand("./bench"))),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if !cfg.Stages[0].Warmup || cfg.Stages[1].Warmup {
+		t.Fatalf("expected only the first stage to be a warmup stage")
+	}
+}
+
+func TestBuilderPipesStages(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("generate", RunCommand("./gen --count 1000"))),
+		WithStage(NewStage("load", RunCommand("./loader"), WithPipeFrom("generate"))),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if cfg.Stages[1].PipeFrom != "generate" {
+		t.Fatalf("expected load to read the stdout of generate, got %q", cfg.Stages[1].PipeFrom)
+	}
+
+	cfg = New("builder", "./results",
+		WithStage(NewStage("load", RunCommand("./loader"), WithPipeFrom("generate"))),
+	)
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected an unknown producer to be rejected")
+	}
+}
+
+func TestBuilderSessionStage(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("seed",
+			RunCommand("redis-cli"),
+			WithSession(Session{
+				Prompt: `> $`,
+				Steps:  []SessionStep{SessionSend("SET key value", "OK"), SessionSend("QUIT", "")},
+			}),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	session := cfg.Stages[0].Session
+	if len(session.Steps) != 2 || session.Steps[0].Send != "SET key value" || session.Steps[0].Expect != "OK" {
+		t.Fatalf("unexpected session steps: %+v", session.Steps)
+	}
+	if session.Timeout != "30s" || session.StartTimeout != "30s" {
+		t.Fatalf("expected validation to default the session timeouts, got %q and %q", session.Timeout, session.StartTimeout)
+	}
+}
+
+func TestBuilderBecomeStage(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithHost("remote", SSHHost("10.0.0.1", "bench", "~/.ssh/id_rsa")),
+		WithStage(NewStage("tune", OnHost("remote"), RunCommand("sysctl -w vm.swappiness=1"), Become(""))),
+		WithStage(NewStage("start", OnHost("remote"), RunCommand("./server"), Become("postgres"))),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if !cfg.Stages[0].Become || cfg.Stages[0].BecomeUser != "" {
+		t.Fatalf("expected tune to run as root, got %+v", cfg.Stages[0])
+	}
+	if !cfg.Stages[1].Become || cfg.Stages[1].BecomeUser != "postgres" {
+		t.Fatalf("expected start to run as postgres, got %+v", cfg.Stages[1])
+	}
+}
+
+func TestBuilderTimeBoxedStage(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("load", RunCommand("./loadgen"), RunFor(10*time.Minute))),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if cfg.Stages[0].Duration != "10m0s" {
+		t.Fatalf("expected a 10m duration, got %q", cfg.Stages[0].Duration)
+	}
+}
+
+func TestBuilderUploadsFiles(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithHost("remote", SSHHost("10.0.0.1", "bench", "~/.ssh/id_rsa")),
+		WithStage(NewStage("serve",
+			OnHost("remote"),
+			RunCommand("./server --config /tmp/server.yaml"),
+			WithUploadFile("./server.yaml", "/tmp/server.yaml"),
+			WithUploadFile("./data.bin", "/tmp/data/data.bin"),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	files := cfg.Stages[0].Files
+	if len(files) != 2 || files[1] != (StageFile{LocalPath: "./data.bin", RemotePath: "/tmp/data/data.bin"}) {
+		t.Fatalf("unexpected stage files: %+v", files)
+	}
+}
+
+func TestBuilderContainerStage(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithHost("remote", SSHHost("10.0.0.1", "bench", "~/.ssh/id_rsa")),
+		WithStage(NewStage("bench",
+			OnHost("remote"),
+			RunCommand("redis-benchmark -q"),
+			WithDocker(Container{Image: "redis:7", Mounts: []string{"/tmp/results:/results"}, Network: "host"}),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	stage := cfg.Stages[0]
+	if stage.Runtime != "docker" || stage.Container.Image != "redis:7" || stage.Container.Network != "host" {
+		t.Fatalf("expected the stage to run in a redis container on the host network, got %+v", stage)
+	}
+}
+
+func TestBuilderKubernetesHost(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithHost("server", KubernetesPodHost(KubernetesHost{Namespace: "bench", Selector: "app=server"})),
+		WithStage(NewStage("inspect", OnHost("server"), RunCommand("cat /proc/loadavg"))),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	host := cfg.Hosts["server"]
+	if host.Type != "kubernetes" || host.Kubernetes.Selector != "app=server" {
+		t.Fatalf("expected a kubernetes host selecting app=server, got %+v", host)
+	}
+}
+
+func TestBuilderOutputLocalPath(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("collect",
+			RunCommand("./collect.sh"),
+			WithOutput(NewOutput("metrics", "/tmp/metrics.csv", OutputLocalPath("raw/metrics.csv"))),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if cfg.Stages[0].Outputs[0].LocalPath != "raw/metrics.csv" {
+		t.Fatalf("expected local path to be set, got %q", cfg.Stages[0].Outputs[0].LocalPath)
+	}
+
+	cfg.Stages[0].Outputs[0] = NewOutput("metrics", "/tmp/metrics.csv", OutputLocalPath("../metrics.csv"))
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected a local path outside the run directory to be rejected")
+	}
+}
+
+func TestBuilderWindowsHost(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithHost("win", WindowsHost("10.0.0.2", "bench", "~/.ssh/id_ed25519")),
+		WithStage(NewStage("bench", OnHost("win"), RunCommand(`.\bench.exe`))),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if host := cfg.Hosts["win"]; host.OS != "windows" || host.IP != "10.0.0.2" {
+		t.Fatalf("expected a windows host at 10.0.0.2, got %+v", host)
+	}
+
+	cfg = New("builder", "./results",
+		WithHost("win", WindowsHost("10.0.0.2", "bench", "~/.ssh/id_ed25519")),
+		WithStage(NewStage("bench", OnHost("win"), RunCommand(`.\bench.exe`), Become(""))),
+	)
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected become on a windows host to be rejected")
+	}
+}
+
+func TestBuilderFailureLogs(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithHost("remote", SSHHost("10.0.0.1", "bench", "~/.ssh/id_rsa")),
+		WithStage(NewStage("serve",
+			OnHost("remote"),
+			RunCommand("./server"),
+			WithFailureLogs("/var/log/server.log"),
+			WithFailureLogs("/var/log/syslog"),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if logs := cfg.Stages[0].FailureLogs; len(logs) != 2 || logs[0] != "/var/log/server.log" || logs[1] != "/var/log/syslog" {
+		t.Fatalf("unexpected failure logs: %v", logs)
+	}
+}
+
+func TestBuilderHetznerHost(t *testing.T) {
+	server := HetznerHost("cx22", "fsn1", "ubuntu-24.04", "bench")
+	server.Username = "root"
+	server.KeyFile = "~/.ssh/id_ed25519"
+	cfg := New("builder", "./results",
+		WithHost("server", server),
+		WithStage(NewStage("bench", OnHost("server"), RunCommand("./bench"))),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	provision := cfg.Hosts["server"].Provision
+	if provision.Provider != "hetzner" || provision.Region != "fsn1" || len(provision.SSHKeys) != 1 {
+		t.Fatalf("unexpected provision: %+v", provision)
+	}
+
+	cfg = New("builder", "./results",
+		WithHost("server", HetznerHost("cx22", "", "ubuntu-24.04")),
+		WithStage(NewStage("bench", OnHost("server"), RunCommand("./bench"))),
+	)
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "hosts.server.provision.region must be set") {
+		t.Fatalf("expected a provisioned host without a location to be rejected, got %v", err)
+	}
+}
+
+func TestBuilderComparisonRules(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithComparison(MetricComparison{Metric: "throughput", Strategy: "higher_is_better", Tolerance: 5}),
+		WithComparison(MetricComparison{Metric: "latency_*_ms", Strategy: "lower_is_better", Tolerance: 10}),
+		WithStage(NewStage("bench", RunCommand("./bench"))),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if rules := cfg.Benchmark.Compare; len(rules) != 2 || !rules[1].Matches("latency_p99_ms") {
+		t.Fatalf("unexpected comparison rules: %+v", rules)
+	}
+
+	cfg = New("builder", "./results",
+		WithComparison(MetricComparison{Metric: "throughput", Strategy: "bigger"}),
+		WithStage(NewStage("bench", RunCommand("./bench"))),
+	)
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "benchmark.compare[0].strategy") {
+		t.Fatalf("expected an unknown comparison strategy to be rejected, got %v", err)
+	}
+}
+
+func TestBuilderSSHAliasHost(t *testing.T) {
+	writeSSHConfig(t, "Host bench-db\n  HostName 10.0.0.7\n  User bench\n")
+	cfg := New("builder", "./results",
+		WithHost("db", SSHAliasHost("bench-db")),
+		WithStage(NewStage("bench", OnHost("db"), RunCommand("./bench"))),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if host := cfg.Hosts["db"]; host.SSHAlias != "bench-db" || host.IP != "10.0.0.7" || host.Username != "bench" {
+		t.Fatalf("expected the host to be resolved from the bench-db ssh alias, got %+v", host)
+	}
+}
+
+func TestBuilderPerPlatformBuildStage(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithHost("arm", SSHHost("10.0.0.1", "bench", "~/.ssh/id_rsa")),
+		WithHost("x86", SSHHost("10.0.0.2", "bench", "~/.ssh/id_rsa")),
+		WithStage(NewStage("build",
+			OnHosts("arm", "x86"),
+			RunCommand("go build -o bin/server-${BENCHCTL_GOOS}-${BENCHCTL_GOARCH} ./cmd/server"),
+			BuildPerPlatformArtifact("bin/server-${BENCHCTL_GOOS}-${BENCHCTL_GOARCH}", "/opt/bench/server"),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	stage := cfg.Stages[0]
+	if stage.Type != "build" || !stage.Artifact.PerPlatform || stage.Artifact.RemotePath != "/opt/bench/server" {
+		t.Fatalf("expected a per-platform build stage, got %+v", stage)
+	}
+}
+
+func TestBuilderCompressedOutput(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("collect",
+			RunCommand("./collect.sh"),
+			WithOutput(NewOutput("trace", "/tmp/trace.json", OutputCompress("zstd"))),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if cfg.Stages[0].Outputs[0].Compress != "zstd" {
+		t.Fatalf("expected zstd compression, got %q", cfg.Stages[0].Outputs[0].Compress)
+	}
+
+	cfg.Stages[0].Outputs[0] = NewOutput("trace", "/tmp/trace.json", OutputCompress("lz4"))
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "compress must be one of [gzip, zstd]") {
+		t.Fatalf("expected an unknown compression to be rejected, got %v", err)
+	}
+}
+
+func TestBuilderOutputCleanupRemote(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("collect",
+			RunCommand("./collect.sh"),
+			WithOutput(NewOutput("metrics", "/tmp/metrics.csv", OutputCleanupRemote())),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if !cfg.Stages[0].Outputs[0].CleanupRemote {
+		t.Fatalf("expected the remote output to be cleaned up")
+	}
+}
+
+func TestBuilderOutputOnStale(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("collect",
+			RunCommand("./collect.sh"),
+			WithOutput(NewOutput("metrics", "/tmp/metrics.csv", OutputOnStale("fail"))),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if cfg.Stages[0].Outputs[0].OnStale != "fail" {
+		t.Fatalf("expected stale outputs to fail the stage, got %q", cfg.Stages[0].Outputs[0].OnStale)
+	}
+
+	cfg.Stages[0].Outputs[0] = NewOutput("metrics", "/tmp/metrics.csv", OutputOnStale("retry"))
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "on_stale") {
+		t.Fatalf("expected an unknown on_stale action to be rejected, got %v", err)
+	}
+}
+
+func TestBuilderOutputFormat(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("bench",
+			RunCommand("go test -bench . ./... > /tmp/bench.txt"),
+			WithOutput(NewOutput("bench", "/tmp/bench.txt", OutputFormat("gobench"))),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if cfg.Stages[0].Outputs[0].Format != "gobench" {
+		t.Fatalf("expected the gobench format, got %q", cfg.Stages[0].Outputs[0].Format)
+	}
+}
+
+func TestBuilderOutputDecompress(t *testing.T) {
+	cfg := New("builder", "./results",
+		WithStage(NewStage("collect",
+			RunCommand("./collect.sh"),
+			WithOutput(NewOutput("metrics", "/tmp/metrics.csv", OutputCompress("gzip"), OutputDecompress())),
+		)),
+	)
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config: %v", err)
+	}
+	if output := cfg.Stages[0].Outputs[0]; output.Compress != "gzip" || !output.Decompress {
+		t.Fatalf("expected a gzip transfer stored uncompressed, got %+v", output)
+	}
+
+	cfg.Stages[0].Outputs[0] = NewOutput("metrics", "/tmp/metrics.csv", OutputDecompress())
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "decompress requires compress") {
+		t.Fatalf("expected decompress without compress to be rejected, got %v", err)
+	}
+}
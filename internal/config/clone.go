@@ -7,9 +7,25 @@ func (cfg *Config) Clone() *Config {
 	}
 	clone := *cfg
 	clone.Hosts = cloneHosts(cfg.Hosts)
+	if cfg.HostGroups != nil {
+		clone.HostGroups = make(map[string][]string, len(cfg.HostGroups))
+		for name, members := range cfg.HostGroups {
+			clone.HostGroups[name] = append([]string(nil), members...)
+		}
+	}
+	if cfg.HostsFromTerraform != nil {
+		tf := *cfg.HostsFromTerraform
+		tf.Hosts = cloneStringMap(cfg.HostsFromTerraform.Hosts)
+		clone.HostsFromTerraform = &tf
+	}
 	clone.Cases = cloneCases(cfg.Cases)
+	clone.Matrix = cloneMatrix(cfg.Matrix)
+	clone.Vars = cloneStringMap(cfg.Vars)
 	clone.Stages = cloneStages(cfg.Stages)
 	clone.Cleanup = cloneCleanup(cfg.Cleanup)
+	if cfg.Profiles != nil {
+		clone.Profiles = cloneYAMLValue(cfg.Profiles).(map[string]any)
+	}
 	if cfg.Benchmark.Logging != nil {
 		logging := *cfg.Benchmark.Logging
 		clone.Benchmark.Logging = &logging
@@ -22,11 +38,41 @@ func (cfg *Config) Clone() *Config {
 		}
 		clone.Benchmark.Git = &git
 	}
+	clone.Benchmark.Links = append([]Link(nil), cfg.Benchmark.Links...)
 	if cfg.Benchmark.Sync != nil {
 		syncConfig := *cfg.Benchmark.Sync
 		syncConfig.Args = append([]string(nil), cfg.Benchmark.Sync.Args...)
 		clone.Benchmark.Sync = &syncConfig
 	}
+	if cfg.Benchmark.Influx != nil {
+		influx := *cfg.Benchmark.Influx
+		influx.Outputs = append([]string(nil), cfg.Benchmark.Influx.Outputs...)
+		clone.Benchmark.Influx = &influx
+	}
+	clone.Benchmark.Webhooks = append([]Webhook(nil), cfg.Benchmark.Webhooks...)
+	if cfg.Benchmark.Cooldown != nil {
+		cooldown := *cfg.Benchmark.Cooldown
+		cooldown.Hosts = append([]string(nil), cfg.Benchmark.Cooldown.Hosts...)
+		clone.Benchmark.Cooldown = &cooldown
+	}
+	clone.Benchmark.Reset = append([]ResetHook(nil), cfg.Benchmark.Reset...)
+	if cfg.Benchmark.Watchdog != nil {
+		watchdog := *cfg.Benchmark.Watchdog
+		clone.Benchmark.Watchdog = &watchdog
+	}
+	if cfg.Benchmark.Capabilities != nil {
+		capabilities := *cfg.Benchmark.Capabilities
+		capabilities.Tools = append([]string(nil), cfg.Benchmark.Capabilities.Tools...)
+		clone.Benchmark.Capabilities = &capabilities
+	}
+	if cfg.Benchmark.FailurePolicy != nil {
+		policy := *cfg.Benchmark.FailurePolicy
+		clone.Benchmark.FailurePolicy = &policy
+	}
+	if cfg.Benchmark.Seed != nil {
+		seed := *cfg.Benchmark.Seed
+		clone.Benchmark.Seed = &seed
+	}
 	return &clone
 }
 
@@ -36,6 +82,14 @@ func cloneHosts(hosts map[string]Host) map[string]Host {
 	}
 	clone := make(map[string]Host, len(hosts))
 	for alias, host := range hosts {
+		if host.SSH != nil {
+			options := *host.SSH
+			options.Ciphers = append([]string(nil), host.SSH.Ciphers...)
+			options.KeyExchanges = append([]string(nil), host.SSH.KeyExchanges...)
+			options.MACs = append([]string(nil), host.SSH.MACs...)
+			options.HostKeyAlgorithms = append([]string(nil), host.SSH.HostKeyAlgorithms...)
+			host.SSH = &options
+		}
 		clone[alias] = host
 	}
 	return clone
@@ -60,6 +114,38 @@ func cloneStages(stages []Stage) []Stage {
 			healthCheck := *stage.HealthCheck
 			clone[i].HealthCheck = &healthCheck
 		}
+		if stage.Artifact != nil {
+			artifact := *stage.Artifact
+			if stage.Artifact.Startup != nil {
+				startup := *stage.Artifact.Startup
+				artifact.Startup = &startup
+			}
+			clone[i].Artifact = &artifact
+		}
+		if stage.Cache != nil {
+			cache := *stage.Cache
+			cache.Inputs = append([]string(nil), stage.Cache.Inputs...)
+			clone[i].Cache = &cache
+		}
+		if stage.Netem != nil {
+			netem := *stage.Netem
+			clone[i].Netem = &netem
+		}
+		if stage.Console != nil {
+			console := *stage.Console
+			clone[i].Console = &console
+		}
+		if stage.Session != nil {
+			session := *stage.Session
+			session.Steps = append([]SessionStep(nil), stage.Session.Steps...)
+			clone[i].Session = &session
+		}
+		clone[i].Chaos = append([]ChaosAction(nil), stage.Chaos...)
+		clone[i].Expect = append([]string(nil), stage.Expect...)
+		if stage.DependsOn != nil {
+			clone[i].DependsOn = append(StageNames{}, stage.DependsOn...)
+		}
+		clone[i].MetricsFromOutput = append([]OutputMetric(nil), stage.MetricsFromOutput...)
 	}
 	return clone
 }
@@ -87,3 +173,33 @@ func cloneStringMap(values map[string]string) map[string]string {
 	}
 	return clone
 }
+
+// cloneYAMLValue deep-copies a decoded YAML value.
+func cloneYAMLValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		clone := make(map[string]any, len(value))
+		for key, child := range value {
+			clone[key] = cloneYAMLValue(child)
+		}
+		return clone
+	case []any:
+		clone := make([]any, len(value))
+		for i, child := range value {
+			clone[i] = cloneYAMLValue(child)
+		}
+		return clone
+	}
+	return value
+}
+
+func cloneMatrix(matrix []Parameter) []Parameter {
+	if matrix == nil {
+		return nil
+	}
+	clone := make([]Parameter, len(matrix))
+	for i, parameter := range matrix {
+		clone[i] = Parameter{Name: parameter.Name, Values: append([]string(nil), parameter.Values...)}
+	}
+	return clone
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// MetricComparison is a benchmark.compare rule. higher_is_better and
+// lower_is_better count a change in the wrong direction by more than Tolerance
+// percent of the baseline as a regression, within_percent any change by more than
+// Tolerance percent, and absolute a value outside Min and Max whatever the
+// baseline was.
+type MetricComparison struct {
+	// Metric is a metric name or a path.Match pattern such as "latency_*_ms".
+	Metric   string `yaml:"metric" json:"metric"`
+	Strategy string `yaml:"strategy" json:"strategy" jsonschema:"enum=higher_is_better,enum=lower_is_better,enum=within_percent,enum=absolute"`
+	// Tolerance is the change in percent of the baseline that is not a regression.
+	Tolerance float64  `yaml:"tolerance,omitempty" json:"tolerance,omitempty"`
+	Min       *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max       *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+}
+
+// Matches reports whether the rule applies to metric.
+func (c MetricComparison) Matches(metric string) bool {
+	if c.Metric == metric {
+		return true
+	}
+	ok, _ := path.Match(c.Metric, metric)
+	return ok
+}
+
+func validateMetricComparison(i int, rule MetricComparison) []string {
+	var errs []string
+	prefix := fmt.Sprintf("benchmark.compare[%d]", i)
+	if strings.TrimSpace(rule.Metric) == "" {
+		errs = append(errs, prefix+".metric must be set")
+	} else if _, err := path.Match(rule.Metric, ""); err != nil {
+		errs = append(errs, fmt.Sprintf("%s.metric %q is not a valid pattern", prefix, rule.Metric))
+	}
+	if rule.Tolerance < 0 {
+		errs = append(errs, prefix+".tolerance must be >= 0")
+	}
+	switch rule.Strategy {
+	case "higher_is_better", "lower_is_better", "within_percent":
+		if rule.Min != nil || rule.Max != nil {
+			errs = append(errs, prefix+": min and max require strategy absolute")
+		}
+	case "absolute":
+		if rule.Min == nil && rule.Max == nil {
+			errs = append(errs, prefix+": strategy absolute requires min or max")
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			errs = append(errs, prefix+".min must be <= max")
+		}
+		if rule.Tolerance != 0 {
+			errs = append(errs, prefix+".tolerance is not used by strategy absolute")
+		}
+	default:
+		errs = append(errs, prefix+".strategy must be one of [higher_is_better, lower_is_better, within_percent, absolute]")
+	}
+	return errs
+}
@@ -3,30 +3,67 @@ package config
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	_ "embed"
 
 	"github.com/goccy/go-yaml"
+	"golang.org/x/crypto/ssh"
 )
 
 // Config mirrors the YAML configuration shape.
 type Config struct {
 	Benchmark Benchmark       `yaml:"benchmark" json:"benchmark"`
 	Hosts     map[string]Host `yaml:"hosts" json:"hosts"`
-	Cases     []Case          `yaml:"cases,omitempty" json:"cases,omitempty"`
-	Stages    []Stage         `yaml:"stages" json:"stages"`
-	Cleanup   []Cleanup       `yaml:"cleanup,omitempty" json:"cleanup,omitempty"`
+	// HostGroups name lists of host aliases. A group name in the hosts of a stage,
+	// a cleanup step, or the cooldown stands for all of its members.
+	HostGroups map[string][]string `yaml:"host_groups,omitempty" json:"host_groups,omitempty"`
+	// HostsFrom is an Ansible inventory (INI, or YAML with a .yml or .yaml
+	// extension) whose hosts and groups are added to Hosts and HostGroups.
+	HostsFrom string `yaml:"hosts_from,omitempty" json:"hosts_from,omitempty"`
+	// HostsFromTerraform adds hosts whose addresses are Terraform outputs.
+	HostsFromTerraform *TerraformHosts `yaml:"hosts_from_terraform,omitempty" json:"hosts_from_terraform,omitempty"`
+	Cases              []Case          `yaml:"cases,omitempty" json:"cases,omitempty"`
+	// Vars are substituted for ${name} placeholders anywhere else in the file; see ApplyVars.
+	Vars map[string]string `yaml:"vars,omitempty" json:"vars,omitempty"`
+	// Matrix expands the benchmark into one run per combination of parameter values.
+	Matrix  []Parameter `yaml:"matrix,omitempty" json:"matrix,omitempty"`
+	Stages  []Stage     `yaml:"stages" json:"stages"`
+	Cleanup []Cleanup   `yaml:"cleanup,omitempty" json:"cleanup,omitempty"`
+	// Profiles are named overlays of the config, merged over it by --profile; see
+	// ApplyProfiles, which removes the section before the config is decoded.
+	Profiles map[string]any `yaml:"profiles,omitempty" json:"profiles,omitempty"`
+}
+
+// Parameter is one dimension of a matrix sweep. Each run exports the parameter as
+// the environment variable Name and records its value in the run metadata.
+type Parameter struct {
+	Name   string   `yaml:"name" json:"name"`
+	Values []string `yaml:"values" json:"values"`
 }
 
 // Benchmark holds top-level benchmark metadata.
 type Benchmark struct {
 	// the benchmark name to be used in metadata
 	Name string `yaml:"name" json:"name"`
+	// What the benchmark measures, carried into metadata.json and inspect output.
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Who to ask about the benchmark (a person, team, or email address).
+	Owner string `yaml:"owner,omitempty" json:"owner,omitempty"`
+	// Related documents such as design docs, dashboards, or tracking issues.
+	Links []Link `yaml:"links,omitempty" json:"links,omitempty"`
 	// the directory to save the results
 	OutputDir string `yaml:"output_dir" json:"output_dir"`
-	// Shell command used to execute stages (default: "bash -lic").
+	// Shell command used to execute stages (default: "bash -lic"). bash, sh, zsh,
+	// and pwsh may be named alone and run as "bash -lic", "sh -c", "zsh -lic", and
+	// "pwsh -NoLogo -NonInteractive -Command".
 	Shell string `yaml:"shell,omitempty" json:"shell,omitempty" jsonschema:"default=bash -lic"`
 	// the logging configuration
 	Logging *LoggingConfig `yaml:"logging,omitempty" json:"logging,omitempty"`
@@ -34,6 +71,130 @@ type Benchmark struct {
 	Git *GitConfig `yaml:"git,omitempty" json:"git,omitempty"`
 	// Sync controls optional result sync via rclone.
 	Sync *SyncConfig `yaml:"sync,omitempty" json:"sync,omitempty"`
+	// Influx writes collected CSV outputs and run metadata to InfluxDB after the run.
+	Influx *InfluxConfig `yaml:"influx,omitempty" json:"influx,omitempty"`
+	// Webhooks receive a signed JSON summary of every finished run.
+	Webhooks []Webhook `yaml:"webhooks,omitempty" json:"webhooks,omitempty"`
+	// Order of case execution. "random" shuffles the cases of every run to avoid
+	// time-of-day and thermal bias; the seed is recorded in metadata.json.
+	Order string `yaml:"order,omitempty" json:"order,omitempty" jsonschema:"enum=config,enum=random,default=config"`
+	// Seed for the random case order; a new seed is chosen per run when unset.
+	Seed *int64 `yaml:"seed,omitempty" json:"seed,omitempty"`
+	// Trials executes the stage pipeline this many times per run, each trial below
+	// trial-<n>/ of the run directory, and aggregates the metrics across trials.
+	Trials int `yaml:"trials,omitempty" json:"trials,omitempty" jsonschema:"default=1"`
+	// WarmupTrials executes the stage pipeline this many times before the trials,
+	// each below warmup-<n>/, without checking expectations or aggregating metrics.
+	WarmupTrials int `yaml:"warmup_trials,omitempty" json:"warmup_trials,omitempty"`
+	// Cooldown waits between cases until the hosts are back in a steady state.
+	Cooldown *Cooldown `yaml:"cooldown,omitempty" json:"cooldown,omitempty"`
+	// Reset hooks run before every case after the first, so each case starts from the same state.
+	Reset []ResetHook `yaml:"reset,omitempty" json:"reset,omitempty"`
+	// Watchdog probes the remote hosts while stages run and fails the run fast
+	// when one of them stops answering.
+	Watchdog *Watchdog `yaml:"watchdog,omitempty" json:"watchdog,omitempty"`
+	// Capabilities detects what the stage hosts offer before the stages run, and
+	// exposes it to stage commands and when conditions as BENCHCTL_CAP_* variables.
+	Capabilities *Capabilities `yaml:"capabilities,omitempty" json:"capabilities,omitempty"`
+	// CaptureVersions lists packages or commands whose installed version is
+	// recorded for every stage host in the run metadata, e.g. nginx or openssl.
+	CaptureVersions []string `yaml:"capture_versions,omitempty" json:"capture_versions,omitempty"`
+	// FailurePolicy retries failed stages and decides whether the run stops at the
+	// first failure or finishes and reports all of them.
+	FailurePolicy *FailurePolicy `yaml:"failure_policy,omitempty" json:"failure_policy,omitempty"`
+	// SkipAnalysis limits runs to executing stages and collecting their outputs.
+	// Metrics are derived and expectations checked later by benchctl analyze.
+	SkipAnalysis bool `yaml:"skip_analysis,omitempty" json:"skip_analysis,omitempty"`
+	// Compare declares how benchctl compare judges the change of each metric; the
+	// first rule matching a metric applies, and metrics without one are not judged.
+	Compare []MetricComparison `yaml:"compare,omitempty" json:"compare,omitempty"`
+}
+
+// FailurePolicy controls how stage failures affect the rest of a run.
+type FailurePolicy struct {
+	// OnFailure "stop" aborts the remaining stages at the first failure. "continue"
+	// records the failure, leaves the failed host out of the remaining stages of the
+	// case, and runs everything else; the run still fails and reports every failure.
+	OnFailure string `yaml:"on_failure,omitempty" json:"on_failure,omitempty" jsonschema:"enum=stop,enum=continue,default=stop"`
+	// Retries is how often a failed stage is re-run on a host before it counts as failed.
+	Retries int `yaml:"retries,omitempty" json:"retries,omitempty"`
+	// MaxRetries caps the retries spent across the whole run (0 means no cap).
+	MaxRetries int `yaml:"max_retries,omitempty" json:"max_retries,omitempty"`
+}
+
+// Watchdog configures the host reachability checks. Every Interval each remote
+// host's SSH port must answer with an SSH banner within Timeout; a host that fails
+// Failures consecutive checks aborts the current stage.
+type Watchdog struct {
+	Interval string `yaml:"interval,omitempty" json:"interval,omitempty" jsonschema:"default=10s"`
+	Timeout  string `yaml:"timeout,omitempty" json:"timeout,omitempty" jsonschema:"default=5s"`
+	Failures int    `yaml:"failures,omitempty" json:"failures,omitempty" jsonschema:"default=3"`
+}
+
+// Capabilities configures host capability detection. Every stage host reports its
+// shell (bash or sh), userland (gnu, bsd, or busybox), cgroup version (v1, v2, or
+// none), OS, and architecture, and whether each of Tools is installed.
+type Capabilities struct {
+	// Tools whose availability is detected (default: perf, nc).
+	Tools []string `yaml:"tools,omitempty" json:"tools,omitempty"`
+}
+
+// detectedCapabilities are the capability names every host reports, which a tool
+// must not take.
+var detectedCapabilities = []string{"SHELL", "USERLAND", "CGROUP", "OS", "ARCH"}
+
+// CapabilityName is the NAME of a tool in BENCHCTL_CAP_NAME: upper case, with
+// characters other than letters and digits replaced by underscores.
+func CapabilityName(tool string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, tool)
+}
+
+// Link is a named reference to a document related to the benchmark.
+type Link struct {
+	Name string `yaml:"name" json:"name"`
+	URL  string `yaml:"url" json:"url"`
+}
+
+// ResetHook restores a host, container, VM, or deployment between cases.
+type ResetHook struct {
+	Name string `yaml:"name" json:"name"`
+	// command runs Command through the benchmark shell with the stage environment;
+	// restart_container runs docker restart Target; libvirt_snapshot reverts domain
+	// Target to Snapshot; k8s_deployment restarts deployment Target and waits for the rollout.
+	Type string `yaml:"type" json:"type" jsonschema:"enum=command,enum=restart_container,enum=libvirt_snapshot,enum=k8s_deployment"`
+	// Host alias to run the hook on (default: local).
+	Host      string `yaml:"host,omitempty" json:"host,omitempty"`
+	Command   string `yaml:"command,omitempty" json:"command,omitempty"`
+	Target    string `yaml:"target,omitempty" json:"target,omitempty"`
+	Snapshot  string `yaml:"snapshot,omitempty" json:"snapshot,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	// Rollout timeout of k8s_deployment hooks (default: 5m).
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// Cooldown configures the wait before every case after the first.
+// benchctl sleeps for Period, then polls the guard hosts every Interval until all
+// limits hold, failing the run after Timeout.
+type Cooldown struct {
+	Period string `yaml:"period,omitempty" json:"period,omitempty"`
+	// Hosts whose guards are checked (default: every host of the config, or the
+	// local host when there are none).
+	Hosts []string `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	// Maximum 1-minute load average.
+	MaxLoad float64 `yaml:"max_load,omitempty" json:"max_load,omitempty"`
+	// Maximum temperature of the hottest thermal zone in degrees Celsius.
+	MaxTempC float64 `yaml:"max_temp_c,omitempty" json:"max_temp_c,omitempty"`
+	Timeout  string  `yaml:"timeout,omitempty" json:"timeout,omitempty" jsonschema:"default=10m"`
+	Interval string  `yaml:"interval,omitempty" json:"interval,omitempty" jsonschema:"default=5s"`
 }
 
 // LoggingConfig controls slog level and the JSON log file path.
@@ -57,7 +218,43 @@ type SyncConfig struct {
 	Args   []string `yaml:"args,omitempty" json:"args,omitempty"`
 }
 
+// InfluxConfig holds InfluxDB v2 results sink settings.
+// Every numeric column of a collected CSV output becomes a field of a point
+// in the measurement named after the output.
+type InfluxConfig struct {
+	URL    string `yaml:"url" json:"url"`
+	Org    string `yaml:"org,omitempty" json:"org,omitempty"`
+	Bucket string `yaml:"bucket" json:"bucket"`
+	// Environment variable holding the API token (default: INFLUX_TOKEN).
+	TokenEnv string `yaml:"token_env,omitempty" json:"token_env,omitempty" jsonschema:"default=INFLUX_TOKEN"`
+	// CSV column holding the point timestamp (default: timestamp_ms).
+	TimestampColumn string `yaml:"timestamp_column,omitempty" json:"timestamp_column,omitempty" jsonschema:"default=timestamp_ms"`
+	// Unit of the timestamp column (default: ms).
+	Precision string `yaml:"precision,omitempty" json:"precision,omitempty" jsonschema:"enum=s,enum=ms,enum=us,enum=ns,default=ms"`
+	// Output names to write; all collected CSV outputs are written when empty.
+	Outputs []string `yaml:"outputs,omitempty" json:"outputs,omitempty"`
+}
+
+// Webhook is an HTTP endpoint that benchctl POSTs the result of every run to,
+// successful or not, once its metadata is saved.
+type Webhook struct {
+	URL string `yaml:"url" json:"url"`
+	// Secret signs the payload with HMAC-SHA256 in the X-Benchctl-Signature header.
+	// It must be a secret reference (env://, file://, or exec://) so it never lands
+	// in metadata.json; payloads are unsigned when it is unset.
+	Secret string `yaml:"secret,omitempty" json:"secret,omitempty"`
+	// ArtifactURL is the link of each artifact, with {run_id} and {name} replaced
+	// (default: a file:// URL of the local file).
+	ArtifactURL string `yaml:"artifact_url,omitempty" json:"artifact_url,omitempty"`
+	// Timeout of the request (default: 10s).
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty" jsonschema:"default=10s"`
+}
+
 // Host is a host in the benchmark. It can be a remote host or the local host.
+//
+// Password, KeyPassword, and KeyFile may reference a secret as env://NAME,
+// file://path, or exec://command instead of holding it; see ResolveSecret. A
+// referenced key_file resolves to the private key itself rather than its path.
 type Host struct {
 	IP          string `yaml:"ip,omitempty" json:"ip,omitempty"`
 	Port        int    `yaml:"port,omitempty" json:"port,omitempty"`
@@ -65,6 +262,90 @@ type Host struct {
 	Password    string `yaml:"password,omitempty" json:"password,omitempty"`
 	KeyFile     string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
 	KeyPassword string `yaml:"key_password,omitempty" json:"key_password,omitempty"`
+	// SSHAlias names a Host entry of ~/.ssh/config whose HostName, User, Port,
+	// IdentityFile, and ProxyJump fill the fields left unset here.
+	SSHAlias string `yaml:"ssh_alias,omitempty" json:"ssh_alias,omitempty"`
+	// ProxyJump lists jump hosts to connect through, as [user@]host[:port] separated
+	// by commas. Jump host names are looked up in ~/.ssh/config.
+	ProxyJump string `yaml:"proxy_jump,omitempty" json:"proxy_jump,omitempty"`
+	// Shell runs the stages, cleanup steps, and reset hooks on this host that set
+	// no shell of their own (defaults to benchmark.shell).
+	Shell string `yaml:"shell,omitempty" json:"shell,omitempty"`
+	// SSH tunes the SSH connection, e.g. for legacy devices.
+	SSH *SSHOptions `yaml:"ssh,omitempty" json:"ssh,omitempty"`
+	// BecomePassword is the sudo password for stages with become, usually a
+	// secret reference. Without it, sudo must allow the user NOPASSWD.
+	BecomePassword string `yaml:"become_password,omitempty" json:"become_password,omitempty"`
+	// OS "windows" marks a Windows host reached through its OpenSSH server, whose
+	// commands are PowerShell scripts run with shell: powershell (default) or pwsh.
+	OS string `yaml:"os,omitempty" json:"os,omitempty" jsonschema:"enum=linux,enum=windows"`
+	// Type "kubernetes" runs the commands on this host in a pod of a cluster
+	// through kubectl instead of over SSH.
+	Type       string          `yaml:"type,omitempty" json:"type,omitempty" jsonschema:"enum=kubernetes"`
+	Kubernetes *KubernetesHost `yaml:"kubernetes,omitempty" json:"kubernetes,omitempty"`
+	// Provision creates the host as a cloud instance when a run starts and deletes
+	// it when the run ends; the run reaches it at its public IP.
+	Provision *Provision `yaml:"provision,omitempty" json:"provision,omitempty"`
+}
+
+// Provision describes the cloud instance created for a provisioned host.
+type Provision struct {
+	Provider string `yaml:"provider" json:"provider" jsonschema:"enum=hetzner"`
+	// Type is the instance type, e.g. "cx22".
+	Type string `yaml:"type" json:"type"`
+	// Region is the location of the instance, e.g. "fsn1".
+	Region string `yaml:"region" json:"region"`
+	// Image is the operating system image, e.g. "ubuntu-24.04".
+	Image string `yaml:"image" json:"image"`
+	// SSHKeys name the keys registered with the provider that may log in; key_file
+	// of the host holds the private key of one of them.
+	SSHKeys []string `yaml:"ssh_keys,omitempty" json:"ssh_keys,omitempty"`
+	// TokenEnv names the environment variable holding the API token of the
+	// provider (default: HCLOUD_TOKEN for hetzner).
+	TokenEnv string `yaml:"token_env,omitempty" json:"token_env,omitempty"`
+	// Timeout bounds the wait for the instance to run and accept SSH connections
+	// (default: 5m).
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty" jsonschema:"default=5m"`
+}
+
+// KubernetesHost selects the pod a kubernetes host runs its commands in: a named
+// pod, or the first running pod matching a label selector.
+type KubernetesHost struct {
+	// Kubeconfig is the kubeconfig file (default: $KUBECONFIG or ~/.kube/config).
+	Kubeconfig string `yaml:"kubeconfig,omitempty" json:"kubeconfig,omitempty"`
+	// Context is the kubeconfig context (default: the current context).
+	Context   string `yaml:"context,omitempty" json:"context,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Pod       string `yaml:"pod,omitempty" json:"pod,omitempty"`
+	// Selector is a label selector such as app=server, resolved when the host is
+	// connected to.
+	Selector string `yaml:"selector,omitempty" json:"selector,omitempty"`
+	// Container is the container of the pod (default: its default container).
+	Container string `yaml:"container,omitempty" json:"container,omitempty"`
+}
+
+// SSHOptions tunes the SSH connection to a host. The algorithm lists replace the
+// defaults of the SSH client, in order of preference, so old appliances that only
+// offer legacy algorithms such as aes128-cbc or diffie-hellman-group1-sha1 can be
+// reached; the algorithms benchctl supports are listed by config validation errors.
+type SSHOptions struct {
+	// ConnectTimeout bounds establishing the TCP connection (default: no limit).
+	ConnectTimeout    string   `yaml:"connect_timeout,omitempty" json:"connect_timeout,omitempty"`
+	Ciphers           []string `yaml:"ciphers,omitempty" json:"ciphers,omitempty"`
+	KeyExchanges      []string `yaml:"kex,omitempty" json:"kex,omitempty"`
+	MACs              []string `yaml:"macs,omitempty" json:"macs,omitempty"`
+	HostKeyAlgorithms []string `yaml:"host_key_algorithms,omitempty" json:"host_key_algorithms,omitempty"`
+	// MaxSessions caps the concurrent sessions on the connection a run shares among
+	// the commands on the host; keep it at or below MaxSessions of sshd (default: 10).
+	MaxSessions int `yaml:"max_sessions,omitempty" json:"max_sessions,omitempty" jsonschema:"default=10"`
+	// KeepaliveInterval is how often an idle connection is probed, like
+	// ServerAliveInterval of OpenSSH; 0s disables keepalives (default: 30s).
+	KeepaliveInterval string `yaml:"keepalive_interval,omitempty" json:"keepalive_interval,omitempty" jsonschema:"default=30s"`
+	// KeepaliveCountMax unanswered keepalives in a row close the connection (default: 3).
+	KeepaliveCountMax int `yaml:"keepalive_count_max,omitempty" json:"keepalive_count_max,omitempty" jsonschema:"default=3"`
+	// ReconnectAttempts bounds the attempts to reopen a lost connection before the
+	// next command fails; -1 disables reconnecting (default: 3).
+	ReconnectAttempts int `yaml:"reconnect_attempts,omitempty" json:"reconnect_attempts,omitempty" jsonschema:"default=3"`
 }
 
 // Case describes a comparison benchmark case.
@@ -75,24 +356,212 @@ type Case struct {
 
 // Stage is a step in the workflow.
 type Stage struct {
-	Name    string   `yaml:"name" json:"name"`
+	Name string `yaml:"name" json:"name"`
+	// What the stage does and why, shown in logs and by benchctl inspect so a run
+	// documents its own methodology.
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Type selects special stage behavior. "build" runs the command locally and
+	// transfers the produced artifact to the stage hosts.
+	Type    string   `yaml:"type,omitempty" json:"type,omitempty" jsonschema:"enum=build"`
 	Host    string   `yaml:"host,omitempty" json:"host,omitempty"`
 	Hosts   []string `yaml:"hosts,omitempty" json:"hosts,omitempty"`
 	Command string   `yaml:"command,omitempty" json:"command,omitempty"`
+	// Runtime "docker" runs the command inside a fresh container of the image in
+	// container, on the stage hosts, for a reproducible environment.
+	Runtime   string     `yaml:"runtime,omitempty" json:"runtime,omitempty" jsonschema:"enum=docker"`
+	Container *Container `yaml:"container,omitempty" json:"container,omitempty"`
+	// DependsOn lists the stages that must complete before this one starts. Once any
+	// stage declares dependencies, stages run concurrently as soon as theirs are done,
+	// stages without depends_on still wait for the stage before them, and an empty
+	// depends_on starts a stage right away.
+	DependsOn StageNames `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+	// Parallel names a group of consecutive stages that start together, such as
+	// load generators on several hosts. The stage after the group starts once all
+	// of them have completed.
+	Parallel string `yaml:"parallel,omitempty" json:"parallel,omitempty"`
+	// PipeFrom names an earlier stage whose stdout is streamed into the stdin of
+	// this stage while both run, across hosts through SSH, such as a load
+	// generator feeding a consumer. The earlier stage starts and this stage runs
+	// until its input ends; a producer still running then is stopped.
+	PipeFrom string `yaml:"pipe_from,omitempty" json:"pipe_from,omitempty"`
 	// Script is a path to the script to execute. It will be copied to the host and executed.
 	Script string `yaml:"script,omitempty" json:"script,omitempty"`
 	// Shell command used to execute this stage (defaults to benchmark.shell).
 	Shell string `yaml:"shell,omitempty" json:"shell,omitempty"`
+	// Become runs the stage command through sudo, as BecomeUser (default: root).
+	Become     bool   `yaml:"become,omitempty" json:"become,omitempty"`
+	BecomeUser string `yaml:"become_user,omitempty" json:"become_user,omitempty"`
 	// Whether the stage should be skipped.
 	Skip bool `yaml:"skip,omitempty" json:"skip,omitempty"`
 	// ExecuteOnlyFor limits a stage to one case name when cases are configured.
 	ExecuteOnlyFor string `yaml:"execute_only_for,omitempty" json:"execute_only_for,omitempty"`
+	// When skips the stage unless the condition holds, such as
+	// "${ENABLE_PROFILING} == 'true'". References resolve against the stage
+	// environment, custom run metadata, and the environment of benchctl.
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
 	// Whether the stage should be ran in the background, allowing execution to continue with other stages.
 	// Stages running in the background will be sent a SIGTERM when the last non-background
 	// task is executed.
-	Background  bool         `yaml:"background,omitempty" json:"background,omitempty"`
+	Background bool `yaml:"background,omitempty" json:"background,omitempty"`
+	// Warmup marks a stage that warms the system up: its outputs are collected below
+	// warmup/ and its metrics recorded apart from the run metrics.
+	Warmup bool `yaml:"warmup,omitempty" json:"warmup,omitempty"`
+	// Duration time-boxes an open-ended command such as a load generator: it is
+	// stopped like a background stage once the duration, e.g. "10m", has elapsed,
+	// which counts as success.
+	Duration    string       `yaml:"duration,omitempty" json:"duration,omitempty"`
 	HealthCheck *HealthCheck `yaml:"health_check,omitempty" json:"health_check,omitempty"`
 	Outputs     []Output     `yaml:"outputs,omitempty" json:"outputs,omitempty"`
+	// Files are uploaded to the stage hosts before the command runs, such as the
+	// config files, datasets, or binaries a script needs.
+	Files []StageFile `yaml:"files,omitempty" json:"files,omitempty"`
+	// FailureLogs are remote log files whose last lines are saved with the outputs
+	// of the stage below failure/ in the run directory when the stage fails.
+	FailureLogs []string `yaml:"failure_logs,omitempty" json:"failure_logs,omitempty"`
+	// Artifact is the file or container image produced by a build stage.
+	Artifact *Artifact `yaml:"artifact,omitempty" json:"artifact,omitempty"`
+	// Cache skips the stage when its command and inputs are unchanged since the last successful execution.
+	Cache *StageCache `yaml:"cache,omitempty" json:"cache,omitempty"`
+	// Netem emulates network conditions on the stage hosts while the stage runs.
+	Netem *Netem `yaml:"netem,omitempty" json:"netem,omitempty"`
+	// Chaos injects faults at time offsets while the stage command runs.
+	Chaos []ChaosAction `yaml:"chaos,omitempty" json:"chaos,omitempty"`
+	// Expect lists conditions on run metrics such as "error_rate < 0.01", checked
+	// after the stage completes. A violated expectation aborts the remaining stages.
+	Expect []string `yaml:"expect,omitempty" json:"expect,omitempty"`
+	// MetricsFromOutput extracts run metrics from the console output of the stage command.
+	MetricsFromOutput []OutputMetric `yaml:"metrics_from_output,omitempty" json:"metrics_from_output,omitempty"`
+	// Console throttles the stage output shown on the console. The run log still
+	// receives the complete output.
+	Console *ConsoleThrottle `yaml:"console,omitempty" json:"console,omitempty"`
+	// Session drives the command interactively through its stdin while it runs.
+	Session *Session `yaml:"session,omitempty" json:"session,omitempty"`
+}
+
+// ConsoleThrottle limits how fast a noisy stage prints to the console. Lines beyond
+// MaxLinesPerSecond are dropped from the console and reported as a suppressed count.
+type ConsoleThrottle struct {
+	MaxLinesPerSecond int `yaml:"max_lines_per_second" json:"max_lines_per_second"`
+}
+
+// OutputMetric records the first capture group of the last match of Pattern in the
+// stage output, e.g. `Requests/sec:\s+(\d+\.\d+)`, as the run metric Name.
+//
+// On a stage with several hosts, the value of each host is recorded as
+// <host>.<Name>, and Name holds the Aggregate of the numeric values of all hosts.
+type OutputMetric struct {
+	Name    string `yaml:"name" json:"name"`
+	Pattern string `yaml:"pattern" json:"pattern"`
+	// Aggregate combines the values of the hosts of a multi-host stage.
+	Aggregate string `yaml:"aggregate,omitempty" json:"aggregate,omitempty" jsonschema:"enum=mean,enum=sum,enum=min,enum=max,default=mean"`
+}
+
+// ChaosAction is a fault injected at a time offset from the start of a stage command.
+// Injections are recorded in metadata.json under chaos.
+type ChaosAction struct {
+	// kill sends a signal to processes matching target (pkill -f), restart_container
+	// restarts the docker container target, and partition drops all traffic between
+	// host and the host alias target until duration elapses or the stage ends.
+	Type string `yaml:"type" json:"type" jsonschema:"enum=kill,enum=restart_container,enum=partition"`
+	// Offset from the start of the stage, e.g. "30s".
+	After string `yaml:"after" json:"after"`
+	// Host alias to inject the fault on (default: local).
+	Host   string `yaml:"host,omitempty" json:"host,omitempty"`
+	Target string `yaml:"target" json:"target"`
+	// Signal sent by kill actions (default: KILL).
+	Signal string `yaml:"signal,omitempty" json:"signal,omitempty" jsonschema:"default=KILL"`
+	// How long a partition lasts (default: until the stage ends).
+	Duration string `yaml:"duration,omitempty" json:"duration,omitempty"`
+	// Run the injection through sudo -n.
+	Sudo bool `yaml:"sudo,omitempty" json:"sudo,omitempty"`
+}
+
+// Netem describes a tc netem qdisc installed on the root of one network interface.
+// The rule is removed when the stage completes, or for background stages when they
+// are stopped; rules left behind by failed runs are removed during teardown.
+type Netem struct {
+	Interface string `yaml:"interface" json:"interface"`
+	// Added one-way delay, e.g. "50ms".
+	Delay string `yaml:"delay,omitempty" json:"delay,omitempty"`
+	// Random variation of the delay, e.g. "10ms". Requires delay.
+	Jitter string `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+	// Packet loss in percent (0-100).
+	Loss float64 `yaml:"loss,omitempty" json:"loss,omitempty"`
+	// Bandwidth cap in tc units, e.g. "100mbit".
+	Rate string `yaml:"rate,omitempty" json:"rate,omitempty"`
+	// Run tc through sudo -n on hosts where the SSH user is not root.
+	Sudo bool `yaml:"sudo,omitempty" json:"sudo,omitempty"`
+}
+
+// Artifact describes what a build stage produces and where it is installed.
+// Exactly one of Path or Image must be set.
+type Artifact struct {
+	// Local file produced by the build command.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Local container image produced by the build command, transferred with docker save/load.
+	Image string `yaml:"image,omitempty" json:"image,omitempty"`
+	// Destination of a file artifact on each stage host.
+	RemotePath string `yaml:"remote_path,omitempty" json:"remote_path,omitempty"`
+	// Startup measures the startup time of a file artifact on the first stage host.
+	Startup *StartupCheck `yaml:"startup,omitempty" json:"startup,omitempty"`
+	// PerPlatform detects the OS and architecture of every stage host and runs the
+	// build command once per platform with GOOS, GOARCH, BENCHCTL_GOOS, and
+	// BENCHCTL_GOARCH set. Path and RemotePath may reference those variables, for
+	// example to pick a prebuilt binary.
+	PerPlatform bool `yaml:"per_platform,omitempty" json:"per_platform,omitempty"`
+}
+
+// StartupCheck runs an installed binary on the first stage host and records its
+// median wall-clock time.
+type StartupCheck struct {
+	// Arguments passed to the binary, e.g. "--version".
+	Args string `yaml:"args,omitempty" json:"args,omitempty"`
+	// Number of timed executions (default: 5).
+	Runs int `yaml:"runs,omitempty" json:"runs,omitempty" jsonschema:"default=5"`
+}
+
+// StageCache declares what a cached stage depends on.
+// The cache key hashes the stage command or script, shell, host, case env, CLI env,
+// the contents of every input file, and Key.
+type StageCache struct {
+	// Local files (glob patterns allowed) whose contents are part of the cache key,
+	// relative to the directory of the config file.
+	Inputs []string `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	// Extra key material, e.g. a version string bumped to invalidate the cache.
+	Key string `yaml:"key,omitempty" json:"key,omitempty"`
+}
+
+// ResolveCacheInputs makes the relative cache inputs of the stages of cfg relative
+// to dir, the directory of the config file, instead of the working directory.
+func ResolveCacheInputs(cfg *Config, dir string) {
+	for i := range cfg.Stages {
+		if cfg.Stages[i].Cache == nil {
+			continue
+		}
+		for j, input := range cfg.Stages[i].Cache.Inputs {
+			if !filepath.IsAbs(input) {
+				cfg.Stages[i].Cache.Inputs[j] = filepath.Join(dir, input)
+			}
+		}
+	}
+}
+
+// Container is the container a stage with runtime docker runs in.
+type Container struct {
+	Image string `yaml:"image" json:"image"`
+	// Mounts bind host paths into the container as host:container[:ro], e.g. the
+	// directory outputs are written to, which are collected from the host.
+	Mounts []string `yaml:"mounts,omitempty" json:"mounts,omitempty"`
+	// Network is the docker network to join, such as "host".
+	Network string `yaml:"network,omitempty" json:"network,omitempty"`
+}
+
+// StageFile is a local file uploaded to the stage hosts.
+type StageFile struct {
+	LocalPath string `yaml:"local_path" json:"local_path"`
+	// RemotePath is where the file is stored on the host; missing directories are
+	// created. It supports the templates of output paths.
+	RemotePath string `yaml:"remote_path" json:"remote_path"`
 }
 
 // Cleanup is a workflow teardown step that runs after all stages, even on failure.
@@ -117,8 +586,30 @@ type HealthCheck struct {
 type Output struct {
 	Name       string `yaml:"name" json:"name"`
 	RemotePath string `yaml:"remote_path" json:"remote_path"`
-	// If not provided, saved under the run's output directory
+	// LocalPath is where the collected file is stored, relative to the run directory,
+	// with the same $VAR templates as remote_path, such as
+	// results_${BENCHCTL_ITERATION}_${THREADS}.csv (default: <name><extension of
+	// remote_path>). For a remote_path pattern, it is the directory of the matches.
 	LocalPath string `yaml:"local_path,omitempty" json:"local_path,omitempty"`
+	// Format "prometheus" parses the collected file as Prometheus text exposition and
+	// records every sample as a run metric. Outputs with a .prom remote_path are
+	// parsed as Prometheus text when unset; "raw" disables parsing. "gobench" marks
+	// go test -bench output, which compare summarizes like benchstat.
+	Format string `yaml:"format,omitempty" json:"format,omitempty" jsonschema:"enum=prometheus,enum=raw,enum=gobench"`
+	// Compress compresses the file on the host before the transfer and stores it
+	// compressed with a .gz or .zst suffix. Readers of the run decompress it.
+	Compress string `yaml:"compress,omitempty" json:"compress,omitempty" jsonschema:"enum=gzip,enum=zstd"`
+	// Decompress stores a compressed output uncompressed, so Compress only shrinks
+	// the transfer, e.g. of large CSVs over a WAN link.
+	Decompress bool `yaml:"decompress,omitempty" json:"decompress,omitempty"`
+	// CleanupRemote deletes the file on the host once its collected copy matches
+	// its SHA-256 checksum, so the next run cannot collect a stale file.
+	CleanupRemote bool `yaml:"cleanup_remote,omitempty" json:"cleanup_remote,omitempty"`
+	// OnStale decides what happens when the file on the host was last modified before
+	// the stage started, for example after a workload crashed without writing new
+	// results: "warn" (default) logs a warning, "fail" fails the stage without
+	// collecting the file, and "ignore" skips the check.
+	OnStale string `yaml:"on_stale,omitempty" json:"on_stale,omitempty" jsonschema:"enum=warn,enum=fail,enum=ignore,default=warn"`
 }
 
 // ParseYAML loads and validates configuration using strict decoding.
@@ -136,6 +627,13 @@ func ParseYAML(data []byte) (*Config, error) {
 func validateConfig(cfg *Config) error {
 	var errs []string
 
+	// inventory hosts are imported and host groups expand in place before any
+	// host list is checked
+	errs = append(errs, importHostsFrom(cfg)...)
+	errs = append(errs, importTerraformHosts(cfg)...)
+	errs = append(errs, resolveSSHAliases(cfg)...)
+	errs = append(errs, expandHostGroups(cfg)...)
+
 	// benchmark
 	if strings.TrimSpace(cfg.Benchmark.Name) == "" {
 		errs = append(errs, "benchmark.name must be set")
@@ -146,8 +644,118 @@ func validateConfig(cfg *Config) error {
 	if cfg.Benchmark.Sync != nil && strings.TrimSpace(cfg.Benchmark.Sync.Remote) == "" {
 		errs = append(errs, "benchmark.sync.remote must be set")
 	}
+	if influx := cfg.Benchmark.Influx; influx != nil {
+		if strings.TrimSpace(influx.URL) == "" {
+			errs = append(errs, "benchmark.influx.url must be set")
+		}
+		if strings.TrimSpace(influx.Bucket) == "" {
+			errs = append(errs, "benchmark.influx.bucket must be set")
+		}
+		if strings.TrimSpace(influx.TokenEnv) == "" {
+			influx.TokenEnv = "INFLUX_TOKEN"
+		}
+		if strings.TrimSpace(influx.TimestampColumn) == "" {
+			influx.TimestampColumn = "timestamp_ms"
+		}
+		switch influx.Precision {
+		case "":
+			influx.Precision = "ms"
+		case "s", "ms", "us", "ns":
+			// ok
+		default:
+			errs = append(errs, "benchmark.influx.precision must be one of [s, ms, us, ns]")
+		}
+	}
+
+	for i := range cfg.Benchmark.Webhooks {
+		errs = append(errs, validateWebhook(i, &cfg.Benchmark.Webhooks[i])...)
+	}
+
+	switch cfg.Benchmark.Order {
+	case "", "config", "random":
+		// ok
+	default:
+		errs = append(errs, "benchmark.order must be one of [config, random]")
+	}
+	if cfg.Benchmark.Seed != nil && cfg.Benchmark.Order != "random" {
+		errs = append(errs, "benchmark.seed requires benchmark.order random")
+	}
+	if cfg.Benchmark.Trials < 0 {
+		errs = append(errs, "benchmark.trials must be >= 0")
+	}
+	if cfg.Benchmark.Trials > 1 && cfg.Benchmark.SkipAnalysis {
+		errs = append(errs, "benchmark.trials cannot be combined with skip_analysis, since every trial checks its own expectations")
+	}
+	if cfg.Benchmark.WarmupTrials < 0 {
+		errs = append(errs, "benchmark.warmup_trials must be >= 0")
+	}
+	if cfg.Benchmark.WarmupTrials > 0 && cfg.Benchmark.SkipAnalysis {
+		errs = append(errs, "benchmark.warmup_trials cannot be combined with skip_analysis")
+	}
+	if cooldown := cfg.Benchmark.Cooldown; cooldown != nil {
+		errs = append(errs, validateCooldown(cooldown, cfg.Hosts)...)
+	}
+	for i := range cfg.Benchmark.Reset {
+		errs = append(errs, validateResetHook(i, &cfg.Benchmark.Reset[i], cfg.Hosts)...)
+	}
+	for i, link := range cfg.Benchmark.Links {
+		if strings.TrimSpace(link.Name) == "" {
+			errs = append(errs, fmt.Sprintf("benchmark.links[%d].name must be set", i))
+		}
+		if u, err := url.Parse(link.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("benchmark.links[%d].url must be an absolute URL", i))
+		}
+	}
+	if watchdog := cfg.Benchmark.Watchdog; watchdog != nil {
+		errs = append(errs, validateWatchdog(watchdog)...)
+	}
+	if capabilities := cfg.Benchmark.Capabilities; capabilities != nil {
+		if capabilities.Tools == nil {
+			capabilities.Tools = []string{"perf", "nc"}
+		}
+		names := map[string]int{}
+		for i, tool := range capabilities.Tools {
+			name := CapabilityName(tool)
+			previous, taken := names[name]
+			switch {
+			case !toolNamePattern.MatchString(tool):
+				errs = append(errs, fmt.Sprintf("benchmark.capabilities.tools[%d] %q must be a command name", i, tool))
+			case slices.Contains(detectedCapabilities, name):
+				errs = append(errs, fmt.Sprintf("benchmark.capabilities.tools[%d] %q would replace the detected BENCHCTL_CAP_%s", i, tool, name))
+			case taken && capabilities.Tools[previous] != tool:
+				errs = append(errs, fmt.Sprintf("benchmark.capabilities.tools[%d] %q and tools[%d] %q are both BENCHCTL_CAP_%s", i, tool, previous, capabilities.Tools[previous], name))
+			case !taken:
+				names[name] = i
+			}
+		}
+	}
+	for i, name := range cfg.Benchmark.CaptureVersions {
+		if !toolNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Sprintf("benchmark.capture_versions[%d] %q must be a package or command name", i, name))
+		}
+	}
+	if policy := cfg.Benchmark.FailurePolicy; policy != nil {
+		errs = append(errs, validateFailurePolicy(policy)...)
+	}
+	for i, rule := range cfg.Benchmark.Compare {
+		errs = append(errs, validateMetricComparison(i, rule)...)
+	}
+
+	errs = append(errs, validateMatrix(cfg.Matrix)...)
 
 	// hosts: allow empty for local only
+	for _, alias := range slices.Sorted(maps.Keys(cfg.Hosts)) {
+		host := cfg.Hosts[alias]
+		errs = append(errs, validateSecretRef(fmt.Sprintf("hosts.%s.password", alias), host.Password)...)
+		errs = append(errs, validateSecretRef(fmt.Sprintf("hosts.%s.key_password", alias), host.KeyPassword)...)
+		errs = append(errs, validateSecretRef(fmt.Sprintf("hosts.%s.key_file", alias), host.KeyFile)...)
+		errs = append(errs, validateSecretRef(fmt.Sprintf("hosts.%s.become_password", alias), host.BecomePassword)...)
+		if host.SSH != nil {
+			errs = append(errs, validateSSHOptions(alias, host.SSH)...)
+		}
+		errs = append(errs, validateKubernetesHost(alias, host)...)
+		errs = append(errs, validateProvision(alias, host)...)
+	}
 
 	// stages
 	hostAliases := map[string]struct{}{}
@@ -213,6 +821,42 @@ func validateConfig(cfg *Config) error {
 		if hasCmd == hasScript {
 			errs = append(errs, "exactly one of command or script must be set")
 		}
+		for j, file := range st.Files {
+			if strings.TrimSpace(file.LocalPath) == "" {
+				errs = append(errs, fmt.Sprintf("stages[%d].files[%d].local_path must be set", i, j))
+			}
+			if strings.TrimSpace(file.RemotePath) == "" {
+				errs = append(errs, fmt.Sprintf("stages[%d].files[%d].remote_path must be set", i, j))
+			}
+		}
+		for j, logPath := range st.FailureLogs {
+			if strings.TrimSpace(logPath) == "" {
+				errs = append(errs, fmt.Sprintf("stages[%d].failure_logs[%d] must be set", i, j))
+			}
+		}
+		switch st.Runtime {
+		case "":
+			if st.Container != nil {
+				errs = append(errs, fmt.Sprintf("stages[%d].container requires runtime docker", i))
+			}
+		case "docker":
+			if st.Container == nil || strings.TrimSpace(st.Container.Image) == "" {
+				errs = append(errs, fmt.Sprintf("stages[%d].container.image must be set for runtime docker", i))
+			}
+			switch {
+			case st.Type == "build":
+				errs = append(errs, fmt.Sprintf("stages[%d].runtime docker cannot be used with build stages", i))
+			case st.Background:
+				errs = append(errs, fmt.Sprintf("stages[%d].runtime docker cannot be used with background stages", i))
+			case st.Become:
+				errs = append(errs, fmt.Sprintf("stages[%d].runtime docker cannot be used with become", i))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("stages[%d].runtime must be one of [docker]", i))
+		}
+		if len(st.Files) > 0 && st.Type == "build" {
+			errs = append(errs, fmt.Sprintf("stages[%d].files cannot be used with build stages, which run locally", i))
+		}
 		if strings.TrimSpace(st.ExecuteOnlyFor) != "" {
 			if len(cfg.Cases) == 0 {
 				errs = append(errs, fmt.Sprintf("stages[%d].execute_only_for requires cases", i))
@@ -221,6 +865,98 @@ func validateConfig(cfg *Config) error {
 			}
 		}
 
+		switch st.Type {
+		case "":
+			if st.Artifact != nil {
+				errs = append(errs, fmt.Sprintf("stages[%d].artifact requires type build", i))
+			}
+		case "build":
+			errs = append(errs, validateBuildStage(i, st)...)
+		default:
+			errs = append(errs, fmt.Sprintf("stages[%d].type must be one of [build]", i))
+		}
+		if st.Cache != nil {
+			if st.Background {
+				errs = append(errs, fmt.Sprintf("stages[%d].cache cannot be used with background stages", i))
+			}
+			if len(st.Outputs) > 0 {
+				errs = append(errs, fmt.Sprintf("stages[%d].cache cannot be used with outputs", i))
+			}
+			for j, input := range st.Cache.Inputs {
+				if strings.TrimSpace(input) == "" {
+					errs = append(errs, fmt.Sprintf("stages[%d].cache.inputs[%d] must be non-empty", i, j))
+				}
+			}
+		}
+
+		if st.Netem != nil {
+			errs = append(errs, validateNetem(i, st.Netem)...)
+		}
+		if st.Session != nil {
+			errs = append(errs, validateSession(i, st)...)
+		}
+		if len(st.Expect) > 0 && st.Background {
+			errs = append(errs, fmt.Sprintf("stages[%d].expect cannot be used with background stages", i))
+		}
+		if st.Warmup && len(st.Expect) > 0 {
+			errs = append(errs, fmt.Sprintf("stages[%d].expect cannot be used with warmup stages, whose metrics are not run metrics", i))
+		}
+		if st.Warmup && st.Background {
+			errs = append(errs, fmt.Sprintf("stages[%d].warmup cannot be used with background stages", i))
+		}
+		if strings.TrimSpace(st.When) != "" {
+			if _, err := ParseCondition(st.When); err != nil {
+				errs = append(errs, fmt.Sprintf("stages[%d].%v", i, err))
+			}
+		}
+		for j, expr := range st.Expect {
+			if _, err := ParseExpectation(expr); err != nil {
+				errs = append(errs, fmt.Sprintf("stages[%d].expect[%d]: %v", i, j, err))
+			}
+		}
+		if st.Duration != "" {
+			if d, err := time.ParseDuration(st.Duration); err != nil || d <= 0 {
+				errs = append(errs, fmt.Sprintf("stages[%d].duration must be a positive duration", i))
+			}
+			if st.Background {
+				errs = append(errs, fmt.Sprintf("stages[%d].duration cannot be used with background stages", i))
+			}
+			if st.Type == "build" {
+				errs = append(errs, fmt.Sprintf("stages[%d].duration cannot be used with build stages", i))
+			}
+		}
+		if st.BecomeUser != "" && !st.Become {
+			errs = append(errs, fmt.Sprintf("stages[%d].become_user requires become", i))
+		}
+		if st.Become && st.Type == "build" {
+			errs = append(errs, fmt.Sprintf("stages[%d].become cannot be used with build stages", i))
+		}
+		if len(st.MetricsFromOutput) > 0 {
+			if st.Background {
+				errs = append(errs, fmt.Sprintf("stages[%d].metrics_from_output cannot be used with background stages", i))
+			}
+			if st.Type == "build" {
+				errs = append(errs, fmt.Sprintf("stages[%d].metrics_from_output cannot be used with build stages", i))
+			}
+			errs = append(errs, validateOutputMetrics(i, st.MetricsFromOutput)...)
+		}
+		if st.Console != nil {
+			if st.Background {
+				errs = append(errs, fmt.Sprintf("stages[%d].console cannot be used with background stages", i))
+			}
+			if st.Console.MaxLinesPerSecond <= 0 {
+				errs = append(errs, fmt.Sprintf("stages[%d].console.max_lines_per_second must be > 0", i))
+			}
+		}
+		if len(st.Chaos) > 0 {
+			if st.Background {
+				errs = append(errs, fmt.Sprintf("stages[%d].chaos cannot be used with background stages", i))
+			}
+			for j := range st.Chaos {
+				errs = append(errs, validateChaosAction(i, j, &st.Chaos[j], cfg.Hosts, hostAliases)...)
+			}
+		}
+
 		// health check validation
 		if st.HealthCheck != nil {
 			hc := st.HealthCheck
@@ -251,8 +987,26 @@ func validateConfig(cfg *Config) error {
 			if strings.TrimSpace(output.RemotePath) == "" {
 				errs = append(errs, fmt.Sprintf("stages[%d].outputs[%d].remote_path must be set", i, j))
 			}
-			if strings.TrimSpace(output.LocalPath) != "" {
-				errs = append(errs, fmt.Sprintf("stages[%d].outputs[%d].local_path is not allowed; files are stored directly in the run directory using output.name", i, j))
+			if localPath := path.Clean(output.LocalPath); output.LocalPath != "" && (path.IsAbs(localPath) || localPath == ".." || strings.HasPrefix(localPath, "../")) {
+				errs = append(errs, fmt.Sprintf("stages[%d].outputs[%d].local_path must be a relative path inside the run directory", i, j))
+			}
+			switch output.Format {
+			case "", "prometheus", "raw", "gobench":
+			default:
+				errs = append(errs, fmt.Sprintf("stages[%d].outputs[%d].format must be one of [prometheus, raw, gobench]", i, j))
+			}
+			switch output.Compress {
+			case "", "gzip", "zstd":
+			default:
+				errs = append(errs, fmt.Sprintf("stages[%d].outputs[%d].compress must be one of [gzip, zstd]", i, j))
+			}
+			if output.Decompress && output.Compress == "" {
+				errs = append(errs, fmt.Sprintf("stages[%d].outputs[%d].decompress requires compress", i, j))
+			}
+			switch output.OnStale {
+			case "", "warn", "fail", "ignore":
+			default:
+				errs = append(errs, fmt.Sprintf("stages[%d].outputs[%d].on_stale must be one of [warn, fail, ignore]", i, j))
 			}
 		}
 	}
@@ -274,6 +1028,10 @@ func validateConfig(cfg *Config) error {
 		}
 	}
 
+	errs = append(errs, validateStageDependencies(cfg.Stages, stageNames)...)
+	errs = append(errs, validateStagePipes(cfg, stageNames)...)
+	errs = append(errs, validateParallelGroups(cfg.Stages)...)
+
 	cleanupNames := map[string]int{}
 	for i := range cfg.Cleanup {
 		cl := &cfg.Cleanup[i]
@@ -318,6 +1076,7 @@ func validateConfig(cfg *Config) error {
 			errs = append(errs, fmt.Sprintf("cleanup[%d]: exactly one of command or script must be set", i))
 		}
 	}
+	errs = append(errs, validateWindowsHosts(cfg)...)
 
 	if len(errs) > 0 {
 		return errors.New(strings.Join(errs, "; "))
@@ -325,9 +1084,532 @@ func validateConfig(cfg *Config) error {
 	return nil
 }
 
+func validateBuildStage(i int, st *Stage) []string {
+	var errs []string
+	if st.Artifact == nil {
+		return []string{fmt.Sprintf("stages[%d].artifact must be set for build stages", i)}
+	}
+	hasPath := strings.TrimSpace(st.Artifact.Path) != ""
+	hasImage := strings.TrimSpace(st.Artifact.Image) != ""
+	if hasPath == hasImage {
+		errs = append(errs, fmt.Sprintf("stages[%d].artifact: exactly one of path or image must be set", i))
+	}
+	if hasPath && strings.TrimSpace(st.Artifact.RemotePath) == "" {
+		errs = append(errs, fmt.Sprintf("stages[%d].artifact.remote_path must be set for file artifacts", i))
+	}
+	if hasImage && strings.TrimSpace(st.Artifact.RemotePath) != "" {
+		errs = append(errs, fmt.Sprintf("stages[%d].artifact.remote_path is not allowed for image artifacts", i))
+	}
+	if st.Artifact.PerPlatform && hasImage {
+		errs = append(errs, fmt.Sprintf("stages[%d].artifact.per_platform is only supported for file artifacts", i))
+	}
+	if startup := st.Artifact.Startup; startup != nil {
+		if st.Artifact.PerPlatform {
+			errs = append(errs, fmt.Sprintf("stages[%d].artifact.startup cannot be used with per_platform", i))
+		}
+		if hasImage {
+			errs = append(errs, fmt.Sprintf("stages[%d].artifact.startup is only supported for file artifacts", i))
+		}
+		if startup.Runs < 0 {
+			errs = append(errs, fmt.Sprintf("stages[%d].artifact.startup.runs must be >= 0", i))
+		}
+		if startup.Runs == 0 {
+			startup.Runs = 5
+		}
+	}
+	if st.Background || st.HealthCheck != nil || len(st.Outputs) > 0 || st.Cache != nil || st.Netem != nil || len(st.Chaos) > 0 {
+		errs = append(errs, fmt.Sprintf("stages[%d]: build stages cannot set background, health_check, outputs, cache, netem, or chaos", i))
+	}
+	return errs
+}
+
+func validateWebhook(i int, webhook *Webhook) []string {
+	var errs []string
+	field := fmt.Sprintf("benchmark.webhooks[%d]", i)
+	if u, err := url.Parse(strings.TrimSpace(webhook.URL)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, field+".url must be an http or https URL")
+	}
+	if webhook.Secret != "" && !IsSecretRef(webhook.Secret) {
+		errs = append(errs, field+".secret must be a secret reference (env://, file://, or exec://)")
+	}
+	errs = append(errs, validateSecretRef(field+".secret", webhook.Secret)...)
+	if webhook.Timeout == "" {
+		webhook.Timeout = "10s"
+	}
+	if d, err := time.ParseDuration(webhook.Timeout); err != nil || d <= 0 {
+		errs = append(errs, field+".timeout must be a positive duration")
+	}
+	return errs
+}
+
+func validateCooldown(cooldown *Cooldown, hosts map[string]Host) []string {
+	var errs []string
+	if cooldown.Period == "" && cooldown.MaxLoad == 0 && cooldown.MaxTempC == 0 {
+		errs = append(errs, "benchmark.cooldown must set at least one of period, max_load, or max_temp_c")
+	}
+	if cooldown.MaxLoad < 0 || cooldown.MaxTempC < 0 {
+		errs = append(errs, "benchmark.cooldown.max_load and max_temp_c must be >= 0")
+	}
+	if cooldown.Timeout == "" {
+		cooldown.Timeout = "10m"
+	}
+	if cooldown.Interval == "" {
+		cooldown.Interval = "5s"
+	}
+	if d, err := time.ParseDuration(cooldown.Timeout); err != nil || d <= 0 {
+		errs = append(errs, "benchmark.cooldown.timeout must be a positive duration")
+	}
+	if d, err := time.ParseDuration(cooldown.Interval); err != nil || d <= 0 {
+		errs = append(errs, "benchmark.cooldown.interval must be a positive duration")
+	}
+	if d, err := time.ParseDuration(cooldown.Period); cooldown.Period != "" && (err != nil || d < 0) {
+		errs = append(errs, "benchmark.cooldown.period must be a non-negative duration")
+	}
+	for _, hostAlias := range cooldown.Hosts {
+		if _, ok := hosts[hostAlias]; !ok && hostAlias != "local" {
+			errs = append(errs, fmt.Sprintf("benchmark.cooldown.hosts references unknown host '%s'", hostAlias))
+		}
+	}
+	return errs
+}
+
+func validateWatchdog(watchdog *Watchdog) []string {
+	var errs []string
+	if watchdog.Interval == "" {
+		watchdog.Interval = "10s"
+	}
+	if watchdog.Timeout == "" {
+		watchdog.Timeout = "5s"
+	}
+	if watchdog.Failures == 0 {
+		watchdog.Failures = 3
+	}
+	if d, err := time.ParseDuration(watchdog.Interval); err != nil || d <= 0 {
+		errs = append(errs, "benchmark.watchdog.interval must be a positive duration")
+	}
+	if d, err := time.ParseDuration(watchdog.Timeout); err != nil || d <= 0 {
+		errs = append(errs, "benchmark.watchdog.timeout must be a positive duration")
+	}
+	if watchdog.Failures < 0 {
+		errs = append(errs, "benchmark.watchdog.failures must be >= 1")
+	}
+	return errs
+}
+
+var parameterNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var toolNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+func validateMatrix(matrix []Parameter) []string {
+	var errs []string
+	names := map[string]int{}
+	for i, parameter := range matrix {
+		if !parameterNamePattern.MatchString(parameter.Name) {
+			errs = append(errs, fmt.Sprintf("matrix[%d].name must be a valid environment variable name", i))
+		} else if previous, exists := names[parameter.Name]; exists {
+			errs = append(errs, fmt.Sprintf("matrix[%d].name duplicates matrix[%d] (%s)", i, previous, parameter.Name))
+		} else {
+			names[parameter.Name] = i
+		}
+		if len(parameter.Values) == 0 {
+			errs = append(errs, fmt.Sprintf("matrix[%d].values must not be empty", i))
+		}
+	}
+	return errs
+}
+
+func validateFailurePolicy(policy *FailurePolicy) []string {
+	var errs []string
+	if policy.OnFailure == "" {
+		policy.OnFailure = "stop"
+	}
+	if policy.OnFailure != "stop" && policy.OnFailure != "continue" {
+		errs = append(errs, "benchmark.failure_policy.on_failure must be one of [stop, continue]")
+	}
+	if policy.Retries < 0 {
+		errs = append(errs, "benchmark.failure_policy.retries must be >= 0")
+	}
+	if policy.MaxRetries < 0 {
+		errs = append(errs, "benchmark.failure_policy.max_retries must be >= 0")
+	}
+	return errs
+}
+
+func validateResetHook(i int, hook *ResetHook, hosts map[string]Host) []string {
+	var errs []string
+	prefix := fmt.Sprintf("benchmark.reset[%d]", i)
+	if strings.TrimSpace(hook.Name) == "" {
+		errs = append(errs, prefix+".name must be set")
+	}
+	if _, ok := hosts[hook.Host]; hook.Host != "" && hook.Host != "local" && !ok {
+		errs = append(errs, fmt.Sprintf("%s.host references unknown host '%s'", prefix, hook.Host))
+	}
+	switch hook.Type {
+	case "command":
+		if strings.TrimSpace(hook.Command) == "" {
+			errs = append(errs, prefix+".command must be set for command hooks")
+		}
+	case "restart_container", "libvirt_snapshot", "k8s_deployment":
+		if strings.TrimSpace(hook.Target) == "" {
+			errs = append(errs, fmt.Sprintf("%s.target must be set for %s hooks", prefix, hook.Type))
+		}
+		if hook.Command != "" {
+			errs = append(errs, fmt.Sprintf("%s.command is only valid for command hooks", prefix))
+		}
+	default:
+		errs = append(errs, prefix+".type must be one of [command, restart_container, libvirt_snapshot, k8s_deployment]")
+	}
+	if hook.Type == "libvirt_snapshot" && strings.TrimSpace(hook.Snapshot) == "" {
+		errs = append(errs, prefix+".snapshot must be set for libvirt_snapshot hooks")
+	}
+	if hook.Type == "k8s_deployment" {
+		if hook.Timeout == "" {
+			hook.Timeout = "5m"
+		}
+		if d, err := time.ParseDuration(hook.Timeout); err != nil || d <= 0 {
+			errs = append(errs, prefix+".timeout must be a positive duration")
+		}
+	} else if hook.Timeout != "" || hook.Namespace != "" {
+		errs = append(errs, prefix+": namespace and timeout are only valid for k8s_deployment hooks")
+	}
+	return errs
+}
+
+var netemRatePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([kmgt]?bit|[kmgt]?bps)$`)
+
+// StageNames is a list of stage names in which an empty list differs from an
+// unset one: depends_on: [] survives rendering and the metadata.
+type StageNames []string
+
+// IsZero reports whether the list is unset, for omitempty and omitzero.
+func (n StageNames) IsZero() bool {
+	return n == nil
+}
+
+// DependencyGraph reports whether stages run as a dependency graph, which any
+// stage setting depends_on, even to an empty list, turns them into.
+func DependencyGraph(stages []Stage) bool {
+	return slices.ContainsFunc(stages, func(stage Stage) bool { return stage.DependsOn != nil })
+}
+
+// StageDependencies returns the names of the stages each stage waits for in a
+// dependency graph: its depends_on, or the stage before it in config order when
+// it does not set depends_on.
+func StageDependencies(stages []Stage) [][]string {
+	dependencies := make([][]string, len(stages))
+	for i, stage := range stages {
+		switch {
+		case stage.DependsOn != nil:
+			dependencies[i] = stage.DependsOn
+		case i > 0:
+			dependencies[i] = []string{stages[i-1].Name}
+		}
+	}
+	return dependencies
+}
+
+func validateStageDependencies(stages []Stage, stageNames map[string]int) []string {
+	var errs []string
+	for i, stage := range stages {
+		for j, dependency := range stage.DependsOn {
+			switch index, ok := stageNames[dependency]; {
+			case !ok:
+				errs = append(errs, fmt.Sprintf("stages[%d].depends_on[%d] references unknown stage '%s'", i, j, dependency))
+			case index == i:
+				errs = append(errs, fmt.Sprintf("stages[%d].depends_on[%d] cannot reference the stage itself", i, j))
+			case slices.Contains(stage.DependsOn[:j], dependency):
+				errs = append(errs, fmt.Sprintf("stages[%d].depends_on contains duplicate stage '%s'", i, dependency))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// Depth-first search over the graph, with the implicit dependencies of stages
+	// without depends_on; a stage reached again while it is still being visited
+	// closes a cycle.
+	dependencies := StageDependencies(stages)
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(stages))
+	var visit func(i int) int
+	visit = func(i int) int {
+		state[i] = visiting
+		for _, dependency := range dependencies[i] {
+			j := stageNames[dependency]
+			if state[j] == visiting {
+				return j
+			}
+			if state[j] == unvisited {
+				if cycle := visit(j); cycle >= 0 {
+					return cycle
+				}
+			}
+		}
+		state[i] = visited
+		return -1
+	}
+	for i := range stages {
+		if state[i] != unvisited {
+			continue
+		}
+		if cycle := visit(i); cycle >= 0 {
+			errs = append(errs, fmt.Sprintf("stages[%d].depends_on forms a cycle through stage '%s'", cycle, stages[cycle].Name))
+			break
+		}
+	}
+	return errs
+}
+
+// validateStagePipes checks that every pipe_from references an earlier stage
+// with no other consumer, and that both run plainly on one host. A stream cannot
+// be replayed, so piped stages are neither retried nor cached.
+func validateStagePipes(cfg *Config, stageNames map[string]int) []string {
+	var errs []string
+	consumers := map[string]int{}
+	for i, stage := range cfg.Stages {
+		if stage.PipeFrom == "" {
+			continue
+		}
+		field := fmt.Sprintf("stages[%d].pipe_from", i)
+		j, ok := stageNames[stage.PipeFrom]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Sprintf("%s references unknown stage '%s'", field, stage.PipeFrom))
+			continue
+		case j >= i:
+			errs = append(errs, fmt.Sprintf("%s must reference an earlier stage", field))
+			continue
+		}
+		if k, ok := consumers[stage.PipeFrom]; ok {
+			errs = append(errs, fmt.Sprintf("%s references stage '%s', which already pipes into stages[%d]", field, stage.PipeFrom, k))
+		}
+		consumers[stage.PipeFrom] = i
+		producer := cfg.Stages[j]
+		if producer.PipeFrom != "" {
+			errs = append(errs, fmt.Sprintf("%s cannot reference stage '%s', which reads pipe_from itself", field, stage.PipeFrom))
+		}
+		for _, end := range []Stage{producer, stage} {
+			switch {
+			case end.Background:
+				errs = append(errs, fmt.Sprintf("%s cannot connect background stage '%s'", field, end.Name))
+			case end.Type == "build":
+				errs = append(errs, fmt.Sprintf("%s cannot connect build stage '%s'", field, end.Name))
+			case len(end.Hosts) > 1:
+				errs = append(errs, fmt.Sprintf("%s cannot connect stage '%s', which runs on several hosts", field, end.Name))
+			case end.Cache != nil:
+				errs = append(errs, fmt.Sprintf("%s cannot connect cached stage '%s'", field, end.Name))
+			case end.Parallel != "":
+				errs = append(errs, fmt.Sprintf("%s cannot connect stage '%s' of parallel group '%s'", field, end.Name, end.Parallel))
+			}
+		}
+		if len(producer.MetricsFromOutput) > 0 {
+			errs = append(errs, fmt.Sprintf("%s cannot reference stage '%s' with metrics_from_output, its stdout goes to the pipe", field, stage.PipeFrom))
+		}
+		if DependencyGraph(cfg.Stages) {
+			errs = append(errs, fmt.Sprintf("%s cannot be used with depends_on", field))
+		}
+		if policy := cfg.Benchmark.FailurePolicy; policy != nil && policy.Retries > 0 {
+			errs = append(errs, fmt.Sprintf("%s cannot be used with benchmark.failure_policy.retries", field))
+		}
+	}
+	return errs
+}
+
+func validateParallelGroups(stages []Stage) []string {
+	var errs []string
+	dependencies := DependencyGraph(stages)
+	last := map[string]int{}
+	for i, stage := range stages {
+		if stage.Parallel == "" {
+			continue
+		}
+		if dependencies {
+			errs = append(errs, fmt.Sprintf("stages[%d].parallel cannot be used with depends_on", i))
+		}
+		if j, ok := last[stage.Parallel]; ok && j != i-1 {
+			errs = append(errs, fmt.Sprintf("stages[%d].parallel group '%s' must directly follow the other stages of the group, the last being stages[%d]", i, stage.Parallel, j))
+		}
+		last[stage.Parallel] = i
+	}
+	return errs
+}
+
+func validateOutputMetrics(i int, metrics []OutputMetric) []string {
+	var errs []string
+	names := make(map[string]int, len(metrics))
+	for j := range metrics {
+		metric := &metrics[j]
+		switch metric.Aggregate {
+		case "":
+			metric.Aggregate = "mean"
+		case "mean", "sum", "min", "max":
+		default:
+			errs = append(errs, fmt.Sprintf("stages[%d].metrics_from_output[%d].aggregate must be mean, sum, min, or max", i, j))
+		}
+		if strings.TrimSpace(metric.Name) == "" {
+			errs = append(errs, fmt.Sprintf("stages[%d].metrics_from_output[%d].name is required", i, j))
+		} else if previous, exists := names[metric.Name]; exists {
+			errs = append(errs, fmt.Sprintf("stages[%d].metrics_from_output[%d].name duplicates metrics_from_output[%d] (%s)", i, j, previous, metric.Name))
+		} else {
+			names[metric.Name] = j
+		}
+		pattern, err := regexp.Compile(metric.Pattern)
+		switch {
+		case strings.TrimSpace(metric.Pattern) == "":
+			errs = append(errs, fmt.Sprintf("stages[%d].metrics_from_output[%d].pattern is required", i, j))
+		case err != nil:
+			errs = append(errs, fmt.Sprintf("stages[%d].metrics_from_output[%d].pattern: %v", i, j, err))
+		case pattern.NumSubexp() == 0:
+			errs = append(errs, fmt.Sprintf("stages[%d].metrics_from_output[%d].pattern must contain a capture group", i, j))
+		}
+	}
+	return errs
+}
+
+func validateNetem(i int, netem *Netem) []string {
+	var errs []string
+	if strings.TrimSpace(netem.Interface) == "" {
+		errs = append(errs, fmt.Sprintf("stages[%d].netem.interface must be set", i))
+	}
+	if netem.Delay == "" && netem.Loss == 0 && netem.Rate == "" {
+		errs = append(errs, fmt.Sprintf("stages[%d].netem must set at least one of delay, loss, or rate", i))
+	}
+	if d, err := time.ParseDuration(netem.Delay); netem.Delay != "" && (err != nil || d < 0) {
+		errs = append(errs, fmt.Sprintf("stages[%d].netem.delay must be a non-negative duration", i))
+	}
+	if d, err := time.ParseDuration(netem.Jitter); netem.Jitter != "" && (err != nil || d < 0) {
+		errs = append(errs, fmt.Sprintf("stages[%d].netem.jitter must be a non-negative duration", i))
+	}
+	if netem.Jitter != "" && netem.Delay == "" {
+		errs = append(errs, fmt.Sprintf("stages[%d].netem.jitter requires delay", i))
+	}
+	if netem.Loss < 0 || netem.Loss > 100 {
+		errs = append(errs, fmt.Sprintf("stages[%d].netem.loss must be between 0 and 100", i))
+	}
+	if netem.Rate != "" && !netemRatePattern.MatchString(netem.Rate) {
+		errs = append(errs, fmt.Sprintf("stages[%d].netem.rate must be a tc rate such as 100mbit", i))
+	}
+	return errs
+}
+
+var chaosSignalPattern = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+func validateChaosAction(i, j int, action *ChaosAction, hosts map[string]Host, hostAliases map[string]struct{}) []string {
+	var errs []string
+	prefix := fmt.Sprintf("stages[%d].chaos[%d]", i, j)
+	if d, err := time.ParseDuration(action.After); err != nil || d < 0 {
+		errs = append(errs, prefix+".after must be a non-negative duration")
+	}
+	if action.Host != "" {
+		if _, ok := hostAliases[action.Host]; !ok {
+			errs = append(errs, fmt.Sprintf("%s.host references unknown host '%s'", prefix, action.Host))
+		}
+	}
+	if strings.TrimSpace(action.Target) == "" {
+		errs = append(errs, prefix+".target must be set")
+	}
+	if action.Signal != "" && action.Type != "kill" {
+		errs = append(errs, prefix+".signal is only valid for kill actions")
+	}
+	if action.Duration != "" && action.Type != "partition" {
+		errs = append(errs, prefix+".duration is only valid for partition actions")
+	}
+	switch action.Type {
+	case "kill":
+		action.Signal = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(action.Signal)), "SIG")
+		if action.Signal == "" {
+			action.Signal = "KILL"
+		}
+		if !chaosSignalPattern.MatchString(action.Signal) {
+			errs = append(errs, prefix+".signal must be a signal name or number")
+		}
+	case "restart_container":
+		// ok
+	case "partition":
+		if host, ok := hosts[action.Target]; action.Target != "" && (!ok || strings.TrimSpace(host.IP) == "") {
+			errs = append(errs, fmt.Sprintf("%s.target must be a host with an ip for partition actions", prefix))
+		}
+		if d, err := time.ParseDuration(action.Duration); action.Duration != "" && (err != nil || d <= 0) {
+			errs = append(errs, prefix+".duration must be a positive duration")
+		}
+	default:
+		errs = append(errs, prefix+".type must be one of [kill, restart_container, partition]")
+	}
+	return errs
+}
+
 func GetDefaultConfigFile() string {
 	return string(defaultConfigFile)
 }
 
 //go:embed files/default_benchmark.yaml
 var defaultConfigFile []byte
+
+func validateKubernetesHost(alias string, host Host) []string {
+	switch host.Type {
+	case "":
+		if host.Kubernetes != nil {
+			return []string{fmt.Sprintf("hosts.%s.kubernetes requires type kubernetes", alias)}
+		}
+		return nil
+	case "kubernetes":
+	default:
+		return []string{fmt.Sprintf("hosts.%s.type must be one of [kubernetes]", alias)}
+	}
+	var errs []string
+	k8s := host.Kubernetes
+	if k8s == nil || (k8s.Pod == "") == (k8s.Selector == "") {
+		errs = append(errs, fmt.Sprintf("hosts.%s.kubernetes must set exactly one of pod or selector", alias))
+	}
+	if host.IP != "" || host.Port != 0 || host.Username != "" || host.Password != "" || host.KeyFile != "" || host.KeyPassword != "" || host.SSHAlias != "" || host.ProxyJump != "" || host.SSH != nil {
+		errs = append(errs, fmt.Sprintf("hosts.%s: kubernetes hosts cannot set SSH settings", alias))
+	}
+	return errs
+}
+
+func validateSSHOptions(alias string, options *SSHOptions) []string {
+	var errs []string
+	if options.ConnectTimeout != "" {
+		if timeout, err := time.ParseDuration(options.ConnectTimeout); err != nil || timeout <= 0 {
+			errs = append(errs, fmt.Sprintf("hosts.%s.ssh.connect_timeout must be a positive duration", alias))
+		}
+	}
+	if options.MaxSessions < 0 {
+		errs = append(errs, fmt.Sprintf("hosts.%s.ssh.max_sessions must not be negative", alias))
+	}
+	if options.KeepaliveInterval != "" {
+		if interval, err := time.ParseDuration(options.KeepaliveInterval); err != nil || interval < 0 {
+			errs = append(errs, fmt.Sprintf("hosts.%s.ssh.keepalive_interval must be a duration, or 0s to disable keepalives", alias))
+		}
+	}
+	if options.KeepaliveCountMax < 0 {
+		errs = append(errs, fmt.Sprintf("hosts.%s.ssh.keepalive_count_max must not be negative", alias))
+	}
+	if options.ReconnectAttempts < -1 {
+		errs = append(errs, fmt.Sprintf("hosts.%s.ssh.reconnect_attempts must be -1 (disabled) or more", alias))
+	}
+	supported, insecure := ssh.SupportedAlgorithms(), ssh.InsecureAlgorithms()
+	lists := []struct {
+		field      string
+		values     []string
+		algorithms []string
+	}{
+		{"ciphers", options.Ciphers, append(supported.Ciphers, insecure.Ciphers...)},
+		{"kex", options.KeyExchanges, append(supported.KeyExchanges, insecure.KeyExchanges...)},
+		{"macs", options.MACs, append(supported.MACs, insecure.MACs...)},
+		{"host_key_algorithms", options.HostKeyAlgorithms, append(supported.HostKeys, insecure.HostKeys...)},
+	}
+	for _, list := range lists {
+		for _, value := range list.values {
+			if !slices.Contains(list.algorithms, value) {
+				errs = append(errs, fmt.Sprintf("hosts.%s.ssh.%s: unsupported algorithm %q (supported: %s)", alias, list.field, value, strings.Join(list.algorithms, ", ")))
+			}
+		}
+	}
+	return errs
+}
@@ -5,8 +5,12 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/goccy/go-yaml"
 )
 
 // TestLoadConfig_Success validates a happy-path config.
@@ -102,6 +106,60 @@ stages:
 	}
 }
 
+func TestHostGroupsExpand(t *testing.T) {
+	yaml := `
+benchmark:
+  name: groups
+  output_dir: ./results
+  cooldown:
+    period: 30s
+    hosts: [workers]
+hosts:
+  gen1: {ip: 10.0.0.1}
+  gen2: {ip: 10.0.0.2}
+  db: {ip: 10.0.0.3}
+host_groups:
+  workers: [gen1, gen2]
+  all: [db, gen1, gen2]
+stages:
+  - name: load
+    hosts: [workers]
+    command: ./load
+  - name: collect
+    hosts: [workers, all]
+    command: ./collect
+  - name: db
+    hosts: [db]
+    command: ./db
+cleanup:
+  - name: stop
+    hosts: [workers]
+    command: ./stop
+`
+	cfg, err := ParseYAML([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"stages[0]", cfg.Stages[0].Hosts, []string{"gen1", "gen2"}},
+		{"stages[1]", cfg.Stages[1].Hosts, []string{"gen1", "gen2", "db"}},
+		{"stages[2]", cfg.Stages[2].Hosts, []string{"db"}},
+		{"cleanup[0]", cfg.Cleanup[0].Hosts, []string{"gen1", "gen2"}},
+		{"cooldown", cfg.Benchmark.Cooldown.Hosts, []string{"gen1", "gen2"}},
+	} {
+		if !slices.Equal(tt.got, tt.want) {
+			t.Fatalf("%s hosts = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expanded config no longer validates: %v", err)
+	}
+}
+
 func TestStageNameUnique(t *testing.T) {
 	yaml := `
 benchmark:
@@ -124,6 +182,126 @@ stages:
 	}
 }
 
+func TestEmptyDependsOnSurvivesRenderAndClone(t *testing.T) {
+	cfg, err := ParseYAML([]byte(`
+benchmark:
+  name: deps
+  output_dir: ./results
+stages:
+  - name: setup
+    command: "true"
+  - name: client
+    command: "true"
+    depends_on: []
+  - name: load
+    command: "true"
+`))
+	if err != nil {
+		t.Fatalf("ParseYAML: %v", err)
+	}
+	rendered, err := yaml.Marshal(cfg.Clone())
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	reparsed, err := ParseYAML(rendered)
+	if err != nil {
+		t.Fatalf("ParseYAML(rendered): %v\n%s", err, rendered)
+	}
+	want := [][]string{nil, {}, {"client"}}
+	if got := StageDependencies(reparsed.Stages); !reflect.DeepEqual(got, want) {
+		t.Fatalf("StageDependencies = %q, want %q\n%s", got, want, rendered)
+	}
+}
+
+func TestProfilesSectionIsPartOfConfig(t *testing.T) {
+	cfg, err := ParseYAML([]byte(`
+benchmark:
+  name: profiles
+  output_dir: ./results
+stages:
+  - name: load
+    command: "true"
+profiles:
+  ci:
+    benchmark:
+      trials: 1
+`))
+	if err != nil {
+		t.Fatalf("ParseYAML: %v", err)
+	}
+	clone := cfg.Clone()
+	clone.Profiles["ci"].(map[string]any)["benchmark"].(map[string]any)["trials"] = 5
+	if got := cfg.Profiles["ci"].(map[string]any)["benchmark"].(map[string]any)["trials"]; got != uint64(1) {
+		t.Fatalf("trials of the original profile = %v, want it unchanged by the clone", got)
+	}
+}
+
+func TestWindowsOutputsSkipTheStaleCheck(t *testing.T) {
+	cfg, err := ParseYAML([]byte(`
+benchmark:
+  name: win
+  output_dir: ./results
+hosts:
+  win:
+    ip: 10.0.0.9
+    os: windows
+stages:
+  - name: load
+    host: win
+    command: .\load.exe
+    outputs:
+      - name: results
+        remote_path: C:/bench/results.csv
+  - name: local
+    command: ./load
+    outputs:
+      - name: local-results
+        remote_path: /tmp/results.csv
+`))
+	if err != nil {
+		t.Fatalf("ParseYAML: %v", err)
+	}
+	if got := cfg.Stages[0].Outputs[0].OnStale; got != "ignore" {
+		t.Fatalf("on_stale of the windows output = %q, want ignore", got)
+	}
+	if got := cfg.Stages[1].Outputs[0].OnStale; got != "" {
+		t.Fatalf("on_stale of the local output = %q, want it unset", got)
+	}
+}
+
+func TestSessionTimeoutDefaults(t *testing.T) {
+	tests := []struct {
+		name             string
+		session          string
+		wantTimeout      string
+		wantStartTimeout string
+	}{
+		{name: "unset", session: "{steps: [{send: PING}]}", wantTimeout: "30s", wantStartTimeout: "30s"},
+		{name: "long timeout", session: "{timeout: 1m, steps: [{send: PING}]}", wantTimeout: "1m", wantStartTimeout: "1m0s"},
+		{name: "short timeout", session: "{timeout: 2s, steps: [{send: PING}]}", wantTimeout: "2s", wantStartTimeout: "30s"},
+		{name: "both set", session: "{timeout: 2s, start_timeout: 5s, steps: [{send: PING}]}", wantTimeout: "2s", wantStartTimeout: "5s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseYAML([]byte(`
+benchmark:
+  name: session
+  output_dir: ./results
+stages:
+  - name: console
+    command: redis-cli
+    session: ` + tt.session + `
+`))
+			if err != nil {
+				t.Fatalf("ParseYAML: %v", err)
+			}
+			if session := cfg.Stages[0].Session; session.Timeout != tt.wantTimeout || session.StartTimeout != tt.wantStartTimeout {
+				t.Fatalf("timeout = %q, start_timeout = %q, want %q and %q", session.Timeout, session.StartTimeout, tt.wantTimeout, tt.wantStartTimeout)
+			}
+		})
+	}
+}
+
 func TestCasesAndExecuteOnlyForValidation(t *testing.T) {
 	yaml := `
 benchmark:
@@ -322,7 +500,7 @@ stages:
 			contain: "hosts contains duplicate host",
 		},
 		{
-			name: "disallowed output local_path",
+			name: "output local_path outside the run directory",
 			yaml: `
 benchmark:
   name: local-path
@@ -335,9 +513,9 @@ stages:
     outputs:
       - name: metrics
         remote_path: /tmp/metrics.csv
-        local_path: ./metrics.csv
+        local_path: ../metrics.csv
 `,
-			contain: "local_path is not allowed",
+			contain: "stages[0].outputs[0].local_path must be a relative path inside the run directory",
 		},
 		{
 			name: "sync without remote",
@@ -407,6 +585,1229 @@ cleanup:
 `,
 			contain: "cleanup[0]: exactly one of command or script must be set",
 		},
+		{
+			name: "cache with outputs",
+			yaml: `
+benchmark:
+  name: bad-cache
+  output_dir: ./results
+stages:
+  - name: prepare
+    command: ./gen.sh
+    cache:
+      inputs: [gen.sh]
+    outputs:
+      - name: data
+        remote_path: /tmp/data.csv
+`,
+			contain: "stages[0].cache cannot be used with outputs",
+		},
+		{
+			name: "build stage without artifact",
+			yaml: `
+benchmark:
+  name: bad-build
+  output_dir: ./results
+stages:
+  - name: build
+    type: build
+    command: go build ./...
+`,
+			contain: "stages[0].artifact must be set for build stages",
+		},
+		{
+			name: "build file artifact without remote path",
+			yaml: `
+benchmark:
+  name: bad-build
+  output_dir: ./results
+stages:
+  - name: build
+    type: build
+    command: go build -o bin/server ./cmd/server
+    artifact:
+      path: bin/server
+`,
+			contain: "stages[0].artifact.remote_path must be set for file artifacts",
+		},
+		{
+			name: "startup on image artifact",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  local: {}
+stages:
+  - name: build
+    type: build
+    hosts: [local]
+    command: docker build -t x .
+    artifact:
+      image: x
+      startup:
+        runs: 3
+`,
+			contain: "stages[0].artifact.startup is only supported for file artifacts",
+		},
+		{
+			name: "netem jitter without delay",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+    netem:
+      interface: eth0
+      jitter: 5ms
+`,
+			contain: "stages[0].netem.jitter requires delay",
+		},
+		{
+			name: "netem invalid rate",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+    netem:
+      interface: eth0
+      rate: fast
+`,
+			contain: "stages[0].netem.rate must be a tc rate such as 100mbit",
+		},
+		{
+			name: "chaos partition target without ip",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+    chaos:
+      - type: partition
+        after: 10s
+        target: local
+`,
+			contain: "stages[0].chaos[0].target must be a host with an ip for partition actions",
+		},
+		{
+			name: "chaos signal on restart",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+    chaos:
+      - type: restart_container
+        after: 10s
+        target: db
+        signal: TERM
+`,
+			contain: "stages[0].chaos[0].signal is only valid for kill actions",
+		},
+		{
+			name: "seed without random order",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  seed: 42
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+`,
+			contain: "benchmark.seed requires benchmark.order random",
+		},
+		{
+			name: "cooldown without period or guards",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  cooldown:
+    hosts: [local]
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+`,
+			contain: "benchmark.cooldown must set at least one of period, max_load, or max_temp_c",
+		},
+		{
+			name: "libvirt reset without snapshot",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  reset:
+    - name: revert
+      type: libvirt_snapshot
+      target: bench-vm
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+`,
+			contain: "benchmark.reset[0].snapshot must be set for libvirt_snapshot hooks",
+		},
+		{
+			name: "invalid expectation",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+    expect:
+      - error_rate is low
+`,
+			contain: "stages[0].expect[0]: expectation \"error_rate is low\" must have the form",
+		},
+		{
+			name: "invalid watchdog interval",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  watchdog:
+    interval: soon
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+`,
+			contain: "benchmark.watchdog.interval must be a positive duration",
+		},
+		{
+			name: "relative link url",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  links:
+    - name: design
+      url: docs/design.md
+hosts:
+  local: {}
+stages:
+  - name: bench
+    command: ./bench
+`,
+			contain: "benchmark.links[0].url must be an absolute URL",
+		},
+		{
+			name: "unknown output format",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: scrape
+    command: curl -s localhost:9090/metrics > /tmp/m.prom
+    outputs:
+      - name: metrics
+        remote_path: /tmp/m.prom
+        format: json
+`,
+			contain: "stages[0].outputs[0].format must be one of",
+		},
+		{
+			name: "metrics_from_output without capture group",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: load
+    command: wrk http://localhost:8080
+    metrics_from_output:
+      - name: rps
+        pattern: 'Requests/sec:\s+\d+'
+`,
+			contain: "stages[0].metrics_from_output[0].pattern must contain a capture group",
+		},
+		{
+			name: "metrics_from_output duplicate name",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: load
+    command: wrk http://localhost:8080
+    background: true
+    metrics_from_output:
+      - name: rps
+        pattern: 'Requests/sec:\s+(\d+)'
+      - name: rps
+        pattern: 'Requests/sec:\s+(\d+)'
+`,
+			contain: "stages[0].metrics_from_output[1].name duplicates metrics_from_output[0] (rps)",
+		},
+		{
+			name: "invalid failure policy",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  failure_policy:
+    on_failure: ignore
+stages:
+  - name: run
+    command: echo hi
+`,
+			contain: "benchmark.failure_policy.on_failure must be one of [stop, continue]",
+		},
+		{
+			name: "console throttle without limit",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: load
+    command: ./loadgen
+    console:
+      max_lines_per_second: 0
+`,
+			contain: "stages[0].console.max_lines_per_second must be > 0",
+		},
+		{
+			name: "matrix parameter without values",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+matrix:
+  - name: RATE
+    values: [100, 500]
+  - name: SIZE
+    values: []
+stages:
+  - name: run
+    command: echo $RATE
+`,
+			contain: "matrix[1].values must not be empty",
+		},
+		{
+			name: "matrix parameter with invalid name",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+matrix:
+  - name: load-level
+    values: [low]
+stages:
+  - name: run
+    command: echo hi
+`,
+			contain: "matrix[0].name must be a valid environment variable name",
+		},
+		{
+			name: "depends_on unknown stage",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: setup
+    command: echo setup
+  - name: run
+    command: echo run
+    depends_on: [setup-db]
+`,
+			contain: "stages[1].depends_on[0] references unknown stage 'setup-db'",
+		},
+		{
+			name: "depends_on cycle",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: a
+    command: echo a
+    depends_on: [b]
+  - name: b
+    command: echo b
+    depends_on: [a]
+`,
+			contain: "depends_on forms a cycle through stage",
+		},
+		{
+			name: "empty secret reference",
+			yaml: `
+benchmark:
+  name: secrets
+  output_dir: ./results
+hosts:
+  vm1:
+    ip: 10.0.0.1
+    username: bench
+    key_file: ~/.ssh/id
+    password: env://
+stages:
+  - name: run
+    host: vm1
+    command: echo ok
+`,
+			contain: "hosts.vm1.password: env:// reference must name a secret",
+		},
+		{
+			name: "invalid secret env name",
+			yaml: `
+benchmark:
+  name: secrets
+  output_dir: ./results
+hosts:
+  vm1:
+    ip: 10.0.0.1
+    username: bench
+    key_file: exec://vault read -field=key secret/bench
+    key_password: env://bad-name
+stages:
+  - name: run
+    host: vm1
+    command: echo ok
+`,
+			contain: "hosts.vm1.key_password: bad-name is not a valid environment variable name",
+		},
+		{
+			name: "invalid output compression",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: run
+    command: ./bench
+    outputs:
+      - name: latency
+        remote_path: /tmp/latency.csv
+        compress: bzip2
+`,
+			contain: "stages[0].outputs[0].compress must be one of [gzip, zstd]",
+		},
+		{
+			name: "invalid when condition",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: profile
+    command: perf record ./bench
+    when: "${PROFILE} =="
+`,
+			contain: "stages[0].when \"${PROFILE} ==\": unexpected end of expression",
+		},
+		{
+			name: "invalid output on_stale",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: run
+    command: ./bench
+    outputs:
+      - name: latency
+        remote_path: /tmp/latency.csv
+        on_stale: abort
+`,
+			contain: "stages[0].outputs[0].on_stale must be one of [warn, fail, ignore]",
+		},
+		{
+			name: "host group with unknown member",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  gen1: {ip: 10.0.0.1}
+host_groups:
+  workers: [gen1, gen3]
+stages:
+  - name: load
+    hosts: [workers]
+    command: ./load
+`,
+			contain: "host_groups.workers references unknown host 'gen3'",
+		},
+		{
+			name: "host group shadowing a host",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  gen1: {ip: 10.0.0.1}
+host_groups:
+  gen1: [gen1]
+stages:
+  - name: load
+    command: ./load
+`,
+			contain: "host_groups.gen1: name is already a host alias",
+		},
+		{
+			name: "host group in single host",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  gen1: {ip: 10.0.0.1}
+host_groups:
+  workers: [gen1]
+stages:
+  - name: load
+    host: workers
+    command: ./load
+`,
+			contain: "stages[0].host references host group 'workers'; use hosts: [workers]",
+		},
+		{
+			name: "per_platform image artifact",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: image
+    type: build
+    command: docker build -t agent .
+    artifact:
+      image: agent
+      per_platform: true
+`,
+			contain: "stages[0].artifact.per_platform is only supported for file artifacts",
+		},
+		{
+			name: "webhook plaintext secret",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  webhooks:
+    - url: https://hooks.example.com/bench
+      secret: hunter2
+hosts: {}
+stages:
+  - name: s
+    command: "true"
+`,
+			contain: "benchmark.webhooks[0].secret must be a secret reference",
+		},
+		{
+			name: "webhook url scheme",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  webhooks:
+    - url: hooks.example.com/bench
+hosts: {}
+stages:
+  - name: s
+    command: "true"
+`,
+			contain: "benchmark.webhooks[0].url must be an http or https URL",
+		},
+		{
+			name: "terraform needs dir or file",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts_from_terraform:
+  hosts:
+    server: server_ip
+hosts: {}
+stages:
+  - name: s
+    command: "true"
+`,
+			contain: "hosts_from_terraform must set exactly one of dir or file",
+		},
+		{
+			name: "terraform output shape",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts_from_terraform:
+  file: testdata/terraform-outputs.json
+  hosts:
+    server: server_count
+hosts: {}
+stages:
+  - name: s
+    command: "true"
+`,
+			contain: "value must be a string, a list of strings, or a map of strings",
+		},
+		{
+			name: "unsupported ssh cipher",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  old:
+    ip: 10.0.0.1
+    ssh:
+      ciphers: [rot13]
+stages:
+  - name: run
+    host: old
+    command: echo hi
+`,
+			contain: "hosts.old.ssh.ciphers: unsupported algorithm \"rot13\"",
+		},
+		{
+			name: "invalid ssh connect timeout",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  old:
+    ip: 10.0.0.1
+    ssh:
+      connect_timeout: soon
+stages:
+  - name: run
+    host: old
+    command: echo hi
+`,
+			contain: "hosts.old.ssh.connect_timeout must be a positive duration",
+		},
+		{
+			name: "become user without become",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: run
+    command: echo hi
+    become_user: postgres
+`,
+			contain: "stages[0].become_user requires become",
+		},
+		{
+			name: "become on build stage",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: build
+    type: build
+    command: go build -o bin/server ./cmd/server
+    become: true
+    artifact:
+      path: bin/server
+      remote_path: /opt/server
+`,
+			contain: "stages[0].become cannot be used with build stages",
+		},
+		{
+			name: "negative ssh max sessions",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  old:
+    ip: 10.0.0.1
+    ssh:
+      max_sessions: -1
+stages:
+  - name: run
+    host: old
+    command: echo hi
+`,
+			contain: "hosts.old.ssh.max_sessions must not be negative",
+		},
+		{
+			name: "invalid capability tool",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  capabilities:
+    tools: ["perf; rm"]
+stages:
+  - name: run
+    command: echo hi
+`,
+			contain: "benchmark.capabilities.tools[0] \"perf; rm\" must be a command name",
+		},
+		{
+			name: "invalid output metric aggregate",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: run
+    command: echo hi
+    metrics_from_output:
+      - name: rps
+        pattern: 'rps: (\d+)'
+        aggregate: median
+`,
+			contain: "stages[0].metrics_from_output[0].aggregate must be mean, sum, min, or max",
+		},
+		{
+			name: "negative keepalive interval",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+hosts:
+  h:
+    ip: 10.0.0.1
+    username: u
+    ssh:
+      keepalive_interval: -5s
+stages:
+  - name: s
+    host: h
+    command: "true"
+`,
+			contain: "keepalive_interval must be a duration",
+		},
+		{
+			name: "duration on background stage",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: load
+    command: ./loadgen
+    background: true
+    duration: 10m
+`,
+			contain: "stages[0].duration cannot be used with background stages",
+		},
+		{
+			name: "invalid stage duration",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: load
+    command: ./loadgen
+    duration: forever
+`,
+			contain: "stages[0].duration must be a positive duration",
+		},
+		{
+			name: "decompress without compress",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: load
+    command: ./loadgen
+    outputs:
+      - name: latency
+        remote_path: /tmp/latency.csv
+        decompress: true
+`,
+			contain: "outputs[0].decompress requires compress",
+		},
+		{
+			name: "pipe_from later stage",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: consume
+    command: wc -l
+    pipe_from: generate
+  - name: generate
+    command: seq 1 5
+`,
+			contain: "stages[0].pipe_from must reference an earlier stage",
+		},
+		{
+			name: "pipe_from producer with metrics_from_output",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: generate
+    command: seq 1 5
+    metrics_from_output:
+      - name: n
+        pattern: '(\d+)'
+  - name: consume
+    command: wc -l
+    pipe_from: generate
+`,
+			contain: "stages[1].pipe_from cannot reference stage 'generate' with metrics_from_output",
+		},
+		{
+			name: "stage file without remote_path",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: load
+    command: ./loadgen
+    files:
+      - local_path: ./workload.conf
+`,
+			contain: "stages[0].files[0].remote_path must be set",
+		},
+		{
+			name: "runtime docker without image",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: load
+    command: ./loadgen
+    runtime: docker
+`,
+			contain: "stages[0].container.image must be set for runtime docker",
+		},
+		{
+			name: "runtime docker on background stage",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: load
+    command: ./loadgen
+    background: true
+    runtime: docker
+    container:
+      image: alpine
+`,
+			contain: "stages[0].runtime docker cannot be used with background stages",
+		},
+		{
+			name: "kubernetes host without pod",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+hosts:
+  server:
+    type: kubernetes
+    kubernetes:
+      namespace: bench
+stages:
+  - name: load
+    host: server
+    command: ./loadgen
+`,
+			contain: "hosts.server.kubernetes must set exactly one of pod or selector",
+		},
+		{
+			name: "kubernetes host with ssh settings",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+hosts:
+  server:
+    type: kubernetes
+    ip: 10.0.0.1
+    kubernetes:
+      pod: server-0
+stages:
+  - name: load
+    host: server
+    command: ./loadgen
+`,
+			contain: "hosts.server: kubernetes hosts cannot set SSH settings",
+		},
+		{
+			name: "capture_versions with a shell word",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+  capture_versions: ["nginx; reboot"]
+stages:
+  - name: load
+    command: ./loadgen
+`,
+			contain: "benchmark.capture_versions[0] \"nginx; reboot\" must be a package or command name",
+		},
+		{
+			name: "background stage on a windows host",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+hosts:
+  win:
+    ip: 10.0.0.9
+    os: windows
+stages:
+  - name: server
+    host: win
+    command: Start-Process server.exe
+    background: true
+`,
+			contain: "stages[0]: background not supported on windows host win",
+		},
+		{
+			name: "windows host with a POSIX shell",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+hosts:
+  win:
+    ip: 10.0.0.9
+    os: windows
+    shell: bash
+stages:
+  - name: load
+    host: win
+    command: ./loadgen.exe
+`,
+			contain: "hosts.win.shell must be powershell or pwsh on a windows host",
+		},
+		{
+			name: "empty failure log path",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: load
+    command: ./loadgen
+    failure_logs:
+      - ""
+`,
+			contain: "stages[0].failure_logs[0] must be set",
+		},
+		{
+			name: "provisioned host with an ip",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+hosts:
+  server:
+    ip: 10.0.0.1
+    provision:
+      provider: hetzner
+      type: cx22
+      region: fsn1
+      image: ubuntu-24.04
+stages:
+  - name: load
+    host: server
+    command: ./loadgen
+`,
+			contain: "hosts.server: provisioned hosts get their ip from the provider",
+		},
+		{
+			name: "provision without a type",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+hosts:
+  server:
+    provision:
+      provider: hetzner
+      region: fsn1
+      image: ubuntu-24.04
+stages:
+  - name: load
+    host: server
+    command: ./loadgen
+`,
+			contain: "hosts.server.provision.type must be set",
+		},
+		{
+			name: "expectation with an unknown unit",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+stages:
+  - name: load
+    command: ./loadgen
+    expect:
+      - latency_p99 < 250 parsecs
+`,
+			contain: "expectation \"latency_p99 < 250 parsecs\": \"250 parsecs\" has an unknown unit",
+		},
+		{
+			name: "compare rule without bounds",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  compare:
+    - metric: error_rate
+      strategy: absolute
+stages:
+  - name: run
+    command: "true"
+`,
+			contain: "strategy absolute requires min or max",
+		},
+		{
+			name: "compare rule with unknown strategy",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  compare:
+    - metric: latency_*_ms
+      strategy: faster
+stages:
+  - name: run
+    command: "true"
+`,
+			contain: "benchmark.compare[0].strategy must be one of",
+		},
+		{
+			name: "trials with skip analysis",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  trials: 3
+  skip_analysis: true
+stages:
+  - name: run
+    command: "true"
+`,
+			contain: "benchmark.trials cannot be combined with skip_analysis",
+		},
+		{
+			name: "warmup stage with expectations",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+stages:
+  - name: warm
+    command: ./load --duration 30s
+    warmup: true
+    expect:
+      - "rps > 100"
+`,
+			contain: "stages[0].expect cannot be used with warmup stages",
+		},
+		{
+			name: "session without steps",
+			yaml: `
+benchmark:
+  name: session
+  output_dir: ./results
+stages:
+  - name: console
+    command: redis-cli
+    session:
+      prompt: "> "
+`,
+			contain: "stages[0].session.steps must not be empty",
+		},
+		{
+			name: "session with background",
+			yaml: `
+benchmark:
+  name: session
+  output_dir: ./results
+stages:
+  - name: console
+    command: redis-cli
+    background: true
+    session:
+      steps:
+        - send: PING
+          expect: PONG
+`,
+			contain: "stages[0].session cannot be used with background",
+		},
+		{
+			name: "parallel group not consecutive",
+			yaml: `
+benchmark:
+  name: parallel
+  output_dir: ./results
+stages:
+  - name: load-a
+    parallel: load
+    command: ./loadgen
+  - name: setup
+    command: ./setup
+  - name: load-b
+    parallel: load
+    command: ./loadgen
+`,
+			contain: "stages[2].parallel group 'load' must directly follow the other stages of the group, the last being stages[0]",
+		},
+		{
+			name: "parallel group with depends_on",
+			yaml: `
+benchmark:
+  name: parallel
+  output_dir: ./results
+stages:
+  - name: setup
+    command: ./setup
+  - name: load-a
+    parallel: load
+    depends_on: [setup]
+    command: ./loadgen
+  - name: load-b
+    parallel: load
+    command: ./loadgen
+`,
+			contain: "stages[1].parallel cannot be used with depends_on",
+		},
+		{
+			name: "session start timeout",
+			yaml: `
+benchmark:
+  name: t
+  output_dir: ./results
+stages:
+  - name: console
+    command: redis-cli
+    session:
+      start_timeout: soon
+      steps:
+        - send: PING
+`,
+			contain: "stages[0].session.start_timeout must be a positive duration",
+		},
+		{
+			name: "depends_on cycle through implicit order",
+			yaml: `
+benchmark:
+  name: t
+  output_dir: ./results
+stages:
+  - name: a
+    command: "true"
+    depends_on: [b]
+  - name: b
+    command: "true"
+`,
+			contain: "depends_on forms a cycle through stage",
+		},
+		{
+			name: "artifact startup on a windows host",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+hosts:
+  win:
+    ip: 10.0.0.9
+    os: windows
+stages:
+  - name: build
+    type: build
+    host: win
+    command: go build -o bin/server.exe .
+    artifact:
+      path: bin/server.exe
+      remote_path: C:/bench/server.exe
+      startup:
+        args: --version
+`,
+			contain: "stages[0]: artifact.startup not supported on windows host win",
+		},
+		{
+			name: "capability tool named like a detected capability",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  capabilities:
+    tools: [perf, os]
+stages:
+  - name: run
+    command: echo hi
+`,
+			contain: "benchmark.capabilities.tools[1] \"os\" would replace the detected BENCHCTL_CAP_OS",
+		},
+		{
+			name: "capability tools with the same variable",
+			yaml: `
+benchmark:
+  name: test
+  output_dir: ./results
+  capabilities:
+    tools: [numa-ctl, numa.ctl]
+stages:
+  - name: run
+    command: echo hi
+`,
+			contain: "benchmark.capabilities.tools[1] \"numa.ctl\" and tools[0] \"numa-ctl\" are both BENCHCTL_CAP_NUMA_CTL",
+		},
+		{
+			name: "on_stale on a windows host",
+			yaml: `
+benchmark:
+  name: b
+  output_dir: ./r
+hosts:
+  win:
+    ip: 10.0.0.9
+    os: windows
+stages:
+  - name: load
+    host: win
+    command: .\load.exe
+    outputs:
+      - name: results
+        remote_path: C:/bench/results.csv
+        on_stale: fail
+`,
+			contain: "stages[0].outputs[0].on_stale is not supported on windows host win",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ConfigFile is a benchmark config found by ListConfigs.
+type ConfigFile struct {
+	// Path is the slash-separated path of the file below the listed directory.
+	Path      string
+	Name      string
+	OutputDir string
+}
+
+// skippedDirs are not searched for configs besides hidden directories.
+var skippedDirs = []string{"node_modules", "vendor"}
+
+// FindConfig returns the nearest of dir and its parents that contains a file
+// named name, the way git finds its repository, or "" when none does.
+func FindConfig(dir, name string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err == nil && !info.IsDir() {
+			return dir, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// ListConfigs returns the benchmark configs below root in path order: the YAML
+// files with a benchmark section naming the benchmark. Hidden directories,
+// node_modules, and vendor are skipped. The files are not validated, so ${name}
+// references in the name and output directory are left as written.
+func ListConfigs(root string) ([]ConfigFile, error) {
+	var configs []ConfigFile
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && (strings.HasPrefix(entry.Name(), ".") || slices.Contains(skippedDirs, entry.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var file struct {
+			Benchmark *struct {
+				Name      string `yaml:"name"`
+				OutputDir string `yaml:"output_dir"`
+			} `yaml:"benchmark"`
+		}
+		if yaml.Unmarshal(data, &file) != nil || file.Benchmark == nil || strings.TrimSpace(file.Benchmark.Name) == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		configs = append(configs, ConfigFile{Path: filepath.ToSlash(rel), Name: file.Benchmark.Name, OutputDir: file.Benchmark.OutputDir})
+		return nil
+	})
+	return configs, err
+}
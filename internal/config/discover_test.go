@@ -0,0 +1,60 @@
+//go:build unit
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindConfigWalksUpParents(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "benchmark.yaml"), "benchmark:\n  name: api\n")
+	nested := filepath.Join(root, "services", "api", "src")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "services", "benchmark.yaml", "not-a-config"), "")
+
+	dir, err := FindConfig(nested, "benchmark.yaml")
+	if err != nil || dir != root {
+		t.Fatalf("FindConfig() = %q, %v, want %q", dir, err, root)
+	}
+	if dir, err := FindConfig(nested, "missing.yaml"); err != nil || dir != "" {
+		t.Fatalf("FindConfig(missing) = %q, %v", dir, err)
+	}
+}
+
+func TestListConfigsFindsBenchmarks(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "benchmark.yaml"), "benchmark:\n  name: root\n  output_dir: ./results\n")
+	writeFile(t, filepath.Join(root, "services", "api", "bench.yml"), "benchmark:\n  name: api\n  output_dir: ${out}\n")
+	writeFile(t, filepath.Join(root, "deploy", "values.yaml"), "replicas: 3\n")
+	writeFile(t, filepath.Join(root, "broken.yaml"), "benchmark: [\n")
+	writeFile(t, filepath.Join(root, ".github", "bench.yaml"), "benchmark:\n  name: hidden\n")
+	writeFile(t, filepath.Join(root, "node_modules", "pkg", "benchmark.yaml"), "benchmark:\n  name: dependency\n")
+
+	configs, err := ListConfigs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ConfigFile{
+		{Path: "benchmark.yaml", Name: "root", OutputDir: "./results"},
+		{Path: "services/api/bench.yml", Name: "api", OutputDir: "${out}"},
+	}
+	if !reflect.DeepEqual(configs, want) {
+		t.Fatalf("ListConfigs() = %+v, want %+v", configs, want)
+	}
+}
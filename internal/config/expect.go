@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// The metric may carry a label set, as recorded for Prometheus outputs, and the
+// threshold a unit, as in "10k rps".
+var expectationPattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_.:-]*(?:\{[^}]*\})?)\s*(<=|>=|==|!=|<|>)\s*(\S+(?:\s+\S+)?)\s*$`)
+
+// Expectation is a parsed stages[].expect entry such as "error_rate < 0.01" or
+// "latency_p99_ms < 250ms".
+type Expectation struct {
+	Metric   string
+	Operator string
+	// Value is the threshold, in the base unit of Dimension when it has a unit:
+	// seconds, bytes, or events per second.
+	Value     float64
+	Dimension string
+	// Threshold is the threshold as written.
+	Threshold string
+}
+
+// ParseExpectation parses "<metric> <op> <threshold>" with op one of <, <=, >, >=,
+// ==, != and the threshold a number, optionally with a unit (see ParseQuantity).
+// A threshold whose unit contradicts the unit suffix of the metric name, as in
+// "latency_ms < 1GB", is rejected.
+func ParseExpectation(expr string) (Expectation, error) {
+	match := expectationPattern.FindStringSubmatch(expr)
+	if match == nil {
+		return Expectation{}, fmt.Errorf("expectation %q must have the form '<metric> <op> <number>'", expr)
+	}
+	threshold, err := ParseQuantity(match[3])
+	if err != nil {
+		return Expectation{}, fmt.Errorf("expectation %q: %w", expr, err)
+	}
+	if named, symbol, ok := metricNameUnit(match[1]); ok && threshold.Dimension != "" && named.dimension != threshold.Dimension {
+		return Expectation{}, fmt.Errorf("expectation %q: metric %s is recorded in %s, which cannot be compared with %s", expr, match[1], symbol, match[3])
+	}
+	return Expectation{Metric: match[1], Operator: match[2], Value: threshold.Value, Dimension: threshold.Dimension, Threshold: match[3]}, nil
+}
+
+// MetricValue returns the recorded value of the metric in the unit of the
+// threshold. The value may carry a unit itself, such as "12.5ms", or else is in
+// the unit of the suffix of the metric name, such as _ms in latency_p99_ms; a rate
+// without either is taken to be per second. Thresholds without a unit compare the
+// plain number.
+func (e Expectation) MetricValue(raw string) (float64, error) {
+	recorded, err := ParseQuantity(raw)
+	if plain, parseErr := strconv.ParseFloat(raw, 64); parseErr == nil {
+		recorded, err = Quantity{Value: plain}, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("value %q is not numeric", raw)
+	}
+	if e.Dimension == "" {
+		if recorded.Dimension != "" {
+			return 0, fmt.Errorf("value %q has a unit, give the threshold one", raw)
+		}
+		return recorded.Value, nil
+	}
+	if recorded.Dimension == "" {
+		named, _, ok := metricNameUnit(e.Metric)
+		switch {
+		case ok:
+			recorded = Quantity{Value: recorded.Value * named.factor, Dimension: named.dimension}
+		case e.Dimension == "rate":
+			recorded.Dimension = "rate"
+		default:
+			return 0, fmt.Errorf("value %q has no unit to compare with %s; record it with one or name the metric with a unit suffix such as _ms", raw, e.Threshold)
+		}
+	}
+	if recorded.Dimension != e.Dimension {
+		return 0, fmt.Errorf("value %q cannot be compared with %s", raw, e.Threshold)
+	}
+	return recorded.Value, nil
+}
+
+// Holds reports whether value, in the unit of the threshold, satisfies the
+// expectation.
+func (e Expectation) Holds(value float64) bool {
+	switch e.Operator {
+	case "<":
+		return value < e.Value
+	case "<=":
+		return value <= e.Value
+	case ">":
+		return value > e.Value
+	case ">=":
+		return value >= e.Value
+	case "==":
+		return value == e.Value
+	case "!=":
+		return value != e.Value
+	}
+	return false
+}
+
+func (e Expectation) String() string {
+	threshold := e.Threshold
+	if threshold == "" {
+		threshold = strconv.FormatFloat(e.Value, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%s %s %s", e.Metric, e.Operator, threshold)
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// expandHostGroups replaces host group names in the host lists of stages, cleanup
+// steps, and the cooldown with the aliases of their members, in group order and
+// without repeating an alias. Lists that name no group are left as they are, so
+// their duplicate checks still apply. Expansion is idempotent, so a config can be
+// validated more than once.
+func expandHostGroups(cfg *Config) []string {
+	if len(cfg.HostGroups) == 0 {
+		return nil
+	}
+	var errs []string
+	for _, name := range slices.Sorted(maps.Keys(cfg.HostGroups)) {
+		if strings.TrimSpace(name) == "" {
+			errs = append(errs, "host_groups names must be non-empty")
+		}
+		if _, ok := cfg.Hosts[name]; ok || name == "local" {
+			errs = append(errs, fmt.Sprintf("host_groups.%s: name is already a host alias", name))
+		}
+		members := cfg.HostGroups[name]
+		if len(members) == 0 {
+			errs = append(errs, fmt.Sprintf("host_groups.%s must list at least one host", name))
+		}
+		for _, alias := range members {
+			if _, ok := cfg.Hosts[alias]; !ok && alias != "local" {
+				errs = append(errs, fmt.Sprintf("host_groups.%s references unknown host '%s'", name, alias))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for i := range cfg.Stages {
+		cfg.Stages[i].Hosts = cfg.expandHostList(cfg.Stages[i].Hosts)
+		if group, ok := cfg.HostGroups[strings.TrimSpace(cfg.Stages[i].Host)]; ok && len(group) > 0 {
+			errs = append(errs, fmt.Sprintf("stages[%d].host references host group '%s'; use hosts: [%s]", i, cfg.Stages[i].Host, cfg.Stages[i].Host))
+		}
+	}
+	for i := range cfg.Cleanup {
+		cfg.Cleanup[i].Hosts = cfg.expandHostList(cfg.Cleanup[i].Hosts)
+		if group, ok := cfg.HostGroups[strings.TrimSpace(cfg.Cleanup[i].Host)]; ok && len(group) > 0 {
+			errs = append(errs, fmt.Sprintf("cleanup[%d].host references host group '%s'; use hosts: [%s]", i, cfg.Cleanup[i].Host, cfg.Cleanup[i].Host))
+		}
+	}
+	if cooldown := cfg.Benchmark.Cooldown; cooldown != nil {
+		cooldown.Hosts = cfg.expandHostList(cooldown.Hosts)
+	}
+	return errs
+}
+
+func (cfg *Config) expandHostList(hosts []string) []string {
+	if !slices.ContainsFunc(hosts, func(alias string) bool { _, ok := cfg.HostGroups[alias]; return ok }) {
+		return hosts
+	}
+	expanded := make([]string, 0, len(hosts))
+	for _, alias := range hosts {
+		members, ok := cfg.HostGroups[alias]
+		if !ok {
+			members = []string{alias}
+		}
+		for _, member := range members {
+			if !slices.Contains(expanded, member) {
+				expanded = append(expanded, member)
+			}
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,395 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Inventory is the hosts and groups read from an Ansible inventory.
+type Inventory struct {
+	Hosts map[string]Host
+	// Groups lists the member aliases of every group with at least one host, in
+	// inventory order. The implicit all and ungrouped groups are left out.
+	Groups map[string][]string
+}
+
+// inventoryGroup is a group while an inventory is read.
+type inventoryGroup struct {
+	hosts    []string
+	children []string
+	vars     map[string]string
+}
+
+type inventoryReader struct {
+	groups    map[string]*inventoryGroup
+	hosts     []string
+	hostVars  map[string]map[string]string
+	hostOrder map[string]int
+}
+
+// LoadInventory reads an Ansible inventory. Files ending in .yml or .yaml are YAML
+// inventories; anything else is read as an INI inventory.
+//
+// Hosts take ansible_host, ansible_port, ansible_user, ansible_password, and
+// ansible_ssh_private_key_file from their own variables, then from the variables
+// of their groups, more specific groups first. Hosts with ansible_connection=local
+// run locally. Other variables are ignored.
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("inventory: %w", err)
+	}
+	r := &inventoryReader{
+		groups:    map[string]*inventoryGroup{},
+		hostVars:  map[string]map[string]string{},
+		hostOrder: map[string]int{},
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = r.readYAML(data)
+	default:
+		err = r.readINI(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("inventory %s: %w", path, err)
+	}
+	return r.inventory()
+}
+
+func (r *inventoryReader) group(name string) *inventoryGroup {
+	group, ok := r.groups[name]
+	if !ok {
+		group = &inventoryGroup{vars: map[string]string{}}
+		r.groups[name] = group
+	}
+	return group
+}
+
+func (r *inventoryReader) addHost(groupName, host string, vars map[string]string) error {
+	if strings.ContainsAny(host, "[]") {
+		return fmt.Errorf("host %s: host ranges are not supported", host)
+	}
+	if _, ok := r.hostOrder[host]; !ok {
+		r.hostOrder[host] = len(r.hosts)
+		r.hosts = append(r.hosts, host)
+		r.hostVars[host] = map[string]string{}
+	}
+	maps.Copy(r.hostVars[host], vars)
+	group := r.group(groupName)
+	if !slices.Contains(group.hosts, host) {
+		group.hosts = append(group.hosts, host)
+	}
+	return nil
+}
+
+// readINI reads [group], [group:vars], and [group:children] sections. Host lines
+// before the first section belong to the ungrouped group.
+func (r *inventoryReader) readINI(data []byte) error {
+	section, kind := "ungrouped", "hosts"
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return fmt.Errorf("line %d: unterminated section header", lineNo)
+			}
+			section, kind = strings.TrimSpace(line[1:len(line)-1]), "hosts"
+			if name, suffix, ok := strings.Cut(section, ":"); ok {
+				section, kind = name, suffix
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return fmt.Errorf("line %d: unknown section type %q", lineNo, kind)
+			}
+			r.group(section)
+			continue
+		}
+		switch kind {
+		case "vars":
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return fmt.Errorf("line %d: expected key=value in [%s:vars]", lineNo, section)
+			}
+			r.group(section).vars[strings.TrimSpace(key)] = unquoteInventoryValue(strings.TrimSpace(value))
+		case "children":
+			group := r.group(section)
+			r.group(line)
+			if !slices.Contains(group.children, line) {
+				group.children = append(group.children, line)
+			}
+		default:
+			fields := strings.Fields(line)
+			vars := map[string]string{}
+			for _, field := range fields[1:] {
+				if strings.HasPrefix(field, "#") {
+					break
+				}
+				key, value, ok := strings.Cut(field, "=")
+				if !ok {
+					return fmt.Errorf("line %d: expected key=value after host %s, got %q", lineNo, fields[0], field)
+				}
+				vars[key] = unquoteInventoryValue(value)
+			}
+			if err := r.addHost(section, fields[0], vars); err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func unquoteInventoryValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// readYAML reads groups of hosts, children, and vars, starting from the top-level
+// groups, usually just all.
+func (r *inventoryReader) readYAML(data []byte) error {
+	var root yaml.MapSlice
+	if err := yaml.UnmarshalWithOptions(data, &root, yaml.UseOrderedMap()); err != nil {
+		return err
+	}
+	for _, item := range root {
+		if err := r.readYAMLGroup(fmt.Sprint(item.Key), item.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *inventoryReader) readYAMLGroup(name string, value any) error {
+	r.group(name)
+	if value == nil {
+		return nil
+	}
+	fields, ok := value.(yaml.MapSlice)
+	if !ok {
+		return fmt.Errorf("group %s: expected a mapping", name)
+	}
+	for _, field := range fields {
+		key := fmt.Sprint(field.Key)
+		entries, ok := field.Value.(yaml.MapSlice)
+		if field.Value != nil && !ok {
+			return fmt.Errorf("group %s: %s must be a mapping", name, key)
+		}
+		switch key {
+		case "hosts":
+			for _, entry := range entries {
+				vars, err := inventoryVars(entry.Value)
+				if err != nil {
+					return fmt.Errorf("group %s: host %v: %w", name, entry.Key, err)
+				}
+				if err := r.addHost(name, fmt.Sprint(entry.Key), vars); err != nil {
+					return fmt.Errorf("group %s: %w", name, err)
+				}
+			}
+		case "vars":
+			vars, err := inventoryVars(field.Value)
+			if err != nil {
+				return fmt.Errorf("group %s: vars: %w", name, err)
+			}
+			maps.Copy(r.group(name).vars, vars)
+		case "children":
+			for _, entry := range entries {
+				child := fmt.Sprint(entry.Key)
+				if err := r.readYAMLGroup(child, entry.Value); err != nil {
+					return err
+				}
+				group := r.group(name)
+				if !slices.Contains(group.children, child) {
+					group.children = append(group.children, child)
+				}
+			}
+		default:
+			return fmt.Errorf("group %s: unknown key %q", name, key)
+		}
+	}
+	return nil
+}
+
+// inventoryVars flattens a mapping of scalar variables to strings. Variables with
+// structured values are skipped, as none of them describe a host connection.
+func inventoryVars(value any) (map[string]string, error) {
+	vars := map[string]string{}
+	if value == nil {
+		return vars, nil
+	}
+	entries, ok := value.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping of variables")
+	}
+	for _, entry := range entries {
+		switch v := entry.Value.(type) {
+		case yaml.MapSlice, []any:
+		case nil:
+			vars[fmt.Sprint(entry.Key)] = ""
+		default:
+			vars[fmt.Sprint(entry.Key)] = fmt.Sprint(v)
+		}
+	}
+	return vars, nil
+}
+
+// members returns the hosts of a group and its children, in order and without
+// repeating a host.
+func (r *inventoryReader) members(name string, visiting map[string]bool) ([]string, error) {
+	if visiting[name] {
+		return nil, fmt.Errorf("group %s is its own child", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+	group := r.groups[name]
+	hosts := slices.Clone(group.hosts)
+	for _, child := range group.children {
+		childHosts, err := r.members(child, visiting)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range childHosts {
+			if !slices.Contains(hosts, host) {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts, nil
+}
+
+// depth returns how far below all a group is nested: 1 for top-level groups, and
+// one more than its deepest parent for children.
+func (r *inventoryReader) depth(name string, parents map[string][]string, visiting map[string]bool) int {
+	if name == "all" || visiting[name] {
+		return 0
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+	depth := 1
+	for _, parent := range parents[name] {
+		depth = max(depth, r.depth(parent, parents, visiting)+1)
+	}
+	return depth
+}
+
+func (r *inventoryReader) inventory() (*Inventory, error) {
+	parents := map[string][]string{}
+	for name, group := range r.groups {
+		for _, child := range group.children {
+			parents[child] = append(parents[child], name)
+		}
+	}
+	groupNames := slices.Sorted(maps.Keys(r.groups))
+	members := map[string][]string{}
+	for _, name := range groupNames {
+		hosts, err := r.members(name, map[string]bool{})
+		if err != nil {
+			return nil, fmt.Errorf("inventory: %w", err)
+		}
+		members[name] = hosts
+	}
+
+	// group variables apply from all down to the most specific group, then the
+	// host's own variables override them
+	slices.SortStableFunc(groupNames, func(a, b string) int {
+		return r.depth(a, parents, map[string]bool{}) - r.depth(b, parents, map[string]bool{})
+	})
+	inv := &Inventory{Hosts: map[string]Host{}, Groups: map[string][]string{}}
+	for _, alias := range r.hosts {
+		vars := map[string]string{}
+		if all, ok := r.groups["all"]; ok {
+			maps.Copy(vars, all.vars)
+		}
+		for _, name := range groupNames {
+			if name != "all" && slices.Contains(members[name], alias) {
+				maps.Copy(vars, r.groups[name].vars)
+			}
+		}
+		maps.Copy(vars, r.hostVars[alias])
+		host, err := inventoryHost(alias, vars)
+		if err != nil {
+			return nil, fmt.Errorf("inventory: host %s: %w", alias, err)
+		}
+		inv.Hosts[alias] = host
+	}
+	for name, hosts := range members {
+		if name == "all" || name == "ungrouped" || len(hosts) == 0 {
+			continue
+		}
+		slices.SortStableFunc(hosts, func(a, b string) int { return r.hostOrder[a] - r.hostOrder[b] })
+		inv.Groups[name] = hosts
+	}
+	return inv, nil
+}
+
+func inventoryHost(alias string, vars map[string]string) (Host, error) {
+	if vars["ansible_connection"] == "local" {
+		return Host{}, nil
+	}
+	host := Host{
+		IP:       firstInventoryVar(vars, "ansible_host", "ansible_ssh_host"),
+		Username: firstInventoryVar(vars, "ansible_user", "ansible_ssh_user"),
+		Password: firstInventoryVar(vars, "ansible_password", "ansible_ssh_pass"),
+		KeyFile:  vars["ansible_ssh_private_key_file"],
+	}
+	if host.IP == "" {
+		host.IP = alias
+	}
+	if port := firstInventoryVar(vars, "ansible_port", "ansible_ssh_port"); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 || n > 65535 {
+			return Host{}, fmt.Errorf("invalid ansible_port %q", port)
+		}
+		host.Port = n
+	}
+	return host, nil
+}
+
+func firstInventoryVar(vars map[string]string, names ...string) string {
+	for _, name := range names {
+		if value := vars[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// importHostsFrom merges the inventory named by hosts_from into the hosts and host
+// groups of cfg. Hosts and groups defined in the config keep their definition.
+func importHostsFrom(cfg *Config) []string {
+	if strings.TrimSpace(cfg.HostsFrom) == "" {
+		return nil
+	}
+	inv, err := LoadInventory(expandHome(cfg.HostsFrom))
+	if err != nil {
+		return []string{fmt.Sprintf("hosts_from: %v", err)}
+	}
+	if len(inv.Hosts) > 0 && cfg.Hosts == nil {
+		cfg.Hosts = map[string]Host{}
+	}
+	for alias, host := range inv.Hosts {
+		if _, ok := cfg.Hosts[alias]; !ok {
+			cfg.Hosts[alias] = host
+		}
+	}
+	if len(inv.Groups) > 0 && cfg.HostGroups == nil {
+		cfg.HostGroups = map[string][]string{}
+	}
+	for name, members := range inv.Groups {
+		if _, ok := cfg.HostGroups[name]; !ok {
+			cfg.HostGroups[name] = members
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+//go:build unit
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeInventory(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func checkInventory(t *testing.T, inv *Inventory) {
+	t.Helper()
+	wantHosts := map[string]Host{
+		"bastion": {},
+		"gen1":    {IP: "10.0.0.1", Username: "bench", KeyFile: "~/.ssh/bench"},
+		"gen2":    {IP: "10.0.0.2", Port: 2222, Username: "bench", KeyFile: "~/.ssh/bench"},
+		"db1":     {IP: "db1", Username: "postgres", KeyFile: "~/.ssh/bench"},
+	}
+	if len(inv.Hosts) != len(wantHosts) {
+		t.Fatalf("hosts = %v, want %v", inv.Hosts, wantHosts)
+	}
+	for alias, want := range wantHosts {
+		if got := inv.Hosts[alias]; got != want {
+			t.Fatalf("hosts[%s] = %+v, want %+v", alias, got, want)
+		}
+	}
+	wantGroups := map[string][]string{
+		"generators": {"gen1", "gen2"},
+		"db":         {"db1"},
+		"cluster":    {"gen1", "gen2", "db1"},
+	}
+	if len(inv.Groups) != len(wantGroups) {
+		t.Fatalf("groups = %v, want %v", inv.Groups, wantGroups)
+	}
+	for name, want := range wantGroups {
+		if got := inv.Groups[name]; !slices.Equal(got, want) {
+			t.Fatalf("groups[%s] = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLoadInventoryINI(t *testing.T) {
+	path := writeInventory(t, "inventory.ini", `
+bastion ansible_connection=local
+
+[generators]
+gen1 ansible_host=10.0.0.1
+gen2 ansible_host=10.0.0.2 ansible_port=2222  # second generator
+
+[db]
+db1 ansible_user=postgres
+
+[cluster:children]
+generators
+db
+
+[cluster:vars]
+ansible_user=bench
+
+[all:vars]
+ansible_ssh_private_key_file="~/.ssh/bench"
+`)
+	inv, err := LoadInventory(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkInventory(t, inv)
+}
+
+func TestLoadInventoryYAML(t *testing.T) {
+	path := writeInventory(t, "inventory.yaml", `
+all:
+  vars:
+    ansible_ssh_private_key_file: ~/.ssh/bench
+  hosts:
+    bastion:
+      ansible_connection: local
+  children:
+    cluster:
+      vars:
+        ansible_user: bench
+      children:
+        generators:
+          hosts:
+            gen1:
+              ansible_host: 10.0.0.1
+            gen2:
+              ansible_host: 10.0.0.2
+              ansible_port: 2222
+        db:
+          hosts:
+            db1:
+              ansible_user: postgres
+`)
+	inv, err := LoadInventory(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkInventory(t, inv)
+}
+
+func TestLoadInventoryErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, file, content, contain string
+	}{
+		{"host range", "inventory.ini", "[web]\nweb[01:03]\n", "host ranges are not supported"},
+		{"bad host var", "inventory.ini", "[web]\nweb1 ansible_host\n", "expected key=value"},
+		{"bad port", "inventory.ini", "[web]\nweb1 ansible_port=ssh\n", "invalid ansible_port"},
+		{"unknown section", "inventory.ini", "[web:hosts2]\n", "unknown section type"},
+		{"child cycle", "inventory.ini", "[a:children]\nb\n[b:children]\na\n", "is its own child"},
+		{"unknown yaml key", "inventory.yml", "all:\n  host:\n    web1:\n", "unknown key"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadInventory(writeInventory(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.contain) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.contain)
+			}
+		})
+	}
+}
+
+func TestHostsFromMergesInventory(t *testing.T) {
+	path := writeInventory(t, "inventory.ini", `
+[generators]
+gen1 ansible_host=10.0.0.1
+gen2 ansible_host=10.0.0.2
+`)
+	yaml := `
+benchmark:
+  name: inventory
+  output_dir: ./results
+hosts_from: ` + path + `
+hosts:
+  gen2: {ip: 192.168.0.2}
+stages:
+  - name: load
+    hosts: [generators]
+    command: ./load
+`
+	cfg, err := ParseYAML([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Hosts["gen1"].IP; got != "10.0.0.1" {
+		t.Fatalf("gen1 ip = %q, want the inventory address", got)
+	}
+	if got := cfg.Hosts["gen2"].IP; got != "192.168.0.2" {
+		t.Fatalf("gen2 ip = %q, want the config address", got)
+	}
+	if got := cfg.Stages[0].Hosts; !slices.Equal(got, []string{"gen1", "gen2"}) {
+		t.Fatalf("stage hosts = %v, want the inventory group", got)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("imported config no longer validates: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import "maps"
+
+// Combinations returns every combination of the matrix parameter values, with the
+// first parameter changing slowest. It returns nil when no matrix is configured.
+func (cfg *Config) Combinations() []map[string]string {
+	if len(cfg.Matrix) == 0 {
+		return nil
+	}
+	combinations := []map[string]string{{}}
+	for _, parameter := range cfg.Matrix {
+		next := make([]map[string]string, 0, len(combinations)*len(parameter.Values))
+		for _, combination := range combinations {
+			for _, value := range parameter.Values {
+				extended := maps.Clone(combination)
+				extended[parameter.Name] = value
+				next = append(next, extended)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// runDirReference matches the paths below $BENCHCTL_RUN_DIR a stage command reads
+// or writes, such as "$BENCHCTL_RUN_DIR/latency.csv".
+var runDirReference = regexp.MustCompile("\\$(?:\\{BENCHCTL_RUN_DIR\\}|BENCHCTL_RUN_DIR\\b)/([^\\s'\"`;|&<>()]+)")
+
+// runDirWrite matches the paths below $BENCHCTL_RUN_DIR a command writes by
+// redirection, tee, or an -o flag.
+var runDirWrite = regexp.MustCompile("(?:>>?|\\btee(?:\\s+-a)?|\\s-o)\\s*\\$(?:\\{BENCHCTL_RUN_DIR\\}|BENCHCTL_RUN_DIR\\b)/([^\\s'\"`;|&<>()]+)")
+
+var templateReference = regexp.MustCompile(`\$\{[^}]*\}|\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// runDirFiles are the files benchctl itself writes to a run directory.
+var runDirFiles = []string{"metadata.json", "benchctl.ndjson", "console", "notes.jsonl", "trace.log"}
+
+// maxScannedSource bounds the size of the scripts and uploaded files whose
+// contents StageOrderWarnings reads; larger files are datasets or binaries.
+const maxScannedSource = 1 << 20
+
+// StageOrderWarnings reports stages that read a file of the run directory before
+// the stage collecting it has run: a later stage in config order or a stage of
+// its parallel group, a background stage, whose outputs are collected when the
+// run ends, or, with depends_on, a stage the reader does not depend on. A
+// reference no output collects, and no earlier stage writes, is reported too.
+// The command, the script, and the files uploaded by a stage are read for
+// references; scripts and files that cannot be read are skipped.
+func StageOrderWarnings(cfg *Config) []string {
+	stages := cfg.Stages
+	graph := DependencyGraph(stages)
+	ancestors := stageAncestors(stages)
+	sources := make([]string, len(stages))
+	for i, stage := range stages {
+		sources[i] = stageSources(stage)
+	}
+
+	// Files written by a stage are assumed to be there for it and later stages.
+	written := map[string]int{}
+	for i := len(stages) - 1; i >= 0; i-- {
+		for _, match := range runDirWrite.FindAllStringSubmatch(sources[i], -1) {
+			written[strings.TrimRight(match[1], ".,")] = i
+		}
+	}
+
+	var warnings []string
+	for i, stage := range stages {
+		seen := map[string]bool{}
+		for _, match := range runDirReference.FindAllStringSubmatch(sources[i], -1) {
+			file := strings.TrimRight(match[1], ".,")
+			if file == "" || seen[file] || slices.Contains(runDirFiles, strings.SplitN(file, "/", 2)[0]) {
+				continue
+			}
+			seen[file] = true
+			if j, ok := written[file]; ok && j <= i {
+				continue
+			}
+			before := func(j int) bool {
+				if graph {
+					return ancestors[i][j]
+				}
+				return j < i && !sameParallelGroup(stage, stages[j])
+			}
+			var producers []int
+			for j := range stages {
+				if j != i && producesFile(stages[j], file) {
+					producers = append(producers, j)
+				}
+			}
+			if slices.ContainsFunc(producers, func(j int) bool { return before(j) && !stages[j].Background }) {
+				continue
+			}
+			reference := fmt.Sprintf("stages[%d] (%s) reads $BENCHCTL_RUN_DIR/%s", i, stage.Name, file)
+			if len(producers) == 0 {
+				if !templateReference.MatchString(file) {
+					warnings = append(warnings, reference+", which no earlier stage collects or writes")
+				}
+				continue
+			}
+			j := producers[0]
+			switch {
+			case stages[j].Background && before(j):
+				warnings = append(warnings, fmt.Sprintf("%s, which background stage stages[%d] (%s) only collects when the run ends", reference, j, stages[j].Name))
+			case graph:
+				warnings = append(warnings, fmt.Sprintf("%s, which is collected by stages[%d] (%s); add %s to depends_on", reference, j, stages[j].Name, stages[j].Name))
+			case sameParallelGroup(stage, stages[j]):
+				warnings = append(warnings, fmt.Sprintf("%s, which is collected by stages[%d] (%s) running at the same time in parallel group '%s'", reference, j, stages[j].Name, stage.Parallel))
+			default:
+				warnings = append(warnings, fmt.Sprintf("%s, which is collected by the later stages[%d] (%s)", reference, j, stages[j].Name))
+			}
+		}
+	}
+	return warnings
+}
+
+// stageSources returns the command of stage followed by the contents of its
+// script and of the files it uploads, which run on the host as well.
+func stageSources(stage Stage) string {
+	sources := []string{stage.Command}
+	paths := []string{stage.Script}
+	for _, file := range stage.Files {
+		paths = append(paths, file.LocalPath)
+	}
+	for _, name := range paths {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxScannedSource {
+			continue
+		}
+		if data, err := os.ReadFile(name); err == nil {
+			sources = append(sources, string(data))
+		}
+	}
+	return strings.Join(sources, "\n")
+}
+
+// producesFile reports whether an output of stage is stored as file in the run
+// directory, with the templates of output names and local paths matching any text.
+func producesFile(stage Stage, file string) bool {
+	file = templateReference.ReplaceAllString(file, "x")
+	for _, suffix := range []string{".gz", ".zst"} {
+		file = strings.TrimSuffix(file, suffix)
+	}
+	for _, output := range stage.Outputs {
+		name := templateReference.ReplaceAllString(output.Name, "*")
+		if output.LocalPath != "" {
+			localPath := path.Clean(templateReference.ReplaceAllString(output.LocalPath, "*"))
+			if strings.ContainsAny(output.RemotePath, "*?[") {
+				localPath += "/*"
+			}
+			if ok, _ := path.Match(localPath, file); ok {
+				return true
+			}
+			continue
+		}
+		if strings.ContainsAny(output.RemotePath, "*?[") {
+			if ok, _ := path.Match(name, strings.SplitN(file, "/", 2)[0]); ok {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(name+path.Ext(output.RemotePath), file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sameParallelGroup reports whether a and b belong to one parallel group.
+func sameParallelGroup(a, b Stage) bool {
+	return a.Parallel != "" && a.Parallel == b.Parallel
+}
+
+// stageAncestors returns, for every stage, the stages it transitively depends on.
+// validateStageDependencies has ruled out unknown stages and cycles.
+func stageAncestors(stages []Stage) []map[int]bool {
+	dependencies := StageDependencies(stages)
+	index := make(map[string]int, len(stages))
+	for i, stage := range stages {
+		index[stage.Name] = i
+	}
+	ancestors := make([]map[int]bool, len(stages))
+	var visit func(i int) map[int]bool
+	visit = func(i int) map[int]bool {
+		if ancestors[i] != nil {
+			return ancestors[i]
+		}
+		ancestors[i] = map[int]bool{}
+		for _, dependency := range dependencies[i] {
+			j, ok := index[dependency]
+			if !ok {
+				continue
+			}
+			ancestors[i][j] = true
+			for k := range visit(j) {
+				ancestors[i][k] = true
+			}
+		}
+		return ancestors[i]
+	}
+	for i := range stages {
+		visit(i)
+	}
+	return ancestors
+}
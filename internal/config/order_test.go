@@ -0,0 +1,117 @@
+//go:build unit
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStageOrderWarnings(t *testing.T) {
+	load := Stage{
+		Name:    "load",
+		Command: "./loadgen",
+		Outputs: []Output{
+			{Name: "${BENCHCTL_HOST}-latency", RemotePath: "/tmp/latency.csv"},
+			{Name: "logs", RemotePath: "/var/log/bench/*.log"},
+		},
+	}
+	monitor := Stage{
+		Name:       "monitor",
+		Command:    "./monitor",
+		Background: true,
+		Outputs:    []Output{{Name: "cpu", RemotePath: "/tmp/cpu.csv", Compress: "gzip"}},
+	}
+	report := Stage{
+		Name:    "report",
+		Command: "python report.py ${BENCHCTL_RUN_DIR}/server-latency.csv $BENCHCTL_RUN_DIR/logs/a.log",
+	}
+	cpu := Stage{Name: "cpu", Command: "gunzip -c $BENCHCTL_RUN_DIR/cpu.csv.gz"}
+	dir := t.TempDir()
+	script, uploaded := filepath.Join(dir, "report.sh"), filepath.Join(dir, "report.yaml")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\npython report.py \"$BENCHCTL_RUN_DIR/server-latency.csv\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(uploaded, []byte("logs: $BENCHCTL_RUN_DIR/logs/a.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scripted := Stage{Name: "report", Script: script, Files: []StageFile{{LocalPath: uploaded, RemotePath: "/tmp/report.yaml"}}}
+	notes := Stage{
+		Name:    "notes",
+		Command: "echo done > $BENCHCTL_RUN_DIR/summary.txt; cat $BENCHCTL_RUN_DIR/summary.txt $BENCHCTL_RUN_DIR/metadata.json $BENCHCTL_RUN_DIR/missing.txt",
+	}
+
+	tests := []struct {
+		name   string
+		stages []Stage
+		want   []string
+	}{
+		{
+			name:   "outputs of earlier stages",
+			stages: []Stage{load, report},
+		},
+		{
+			name:   "forward reference",
+			stages: []Stage{report, load},
+			want: []string{
+				"stages[0] (report) reads $BENCHCTL_RUN_DIR/server-latency.csv, which is collected by the later stages[1] (load)",
+				"stages[0] (report) reads $BENCHCTL_RUN_DIR/logs/a.log, which is collected by the later stages[1] (load)",
+			},
+		},
+		{
+			name: "same parallel group",
+			stages: []Stage{
+				{Name: "load", Command: load.Command, Outputs: load.Outputs, Parallel: "bench"},
+				{Name: "report", Command: report.Command, Parallel: "bench"},
+			},
+			want: []string{
+				"stages[1] (report) reads $BENCHCTL_RUN_DIR/server-latency.csv, which is collected by stages[0] (load) running at the same time in parallel group 'bench'",
+				"stages[1] (report) reads $BENCHCTL_RUN_DIR/logs/a.log, which is collected by stages[0] (load) running at the same time in parallel group 'bench'",
+			},
+		},
+		{
+			name:   "background outputs",
+			stages: []Stage{monitor, cpu},
+			want:   []string{"stages[1] (cpu) reads $BENCHCTL_RUN_DIR/cpu.csv.gz, which background stage stages[0] (monitor) only collects when the run ends"},
+		},
+		{
+			name:   "missing dependency",
+			stages: []Stage{load, {Name: "report", Command: report.Command, DependsOn: []string{"setup"}}, {Name: "setup", Command: "true"}},
+			want: []string{
+				"stages[1] (report) reads $BENCHCTL_RUN_DIR/server-latency.csv, which is collected by stages[0] (load); add load to depends_on",
+				"stages[1] (report) reads $BENCHCTL_RUN_DIR/logs/a.log, which is collected by stages[0] (load); add load to depends_on",
+			},
+		},
+		{
+			name: "outputs with a local path",
+			stages: []Stage{
+				{Name: "sweep", Command: "./sweep", Outputs: []Output{{Name: "latency", RemotePath: "/tmp/latency.csv", LocalPath: "results/latency_${BENCHCTL_ITERATION}.csv"}}},
+				{Name: "report", Command: "python report.py $BENCHCTL_RUN_DIR/results/latency_1.csv $BENCHCTL_RUN_DIR/latency.csv"},
+			},
+			want: []string{"stages[1] (report) reads $BENCHCTL_RUN_DIR/latency.csv, which no earlier stage collects or writes"},
+		},
+		{
+			name:   "scripts and uploaded files",
+			stages: []Stage{scripted, load},
+			want: []string{
+				"stages[0] (report) reads $BENCHCTL_RUN_DIR/server-latency.csv, which is collected by the later stages[1] (load)",
+				"stages[0] (report) reads $BENCHCTL_RUN_DIR/logs/a.log, which is collected by the later stages[1] (load)",
+			},
+		},
+		{
+			name:   "files no stage collects",
+			stages: []Stage{notes},
+			want:   []string{"stages[0] (notes) reads $BENCHCTL_RUN_DIR/missing.txt, which no earlier stage collects or writes"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := StageOrderWarnings(&Config{Stages: tt.stages})
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("warnings =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
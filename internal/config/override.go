@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+var overrideSegmentPattern = regexp.MustCompile(`^([^\[\]]+)((?:\[\d+\])*)$`)
+
+// ApplyOverrides sets values such as "stages[2].command=./bench --fast" or
+// "benchmark.output_dir=/tmp/results" in a YAML config before it is decoded, so
+// overridden values are validated like the rest of the file.
+//
+// Values are taken verbatim as strings, except booleans, numbers, and flow
+// sequences and mappings ("[vm1, vm2]", "{ip: 10.0.0.1}"), which are parsed as YAML.
+// Missing mapping keys are created, and an index one past the end of a sequence
+// appends to it.
+func ApplyOverrides(data []byte, overrides []string) ([]byte, error) {
+	if len(overrides) == 0 {
+		return data, nil
+	}
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		path, raw, ok := strings.Cut(override, "=")
+		if !ok || strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf("invalid override %q: expected path=value", override)
+		}
+		segments, err := parseOverridePath(strings.TrimSpace(path))
+		if err != nil {
+			return nil, fmt.Errorf("invalid override %q: %w", override, err)
+		}
+		value, err := overrideValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid override %q: %w", override, err)
+		}
+		doc, err = setOverride(doc, segments, value)
+		if err != nil {
+			return nil, fmt.Errorf("override %s: %w", path, err)
+		}
+	}
+	return yaml.Marshal(doc)
+}
+
+// overrideSegment is one step of an override path: a mapping key or a sequence index.
+type overrideSegment struct {
+	key   string
+	index int
+}
+
+func (s overrideSegment) isIndex() bool {
+	return s.key == ""
+}
+
+func parseOverridePath(path string) ([]overrideSegment, error) {
+	var segments []overrideSegment
+	for part := range strings.SplitSeq(path, ".") {
+		match := overrideSegmentPattern.FindStringSubmatch(part)
+		if match == nil {
+			return nil, fmt.Errorf("path segment %q must be a key optionally followed by [index]", part)
+		}
+		segments = append(segments, overrideSegment{key: match[1]})
+		for index := range strings.SplitSeq(strings.Trim(match[2], "[]"), "][") {
+			if index == "" {
+				continue
+			}
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q", index)
+			}
+			segments = append(segments, overrideSegment{index: i})
+		}
+	}
+	return segments, nil
+}
+
+// overrideValue keeps raw as a string unless it is a canonical boolean or number,
+// which string fields accept as well, or a flow collection.
+func overrideValue(raw string) (any, error) {
+	if raw == "true" || raw == "false" {
+		return raw == "true", nil
+	}
+	if i, err := strconv.ParseInt(raw, 10, 64); err == nil && strconv.FormatInt(i, 10) == raw {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == raw {
+		return f, nil
+	}
+	trimmed := strings.TrimSpace(raw)
+	if !strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "{") {
+		return raw, nil
+	}
+	var value any
+	if err := yaml.Unmarshal([]byte(trimmed), &value); err != nil {
+		return nil, fmt.Errorf("parse value: %w", err)
+	}
+	return value, nil
+}
+
+// setOverride returns node with value stored at segments, creating missing mappings.
+func setOverride(node any, segments []overrideSegment, value any) (any, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	segment := segments[0]
+	if segment.isIndex() {
+		list, ok := node.([]any)
+		if node != nil && !ok {
+			return nil, fmt.Errorf("[%d] indexes a value that is not a list", segment.index)
+		}
+		if segment.index > len(list) {
+			return nil, fmt.Errorf("index %d out of range (list has %d entries)", segment.index, len(list))
+		}
+		if segment.index == len(list) {
+			list = append(list, nil)
+		}
+		child, err := setOverride(list[segment.index], segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		list[segment.index] = child
+		return list, nil
+	}
+
+	mapping, ok := node.(map[string]any)
+	if node != nil && !ok {
+		return nil, fmt.Errorf("%s is a key of a value that is not a mapping", segment.key)
+	}
+	if mapping == nil {
+		mapping = map[string]any{}
+	}
+	child, err := setOverride(mapping[segment.key], segments[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	mapping[segment.key] = child
+	return mapping, nil
+}
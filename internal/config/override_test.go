@@ -0,0 +1,86 @@
+//go:build unit
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	base := []byte(`benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  vm1:
+    ip: 10.0.0.1
+    username: bench
+    key_file: ~/.ssh/id
+stages:
+  - name: setup
+    command: ./setup
+  - name: bench
+    command: ./bench
+`)
+
+	t.Run("typed values", func(t *testing.T) {
+		data, err := ApplyOverrides(base, []string{
+			"benchmark.output_dir=/tmp/results",
+			"stages[1].command=./bench --duration 30s # quick",
+			"stages[0].skip=true",
+			"stages[1].hosts=[vm1]",
+			"hosts.vm1.port=2222",
+			"stages[2].name=report",
+			"stages[2].command=true",
+		})
+		if err != nil {
+			t.Fatalf("ApplyOverrides: %v", err)
+		}
+		cfg, err := ParseYAML(data)
+		if err != nil {
+			t.Fatalf("ParseYAML: %v\n%s", err, data)
+		}
+		if cfg.Benchmark.OutputDir != "/tmp/results" {
+			t.Fatalf("output_dir = %q", cfg.Benchmark.OutputDir)
+		}
+		if cfg.Stages[1].Command != "./bench --duration 30s # quick" || len(cfg.Stages[1].Hosts) != 1 {
+			t.Fatalf("stage override not applied: %+v", cfg.Stages[1])
+		}
+		if !cfg.Stages[0].Skip || cfg.Hosts["vm1"].Port != 2222 {
+			t.Fatalf("typed overrides not applied: skip=%v port=%d", cfg.Stages[0].Skip, cfg.Hosts["vm1"].Port)
+		}
+		if len(cfg.Stages) != 3 || cfg.Stages[2].Command != "true" {
+			t.Fatalf("expected appended stage, got %+v", cfg.Stages)
+		}
+	})
+
+	errorTests := []struct {
+		name     string
+		override string
+		contain  string
+	}{
+		{name: "missing value", override: "benchmark.name", contain: "expected path=value"},
+		{name: "index out of range", override: "stages[5].command=x", contain: "index 5 out of range (list has 2 entries)"},
+		{name: "index into mapping", override: "benchmark[0]=x", contain: "not a list"},
+		{name: "key into scalar", override: "benchmark.name.first=x", contain: "not a mapping"},
+		{name: "bad segment", override: "stages[x].command=y", contain: "must be a key optionally followed by [index]"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ApplyOverrides(base, []string{tt.override})
+			if err == nil || !strings.Contains(err.Error(), tt.contain) {
+				t.Fatalf("expected error containing %q, got %v", tt.contain, err)
+			}
+		})
+	}
+
+	t.Run("unknown field is rejected by validation", func(t *testing.T) {
+		data, err := ApplyOverrides(base, []string{"benchmark.outptu_dir=x"})
+		if err != nil {
+			t.Fatalf("ApplyOverrides: %v", err)
+		}
+		if _, err := ParseYAML(data); err == nil {
+			t.Fatalf("expected strict decoding to reject the misspelled key")
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ApplyProfiles merges the named entries of the profiles section of a YAML config
+// over the rest of the file, in order, and removes the section. It runs before
+// ApplyOverrides, so --set values win over profiles.
+//
+// A profile has the shape of a config and is deep-merged into it:
+//   - mappings merge key by key, and a key set to null is removed;
+//   - lists whose entries all have a name, such as stages, cleanup, and cases,
+//     merge by name: an entry with a known name is merged into it, others are
+//     appended;
+//   - any other value, lists included, replaces the base value.
+func ApplyProfiles(data []byte, names []string) ([]byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		if len(names) > 0 {
+			return nil, fmt.Errorf("profile %s: config is not a mapping", names[0])
+		}
+		return data, nil
+	}
+	rawProfiles, hasProfiles := root["profiles"]
+	if !hasProfiles && len(names) == 0 {
+		return data, nil
+	}
+	profiles, ok := rawProfiles.(map[string]any)
+	if rawProfiles != nil && !ok {
+		return nil, fmt.Errorf("profiles must be a mapping of profile names to config overlays")
+	}
+	delete(root, "profiles")
+
+	for _, name := range names {
+		profile, ok := profiles[name]
+		if !ok {
+			available := slices.Sorted(maps.Keys(profiles))
+			if len(available) == 0 {
+				return nil, fmt.Errorf("unknown profile %q: the config defines no profiles", name)
+			}
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(available, ", "))
+		}
+		if _, ok := profile.(map[string]any); profile != nil && !ok {
+			return nil, fmt.Errorf("profile %s must be a mapping", name)
+		}
+		if overlay, ok := profile.(map[string]any); ok {
+			if _, nested := overlay["profiles"]; nested {
+				return nil, fmt.Errorf("profile %s cannot define profiles", name)
+			}
+		}
+		root = mergeProfile(root, profile).(map[string]any)
+	}
+	return yaml.Marshal(root)
+}
+
+// mergeProfile deep-merges overlay into base as described by ApplyProfiles.
+func mergeProfile(base, overlay any) any {
+	switch overlay := overlay.(type) {
+	case map[string]any:
+		mapping, ok := base.(map[string]any)
+		if !ok {
+			mapping = map[string]any{}
+		}
+		for key, value := range overlay {
+			if value == nil {
+				delete(mapping, key)
+				continue
+			}
+			mapping[key] = mergeProfile(mapping[key], value)
+		}
+		return mapping
+	case []any:
+		list, ok := base.([]any)
+		if !ok || !namedEntries(list) || !namedEntries(overlay) {
+			return overlay
+		}
+		for _, entry := range overlay {
+			name := entry.(map[string]any)["name"]
+			index := slices.IndexFunc(list, func(existing any) bool {
+				return existing.(map[string]any)["name"] == name
+			})
+			if index < 0 {
+				list = append(list, entry)
+				continue
+			}
+			list[index] = mergeProfile(list[index], entry)
+		}
+		return list
+	case nil:
+		return base
+	}
+	return overlay
+}
+
+// namedEntries reports whether every entry of list is a mapping with a string name.
+func namedEntries(list []any) bool {
+	for _, entry := range list {
+		mapping, ok := entry.(map[string]any)
+		if !ok {
+			return false
+		}
+		if _, ok := mapping["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
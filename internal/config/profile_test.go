@@ -0,0 +1,141 @@
+//go:build unit
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyProfiles(t *testing.T) {
+	base := []byte(`benchmark:
+  name: test
+  output_dir: ./results
+hosts:
+  server:
+    ip: 127.0.0.1
+    username: dev
+stages:
+  - name: setup
+    command: ./setup
+  - name: bench
+    command: ./bench --local
+    host: server
+profiles:
+  cluster:
+    benchmark:
+      output_dir: /data/results
+    hosts:
+      server:
+        ip: 10.0.0.1
+        username: null
+        key_file: ~/.ssh/cluster
+    stages:
+      - name: bench
+        command: ./bench --cluster
+      - name: report
+        command: ./report
+  quick:
+    stages:
+      - name: bench
+        command: ./bench --quick
+`)
+
+	t.Run("merge", func(t *testing.T) {
+		data, err := ApplyProfiles(base, []string{"cluster"})
+		if err != nil {
+			t.Fatalf("ApplyProfiles: %v", err)
+		}
+		cfg, err := ParseYAML(data)
+		if err != nil {
+			t.Fatalf("ParseYAML: %v\n%s", err, data)
+		}
+		if cfg.Benchmark.OutputDir != "/data/results" || cfg.Benchmark.Name != "test" {
+			t.Fatalf("benchmark not merged: %+v", cfg.Benchmark)
+		}
+		server := cfg.Hosts["server"]
+		if server.IP != "10.0.0.1" || server.Username != "" || server.KeyFile != "~/.ssh/cluster" {
+			t.Fatalf("host not merged: %+v", server)
+		}
+		if len(cfg.Stages) != 3 || cfg.Stages[0].Command != "./setup" || cfg.Stages[2].Name != "report" {
+			t.Fatalf("stages not merged by name: %+v", cfg.Stages)
+		}
+		if cfg.Stages[1].Command != "./bench --cluster" || cfg.Stages[1].Host != "server" {
+			t.Fatalf("stage not merged: %+v", cfg.Stages[1])
+		}
+	})
+
+	t.Run("profiles apply in order and before overrides", func(t *testing.T) {
+		data, err := ApplyProfiles(base, []string{"cluster", "quick"})
+		if err != nil {
+			t.Fatalf("ApplyProfiles: %v", err)
+		}
+		data, err = ApplyOverrides(data, []string{"benchmark.output_dir=./scratch"})
+		if err != nil {
+			t.Fatalf("ApplyOverrides: %v", err)
+		}
+		cfg, err := ParseYAML(data)
+		if err != nil {
+			t.Fatalf("ParseYAML: %v\n%s", err, data)
+		}
+		if cfg.Stages[1].Command != "./bench --quick" || cfg.Benchmark.OutputDir != "./scratch" {
+			t.Fatalf("unexpected precedence: command=%q output_dir=%q", cfg.Stages[1].Command, cfg.Benchmark.OutputDir)
+		}
+	})
+
+	t.Run("no profile strips the section", func(t *testing.T) {
+		data, err := ApplyProfiles(base, nil)
+		if err != nil {
+			t.Fatalf("ApplyProfiles: %v", err)
+		}
+		cfg, err := ParseYAML(data)
+		if err != nil {
+			t.Fatalf("ParseYAML: %v\n%s", err, data)
+		}
+		if cfg.Stages[1].Command != "./bench --local" || len(cfg.Stages) != 2 {
+			t.Fatalf("base config changed: %+v", cfg.Stages)
+		}
+	})
+
+	t.Run("unnamed lists are replaced", func(t *testing.T) {
+		data, err := ApplyProfiles([]byte(`benchmark:
+  name: test
+  output_dir: ./results
+matrix:
+  - name: rate
+    values: [100, 200, 300]
+profiles:
+  ci:
+    matrix:
+      - name: rate
+        values: [100]
+`), []string{"ci"})
+		if err != nil {
+			t.Fatalf("ApplyProfiles: %v", err)
+		}
+		if !strings.Contains(string(data), "values:\n  - 100\n") || strings.Contains(string(data), "200") {
+			t.Fatalf("expected values to be replaced:\n%s", data)
+		}
+	})
+
+	errorTests := []struct {
+		name     string
+		data     string
+		profiles []string
+		contain  string
+	}{
+		{name: "unknown profile", data: string(base), profiles: []string{"prod"}, contain: `unknown profile "prod" (available: cluster, quick)`},
+		{name: "no profiles", data: "benchmark:\n  name: test\n", profiles: []string{"prod"}, contain: "the config defines no profiles"},
+		{name: "profile not a mapping", data: "profiles:\n  prod: [a]\n", profiles: []string{"prod"}, contain: "profile prod must be a mapping"},
+		{name: "nested profiles", data: "profiles:\n  prod:\n    profiles: {}\n", profiles: []string{"prod"}, contain: "profile prod cannot define profiles"},
+		{name: "profiles not a mapping", data: "profiles: [a]\n", contain: "profiles must be a mapping"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ApplyProfiles([]byte(tt.data), tt.profiles)
+			if err == nil || !strings.Contains(err.Error(), tt.contain) {
+				t.Fatalf("expected error containing %q, got %v", tt.contain, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// validateProvision checks the provision block of a host. Provisioned hosts are
+// plain SSH hosts whose address comes from the provider.
+func validateProvision(alias string, host Host) []string {
+	p := host.Provision
+	if p == nil {
+		return nil
+	}
+	var errs []string
+	if p.Provider != "hetzner" {
+		errs = append(errs, fmt.Sprintf("hosts.%s.provision.provider must be one of [hetzner]", alias))
+	}
+	for _, field := range []struct{ name, value string }{{"type", p.Type}, {"region", p.Region}, {"image", p.Image}} {
+		if strings.TrimSpace(field.value) == "" {
+			errs = append(errs, fmt.Sprintf("hosts.%s.provision.%s must be set", alias, field.name))
+		}
+	}
+	if p.Timeout != "" {
+		if timeout, err := time.ParseDuration(p.Timeout); err != nil || timeout <= 0 {
+			errs = append(errs, fmt.Sprintf("hosts.%s.provision.timeout must be a positive duration", alias))
+		}
+	}
+	if host.IP != "" || host.SSHAlias != "" || host.Type != "" || host.OS == "windows" {
+		errs = append(errs, fmt.Sprintf("hosts.%s: provisioned hosts get their ip from the provider and cannot set ip, ssh_alias, type, or os windows", alias))
+	}
+	return errs
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Secret reference prefixes accepted by host password, key_password, and key_file.
+const (
+	SecretEnvPrefix  = "env://"
+	SecretFilePrefix = "file://"
+	SecretExecPrefix = "exec://"
+)
+
+// IsSecretRef reports whether value references an external secret instead of
+// holding it.
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretEnvPrefix) ||
+		strings.HasPrefix(value, SecretFilePrefix) ||
+		strings.HasPrefix(value, SecretExecPrefix)
+}
+
+// ResolveSecret returns the secret value references: the environment variable of
+// env://NAME, the contents of file://path, or the standard output of the shell
+// command of exec://command. A single trailing newline is dropped. Values that are
+// not references are returned unchanged.
+//
+// Secrets are resolved when a connection is opened, so the config, and the run
+// metadata written from it, only ever contain the reference.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret %s: environment variable %s is not set", value, name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, SecretFilePrefix):
+		data, err := os.ReadFile(expandHome(strings.TrimPrefix(value, SecretFilePrefix)))
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", value, err)
+		}
+		return trimNewline(string(data)), nil
+	case strings.HasPrefix(value, SecretExecPrefix):
+		var stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", strings.TrimPrefix(value, SecretExecPrefix))
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w: %s", value, err, strings.TrimSpace(stderr.String()))
+		}
+		return trimNewline(string(out)), nil
+	}
+	return value, nil
+}
+
+// validateSecretRef checks that a secret reference names what it refers to.
+func validateSecretRef(field, value string) []string {
+	if !IsSecretRef(value) {
+		return nil
+	}
+	scheme, target, _ := strings.Cut(value, "://")
+	if strings.TrimSpace(target) == "" {
+		return []string{fmt.Sprintf("%s: %s:// reference must name a secret", field, scheme)}
+	}
+	if scheme == "env" && !parameterNamePattern.MatchString(target) {
+		return []string{fmt.Sprintf("%s: %s is not a valid environment variable name", field, target)}
+	}
+	return nil
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+func trimNewline(value string) string {
+	value = strings.TrimSuffix(value, "\n")
+	return strings.TrimSuffix(value, "\r")
+}
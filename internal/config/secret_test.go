@@ -0,0 +1,56 @@
+//go:build unit
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("BENCH_SSH_PASSWORD", "from-env")
+	secretFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "plaintext", want: "plaintext"},
+		{value: "env://BENCH_SSH_PASSWORD", want: "from-env"},
+		{value: "file://" + secretFile, want: "from-file"},
+		{value: "exec://printf 'from-exec\\n'", want: "from-exec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ResolveSecret(tt.value)
+			if err != nil {
+				t.Fatalf("ResolveSecret: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("ResolveSecret(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		value   string
+		contain string
+	}{
+		{value: "env://BENCH_UNSET_SECRET", contain: "BENCH_UNSET_SECRET is not set"},
+		{value: "file://" + filepath.Join(t.TempDir(), "missing"), contain: "no such file"},
+		{value: "exec://echo denied >&2; exit 3", contain: "denied"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.value, func(t *testing.T) {
+			_, err := ResolveSecret(tt.value)
+			if err == nil || !strings.Contains(err.Error(), tt.contain) {
+				t.Fatalf("expected error containing %q, got %v", tt.contain, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Session drives an interactive command such as redis-cli, a debugger, or the
+// console of a game server: the stage command starts once, and the steps are sent
+// to its stdin one after the other, each waiting for its reply.
+type Session struct {
+	// Prompt is a regular expression matching the prompt of the command, awaited
+	// before the first step and after every step.
+	Prompt string `yaml:"prompt,omitempty" json:"prompt,omitempty"`
+	// Timeout bounds the wait for each prompt and reply, and for the command to
+	// exit once the steps are done (default: 30s).
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty" jsonschema:"default=30s"`
+	// StartTimeout bounds the first wait, for the prompt or the first reply, which
+	// includes starting the command (default: 30s, or timeout when it is longer).
+	StartTimeout string        `yaml:"start_timeout,omitempty" json:"start_timeout,omitempty" jsonschema:"default=30s"`
+	Steps        []SessionStep `yaml:"steps" json:"steps"`
+}
+
+// SessionStep is one line sent to a session and the reply it waits for.
+type SessionStep struct {
+	Send string `yaml:"send,omitempty" json:"send,omitempty"`
+	// Expect is a regular expression the output after Send must match before the
+	// next step.
+	Expect string `yaml:"expect,omitempty" json:"expect,omitempty"`
+}
+
+// defaultSessionTimeout is the timeout of a session without timeout, and the
+// least start_timeout of one without start_timeout.
+const defaultSessionTimeout = 30 * time.Second
+
+func validateSession(i int, st *Stage) []string {
+	var errs []string
+	session := st.Session
+	prefix := fmt.Sprintf("stages[%d].session", i)
+	if _, err := regexp.Compile(session.Prompt); err != nil {
+		errs = append(errs, fmt.Sprintf("%s.prompt: %v", prefix, err))
+	}
+	if session.Timeout == "" {
+		session.Timeout = defaultSessionTimeout.String()
+	}
+	timeout, err := time.ParseDuration(session.Timeout)
+	if err != nil || timeout <= 0 {
+		errs = append(errs, prefix+".timeout must be a positive duration")
+	}
+	// The first prompt also waits for the shell and the command to start, which a
+	// timeout sized for the replies does not cover under load.
+	if session.StartTimeout == "" && err == nil {
+		session.StartTimeout = max(timeout, defaultSessionTimeout).String()
+	}
+	if d, err := time.ParseDuration(session.StartTimeout); session.StartTimeout != "" && (err != nil || d <= 0) {
+		errs = append(errs, prefix+".start_timeout must be a positive duration")
+	}
+	if len(session.Steps) == 0 {
+		errs = append(errs, prefix+".steps must not be empty")
+	}
+	for j, step := range session.Steps {
+		if _, err := regexp.Compile(step.Expect); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.steps[%d].expect: %v", prefix, j, err))
+		}
+	}
+	for _, feature := range []struct {
+		name string
+		set  bool
+	}{
+		{"background", st.Background},
+		{"duration", st.Duration != ""},
+		{"become", st.Become},
+		{"pipe_from", st.PipeFrom != ""},
+		{"type build", st.Type == "build"},
+	} {
+		if feature.set {
+			errs = append(errs, fmt.Sprintf("%s cannot be used with %s", prefix, feature.name))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SourceFetchTimeout bounds fetching a remote config.
+const SourceFetchTimeout = 30 * time.Second
+
+// sourceChecksumPrefix pins the content of a remote config, as in
+// "https://example.com/bench.yaml#sha256=<hex>".
+const sourceChecksumPrefix = "#sha256="
+
+// IsRemoteSource reports whether source names a config fetched over HTTP(S) or
+// from a git repository rather than a local file.
+func IsRemoteSource(source string) bool {
+	_, _, _, ok := gitSource(source)
+	return ok || strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// ReadSource reads the config named by source and returns it with its SHA-256
+// checksum. Besides a local path, source may be an HTTP(S) URL or a file in a git
+// repository, written <repository>//<path>[@<ref>] as in
+// "github.com/org/repo//bench/api.yaml@v1.2"; repositories without a scheme are
+// cloned over HTTPS, and ref defaults to HEAD.
+//
+// Remote configs are cached below $BENCHCTL_CACHE_DIR, or the user cache
+// directory. A source pinned with "#sha256=<hex>" is read from the cache while the
+// cached copy has that checksum, and fails when the fetched content differs. An
+// unpinned source is fetched every time.
+func ReadSource(ctx context.Context, source string) ([]byte, string, error) {
+	if !IsRemoteSource(source) {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, checksum(data), nil
+	}
+
+	location, pinned, _ := strings.Cut(source, sourceChecksumPrefix)
+	pinned = strings.ToLower(pinned)
+	cachePath, err := sourceCachePath(location)
+	if err != nil {
+		return nil, "", err
+	}
+	if pinned != "" {
+		if data, err := os.ReadFile(cachePath); err == nil && checksum(data) == pinned {
+			return data, pinned, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, SourceFetchTimeout)
+	defer cancel()
+	var data []byte
+	if repository, path, ref, ok := gitSource(location); ok {
+		data, err = fetchGitSource(ctx, repository, path, ref)
+	} else {
+		data, err = fetchHTTPSource(ctx, location)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch %s: %w", location, err)
+	}
+	sum := checksum(data)
+	if pinned != "" && sum != pinned {
+		return nil, "", fmt.Errorf("fetch %s: checksum mismatch: got sha256 %s, want %s", location, sum, pinned)
+	}
+	if err := writeSourceCache(cachePath, data); err != nil {
+		return nil, "", err
+	}
+	return data, sum, nil
+}
+
+// gitSource splits a git source into its repository URL, file path, and ref.
+func gitSource(source string) (repository, path, ref string, ok bool) {
+	source, _, _ = strings.Cut(source, sourceChecksumPrefix)
+	scheme, rest, hasScheme := strings.Cut(source, "://")
+	if !hasScheme {
+		// Without a scheme the repository starts with a host name, like github.com.
+		host, _, _ := strings.Cut(source, "/")
+		if !strings.Contains(host, ".") || strings.HasPrefix(source, ".") {
+			return "", "", "", false
+		}
+		if _, err := os.Stat(source); err == nil {
+			return "", "", "", false
+		}
+		scheme, rest = "https", source
+	}
+	repo, file, found := strings.Cut(rest, "//")
+	if !found || repo == "" || file == "" {
+		return "", "", "", false
+	}
+	ref = "HEAD"
+	if i := strings.LastIndex(file, "@"); i >= 0 {
+		file, ref = file[:i], file[i+1:]
+	}
+	if file == "" || ref == "" {
+		return "", "", "", false
+	}
+	return scheme + "://" + repo, file, ref, true
+}
+
+// fetchGitSource reads path at ref of repository through a shallow fetch, without
+// checking out the repository.
+func fetchGitSource(ctx context.Context, repository, path, ref string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "benchctl-config-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	var data []byte
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", repository, ref},
+		{"show", "FETCH_HEAD:" + path},
+	} {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		data = out
+	}
+	return data, nil
+}
+
+func fetchHTTPSource(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// sourceCachePath returns the cache file of a remote config location.
+func sourceCachePath(location string) (string, error) {
+	dir := os.Getenv("BENCHCTL_CACHE_DIR")
+	if dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("config cache: %w", err)
+		}
+		dir = filepath.Join(userCache, "benchctl")
+	}
+	return filepath.Join(dir, "configs", checksum([]byte(location))+".yaml"), nil
+}
+
+// writeSourceCache replaces the cached copy of a config, so concurrent readers
+// never see a partial file.
+func writeSourceCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("config cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*")
+	if err != nil {
+		return fmt.Errorf("config cache: %w", err)
+	}
+	_, err = tmp.Write(data)
+	err = errors.Join(err, tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("config cache: %w", err)
+	}
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,101 @@
+//go:build unit
+
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sourceYAML = "benchmark:\n  name: shared\n  output_dir: ./results\n"
+
+func TestReadSourceFetchesAndPinsURLs(t *testing.T) {
+	t.Setenv("BENCHCTL_CACHE_DIR", t.TempDir())
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/bench.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(sourceYAML))
+	}))
+	defer server.Close()
+
+	url := server.URL + "/bench.yaml"
+	data, sum, err := ReadSource(context.Background(), url)
+	if err != nil || string(data) != sourceYAML {
+		t.Fatalf("ReadSource(%s) = %q, %v", url, data, err)
+	}
+	if sum != checksum([]byte(sourceYAML)) {
+		t.Fatalf("unexpected checksum %s", sum)
+	}
+
+	// A pinned source is served from the cache.
+	if _, _, err := ReadSource(context.Background(), url+"#sha256="+sum); err != nil {
+		t.Fatalf("ReadSource pinned: %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("expected the pinned source to be read from the cache, got %d requests", requests)
+	}
+
+	wrong := strings.Repeat("0", 64)
+	if _, _, err := ReadSource(context.Background(), url+"#sha256="+wrong); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if _, _, err := ReadSource(context.Background(), server.URL+"/missing.yaml"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected the status of a missing config, got %v", err)
+	}
+}
+
+func TestReadSourceReadsGitReferences(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("BENCHCTL_CACHE_DIR", t.TempDir())
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, "bench"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "bench", "api.yaml"), []byte(sourceYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "bench"},
+		{"tag", "v1.2"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	for _, source := range []string{"file://" + repo + "//bench/api.yaml@v1.2", "file://" + repo + "//bench/api.yaml"} {
+		data, _, err := ReadSource(context.Background(), source)
+		if err != nil || string(data) != sourceYAML {
+			t.Fatalf("ReadSource(%s) = %q, %v", source, data, err)
+		}
+	}
+	if _, _, err := ReadSource(context.Background(), "file://"+repo+"//bench/missing.yaml@v1.2"); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	repository, path, ref, ok := gitSource("github.com/org/repo//bench/api.yaml@v1.2#sha256=abc")
+	if !ok || repository != "https://github.com/org/repo" || path != "bench/api.yaml" || ref != "v1.2" {
+		t.Fatalf("gitSource = %q %q %q %v", repository, path, ref, ok)
+	}
+	for _, source := range []string{"benchmark.yaml", "./configs//bench.yaml", "https://example.com/bench.yaml"} {
+		if _, _, _, ok := gitSource(source); ok {
+			t.Fatalf("expected %s not to be a git source", source)
+		}
+	}
+}
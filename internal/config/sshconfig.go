@@ -0,0 +1,204 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SSHConfigPath is the OpenSSH client config read for ssh_alias hosts and
+// proxy_jump hops.
+var SSHConfigPath = "~/.ssh/config"
+
+// sshConfigKeys are the ssh_config keywords read into a Host, lowercased.
+var sshConfigKeys = []string{"hostname", "user", "port", "identityfile", "proxyjump"}
+
+// LookupSSHHost returns the connection settings that the OpenSSH client config at
+// SSHConfigPath gives alias: HostName, User, Port, IdentityFile, and ProxyJump. As
+// in ssh, the first value obtained for a keyword wins, and the address is alias
+// itself when no HostName applies. A missing config yields just the address.
+//
+// Host blocks with * and ? patterns and ! negation, and Include directives, are
+// supported. Match blocks are skipped.
+func LookupSSHHost(alias string) (Host, error) {
+	values := map[string]string{}
+	if err := readSSHConfig(expandHome(SSHConfigPath), alias, values, 0); err != nil {
+		return Host{}, err
+	}
+	host := Host{
+		IP:        strings.ReplaceAll(values["hostname"], "%h", alias),
+		Username:  values["user"],
+		KeyFile:   values["identityfile"],
+		ProxyJump: values["proxyjump"],
+	}
+	if host.IP == "" {
+		host.IP = alias
+	}
+	if host.KeyFile != "" {
+		host.KeyFile = expandSSHTokens(host.KeyFile, alias, host)
+	}
+	if strings.EqualFold(host.ProxyJump, "none") {
+		host.ProxyJump = ""
+	}
+	if port := values["port"]; port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 || n > 65535 {
+			return Host{}, fmt.Errorf("ssh config: host %s: invalid Port %q", alias, port)
+		}
+		host.Port = n
+	}
+	return host, nil
+}
+
+func readSSHConfig(file, alias string, values map[string]string, depth int) error {
+	if depth > 8 {
+		return fmt.Errorf("ssh config %s: Include nested too deeply", file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) && depth == 0 {
+			return nil
+		}
+		return fmt.Errorf("ssh config: %w", err)
+	}
+	defer f.Close()
+	matches := true
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		keyword, args := splitSSHConfigLine(scanner.Text())
+		switch keyword {
+		case "":
+			continue
+		case "host":
+			matches = sshHostMatches(alias, args)
+		case "match":
+			matches = false
+		case "include":
+			if !matches {
+				continue
+			}
+			for _, pattern := range args {
+				pattern = expandHome(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(expandHome("~/.ssh"), pattern)
+				}
+				included, _ := filepath.Glob(pattern)
+				for _, name := range included {
+					if err := readSSHConfig(name, alias, values, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			if !matches || len(args) == 0 {
+				continue
+			}
+			if _, ok := values[keyword]; !ok && slices.Contains(sshConfigKeys, keyword) {
+				values[keyword] = strings.Join(args, " ")
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("ssh config %s: %w", file, err)
+	}
+	return nil
+}
+
+// splitSSHConfigLine returns the lowercased keyword and the arguments of a config
+// line, which separates them with whitespace or a single =.
+func splitSSHConfigLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+	var args []string
+	for rest != "" {
+		if rest[0] == '"' {
+			value, remainder, _ := strings.Cut(rest[1:], `"`)
+			args = append(args, value)
+			rest = strings.TrimSpace(remainder)
+			continue
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		args = append(args, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+	return keyword, args
+}
+
+// sshHostMatches reports whether alias matches a Host line: any pattern matches
+// and no negated pattern does.
+func sshHostMatches(alias string, patterns []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		ok, _ := path.Match(strings.TrimPrefix(pattern, "!"), alias)
+		if ok && negated {
+			return false
+		}
+		matched = matched || ok && !negated
+	}
+	return matched
+}
+
+// expandSSHTokens expands the %d, %h, %n, %r, %u, and %% tokens of an IdentityFile.
+func expandSSHTokens(value, alias string, host Host) string {
+	home, _ := os.UserHomeDir()
+	local := os.Getenv("USER")
+	user := host.Username
+	if user == "" {
+		user = local
+	}
+	return strings.NewReplacer("%%", "%", "%d", home, "%h", host.IP, "%n", alias, "%r", user, "%u", local).Replace(value)
+}
+
+// resolveSSHAliases fills the connection settings of hosts with an ssh_alias from
+// the SSH config. Settings given in the config take precedence, so resolution is
+// idempotent.
+func resolveSSHAliases(cfg *Config) []string {
+	var errs []string
+	for _, alias := range slices.Sorted(maps.Keys(cfg.Hosts)) {
+		host := cfg.Hosts[alias]
+		if strings.TrimSpace(host.SSHAlias) == "" {
+			continue
+		}
+		resolved, err := LookupSSHHost(host.SSHAlias)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("hosts.%s.ssh_alias: %v", alias, err))
+			continue
+		}
+		if host.IP == "" {
+			host.IP = resolved.IP
+		}
+		if host.Port == 0 {
+			host.Port = resolved.Port
+		}
+		if host.Username == "" {
+			host.Username = resolved.Username
+		}
+		if host.KeyFile == "" {
+			host.KeyFile = resolved.KeyFile
+		}
+		if host.ProxyJump == "" {
+			host.ProxyJump = resolved.ProxyJump
+		}
+		cfg.Hosts[alias] = host
+	}
+	return errs
+}
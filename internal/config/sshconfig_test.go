@@ -0,0 +1,91 @@
+//go:build unit
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSSHConfig(t *testing.T, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original := SSHConfigPath
+	SSHConfigPath = path
+	t.Cleanup(func() { SSHConfigPath = original })
+}
+
+func TestLookupSSHHost(t *testing.T) {
+	dir := t.TempDir()
+	included := filepath.Join(dir, "lab.conf")
+	if err := os.WriteFile(included, []byte("Host lab-*\n  User lab\n  ProxyJump bastion\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeSSHConfig(t, `
+Host lab-direct
+  ProxyJump none
+
+Host mybox
+  HostName 10.0.0.5
+  Port=2222
+  IdentityFile "~/.ssh/my box"
+
+Host lab-* !lab-direct
+  HostName %h.lab.internal
+
+Host *
+  Include `+included+`
+  User default
+  IdentityFile ~/.ssh/id_ed25519
+
+Match user root
+  User ignored
+`)
+	for _, tt := range []struct {
+		alias string
+		want  Host
+	}{
+		{"mybox", Host{IP: "10.0.0.5", Port: 2222, Username: "default", KeyFile: "~/.ssh/my box"}},
+		{"lab-1", Host{IP: "lab-1.lab.internal", Username: "lab", KeyFile: "~/.ssh/id_ed25519", ProxyJump: "bastion"}},
+		{"lab-direct", Host{IP: "lab-direct", Username: "lab", KeyFile: "~/.ssh/id_ed25519"}},
+		{"other", Host{IP: "other", Username: "default", KeyFile: "~/.ssh/id_ed25519"}},
+	} {
+		got, err := LookupSSHHost(tt.alias)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.alias, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s = %+v, want %+v", tt.alias, got, tt.want)
+		}
+	}
+}
+
+func TestSSHAliasFillsUnsetHostFields(t *testing.T) {
+	writeSSHConfig(t, "Host mybox\n  HostName 10.0.0.5\n  User bench\n  Port 2222\n  IdentityFile ~/.ssh/bench\n")
+	yaml := `
+benchmark:
+  name: ssh-alias
+  output_dir: ./results
+hosts:
+  box:
+    ssh_alias: mybox
+    username: override
+stages:
+  - name: run
+    host: box
+    command: ./run
+`
+	cfg, err := ParseYAML([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Host{IP: "10.0.0.5", Port: 2222, Username: "override", KeyFile: "~/.ssh/bench", SSHAlias: "mybox"}
+	if got := cfg.Hosts["box"]; got != want {
+		t.Fatalf("hosts.box = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TerraformHosts imports hosts from the outputs of a Terraform configuration.
+//
+// Each entry of Hosts names the output holding the address of a host alias. An
+// output holding a string is one host. A list output becomes the hosts
+// <alias>-1, <alias>-2, ..., and a map output the hosts <alias>-<key>; both also
+// define the host group <alias> of those hosts.
+type TerraformHosts struct {
+	// Dir is the Terraform working directory to run terraform output -json in.
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	// File is a saved terraform output -json, read instead of running terraform.
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+	// Hosts maps host aliases to output names.
+	Hosts map[string]string `yaml:"hosts" json:"hosts"`
+	// Connection settings of the imported hosts.
+	Port     int    `yaml:"port,omitempty" json:"port,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+}
+
+// terraformOutput is one output of terraform output -json.
+type terraformOutput struct {
+	Sensitive bool            `json:"sensitive"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// readTerraformOutputs returns the outputs of terraform output -json, run in tf.Dir
+// or read from tf.File.
+func readTerraformOutputs(tf *TerraformHosts) (map[string]terraformOutput, error) {
+	var data []byte
+	if tf.File != "" {
+		var err error
+		if data, err = os.ReadFile(expandHome(tf.File)); err != nil {
+			return nil, err
+		}
+	} else {
+		var stderr bytes.Buffer
+		cmd := exec.Command("terraform", "-chdir="+expandHome(tf.Dir), "output", "-json")
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("terraform output: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		data = out
+	}
+	var outputs map[string]terraformOutput
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, fmt.Errorf("parse terraform outputs: %w", err)
+	}
+	return outputs, nil
+}
+
+// terraformAddresses returns the addresses an output holds, keyed by host alias,
+// and the group of those hosts when the output holds a list or a map.
+func terraformAddresses(alias string, value json.RawMessage) (map[string]string, []string, error) {
+	var address string
+	if err := json.Unmarshal(value, &address); err == nil {
+		return map[string]string{alias: address}, nil, nil
+	}
+	var list []string
+	if err := json.Unmarshal(value, &list); err == nil {
+		hosts := make(map[string]string, len(list))
+		group := make([]string, 0, len(list))
+		for i, address := range list {
+			member := alias + "-" + strconv.Itoa(i+1)
+			hosts[member] = address
+			group = append(group, member)
+		}
+		return hosts, group, nil
+	}
+	var named map[string]string
+	if err := json.Unmarshal(value, &named); err == nil {
+		hosts := make(map[string]string, len(named))
+		var group []string
+		for _, key := range slices.Sorted(maps.Keys(named)) {
+			member := alias + "-" + key
+			hosts[member] = named[key]
+			group = append(group, member)
+		}
+		return hosts, group, nil
+	}
+	return nil, nil, fmt.Errorf("value must be a string, a list of strings, or a map of strings")
+}
+
+// importTerraformHosts adds the hosts and host groups of hosts_from_terraform to
+// cfg. Hosts and groups defined in the config keep their definition.
+func importTerraformHosts(cfg *Config) []string {
+	tf := cfg.HostsFromTerraform
+	if tf == nil {
+		return nil
+	}
+	var errs []string
+	if (strings.TrimSpace(tf.Dir) == "") == (strings.TrimSpace(tf.File) == "") {
+		errs = append(errs, "hosts_from_terraform must set exactly one of dir or file")
+	}
+	if len(tf.Hosts) == 0 {
+		errs = append(errs, "hosts_from_terraform.hosts must map at least one host alias to an output")
+	}
+	errs = append(errs, validateSecretRef("hosts_from_terraform.key_file", tf.KeyFile)...)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	outputs, err := readTerraformOutputs(tf)
+	if err != nil {
+		return []string{fmt.Sprintf("hosts_from_terraform: %v", err)}
+	}
+	for _, alias := range slices.Sorted(maps.Keys(tf.Hosts)) {
+		name := tf.Hosts[alias]
+		output, ok := outputs[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("hosts_from_terraform.hosts.%s: terraform output %q does not exist", alias, name))
+			continue
+		}
+		addresses, group, err := terraformAddresses(alias, output.Value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("hosts_from_terraform.hosts.%s: output %s: %v", alias, name, err))
+			continue
+		}
+		if cfg.Hosts == nil {
+			cfg.Hosts = map[string]Host{}
+		}
+		for member, address := range addresses {
+			if _, ok := cfg.Hosts[member]; !ok {
+				cfg.Hosts[member] = Host{IP: address, Port: tf.Port, Username: tf.Username, KeyFile: tf.KeyFile}
+			}
+		}
+		if group == nil {
+			continue
+		}
+		if cfg.HostGroups == nil {
+			cfg.HostGroups = map[string][]string{}
+		}
+		if _, ok := cfg.HostGroups[alias]; !ok {
+			cfg.HostGroups[alias] = group
+		}
+	}
+	return errs
+}
@@ -0,0 +1,72 @@
+//go:build unit
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHostsFromTerraform(t *testing.T) {
+	outputs := filepath.Join(t.TempDir(), "outputs.json")
+	if err := os.WriteFile(outputs, []byte(`{
+  "server_ip": {"sensitive": false, "type": "string", "value": "10.0.0.10"},
+  "worker_ips": {"sensitive": false, "type": ["list", "string"], "value": ["10.0.1.1", "10.0.1.2"]},
+  "zone_ips": {"sensitive": false, "type": ["map", "string"], "value": {"b": "10.0.2.2", "a": "10.0.2.1"}},
+  "db_password": {"sensitive": true, "type": "string", "value": "hunter2"}
+}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	yaml := `
+benchmark:
+  name: terraform
+  output_dir: ./results
+hosts:
+  server: {ip: 192.168.0.10, username: admin}
+hosts_from_terraform:
+  file: ` + outputs + `
+  username: ubuntu
+  key_file: ~/.ssh/bench
+  hosts:
+    server: server_ip
+    workers: worker_ips
+    zone: zone_ips
+stages:
+  - name: load
+    hosts: [workers, zone]
+    command: ./load
+  - name: serve
+    host: server
+    command: ./serve
+`
+	cfg, err := ParseYAML([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Hosts["server"]; got.IP != "192.168.0.10" || got.Username != "admin" {
+		t.Fatalf("server = %+v, want the config host", got)
+	}
+	want := Host{IP: "10.0.1.2", Username: "ubuntu", KeyFile: "~/.ssh/bench"}
+	if got := cfg.Hosts["workers-2"]; got != want {
+		t.Fatalf("workers-2 = %+v, want %+v", got, want)
+	}
+	if got := cfg.Hosts["zone-a"].IP; got != "10.0.2.1" {
+		t.Fatalf("zone-a ip = %q", got)
+	}
+	if got := cfg.Stages[0].Hosts; !slices.Equal(got, []string{"workers-1", "workers-2", "zone-a", "zone-b"}) {
+		t.Fatalf("stage hosts = %v", got)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("imported config no longer validates: %v", err)
+	}
+
+	cfg.HostsFromTerraform.Hosts["db"] = "db_ip"
+	cfg.HostsFromTerraform.Hosts["secret"] = "db_password"
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), `terraform output "db_ip" does not exist`) {
+		t.Fatalf("error = %v, want a missing output", err)
+	}
+}
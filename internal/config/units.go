@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// unit is a unit of measurement: its dimension and its size in the base unit of
+// the dimension, which is seconds for time, bytes for sizes, and events per
+// second for rates.
+type unit struct {
+	dimension string
+	factor    float64
+}
+
+var units = map[string]unit{
+	"ns": {"time", 1e-9}, "us": {"time", 1e-6}, "µs": {"time", 1e-6}, "ms": {"time", 1e-3},
+	"s": {"time", 1}, "min": {"time", 60}, "h": {"time", 3600},
+	"B": {"size", 1}, "kB": {"size", 1e3}, "KB": {"size", 1e3}, "MB": {"size", 1e6}, "GB": {"size", 1e9},
+	"KiB": {"size", 1 << 10}, "MiB": {"size", 1 << 20}, "GiB": {"size", 1 << 30},
+	"rps": {"rate", 1}, "req/s": {"rate", 1}, "ops/s": {"rate", 1}, "/s": {"rate", 1},
+}
+
+// multipliers are the SI prefixes a count or a rate may carry, as in "10k rps".
+var multipliers = map[string]float64{"k": 1e3, "K": 1e3, "M": 1e6, "G": 1e9}
+
+// metricNameUnits maps the unit suffixes of metric names, such as _ms in
+// latency_p99_ms, to their units. Longer suffixes come first, so that _per_sec
+// is not taken for _sec.
+var metricNameUnits = []struct{ suffix, unit string }{
+	{"per_second", "rps"}, {"per_sec", "rps"}, {"seconds", "s"}, {"bytes", "B"},
+	{"rps", "rps"}, {"qps", "rps"}, {"sec", "s"}, {"kib", "KiB"}, {"mib", "MiB"}, {"gib", "GiB"},
+	{"ns", "ns"}, {"us", "us"}, {"ms", "ms"}, {"kb", "kB"}, {"mb", "MB"}, {"gb", "GB"}, {"s", "s"},
+}
+
+var quantityPattern = regexp.MustCompile(`^([+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?)\s*(.*)$`)
+
+// Quantity is a number with an optional unit, normalized to the base unit of
+// its dimension. Numbers without a unit have no dimension.
+type Quantity struct {
+	Value     float64
+	Dimension string
+}
+
+// ParseQuantity parses a number with an optional SI multiplier and unit, such
+// as "0.01", "250ms", "1.5 GiB", or "10k rps".
+func ParseQuantity(text string) (Quantity, error) {
+	match := quantityPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return Quantity{}, fmt.Errorf("%q is not a number", text)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return Quantity{}, fmt.Errorf("%q is not a number", text)
+	}
+	suffix := match[2]
+	if suffix == "" {
+		return Quantity{Value: value}, nil
+	}
+	if u, ok := units[suffix]; ok {
+		return Quantity{Value: value * u.factor, Dimension: u.dimension}, nil
+	}
+	prefix, rest := suffix[:1], strings.TrimSpace(suffix[1:])
+	multiplier, ok := multipliers[prefix]
+	if !ok {
+		return Quantity{}, fmt.Errorf("%q has an unknown unit %q", text, suffix)
+	}
+	if rest == "" {
+		return Quantity{Value: value * multiplier}, nil
+	}
+	if u, ok := units[rest]; ok && u.dimension == "rate" {
+		return Quantity{Value: value * multiplier * u.factor, Dimension: u.dimension}, nil
+	}
+	return Quantity{}, fmt.Errorf("%q has an unknown unit %q", text, suffix)
+}
+
+// metricNameUnit returns the unit named by the suffix of a metric name, such as
+// ms for latency_p99_ms or B for artifact_size_bytes. Label sets are ignored.
+func metricNameUnit(metric string) (unit, string, bool) {
+	name, _, _ := strings.Cut(metric, "{")
+	name = strings.ToLower(name)
+	for _, entry := range metricNameUnits {
+		if strings.HasSuffix(name, "_"+entry.suffix) || strings.HasSuffix(name, "."+entry.suffix) {
+			return units[entry.unit], entry.unit, true
+		}
+	}
+	return unit{}, "", false
+}
@@ -0,0 +1,73 @@
+//go:build unit
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		text      string
+		value     float64
+		dimension string
+	}{
+		{"0.01", 0.01, ""},
+		{"10k", 10000, ""},
+		{"250ms", 0.25, "time"},
+		{"1.5 s", 1.5, "time"},
+		{"2min", 120, "time"},
+		{"512MiB", 512 << 20, "size"},
+		{"10k rps", 10000, "rate"},
+		{"3M/s", 3e6, "rate"},
+	}
+	for _, tt := range tests {
+		got, err := ParseQuantity(tt.text)
+		if err != nil || got.Dimension != tt.dimension || got.Value != tt.value {
+			t.Errorf("ParseQuantity(%q) = %+v, %v, want %v %s", tt.text, got, err, tt.value, tt.dimension)
+		}
+	}
+	for _, text := range []string{"fast", "10 parsecs", "10kms"} {
+		if _, err := ParseQuantity(text); err == nil {
+			t.Errorf("ParseQuantity(%q) succeeded", text)
+		}
+	}
+}
+
+func TestExpectationMetricValue(t *testing.T) {
+	tests := []struct {
+		expr, raw string
+		holds     bool
+		err       string
+	}{
+		{expr: "latency_p99_ms < 250ms", raw: "180", holds: true},
+		{expr: "latency_p99_seconds < 250ms", raw: "0.3", holds: false},
+		{expr: "latency_p99 < 250ms", raw: "0.2s", holds: true},
+		{expr: "throughput > 10k rps", raw: "12000", holds: true},
+		{expr: "memory_bytes <= 1GiB", raw: "2.5e+07", holds: true},
+		{expr: "p99 < 250", raw: "180", holds: true},
+		{expr: "latency_p99 < 250ms", raw: "180", err: "has no unit"},
+		{expr: "p99 < 250", raw: "180ms", err: "has a unit"},
+		{expr: "latency < 1s", raw: "5MB", err: "cannot be compared"},
+	}
+	for _, tt := range tests {
+		expectation, err := ParseExpectation(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseExpectation(%q): %v", tt.expr, err)
+		}
+		value, err := expectation.MetricValue(tt.raw)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s with %s: expected error containing %q, got %v", tt.expr, tt.raw, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || expectation.Holds(value) != tt.holds {
+			t.Errorf("%s with %s: holds = %v, %v, want %v", tt.expr, tt.raw, expectation.Holds(value), err, tt.holds)
+		}
+	}
+	if _, err := ParseExpectation("latency_ms < 1GB"); err == nil || !strings.Contains(err.Error(), "recorded in ms") {
+		t.Errorf("expected a unit mismatch with the metric name, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// varPlaceholderPattern matches ${name}, and $${name}, which escapes it.
+var varPlaceholderPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ApplyVars replaces ${name} placeholders in every string of a YAML config with
+// the value of the variable name, before the config is decoded.
+//
+// Variables are declared in the vars section. An environment variable of the same
+// name overrides the declared value, and overrides (from --var) take precedence
+// over both and may introduce new variables. Placeholders naming anything else,
+// such as ${BENCHCTL_RUN_ID} or shell variables, are left for the stage shell, as
+// is $${name}, written as ${name}. A string that consists of a single placeholder
+// takes the type of the value, so "port: ${ssh_port}" decodes as a number. The
+// vars section is rewritten with the resolved values, so run metadata records
+// what the run used.
+func ApplyVars(data []byte, overrides map[string]string) ([]byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	root, ok := doc.(map[string]any)
+	if !ok {
+		return data, nil
+	}
+	declared, ok := root["vars"].(map[string]any)
+	if root["vars"] != nil && !ok {
+		return nil, fmt.Errorf("vars must be a mapping of names to values")
+	}
+	if len(declared) == 0 && len(overrides) == 0 && !bytes.Contains(data, []byte("$${")) {
+		return data, nil
+	}
+
+	vars := make(map[string]string, len(declared)+len(overrides))
+	for name, value := range declared {
+		if !parameterNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("vars.%s: name must be a valid environment variable name", name)
+		}
+		switch value.(type) {
+		case nil:
+			vars[name] = ""
+		case map[string]any, []any:
+			return nil, fmt.Errorf("vars.%s must be a scalar value", name)
+		default:
+			vars[name] = fmt.Sprint(value)
+		}
+		if env, ok := os.LookupEnv(name); ok {
+			vars[name] = env
+		}
+	}
+	for name, value := range overrides {
+		if !parameterNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("var %s: name must be a valid environment variable name", name)
+		}
+		vars[name] = value
+	}
+
+	lookup := func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+	for key, value := range root {
+		if key == "vars" {
+			continue
+		}
+		substituted, err := substituteVars(value, lookup)
+		if err != nil {
+			return nil, err
+		}
+		root[key] = substituted
+	}
+	if len(vars) > 0 {
+		resolved := make(map[string]any, len(vars))
+		for name, value := range vars {
+			resolved[name] = value
+		}
+		root["vars"] = resolved
+	}
+	return yaml.Marshal(root)
+}
+
+func substituteVars(node any, lookup func(string) (string, bool)) (any, error) {
+	switch value := node.(type) {
+	case string:
+		if match := varPlaceholderPattern.FindStringSubmatch(value); match != nil && match[0] == value && !strings.HasPrefix(value, "$$") {
+			if resolved, ok := lookup(match[1]); ok {
+				return overrideValue(resolved)
+			}
+		}
+		return varPlaceholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+			if escaped, ok := strings.CutPrefix(placeholder, "$"); ok && strings.HasPrefix(escaped, "$") {
+				return escaped
+			}
+			if resolved, ok := lookup(placeholder[2 : len(placeholder)-1]); ok {
+				return resolved
+			}
+			return placeholder
+		}), nil
+	case map[string]any:
+		for key, child := range value {
+			substituted, err := substituteVars(child, lookup)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = substituted
+		}
+	case []any:
+		for i, child := range value {
+			substituted, err := substituteVars(child, lookup)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = substituted
+		}
+	}
+	return node, nil
+}
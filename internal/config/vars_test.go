@@ -0,0 +1,118 @@
+//go:build unit
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyVars(t *testing.T) {
+	base := []byte(`vars:
+  target: 10.0.0.1
+  ssh_port: 2222
+  rate: 100
+benchmark:
+  name: bench-${target}
+  output_dir: ./results
+hosts:
+  vm1:
+    ip: ${target}
+    port: ${ssh_port}
+    username: bench
+    key_file: ~/.ssh/id
+stages:
+  - name: load
+    host: vm1
+    command: ./load --rate ${rate} --run "${BENCHCTL_RUN_ID}"
+`)
+
+	t.Run("declared values", func(t *testing.T) {
+		data, err := ApplyVars(base, nil)
+		if err != nil {
+			t.Fatalf("ApplyVars: %v", err)
+		}
+		cfg, err := ParseYAML(data)
+		if err != nil {
+			t.Fatalf("ParseYAML: %v\n%s", err, data)
+		}
+		if cfg.Benchmark.Name != "bench-10.0.0.1" || cfg.Hosts["vm1"].IP != "10.0.0.1" {
+			t.Fatalf("vars not substituted: name=%q ip=%q", cfg.Benchmark.Name, cfg.Hosts["vm1"].IP)
+		}
+		if cfg.Hosts["vm1"].Port != 2222 {
+			t.Fatalf("port = %d, want 2222", cfg.Hosts["vm1"].Port)
+		}
+		if cfg.Stages[0].Command != `./load --rate 100 --run "${BENCHCTL_RUN_ID}"` {
+			t.Fatalf("command = %q", cfg.Stages[0].Command)
+		}
+	})
+
+	t.Run("environment and overrides", func(t *testing.T) {
+		t.Setenv("rate", "500")
+		t.Setenv("target", "10.0.0.2")
+		data, err := ApplyVars(base, map[string]string{"target": "10.0.0.3"})
+		if err != nil {
+			t.Fatalf("ApplyVars: %v", err)
+		}
+		cfg, err := ParseYAML(data)
+		if err != nil {
+			t.Fatalf("ParseYAML: %v\n%s", err, data)
+		}
+		if cfg.Hosts["vm1"].IP != "10.0.0.3" {
+			t.Fatalf("override should win over environment, ip = %q", cfg.Hosts["vm1"].IP)
+		}
+		if !strings.Contains(cfg.Stages[0].Command, "--rate 500") {
+			t.Fatalf("environment should win over vars, command = %q", cfg.Stages[0].Command)
+		}
+		if cfg.Vars["target"] != "10.0.0.3" || cfg.Vars["rate"] != "500" {
+			t.Fatalf("vars not recorded as resolved: %v", cfg.Vars)
+		}
+	})
+
+	t.Run("undeclared placeholders and escapes", func(t *testing.T) {
+		t.Setenv("LOAD_THREADS", "8")
+		t.Setenv("HOME", "/home/controller")
+		t.Setenv("API_TOKEN", "s3cr3t")
+		data, err := ApplyVars([]byte(`benchmark:
+  name: env
+  output_dir: ./results
+stages:
+  - name: load
+    command: ./load --threads ${LOAD_THREADS} --data ${HOME}/data --token ${API_TOKEN} --literal $${LOAD_THREADS}
+`), nil)
+		if err != nil {
+			t.Fatalf("ApplyVars: %v", err)
+		}
+		cfg, err := ParseYAML(data)
+		if err != nil {
+			t.Fatalf("ParseYAML: %v\n%s", err, data)
+		}
+		// The stage shell expands them, with -e values and on the stage host.
+		if want := "./load --threads ${LOAD_THREADS} --data ${HOME}/data --token ${API_TOKEN} --literal ${LOAD_THREADS}"; cfg.Stages[0].Command != want {
+			t.Fatalf("command = %q, want %q", cfg.Stages[0].Command, want)
+		}
+		if len(cfg.Vars) != 0 {
+			t.Fatalf("expected no environment variables to be recorded, vars = %v", cfg.Vars)
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		yaml    string
+		vars    map[string]string
+		contain string
+	}{
+		{name: "invalid name", yaml: "vars:\n  bad-name: x\n", contain: "vars.bad-name"},
+		{name: "nested value", yaml: "vars:\n  list: [a, b]\n", contain: "vars.list must be a scalar"},
+		{name: "not a mapping", yaml: "vars: [a]\n", contain: "vars must be a mapping"},
+		{name: "invalid override", yaml: "benchmark: {}\n", vars: map[string]string{"1x": "y"}, contain: "var 1x"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ApplyVars([]byte(tt.yaml), tt.vars)
+			if err == nil || !strings.Contains(err.Error(), tt.contain) {
+				t.Fatalf("expected error containing %q, got %v", tt.contain, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Condition is a parsed stages[].when expression such as
+// "${ENABLE_PROFILING} == 'true' && $REGION != eu".
+//
+// Operands are ${NAME} or $NAME references, quoted strings, and bare words.
+// Operands compare as strings with == and !=, combine with &&, ||, and !, and
+// group with parentheses. An operand on its own holds unless it is empty, "false",
+// or "0".
+type Condition struct {
+	expr string
+	root conditionNode
+}
+
+type conditionNode interface {
+	holds(lookup func(string) (string, bool)) bool
+}
+
+type (
+	conditionOperand struct {
+		literal string
+		ref     string // variable name when the operand is a reference
+	}
+	conditionCompare struct {
+		left, right conditionOperand
+		equal       bool
+	}
+	conditionNot struct{ node conditionNode }
+	conditionAnd struct{ left, right conditionNode }
+	conditionOr  struct{ left, right conditionNode }
+)
+
+// ParseCondition parses a stages[].when expression.
+func ParseCondition(expr string) (Condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return Condition{}, fmt.Errorf("when %q: %w", expr, err)
+	}
+	if len(tokens) == 0 {
+		return Condition{}, fmt.Errorf("when %q: expression is empty", expr)
+	}
+	p := &conditionParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %s", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return Condition{}, fmt.Errorf("when %q: %w", expr, err)
+	}
+	return Condition{expr: expr, root: root}, nil
+}
+
+// Holds evaluates the condition, resolving references with lookup. Undefined
+// references are empty strings.
+func (c Condition) Holds(lookup func(name string) (string, bool)) bool {
+	return c.root.holds(lookup)
+}
+
+func (c Condition) String() string {
+	return c.expr
+}
+
+func (o conditionOperand) value(lookup func(string) (string, bool)) string {
+	if o.ref == "" {
+		return o.literal
+	}
+	value, _ := lookup(o.ref)
+	return value
+}
+
+func (o conditionOperand) holds(lookup func(string) (string, bool)) bool {
+	switch strings.ToLower(strings.TrimSpace(o.value(lookup))) {
+	case "", "false", "0":
+		return false
+	}
+	return true
+}
+
+func (c conditionCompare) holds(lookup func(string) (string, bool)) bool {
+	return (c.left.value(lookup) == c.right.value(lookup)) == c.equal
+}
+
+func (n conditionNot) holds(lookup func(string) (string, bool)) bool {
+	return !n.node.holds(lookup)
+}
+
+func (n conditionAnd) holds(lookup func(string) (string, bool)) bool {
+	return n.left.holds(lookup) && n.right.holds(lookup)
+}
+
+func (n conditionOr) holds(lookup func(string) (string, bool)) bool {
+	return n.left.holds(lookup) || n.right.holds(lookup)
+}
+
+type conditionToken struct {
+	kind    string // "operand" or the operator itself
+	text    string
+	operand conditionOperand
+}
+
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.HasPrefix(expr[i:], "&&"), strings.HasPrefix(expr[i:], "||"),
+			strings.HasPrefix(expr[i:], "=="), strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, conditionToken{kind: expr[i : i+2], text: expr[i : i+2]})
+			i += 2
+		case c == '!' || c == '(' || c == ')':
+			tokens = append(tokens, conditionToken{kind: string(c), text: string(c)})
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			literal := expr[i+1 : i+1+end]
+			tokens = append(tokens, conditionToken{kind: "operand", text: expr[i : i+end+2], operand: conditionOperand{literal: literal}})
+			i += end + 2
+		case c == '$':
+			name, length := conditionRef(expr[i:])
+			if name == "" {
+				return nil, fmt.Errorf("invalid reference at offset %d", i)
+			}
+			tokens = append(tokens, conditionToken{kind: "operand", text: expr[i : i+length], operand: conditionOperand{ref: name}})
+			i += length
+		default:
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\n!=&|()'\"$", rune(expr[i])) {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			tokens = append(tokens, conditionToken{kind: "operand", text: expr[start:i], operand: conditionOperand{literal: expr[start:i]}})
+		}
+	}
+	return tokens, nil
+}
+
+// conditionRef returns the variable name of a $NAME or ${NAME} reference at the
+// start of s and the length of the reference.
+func conditionRef(s string) (string, int) {
+	if rest, ok := strings.CutPrefix(s, "${"); ok {
+		end := strings.IndexByte(rest, '}')
+		if end < 0 || !parameterNamePattern.MatchString(rest[:end]) {
+			return "", 0
+		}
+		return rest[:end], end + 3
+	}
+	end := 1
+	for end < len(s) && (s[end] == '_' || s[end] >= 'A' && s[end] <= 'Z' || s[end] >= 'a' && s[end] <= 'z' || end > 1 && s[end] >= '0' && s[end] <= '9') {
+		end++
+	}
+	if end == 1 {
+		return "", 0
+	}
+	return s[1:end], end
+}
+
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+func (p *conditionParser) next(kind string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.next("||") {
+		var right conditionNode
+		right, err = p.parseAnd()
+		left = conditionOr{left, right}
+	}
+	return left, err
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.next("&&") {
+		var right conditionNode
+		right, err = p.parseUnary()
+		left = conditionAnd{left, right}
+	}
+	return left, err
+}
+
+func (p *conditionParser) parseUnary() (conditionNode, error) {
+	if p.next("!") {
+		node, err := p.parseUnary()
+		return conditionNot{node}, err
+	}
+	if p.next("(") {
+		node, err := p.parseOr()
+		if err == nil && !p.next(")") {
+			err = fmt.Errorf("missing )")
+		}
+		return node, err
+	}
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!="} {
+		if p.next(op) {
+			right, err := p.operand()
+			return conditionCompare{left: left, right: right, equal: op == "=="}, err
+		}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) operand() (conditionOperand, error) {
+	if p.pos >= len(p.tokens) {
+		return conditionOperand{}, fmt.Errorf("unexpected end of expression")
+	}
+	token := p.tokens[p.pos]
+	if token.kind != "operand" {
+		return conditionOperand{}, fmt.Errorf("unexpected %s", token.text)
+	}
+	p.pos++
+	return token.operand, nil
+}
@@ -0,0 +1,67 @@
+//go:build unit
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCondition(t *testing.T) {
+	vars := map[string]string{"PROFILE": "true", "REGION": "eu-west-1", "EMPTY": "", "MODE": "fast mode"}
+	lookup := func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"${PROFILE} == 'true'", true},
+		{"$PROFILE != true", false},
+		{"$REGION == eu-west-1", true},
+		{`"${MODE}" == 'x' || $MODE == "fast mode"`, true},
+		{"$PROFILE && $REGION == us-east-1", false},
+		{"!($PROFILE && $REGION == us-east-1)", true},
+		{"$EMPTY", false},
+		{"$MISSING == ''", true},
+		{"0", false},
+		{"False", false},
+		{"$PROFILE && ($EMPTY || $REGION != x)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			condition, err := ParseCondition(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCondition: %v", err)
+			}
+			if got := condition.Holds(lookup); got != tt.want {
+				t.Fatalf("Holds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		contain string
+	}{
+		{"", "expression is empty"},
+		{"$A ==", "unexpected end of expression"},
+		{"'open", "unterminated string"},
+		{"($A", "missing )"},
+		{"$A = b", `unexpected '='`},
+		{"$A b", "unexpected b"},
+		{"${1A} == x", "invalid reference"},
+		{"&& $A", "unexpected &&"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCondition(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.contain) {
+				t.Fatalf("expected error containing %q, got %v", tt.contain, err)
+			}
+		})
+	}
+}
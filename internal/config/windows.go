@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// validateWindowsHosts checks the settings of windows hosts and rejects the
+// stage features that rely on a POSIX shell on the hosts they run on.
+func validateWindowsHosts(cfg *Config) []string {
+	var errs []string
+	windows := map[string]bool{}
+	for _, alias := range slices.Sorted(maps.Keys(cfg.Hosts)) {
+		host := cfg.Hosts[alias]
+		switch host.OS {
+		case "", "linux":
+			continue
+		case "windows":
+		default:
+			errs = append(errs, fmt.Sprintf("hosts.%s.os must be one of [linux, windows]", alias))
+			continue
+		}
+		windows[alias] = true
+		if strings.TrimSpace(host.IP) == "" || host.Type != "" {
+			errs = append(errs, fmt.Sprintf("hosts.%s: windows hosts are reached over SSH and need an ip or ssh_alias", alias))
+		}
+		if shell := strings.TrimSpace(host.Shell); shell != "" && shell != "powershell" && shell != "pwsh" {
+			errs = append(errs, fmt.Sprintf("hosts.%s.shell must be powershell or pwsh on a windows host", alias))
+		}
+	}
+	if len(windows) == 0 {
+		return errs
+	}
+
+	onWindows := func(hosts []string) string {
+		for _, alias := range hosts {
+			if windows[alias] {
+				return alias
+			}
+		}
+		return ""
+	}
+	var stageHosts []string
+	for i, st := range cfg.Stages {
+		hosts := itemHosts(st.Host, st.Hosts)
+		stageHosts = append(stageHosts, hosts...)
+		alias := onWindows(hosts)
+		if alias == "" {
+			continue
+		}
+		var unsupported []string
+		for _, feature := range []struct {
+			name string
+			set  bool
+		}{
+			{"background", st.Background},
+			{"duration", st.Duration != ""},
+			{"become", st.Become},
+			{"shell", st.Shell != ""},
+			{"runtime", st.Runtime != ""},
+			{"netem", st.Netem != nil},
+			{"chaos", len(st.Chaos) > 0},
+			{"artifact.image", st.Artifact != nil && st.Artifact.Image != ""},
+			{"artifact.startup", st.Artifact != nil && st.Artifact.Startup != nil},
+			{"failure_logs", len(st.FailureLogs) > 0},
+			{"session", st.Session != nil},
+		} {
+			if feature.set {
+				unsupported = append(unsupported, feature.name)
+			}
+		}
+		if len(unsupported) > 0 {
+			errs = append(errs, fmt.Sprintf("stages[%d]: %s not supported on windows host %s", i, strings.Join(unsupported, ", "), alias))
+		}
+		if st.Script != "" && !strings.HasSuffix(strings.ToLower(st.Script), ".ps1") {
+			errs = append(errs, fmt.Sprintf("stages[%d].script must be a .ps1 script on windows host %s", i, alias))
+		}
+		for j, output := range st.Outputs {
+			if output.Compress != "" || output.CleanupRemote || strings.ContainsAny(output.RemotePath, "*?[") {
+				errs = append(errs, fmt.Sprintf("stages[%d].outputs[%d]: compress, cleanup_remote, and remote_path patterns are not supported on windows host %s", i, j, alias))
+			}
+			// The age of an output is checked with date and stat, which windows
+			// hosts lack, so their outputs are never checked.
+			if output.OnStale != "" && output.OnStale != "ignore" {
+				errs = append(errs, fmt.Sprintf("stages[%d].outputs[%d].on_stale is not supported on windows host %s", i, j, alias))
+			}
+			cfg.Stages[i].Outputs[j].OnStale = "ignore"
+		}
+	}
+	for i, step := range cfg.Cleanup {
+		alias := onWindows(itemHosts(step.Host, step.Hosts))
+		if alias == "" {
+			continue
+		}
+		if step.Shell != "" {
+			errs = append(errs, fmt.Sprintf("cleanup[%d].shell is not supported on windows host %s", i, alias))
+		}
+		if step.Script != "" && !strings.HasSuffix(strings.ToLower(step.Script), ".ps1") {
+			errs = append(errs, fmt.Sprintf("cleanup[%d].script must be a .ps1 script on windows host %s", i, alias))
+		}
+	}
+	for i, hook := range cfg.Benchmark.Reset {
+		if windows[hook.Host] {
+			errs = append(errs, fmt.Sprintf("benchmark.reset[%d]: reset hooks are not supported on windows host %s", i, hook.Host))
+		}
+	}
+	if alias := onWindows(stageHosts); alias != "" {
+		if cfg.Benchmark.Capabilities != nil {
+			errs = append(errs, fmt.Sprintf("benchmark.capabilities is not supported on windows host %s", alias))
+		}
+		if len(cfg.Benchmark.CaptureVersions) > 0 {
+			errs = append(errs, fmt.Sprintf("benchmark.capture_versions is not supported on windows host %s", alias))
+		}
+	}
+	if cooldown := cfg.Benchmark.Cooldown; cooldown != nil && (cooldown.MaxLoad > 0 || cooldown.MaxTempC > 0) {
+		guards := cooldown.Hosts
+		if len(guards) == 0 {
+			guards = slices.Sorted(maps.Keys(cfg.Hosts))
+		}
+		if alias := onWindows(guards); alias != "" {
+			errs = append(errs, fmt.Sprintf("benchmark.cooldown: max_load and max_temp_c are not supported on windows host %s", alias))
+		}
+	}
+	return errs
+}
+
+// itemHosts returns the hosts a stage or cleanup step runs on.
+func itemHosts(host string, hosts []string) []string {
+	if len(hosts) > 0 {
+		return hosts
+	}
+	if host != "" {
+		return []string{host}
+	}
+	return []string{"local"}
+}
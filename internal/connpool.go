@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// connectionPool shares one SSH connection per host among the commands of a run,
+// so stages, output collection, health checks, and PID polling open sessions on
+// it instead of connecting again, which costs a handshake each time and trips
+// MaxStartups of sshd when stages run concurrently.
+type connectionPool struct {
+	mu    sync.Mutex
+	conns map[string]*pooledConnection
+}
+
+type pooledConnection struct {
+	mu     sync.Mutex
+	client execution.ExecutionClient
+}
+
+// sharedClient is a pooled client whose Close leaves the connection open for
+// the rest of the run.
+type sharedClient struct {
+	execution.ExecutionClient
+}
+
+func (sharedClient) Close() error { return nil }
+
+type connectionPoolKey struct{}
+
+// withConnectionPool returns a context whose SSH connections are shared until
+// the returned func closes them.
+func withConnectionPool(ctx context.Context) (context.Context, func()) {
+	pool := &connectionPool{conns: map[string]*pooledConnection{}}
+	return context.WithValue(ctx, connectionPoolKey{}, pool), pool.close
+}
+
+// client returns the pooled connection to host, connecting when the host has
+// none yet or its connection no longer answers, e.g. after a chaos reboot.
+func (p *connectionPool) client(ctx context.Context, host config.Host) (execution.ExecutionClient, error) {
+	key := connectionKey(host)
+	p.mu.Lock()
+	conn, ok := p.conns[key]
+	if !ok {
+		conn = &pooledConnection{}
+		p.conns[key] = conn
+	}
+	p.mu.Unlock()
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	logger := runLogger(ctx)
+	if conn.client != nil {
+		if execution.Alive(conn.client) {
+			if logger != nil {
+				logger.Debug("ssh connection reused", "host", host.IP)
+			}
+			return sharedClient{conn.client}, nil
+		}
+		if logger != nil {
+			logger.Debug("ssh connection lost, reconnecting", "host", host.IP)
+		}
+		_ = conn.client.Close()
+		conn.client = nil
+	}
+	client, err := execution.DialSSH(host, logger)
+	if err != nil {
+		return nil, err
+	}
+	conn.client = client
+	return sharedClient{client}, nil
+}
+
+// connectionKey identifies the connection to host by everything that goes into
+// dialing it, so hosts with the same address but other credentials or SSH options
+// do not share a connection. The settings are hashed to keep the secrets out of
+// the pool.
+func connectionKey(host config.Host) string {
+	settings, _ := json.Marshal(config.Host{
+		IP:          host.IP,
+		Port:        host.Port,
+		Username:    host.Username,
+		Password:    host.Password,
+		KeyFile:     host.KeyFile,
+		KeyPassword: host.KeyPassword,
+		SSHAlias:    host.SSHAlias,
+		ProxyJump:   host.ProxyJump,
+		SSH:         host.SSH,
+	})
+	sum := sha256.Sum256(settings)
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *connectionPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, conn := range p.conns {
+		conn.mu.Lock()
+		if conn.client != nil {
+			_ = conn.client.Close()
+		}
+		conn.mu.Unlock()
+		delete(p.conns, key)
+	}
+}
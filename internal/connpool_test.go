@@ -0,0 +1,170 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConnectionPoolSharesConnectionPerHost(t *testing.T) {
+	server := startExecServer(t)
+	host := config.Host{IP: "127.0.0.1", Port: server.port, Username: "bench", Password: "secret"}
+	ctx, closeConnections := withConnectionPool(context.Background())
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := openExecutionClient(ctx, host)
+			if err != nil {
+				t.Errorf("openExecutionClient: %v", err)
+				return
+			}
+			defer client.Close()
+			for range 4 {
+				if _, err := client.RunCommand(ctx, execution.CommandRequest{Command: "kill -0 1"}); err != nil {
+					t.Errorf("RunCommand: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := server.connections.Load(); got != 1 {
+		t.Fatalf("expected one connection for 20 commands, got %d", got)
+	}
+	if got := server.commands.Load(); got != 20 {
+		t.Fatalf("commands = %d", got)
+	}
+
+	server.dropConnections()
+	client, err := openExecutionClient(ctx, host)
+	if err != nil {
+		t.Fatalf("openExecutionClient after the connection was lost: %v", err)
+	}
+	if _, err := client.RunCommand(ctx, execution.CommandRequest{Command: "true"}); err != nil {
+		t.Fatalf("RunCommand after reconnecting: %v", err)
+	}
+	if got := server.connections.Load(); got != 2 {
+		t.Fatalf("expected a reconnect, got %d connections", got)
+	}
+	closeConnections()
+}
+
+func TestConnectionPoolKeepsHostSettingsApart(t *testing.T) {
+	server := startExecServer(t)
+	host := config.Host{IP: "127.0.0.1", Port: server.port, Username: "bench", Password: "secret"}
+	ctx, closeConnections := withConnectionPool(context.Background())
+	defer closeConnections()
+
+	otherPassword := host
+	otherPassword.Password = "other"
+	otherOptions := host
+	otherOptions.SSH = &config.SSHOptions{Ciphers: []string{"aes128-ctr"}}
+	for _, h := range []config.Host{host, host, otherPassword, otherOptions} {
+		client, err := openExecutionClient(ctx, h)
+		if err != nil {
+			t.Fatalf("openExecutionClient: %v", err)
+		}
+		if _, err := client.RunCommand(ctx, execution.CommandRequest{Command: "true"}); err != nil {
+			t.Fatalf("RunCommand: %v", err)
+		}
+	}
+	if got := server.connections.Load(); got != 3 {
+		t.Fatalf("expected a connection per password and SSH options, got %d", got)
+	}
+}
+
+type execServer struct {
+	port        int
+	connections atomic.Int32
+	commands    atomic.Int32
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// startExecServer starts an SSH server accepting any password on which every
+// command succeeds without output.
+func startExecServer(t *testing.T) *execServer {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) { return nil, nil },
+	}
+	serverConfig.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &execServer{port: listener.Addr().(*net.TCPAddr).Port}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.connections.Add(1)
+			server.mu.Lock()
+			server.conns = append(server.conns, conn)
+			server.mu.Unlock()
+			go server.serve(conn, serverConfig)
+		}
+	}()
+	return server
+}
+
+func (s *execServer) serve(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	defer conn.Close()
+	_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for request := range channelRequests {
+				if request.Type != "exec" {
+					_ = request.Reply(false, nil)
+					continue
+				}
+				s.commands.Add(1)
+				_ = request.Reply(true, nil)
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				_ = channel.Close()
+			}
+		}()
+	}
+}
+
+func (s *execServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// CooldownRecord describes the wait before one case started.
+type CooldownRecord struct {
+	BeforeCase      string         `json:"before_case"`
+	StartedAt       time.Time      `json:"started_at"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Readings        []GuardReading `json:"readings,omitempty"` // last readings, once all guards passed
+}
+
+// GuardReading is one steady-state measurement of a host.
+type GuardReading struct {
+	Host  string   `json:"host"`
+	Load1 *float64 `json:"load1,omitempty"`
+	TempC *float64 `json:"temp_c,omitempty"`
+}
+
+// coolDown sleeps for the configured period and then polls the guard hosts until
+// their load average and temperature are below the configured limits.
+func coolDown(ctx context.Context, cfg *config.Config, benchmarkCase config.Case, logger *slog.Logger) (*CooldownRecord, error) {
+	cooldown := cfg.Benchmark.Cooldown
+	clock := clockFrom(ctx)
+	record := &CooldownRecord{BeforeCase: benchmarkCase.Name, StartedAt: clock.Now()}
+	defer func() {
+		record.DurationSeconds = clock.Now().Sub(record.StartedAt).Seconds()
+	}()
+
+	period, _ := time.ParseDuration(cooldown.Period)
+	if period > 0 {
+		logger.Info("cooling down", "case", benchmarkCase.Name, "period", period)
+		if err := sleepContext(ctx, period); err != nil {
+			return record, err
+		}
+	}
+	if cooldown.MaxLoad == 0 && cooldown.MaxTempC == 0 {
+		return record, nil
+	}
+
+	timeout, _ := time.ParseDuration(cooldown.Timeout)
+	interval, _ := time.ParseDuration(cooldown.Interval)
+	deadline := clock.Now().Add(timeout)
+	for {
+		readings, pending, err := readGuards(ctx, cfg, cooldown)
+		if err != nil {
+			return record, err
+		}
+		if len(pending) == 0 {
+			record.Readings = readings
+			logger.Info("steady state reached", "case", benchmarkCase.Name)
+			return record, nil
+		}
+		if clock.Now().After(deadline) {
+			record.Readings = readings
+			return record, fmt.Errorf("cooldown before case %s: guards not satisfied after %s: %s", benchmarkCase.Name, timeout, strings.Join(pending, ", "))
+		}
+		logger.Info("waiting for steady state", "case", benchmarkCase.Name, "pending", strings.Join(pending, ", "))
+		if err := sleepContext(ctx, interval); err != nil {
+			return record, err
+		}
+	}
+}
+
+// readGuards measures every guard host and describes each limit that is still exceeded.
+func readGuards(ctx context.Context, cfg *config.Config, cooldown *config.Cooldown) ([]GuardReading, []string, error) {
+	var readings []GuardReading
+	var pending []string
+	for _, hostAlias := range cooldownHosts(cfg) {
+		client, err := openExecutionClient(ctx, cfg.Hosts[hostAlias])
+		if err != nil {
+			return nil, nil, fmt.Errorf("cooldown: host %s: %w", hostAlias, err)
+		}
+		reading := GuardReading{Host: hostAlias}
+		if cooldown.MaxLoad > 0 {
+			load, err := readLoadAverage(ctx, client)
+			if err != nil {
+				_ = client.Close()
+				return nil, nil, fmt.Errorf("cooldown: host %s: %w", hostAlias, err)
+			}
+			reading.Load1 = &load
+			if load > cooldown.MaxLoad {
+				pending = append(pending, fmt.Sprintf("%s load %.2f > %.2f", hostAlias, load, cooldown.MaxLoad))
+			}
+		}
+		if cooldown.MaxTempC > 0 {
+			temp, err := readMaxTemperature(ctx, client)
+			if err != nil {
+				_ = client.Close()
+				return nil, nil, fmt.Errorf("cooldown: host %s: %w", hostAlias, err)
+			}
+			reading.TempC = &temp
+			if temp > cooldown.MaxTempC {
+				pending = append(pending, fmt.Sprintf("%s temperature %.1fC > %.1fC", hostAlias, temp, cooldown.MaxTempC))
+			}
+		}
+		_ = client.Close()
+		readings = append(readings, reading)
+	}
+	return readings, pending, nil
+}
+
+// cooldownHosts returns the configured guard hosts. When none are listed the
+// guards wait on every host of the config, or on the local host without hosts.
+func cooldownHosts(cfg *config.Config) []string {
+	if len(cfg.Benchmark.Cooldown.Hosts) > 0 {
+		return cfg.Benchmark.Cooldown.Hosts
+	}
+	if len(cfg.Hosts) == 0 {
+		return []string{"local"}
+	}
+	hosts := make([]string, 0, len(cfg.Hosts))
+	for alias := range cfg.Hosts {
+		hosts = append(hosts, alias)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func readLoadAverage(ctx context.Context, client execution.ExecutionClient) (float64, error) {
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: "cat /proc/loadavg"})
+	if err != nil || result.ExitCode != 0 {
+		return 0, fmt.Errorf("read /proc/loadavg: %s", strings.TrimSpace(result.Output))
+	}
+	fields := strings.Fields(result.Output)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("read /proc/loadavg: empty output")
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse load average %q: %w", fields[0], err)
+	}
+	return load, nil
+}
+
+// readMaxTemperature returns the hottest thermal zone in degrees Celsius.
+func readMaxTemperature(ctx context.Context, client execution.ExecutionClient) (float64, error) {
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: "cat /sys/class/thermal/thermal_zone*/temp 2>/dev/null"})
+	if err != nil {
+		return 0, fmt.Errorf("read thermal zones: %w", err)
+	}
+	var hottest *float64
+	for _, line := range strings.Fields(result.Output) {
+		milli, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			continue
+		}
+		temp := milli / 1000
+		if hottest == nil || temp > *hottest {
+			hottest = &temp
+		}
+	}
+	if hottest == nil {
+		return 0, fmt.Errorf("no thermal zones found under /sys/class/thermal")
+	}
+	return *hottest, nil
+}
@@ -0,0 +1,42 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestExecuteStagesCoolsDownBetweenCases(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{
+			Name:      "cooldown",
+			OutputDir: tempDir,
+			Cooldown:  &config.Cooldown{Period: "10ms", MaxLoad: 100000, Timeout: "1s", Interval: "10ms"},
+		},
+		Cases:  []config.Case{{Name: "first"}, {Name: "second"}, {Name: "third"}},
+		Stages: []config.Stage{{Name: "noop", Command: "true"}},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metadata := &RunMetadata{RunID: "1"}
+	if err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+
+	if len(metadata.Cooldowns) != 2 {
+		t.Fatalf("expected a cooldown before every case after the first, got %+v", metadata.Cooldowns)
+	}
+	record := metadata.Cooldowns[0]
+	if record.BeforeCase != "second" || record.DurationSeconds < 0.01 {
+		t.Fatalf("unexpected cooldown record: %+v", record)
+	}
+	if len(record.Readings) != 1 || record.Readings[0].Host != "local" || record.Readings[0].Load1 == nil {
+		t.Fatalf("expected a load reading of the local host, got %+v", record.Readings)
+	}
+}
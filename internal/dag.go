@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// runCaseStages runs the stages of one case. Without depends_on the stages run one
+// after another in config order, the stages of a parallel group together; once any
+// stage declares dependencies, every stage starts as soon as the stages it depends
+// on have completed, which for a stage without depends_on is the stage before it.
+//
+// run returns an error only when the run has to stop. In a parallel group or a
+// dependency graph the first such error cancels the stages still running and keeps
+// the others from starting.
+func runCaseStages(
+	ctx context.Context,
+	stages []config.Stage,
+	benchmarkCase config.Case,
+	logger *slog.Logger,
+	run func(ctx context.Context, i int, stage config.Stage) error,
+) error {
+	if !config.DependencyGraph(stages) {
+		for i := 0; i < len(stages); {
+			end := i + 1
+			for stages[i].Parallel != "" && end < len(stages) && stages[end].Parallel == stages[i].Parallel {
+				end++
+			}
+			if end == i+1 {
+				if err := run(ctx, i, stages[i]); err != nil {
+					return err
+				}
+			} else if err := runParallelGroup(ctx, i, stages[i:end], benchmarkCase, logger, run); err != nil {
+				return err
+			}
+			i = end
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	dependencies := config.StageDependencies(stages)
+	done := make(map[string]chan struct{}, len(stages))
+	for _, stage := range stages {
+		done[stage.Name] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var stopErr error
+	for i, stage := range stages {
+		wg.Go(func() {
+			defer close(done[stage.Name])
+			for _, dependency := range dependencies[i] {
+				select {
+				case <-done[dependency]:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if len(stage.DependsOn) > 0 {
+				logger.Info("stage dependencies completed", "stage", stage.Name, "case", benchmarkCase.Name, "depends_on", stage.DependsOn)
+			}
+			if err := run(ctx, i, stage); err != nil {
+				mu.Lock()
+				if stopErr == nil {
+					stopErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	return stopErr
+}
+
+// runParallelGroup starts the stages of a parallel group, the first of which is
+// stages[first] of the case, together and waits for all of them.
+func runParallelGroup(
+	ctx context.Context,
+	first int,
+	group []config.Stage,
+	benchmarkCase config.Case,
+	logger *slog.Logger,
+	run func(ctx context.Context, i int, stage config.Stage) error,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	names := make([]string, len(group))
+	for j, stage := range group {
+		names[j] = stage.Name
+	}
+	logger.Info("parallel group started", "group", group[0].Parallel, "case", benchmarkCase.Name, "stages", names)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var stopErr error
+	for j, stage := range group {
+		wg.Go(func() {
+			if err := run(ctx, first+j, stage); err != nil {
+				mu.Lock()
+				if stopErr == nil {
+					stopErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	if stopErr == nil {
+		logger.Info("parallel group completed", "group", group[0].Parallel, "case", benchmarkCase.Name)
+	}
+	return stopErr
+}
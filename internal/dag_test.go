@@ -0,0 +1,135 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestExecuteStagesRunsIndependentStagesConcurrently(t *testing.T) {
+	tempDir := t.TempDir()
+	// Each setup stage only succeeds if the other one runs at the same time.
+	waitFor := func(self, other string) string {
+		return "touch '" + filepath.Join(tempDir, self) + "'; for i in $(seq 100); do [ -f '" +
+			filepath.Join(tempDir, other) + "' ] && exit 0; sleep 0.05; done; exit 1"
+	}
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "dag", OutputDir: tempDir, Shell: "sh -c"},
+		Stages: []config.Stage{
+			{Name: "setup-a", Command: waitFor("a", "b")},
+			{Name: "setup-b", DependsOn: config.StageNames{}, Command: waitFor("b", "a")},
+			{Name: "load", DependsOn: []string{"setup-a", "setup-b"}, Command: "touch '" + filepath.Join(tempDir, "load") + "'"},
+		},
+	}
+	metadata := &RunMetadata{RunID: "1", Custom: map[string]string{}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "load")); err != nil {
+		t.Fatalf("expected the dependent stage to run: %v", err)
+	}
+}
+
+func TestExecuteStagesStopsDependentsOfFailedStage(t *testing.T) {
+	tempDir := t.TempDir()
+	marker := filepath.Join(tempDir, "load")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "dag", OutputDir: tempDir, Shell: "sh -c"},
+		Stages: []config.Stage{
+			{Name: "setup", Command: "exit 3"},
+			{Name: "load", DependsOn: []string{"setup"}, Command: "touch '" + marker + "'"},
+		},
+	}
+	metadata := &RunMetadata{RunID: "1", Custom: map[string]string{}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil)
+	if stageErrs := stageErrors(err); len(stageErrs) != 1 || stageErrs[0].Name != "setup" {
+		t.Fatalf("expected the setup failure, got %v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("expected the dependent stage not to run, stat error: %v", err)
+	}
+}
+
+func TestExecuteStagesRunsParallelGroupTogether(t *testing.T) {
+	tempDir := t.TempDir()
+	waitFor := func(self, other string) string {
+		return "touch '" + filepath.Join(tempDir, self) + "'; for i in $(seq 100); do [ -f '" +
+			filepath.Join(tempDir, other) + "' ] && exit 0; sleep 0.05; done; exit 1"
+	}
+	// The report stage only succeeds once both load stages have completed.
+	report := "[ -f '" + filepath.Join(tempDir, "a-done") + "' ] && [ -f '" + filepath.Join(tempDir, "b-done") + "' ]"
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "parallel", OutputDir: tempDir, Shell: "sh -c"},
+		Stages: []config.Stage{
+			{Name: "load-a", Parallel: "load", Command: "(" + waitFor("a", "b") + ") && sleep 0.2 && touch '" + filepath.Join(tempDir, "a-done") + "'"},
+			{Name: "load-b", Parallel: "load", Command: "(" + waitFor("b", "a") + ") && touch '" + filepath.Join(tempDir, "b-done") + "'"},
+			{Name: "report", Command: report},
+		},
+	}
+	metadata := &RunMetadata{RunID: "1", Custom: map[string]string{}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+}
+
+func TestExecuteStagesStopsParallelGroupOnFailure(t *testing.T) {
+	tempDir := t.TempDir()
+	marker := filepath.Join(tempDir, "report")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "parallel", OutputDir: tempDir, Shell: "sh -c"},
+		Stages: []config.Stage{
+			{Name: "load-a", Parallel: "load", Command: "exit 3"},
+			{Name: "load-b", Parallel: "load", Command: "sleep 30"},
+			{Name: "report", Command: "touch '" + marker + "'"},
+		},
+	}
+	metadata := &RunMetadata{RunID: "1", Custom: map[string]string{}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	started := time.Now()
+	err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil)
+	if stageErrs := stageErrors(err); len(stageErrs) == 0 || stageErrs[0].Name != "load-a" {
+		t.Fatalf("expected the load-a failure, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("expected load-b to be stopped, the stages took %s", elapsed)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("expected the stage after the group not to run, stat error: %v", err)
+	}
+}
+
+func TestExecuteStagesKeepsImplicitOrderInDependencyGraph(t *testing.T) {
+	tempDir := t.TempDir()
+	prepared := filepath.Join(tempDir, "prepared")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "dag", OutputDir: tempDir, Shell: "sh -c"},
+		Stages: []config.Stage{
+			{Name: "prepare", Command: "sleep 0.3 && touch '" + prepared + "'"},
+			// check has no depends_on, so it waits for prepare before it.
+			{Name: "check", Command: "[ -f '" + prepared + "' ]"},
+			// side starts right away, which makes the stages a dependency graph.
+			{Name: "side", DependsOn: config.StageNames{}, Command: "[ ! -f '" + prepared + "' ]"},
+		},
+	}
+	metadata := &RunMetadata{RunID: "1", Custom: map[string]string{}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+}
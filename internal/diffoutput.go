@@ -0,0 +1,398 @@
+package internal
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// outputDiffBins is the number of equal-width buckets numeric columns are split into.
+const outputDiffBins = 10
+
+// OutputDiff compares the same named CSV output of two runs.
+type OutputDiff struct {
+	Output  string       `json:"output"`
+	RowsA   int          `json:"rows_a"`
+	RowsB   int          `json:"rows_b"`
+	Columns []ColumnDiff `json:"columns"`
+	OnlyInA []string     `json:"only_in_a,omitempty"`
+	OnlyInB []string     `json:"only_in_b,omitempty"`
+}
+
+// ColumnDiff compares the values of one column present in both outputs.
+type ColumnDiff struct {
+	Column  string `json:"column"`
+	Numeric bool   `json:"numeric"`
+	// Summaries, the t-test p-value, and the Kolmogorov-Smirnov distance (the largest
+	// gap between the two empirical CDFs, 0 to 1) are set for numeric columns only.
+	A       *ColumnSummary `json:"a,omitempty"`
+	B       *ColumnSummary `json:"b,omitempty"`
+	PValue  *float64       `json:"p_value,omitempty"`
+	KS      *float64       `json:"ks,omitempty"`
+	Buckets []BucketChange `json:"buckets"` // largest changes in the share of rows first
+}
+
+// ColumnSummary describes the distribution of a numeric column.
+type ColumnSummary struct {
+	Sample
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+}
+
+// BucketChange is the share of rows falling into one value range (numeric columns)
+// or having one value (other columns) in each run.
+type BucketChange struct {
+	Bucket string  `json:"bucket"`
+	ShareA float64 `json:"share_a"`
+	ShareB float64 `json:"share_b"`
+}
+
+// DiffOutput compares the CSV output named output in the run directories runA and
+// runB, keeping the topK most changed buckets of every column.
+func DiffOutput(runA, runB, output string, topK int) (*OutputDiff, error) {
+	storeA, runIDA := localRun(runA)
+	storeB, runIDB := localRun(runB)
+	return diffOutput(context.Background(), storeA, runIDA, storeB, runIDB, output, topK)
+}
+
+// DiffStoredOutput compares the CSV output named output of two stored runs.
+func DiffStoredOutput(ctx context.Context, store ResultStore, runA, runB, output string, topK int) (*OutputDiff, error) {
+	return diffOutput(ctx, store, runA, store, runB, output, topK)
+}
+
+func diffOutput(ctx context.Context, storeA ResultStore, runA string, storeB ResultStore, runB, output string, topK int) (*OutputDiff, error) {
+	headerA, rowsA, err := readOutputCSV(ctx, storeA, runA, output)
+	if err != nil {
+		return nil, err
+	}
+	headerB, rowsB, err := readOutputCSV(ctx, storeB, runB, output)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &OutputDiff{Output: output, RowsA: len(rowsA), RowsB: len(rowsB)}
+	for i, column := range headerA {
+		j := slices.Index(headerB, column)
+		if j < 0 {
+			diff.OnlyInA = append(diff.OnlyInA, column)
+			continue
+		}
+		diff.Columns = append(diff.Columns, diffColumn(column, columnValues(rowsA, i), columnValues(rowsB, j), topK))
+	}
+	for _, column := range headerB {
+		if !slices.Contains(headerA, column) {
+			diff.OnlyInB = append(diff.OnlyInB, column)
+		}
+	}
+	return diff, nil
+}
+
+func diffColumn(column string, cellsA, cellsB []string, topK int) ColumnDiff {
+	diff := ColumnDiff{Column: column}
+	valuesA, okA := numericCells(cellsA)
+	valuesB, okB := numericCells(cellsB)
+	if !okA || !okB {
+		diff.Buckets = topBucketChanges(valueShares(cellsA), valueShares(cellsB), topK)
+		return diff
+	}
+
+	diff.Numeric = true
+	slices.Sort(valuesA)
+	slices.Sort(valuesB)
+	diff.A = summarizeColumn(valuesA)
+	diff.B = summarizeColumn(valuesB)
+	if p, ok := welchTTest(diff.A.Sample, diff.B.Sample); ok {
+		diff.PValue = &p
+	}
+	if len(valuesA) > 0 && len(valuesB) > 0 {
+		ks := ksDistance(valuesA, valuesB)
+		diff.KS = &ks
+	}
+	sharesA, sharesB := binShares(valuesA, valuesB)
+	diff.Buckets = topBucketChanges(sharesA, sharesB, topK)
+	return diff
+}
+
+func summarizeColumn(sorted []float64) *ColumnSummary {
+	return &ColumnSummary{Sample: summarize(sorted), P50: quantile(sorted, 0.5), P95: quantile(sorted, 0.95)}
+}
+
+// quantile interpolates linearly between the closest ranks of sorted.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+// ksDistance returns the two-sample Kolmogorov-Smirnov statistic of sorted a and b.
+func ksDistance(a, b []float64) float64 {
+	var i, j int
+	var distance float64
+	for i < len(a) && j < len(b) {
+		value := math.Min(a[i], b[j])
+		for i < len(a) && a[i] == value {
+			i++
+		}
+		for j < len(b) && b[j] == value {
+			j++
+		}
+		gap := math.Abs(float64(i)/float64(len(a)) - float64(j)/float64(len(b)))
+		distance = math.Max(distance, gap)
+	}
+	return distance
+}
+
+// binShares splits the combined value range into equal-width buckets and returns
+// the share of each run's values per bucket.
+func binShares(a, b []float64) (map[string]float64, map[string]float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, values := range [][]float64{a, b} {
+		if len(values) > 0 {
+			low = math.Min(low, values[0])
+			high = math.Max(high, values[len(values)-1])
+		}
+	}
+	width := (high - low) / outputDiffBins
+	shares := func(values []float64) map[string]float64 {
+		out := map[string]float64{}
+		for _, value := range values {
+			bin := 0
+			if width > 0 {
+				bin = min(int((value-low)/width), outputDiffBins-1)
+			}
+			start := low + float64(bin)*width
+			label := fmt.Sprintf("[%.4g, %.4g)", start, start+width)
+			if width == 0 {
+				label = strconv.FormatFloat(low, 'g', -1, 64)
+			} else if bin == outputDiffBins-1 {
+				label = fmt.Sprintf("[%.4g, %.4g]", start, high)
+			}
+			out[label] += 1 / float64(len(values))
+		}
+		return out
+	}
+	return shares(a), shares(b)
+}
+
+func valueShares(cells []string) map[string]float64 {
+	shares := map[string]float64{}
+	for _, cell := range cells {
+		shares[cell] += 1 / float64(len(cells))
+	}
+	return shares
+}
+
+// topBucketChanges returns the topK buckets with the largest absolute share change.
+func topBucketChanges(a, b map[string]float64, topK int) []BucketChange {
+	changes := make([]BucketChange, 0, len(a)+len(b))
+	for bucket, share := range a {
+		changes = append(changes, BucketChange{Bucket: bucket, ShareA: share, ShareB: b[bucket]})
+	}
+	for bucket, share := range b {
+		if _, ok := a[bucket]; !ok {
+			changes = append(changes, BucketChange{Bucket: bucket, ShareB: share})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		di := math.Abs(changes[i].ShareB - changes[i].ShareA)
+		dj := math.Abs(changes[j].ShareB - changes[j].ShareA)
+		if di != dj {
+			return di > dj
+		}
+		return changes[i].Bucket < changes[j].Bucket
+	})
+	if topK >= 0 && len(changes) > topK {
+		changes = changes[:topK]
+	}
+	return changes
+}
+
+// numericCells parses every non-empty cell; ok is false if any cell is not a number.
+func numericCells(cells []string) ([]float64, bool) {
+	values := make([]float64, 0, len(cells))
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+		if err != nil {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+func columnValues(rows [][]string, index int) []string {
+	values := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if index < len(row) {
+			values = append(values, row[index])
+		}
+	}
+	return values
+}
+
+// readOutputCSV reads the collected CSV output named output of a stored run, with
+// the rows of every non-warmup trial of a run with trials.
+func readOutputCSV(ctx context.Context, store ResultStore, runID, output string) ([]string, [][]string, error) {
+	files, err := outputCSVFiles(ctx, store, runID, output)
+	if err != nil {
+		return nil, nil, fmt.Errorf("output %s: %w", output, err)
+	}
+	var header []string
+	var rows [][]string
+	for _, name := range files {
+		fileHeader, fileRows, err := readCSVArtifact(ctx, store, runID, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("output %s: %w", output, err)
+		}
+		if header != nil && fileHeader != nil && !slices.Equal(header, fileHeader) {
+			return nil, nil, fmt.Errorf("output %s: %s has other columns than %s", output, name, files[0])
+		}
+		if header == nil {
+			header = fileHeader
+		}
+		rows = append(rows, fileRows...)
+	}
+	return header, rows, nil
+}
+
+// outputCSVFiles resolves output through the outputs the run recorded: an output
+// name, the name of one file of a wildcard output, or a stored file name with or
+// without .csv. An exact match wins over the files of a wildcard output, and a
+// name matching several files, such as an output of several cases, is an error.
+// Runs without a record of their outputs are read from <output>.csv.
+func outputCSVFiles(ctx context.Context, store ResultStore, runID, output string) ([]string, error) {
+	fallback := []string{strings.TrimSuffix(output, ".csv") + ".csv"}
+	metadata, err := store.LoadMetadata(ctx, runID)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fallback, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Analysis == nil {
+		return fallback, nil
+	}
+	var exact, prefixed []string
+	for _, input := range metadata.Analysis.Inputs {
+		file := trimCompressionSuffix(input.File)
+		if input.Output == "" || path.Ext(file) != ".csv" {
+			continue
+		}
+		switch {
+		case input.Output == output || file == output || file == fallback[0]:
+			if !slices.Contains(exact, input.File) {
+				exact = append(exact, input.File)
+			}
+		case strings.HasPrefix(input.Output, output+"."):
+			if !slices.Contains(prefixed, input.File) {
+				prefixed = append(prefixed, input.File)
+			}
+		}
+	}
+	matches := exact
+	if len(matches) == 0 {
+		matches = prefixed
+	}
+	switch len(matches) {
+	case 0:
+		return fallback, nil
+	case 1:
+	default:
+		return nil, fmt.Errorf("matches the files %s; name one of them", strings.Join(matches, ", "))
+	}
+	if len(metadata.Trials) == 0 {
+		return matches, nil
+	}
+	var files []string
+	for _, trial := range metadata.Trials {
+		if !trial.Warmup {
+			files = append(files, path.Join(filepath.ToSlash(trial.Dir), matches[0]))
+		}
+	}
+	return files, nil
+}
+
+// readCSVArtifact reads the header and rows of the stored CSV file name, which may
+// be compressed.
+func readCSVArtifact(ctx context.Context, store ResultStore, runID, name string) ([]string, [][]string, error) {
+	path := trimCompressionSuffix(name)
+	file, err := openOutputArtifact(ctx, store, runID, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return header, rows, nil
+}
+
+// FormatOutputDiff renders an output diff as aligned tables.
+func FormatOutputDiff(diff *OutputDiff) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "output %s: %d rows -> %d rows", diff.Output, diff.RowsA, diff.RowsB)
+	if diff.RowsA > 0 {
+		fmt.Fprintf(&out, " (%+.1f%%)", float64(diff.RowsB-diff.RowsA)/float64(diff.RowsA)*100)
+	}
+	out.WriteString("\n")
+	if len(diff.OnlyInA) > 0 {
+		fmt.Fprintf(&out, "columns only in first run: %s\n", strings.Join(diff.OnlyInA, ", "))
+	}
+	if len(diff.OnlyInB) > 0 {
+		fmt.Fprintf(&out, "columns only in second run: %s\n", strings.Join(diff.OnlyInB, ", "))
+	}
+
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	for _, column := range diff.Columns {
+		fmt.Fprintf(w, "\n%s", column.Column)
+		if column.Numeric {
+			p, ks := "-", "-"
+			if column.PValue != nil {
+				p = fmt.Sprintf("%.3f", *column.PValue)
+			}
+			if column.KS != nil {
+				ks = fmt.Sprintf("%.3f", *column.KS)
+			}
+			fmt.Fprintf(w, "\tmean\tp50\tp95\tn\n")
+			fmt.Fprintf(w, "  first\t%.4g\t%.4g\t%.4g\t%d\n", column.A.Mean, column.A.P50, column.A.P95, column.A.N)
+			fmt.Fprintf(w, "  second\t%.4g\t%.4g\t%.4g\t%d\n", column.B.Mean, column.B.P50, column.B.P95, column.B.N)
+			fmt.Fprintf(w, "  p=%s ks=%s\n", p, ks)
+		} else {
+			fmt.Fprintf(w, "\n")
+		}
+		for _, bucket := range column.Buckets {
+			fmt.Fprintf(w, "  %s\t%.1f%%\t->\t%.1f%%\n", bucket.Bucket, bucket.ShareA*100, bucket.ShareB*100)
+		}
+	}
+	_ = w.Flush()
+	return out.String()
+}
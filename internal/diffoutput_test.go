@@ -0,0 +1,138 @@
+//go:build unit
+
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffOutput(t *testing.T) {
+	runA, runB := t.TempDir(), t.TempDir()
+	writeCSV := func(dir, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "latency.csv"), []byte(content), 0644); err != nil {
+			t.Fatalf("write csv: %v", err)
+		}
+	}
+	writeCSV(runA, "latency_ms,status,host\n1,200,a\n2,200,a\n3,200,a\n4,500,a\n")
+	writeCSV(runB, "latency_ms,status,region\n11,200,eu\n12,500,eu\n13,500,eu\n14,500,eu\n15,500,eu\n")
+
+	diff, err := DiffOutput(runA, runB, "latency", 1)
+	if err != nil {
+		t.Fatalf("DiffOutput: %v", err)
+	}
+	if diff.RowsA != 4 || diff.RowsB != 5 {
+		t.Fatalf("rows = %d -> %d", diff.RowsA, diff.RowsB)
+	}
+	if len(diff.OnlyInA) != 1 || diff.OnlyInA[0] != "host" || len(diff.OnlyInB) != 1 || diff.OnlyInB[0] != "region" {
+		t.Fatalf("unexpected column sets: %v %v", diff.OnlyInA, diff.OnlyInB)
+	}
+
+	latency := diff.Columns[0]
+	if !latency.Numeric || latency.KS == nil || *latency.KS != 1 {
+		t.Fatalf("expected disjoint distributions to have KS distance 1, got %+v", latency)
+	}
+	if latency.A.P50 != 2.5 || latency.B.P50 != 13 {
+		t.Fatalf("p50 = %v -> %v", latency.A.P50, latency.B.P50)
+	}
+	if len(latency.Buckets) != 1 {
+		t.Fatalf("expected top-1 bucket, got %v", latency.Buckets)
+	}
+
+	status := diff.Columns[1]
+	// Both buckets change by 55 points; ties are ordered by bucket.
+	if len(status.Buckets) != 1 || status.Buckets[0].Bucket != "[200, 230)" ||
+		math.Abs(status.Buckets[0].ShareA-0.75) > 1e-9 || math.Abs(status.Buckets[0].ShareB-0.2) > 1e-9 {
+		t.Fatalf("unexpected status buckets: %+v", status.Buckets)
+	}
+
+	out := FormatOutputDiff(diff)
+	for _, want := range []string{"output latency: 4 rows -> 5 rows (+25.0%)", "columns only in first run: host", "ks=1.000"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestDiffOutputCategoricalColumn(t *testing.T) {
+	runA, runB := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(runA, "codes.csv"), []byte("code\nok\nok\nerr\n"), 0644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(runB, "codes.csv"), []byte("code\nok\ntimeout\n"), 0644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	diff, err := DiffOutput(runA, runB, "codes.csv", 5)
+	if err != nil {
+		t.Fatalf("DiffOutput: %v", err)
+	}
+	column := diff.Columns[0]
+	if column.Numeric || len(column.Buckets) != 3 || column.Buckets[0].Bucket != "timeout" {
+		t.Fatalf("unexpected categorical diff: %+v", column)
+	}
+}
+
+func TestDiffOutputResolvesRecordedOutputs(t *testing.T) {
+	runA, runB := t.TempDir(), t.TempDir()
+	write := func(path string, content []byte) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gzipped := func(content string) []byte {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		_, _ = writer.Write([]byte(content))
+		_ = writer.Close()
+		return buf.Bytes()
+	}
+	// The first run stores the output compressed, once per trial.
+	write(filepath.Join(runA, "warmup-1", "large", "latency.csv.gz"), gzipped("latency_ms\n100\n"))
+	write(filepath.Join(runA, "trial-1", "large", "latency.csv.gz"), gzipped("latency_ms\n1\n2\n"))
+	write(filepath.Join(runA, "trial-2", "large", "latency.csv.gz"), gzipped("latency_ms\n3\n"))
+	input := AnalysisInput{Stage: "load", Output: "latency", File: "large/latency.csv.gz"}
+	if err := saveMetadata(&RunMetadata{
+		RunID:    "1",
+		Analysis: &Analysis{Inputs: []AnalysisInput{input, input, input}},
+		Trials: []TrialRecord{
+			{Trial: 1, Warmup: true, Dir: "warmup-1"},
+			{Trial: 1, Dir: "trial-1"},
+			{Trial: 2, Dir: "trial-2"},
+		},
+	}, runA); err != nil {
+		t.Fatal(err)
+	}
+	// The second run collected the output for two cases.
+	write(filepath.Join(runB, "small", "latency.csv"), []byte("latency_ms\n5\n"))
+	write(filepath.Join(runB, "large", "latency.csv"), []byte("latency_ms\n50\n"))
+	if err := saveMetadata(&RunMetadata{
+		RunID: "2",
+		Analysis: &Analysis{Inputs: []AnalysisInput{
+			{Stage: "load", Output: "latency", File: "small/latency.csv"},
+			{Stage: "load", Output: "latency", File: "large/latency.csv"},
+		}},
+	}, runB); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DiffOutput(runA, runB, "latency", 5); err == nil || !strings.Contains(err.Error(), "matches the files small/latency.csv, large/latency.csv") {
+		t.Fatalf("expected an ambiguous output error, got %v", err)
+	}
+	diff, err := DiffOutput(runA, runB, "large/latency", 5)
+	if err != nil {
+		t.Fatalf("DiffOutput: %v", err)
+	}
+	if diff.RowsA != 3 || diff.RowsB != 1 || diff.Columns[0].B.Mean != 50 {
+		t.Fatalf("expected the trial rows of the first run and the large case of the second, got %+v", diff)
+	}
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// StageEnvironment returns the variables a stage on hostAlias receives in the
+// first case of a validated config, built like a run builds them. An empty runID
+// stands for the ID the next run would get, whose directory is not created, and
+// an empty hostAlias for the local host. Detected host capabilities are not
+// included, since detection needs a run.
+func StageEnvironment(cfg *config.Config, runID, hostAlias string, envVars map[string]string) (map[string]string, error) {
+	if runID == "" {
+		next, err := nextRunID(cfg.Benchmark.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+		runID = next
+	} else if info, err := os.Stat(filepath.Join(cfg.Benchmark.OutputDir, runID)); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("run %s not found in %s", runID, cfg.Benchmark.OutputDir)
+	}
+	if hostAlias == "" {
+		hostAlias = "local"
+	}
+	if _, ok := cfg.Hosts[hostAlias]; !ok && hostAlias != "local" {
+		return nil, fmt.Errorf("unknown host %s", hostAlias)
+	}
+	runDir := filepath.Join(cfg.Benchmark.OutputDir, runID)
+	return buildStageEnv(runID, runDir, cfg, envVars, workflowCases(cfg)[0], hostAlias), nil
+}
+
+// nextRunID returns the ID generateRunID would pick next, without creating anything.
+func nextRunID(outputDir string) (string, error) {
+	for runNum := 1; ; runNum++ {
+		runID := fmt.Sprintf("%d", runNum)
+		_, err := os.Stat(filepath.Join(outputDir, runID))
+		if os.IsNotExist(err) {
+			return runID, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// FormatEnvironment renders env as export lines for a POSIX shell, sorted by
+// name, so the output of benchctl env can be evaluated with eval.
+func FormatEnvironment(env map[string]string) string {
+	var b strings.Builder
+	for _, assignment := range envAssignments(env) {
+		b.WriteString("export " + assignment + "\n")
+	}
+	return b.String()
+}
+
+// FormatVars renders the vars of cfg as shell comments: they are substituted into
+// the config when it is loaded rather than exported to stages.
+func FormatVars(cfg *config.Config) string {
+	names := make([]string, 0, len(cfg.Vars))
+	for name := range cfg.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "# var %s=%s\n", name, cfg.Vars[name])
+	}
+	return b.String()
+}
@@ -0,0 +1,28 @@
+//go:build unit
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNextRunIDFailsWhenOutputDirIsAFile(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "results")
+	if err := os.WriteFile(outputDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if runID, err := nextRunID(outputDir); err == nil {
+		t.Fatalf("nextRunID() = %q, want an error", runID)
+	}
+	if err := os.Remove(outputDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(outputDir, "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if runID, err := nextRunID(outputDir); err != nil || runID != "2" {
+		t.Fatalf("nextRunID() = %q, %v, want 2", runID, err)
+	}
+}
@@ -51,6 +51,10 @@ func multiWriterFiltered(writers ...io.Writer) io.Writer {
 		skip := false
 		if rv.Kind() == reflect.Pointer || rv.Kind() == reflect.UnsafePointer {
 			ptr := rv.Pointer()
+			if ptr == 0 {
+				// A disabled capture buffer.
+				continue
+			}
 			if _, ok := seenPtrs[ptr]; ok {
 				skip = true
 			} else {
@@ -0,0 +1,79 @@
+package execution
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// dockerRemoveTimeout bounds removing the container of a canceled command.
+const dockerRemoveTimeout = 30 * time.Second
+
+// DockerOptions describe the container a docker client runs commands in.
+type DockerOptions struct {
+	Image string
+	// Mounts are bind mounts in the host:container[:options] form of docker run -v.
+	Mounts []string
+	// Network is the docker network, such as "host"; empty keeps the default bridge.
+	Network string
+}
+
+// Docker client running every command in a fresh container on the host of another
+// client, removed when the command ends.
+type dockerClient struct {
+	ExecutionClient
+	options DockerOptions
+}
+
+// NewDockerClient creates a client that runs commands through docker run on the
+// host of client. File transfers and port checks still reach the host itself, so
+// outputs are collected from mounted host paths.
+func NewDockerClient(client ExecutionClient, options DockerOptions) ExecutionClient {
+	return &dockerClient{ExecutionClient: client, options: options}
+}
+
+// RunCommand executes the command with sh in a new container. Stdin is attached,
+// and a terminal is allocated when a PTY is requested. The container of a
+// canceled command, which the docker CLI leaves running, is removed.
+func (c *dockerClient) RunCommand(ctx context.Context, req CommandRequest) (CommandResult, error) {
+	name := containerName()
+	req.Command = DockerCommand(c.options, name, req.Command, req.UsePTY)
+	result, err := c.ExecutionClient.RunCommand(ctx, req)
+	if ctx.Err() != nil {
+		removeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dockerRemoveTimeout)
+		defer cancel()
+		_, _ = c.ExecutionClient.RunCommand(removeCtx, CommandRequest{Command: "docker rm -f " + name, DisableCapture: true})
+	}
+	return result, err
+}
+
+// DockerCommand returns the docker run invocation executing command with sh in a
+// container named name.
+func DockerCommand(options DockerOptions, name, command string, tty bool) string {
+	args := []string{"docker", "run", "--rm", "-i", "--init", "--name", name}
+	if tty {
+		args = append(args, "-t")
+	}
+	if options.Network != "" {
+		args = append(args, "--network", shellQuote(options.Network))
+	}
+	for _, mount := range options.Mounts {
+		args = append(args, "-v", shellQuote(mount))
+	}
+	args = append(args, shellQuote(options.Image), "sh", "-c", shellQuote(command))
+	return strings.Join(args, " ")
+}
+
+// containerName returns a unique name for the container of one command.
+func containerName() string {
+	suffix := make([]byte, 6)
+	_, _ = rand.Read(suffix)
+	return "benchctl-" + hex.EncodeToString(suffix)
+}
+
+// shellQuote quotes s as a single sh word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,55 @@
+//go:build unit
+
+package execution
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// recordingClient records the commands it is asked to run.
+type recordingClient struct {
+	ExecutionClient
+	commands []string
+	run      func(ctx context.Context) error
+}
+
+func (c *recordingClient) RunCommand(ctx context.Context, req CommandRequest) (CommandResult, error) {
+	c.commands = append(c.commands, req.Command)
+	if c.run != nil && len(c.commands) == 1 {
+		return CommandResult{ExitCode: -1}, c.run(ctx)
+	}
+	return CommandResult{}, nil
+}
+
+func TestDockerCommand(t *testing.T) {
+	options := DockerOptions{Image: "alpine:3.20", Mounts: []string{"/data:/data:ro"}, Network: "host"}
+	got := DockerCommand(options, "benchctl-1", "echo 'hi'", false)
+	want := `docker run --rm -i --init --name benchctl-1 --network 'host' -v '/data:/data:ro' 'alpine:3.20' sh -c 'echo '"'"'hi'"'"''`
+	if got != want {
+		t.Fatalf("DockerCommand() =\n%s\nwant\n%s", got, want)
+	}
+	if got := DockerCommand(DockerOptions{Image: "alpine"}, "n", "true", true); !strings.Contains(got, "--name n -t 'alpine'") {
+		t.Fatalf("expected a terminal to be allocated, got %s", got)
+	}
+}
+
+func TestDockerClientRemovesContainerOfCanceledCommand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	inner := &recordingClient{run: func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	}}
+	client := NewDockerClient(inner, DockerOptions{Image: "alpine"})
+	if _, err := client.RunCommand(ctx, CommandRequest{Command: "sleep 60"}); err == nil {
+		t.Fatal("expected the canceled command to fail")
+	}
+	if len(inner.commands) != 2 {
+		t.Fatalf("expected the command and a removal, got %q", inner.commands)
+	}
+	name := strings.Fields(inner.commands[0])[6]
+	if !strings.HasPrefix(name, "benchctl-") || inner.commands[1] != "docker rm -f "+name {
+		t.Fatalf("expected container %s to be removed, got %q", name, inner.commands)
+	}
+}
@@ -0,0 +1,190 @@
+package execution
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// Kubernetes client running commands in a pod through kubectl exec, with the
+// kubectl of the machine running benchctl.
+type kubernetesClient struct {
+	local   ExecutionClient
+	options config.KubernetesHost
+	pod     string
+}
+
+// NewKubernetesClient creates a client for the pod of a kubernetes host. A label
+// selector is resolved to the first running pod it matches.
+func NewKubernetesClient(ctx context.Context, host config.Host) (ExecutionClient, error) {
+	if host.Kubernetes == nil {
+		return nil, errors.New("kubernetes host has no kubernetes settings")
+	}
+	c := &kubernetesClient{local: NewLocalClient(), options: *host.Kubernetes, pod: host.Kubernetes.Pod}
+	if c.pod != "" {
+		return c, nil
+	}
+	command := c.kubectl("get", "pods", "-l", shellQuote(c.options.Selector), "--field-selector=status.phase=Running", "-o", shellQuote("jsonpath={.items[*].metadata.name}"))
+	result, err := c.local.RunCommand(ctx, CommandRequest{Command: command})
+	if err != nil {
+		return nil, fmt.Errorf("error resolving pod of selector %s: %w: %s", c.options.Selector, err, strings.TrimSpace(result.Output))
+	}
+	pods := strings.Fields(result.Output)
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no running pod matches selector %s", c.options.Selector)
+	}
+	c.pod = pods[0]
+	return c, nil
+}
+
+// kubectl returns the kubectl invocation of args for the cluster and namespace of
+// the host. Args are passed to the shell as they are.
+func (c *kubernetesClient) kubectl(args ...string) string {
+	command := []string{"kubectl"}
+	if c.options.Kubeconfig != "" {
+		command = append(command, "--kubeconfig", shellQuote(ExpandTilde(c.options.Kubeconfig)))
+	}
+	if c.options.Context != "" {
+		command = append(command, "--context", shellQuote(c.options.Context))
+	}
+	if c.options.Namespace != "" {
+		command = append(command, "--namespace", shellQuote(c.options.Namespace))
+	}
+	return strings.Join(append(command, args...), " ")
+}
+
+// exec returns the kubectl exec invocation running command with sh in the pod.
+func (c *kubernetesClient) exec(command string, tty bool) string {
+	args := []string{"exec", "-i"}
+	if tty {
+		args = append(args, "-t")
+	}
+	args = append(args, shellQuote(c.pod))
+	if c.options.Container != "" {
+		args = append(args, "-c", shellQuote(c.options.Container))
+	}
+	return c.kubectl(append(args, "--", "sh", "-c", shellQuote(command))...)
+}
+
+// RunCommand executes the command in the pod. The exit code of the command is
+// the exit code of kubectl exec.
+func (c *kubernetesClient) RunCommand(ctx context.Context, req CommandRequest) (CommandResult, error) {
+	if strings.TrimSpace(req.Command) == "" {
+		return CommandResult{ExitCode: -1}, errors.New("empty command")
+	}
+	req.Command = c.exec(req.Command, req.UsePTY)
+	return c.local.RunCommand(ctx, req)
+}
+
+// CheckPort checks a port in the pod, or, for a service:port target, that the
+// service has a ready endpoint with that port number or name. Pod ports are read
+// from /proc/net, so the image needs no netcat.
+func (c *kubernetesClient) CheckPort(ctx context.Context, target string, timeout time.Duration) (bool, error) {
+	subCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if service, port, ok := strings.Cut(target, ":"); ok {
+		return c.checkServicePort(subCtx, service, port)
+	}
+	port, err := strconv.Atoi(target)
+	if err != nil || port <= 0 || port > 65535 {
+		return false, fmt.Errorf("invalid port %q", target)
+	}
+	command := fmt.Sprintf(`cat /proc/net/tcp /proc/net/tcp6 2>/dev/null | awk '$2 ~ /:%04X$/ && $4 == "0A" { found = 1 } END { exit found ? 0 : %d }'`, port, portClosed)
+	result, err := c.local.RunCommand(subCtx, CommandRequest{Command: c.exec(command, false)})
+	if result.ExitCode == portClosed {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// portClosed is the exit code of CheckPort commands for a port nothing listens
+// on, told apart from the exit code 1 of kubectl errors.
+const portClosed = 3
+
+// checkServicePort reports whether the endpoints of service list a ready address
+// serving port.
+func (c *kubernetesClient) checkServicePort(ctx context.Context, service, port string) (bool, error) {
+	template := `jsonpath={range .subsets[*]}{.addresses[*].ip}{"|"}{.ports[*].port} {.ports[*].name}{"\n"}{end}`
+	result, err := c.local.RunCommand(ctx, CommandRequest{Command: c.kubectl("get", "endpoints", shellQuote(service), "-o", shellQuote(template))})
+	if err != nil {
+		return false, fmt.Errorf("error reading endpoints of service %s: %w: %s", service, err, strings.TrimSpace(result.Output))
+	}
+	return serviceEndpointReady(result.Output, port), nil
+}
+
+// serviceEndpointReady reports whether a subset of the endpoints printed by
+// checkServicePort has an address and serves port.
+func serviceEndpointReady(endpoints, port string) bool {
+	for _, subset := range strings.Split(endpoints, "\n") {
+		addresses, ports, ok := strings.Cut(subset, "|")
+		if ok && strings.TrimSpace(addresses) != "" && slices.Contains(strings.Fields(ports), port) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scp copies a file out of the pod by streaming it through kubectl exec, so the
+// image needs no tar, unlike kubectl cp.
+func (c *kubernetesClient) Scp(ctx context.Context, remotePath, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	_, err = c.local.RunCommand(ctx, CommandRequest{
+		Command:        c.exec("cat "+shellQuote(remotePath), false),
+		Stdout:         file,
+		Stderr:         &stderr,
+		DisableCapture: true,
+	})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error copying %s from pod %s: %w: %s", remotePath, c.pod, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Upload copies a file into the pod, creating its directory.
+func (c *kubernetesClient) Upload(ctx context.Context, localPath, remotePath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	command := fmt.Sprintf("mkdir -p %s && cat > %s", shellQuote(path.Dir(remotePath)), shellQuote(remotePath))
+	var stderr bytes.Buffer
+	_, err = c.local.RunCommand(ctx, CommandRequest{
+		Command:        c.exec(command, false),
+		Stdin:          file,
+		Stderr:         &stderr,
+		DisableCapture: true,
+	})
+	if err != nil {
+		return fmt.Errorf("error copying %s to pod %s: %w: %s", localPath, c.pod, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Close closes the kubernetes client; kubectl keeps no connection open.
+func (c *kubernetesClient) Close() error {
+	return nil
+}
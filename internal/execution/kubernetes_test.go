@@ -0,0 +1,104 @@
+//go:build unit
+
+package execution
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// fakeKubectl puts a kubectl on PATH that logs its arguments, lists two running
+// pods, and runs exec commands locally, and returns the path of the log.
+func fakeKubectl(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "kubectl.log")
+	script := `#!/bin/sh
+echo "$*" >> ` + log + `
+case "$*" in
+*"get pods"*) echo "server-0 server-1" ;;
+*"get endpoints"*) printf '10.0.0.5|8080 http\n' ;;
+"exec "*|*" exec "*)
+	while [ "$1" != "--" ]; do shift; done
+	shift
+	exec "$@"
+	;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestKubernetesClientRunsCommandsInSelectedPod(t *testing.T) {
+	log := fakeKubectl(t)
+	host := config.Host{Type: "kubernetes", Kubernetes: &config.KubernetesHost{Context: "bench", Namespace: "load", Selector: "app=server", Container: "app"}}
+	client, err := NewKubernetesClient(context.Background(), host)
+	if err != nil {
+		t.Fatalf("NewKubernetesClient() error = %v", err)
+	}
+	result, err := client.RunCommand(context.Background(), CommandRequest{Command: "echo 'in pod'"})
+	if err != nil || strings.TrimSpace(result.Output) != "in pod" {
+		t.Fatalf("RunCommand() = %q, %v", result.Output, err)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--context bench --namespace load exec -i server-0 -c app -- sh -c echo 'in pod'"
+	if !strings.Contains(string(data), want) {
+		t.Fatalf("expected kubectl %q, got:\n%s", want, data)
+	}
+}
+
+func TestKubernetesClientCopiesFiles(t *testing.T) {
+	fakeKubectl(t)
+	client, err := NewKubernetesClient(context.Background(), config.Host{Type: "kubernetes", Kubernetes: &config.KubernetesHost{Pod: "server-0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	local := filepath.Join(dir, "results.csv")
+	if err := os.WriteFile(local, []byte("p50,p99\n1,2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := filepath.Join(dir, "pod", "results.csv")
+	if err := client.Upload(context.Background(), local, remote); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	collected := filepath.Join(dir, "run", "results.csv")
+	if err := client.Scp(context.Background(), remote, collected); err != nil {
+		t.Fatalf("Scp() error = %v", err)
+	}
+	if data, _ := os.ReadFile(collected); string(data) != "p50,p99\n1,2\n" {
+		t.Fatalf("collected %q", data)
+	}
+	if err := client.Scp(context.Background(), filepath.Join(dir, "missing"), collected); err == nil {
+		t.Fatal("expected copying a missing file to fail")
+	}
+}
+
+func TestKubernetesClientChecksServicePorts(t *testing.T) {
+	fakeKubectl(t)
+	client, err := NewKubernetesClient(context.Background(), config.Host{Type: "kubernetes", Kubernetes: &config.KubernetesHost{Pod: "server-0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for target, want := range map[string]bool{"server:8080": true, "server:http": true, "server:9090": false} {
+		healthy, err := client.CheckPort(context.Background(), target, time.Second)
+		if err != nil || healthy != want {
+			t.Errorf("CheckPort(%s) = %v, %v, want %v", target, healthy, err, want)
+		}
+	}
+	if serviceEndpointReady("|8080 http\n", "8080") {
+		t.Error("expected a service without ready addresses to be unhealthy")
+	}
+}
@@ -8,12 +8,14 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/creack/pty"
 )
 
+// localWaitDelay bounds how long output is still read after a local command exited.
+const localWaitDelay = time.Second
+
 // Local execution client for running commands locally
 type localClient struct{}
 
@@ -46,34 +48,17 @@ func runLocalPiped(cmd *exec.Cmd, req CommandRequest) (CommandResult, error) {
 		capture = newCaptureBuffer()
 	}
 
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return CommandResult{ExitCode: -1}, err
-	}
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return CommandResult{ExitCode: -1}, err
-	}
-
-	if err := cmd.Start(); err != nil {
-		return CommandResult{ExitCode: -1}, err
-	}
+	// exec copies the output and stops waiting for it localWaitDelay after the
+	// process exited or was canceled, so children that inherited the pipes cannot
+	// keep the command from returning.
+	cmd.Stdout = multiWriterFiltered(req.Stdout, capture)
+	cmd.Stderr = multiWriterFiltered(req.Stderr, capture)
+	cmd.WaitDelay = localWaitDelay
 
-	var wg sync.WaitGroup
-	copyStream := func(r io.Reader, additional io.Writer) {
-		defer wg.Done()
-		_, _ = io.Copy(additional, r)
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
 	}
-
-	stdoutDest := multiWriterFiltered(req.Stdout, capture)
-	stderrDest := multiWriterFiltered(req.Stderr, capture)
-
-	wg.Add(2)
-	go copyStream(stdoutPipe, stdoutDest)
-	go copyStream(stderrPipe, stderrDest)
-
-	err = cmd.Wait()
-	wg.Wait()
 	exitCode := 0
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
@@ -120,7 +105,13 @@ func runLocalWithPTY(cmd *exec.Cmd, req CommandRequest) (CommandResult, error) {
 	}()
 
 	err = cmd.Wait()
-	<-copyDone
+	select {
+	case <-copyDone:
+	case <-time.After(localWaitDelay):
+		// A child process still holds the terminal open.
+		_ = ptmx.Close()
+		<-copyDone
+	}
 
 	exitCode := 0
 	if err != nil {
@@ -0,0 +1,68 @@
+package execution
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/bramvdbogaerde/go-scp"
+)
+
+// ProgressInterval is how often a running transfer reports its progress.
+var ProgressInterval = 5 * time.Second
+
+// TransferProgress is how far a file transfer has come.
+type TransferProgress struct {
+	Bytes   int64
+	Total   int64
+	Elapsed time.Duration
+	// Done is set on the last report, once Total bytes were transferred.
+	Done bool
+}
+
+type progressKey struct{}
+
+// WithTransferProgress returns a context whose Scp and Upload calls over SSH pass
+// their progress to report every ProgressInterval, and once when they complete.
+func WithTransferProgress(ctx context.Context, report func(TransferProgress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// progressPassThru returns the scp reader wrapper reporting to the progress
+// function of ctx, or nil without one.
+func progressPassThru(ctx context.Context) scp.PassThru {
+	report, ok := ctx.Value(progressKey{}).(func(TransferProgress))
+	if !ok || report == nil {
+		return nil
+	}
+	return func(r io.Reader, total int64) io.Reader {
+		now := time.Now()
+		return &progressReader{r: r, total: total, report: report, started: now, reported: now}
+	}
+}
+
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	bytes    int64
+	report   func(TransferProgress)
+	started  time.Time
+	reported time.Time
+	done     bool
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.bytes += int64(n)
+	now := time.Now()
+	switch {
+	case p.done:
+	case p.bytes >= p.total:
+		p.done = true
+		p.report(TransferProgress{Bytes: p.bytes, Total: p.total, Elapsed: now.Sub(p.started), Done: true})
+	case now.Sub(p.reported) >= ProgressInterval:
+		p.reported = now
+		p.report(TransferProgress{Bytes: p.bytes, Total: p.total, Elapsed: now.Sub(p.started)})
+	}
+	return n, err
+}
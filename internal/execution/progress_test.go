@@ -0,0 +1,41 @@
+//go:build unit
+
+package execution
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestProgressPassThruReportsTransfer(t *testing.T) {
+	previous := ProgressInterval
+	ProgressInterval = 0
+	t.Cleanup(func() { ProgressInterval = previous })
+
+	if progressPassThru(context.Background()) != nil {
+		t.Fatal("expected no pass-through without a progress function")
+	}
+	var reports []TransferProgress
+	ctx := WithTransferProgress(context.Background(), func(progress TransferProgress) {
+		reports = append(reports, progress)
+	})
+	data := bytes.Repeat([]byte("x"), 10)
+	reader := progressPassThru(ctx)(io.LimitReader(bytes.NewReader(data), 10), int64(len(data)))
+	buf := make([]byte, 4)
+	for {
+		if _, err := reader.Read(buf); err == io.EOF {
+			break
+		}
+	}
+	if len(reports) != 3 {
+		t.Fatalf("expected two progress reports and a final one, got %+v", reports)
+	}
+	if reports[0].Bytes != 4 || reports[0].Done {
+		t.Fatalf("unexpected first report %+v", reports[0])
+	}
+	if last := reports[2]; last.Bytes != 10 || last.Total != 10 || !last.Done {
+		t.Fatalf("unexpected last report %+v", last)
+	}
+}
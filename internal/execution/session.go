@@ -0,0 +1,162 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// ErrSessionEnded is returned by Send and Expect once the command of a session
+// exited.
+var ErrSessionEnded = errors.New("session command exited")
+
+// Session is a long-lived interactive command, such as a REPL, a debugger, or the
+// console of a server, that is started once and then receives input while it runs.
+// It works with every ExecutionClient: its input is the stdin of one RunCommand
+// call, and its output is read as the command prints it.
+type Session struct {
+	stdin  *os.File
+	output *sessionOutput
+	cancel context.CancelFunc
+	done   chan struct{}
+	result CommandResult
+	err    error
+}
+
+// StartSession starts req.Command on client as a session. The stdin of req is
+// replaced by the input of the session, and no PTY is requested, so that closing
+// the input ends the stdin of the command. The stdout and stderr of req still
+// receive the output, which the result holds as well unless capture is disabled.
+//
+// The input is an OS pipe, so that a local command reads it directly and nothing
+// keeps waiting for more input once the command exited.
+func StartSession(ctx context.Context, client ExecutionClient, req CommandRequest) (*Session, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create session input: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Session{
+		stdin:  writer,
+		output: &sessionOutput{changed: make(chan struct{})},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	req.Stdin = reader
+	req.UsePTY = false
+	req.Stdout = multiWriterFiltered(req.Stdout, s.output)
+	req.Stderr = multiWriterFiltered(req.Stderr, s.output)
+	go func() {
+		s.result, s.err = client.RunCommand(ctx, req)
+		_ = reader.Close()
+		_ = writer.Close()
+		s.output.end()
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// Send writes line and a newline to the input of the command.
+func (s *Session) Send(line string) error {
+	if _, err := io.WriteString(s.stdin, line+"\n"); err != nil {
+		select {
+		case <-s.done:
+			return fmt.Errorf("send %q: %w", line, ErrSessionEnded)
+		default:
+			return fmt.Errorf("send %q: %w", line, err)
+		}
+	}
+	return nil
+}
+
+// Expect waits until the output not yet consumed by an earlier Expect matches
+// pattern, and returns that output up to the end of the match, which it consumes.
+func (s *Session) Expect(ctx context.Context, pattern *regexp.Regexp) (string, error) {
+	for {
+		data, changed, ended := s.output.pending()
+		if loc := pattern.FindIndex(data); loc != nil {
+			return s.output.consume(loc[1]), nil
+		}
+		if ended {
+			return "", fmt.Errorf("expect %q: %w", pattern, ErrSessionEnded)
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return "", fmt.Errorf("expect %q: %w", pattern, ctx.Err())
+		}
+	}
+}
+
+// CloseInput closes the input of the command, which most interactive commands
+// take as the signal to exit.
+func (s *Session) CloseInput() error {
+	if err := s.stdin.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// Wait waits for the command to exit and returns its result. When ctx is done
+// first, the command is canceled and the error of ctx returned with its result.
+func (s *Session) Wait(ctx context.Context) (CommandResult, error) {
+	select {
+	case <-s.done:
+		return s.result, s.err
+	case <-ctx.Done():
+		result, _ := s.Stop()
+		return result, ctx.Err()
+	}
+}
+
+// Stop cancels the command and returns its result once it exited.
+func (s *Session) Stop() (CommandResult, error) {
+	s.cancel()
+	<-s.done
+	return s.result, s.err
+}
+
+// sessionOutput holds the output of a session that Expect has not consumed yet,
+// and signals every write by closing and replacing changed.
+type sessionOutput struct {
+	mu      sync.Mutex
+	data    []byte
+	changed chan struct{}
+	ended   bool
+}
+
+func (o *sessionOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.data = append(o.data, p...)
+	close(o.changed)
+	o.changed = make(chan struct{})
+	return len(p), nil
+}
+
+// end marks the output complete once the command exited.
+func (o *sessionOutput) end() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ended = true
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+func (o *sessionOutput) pending() ([]byte, <-chan struct{}, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]byte(nil), o.data...), o.changed, o.ended
+}
+
+func (o *sessionOutput) consume(n int) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	consumed := string(o.data[:n])
+	o.data = append([]byte(nil), o.data[n:]...)
+	return consumed
+}
@@ -0,0 +1,93 @@
+//go:build unit
+
+package execution
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replCommand prints a prompt, answers every line, and exits with code 3 on quit.
+const replCommand = `printf 'ready> '; while read -r line; do [ "$line" = quit ] && exit 3; echo "got $line"; printf 'ready> '; done`
+
+func TestSessionSendsLinesAndReadsReplies(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var stdout strings.Builder
+	session, err := StartSession(ctx, NewLocalClient(), CommandRequest{Command: replCommand, Stdout: &stdout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt := regexp.MustCompile(`ready> `)
+
+	if _, err := session.Expect(ctx, prompt); err != nil {
+		t.Fatalf("Expect(prompt): %v", err)
+	}
+	for _, line := range []string{"one", "two"} {
+		if err := session.Send(line); err != nil {
+			t.Fatalf("Send(%q): %v", line, err)
+		}
+		reply, err := session.Expect(ctx, regexp.MustCompile(`got (\w+)\n`))
+		if err != nil {
+			t.Fatalf("Expect(reply): %v", err)
+		}
+		if reply != "got "+line+"\n" {
+			t.Fatalf("reply = %q, want %q", reply, "got "+line+"\n")
+		}
+		if _, err := session.Expect(ctx, prompt); err != nil {
+			t.Fatalf("Expect(prompt): %v", err)
+		}
+	}
+	if err := session.Send("quit"); err != nil {
+		t.Fatalf("Send(quit): %v", err)
+	}
+	result, _ := session.Wait(ctx)
+	if result.ExitCode != 3 {
+		t.Fatalf("exit code = %d, want 3", result.ExitCode)
+	}
+	if want := "ready> got one\nready> got two\nready> "; result.Output != want || stdout.String() != want {
+		t.Fatalf("output = %q, stdout = %q, want %q", result.Output, stdout.String(), want)
+	}
+}
+
+func TestSessionEndsWhenInputCloses(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	session, err := StartSession(ctx, NewLocalClient(), CommandRequest{Command: replCommand})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.CloseInput(); err != nil {
+		t.Fatalf("CloseInput: %v", err)
+	}
+	result, err := session.Wait(ctx)
+	if err != nil || result.ExitCode != 0 {
+		t.Fatalf("Wait() = %+v, %v, want exit code 0", result, err)
+	}
+	if _, err := session.Expect(ctx, regexp.MustCompile(`got`)); !errors.Is(err, ErrSessionEnded) {
+		t.Fatalf("Expect after exit = %v, want ErrSessionEnded", err)
+	}
+	if err := session.Send("late"); !errors.Is(err, ErrSessionEnded) {
+		t.Fatalf("Send after exit = %v, want ErrSessionEnded", err)
+	}
+}
+
+func TestSessionExpectTimesOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	session, err := StartSession(ctx, NewLocalClient(), CommandRequest{Command: replCommand})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Stop()
+
+	expectCtx, cancelExpect := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelExpect()
+	if _, err := session.Expect(expectCtx, regexp.MustCompile(`never printed`)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expect() = %v, want deadline exceeded", err)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,6 +23,15 @@ import (
 
 const (
 	DEFAULT_SSH_PORT = 22
+	// DefaultMaxSessions is the default of hosts.<name>.ssh.max_sessions, the
+	// MaxSessions default of OpenSSH.
+	DefaultMaxSessions = 10
+	// DefaultKeepaliveInterval is the default of hosts.<name>.ssh.keepalive_interval.
+	DefaultKeepaliveInterval = 30 * time.Second
+	// DefaultKeepaliveCountMax is the default of hosts.<name>.ssh.keepalive_count_max.
+	DefaultKeepaliveCountMax = 3
+	// DefaultReconnectAttempts is the default of hosts.<name>.ssh.reconnect_attempts.
+	DefaultReconnectAttempts = 3
 )
 
 // ExpandTilde expands ~ to the user's home directory using $HOME
@@ -31,20 +44,227 @@ func ExpandTilde(path string) string {
 // all things SSH here
 
 type sshClient struct {
-	client *ssh.Client
 	host   config.Host
+	logger *slog.Logger
+	// sessions holds a token for every open session, so callers sharing the
+	// connection stay below the MaxSessions limit of sshd.
+	sessions chan struct{}
+
+	mu     sync.Mutex
+	client *ssh.Client
+	// jumps are the connections to the proxy_jump hosts, first hop first.
+	jumps []*ssh.Client
+	// stopKeepalive ends the keepalives of the current connection.
+	stopKeepalive chan struct{}
+	closed        bool
 }
 
 func NewSSHClient(host config.Host) (ExecutionClient, error) {
-	client, err := connect(host)
+	return DialSSH(host, nil)
+}
+
+// DialSSH connects to host like NewSSHClient and logs every step of the connection
+// (addresses, jump hops, offered algorithms and auth methods, server version and
+// banner) to logger at debug level. A nil logger logs to slog.Default.
+func DialSSH(host config.Host, logger *slog.Logger) (ExecutionClient, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	client, jumps, err := connect(host, logger)
 	if err != nil {
 		return nil, errors.New("error creating ssh client: " + err.Error())
 	}
-	return &sshClient{client: client, host: host}, nil
+	maxSessions := DefaultMaxSessions
+	if host.SSH != nil && host.SSH.MaxSessions > 0 {
+		maxSessions = host.SSH.MaxSessions
+	}
+	c := &sshClient{host: host, logger: logger, sessions: make(chan struct{}, maxSessions)}
+	c.setConnection(client, jumps)
+	return c, nil
+}
+
+// Alive reports whether the connection of client still answers, with an SSH
+// keepalive request for SSH clients. Other clients are always alive.
+func Alive(client ExecutionClient) bool {
+	c, ok := client.(*sshClient)
+	if !ok {
+		return true
+	}
+	_, _, err := c.connection().SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
+}
+
+func (c *sshClient) connection() *ssh.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client
+}
+
+// setConnection makes client the connection of c and starts its keepalives.
+// c.mu must be held, or c not yet shared.
+func (c *sshClient) setConnection(client *ssh.Client, jumps []*ssh.Client) {
+	c.client, c.jumps = client, jumps
+	c.stopKeepalive = make(chan struct{})
+	interval, countMax := keepaliveSettings(c.host)
+	if interval > 0 {
+		go keepalive(client, interval, countMax, c.stopKeepalive, c.logger, sshAddress(c.host))
+	}
+}
+
+func keepaliveSettings(host config.Host) (time.Duration, int) {
+	interval, countMax := DefaultKeepaliveInterval, DefaultKeepaliveCountMax
+	if options := host.SSH; options != nil {
+		if options.KeepaliveInterval != "" {
+			if parsed, err := time.ParseDuration(options.KeepaliveInterval); err == nil {
+				interval = parsed
+			}
+		}
+		if options.KeepaliveCountMax > 0 {
+			countMax = options.KeepaliveCountMax
+		}
+	}
+	return interval, countMax
+}
+
+// keepalive sends a keepalive request on client every interval, like
+// ServerAliveInterval of OpenSSH, so idle connections are not dropped by NAT and
+// firewalls. After countMax unanswered requests in a row, the connection is closed,
+// failing its sessions instead of leaving them hanging, and reopened on next use.
+func keepalive(client *ssh.Client, interval time.Duration, countMax int, stop chan struct{}, logger *slog.Logger, addr string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		answered := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			answered <- err
+		}()
+		var err error
+		select {
+		case <-stop:
+			return
+		case err = <-answered:
+		case <-time.After(interval):
+			err = errors.New("no answer")
+		}
+		if err == nil {
+			missed = 0
+			continue
+		}
+		missed++
+		logger.Debug("ssh keepalive missed", "address", addr, "missed", missed, "error", err)
+		if missed >= countMax {
+			logger.Warn("ssh connection lost", "address", addr, "missed_keepalives", missed)
+			_ = client.Close()
+			return
+		}
+	}
+}
+
+// reconnect replaces the connection failed, unless another caller has already
+// done so, retrying up to hosts.<name>.ssh.reconnect_attempts times with a
+// growing delay.
+func (c *sshClient) reconnect(ctx context.Context, failed *ssh.Client) (*ssh.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, errors.New("ssh client closed")
+	}
+	if c.client != failed {
+		return c.client, nil
+	}
+	c.closeConnection()
+	attempts := DefaultReconnectAttempts
+	if c.host.SSH != nil && c.host.SSH.ReconnectAttempts != 0 {
+		attempts = max(c.host.SSH.ReconnectAttempts, 0)
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		c.logger.Info("ssh reconnecting", "address", sshAddress(c.host), "attempt", attempt, "attempts", attempts)
+		client, jumps, connectErr := connect(c.host, c.logger)
+		if connectErr == nil {
+			c.setConnection(client, jumps)
+			return client, nil
+		}
+		err = connectErr
+		if attempt == attempts {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err == nil {
+		err = errors.New("reconnecting is disabled")
+	}
+	return nil, fmt.Errorf("ssh connection to %s lost: %w", sshAddress(c.host), err)
+}
+
+// closeConnection closes the current connection; c.mu must be held.
+func (c *sshClient) closeConnection() error {
+	if c.stopKeepalive != nil {
+		close(c.stopKeepalive)
+		c.stopKeepalive = nil
+	}
+	err := c.client.Close()
+	for i := len(c.jumps) - 1; i >= 0; i-- {
+		_ = c.jumps[i].Close()
+	}
+	return err
+}
+
+// newSession opens a session, reconnecting once when the connection was lost.
+func (c *sshClient) newSession(ctx context.Context) (*ssh.Session, error) {
+	client := c.connection()
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+	c.logger.Debug("ssh session failed", "address", sshAddress(c.host), "error", err)
+	client, reconnectErr := c.reconnect(ctx, client)
+	if reconnectErr != nil {
+		return nil, errors.Join(err, reconnectErr)
+	}
+	return client.NewSession()
+}
+
+// alive returns the connection after checking that it still answers, reconnecting
+// when it does not, for operations that open their own sessions.
+func (c *sshClient) alive(ctx context.Context) (*ssh.Client, error) {
+	client := c.connection()
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+		return client, nil
+	}
+	return c.reconnect(ctx, client)
+}
+
+// acquireSession waits until the connection has room for another session and
+// returns the func to call once the session is closed.
+func (c *sshClient) acquireSession(ctx context.Context) (func(), error) {
+	select {
+	case c.sessions <- struct{}{}:
+		return func() { <-c.sessions }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 func (c *sshClient) Close() error {
-	return c.client.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.closeConnection()
 }
 
 // RunCommand runs a command on the remote host and returns the output and exit code.
@@ -54,7 +274,12 @@ func (c *sshClient) RunCommand(ctx context.Context, req CommandRequest) (Command
 		return CommandResult{ExitCode: -1}, errors.New("empty command")
 	}
 
-	session, err := c.client.NewSession()
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	defer release()
+	session, err := c.newSession(ctx)
 	if err != nil {
 		return CommandResult{ExitCode: -1}, errors.New("error creating new session: " + err.Error())
 	}
@@ -213,86 +438,324 @@ func (c *sshClient) CommandExists(ctx context.Context, cmd string) (bool, error)
 	return res.ExitCode == 0, nil
 }
 
-// Utility function to check if a port is listening (using nc -z, requires nc to be installed on the remote host)
+// Utility function to check if a port is listening (using nc -z, requires nc to be installed on the remote host).
+// The check for nc runs in the same session as nc, so polling a port opens one session per attempt.
 func (c *sshClient) CheckPort(ctx context.Context, port string, timeout time.Duration) (bool, error) {
-	// Check if nc is installed
-	exists, err := c.CommandExists(ctx, "nc")
-	if err != nil {
-		return false, err
-	}
-	if !exists {
-		return false, errors.New("nc (netcat) is not installed on the remote host")
-	}
-
-	command := fmt.Sprintf("nc -z localhost %s", port)
+	command := fmt.Sprintf("command -v nc >/dev/null 2>&1 || exit %d; nc -z localhost %s", ncMissing, port)
 	subCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	result, err := c.RunCommand(subCtx, CommandRequest{Command: command})
 	godump.Dump(result.Output, err)
+	if result.ExitCode == ncMissing {
+		return false, errors.New("nc (netcat) is not installed on the remote host")
+	}
 	if err != nil {
 		return false, err
 	}
 	return result.ExitCode == 0, nil
 }
 
-// TODO: implement Password auth, for now only key auth is supported
-func connect(host config.Host) (*ssh.Client, error) {
-	var key ssh.Signer
-	var err error
+// ncMissing is the exit code of CheckPort commands on hosts without nc.
+const ncMissing = 127
 
-	expandedKeyFile := ExpandTilde(host.KeyFile)
+// connect authenticates with the host key file and, when set, the password, sent
+// as password or keyboard-interactive authentication, and returns the client along with the clients of the proxy_jump hops it goes through.
+// Secret references in the credentials are resolved here, right before use.
+func connect(host config.Host, logger *slog.Logger) (*ssh.Client, []*ssh.Client, error) {
+	hops, err := jumpHosts(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	var jumps []*ssh.Client
+	closeJumps := func() {
+		for i := len(jumps) - 1; i >= 0; i-- {
+			_ = jumps[i].Close()
+		}
+	}
+	for i, hop := range append(hops, host) {
+		sshConfig, err := clientConfig(hop, logger)
+		if err != nil {
+			closeJumps()
+			return nil, nil, err
+		}
+		addr := sshAddress(hop)
+		attrs := []any{"address", addr, "user", hop.Username, "auth", authNames(hop)}
+		if i < len(hops) {
+			attrs = append(attrs, "jump", fmt.Sprintf("%d/%d", i+1, len(hops)))
+		}
+		if len(jumps) > 0 {
+			attrs = append(attrs, "via", jumps[len(jumps)-1].RemoteAddr().String())
+		}
+		if sshConfig.Timeout > 0 {
+			attrs = append(attrs, "timeout", sshConfig.Timeout)
+		}
+		for _, algorithms := range []struct {
+			name   string
+			values []string
+		}{
+			{"ciphers", sshConfig.Ciphers},
+			{"kex", sshConfig.KeyExchanges},
+			{"macs", sshConfig.MACs},
+			{"host_key_algorithms", sshConfig.HostKeyAlgorithms},
+		} {
+			if len(algorithms.values) > 0 {
+				attrs = append(attrs, algorithms.name, strings.Join(algorithms.values, ","))
+			}
+		}
+		logger.Debug("ssh connecting", attrs...)
+		client, err := dial(jumps, addr, sshConfig)
+		if err != nil {
+			logger.Debug("ssh connection failed", "address", addr, "error", err)
+			closeJumps()
+			return nil, nil, connectError(hop, addr, err)
+		}
+		logger.Debug("ssh connected", "address", addr, "server_version", string(client.ServerVersion()))
+		jumps = append(jumps, client)
+	}
+	return jumps[len(jumps)-1], jumps[:len(jumps)-1], nil
+}
 
-	keyFile, err := os.ReadFile(expandedKeyFile)
+// dial connects to addr directly, or through the last of the jump clients. The
+// connect_timeout in sshConfig bounds the connection and the SSH handshake, so a
+// hop or host that accepts the connection and then stalls fails the dial.
+func dial(jumps []*ssh.Client, addr string, sshConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	ctx := context.Background()
+	if sshConfig.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sshConfig.Timeout)
+		defer cancel()
+	}
+	var conn net.Conn
+	var err error
+	if len(jumps) == 0 {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	} else if conn, err = jumps[len(jumps)-1].DialContext(ctx, "tcp", addr); err != nil {
+		err = fmt.Errorf("jump to %s: %w", addr, err)
+	}
 	if err != nil {
 		return nil, err
 	}
+	// Connections through a jump host take no deadlines, so the handshake is
+	// ended by closing the connection once the timeout expires.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	if !stop() {
+		if err == nil {
+			_ = clientConn.Close()
+		}
+		return nil, fmt.Errorf("ssh handshake did not finish within %s: %w", sshConfig.Timeout, os.ErrDeadlineExceeded)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
 
-	if host.KeyPassword != "" {
-		key, err = ssh.ParsePrivateKeyWithPassphrase(keyFile, []byte(host.KeyPassword))
-
-	} else {
-		key, err = ssh.ParsePrivateKey(keyFile)
+// jumpHosts parses the proxy_jump hops of host. Each hop takes its settings from
+// ~/.ssh/config, and the user and credentials of host where none are configured.
+func jumpHosts(host config.Host) ([]config.Host, error) {
+	if strings.TrimSpace(host.ProxyJump) == "" {
+		return nil, nil
+	}
+	var hops []config.Host
+	for _, spec := range strings.Split(host.ProxyJump, ",") {
+		spec = strings.TrimPrefix(strings.TrimSpace(spec), "ssh://")
+		user, name, hasUser := strings.Cut(spec, "@")
+		if !hasUser {
+			user, name = "", spec
+		}
+		port := 0
+		if at := strings.LastIndex(name, ":"); at >= 0 && !strings.HasSuffix(name, "]") {
+			var err error
+			if port, err = strconv.Atoi(name[at+1:]); err != nil {
+				return nil, fmt.Errorf("proxy_jump %q: invalid port", spec)
+			}
+			name = name[:at]
+		}
+		name = strings.Trim(name, "[]")
+		if name == "" {
+			return nil, fmt.Errorf("proxy_jump %q: missing host", spec)
+		}
+		hop, err := config.LookupSSHHost(name)
+		if err != nil {
+			return nil, err
+		}
+		if user != "" {
+			hop.Username = user
+		}
+		if port != 0 {
+			hop.Port = port
+		}
+		if hop.Username == "" {
+			hop.Username = host.Username
+		}
+		if hop.KeyFile == "" {
+			hop.KeyFile, hop.KeyPassword, hop.Password = host.KeyFile, host.KeyPassword, host.Password
+		}
+		hop.ProxyJump = ""
+		if host.SSH != nil && host.SSH.ConnectTimeout != "" {
+			hop.SSH = &config.SSHOptions{ConnectTimeout: host.SSH.ConnectTimeout}
+		}
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
 
+func clientConfig(host config.Host, logger *slog.Logger) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if host.KeyFile != "" || host.Password == "" {
+		key, err := loadKey(host)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(key))
 	}
-	if err != nil {
-		return nil, errors.New("error reading key file: " + err.Error())
+	if host.Password != "" {
+		password, err := config.ResolveSecret(host.Password)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.Password(password), ssh.KeyboardInteractive(answerPassword(password)))
 	}
 
 	sshConfig := &ssh.ClientConfig{
-		User: host.Username,
-		Auth: []ssh.AuthMethod{
-			// ssh.Password(host.Password),
-			ssh.PublicKeys(key),
-		},
+		User:            host.Username,
+		Auth:            auth,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		BannerCallback: func(message string) error {
+			logger.Debug("ssh banner", "address", sshAddress(host), "banner", strings.TrimSpace(message))
+			return nil
+		},
 	}
+	if options := host.SSH; options != nil {
+		if options.ConnectTimeout != "" {
+			timeout, err := time.ParseDuration(options.ConnectTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ssh connect_timeout: %w", err)
+			}
+			sshConfig.Timeout = timeout
+		}
+		sshConfig.Ciphers = options.Ciphers
+		sshConfig.KeyExchanges = options.KeyExchanges
+		sshConfig.MACs = options.MACs
+		sshConfig.HostKeyAlgorithms = options.HostKeyAlgorithms
+	}
+	return sshConfig, nil
+}
 
+// authNames names the authentication methods clientConfig offers for host.
+func authNames(host config.Host) string {
+	var names []string
+	if host.KeyFile != "" || host.Password == "" {
+		names = append(names, "publickey")
+	}
+	if host.Password != "" {
+		names = append(names, "password", "keyboard-interactive")
+	}
+	return strings.Join(names, ",")
+}
+
+// answerPassword answers keyboard-interactive challenges with password, for
+// servers that only offer password login through PAM. A challenge asks for the
+// password when it hides the answer; questions shown in the clear, like a
+// prompt for a one-time code, cannot be answered.
+func answerPassword(password string) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			if echos[i] {
+				return nil, fmt.Errorf("keyboard-interactive question %q is not a password prompt", strings.TrimSpace(question))
+			}
+			answers[i] = password
+		}
+		return answers, nil
+	}
+}
+
+// connectError names the user and address of a failed connection, and points at
+// the settings that fix the usual failures with legacy devices.
+func connectError(host config.Host, addr string, err error) error {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "no common algorithm"):
+		return fmt.Errorf("%s@%s: %w (list an algorithm the server offers under the host's ssh ciphers, kex, macs, or host_key_algorithms)", host.Username, addr, err)
+	case strings.Contains(message, "unable to authenticate"):
+		return fmt.Errorf("%s@%s: %w (offered: %s)", host.Username, addr, err, authNames(host))
+	case errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) || strings.Contains(message, "i/o timeout"):
+		return fmt.Errorf("%s@%s: %w (raise the host's ssh connect_timeout for slow devices)", host.Username, addr, err)
+	}
+	return fmt.Errorf("%s@%s: %w", host.Username, addr, err)
+}
+
+func sshAddress(host config.Host) string {
 	port := host.Port
 	if port == 0 {
 		port = DEFAULT_SSH_PORT
 	}
+	return net.JoinHostPort(host.IP, strconv.Itoa(port))
+}
+
+// loadKey reads the private key of host, from key_file or the secret it references.
+func loadKey(host config.Host) (ssh.Signer, error) {
+	var keyFile []byte
+	if config.IsSecretRef(host.KeyFile) {
+		key, err := config.ResolveSecret(host.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keyFile = []byte(key + "\n")
+	} else {
+		data, err := os.ReadFile(ExpandTilde(host.KeyFile))
+		if err != nil {
+			return nil, err
+		}
+		keyFile = data
+	}
 
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host.IP, port), sshConfig)
+	var key ssh.Signer
+	var err error
+	if host.KeyPassword != "" {
+		passphrase, resolveErr := config.ResolveSecret(host.KeyPassword)
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+		key, err = ssh.ParsePrivateKeyWithPassphrase(keyFile, []byte(passphrase))
+	} else {
+		key, err = ssh.ParsePrivateKey(keyFile)
+	}
 	if err != nil {
-		return nil, err
+		return nil, errors.New("error reading key file: " + err.Error())
 	}
-	return client, nil
+	return key, nil
 }
 
 // Scp copies a file from the remote host to the local host.
 func (c *sshClient) Scp(ctx context.Context, remotePath string, localPath string) error {
-	client, err := scp.NewClientBySSH(c.client)
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	connection, err := c.alive(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := scp.NewClientBySSH(connection)
 	if err != nil {
 		return errors.New("error creating scp client: " + err.Error())
 	}
 
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return errors.New("error creating local directory: " + err.Error())
+	}
 	file, err := os.Create(localPath)
 	if err != nil {
 		return errors.New("error creating local file: " + err.Error())
 	}
 	defer file.Close()
 
-	err = client.CopyFromRemote(ctx, file, remotePath)
+	err = client.CopyFromRemotePassThru(ctx, file, remotePath, progressPassThru(ctx))
 	if err != nil {
 		return errors.New("error copying file: " + err.Error())
 	}
@@ -301,7 +764,16 @@ func (c *sshClient) Scp(ctx context.Context, remotePath string, localPath string
 
 // Upload copies a local file to the remote host
 func (c *sshClient) Upload(ctx context.Context, localPath, remotePath string) error {
-	client, err := scp.NewClientBySSH(c.client)
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	connection, err := c.alive(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := scp.NewClientBySSH(connection)
 	if err != nil {
 		return errors.New("error creating scp client: " + err.Error())
 	}
@@ -310,8 +782,12 @@ func (c *sshClient) Upload(ctx context.Context, localPath, remotePath string) er
 		return errors.New("error opening local file: " + err.Error())
 	}
 	defer file.Close()
-	// Mode 0755 for scripts
-	err = client.CopyFile(ctx, file, remotePath, "0755")
+	info, err := file.Stat()
+	if err != nil {
+		return errors.New("error reading local file: " + err.Error())
+	}
+	// Mode 0755 for scripts. The file is streamed, where CopyFile reads it into memory.
+	err = client.CopyPassThru(ctx, file, remotePath, "0755", info.Size(), progressPassThru(ctx))
 	if err != nil {
 		return errors.New("error uploading file: " + err.Error())
 	}
@@ -3,8 +3,24 @@
 package execution
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestExpandTilde(t *testing.T) {
@@ -49,3 +65,351 @@ func TestExpandTilde(t *testing.T) {
 		})
 	}
 }
+
+func TestJumpHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("Host bastion\n  HostName 203.0.113.1\n  User jump\n  IdentityFile ~/.ssh/jump\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original := config.SSHConfigPath
+	config.SSHConfigPath = path
+	defer func() { config.SSHConfigPath = original }()
+
+	host := config.Host{IP: "10.0.0.5", Username: "bench", KeyFile: "~/.ssh/bench", ProxyJump: "bastion, admin@[2001:db8::1]:2200"}
+	hops, err := jumpHosts(host)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []config.Host{
+		{IP: "203.0.113.1", Username: "jump", KeyFile: "~/.ssh/jump"},
+		{IP: "2001:db8::1", Port: 2200, Username: "admin", KeyFile: "~/.ssh/bench"},
+	}
+	if len(hops) != len(want) {
+		t.Fatalf("hops = %+v, want %+v", hops, want)
+	}
+	for i := range want {
+		if hops[i] != want[i] {
+			t.Fatalf("hops[%d] = %+v, want %+v", i, hops[i], want[i])
+		}
+	}
+	if got := sshAddress(hops[1]); got != "[2001:db8::1]:2200" {
+		t.Fatalf("address = %q", got)
+	}
+	if _, err := jumpHosts(config.Host{ProxyJump: "bastion:ssh"}); err == nil {
+		t.Fatalf("expected an invalid port error")
+	}
+}
+
+func TestClientConfigAppliesSSHOptions(t *testing.T) {
+	host := config.Host{Username: "admin", Password: "secret", SSH: &config.SSHOptions{
+		ConnectTimeout:    "5s",
+		Ciphers:           []string{"aes128-cbc"},
+		KeyExchanges:      []string{"diffie-hellman-group1-sha1"},
+		MACs:              []string{"hmac-sha1"},
+		HostKeyAlgorithms: []string{"ssh-rsa"},
+	}}
+	sshConfig, err := clientConfig(host, slog.Default())
+	if err != nil {
+		t.Fatalf("clientConfig: %v", err)
+	}
+	if sshConfig.Timeout != 5*time.Second || sshConfig.Ciphers[0] != "aes128-cbc" || sshConfig.KeyExchanges[0] != "diffie-hellman-group1-sha1" ||
+		sshConfig.MACs[0] != "hmac-sha1" || sshConfig.HostKeyAlgorithms[0] != "ssh-rsa" {
+		t.Fatalf("options not applied: %+v", sshConfig)
+	}
+}
+
+func TestDialSSHExplainsAlgorithmMismatch(t *testing.T) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true, Config: ssh.Config{Ciphers: []string{"aes128-ctr"}}}
+	serverConfig.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _, _, _ = ssh.NewServerConn(conn, serverConfig)
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	host := config.Host{IP: "127.0.0.1", Port: addr.Port, Username: "admin", Password: "secret", SSH: &config.SSHOptions{
+		Ciphers: []string{"aes256-gcm@openssh.com"},
+	}}
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	_, err = DialSSH(host, logger)
+	if err == nil {
+		t.Fatal("expected the connection to fail")
+	}
+	for _, want := range []string{"admin@127.0.0.1:" + strconv.Itoa(addr.Port), "no common algorithm", "ssh ciphers"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q does not contain %q", err, want)
+		}
+	}
+	if !strings.Contains(logs.String(), "ssh connecting") || !strings.Contains(logs.String(), "ciphers=aes256-gcm@openssh.com") {
+		t.Fatalf("missing debug logs:\n%s", logs.String())
+	}
+}
+
+func TestDialSSHFallsBackToKeyboardInteractive(t *testing.T) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Like sshd with PasswordAuthentication no and PAM behind keyboard-interactive.
+	serverConfig := &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge("", "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 1 || answers[0] != "secret" {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	serverConfig.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serverConn, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				defer serverConn.Close()
+				go ssh.DiscardRequests(requests)
+				for channel := range channels {
+					_ = channel.Reject(ssh.Prohibited, "no sessions")
+				}
+			}()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	client, err := DialSSH(config.Host{IP: "127.0.0.1", Port: port, Username: "admin", Password: "secret"}, nil)
+	if err != nil {
+		t.Fatalf("DialSSH: %v", err)
+	}
+	client.Close()
+
+	_, err = DialSSH(config.Host{IP: "127.0.0.1", Port: port, Username: "admin", Password: "wrong"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "offered: password,keyboard-interactive") {
+		t.Fatalf("expected an authentication error naming the offered methods, got %v", err)
+	}
+}
+
+func TestDialBoundsHandshakeThroughJumpHost(t *testing.T) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The target accepts connections and never sends its SSH version.
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	// The jump host forwards direct-tcpip channels.
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+	jump, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jump.Close()
+	go func() {
+		conn, err := jump.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			forwarded, err := net.Dial("tcp", target.Addr().String())
+			if err != nil {
+				_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				_ = forwarded.Close()
+				continue
+			}
+			go ssh.DiscardRequests(channelRequests)
+			go func() {
+				defer channel.Close()
+				defer forwarded.Close()
+				go func() { _, _ = io.Copy(forwarded, channel) }()
+				_, _ = io.Copy(channel, forwarded)
+			}()
+		}
+	}()
+
+	sshConfig := &ssh.ClientConfig{User: "bench", HostKeyCallback: ssh.InsecureIgnoreHostKey(), Timeout: 200 * time.Millisecond}
+	jumpClient, err := dial(nil, jump.Addr().String(), sshConfig)
+	if err != nil {
+		t.Fatalf("dial jump host: %v", err)
+	}
+	defer jumpClient.Close()
+
+	started := time.Now()
+	_, err = dial([]*ssh.Client{jumpClient}, target.Addr().String(), sshConfig)
+	if err == nil || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected the handshake to time out, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("expected the dial to stop after connect_timeout, it took %s", elapsed)
+	}
+}
+
+func TestAnswerPasswordRefusesClearTextQuestions(t *testing.T) {
+	challenge := answerPassword("secret")
+	answers, err := challenge("", "", []string{"Password: ", "Password again: "}, []bool{false, false})
+	if err != nil || len(answers) != 2 || answers[0] != "secret" || answers[1] != "secret" {
+		t.Fatalf("answers = %v, %v", answers, err)
+	}
+	if _, err := challenge("", "", []string{"Verification code: "}, []bool{true}); err == nil || !strings.Contains(err.Error(), "Verification code:") {
+		t.Fatalf("expected a clear-text question to be refused, got %v", err)
+	}
+}
+
+func TestRunCommandReconnectsDroppedConnection(t *testing.T) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) { return nil, nil },
+	}
+	serverConfig.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+			go serveExitZero(conn, serverConfig)
+		}
+	}()
+	dropConnections := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	host := config.Host{IP: "127.0.0.1", Port: port, Username: "admin", Password: "secret"}
+	client, err := DialSSH(host, nil)
+	if err != nil {
+		t.Fatalf("DialSSH: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.RunCommand(context.Background(), CommandRequest{Command: "true"}); err != nil {
+		t.Fatalf("RunCommand: %v", err)
+	}
+	dropConnections()
+	if _, err := client.RunCommand(context.Background(), CommandRequest{Command: "true"}); err != nil {
+		t.Fatalf("expected the command to run on a new connection, got %v", err)
+	}
+	if !Alive(client) {
+		t.Fatal("expected the new connection to be alive")
+	}
+
+	host.SSH = &config.SSHOptions{ReconnectAttempts: -1}
+	noReconnect, err := DialSSH(host, nil)
+	if err != nil {
+		t.Fatalf("DialSSH: %v", err)
+	}
+	defer noReconnect.Close()
+	dropConnections()
+	if _, err := noReconnect.RunCommand(context.Background(), CommandRequest{Command: "true"}); err == nil || !strings.Contains(err.Error(), "reconnecting is disabled") {
+		t.Fatalf("expected the lost connection to fail the command, got %v", err)
+	}
+}
+
+// serveExitZero serves an SSH connection on which every command exits with 0.
+func serveExitZero(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	defer conn.Close()
+	_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for request := range channelRequests {
+				if request.Type != "exec" {
+					_ = request.Reply(false, nil)
+					continue
+				}
+				_ = request.Reply(true, nil)
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				_ = channel.Close()
+			}
+		}()
+	}
+}
@@ -0,0 +1,70 @@
+package execution
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// powerShellExit ends every script with the exit code of its last command: the
+// exit code of a failed native command, or 1 for a failed cmdlet.
+const powerShellExit = "\n$benchctlOK = $?; if (-not $benchctlOK) { if ($LASTEXITCODE) { exit $LASTEXITCODE }; exit 1 }"
+
+// Windows client running every command as a PowerShell script on a Windows host
+// reached through the client of its OpenSSH server.
+type windowsClient struct {
+	ExecutionClient
+	shell string
+}
+
+// NewWindowsClient creates a client whose commands are PowerShell scripts, run
+// with shell ("powershell" or "pwsh") whatever the default shell of the OpenSSH
+// server is. File transfers go through client unchanged.
+func NewWindowsClient(client ExecutionClient, shell string) ExecutionClient {
+	if shell == "" {
+		shell = "powershell"
+	}
+	return &windowsClient{ExecutionClient: client, shell: shell}
+}
+
+// RunCommand runs the PowerShell script of req.
+func (c *windowsClient) RunCommand(ctx context.Context, req CommandRequest) (CommandResult, error) {
+	req.Command = PowerShellCommand(c.shell, req.Command)
+	return c.ExecutionClient.RunCommand(ctx, req)
+}
+
+// CheckPort checks if a port is listening on the host by connecting to it, since
+// Windows ships no nc.
+func (c *windowsClient) CheckPort(ctx context.Context, port string, timeout time.Duration) (bool, error) {
+	subCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	script := fmt.Sprintf("$c = New-Object Net.Sockets.TcpClient; try { $c.Connect('127.0.0.1', %s); exit 0 } catch { exit 1 } finally { $c.Close() }", PowerShellQuote(port))
+	result, err := c.RunCommand(subCtx, CommandRequest{Command: script})
+	if result.ExitCode == 1 {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PowerShellCommand returns the invocation of shell running script, passed as
+// -EncodedCommand so that neither cmd.exe nor PowerShell, whichever the OpenSSH
+// server starts, reinterprets its quotes.
+func PowerShellCommand(shell, script string) string {
+	encoded := utf16.Encode([]rune(script + powerShellExit))
+	data := make([]byte, 0, 2*len(encoded))
+	for _, unit := range encoded {
+		data = append(data, byte(unit), byte(unit>>8))
+	}
+	return shell + " -NoLogo -NonInteractive -NoProfile -ExecutionPolicy Bypass -EncodedCommand " + base64.StdEncoding.EncodeToString(data)
+}
+
+// PowerShellQuote quotes s as a PowerShell string literal.
+func PowerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,48 @@
+//go:build unit
+
+package execution
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// decodePowerShellCommand returns the shell and script of a PowerShellCommand.
+func decodePowerShellCommand(t *testing.T, command string) (string, string) {
+	t.Helper()
+	fields := strings.Fields(command)
+	data, err := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+	if err != nil || len(data)%2 != 0 {
+		t.Fatalf("invalid encoded command %q: %v", command, err)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	return fields[0], string(utf16.Decode(units))
+}
+
+func TestWindowsClientEncodesPowerShellScripts(t *testing.T) {
+	recorder := &recordingClient{}
+	client := NewWindowsClient(recorder, "pwsh")
+	script := `$env:TARGET = 'it''s'; & "C:\bench\load.exe" --rps 100`
+	if _, err := client.RunCommand(context.Background(), CommandRequest{Command: script}); err != nil {
+		t.Fatal(err)
+	}
+	shell, decoded := decodePowerShellCommand(t, recorder.commands[0])
+	if shell != "pwsh" || decoded != script+powerShellExit {
+		t.Fatalf("RunCommand ran %s %q", shell, decoded)
+	}
+	if strings.ContainsAny(recorder.commands[0], `'"$&`) {
+		t.Fatalf("expected the script to be passed encoded, got %q", recorder.commands[0])
+	}
+	if shell, _ := decodePowerShellCommand(t, PowerShellCommand("powershell", "exit 0")); shell != "powershell" {
+		t.Fatalf("shell = %q", shell)
+	}
+	if got := PowerShellQuote("it's"); got != "'it''s'" {
+		t.Fatalf("PowerShellQuote() = %s", got)
+	}
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// checkExpectations evaluates the stage's expect entries against the numeric custom
+// metadata collected so far, converted to the units of the thresholds. Missing or
+// non-numeric metrics, and values without a unit to convert, violate the expectation.
+func checkExpectations(stage config.Stage, metadata *RunMetadata) error {
+	var violations []string
+	for _, expr := range stage.Expect {
+		expectation, err := config.ParseExpectation(expr)
+		if err != nil {
+			return fmt.Errorf("stage %s: %w", stage.Name, err)
+		}
+		raw, ok := metadata.Custom[expectation.Metric]
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%s (metric not recorded)", expectation))
+			continue
+		}
+		value, err := expectation.MetricValue(raw)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("%s (%v)", expectation, err))
+			continue
+		}
+		if !expectation.Holds(value) {
+			violations = append(violations, fmt.Sprintf("%s (got %s)", expectation, raw))
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("stage %s expectations failed: %s", stage.Name, strings.Join(violations, "; "))
+	}
+	return nil
+}
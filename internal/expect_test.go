@@ -0,0 +1,67 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestCheckExpectations(t *testing.T) {
+	metadata := &RunMetadata{Custom: map[string]string{"error_rate": "0.02", "rps": "1200", "branch": "main", "latency_p99_ms": "300"}}
+	tests := []struct {
+		name    string
+		expect  []string
+		contain string
+	}{
+		{name: "all hold", expect: []string{"rps >= 1000", "error_rate < 0.05"}},
+		{name: "violated", expect: []string{"error_rate < 0.01"}, contain: "error_rate < 0.01 (got 0.02)"},
+		{name: "missing metric", expect: []string{"p99_ms < 10"}, contain: "p99_ms < 10 (metric not recorded)"},
+		{name: "units", expect: []string{"rps > 1k rps", "latency_p99_ms < 1s"}},
+		{name: "violated with units", expect: []string{"latency_p99_ms < 250ms"}, contain: "latency_p99_ms < 250ms (got 300)"},
+		{name: "non-numeric metric", expect: []string{"branch == 1"}, contain: `(value "main" is not numeric)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkExpectations(config.Stage{Name: "load", Expect: tt.expect}, metadata)
+			if tt.contain == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.contain) {
+				t.Fatalf("expected error containing %q, got %v", tt.contain, err)
+			}
+		})
+	}
+}
+
+func TestExecuteStagesAbortsOnFailedExpectation(t *testing.T) {
+	tempDir := t.TempDir()
+	marker := filepath.Join(tempDir, "ran")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "expect", OutputDir: tempDir},
+		Stages: []config.Stage{
+			{Name: "load", Command: "true", Expect: []string{"error_rate < 0.01"}},
+			{Name: "plot", Command: "touch '" + marker + "'"},
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metadata := &RunMetadata{RunID: "1", Custom: map[string]string{"error_rate": "0.3"}}
+	err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil)
+	if err == nil || !strings.Contains(err.Error(), "stage load expectations failed") {
+		t.Fatalf("expected expectation failure, got %v", err)
+	}
+	if _, statErr := os.Stat(marker); !os.IsNotExist(statErr) {
+		t.Fatalf("expected remaining stages to be skipped")
+	}
+}
@@ -0,0 +1,274 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricPrefix = "benchctl_"
+
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// FormatOpenMetrics renders the numeric custom metadata of a run as OpenMetrics gauges.
+// Non-numeric custom metadata is attached to every sample as labels, together with
+// the run ID and benchmark name.
+func FormatOpenMetrics(metadata *RunMetadata) string {
+	return formatMetrics(metadata, true)
+}
+
+// PushMetrics pushes the numeric custom metadata of a run to a Prometheus Pushgateway.
+// The run is grouped under job and its run ID, so repeated pushes replace the same group.
+func PushMetrics(ctx context.Context, gatewayURL, job string, metadata *RunMetadata) error {
+	if strings.TrimSpace(gatewayURL) == "" {
+		return fmt.Errorf("pushgateway url must be set")
+	}
+	if strings.TrimSpace(job) == "" {
+		job = metadata.BenchmarkName
+	}
+	target := fmt.Sprintf("%s/metrics/job/%s/run_id/%s",
+		strings.TrimRight(gatewayURL, "/"), url.PathEscape(job), url.PathEscape(metadata.RunID))
+
+	body := formatMetrics(metadata, false)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("push metrics: pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func formatMetrics(metadata *RunMetadata, openMetrics bool) string {
+	labels := map[string]string{
+		"run_id":    metadata.RunID,
+		"benchmark": metadata.BenchmarkName,
+	}
+	values := map[string]float64{}
+	for key, value := range metadata.Custom {
+		if f, ok := parseFloat(value); ok {
+			values[metricName(key)] = *f
+			continue
+		}
+		labels[labelName(key)] = value
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	labelSet := formatLabels(labels)
+
+	var out bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&out, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(&out, "%s%s %s\n", name, labelSet, strconv.FormatFloat(values[name], 'g', -1, 64))
+	}
+	if openMetrics {
+		out.WriteString("# EOF\n")
+	}
+	return out.String()
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", key, labelValueEscaper.Replace(labels[key])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func metricName(key string) string {
+	return metricPrefix + sanitizeMetricKey(key)
+}
+
+func labelName(key string) string {
+	name := sanitizeMetricKey(key)
+	if name == "run_id" || name == "benchmark" {
+		return "custom_" + name
+	}
+	return name
+}
+
+func sanitizeMetricKey(key string) string {
+	name := invalidMetricChars.ReplaceAllString(strings.TrimSpace(key), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// benchmarkRuns summarizes the stored runs of one benchmark for FormatStoreMetrics.
+type benchmarkRuns struct {
+	statuses map[string]int
+	latest   *RunMetadata // latest finished run, nil while none has finished
+	bytes    int64
+}
+
+// storedRun identifies a finished run whose disk usage StoreMetrics remembers.
+type storedRun struct {
+	store ResultStore
+	runID string
+	end   time.Time
+}
+
+// StoreMetrics renders the gauges of FormatStoreMetrics, and remembers the disk
+// usage of finished runs so that repeated scrapes do not walk their files again.
+// Stores are told apart by identity, so pass the same store values on every call.
+type StoreMetrics struct {
+	mu    sync.Mutex
+	sizes map[storedRun]int64
+}
+
+// NewStoreMetrics returns a StoreMetrics with an empty disk usage cache.
+func NewStoreMetrics() *StoreMetrics {
+	return &StoreMetrics{sizes: map[storedRun]int64{}}
+}
+
+// FormatStoreMetrics renders Prometheus gauges about the runs of stores, per
+// benchmark: the number of runs by status, the status, duration, and end time of
+// the latest finished run, and the bytes the runs occupy. Stores whose output
+// directory does not exist yet are skipped, and runs that cannot be read are
+// counted in benchctl_store_read_errors instead of failing the scrape. The gauges
+// let the benchmark infrastructure itself be monitored and alerted on.
+func FormatStoreMetrics(ctx context.Context, stores ...ResultStore) (string, error) {
+	return NewStoreMetrics().Format(ctx, stores...)
+}
+
+// Format renders the gauges of FormatStoreMetrics for stores.
+func (m *StoreMetrics) Format(ctx context.Context, stores ...ResultStore) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	benchmarks := map[string]*benchmarkRuns{}
+	readErrors := 0
+	for _, store := range stores {
+		runIDs, err := store.ListRuns(ctx)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // no run has been stored yet
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, runID := range runIDs {
+			metadata, err := store.LoadMetadata(ctx, runID)
+			if err != nil {
+				readErrors++
+				continue
+			}
+			finished := metadata.Status != "running" && !metadata.EndTime.IsZero()
+			key := storedRun{store: store, runID: runID, end: metadata.EndTime}
+			size, cached := m.sizes[key]
+			if !cached {
+				artifacts, err := store.ListArtifacts(ctx, runID)
+				if err != nil {
+					readErrors++
+					continue
+				}
+				for _, artifact := range artifacts {
+					size += artifact.Size
+				}
+				if finished {
+					m.sizes[key] = size
+				}
+			}
+			summary, ok := benchmarks[metadata.BenchmarkName]
+			if !ok {
+				summary = &benchmarkRuns{statuses: map[string]int{}}
+				benchmarks[metadata.BenchmarkName] = summary
+			}
+			summary.statuses[metadata.Status]++
+			if finished && (summary.latest == nil || !metadata.StartTime.Before(summary.latest.StartTime)) {
+				summary.latest = metadata
+			}
+			summary.bytes += size
+		}
+	}
+
+	names := make([]string, 0, len(benchmarks))
+	for name := range benchmarks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out bytes.Buffer
+	header := func(name, help string) {
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	sample := func(name string, labels map[string]string, value float64) {
+		fmt.Fprintf(&out, "%s%s %s\n", name, formatLabels(labels), strconv.FormatFloat(value, 'f', -1, 64))
+	}
+
+	header(metricPrefix+"stored_runs", "Stored runs by status.")
+	for _, name := range names {
+		statuses := benchmarks[name].statuses
+		keys := make([]string, 0, len(statuses))
+		for status := range statuses {
+			keys = append(keys, status)
+		}
+		sort.Strings(keys)
+		for _, status := range keys {
+			sample(metricPrefix+"stored_runs", map[string]string{"benchmark": name, "status": status}, float64(statuses[status]))
+		}
+	}
+	gauges := []struct {
+		name, help string
+		latest     bool // only reported for benchmarks with a finished run
+		value      func(summary *benchmarkRuns) float64
+	}{
+		{"last_run_success", "Whether the latest run succeeded.", true, func(summary *benchmarkRuns) float64 {
+			if summary.latest.Status == "success" {
+				return 1
+			}
+			return 0
+		}},
+		{"last_run_duration_seconds", "Duration of the latest run.", true, func(summary *benchmarkRuns) float64 {
+			return max(summary.latest.EndTime.Sub(summary.latest.StartTime).Seconds(), 0)
+		}},
+		{"last_run_end_timestamp_seconds", "Unix time the latest run ended.", true, func(summary *benchmarkRuns) float64 {
+			return float64(summary.latest.EndTime.Unix())
+		}},
+		{"stored_bytes", "Size of the files of the stored runs.", false, func(summary *benchmarkRuns) float64 {
+			return float64(summary.bytes)
+		}},
+	}
+	for _, gauge := range gauges {
+		header(metricPrefix+gauge.name, gauge.help)
+		for _, name := range names {
+			if gauge.latest && benchmarks[name].latest == nil {
+				continue
+			}
+			sample(metricPrefix+gauge.name, map[string]string{"benchmark": name}, gauge.value(benchmarks[name]))
+		}
+	}
+	header(metricPrefix+"store_read_errors", "Stored runs whose metadata or files could not be read.")
+	fmt.Fprintf(&out, "%sstore_read_errors %d\n", metricPrefix, readErrors)
+	return out.String(), nil
+}
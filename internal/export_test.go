@@ -0,0 +1,190 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatOpenMetrics(t *testing.T) {
+	metadata := &RunMetadata{
+		RunID:         "3",
+		BenchmarkName: "api",
+		Custom: map[string]string{
+			"latency_p95_ms": "12.5",
+			"rps":            "1000",
+			"branch":         "main",
+			"note":           `say "hi"`,
+		},
+	}
+
+	got := FormatOpenMetrics(metadata)
+	want := `# TYPE benchctl_latency_p95_ms gauge
+benchctl_latency_p95_ms{benchmark="api",branch="main",note="say \"hi\"",run_id="3"} 12.5
+# TYPE benchctl_rps gauge
+benchctl_rps{benchmark="api",branch="main",note="say \"hi\"",run_id="3"} 1000
+# EOF
+`
+	if got != want {
+		t.Fatalf("FormatOpenMetrics() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatStoreMetrics(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStore(dir)
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	runs := []*RunMetadata{
+		{RunID: "1", BenchmarkName: "api", Status: "success", StartTime: start, EndTime: start.Add(time.Minute)},
+		{RunID: "2", BenchmarkName: "api", Status: "failed", StartTime: start.Add(time.Hour), EndTime: start.Add(time.Hour + 90*time.Second)},
+		{RunID: "3", BenchmarkName: "db", Status: "success", StartTime: start, EndTime: start.Add(time.Second)},
+		{RunID: "4", BenchmarkName: "api", Status: "running", StartTime: start.Add(2 * time.Hour)},
+	}
+	var apiBytes int64
+	for _, metadata := range runs {
+		if err := os.Mkdir(filepath.Join(dir, metadata.RunID), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveMetadata(context.Background(), metadata.RunID, metadata); err != nil {
+			t.Fatalf("SaveMetadata: %v", err)
+		}
+		if metadata.BenchmarkName != "api" {
+			continue
+		}
+		if err := store.WriteArtifact(context.Background(), metadata.RunID, "out.txt", strings.NewReader("12345")); err != nil {
+			t.Fatalf("WriteArtifact: %v", err)
+		}
+		artifacts, _ := store.ListArtifacts(context.Background(), metadata.RunID)
+		for _, artifact := range artifacts {
+			apiBytes += artifact.Size
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "5"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "5", metadataFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FormatStoreMetrics(context.Background(), store, NewLocalStore(filepath.Join(dir, "missing")))
+	if err != nil {
+		t.Fatalf("FormatStoreMetrics: %v", err)
+	}
+	for _, want := range []string{
+		"# TYPE benchctl_stored_runs gauge\n",
+		`benchctl_stored_runs{benchmark="api",status="failed"} 1` + "\n",
+		`benchctl_stored_runs{benchmark="api",status="success"} 1` + "\n",
+		`benchctl_stored_runs{benchmark="api",status="running"} 1` + "\n",
+		`benchctl_stored_runs{benchmark="db",status="success"} 1` + "\n",
+		`benchctl_last_run_success{benchmark="api"} 0` + "\n",
+		`benchctl_last_run_success{benchmark="db"} 1` + "\n",
+		`benchctl_last_run_duration_seconds{benchmark="api"} 90` + "\n",
+		`benchctl_last_run_end_timestamp_seconds{benchmark="db"} ` + strconv.FormatInt(start.Add(time.Second).Unix(), 10) + "\n",
+		`benchctl_stored_bytes{benchmark="api"} ` + strconv.FormatInt(apiBytes, 10) + "\n",
+		"benchctl_store_read_errors 1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestStoreMetricsCachesFinishedRunSizes(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStore(dir)
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	runs := []*RunMetadata{
+		{RunID: "1", BenchmarkName: "api", Status: "success", StartTime: start, EndTime: start.Add(time.Minute)},
+		{RunID: "2", BenchmarkName: "api", Status: "running", StartTime: start.Add(time.Hour)},
+	}
+	for _, metadata := range runs {
+		if err := os.Mkdir(filepath.Join(dir, metadata.RunID), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveMetadata(context.Background(), metadata.RunID, metadata); err != nil {
+			t.Fatalf("SaveMetadata: %v", err)
+		}
+	}
+	storedBytes := func(m *StoreMetrics) string {
+		t.Helper()
+		got, err := m.Format(context.Background(), store)
+		if err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		for _, line := range strings.Split(got, "\n") {
+			if value, ok := strings.CutPrefix(line, `benchctl_stored_bytes{benchmark="api"} `); ok {
+				return value
+			}
+		}
+		t.Fatalf("no stored_bytes sample in\n%s", got)
+		return ""
+	}
+
+	metrics := NewStoreMetrics()
+	before := storedBytes(metrics)
+	for _, runID := range []string{"1", "2"} {
+		if err := store.WriteArtifact(context.Background(), runID, "out.txt", strings.NewReader("12345")); err != nil {
+			t.Fatalf("WriteArtifact: %v", err)
+		}
+	}
+	after := storedBytes(metrics)
+	want, _ := strconv.Atoi(before)
+	if got, _ := strconv.Atoi(after); got != want+5 {
+		t.Fatalf("stored_bytes = %s after %s, want only the running run to be measured again", after, before)
+	}
+}
+
+func TestSanitizeMetricKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "latency_ms", want: "latency_ms"},
+		{key: "latency.p99-ms", want: "latency_p99_ms"},
+		{key: "99th", want: "_99th"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := sanitizeMetricKey(tt.key); got != tt.want {
+				t.Fatalf("sanitizeMetricKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	var gotPath, gotMethod, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotMethod = r.Method
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	metadata := &RunMetadata{RunID: "7", BenchmarkName: "api", Custom: map[string]string{"rps": "10"}}
+	if err := PushMetrics(context.Background(), server.URL+"/", "", metadata); err != nil {
+		t.Fatalf("PushMetrics: %v", err)
+	}
+	if gotMethod != http.MethodPut {
+		t.Fatalf("method = %s, want PUT", gotMethod)
+	}
+	if gotPath != "/metrics/job/api/run_id/7" {
+		t.Fatalf("path = %s", gotPath)
+	}
+	want := "# TYPE benchctl_rps gauge\nbenchctl_rps{benchmark=\"api\",run_id=\"7\"} 10\n"
+	if gotBody != want {
+		t.Fatalf("body = %q, want %q", gotBody, want)
+	}
+}
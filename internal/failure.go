@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// StageFailure records a stage that failed on one host after all of its attempts.
+type StageFailure struct {
+	Stage    string `json:"stage"`
+	Case     string `json:"case,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+}
+
+// failureTracker applies benchmark.failure_policy: it retries failed stages within
+// the run's retry budget and, under on_failure: continue, collects the failures
+// instead of aborting so large fan-out suites report every broken host at once.
+type failureTracker struct {
+	mu          sync.Mutex
+	policy      config.FailurePolicy
+	retriesUsed int
+	failedHosts map[string]struct{} // hosts left out of the remaining stages of the case
+	errs        []error
+	metadata    *RunMetadata
+	logger      *slog.Logger
+}
+
+func newFailureTracker(cfg *config.Config, metadata *RunMetadata, logger *slog.Logger) *failureTracker {
+	policy := config.FailurePolicy{OnFailure: "stop"}
+	if cfg.Benchmark.FailurePolicy != nil {
+		policy = *cfg.Benchmark.FailurePolicy
+	}
+	return &failureTracker{policy: policy, failedHosts: map[string]struct{}{}, metadata: metadata, logger: logger}
+}
+
+// startCase gives every host a fresh start in the next case.
+func (t *failureTracker) startCase() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.failedHosts)
+}
+
+func (t *failureTracker) hostFailed(hostAlias string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, failed := t.failedHosts[hostAlias]
+	return failed
+}
+
+// run calls attempt until it succeeds, the stage retries or the run's retry budget
+// are used up, or ctx is done. It returns the number of attempts made.
+func (t *failureTracker) run(ctx context.Context, stage, hostAlias string, attempt func() error) (int, error) {
+	for attempts := 1; ; attempts++ {
+		err := attempt()
+		if err == nil || attempts > t.policy.Retries || ctx.Err() != nil {
+			return attempts, err
+		}
+		if !t.takeRetry() {
+			t.logger.Warn("retry budget exhausted", "stage", stage, "host", hostAlias, "max_retries", t.policy.MaxRetries)
+			return attempts, err
+		}
+		t.logger.Warn("stage failed, retrying", "stage", stage, "host", hostAlias, "attempt", attempts, "error", err)
+	}
+}
+
+// takeRetry spends one retry of the run budget, if any is left.
+func (t *failureTracker) takeRetry() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.policy.MaxRetries > 0 && t.retriesUsed >= t.policy.MaxRetries {
+		return false
+	}
+	t.retriesUsed++
+	return true
+}
+
+// fail records a failed stage. It returns the error to abort the run with, or nil
+// when the policy lets the remaining stages run.
+func (t *failureTracker) fail(ctx context.Context, err error, stage, caseName, hostAlias string, attempts int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metadata.Failures = append(t.metadata.Failures, StageFailure{
+		Stage:    stage,
+		Case:     caseName,
+		Host:     hostAlias,
+		Attempts: attempts,
+		Error:    err.Error(),
+	})
+	if t.policy.OnFailure != "continue" || ctx.Err() != nil {
+		return errors.Join(append(t.errs, err)...)
+	}
+	t.errs = append(t.errs, err)
+	if hostAlias != "" {
+		t.failedHosts[hostAlias] = struct{}{}
+	}
+	t.logger.Warn("continuing after stage failure", "stage", stage, "case", caseName, "host", hostAlias)
+	return nil
+}
+
+// abort returns err joined with the failures collected so far.
+func (t *failureTracker) abort(err error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return errors.Join(append(t.errs, err)...)
+}
+
+// Err returns every failure collected under on_failure: continue.
+func (t *failureTracker) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return errors.Join(t.errs...)
+}
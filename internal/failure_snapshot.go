@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// failureDir is the directory of a run holding the snapshots of failed stages.
+const failureDir = "failure"
+
+// failureLogLines is how many trailing lines of each failure log are saved.
+const failureLogLines = 1000
+
+// failureSnapshotTimeout bounds the snapshot of a failed stage, so that a host
+// that went away does not hold up the rest of the run.
+const failureSnapshotTimeout = 30 * time.Second
+
+// snapshotFailedStage saves what a failed stage left on hostAlias below
+// failure/<stage>/<[case.]host> of the run directory: its outputs as far as they
+// exist, the last lines of its failure_logs, and its console output. It is best
+// effort; files that cannot be collected are logged and skipped, and the run
+// fails with the error of the stage either way.
+func snapshotFailedStage(
+	ctx context.Context,
+	client execution.ExecutionClient,
+	runDir string,
+	stage config.Stage,
+	benchmarkCase config.Case,
+	hostAlias string,
+	env map[string]string,
+	consoleOutput string,
+	logger *slog.Logger,
+) {
+	if len(stage.Outputs) == 0 && len(stage.FailureLogs) == 0 && consoleOutput == "" {
+		return
+	}
+	// The run context may be cancelled already, e.g. by the watchdog.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), failureSnapshotTimeout)
+	defer cancel()
+
+	name := cacheFileName(hostAlias)
+	if benchmarkCase.Name != "" {
+		name = cacheFileName(benchmarkCase.Name) + "." + name
+	}
+	dir := filepath.Join(runDir, failureDir, cacheFileName(stage.Name), name)
+	var saved int
+	save := func(file string, write func(localPath string) error) {
+		localPath := filepath.Join(dir, filepath.FromSlash(file))
+		err := os.MkdirAll(filepath.Dir(localPath), 0755)
+		if err == nil {
+			err = write(localPath)
+		}
+		if err != nil {
+			logger.Warn("failure snapshot incomplete", "stage", stage.Name, "host", hostAlias, "file", file, "error", err)
+			return
+		}
+		saved++
+	}
+
+	if consoleOutput != "" {
+		save("console.log", func(localPath string) error {
+			return os.WriteFile(localPath, []byte(consoleOutput), 0644)
+		})
+	}
+	for _, output := range stage.Outputs {
+		resolved, err := resolveOutput(output, env)
+		if err != nil {
+			logger.Warn("failure snapshot incomplete", "stage", stage.Name, "host", hostAlias, "output", output.Name, "error", err)
+			continue
+		}
+		files := []resolvedOutput{resolved}
+		if hasGlob(resolved.remotePath) {
+			if files, err = expandOutputGlob(ctx, client, resolved); err != nil {
+				logger.Warn("failure snapshot incomplete", "stage", stage.Name, "host", hostAlias, "output", output.Name, "error", err)
+				continue
+			}
+		}
+		for _, file := range files {
+			save(path.Join("outputs", file.localFilename), func(localPath string) error {
+				return client.Scp(ctx, file.remotePath, localPath)
+			})
+		}
+	}
+	for _, logPath := range stage.FailureLogs {
+		save(path.Join("logs", path.Base(logPath)), func(localPath string) error {
+			command := fmt.Sprintf("tail -n %d -- %s", failureLogLines, shellQuote(logPath))
+			result, err := client.RunCommand(ctx, execution.CommandRequest{Command: command})
+			if err == nil && result.ExitCode != 0 {
+				err = fmt.Errorf("exit code %d: %s", result.ExitCode, result.Output)
+			}
+			if err != nil {
+				return fmt.Errorf("read %s: %w", logPath, err)
+			}
+			return os.WriteFile(localPath, []byte(result.Output), 0644)
+		})
+	}
+	if saved > 0 {
+		logger.Info("failure snapshot saved", "stage", stage.Name, "host", hostAlias, "dir", dir, "files", saved)
+	}
+}
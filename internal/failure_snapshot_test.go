@@ -0,0 +1,51 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestFailedStageSnapshotsOutputsAndLogs(t *testing.T) {
+	remote := t.TempDir()
+	outputDir := t.TempDir()
+	partial := filepath.Join(remote, "partial.csv")
+	serverLog := filepath.Join(remote, "server.log")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "snapshot", OutputDir: outputDir},
+		Stages: []config.Stage{{
+			Name:        "load",
+			Command:     "echo started; printf 'p50\\n12\\n' > " + partial + "; echo 'panic: out of memory' > " + serverLog + "; exit 3",
+			Outputs:     []config.Output{{Name: "latency", RemotePath: partial}, {Name: "summary", RemotePath: filepath.Join(remote, "summary.json")}},
+			FailureLogs: []string{serverLog, filepath.Join(remote, "missing.log")},
+		}},
+	}
+	if _, err := RunWorkflow(context.Background(), cfg, nil, nil); err == nil {
+		t.Fatal("expected the stage to fail")
+	}
+	dirs, err := filepath.Glob(filepath.Join(outputDir, "*", failureDir, "load", "local"))
+	if err != nil || len(dirs) != 1 {
+		t.Fatalf("expected one failure snapshot, got %v (%v)", dirs, err)
+	}
+	for file, want := range map[string]string{
+		"outputs/latency.csv": "p50\n12\n",
+		"logs/server.log":     "panic: out of memory\n",
+		"console.log":         "started",
+	} {
+		data, err := os.ReadFile(filepath.Join(dirs[0], filepath.FromSlash(file)))
+		if err != nil || !strings.Contains(string(data), want) {
+			t.Errorf("%s = %q, %v, want %q", file, data, err, want)
+		}
+	}
+	for _, file := range []string{"outputs/summary.json", "logs/missing.log"} {
+		if _, err := os.Stat(filepath.Join(dirs[0], filepath.FromSlash(file))); !os.IsNotExist(err) {
+			t.Errorf("expected no %s, got %v", file, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestExecuteStagesContinuesAfterFailedHost(t *testing.T) {
+	tempDir := t.TempDir()
+	logPath := filepath.Join(tempDir, "executions.log")
+	record := func(step string) string {
+		return "echo \"$BENCHCTL_HOST " + step + "\" >> '" + logPath + "'"
+	}
+
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{
+			Name:          "fan-out",
+			OutputDir:     tempDir,
+			FailurePolicy: &config.FailurePolicy{OnFailure: "continue", Retries: 2, MaxRetries: 1},
+		},
+		Hosts: map[string]config.Host{"vm1": {}, "vm2": {}, "vm3": {}},
+		Stages: []config.Stage{
+			{
+				Name:    "setup",
+				Hosts:   []string{"vm1", "vm2", "vm3"},
+				Command: record("setup") + "; [ \"$BENCHCTL_HOST\" = vm1 ]",
+			},
+			{
+				Name:    "load",
+				Hosts:   []string{"vm1", "vm2", "vm3"},
+				Command: record("load"),
+			},
+		},
+	}
+	metadata := &RunMetadata{RunID: "1", Custom: map[string]string{}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil)
+	if err == nil {
+		t.Fatalf("expected the collected failures to fail the run")
+	}
+	if stageErrs := stageErrors(err); len(stageErrs) != 2 || stageErrs[0].Host != "vm2" || stageErrs[1].Host != "vm3" {
+		t.Fatalf("expected failures on vm2 and vm3, got %v", err)
+	}
+
+	data, readErr := os.ReadFile(logPath)
+	if readErr != nil {
+		t.Fatalf("read executions: %v", readErr)
+	}
+	// vm2 uses the single retry of the run budget; vm3 gets no retry.
+	want := "vm1 setup\nvm2 setup\nvm2 setup\nvm3 setup\nvm1 load\n"
+	if string(data) != want {
+		t.Fatalf("executions = %q, want %q", string(data), want)
+	}
+	if len(metadata.Failures) != 2 || metadata.Failures[0].Attempts != 2 || metadata.Failures[1].Attempts != 1 {
+		t.Fatalf("unexpected failure records: %+v", metadata.Failures)
+	}
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// fanOutMetrics gathers the metrics_from_output values of stages running on
+// several hosts, so the value of one host does not overwrite the others.
+type fanOutMetrics map[string]map[string]map[string]string // stage -> host -> metrics
+
+// add records the metrics scraped on hostAlias and returns the run metrics of the
+// stage: the scraped metrics unchanged for single-host stages, and otherwise the
+// metrics of every host so far as <host>.<name> plus their aggregates as <name>.
+func (f fanOutMetrics) add(stage config.Stage, hostAliases []string, hostAlias string, metrics map[string]string) map[string]string {
+	if len(hostAliases) < 2 || len(metrics) == 0 {
+		return metrics
+	}
+	hosts, ok := f[stage.Name]
+	if !ok {
+		hosts = map[string]map[string]string{}
+		f[stage.Name] = hosts
+	}
+	hosts[hostAlias] = metrics
+	return combineHostMetrics(stage, hostAliases, hosts)
+}
+
+// combineHostMetrics namespaces the metrics of each host of hostAliases and adds the
+// aggregate of every metrics_from_output rule. A rule with a value that is not a
+// number on some host keeps the value of the last host instead.
+func combineHostMetrics(stage config.Stage, hostAliases []string, hosts map[string]map[string]string) map[string]string {
+	combined := map[string]string{}
+	for _, hostAlias := range hostAliases {
+		for name, value := range hosts[hostAlias] {
+			combined[hostAlias+"."+name] = value
+		}
+	}
+	for _, rule := range stage.MetricsFromOutput {
+		var values []float64
+		var last string
+		numeric := true
+		for _, hostAlias := range hostAliases {
+			value, ok := hosts[hostAlias][rule.Name]
+			if !ok {
+				continue
+			}
+			last = value
+			number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				numeric = false
+				continue
+			}
+			values = append(values, number)
+		}
+		switch {
+		case last == "":
+		case !numeric:
+			combined[rule.Name] = last
+		default:
+			combined[rule.Name] = strconv.FormatFloat(aggregate(rule.Aggregate, values), 'f', -1, 64)
+		}
+	}
+	return combined
+}
+
+func aggregate(kind string, values []float64) float64 {
+	result := values[0]
+	for _, value := range values[1:] {
+		switch kind {
+		case "min":
+			result = min(result, value)
+		case "max":
+			result = max(result, value)
+		default:
+			result += value
+		}
+	}
+	if kind == "mean" || kind == "" {
+		result /= float64(len(values))
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestMultiHostStageRecordsMetricsPerHost(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "fan-out", OutputDir: t.TempDir()},
+		Hosts:     map[string]config.Host{"gen1": {}, "gen2": {}},
+		Stages: []config.Stage{
+			{
+				Name:    "load",
+				Hosts:   []string{"gen1", "gen2"},
+				Command: `if [ "$BENCHCTL_HOST" = gen1 ]; then echo 'rps: 100 p99: 12.5 version: a'; else echo 'rps: 300 p99: 20 version: b'; fi`,
+				MetricsFromOutput: []config.OutputMetric{
+					{Name: "rps", Pattern: `rps: (\d+)`, Aggregate: "sum"},
+					{Name: "p99", Pattern: `p99: ([\d.]+)`, Aggregate: "max"},
+					{Name: "mean_p99", Pattern: `p99: ([\d.]+)`},
+					{Name: "version", Pattern: `version: (\w+)`},
+				},
+				Expect: []string{"rps >= 400", "gen1.rps < 200"},
+			},
+		},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	want := map[string]string{
+		"gen1.rps": "100", "gen2.rps": "300", "rps": "400",
+		"gen1.p99": "12.5", "gen2.p99": "20", "p99": "20",
+		"mean_p99": "16.25", "version": "b", "gen1.version": "a",
+	}
+	for name, value := range want {
+		if got := result.Metadata.Custom[name]; got != value {
+			t.Fatalf("%s = %q, want %q (metrics %v)", name, got, value, result.Metadata.Custom)
+		}
+	}
+
+	store, runID := localRun(result.RunDir)
+	metadata, err := AnalyzeStoredRun(context.Background(), store, runID, nil)
+	if err != nil {
+		t.Fatalf("AnalyzeStoredRun: %v", err)
+	}
+	for name, value := range want {
+		if got := metadata.Custom[name]; got != value {
+			t.Fatalf("reanalyzed %s = %q, want %q", name, got, value)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/parser"
+)
+
+var (
+	annotationDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	annotationPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// InGitHubActions reports whether benchctl runs inside a GitHub Actions job.
+func InGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// GitHubAnnotations returns one ::error workflow command per stage or cleanup failure
+// contained in err. When configData is the content of configPath, before profiles
+// and overrides are applied, each annotation points at the line of the failing
+// step in it. The step is found by name, so a step that only a profile defines
+// gets no line.
+func GitHubAnnotations(err error, configPath string, configData []byte) []string {
+	var annotations []string
+	for _, stageErr := range stageErrors(err) {
+		var properties []string
+		if configPath != "" {
+			properties = append(properties, "file="+annotationPropertyEscaper.Replace(configPath))
+			if line := stepLine(configData, stageErr.Kind, stageErr.Name); line > 0 {
+				properties = append(properties, fmt.Sprintf("line=%d", line))
+			}
+		}
+		title := fmt.Sprintf("benchctl %s %s failed", stageErr.Kind, stageErr.Name)
+		properties = append(properties, "title="+annotationPropertyEscaper.Replace(title))
+		message := stageErr.Error()
+		if stageErr.Host != "" {
+			message = fmt.Sprintf("%s (host: %s)", message, stageErr.Host)
+		}
+		annotations = append(annotations, fmt.Sprintf("::error %s::%s", strings.Join(properties, ","), annotationDataEscaper.Replace(message)))
+	}
+	return annotations
+}
+
+// stageErrors collects every StageError in the tree of err, including joined errors.
+func stageErrors(err error) []*StageError {
+	if err == nil {
+		return nil
+	}
+	switch wrapped := err.(type) {
+	case *StageError:
+		return []*StageError{wrapped}
+	case interface{ Unwrap() []error }:
+		var all []*StageError
+		for _, inner := range wrapped.Unwrap() {
+			all = append(all, stageErrors(inner)...)
+		}
+		return all
+	case interface{ Unwrap() error }:
+		return stageErrors(wrapped.Unwrap())
+	}
+	return nil
+}
+
+// stepLine returns the 1-based line of the stage or cleanup step named name in the
+// YAML, or 0.
+func stepLine(data []byte, kind, name string) int {
+	if len(data) == 0 {
+		return 0
+	}
+	var doc struct {
+		Stages  []struct{ Name string } `yaml:"stages"`
+		Cleanup []struct{ Name string } `yaml:"cleanup"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return 0
+	}
+	section, steps := "stages", doc.Stages
+	if kind == "cleanup" {
+		section, steps = "cleanup", doc.Cleanup
+	}
+	index := slices.IndexFunc(steps, func(step struct{ Name string }) bool { return step.Name == name })
+	if index < 0 {
+		return 0
+	}
+	path, err := yaml.PathString(fmt.Sprintf("$.%s[%d]", section, index))
+	if err != nil {
+		return 0
+	}
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return 0
+	}
+	node, err := path.FilterFile(file)
+	if err != nil || node == nil || node.GetToken() == nil {
+		return 0
+	}
+	return node.GetToken().Position.Line
+}
@@ -0,0 +1,87 @@
+//go:build unit
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestGitHubAnnotations(t *testing.T) {
+	configData := []byte(`benchmark:
+  name: gh
+  output_dir: ./results
+stages:
+  - name: setup
+    command: echo setup
+  - name: load
+    command: exit 1
+cleanup:
+  - name: stop
+    command: exit 2
+`)
+	err := fmt.Errorf("workflow failed: %w", errors.Join(
+		newStageError("stage", 1, "load", "vm1", errors.New("stage load failed: exit status 1")),
+		nil,
+		newStageError("cleanup", 0, "stop", "local", errors.New("cleanup stop failed:\nexit 2")),
+	))
+
+	got := GitHubAnnotations(err, "bench/benchmark.yaml", configData)
+	want := []string{
+		"::error file=bench/benchmark.yaml,line=7,title=benchctl stage load failed::stage load failed: exit status 1 (host: vm1)",
+		"::error file=bench/benchmark.yaml,line=10,title=benchctl cleanup stop failed::cleanup stop failed:%0Aexit 2 (host: local)",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("annotations = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("annotation %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGitHubAnnotationsWithoutConfig(t *testing.T) {
+	err := newStageError("stage", 0, "a,b", "", errors.New("boom"))
+	got := GitHubAnnotations(err, "", nil)
+	if len(got) != 1 || got[0] != "::error title=benchctl stage a%2Cb failed::boom" {
+		t.Fatalf("annotations = %q", got)
+	}
+}
+
+func TestGitHubAnnotationsIgnoresOtherErrors(t *testing.T) {
+	if got := GitHubAnnotations(errors.New("git worktree is dirty"), "benchmark.yaml", nil); len(got) != 0 {
+		t.Fatalf("expected no annotations, got %q", got)
+	}
+}
+
+func TestGitHubAnnotationsFindStepsOfProfiles(t *testing.T) {
+	configData := []byte(`benchmark:
+  name: gh
+  output_dir: ./results
+stages:
+  - name: setup
+    command: echo setup
+  - name: load
+    command: exit 1
+profiles:
+  ci:
+    stages:
+      - name: smoke
+        command: exit 1
+`)
+	// The indexes refer to the config that ran, which the ci profile changed.
+	err := errors.Join(
+		newStageError("stage", 2, "load", "", errors.New("stage load failed")),
+		newStageError("stage", 1, "smoke", "", errors.New("stage smoke failed")),
+	)
+	got := GitHubAnnotations(err, "benchmark.yaml", configData)
+	want := []string{
+		"::error file=benchmark.yaml,line=7,title=benchctl stage load failed::stage load failed",
+		"::error file=benchmark.yaml,title=benchctl stage smoke failed::stage smoke failed",
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("annotations = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,421 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// goBenchAlpha is the significance level below which a delta is reported, as in
+// benchstat.
+const goBenchAlpha = 0.05
+
+// GoBenchTable compares one unit of the Go benchmarks in a gobench output of two
+// runs, like a benchstat table.
+type GoBenchTable struct {
+	Output string         `json:"output"`
+	Unit   string         `json:"unit"`
+	Rows   []GoBenchDelta `json:"rows"`
+}
+
+// GoBenchDelta compares one benchmark between the runs. Old and New are the
+// samples after outliers beyond 1.5 interquartile ranges are removed.
+type GoBenchDelta struct {
+	Name string        `json:"name"`
+	Old  GoBenchSample `json:"old"`
+	New  GoBenchSample `json:"new"`
+	// Delta is the relative change of the means in percent.
+	Delta float64 `json:"delta"`
+	// PValue of the Mann-Whitney U test; the delta is significant below 0.05.
+	PValue      float64 `json:"p_value"`
+	Significant bool    `json:"significant"`
+}
+
+// GoBenchSample summarizes the measurements of one benchmark in one run.
+type GoBenchSample struct {
+	N    int     `json:"n"`
+	Mean float64 `json:"mean"`
+	// Spread is the largest relative distance of a measurement from the mean (the
+	// ± of benchstat), in percent.
+	Spread float64 `json:"spread"`
+}
+
+// goBenchResults holds the measurements of a go test -bench output per benchmark
+// name and unit, in the order they first appear.
+type goBenchResults struct {
+	names  []string
+	units  []string
+	values map[string]map[string][]float64
+}
+
+// parseGoBench reads the benchmark lines of go test -bench output, such as
+// "BenchmarkEncode-8  1000000  1234 ns/op  64 B/op  2 allocs/op". Other lines, like
+// goos: and PASS, are ignored.
+func parseGoBench(r io.Reader) (*goBenchResults, error) {
+	results := &goBenchResults{values: map[string]map[string][]float64{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.ParseUint(fields[1], 10, 64); err != nil {
+			continue
+		}
+		name := strings.TrimPrefix(fields[0], "Benchmark")
+		for i := 2; i < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			results.add(name, fields[i+1], value)
+		}
+	}
+	return results, scanner.Err()
+}
+
+func (r *goBenchResults) add(name, unit string, value float64) {
+	units, ok := r.values[name]
+	if !ok {
+		units = map[string][]float64{}
+		r.values[name] = units
+		r.names = append(r.names, name)
+	}
+	if !slices.Contains(r.units, unit) {
+		r.units = append(r.units, unit)
+	}
+	units[unit] = append(units[unit], value)
+}
+
+// CompareGoBenchmarks compares the outputs with format: gobench that runA and runB
+// both collected, with one table per output and unit.
+func CompareGoBenchmarks(ctx context.Context, store ResultStore, runA, runB string) ([]GoBenchTable, error) {
+	metadataA, err := store.LoadMetadata(ctx, runA)
+	if err != nil {
+		return nil, err
+	}
+	metadataB, err := store.LoadMetadata(ctx, runB)
+	if err != nil {
+		return nil, err
+	}
+	patterns := append(goBenchPatterns(metadataA.Config), goBenchPatterns(metadataB.Config)...)
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	namesA, err := goBenchArtifacts(ctx, store, runA, patterns)
+	if err != nil {
+		return nil, err
+	}
+	namesB, err := goBenchArtifacts(ctx, store, runB, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []GoBenchTable
+	for _, name := range namesA {
+		if !slices.Contains(namesB, name) {
+			continue
+		}
+		resultsA, err := readGoBench(ctx, store, runA, name)
+		if err != nil {
+			return nil, err
+		}
+		resultsB, err := readGoBench(ctx, store, runB, name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, compareGoBenchResults(name, resultsA, resultsB)...)
+	}
+	return tables, nil
+}
+
+var outputTemplatePattern = regexp.MustCompile(`\$\{[^}]*\}|\$[A-Za-z_][A-Za-z0-9_]*`)
+
+// goBenchPatterns returns the stored file names of the gobench outputs of cfg as
+// path.Match patterns, with templates that stayed unresolved in the snapshot, such
+// as ${BENCHCTL_HOST}, matching any name.
+func goBenchPatterns(cfg *config.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	var patterns []string
+	for _, stage := range cfg.Stages {
+		for _, output := range stage.Outputs {
+			if output.Format != "gobench" {
+				continue
+			}
+			name := output.Name + filepath.Ext(output.RemotePath)
+			patterns = append(patterns, outputTemplatePattern.ReplaceAllString(name, "*"))
+		}
+	}
+	return patterns
+}
+
+// goBenchArtifacts returns the names of the files of a run matching patterns,
+// without their compression suffix.
+func goBenchArtifacts(ctx context.Context, store ResultStore, runID string, patterns []string) ([]string, error) {
+	artifacts, err := store.ListArtifacts(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, artifact := range artifacts {
+		name := trimCompressionSuffix(artifact.Name)
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok && !slices.Contains(names, name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+func readGoBench(ctx context.Context, store ResultStore, runID, name string) (*goBenchResults, error) {
+	file, err := openOutputArtifact(ctx, store, runID, name)
+	if err != nil {
+		return nil, fmt.Errorf("output %s: %w", name, err)
+	}
+	defer file.Close()
+	results, err := parseGoBench(file)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	return results, nil
+}
+
+// compareGoBenchResults returns a table per unit for the benchmarks measured in
+// both runs.
+func compareGoBenchResults(output string, a, b *goBenchResults) []GoBenchTable {
+	var tables []GoBenchTable
+	for _, unit := range a.units {
+		table := GoBenchTable{Output: output, Unit: unit}
+		for _, name := range a.names {
+			valuesA, valuesB := a.values[name][unit], b.values[name][unit]
+			if len(valuesA) == 0 || len(valuesB) == 0 {
+				continue
+			}
+			keptA, keptB := withoutOutliers(valuesA), withoutOutliers(valuesB)
+			row := GoBenchDelta{
+				Name:   name,
+				Old:    goBenchSummary(keptA),
+				New:    goBenchSummary(keptB),
+				PValue: mannWhitneyU(keptA, keptB),
+			}
+			if row.Old.Mean != 0 {
+				row.Delta = (row.New.Mean - row.Old.Mean) / row.Old.Mean * 100
+			}
+			row.Significant = row.PValue < goBenchAlpha
+			table.Rows = append(table.Rows, row)
+		}
+		if len(table.Rows) > 0 {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// withoutOutliers drops the values more than 1.5 interquartile ranges outside the
+// quartiles.
+func withoutOutliers(values []float64) []float64 {
+	sorted := slices.Sorted(slices.Values(values))
+	q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+	low, high := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+	kept := make([]float64, 0, len(sorted))
+	for _, value := range sorted {
+		if value >= low && value <= high {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+func goBenchSummary(values []float64) GoBenchSample {
+	sample := GoBenchSample{N: len(values), Mean: summarize(values).Mean}
+	if sample.Mean == 0 {
+		return sample
+	}
+	for _, value := range values {
+		sample.Spread = max(sample.Spread, math.Abs(value-sample.Mean)/math.Abs(sample.Mean)*100)
+	}
+	return sample
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test. It is
+// exact for small samples without ties and uses the normal approximation with tie
+// correction otherwise.
+func mannWhitneyU(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	type observation struct {
+		value float64
+		first bool
+	}
+	all := make([]observation, 0, n1+n2)
+	for _, value := range a {
+		all = append(all, observation{value, true})
+	}
+	for _, value := range b {
+		all = append(all, observation{value, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	var rankSum, tieSum float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // average of the 1-based ranks i+1..j
+		for k := i; k < j; k++ {
+			if all[k].first {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		tieSum += t*t*t - t
+		i = j
+	}
+	u := rankSum - float64(n1*(n1+1))/2
+
+	if tieSum == 0 && n1+n2 <= 40 {
+		counts := uDistribution(n1, n2)
+		var total, below, above float64
+		for value, count := range counts {
+			total += count
+			if float64(value) <= u {
+				below += count
+			}
+			if float64(value) >= u {
+				above += count
+			}
+		}
+		return math.Min(1, 2*math.Min(below, above)/total)
+	}
+
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieSum/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := math.Max(0, math.Abs(u-mean)-0.5) / math.Sqrt(variance)
+	return math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// uDistribution returns how many orderings of n1 and n2 distinct values yield each
+// value of U, from 0 to n1*n2.
+func uDistribution(n1, n2 int) []float64 {
+	// ways[m][n] is the distribution for m and n values; adding a value to the first
+	// sample either ranks it above all n others (U grows by n) or below some of them.
+	ways := make([][][]float64, n1+1)
+	for m := range ways {
+		ways[m] = make([][]float64, n2+1)
+		for n := range ways[m] {
+			ways[m][n] = make([]float64, m*n+1)
+			if m == 0 || n == 0 {
+				ways[m][n][0] = 1
+				continue
+			}
+			for u := range ways[m][n] {
+				if u >= n {
+					ways[m][n][u] += ways[m-1][n][u-n]
+				}
+				if u < len(ways[m][n-1]) {
+					ways[m][n][u] += ways[m][n-1][u]
+				}
+			}
+		}
+	}
+	return ways[n1][n2]
+}
+
+// FormatGoBenchmarks renders Go benchmark comparisons in the layout of benchstat.
+func FormatGoBenchmarks(tables []GoBenchTable) string {
+	var out strings.Builder
+	output := ""
+	for i, table := range tables {
+		if table.Output != output {
+			if i > 0 {
+				out.WriteString("\n")
+			}
+			fmt.Fprintf(&out, "output %s:\n", table.Output)
+			output = table.Output
+		} else {
+			out.WriteString("\n")
+		}
+		label := goBenchUnitLabel(table.Unit)
+		w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "name\told %s\tnew %s\tdelta\n", label, label)
+		for _, row := range table.Rows {
+			delta := "~"
+			if row.Significant {
+				delta = fmt.Sprintf("%+.2f%%", row.Delta)
+			}
+			fmt.Fprintf(w, "%s\t%s ± %.0f%%\t%s ± %.0f%%\t%s\t(p=%.3f n=%d+%d)\n",
+				row.Name,
+				formatGoBenchValue(table.Unit, row.Old.Mean), row.Old.Spread,
+				formatGoBenchValue(table.Unit, row.New.Mean), row.New.Spread,
+				delta, row.PValue, row.Old.N, row.New.N)
+		}
+		_ = w.Flush()
+	}
+	return out.String()
+}
+
+// goBenchUnitLabel names the column of a unit the way benchstat does.
+func goBenchUnitLabel(unit string) string {
+	switch unit {
+	case "ns/op":
+		return "time/op"
+	case "B/op":
+		return "alloc/op"
+	case "MB/s":
+		return "speed"
+	}
+	return unit
+}
+
+// formatGoBenchValue scales time and byte measurements to a readable unit with
+// three significant digits.
+func formatGoBenchValue(unit string, value float64) string {
+	scales := map[string][]struct {
+		factor float64
+		suffix string
+	}{
+		"ns/op": {{1e9, "s"}, {1e6, "ms"}, {1e3, "µs"}, {1, "ns"}},
+		"B/op":  {{1e9, "GB"}, {1e6, "MB"}, {1e3, "kB"}, {1, "B"}},
+		"MB/s":  {{1, "MB/s"}},
+	}[unit]
+	for _, scale := range scales {
+		if math.Abs(value) >= scale.factor || scale.factor == 1 {
+			return significant(value/scale.factor) + scale.suffix
+		}
+	}
+	return significant(value)
+}
+
+func significant(value float64) string {
+	switch abs := math.Abs(value); {
+	case abs >= 100:
+		return strconv.FormatFloat(value, 'f', 0, 64)
+	case abs >= 10:
+		return strconv.FormatFloat(value, 'f', 1, 64)
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
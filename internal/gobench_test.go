@@ -0,0 +1,115 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestParseGoBench(t *testing.T) {
+	results, err := parseGoBench(strings.NewReader(`goos: linux
+goarch: amd64
+pkg: example.com/codec
+BenchmarkEncode-8   	 1000000	      1200 ns/op	      64 B/op	       2 allocs/op
+BenchmarkEncode-8   	 1000000	      1300 ns/op	      64 B/op	       2 allocs/op
+BenchmarkDecode-8   	  500000	      2500 ns/op
+--- BENCH: BenchmarkBroken
+BenchmarkBroken-8  not-a-count  1 ns/op
+PASS
+`))
+	if err != nil {
+		t.Fatalf("parseGoBench: %v", err)
+	}
+	if strings.Join(results.names, ",") != "Encode-8,Decode-8" {
+		t.Fatalf("names = %v", results.names)
+	}
+	if strings.Join(results.units, ",") != "ns/op,B/op,allocs/op" {
+		t.Fatalf("units = %v", results.units)
+	}
+	if got := results.values["Encode-8"]["ns/op"]; len(got) != 2 || got[0] != 1200 || got[1] != 1300 {
+		t.Fatalf("Encode-8 ns/op = %v", got)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"separated", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{"interleaved", []float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		{"identical", []float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+	} {
+		if got := mannWhitneyU(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Fatalf("%s: p = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	// large samples use the normal approximation
+	a, b := make([]float64, 30), make([]float64, 30)
+	for i := range a {
+		a[i], b[i] = float64(i), float64(i)+100
+	}
+	if got := mannWhitneyU(a, b); got > 1e-9 {
+		t.Fatalf("separated large samples: p = %v", got)
+	}
+}
+
+func TestCompareGoBenchmarks(t *testing.T) {
+	outputDir := t.TempDir()
+	store := NewLocalStore(outputDir)
+	ctx := context.Background()
+	cfg := &config.Config{Stages: []config.Stage{{
+		Name:    "bench",
+		Outputs: []config.Output{{Name: "${BENCHCTL_HOST}-bench", RemotePath: "/tmp/bench.txt", Format: "gobench"}},
+	}}}
+	runs := map[string]string{
+		"1": "BenchmarkEncode-8 100 1000 ns/op 64 B/op\nBenchmarkEncode-8 100 1010 ns/op 64 B/op\nBenchmarkEncode-8 100 990 ns/op 64 B/op\nBenchmarkEncode-8 100 1020 ns/op 64 B/op\nBenchmarkEncode-8 100 980 ns/op 64 B/op\n",
+		"2": "BenchmarkEncode-8 100 800 ns/op 64 B/op\nBenchmarkEncode-8 100 810 ns/op 64 B/op\nBenchmarkEncode-8 100 790 ns/op 64 B/op\nBenchmarkEncode-8 100 820 ns/op 64 B/op\nBenchmarkEncode-8 100 780 ns/op 64 B/op\n",
+	}
+	for runID, content := range runs {
+		if err := os.MkdirAll(filepath.Join(outputDir, runID), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveMetadata(ctx, runID, &RunMetadata{RunID: runID, Config: cfg}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.WriteArtifact(ctx, runID, "gen1-bench.txt", strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tables, err := CompareGoBenchmarks(ctx, store, "1", "2")
+	if err != nil {
+		t.Fatalf("CompareGoBenchmarks: %v", err)
+	}
+	if len(tables) != 2 || tables[0].Unit != "ns/op" || tables[1].Unit != "B/op" {
+		t.Fatalf("tables = %+v", tables)
+	}
+	timeRow, allocRow := tables[0].Rows[0], tables[1].Rows[0]
+	if !timeRow.Significant || math.Abs(timeRow.Delta-(-20)) > 1e-9 || timeRow.Old.N != 5 {
+		t.Fatalf("time row = %+v", timeRow)
+	}
+	if allocRow.Significant {
+		t.Fatalf("alloc row = %+v", allocRow)
+	}
+
+	out := FormatGoBenchmarks(tables)
+	for _, want := range []string{
+		"output gen1-bench.txt:",
+		"name      old time/op  new time/op  delta",
+		"Encode-8  1.00µs ± 2%  800ns ± 2%   -20.00%  (p=0.008 n=5+5)",
+		"Encode-8  64.0B ± 0%    64.0B ± 0%    ~  (p=1.000 n=5+5)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+}
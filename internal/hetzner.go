@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// hetznerAPI is the base URL of the Hetzner Cloud API.
+var hetznerAPI = "https://api.hetzner.cloud/v1"
+
+// hetznerProvider creates servers through the Hetzner Cloud API.
+type hetznerProvider struct {
+	token string
+}
+
+func newHetznerProvider(p config.Provision) (cloudProvider, error) {
+	tokenEnv := p.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = "HCLOUD_TOKEN"
+	}
+	token := strings.TrimSpace(os.Getenv(tokenEnv))
+	if token == "" {
+		return nil, fmt.Errorf("hetzner API token not set: export %s", tokenEnv)
+	}
+	return &hetznerProvider{token: token}, nil
+}
+
+// hetznerServer is the part of a Hetzner server object benchctl reads.
+type hetznerServer struct {
+	ID        int64  `json:"id"`
+	Status    string `json:"status"`
+	PublicNet struct {
+		IPv4 struct {
+			IP string `json:"ip"`
+		} `json:"ipv4"`
+	} `json:"public_net"`
+	ServerType struct {
+		Name string `json:"name"`
+	} `json:"server_type"`
+	Datacenter struct {
+		Location struct {
+			Name string `json:"name"`
+		} `json:"location"`
+	} `json:"datacenter"`
+}
+
+func (h *hetznerProvider) create(ctx context.Context, name, runID string, p config.Provision) (ProvisionedInstance, error) {
+	request := map[string]any{
+		"name":        name,
+		"server_type": p.Type,
+		"image":       p.Image,
+		"location":    p.Region,
+		"labels":      map[string]string{"managed-by": "benchctl", "benchctl-run-id": runID},
+	}
+	if len(p.SSHKeys) > 0 {
+		request["ssh_keys"] = p.SSHKeys
+	}
+	var created struct {
+		Server hetznerServer `json:"server"`
+	}
+	if err := h.do(ctx, http.MethodPost, "/servers", request, &created); err != nil {
+		return ProvisionedInstance{}, err
+	}
+	instance := ProvisionedInstance{
+		ID:        strconv.FormatInt(created.Server.ID, 10),
+		Name:      name,
+		Type:      p.Type,
+		Region:    p.Region,
+		Image:     p.Image,
+		CreatedAt: clockFrom(ctx).Now(),
+	}
+	server := created.Server
+	for server.Status != "running" {
+		select {
+		case <-ctx.Done():
+			return instance, fmt.Errorf("server %s is still %s: %w", instance.ID, server.Status, ctx.Err())
+		case <-time.After(provisionPollInterval):
+		}
+		var current struct {
+			Server hetznerServer `json:"server"`
+		}
+		if err := h.do(ctx, http.MethodGet, "/servers/"+instance.ID, nil, &current); err != nil {
+			return instance, err
+		}
+		server = current.Server
+	}
+	instance.IP = server.PublicNet.IPv4.IP
+	if server.ServerType.Name != "" {
+		instance.Type = server.ServerType.Name
+	}
+	if location := server.Datacenter.Location.Name; location != "" {
+		instance.Region = location
+	}
+	if instance.IP == "" {
+		return instance, fmt.Errorf("server %s has no public IPv4 address", instance.ID)
+	}
+	return instance, nil
+}
+
+func (h *hetznerProvider) delete(ctx context.Context, id string) error {
+	err := h.do(ctx, http.MethodDelete, "/servers/"+id, nil, nil)
+	var apiErr *hetznerError
+	if errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// hetznerError is an error response of the Hetzner Cloud API.
+type hetznerError struct {
+	status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *hetznerError) Error() string {
+	return fmt.Sprintf("hetzner API: %s (%s, HTTP %d)", e.Message, e.Code, e.status)
+}
+
+// do sends a request to the Hetzner Cloud API and decodes the response into out.
+func (h *hetznerProvider) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshal hetzner request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, hetznerAPI+path, body)
+	if err != nil {
+		return fmt.Errorf("create hetzner request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("hetzner API: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("hetzner API: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		var failure struct {
+			Error hetznerError `json:"error"`
+		}
+		if json.Unmarshal(data, &failure) != nil || failure.Error.Message == "" {
+			failure.Error.Message = strings.TrimSpace(string(data))
+		}
+		failure.Error.status = resp.StatusCode
+		return &failure.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode hetzner response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// historyFile holds the final metrics of every run of a benchmark, one JSON object
+// per line, in benchmark.output_dir.
+const historyFile = "history.jsonl"
+
+// historyLockTimeout bounds the wait for another process appending to the history.
+const historyLockTimeout = 10 * time.Second
+
+// errLockHeld is returned by tryLockFile while another process holds the lock.
+var errLockHeld = errors.New("lock held by another process")
+
+// HistoryEntry is the outcome of a run as recorded in history.jsonl.
+type HistoryEntry struct {
+	RunID     string            `json:"run_id"`
+	StartTime time.Time         `json:"start_time"`
+	EndTime   time.Time         `json:"end_time"`
+	Status    string            `json:"status"`
+	Commit    string            `json:"commit,omitempty"`
+	Metrics   map[string]string `json:"metrics,omitempty"`
+}
+
+// historyEntry returns the history entry of a run: its status and the metrics
+// derived by its analysis, without the metadata given with --metadata.
+func historyEntry(metadata *RunMetadata) HistoryEntry {
+	entry := HistoryEntry{
+		RunID:     metadata.RunID,
+		StartTime: metadata.StartTime,
+		EndTime:   metadata.EndTime,
+		Status:    metadata.Status,
+	}
+	if metadata.Git != nil {
+		entry.Commit = metadata.Git.Commit
+	}
+	if metadata.Analysis == nil {
+		entry.Metrics = maps.Clone(metadata.Custom)
+		return entry
+	}
+	for _, name := range metadata.Analysis.Metrics {
+		if value, ok := metadata.Custom[name]; ok {
+			if entry.Metrics == nil {
+				entry.Metrics = map[string]string{}
+			}
+			entry.Metrics[name] = value
+		}
+	}
+	return entry
+}
+
+// appendHistory appends the entry of a run to the history of the runs in
+// outputDir. Concurrent runs sharing the output directory take turns through a
+// lock file, and each entry is a single append, so lines never interleave.
+func appendHistory(outputDir string, metadata *RunMetadata) error {
+	line, err := json.Marshal(historyEntry(metadata))
+	if err != nil {
+		return fmt.Errorf("error marshalling history entry: %w", err)
+	}
+	path := filepath.Join(outputDir, historyFile)
+	unlock, err := lockHistory(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening history: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing history: %w", err)
+	}
+	return file.Close()
+}
+
+// lockHistory locks the lock file path, waiting while another process holds it.
+// The lock is held by the operating system on the open file, so a process that
+// crashes releases it and no stale lock has to be broken. The file is left in
+// place, since removing it would let a process waiting on the removed file and
+// one creating a new file hold the lock at once.
+func lockHistory(path string) (func(), error) {
+	deadline := time.Now().Add(historyLockTimeout)
+	for {
+		unlock, err := tryLockFile(path)
+		if err == nil {
+			return unlock, nil
+		}
+		if !errors.Is(err, errLockHeld) {
+			return nil, fmt.Errorf("error locking history: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("error locking history: %s held for more than %s", path, historyLockTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// LoadHistory returns the history of the runs in outputDir, oldest run first. A
+// run analyzed again with benchctl analyze is listed once, with its latest metrics.
+func LoadHistory(outputDir string) ([]HistoryEntry, error) {
+	file, err := os.Open(filepath.Join(outputDir, historyFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	defer file.Close()
+
+	latest := map[string]HistoryEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("error unmarshalling history line %d: %w", lineNumber, err)
+		}
+		latest[entry.RunID] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	entries := slices.Collect(maps.Values(latest))
+	slices.SortFunc(entries, func(a, b HistoryEntry) int { return compareRunIDs(a.RunID, b.RunID) })
+	return entries, nil
+}
@@ -0,0 +1,100 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestRunsAppendToHistory(t *testing.T) {
+	outputDir := t.TempDir()
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "history", OutputDir: outputDir},
+		Stages: []config.Stage{
+			{
+				Name:              "load",
+				Command:           "echo 'Requests/sec: 1500'",
+				MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}},
+			},
+		},
+	}
+	for range 2 {
+		if _, err := RunWorkflow(context.Background(), cfg, map[string]string{"branch": "main"}, nil); err != nil {
+			t.Fatalf("RunWorkflow: %v", err)
+		}
+	}
+	entries, err := LoadHistory(outputDir)
+	if err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	if len(entries) != 2 || entries[0].RunID != "1" || entries[1].RunID != "2" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if entries[0].Status != "success" || entries[0].Metrics["rps"] != "1500" || len(entries[0].Metrics) != 1 {
+		t.Fatalf("expected the derived metrics without --metadata, got %+v", entries[0])
+	}
+
+	changed := cfg.Clone()
+	changed.Stages[0].MetricsFromOutput[0].Name = "throughput"
+	store := NewLocalStore(outputDir)
+	if _, err := AnalyzeStoredRun(context.Background(), store, "1", changed); err != nil {
+		t.Fatalf("AnalyzeStoredRun: %v", err)
+	}
+	entries, err = LoadHistory(outputDir)
+	if err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Metrics["throughput"] != "1500" || entries[0].Metrics["rps"] != "" {
+		t.Fatalf("expected the reanalyzed run once with its latest metrics, got %+v", entries)
+	}
+}
+
+func TestAppendHistoryIsSafeForConcurrentRuns(t *testing.T) {
+	outputDir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			metadata := &RunMetadata{RunID: fmt.Sprint(i + 1), Status: "success", Custom: map[string]string{"rps": fmt.Sprint(i)}}
+			if err := appendHistory(outputDir, metadata); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	entries, err := LoadHistory(outputDir)
+	if err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	if len(entries) != 20 || entries[19].RunID != "20" || entries[19].Metrics["rps"] != "19" {
+		t.Fatalf("entries = %+v", entries)
+	}
+}
+
+func TestLockHistoryWaitsForHolderOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFile+".lock")
+	// A lock file left behind by a crashed run does not hold the lock.
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := lockHistory(path)
+	if err != nil {
+		t.Fatalf("lockHistory with a leftover lock file: %v", err)
+	}
+	if _, err := tryLockFile(path); !errors.Is(err, errLockHeld) {
+		t.Fatalf("expected the lock to be held, got %v", err)
+	}
+	unlock()
+	again, err := tryLockFile(path)
+	if err != nil {
+		t.Fatalf("expected the lock to be free after unlock, got %v", err)
+	}
+	again()
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package internal
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLockFile takes an exclusive flock on path, creating the file when missing.
+// Closing the file, which the returned func does, releases the lock.
+func tryLockFile(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errLockHeld
+		}
+		return nil, err
+	}
+	return func() { _ = file.Close() }, nil
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package internal
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorSharingViolation is ERROR_SHARING_VIOLATION, returned while another
+// process has the file open.
+const errorSharingViolation syscall.Errno = 32
+
+// tryLockFile opens path, creating it when missing, without sharing it with any
+// other process. Closing the handle, which the returned func does, releases it.
+func tryLockFile(path string) (func(), error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := syscall.CreateFile(name, syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if errors.Is(err, errorSharingViolation) {
+			return nil, errLockHeld
+		}
+		return nil, err
+	}
+	return func() { _ = syscall.CloseHandle(handle) }, nil
+}
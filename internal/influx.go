@@ -0,0 +1,241 @@
+package internal
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+const influxRunMeasurement = "benchctl_run"
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// WriteInflux writes the collected CSV outputs of a run and a summary point of its
+// metadata to the configured InfluxDB bucket. The outputs are those recorded in
+// metadata, so that it is called once the metadata is final.
+func WriteInflux(ctx context.Context, cfg *config.Config, metadata *RunMetadata, runDir string) error {
+	influx := cfg.Benchmark.Influx
+	if influx == nil {
+		return nil
+	}
+	token := os.Getenv(influx.TokenEnv)
+	for _, output := range influxOutputFiles(runDir, metadata, influx.Outputs) {
+		tags := map[string]string{
+			"benchmark": metadata.BenchmarkName,
+			"run_id":    metadata.RunID,
+		}
+		if output.trial > 0 {
+			tags["trial"] = strconv.Itoa(output.trial)
+		}
+		lines, err := csvToLineProtocol(output.path, output.name, influxTags(tags), influx.TimestampColumn)
+		if err != nil {
+			return fmt.Errorf("influx: %w", err)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		if err := influxWrite(ctx, influx, token, influx.Precision, lines); err != nil {
+			return err
+		}
+	}
+
+	return influxWrite(ctx, influx, token, "ns", []string{runMetadataLine(metadata)})
+}
+
+// influxOutput is a collected CSV output written to InfluxDB.
+type influxOutput struct {
+	name  string // output name, the measurement of its points
+	path  string
+	trial int // zero for runs without trials
+}
+
+// influxOutputFiles returns the CSV outputs recorded in the metadata of a run,
+// optionally restricted to names; the files an output pattern matched count as
+// that output. A run with trials collected its outputs below the directory of
+// every trial, and only the measured trials are returned.
+func influxOutputFiles(runDir string, metadata *RunMetadata, names []string) []influxOutput {
+	if metadata.Analysis == nil {
+		return nil
+	}
+	type trialDir struct {
+		dir   string
+		trial int
+	}
+	dirs := []trialDir{{dir: runDir}}
+	if len(metadata.Trials) > 0 {
+		dirs = nil
+		for _, trial := range metadata.Trials {
+			if !trial.Warmup {
+				dirs = append(dirs, trialDir{dir: filepath.Join(runDir, trial.Dir), trial: trial.Trial})
+			}
+		}
+	}
+	var outputs []influxOutput
+	seen := map[string]bool{}
+	for _, input := range metadata.Analysis.Inputs {
+		if input.Output == "" || seen[input.File] || filepath.Ext(trimCompressionSuffix(input.File)) != ".csv" {
+			continue
+		}
+		if len(names) > 0 && !slices.ContainsFunc(names, func(name string) bool {
+			return input.Output == name || strings.HasPrefix(input.Output, name+".")
+		}) {
+			continue
+		}
+		seen[input.File] = true // every trial records the same file again
+		for _, dir := range dirs {
+			path := filepath.Join(dir.dir, filepath.FromSlash(input.File))
+			if _, err := os.Stat(path); err == nil {
+				outputs = append(outputs, influxOutput{name: input.Output, path: path, trial: dir.trial})
+			}
+		}
+	}
+	return outputs
+}
+
+// csvToLineProtocol converts every row of a CSV file into one point of measurement.
+// Non-numeric cells are skipped; rows without numeric fields are dropped.
+func csvToLineProtocol(path, measurement, tags, timestampColumn string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := decompressed(path, file)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	measurement = influxMeasurementEscaper.Replace(measurement)
+	reader := csv.NewReader(content)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	timestampIndex := slices.Index(header, timestampColumn)
+	if timestampIndex < 0 {
+		return nil, fmt.Errorf("%s has no %q column", filepath.Base(path), timestampColumn)
+	}
+
+	var lines []string
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+		}
+		if timestampIndex >= len(record) {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(strings.TrimSpace(record[timestampIndex]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s row %d: invalid timestamp %q", filepath.Base(path), row, record[timestampIndex])
+		}
+		var fields []string
+		for i, cell := range record {
+			if i == timestampIndex || i >= len(header) {
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+			if err != nil {
+				continue
+			}
+			fields = append(fields, influxKeyEscaper.Replace(header[i])+"="+strconv.FormatFloat(value, 'g', -1, 64))
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s%s %s %d", measurement, tags, strings.Join(fields, ","), timestamp))
+	}
+	return lines, nil
+}
+
+// runMetadataLine renders the run status, duration, and numeric custom metadata as one point.
+func runMetadataLine(metadata *RunMetadata) string {
+	end := metadata.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	fields := []string{fmt.Sprintf("duration_seconds=%s", strconv.FormatFloat(end.Sub(metadata.StartTime).Seconds(), 'g', -1, 64))}
+	keys := make([]string, 0, len(metadata.Custom))
+	for key := range metadata.Custom {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, ok := parseFloat(metadata.Custom[key]); ok {
+			fields = append(fields, influxKeyEscaper.Replace(key)+"="+strconv.FormatFloat(*value, 'g', -1, 64))
+		}
+	}
+	tags := influxTags(map[string]string{
+		"benchmark": metadata.BenchmarkName,
+		"run_id":    metadata.RunID,
+		"status":    metadata.Status,
+	})
+	return fmt.Sprintf("%s%s %s %d", influxRunMeasurement, tags, strings.Join(fields, ","), metadata.StartTime.UnixNano())
+}
+
+func influxTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key, value := range tags {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var out strings.Builder
+	for _, key := range keys {
+		out.WriteString("," + influxKeyEscaper.Replace(key) + "=" + influxKeyEscaper.Replace(tags[key]))
+	}
+	return out.String()
+}
+
+func influxWrite(ctx context.Context, influx *config.InfluxConfig, token, precision string, lines []string) error {
+	query := url.Values{}
+	query.Set("bucket", influx.Bucket)
+	query.Set("precision", precision)
+	if influx.Org != "" {
+		query.Set("org", influx.Org)
+	}
+	target := strings.TrimRight(influx.URL, "/") + "/api/v2/write?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return fmt.Errorf("create influx request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("influx write: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("influx write: server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
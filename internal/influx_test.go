@@ -0,0 +1,133 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestCSVToLineProtocol(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latency.csv")
+	data := "timestamp_ms,latency ms,status\n1000,12.5,ok\n2000,n/a,ok\n3000,7,err\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	lines, err := csvToLineProtocol(path, "latency", ",run_id=1", "timestamp_ms")
+	if err != nil {
+		t.Fatalf("csvToLineProtocol: %v", err)
+	}
+	want := []string{
+		`latency,run_id=1 latency\ ms=12.5 1000`,
+		`latency,run_id=1 latency\ ms=7 3000`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestCSVToLineProtocolMissingTimestamp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.csv")
+	if err := os.WriteFile(path, []byte("time,value\n1,2\n"), 0644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	if _, err := csvToLineProtocol(path, "metrics", "", "timestamp_ms"); err == nil {
+		t.Fatal("expected error for missing timestamp column")
+	}
+}
+
+func TestWriteInflux(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.URL.Query().Get("precision")+" "+r.Header.Get("Authorization")+" "+string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	runDir := t.TempDir()
+	for _, name := range []string{"results/metrics.csv", "ignored.csv", "stray.csv"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(runDir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(runDir, name), []byte("timestamp_ms,value\n1000,1\n"), 0644); err != nil {
+			t.Fatalf("write csv: %v", err)
+		}
+	}
+	t.Setenv("TEST_INFLUX_TOKEN", "secret")
+
+	cfg := config.New("influx", runDir, config.WithInflux(config.InfluxConfig{
+		URL:             server.URL,
+		Bucket:          "bench",
+		TokenEnv:        "TEST_INFLUX_TOKEN",
+		TimestampColumn: "timestamp_ms",
+		Precision:       "ms",
+		Outputs:         []string{"metrics"},
+	}))
+	start := time.Unix(10, 0)
+	metadata := &RunMetadata{
+		RunID:         "1",
+		BenchmarkName: "influx",
+		StartTime:     start,
+		EndTime:       start.Add(2 * time.Second),
+		Status:        "success",
+		Custom:        map[string]string{"rps": "100", "branch": "main"},
+		Analysis: &Analysis{Inputs: []AnalysisInput{
+			{Stage: "load", Output: "metrics", File: "results/metrics.csv"},
+			{Stage: "load", Output: "ignored", File: "ignored.csv"},
+			{Stage: "load", File: "load.log"},
+		}},
+	}
+
+	if err := WriteInflux(context.Background(), cfg, metadata, runDir); err != nil {
+		t.Fatalf("WriteInflux: %v", err)
+	}
+	want := []string{
+		"ms Token secret metrics,benchmark=influx,run_id=1 value=1 1000\n",
+		"ns Token secret benchctl_run,benchmark=influx,run_id=1,status=success duration_seconds=2,rps=100 10000000000\n",
+	}
+	if strings.Join(requests, "|") != strings.Join(want, "|") {
+		t.Fatalf("requests = %q, want %q", requests, want)
+	}
+}
+
+func TestInfluxOutputFilesOfTrials(t *testing.T) {
+	runDir := t.TempDir()
+	for _, dir := range []string{"warmup-1", "trial-1", "trial-2"} {
+		if err := os.MkdirAll(filepath.Join(runDir, dir, "metrics"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(runDir, dir, "metrics", "a.csv"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input := AnalysisInput{Stage: "load", Output: "metrics.a", File: "metrics/a.csv"}
+	metadata := &RunMetadata{
+		Analysis: &Analysis{Inputs: []AnalysisInput{input, input, input}},
+		Trials: []TrialRecord{
+			{Trial: 1, Warmup: true, Dir: "warmup-1"},
+			{Trial: 1, Dir: "trial-1"},
+			{Trial: 2, Dir: "trial-2"},
+		},
+	}
+
+	got := influxOutputFiles(runDir, metadata, []string{"metrics"})
+	want := []influxOutput{
+		{name: "metrics.a", path: filepath.Join(runDir, "trial-1", "metrics", "a.csv"), trial: 1},
+		{name: "metrics.a", path: filepath.Join(runDir, "trial-2", "metrics", "a.csv"), trial: 2},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("influxOutputFiles() = %+v, want %+v", got, want)
+	}
+}
@@ -1,28 +1,67 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"maps"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/goforj/godump"
+	"github.com/luccadibe/benchctl/internal/config"
 )
 
 func InspectRun(runPath string, verbose bool) string {
-	// find metadata.json in the runPath
-	metadataPath := filepath.Join(runPath, "metadata.json")
-	runmd, err := LoadRunMetadata(metadataPath)
+	store, runID := localRun(runPath)
+	return InspectStoredRun(context.Background(), store, runID, verbose)
+}
+
+// InspectStoredRun returns the human-readable inspection of a stored run.
+func InspectStoredRun(ctx context.Context, store ResultStore, runID string, verbose bool) string {
+	runmd, err := store.LoadMetadata(ctx, runID)
 	if err != nil {
 		return "Error loading run metadata: " + err.Error()
 	}
 	out := strings.Builder{}
+	out.WriteString("Benchmark: " + runmd.BenchmarkName + "\n")
+	if runmd.Description != "" {
+		out.WriteString("Description: " + runmd.Description + "\n")
+	}
+	if runmd.Owner != "" {
+		out.WriteString("Owner: " + runmd.Owner + "\n")
+	}
+	for _, link := range runmd.Links {
+		out.WriteString(fmt.Sprintf("Link: %s <%s>\n", link.Name, link.URL))
+	}
+	if ci := runmd.CI; ci != nil {
+		out.WriteString("CI: " + ci.Provider)
+		if ci.JobURL != "" {
+			out.WriteString(" " + ci.JobURL)
+		}
+		if ci.PullRequest != "" {
+			out.WriteString(" (pull request " + ci.PullRequest + ")")
+		}
+		out.WriteString("\n")
+	}
+	if stages := describedStages(runmd.Config); stages != "" {
+		out.WriteString("Stages:\n" + stages)
+	}
 	out.WriteString("Start time: " + runmd.StartTime.Format(time.RFC3339) + "\n")
 	out.WriteString("End time: " + runmd.EndTime.Format(time.RFC3339) + "\n")
 	out.WriteString(fmt.Sprintf("Run custom metadata: \n%+v", stringifyCustomMetadata(runmd.Custom)+"\n"))
+	notes, err := LoadStoredNotes(ctx, store, runID)
+	if err != nil {
+		out.WriteString("Error loading notes: " + err.Error() + "\n")
+	}
+	if len(notes) > 0 {
+		out.WriteString("Notes:\n")
+		for _, note := range notes {
+			out.WriteString(fmt.Sprintf("  %s  %s\n", note.Time.Format(time.RFC3339), note.Text))
+		}
+	}
 
 	if verbose {
 		out.WriteString(fmt.Sprintf("Run config: %+v", godump.DumpStr(runmd.Config)+"\n"))
@@ -30,6 +69,27 @@ func InspectRun(runPath string, verbose bool) string {
 	return out.String()
 }
 
+// describedStages lists the stages of a run with their descriptions, so the
+// inspection documents how the run was produced. It is empty when no stage has a
+// description.
+func describedStages(cfg *config.Config) string {
+	if cfg == nil || !slices.ContainsFunc(cfg.Stages, func(stage config.Stage) bool { return stage.Description != "" }) {
+		return ""
+	}
+	out := strings.Builder{}
+	for _, stage := range cfg.Stages {
+		out.WriteString("  " + stage.Name)
+		if stage.Description != "" {
+			out.WriteString(": " + stage.Description)
+		}
+		if stage.Skip {
+			out.WriteString(" (skipped)")
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
 func stringifyCustomMetadata(customMd map[string]string) string {
 	out := strings.Builder{}
 	for key, value := range customMd {
@@ -39,10 +99,13 @@ func stringifyCustomMetadata(customMd map[string]string) string {
 }
 
 func AddMetadata(runPath string, extraMetadata map[string]string) error {
+	store, runID := localRun(runPath)
+	return AnnotateStoredRun(context.Background(), store, runID, extraMetadata)
+}
 
-	// find metadata.json in the runPath
-	metadataPath := filepath.Join(runPath, "metadata.json")
-	runmd, err := LoadRunMetadata(metadataPath)
+// AnnotateStoredRun adds custom metadata to a stored run.
+func AnnotateStoredRun(ctx context.Context, store ResultStore, runID string, extraMetadata map[string]string) error {
+	runmd, err := store.LoadMetadata(ctx, runID)
 	if err != nil {
 		return fmt.Errorf("error loading run metadata: %w", err)
 	}
@@ -50,11 +113,7 @@ func AddMetadata(runPath string, extraMetadata map[string]string) error {
 		runmd.Custom = map[string]string{}
 	}
 	maps.Copy(runmd.Custom, extraMetadata)
-	metadataBytes, err := json.MarshalIndent(runmd, "", "  ")
-	if err != nil {
-		return fmt.Errorf("error marshalling run metadata: %w", err)
-	}
-	if err := os.WriteFile(metadataPath, metadataBytes, 0644); err != nil {
+	if err := store.SaveMetadata(ctx, runID, runmd); err != nil {
 		return fmt.Errorf("error writing run metadata: %w", err)
 	}
 	return nil
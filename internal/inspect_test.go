@@ -4,10 +4,15 @@ package internal
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
 )
 
 func TestAddMetadataInitializesCustom(t *testing.T) {
@@ -38,3 +43,97 @@ func TestAddMetadataInitializesCustom(t *testing.T) {
 		t.Fatalf("expected annotation to be persisted")
 	}
 }
+
+func TestInspectRunShowsBenchmarkDescription(t *testing.T) {
+	runDir := t.TempDir()
+	metadata := RunMetadata{
+		RunID:         "1",
+		BenchmarkName: "kv-latency",
+		Description:   "p99 latency of the kv store under mixed load",
+		Owner:         "storage-team",
+		Links:         []config.Link{{Name: "design", URL: "https://example.com/design"}},
+		Config: &config.Config{Stages: []config.Stage{
+			{Name: "load", Description: "preload 1M keys with uniform sizes"},
+			{Name: "warmup", Skip: true},
+			{Name: "measure", Description: "mixed 90/10 read/write load for 10 minutes"},
+		}},
+	}
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatalf("marshal metadata: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "metadata.json"), b, 0644); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+
+	out := InspectRun(runDir, false)
+	for _, want := range []string{
+		"Benchmark: kv-latency\n",
+		"Description: p99 latency of the kv store under mixed load\n",
+		"Owner: storage-team\n",
+		"Link: design <https://example.com/design>\n",
+		"Stages:\n  load: preload 1M keys with uniform sizes\n  warmup (skipped)\n  measure: mixed 90/10 read/write load for 10 minutes\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected inspect output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestAddNoteAppendsTimestampedNotes(t *testing.T) {
+	runDir := t.TempDir()
+	if err := AddNote(runDir, "too early"); err == nil {
+		t.Fatalf("expected error for a directory without metadata.json")
+	}
+	b, err := json.Marshal(RunMetadata{RunID: "1", BenchmarkName: "notes"})
+	if err != nil {
+		t.Fatalf("marshal metadata: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "metadata.json"), b, 0644); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+
+	for _, text := range []string{"observed thermal throttling at 14:00", "fan replaced"} {
+		if err := AddNote(runDir, text); err != nil {
+			t.Fatalf("add note: %v", err)
+		}
+	}
+	notes, err := LoadNotes(runDir)
+	if err != nil {
+		t.Fatalf("load notes: %v", err)
+	}
+	if len(notes) != 2 || notes[0].Text != "observed thermal throttling at 14:00" || notes[1].Text != "fan replaced" || notes[0].Time.IsZero() {
+		t.Fatalf("unexpected notes: %+v", notes)
+	}
+	if out := InspectRun(runDir, false); !strings.Contains(out, "Notes:\n") || !strings.Contains(out, "  fan replaced\n") {
+		t.Fatalf("expected notes in inspect output, got:\n%s", out)
+	}
+}
+
+func TestAddNoteKeepsConcurrentNotes(t *testing.T) {
+	runDir := t.TempDir()
+	b, err := json.Marshal(RunMetadata{RunID: "1", BenchmarkName: "notes"})
+	if err != nil {
+		t.Fatalf("marshal metadata: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "metadata.json"), b, 0644); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			if err := AddNote(runDir, fmt.Sprintf("note %d", i)); err != nil {
+				t.Errorf("add note: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	notes, err := LoadNotes(runDir)
+	if err != nil {
+		t.Fatalf("load notes: %v", err)
+	}
+	if len(notes) != 20 {
+		t.Fatalf("expected all 20 notes, got %d: %+v", len(notes), notes)
+	}
+}
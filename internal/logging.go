@@ -41,6 +41,9 @@ var attrKeyColors = map[string]string{
 	"branch":      ansiBlue,
 	"dirty":       ansiYellow,
 	"pid":         ansiGray,
+	"digest":      ansiGray,
+	"size_bytes":  ansiGray,
+	"startup_ms":  ansiGray,
 	"type":        ansiCyan,
 	"target":      ansiCyan,
 	"index":       ansiGray,
@@ -157,3 +160,17 @@ func ConfigureDefaultLogger() {
 	color := term.IsTerminal(int(os.Stderr.Fd()))
 	slog.SetDefault(slog.New(newConsoleHandler(os.Stderr, slog.LevelInfo, color, defaultConsoleTimeFormat)))
 }
+
+type runLoggerKey struct{}
+
+// withRunLogger returns a context whose SSH connections log their details to the
+// logger of the run.
+func withRunLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, runLoggerKey{}, logger)
+}
+
+// runLogger returns the logger of the run of ctx, or nil outside of runs.
+func runLogger(ctx context.Context) *slog.Logger {
+	logger, _ := ctx.Value(runLoggerKey{}).(*slog.Logger)
+	return logger
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// netemRule tracks a netem qdisc installed by a stage.
+type netemRule struct {
+	stage     string
+	hostAlias string
+	host      config.Host
+	netem     config.Netem
+}
+
+// netemManager removes the netem rules installed during a run, so emulated
+// network conditions never leak into later stages or runs.
+type netemManager struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	rules  []netemRule
+}
+
+func newNetemManager(logger *slog.Logger) *netemManager {
+	return &netemManager{logger: logger}
+}
+
+// Apply installs the stage's netem rule on the host and tracks it for removal.
+func (m *netemManager) Apply(ctx context.Context, client execution.ExecutionClient, stage config.Stage, hostAlias string, host config.Host) error {
+	if stage.Netem == nil {
+		return nil
+	}
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: netemApplyCommand(*stage.Netem)})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("tc exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	if err != nil {
+		return fmt.Errorf("stage %s: apply netem on %s: %w", stage.Name, stage.Netem.Interface, err)
+	}
+	m.mu.Lock()
+	m.rules = append(m.rules, netemRule{stage: stage.Name, hostAlias: hostAlias, host: host, netem: *stage.Netem})
+	m.mu.Unlock()
+	m.logger.Info("netem applied", "stage", stage.Name, "host", hostAlias, "interface", stage.Netem.Interface)
+	return nil
+}
+
+// Remove deletes the rule the stage installed on the host, reusing client.
+func (m *netemManager) Remove(ctx context.Context, client execution.ExecutionClient, stageName, hostAlias string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, rule := range m.rules {
+		if rule.stage != stageName || rule.hostAlias != hostAlias {
+			continue
+		}
+		if err := m.remove(ctx, client, rule); err != nil {
+			return err
+		}
+		m.rules = append(m.rules[:i], m.rules[i+1:]...)
+		return nil
+	}
+	return nil
+}
+
+// RemoveAll deletes every rule still installed, in reverse order of installation.
+func (m *netemManager) RemoveAll(ctx context.Context) error {
+	var combinedErr error
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		if err := m.removeWithNewClient(ctx, m.rules[i]); err != nil {
+			combinedErr = errors.Join(combinedErr, err)
+		}
+	}
+	m.rules = nil
+	return combinedErr
+}
+
+func (m *netemManager) removeWithNewClient(ctx context.Context, rule netemRule) error {
+	client, err := openExecutionClient(ctx, rule.host)
+	if err != nil {
+		err = fmt.Errorf("stage %s: remove netem on %s: %w", rule.stage, rule.hostAlias, err)
+		m.logger.Error("netem removal failed", "stage", rule.stage, "host", rule.hostAlias, "error", err)
+		return err
+	}
+	defer client.Close()
+	return m.remove(ctx, client, rule)
+}
+
+func (m *netemManager) remove(ctx context.Context, client execution.ExecutionClient, rule netemRule) error {
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: netemRemoveCommand(rule.netem)})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("tc exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	if err != nil {
+		err = fmt.Errorf("stage %s: remove netem on %s: %w", rule.stage, rule.hostAlias, err)
+		m.logger.Error("netem removal failed", "stage", rule.stage, "host", rule.hostAlias, "error", err)
+		return err
+	}
+	m.logger.Info("netem removed", "stage", rule.stage, "host", rule.hostAlias, "interface", rule.netem.Interface)
+	return nil
+}
+
+// netemApplyCommand builds an idempotent tc command. Removing the rule restores
+// the default qdisc of the interface, so the command refuses to replace a root
+// qdisc someone configured (one with a handle other than 0:) unless it is netem,
+// which a run that did not finish its teardown may have left behind.
+func netemApplyCommand(netem config.Netem) string {
+	show := tcCommand(netem, []string{"qdisc", "show", "dev", shellQuote(netem.Interface), "root"})
+	check := fmt.Sprintf(`current=$(%s) || exit; set -- $current; if [ "$2" != netem ] && [ "$3" != 0: ]; then echo "interface "%s" already has the root qdisc \"$current\", which netem would replace and teardown would delete" >&2; exit 3; fi; `,
+		show, shellQuote(netem.Interface))
+	args := []string{"qdisc", "replace", "dev", shellQuote(netem.Interface), "root", "netem"}
+	if netem.Delay != "" {
+		args = append(args, "delay", tcDuration(netem.Delay))
+		if netem.Jitter != "" {
+			args = append(args, tcDuration(netem.Jitter))
+		}
+	}
+	if netem.Loss > 0 {
+		args = append(args, "loss", strconv.FormatFloat(netem.Loss, 'f', -1, 64)+"%")
+	}
+	if netem.Rate != "" {
+		args = append(args, "rate", netem.Rate)
+	}
+	return check + tcCommand(netem, args)
+}
+
+func netemRemoveCommand(netem config.Netem) string {
+	return tcCommand(netem, []string{"qdisc", "del", "dev", shellQuote(netem.Interface), "root"})
+}
+
+func tcCommand(netem config.Netem, args []string) string {
+	command := "tc " + strings.Join(args, " ")
+	if netem.Sudo {
+		command = "sudo -n " + command
+	}
+	return command
+}
+
+// tcDuration converts a validated Go duration to microseconds, which tc always understands.
+func tcDuration(value string) string {
+	d, _ := time.ParseDuration(value)
+	return fmt.Sprintf("%dus", d.Microseconds())
+}
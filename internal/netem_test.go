@@ -0,0 +1,79 @@
+//go:build unit
+
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestNetemCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		netem config.Netem
+		want  string
+	}{
+		{
+			name:  "delay with jitter",
+			netem: config.Netem{Interface: "eth0", Delay: "50ms", Jitter: "1.5ms"},
+			want:  "tc qdisc replace dev 'eth0' root netem delay 50000us 1500us",
+		},
+		{
+			name:  "loss and rate with sudo",
+			netem: config.Netem{Interface: "ens5", Loss: 0.5, Rate: "100mbit", Sudo: true},
+			want:  "sudo -n tc qdisc replace dev 'ens5' root netem loss 0.5% rate 100mbit",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := netemApplyCommand(tt.netem); !strings.HasSuffix(got, "; "+tt.want) {
+				t.Fatalf("netemApplyCommand() = %q, want it to end with %q", got, tt.want)
+			}
+		})
+	}
+
+	if got, want := netemRemoveCommand(config.Netem{Interface: "eth0", Sudo: true}), "sudo -n tc qdisc del dev 'eth0' root"; got != want {
+		t.Fatalf("netemRemoveCommand() = %q, want %q", got, want)
+	}
+}
+
+func TestNetemApplyRefusesConfiguredRootQdisc(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		wantErr bool
+	}{
+		{name: "default qdisc", current: "qdisc fq_codel 0: root refcnt 2 limit 10240p"},
+		{name: "netem left behind", current: "qdisc netem 8001: root refcnt 2 limit 1000 delay 50ms"},
+		{name: "configured qdisc", current: "qdisc htb 1: root refcnt 2 r2q 10 default 0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			log := filepath.Join(dir, "tc.log")
+			fake := "#!/bin/sh\necho \"$*\" >> " + shellQuote(log) + "\n[ \"$2\" = show ] && echo " + shellQuote(tt.current) + "\nexit 0\n"
+			if err := os.WriteFile(filepath.Join(dir, "tc"), []byte(fake), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command("sh", "-c", netemApplyCommand(config.Netem{Interface: "eth0", Delay: "10ms"}))
+			cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+			output, err := cmd.CombinedOutput()
+			calls, _ := os.ReadFile(log)
+			replaced := strings.Contains(string(calls), "qdisc replace")
+			if tt.wantErr {
+				if err == nil || replaced || !strings.Contains(string(output), "already has the root qdisc") {
+					t.Fatalf("expected netem to refuse the qdisc, got err %v, output %q, tc calls %q", err, output, calls)
+				}
+				return
+			}
+			if err != nil || !replaced {
+				t.Fatalf("expected netem to replace the qdisc, got err %v, output %q, tc calls %q", err, output, calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// notesFile holds the free-text notes of a run, one JSON object per line.
+const notesFile = "notes.jsonl"
+
+// RunNote is a timestamped free-text note attached to a run after the fact.
+type RunNote struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// AddNote appends a note to the run directory at runPath.
+func AddNote(runPath, text string) error {
+	store, runID := localRun(runPath)
+	return AddStoredNote(context.Background(), store, runID, text)
+}
+
+// AddStoredNote appends a note to a stored run. Notes added at the same time,
+// e.g. from several server requests, are all kept.
+func AddStoredNote(ctx context.Context, store ResultStore, runID, text string) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("note text must be non-empty")
+	}
+	if _, err := store.LoadMetadata(ctx, runID); err != nil {
+		return fmt.Errorf("error finding run: %w", err)
+	}
+	line, err := json.Marshal(RunNote{Time: clockFrom(ctx).Now(), Text: text})
+	if err != nil {
+		return fmt.Errorf("error marshalling note: %w", err)
+	}
+	if err := store.AppendArtifact(ctx, runID, notesFile, bytes.NewReader(append(line, '\n'))); err != nil {
+		return fmt.Errorf("error writing note: %w", err)
+	}
+	return nil
+}
+
+// LoadNotes returns the notes of the run at runPath in the order they were added.
+func LoadNotes(runPath string) ([]RunNote, error) {
+	store, runID := localRun(runPath)
+	return LoadStoredNotes(context.Background(), store, runID)
+}
+
+// LoadStoredNotes returns the notes of a stored run in the order they were added.
+func LoadStoredNotes(ctx context.Context, store ResultStore, runID string) ([]RunNote, error) {
+	file, err := store.OpenArtifact(ctx, runID, notesFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading notes: %w", err)
+	}
+	defer file.Close()
+
+	var notes []RunNote
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var note RunNote
+		if err := json.Unmarshal(scanner.Bytes(), &note); err != nil {
+			return nil, fmt.Errorf("error unmarshalling note %d: %w", len(notes)+1, err)
+		}
+		notes = append(notes, note)
+	}
+	return notes, scanner.Err()
+}
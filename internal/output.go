@@ -2,12 +2,17 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/luccadibe/benchctl/internal/config"
 	"github.com/luccadibe/benchctl/internal/execution"
@@ -77,22 +82,67 @@ func resolveOutput(output config.Output, env map[string]string) (resolvedOutput,
 		return resolvedOutput{}, fmt.Errorf("remote_path is empty after expansion")
 	}
 
-	ext := filepath.Ext(remotePath)
+	localFilename := name + filepath.Ext(remotePath)
+	if hasGlob(remotePath) {
+		localFilename = name
+	}
+	if output.LocalPath != "" {
+		localPath, err := expandTemplate(output.LocalPath, env)
+		if err != nil {
+			return resolvedOutput{}, fmt.Errorf("local_path: %w", err)
+		}
+		if localFilename, err = runDirPath(localPath); err != nil {
+			return resolvedOutput{}, fmt.Errorf("local_path: %w", err)
+		}
+	}
 	return resolvedOutput{
 		name:          name,
 		remotePath:    remotePath,
-		localFilename: name + ext,
+		localFilename: localFilename,
 	}, nil
 }
 
+// runDirPath cleans an output local_path, which must stay inside the run directory.
+func runDirPath(localPath string) (string, error) {
+	cleaned := path.Clean(filepath.ToSlash(localPath))
+	if strings.TrimSpace(localPath) == "" || path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%q is not a path inside the run directory", localPath)
+	}
+	return cleaned, nil
+}
+
 // prepareMetadataForSave resolves $VAR templates in the config snapshot written to
 // metadata.json. Stage commands and outputs use the same env as execution; templates
 // that would expand differently per case or host (e.g. ${BENCHCTL_HOST}) are left as-is.
+// Plaintext host passwords and webhook secrets are redacted; secret references
+// are kept.
 func prepareMetadataForSave(metadata *RunMetadata, runID, runDir string, envVars map[string]string) {
 	if metadata == nil || metadata.Config == nil {
 		return
 	}
 	cfg := metadata.Config
+	resolveConfigTemplates(cfg, runID, runDir, envVars)
+	cfg.Hosts = redactHosts(cfg.Hosts)
+	cfg.Benchmark.Webhooks = redactWebhooks(cfg.Benchmark.Webhooks)
+	metadata.Hosts = redactHosts(metadata.Hosts)
+	if len(metadata.Custom) == 0 {
+		return
+	}
+	benchmarkCase := config.Case{}
+	if cases := workflowCases(cfg); len(cases) == 1 {
+		benchmarkCase = cases[0]
+	}
+	env := buildStageEnv(runID, runDir, cfg, envVars, benchmarkCase, "")
+	for k, v := range metadata.Custom {
+		if expanded, err := expandTemplate(v, env); err == nil {
+			metadata.Custom[k] = expanded
+		}
+	}
+}
+
+// resolveConfigTemplates expands the stage command and output templates of cfg that
+// resolve the same way for every case and host.
+func resolveConfigTemplates(cfg *config.Config, runID, runDir string, envVars map[string]string) {
 	for i := range cfg.Stages {
 		envs := stageEnvs(cfg, runID, runDir, envVars, cfg.Stages[i])
 		stage := &cfg.Stages[i]
@@ -106,19 +156,9 @@ func prepareMetadataForSave(metadata *RunMetadata, runID, runDir string, envVars
 			if v, ok := uniqueExpansion(stage.Outputs[j].RemotePath, envs); ok {
 				stage.Outputs[j].RemotePath = v
 			}
-		}
-	}
-	if len(metadata.Custom) == 0 {
-		return
-	}
-	benchmarkCase := config.Case{}
-	if cases := workflowCases(cfg); len(cases) == 1 {
-		benchmarkCase = cases[0]
-	}
-	env := buildStageEnv(runID, runDir, cfg, envVars, benchmarkCase, "")
-	for k, v := range metadata.Custom {
-		if expanded, err := expandTemplate(v, env); err == nil {
-			metadata.Custom[k] = expanded
+			if v, ok := uniqueExpansion(stage.Outputs[j].LocalPath, envs); ok {
+				stage.Outputs[j].LocalPath = v
+			}
 		}
 	}
 }
@@ -165,23 +205,292 @@ func collectStageOutputs(
 	stage config.Stage,
 	logger *slog.Logger,
 	env map[string]string,
-) error {
+	startedAt time.Time,
+) ([]collectedOutput, error) {
+	// Later outputs are still collected when one fails.
+	var errs []error
+	var collected []collectedOutput
 	for _, output := range stage.Outputs {
 		resolved, err := resolveOutput(output, env)
 		if err != nil {
-			return fmt.Errorf("output %q in stage %s: %w", output.Name, stage.Name, err)
+			errs = append(errs, fmt.Errorf("output %q in stage %s: %w", output.Name, stage.Name, err))
+			continue
+		}
+		files := []resolvedOutput{resolved}
+		if hasGlob(resolved.remotePath) {
+			files, err = expandOutputGlob(ctx, client, resolved)
+			if err != nil {
+				err = fmt.Errorf("failed to collect output %s for stage %s: %w", resolved.name, stage.Name, err)
+				logError(logger, "output collection failed", err, "output", resolved.name, "remote_path", resolved.remotePath)
+				errs = append(errs, err)
+				continue
+			}
+			logger.Info("output pattern matched", "output", resolved.name, "remote_path", resolved.remotePath, "files", len(files))
+		}
+		for _, file := range files {
+			collectedFile, err := collectOutputFile(ctx, client, runDir, stage, output, file, logger, startedAt)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			collected = append(collected, collectedFile)
+		}
+	}
+	return collected, errors.Join(errs...)
+}
+
+// hasGlob reports whether an output remote_path is a pattern matching several files.
+func hasGlob(remotePath string) bool {
+	return strings.ContainsAny(remotePath, "*?[")
+}
+
+// expandOutputGlob lists the regular files on the host matching the remote_path
+// pattern of an output. Each is stored as <name>/<path below the pattern's
+// fixed directory>, and named <name>.<that path without extension, with dots for
+// slashes> in the run metrics.
+func expandOutputGlob(ctx context.Context, client execution.ExecutionClient, output resolvedOutput) ([]resolvedOutput, error) {
+	script := fmt.Sprintf(`for f in %s; do if [ -f "$f" ]; then printf '%%s\n' "$f"; fi; done`, shellGlob(output.remotePath))
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: "sh -c " + shellQuote(script)})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expand %s: %w", output.remotePath, err)
+	}
+	base := globBase(output.remotePath)
+	var files []resolvedOutput
+	for _, match := range strings.Split(result.Output, "\n") {
+		match = strings.TrimSuffix(match, "\r")
+		if match == "" {
+			continue
+		}
+		rel := strings.TrimPrefix(match, base)
+		if rel == match && base != "" {
+			rel = path.Base(match)
+		}
+		ext := path.Ext(rel)
+		files = append(files, resolvedOutput{
+			name:          output.name + "." + strings.ReplaceAll(strings.TrimSuffix(rel, ext), "/", "."),
+			remotePath:    match,
+			localFilename: path.Join(output.localFilename, rel),
+		})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match %s", output.remotePath)
+	}
+	return files, nil
+}
+
+// globBase returns the directory of pattern before its first wildcard, with a
+// trailing slash.
+func globBase(pattern string) string {
+	i := strings.IndexAny(pattern, "*?[")
+	return pattern[:strings.LastIndex(pattern[:i], "/")+1]
+}
+
+// shellGlob quotes pattern for sh with its wildcards left active: the literal
+// text and the characters of bracket expressions are quoted, so a pattern cannot
+// inject shell syntax.
+func shellGlob(pattern string) string {
+	var b strings.Builder
+	literal := func(text string) {
+		if text != "" {
+			b.WriteString(shellQuote(text))
+		}
+	}
+	start := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?':
+			literal(pattern[start:i])
+			b.WriteByte(pattern[i])
+			start = i + 1
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end <= 0 {
+				continue
+			}
+			literal(pattern[start:i])
+			b.WriteByte('[')
+			for j, c := range pattern[i+1 : i+1+end] {
+				switch {
+				case j == 0 && (c == '!' || c == '^'):
+					b.WriteByte('!')
+				case c == '-':
+					b.WriteRune(c)
+				default:
+					b.WriteString(shellQuote(string(c)))
+				}
+			}
+			b.WriteByte(']')
+			i += end + 1
+			start = i + 1
+		}
+	}
+	literal(pattern[start:])
+	return b.String()
+}
+
+// collectOutputFile copies one resolved output file of a stage into the run directory.
+func collectOutputFile(
+	ctx context.Context,
+	client execution.ExecutionClient,
+	runDir string,
+	stage config.Stage,
+	output config.Output,
+	resolved resolvedOutput,
+	logger *slog.Logger,
+	startedAt time.Time,
+) (collectedOutput, error) {
+	if !startedAt.IsZero() && output.OnStale != "ignore" {
+		modTime, stale, err := outputIsStale(ctx, client, resolved.remotePath, startedAt)
+		switch {
+		case err != nil:
+			logger.Warn("output age not checked", "output", resolved.name, "stage", stage.Name, "remote_path", resolved.remotePath, "error", err)
+		case stale && output.OnStale == "fail":
+			err = fmt.Errorf("output %s for stage %s is stale: %s was last modified at %s, before the stage started", resolved.name, stage.Name, resolved.remotePath, modTime.Format(time.RFC3339))
+			logError(logger, "stale output", err, "output", resolved.name, "remote_path", resolved.remotePath)
+			return collectedOutput{}, err
+		case stale:
+			logger.Warn("output predates its stage", "output", resolved.name, "stage", stage.Name, "remote_path", resolved.remotePath, "modified", modTime.Format(time.RFC3339))
+		}
+	}
+
+	localPath := filepath.Join(runDir, filepath.FromSlash(resolved.localFilename))
+	transferPath := resolved.remotePath
+	var err error
+	if output.Compress != "" {
+		transferPath, err = compressRemote(ctx, client, resolved.remotePath, output.Compress)
+		if err != nil {
+			err = fmt.Errorf("failed to compress output %s for stage %s: %w", resolved.name, stage.Name, err)
+			logError(logger, "output compression failed", err, "output", resolved.name, "remote_path", resolved.remotePath)
+			return collectedOutput{}, err
+		}
+		localPath += compressionSuffixes[output.Compress]
+	}
+	err = retryTransfer(ctx, logger, "output "+resolved.name, func(ctx context.Context) error {
+		return client.Scp(ctx, transferPath, localPath)
+	})
+	if err == nil && output.CleanupRemote {
+		err = verifyTransfer(ctx, client, transferPath, localPath)
+	}
+	if transferPath != resolved.remotePath {
+		if removeErr := removeRemote(ctx, client, transferPath); removeErr != nil {
+			logger.Warn("compressed output not removed from host", "output", resolved.name, "path", transferPath, "error", removeErr)
+		}
+	}
+	if err == nil && output.Decompress {
+		localPath, err = decompressFile(localPath)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to collect output %s for stage %s: %w", resolved.name, stage.Name, err)
+		logError(logger, "output collection failed", err, "output", resolved.name, "remote_path", resolved.remotePath)
+		return collectedOutput{}, err
+	}
+	logger.Info(
+		"output collected",
+		"output", resolved.name,
+		"remote_path", resolved.remotePath,
+		"local_path", localPath,
+	)
+	if output.CleanupRemote {
+		if err := removeRemote(ctx, client, resolved.remotePath); err != nil {
+			logger.Warn("output not removed from host", "output", resolved.name, "remote_path", resolved.remotePath, "error", err)
+		} else {
+			logger.Info("output removed from host", "output", resolved.name, "remote_path", resolved.remotePath)
 		}
+	}
+	file, _ := filepath.Rel(runDir, localPath)
+	return collectedOutput{
+		name:       resolved.name,
+		file:       filepath.ToSlash(file),
+		prometheus: isPrometheusOutput(output, resolved.remotePath),
+	}, nil
+}
 
-		localPath := filepath.Join(runDir, resolved.localFilename)
-		if err := client.Scp(ctx, resolved.remotePath, localPath); err != nil {
-			return fmt.Errorf("failed to collect output %s for stage %s: %w", resolved.name, stage.Name, err)
+// collectedOutput is an output of a stage stored in the run directory.
+type collectedOutput struct {
+	name       string
+	file       string // slash-separated name in the run directory, compression suffix included
+	prometheus bool
+}
+
+// outputMetrics parses the collected Prometheus outputs of a stage into run metrics.
+func outputMetrics(runDir string, stage config.Stage, outputs []collectedOutput, logger *slog.Logger) (map[string]string, error) {
+	var errs []error
+	metrics := map[string]string{}
+	for _, output := range outputs {
+		if !output.prometheus {
+			continue
+		}
+		parsed, err := prometheusMetrics(output.name, filepath.Join(runDir, filepath.FromSlash(output.file)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("output %s for stage %s: %w", output.name, stage.Name, err))
+			continue
 		}
-		logger.Info(
-			"output collected",
-			"output", resolved.name,
-			"remote_path", resolved.remotePath,
-			"local_path", localPath,
-		)
+		maps.Copy(metrics, parsed)
+		logger.Info("output metrics parsed", "output", output.name, "metrics", len(parsed))
+	}
+	return metrics, errors.Join(errs...)
+}
+
+// outputIsStale reports whether remotePath was last modified before the stage that
+// produced it started at startedAt. The modification time is compared with the clock
+// of the host, so clock skew between benchctl and the host does not matter.
+func outputIsStale(ctx context.Context, client execution.ExecutionClient, remotePath string, startedAt time.Time) (time.Time, bool, error) {
+	quoted := shellQuote(remotePath)
+	// GNU stat takes -c, BSD stat -f.
+	command := fmt.Sprintf("date +%%s && { stat -c %%Y -- %s 2>/dev/null || stat -f %%m -- %s; }", quoted, quoted)
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: command})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("stat %s: %w", remotePath, err)
+	}
+	fields := strings.Fields(result.Output)
+	if len(fields) < 2 {
+		return time.Time{}, false, fmt.Errorf("stat %s: unexpected output %q", remotePath, result.Output)
+	}
+	now, errNow := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	modified, errModified := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+	if errNow != nil || errModified != nil {
+		return time.Time{}, false, fmt.Errorf("stat %s: unexpected output %q", remotePath, result.Output)
+	}
+	// Both clocks have one-second resolution here, so allow one second of slack.
+	hostStart := time.Unix(now, 0).Add(-clockFrom(ctx).Now().Sub(startedAt)).Add(-time.Second)
+	return time.Unix(modified, 0), time.Unix(modified, 0).Before(hostStart), nil
+}
+
+// verifyTransfer compares the SHA-256 digests of a collected file and its source
+// on the host, so a file is only removed from the host once its copy is intact.
+func verifyTransfer(ctx context.Context, client execution.ExecutionClient, remotePath, localPath string) error {
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: "sha256sum -- " + shellQuote(remotePath)})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	if err != nil {
+		return fmt.Errorf("checksum %s: %w", remotePath, err)
+	}
+	fields := strings.Fields(result.Output)
+	if len(fields) == 0 {
+		return fmt.Errorf("checksum %s: empty sha256sum output", remotePath)
+	}
+	localDigest, err := fileDigest(localPath)
+	if err != nil {
+		return fmt.Errorf("checksum %s: %w", localPath, err)
+	}
+	if remoteDigest := "sha256:" + fields[0]; remoteDigest != localDigest {
+		return fmt.Errorf("checksum mismatch: %s on host is %s, collected copy is %s", remotePath, remoteDigest, localDigest)
 	}
 	return nil
 }
+
+// removeRemote deletes a file on the host.
+func removeRemote(ctx context.Context, client execution.ExecutionClient, remotePath string) error {
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: "rm -f -- " + shellQuote(remotePath)})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	return err
+}
@@ -3,6 +3,7 @@
 package internal
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"log/slog"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/luccadibe/benchctl/internal/config"
 	"github.com/luccadibe/benchctl/internal/execution"
@@ -88,6 +90,25 @@ func TestResolveOutput(t *testing.T) {
 		}
 	})
 
+	t.Run("local path templates", func(t *testing.T) {
+		env := map[string]string{"BENCHCTL_ITERATION": "2", "THREADS": "8"}
+		resolved, err := resolveOutput(config.Output{
+			Name:       "latency",
+			RemotePath: "/tmp/results.csv",
+			LocalPath:  "./sweep/results_${BENCHCTL_ITERATION}_${THREADS}.csv",
+		}, env)
+		if err != nil {
+			t.Fatalf("resolveOutput: %v", err)
+		}
+		if resolved.localFilename != "sweep/results_2_8.csv" {
+			t.Fatalf("localFilename = %q, want sweep/results_2_8.csv", resolved.localFilename)
+		}
+		_, err = resolveOutput(config.Output{Name: "latency", RemotePath: "/tmp/results.csv", LocalPath: "${DIR}/results.csv"}, map[string]string{"DIR": ".."})
+		if err == nil || !strings.Contains(err.Error(), "not a path inside the run directory") {
+			t.Fatalf("expected a local_path outside the run directory to fail, got %v", err)
+		}
+	})
+
 	t.Run("empty name after expansion", func(t *testing.T) {
 		emptyEnv := map[string]string{"EMPTY": ""}
 		_, err := resolveOutput(config.Output{
@@ -170,6 +191,45 @@ func TestPrepareMetadataForSave(t *testing.T) {
 			t.Fatalf("name = %q", output.Name)
 		}
 	})
+
+	t.Run("redacts plaintext passwords", func(t *testing.T) {
+		hosts := map[string]config.Host{
+			"vm1": {IP: "10.0.0.1", Password: "hunter2", KeyPassword: "env://KEY_PASSWORD", KeyFile: "~/.ssh/id"},
+		}
+		cfg := &config.Config{
+			Benchmark: config.Benchmark{Name: "bench", OutputDir: outputDir},
+			Hosts:     hosts,
+			Stages:    []config.Stage{{Name: "run", Host: "vm1", Command: "echo ok"}},
+		}
+		metadata := &RunMetadata{Config: cfg, Hosts: hosts}
+		prepareMetadataForSave(metadata, "1", runDir, nil)
+
+		for _, host := range []config.Host{metadata.Hosts["vm1"], metadata.Config.Hosts["vm1"]} {
+			if host.Password != redacted || host.KeyPassword != "env://KEY_PASSWORD" || host.KeyFile != "~/.ssh/id" {
+				t.Fatalf("unexpected host in metadata: %+v", host)
+			}
+		}
+		if hosts["vm1"].Password != "hunter2" {
+			t.Fatal("expected the hosts of the run to keep the password")
+		}
+	})
+
+	t.Run("redacts plaintext webhook secrets", func(t *testing.T) {
+		webhooks := []config.Webhook{{URL: "https://hooks.example.com", Secret: "s3cret"}, {URL: "https://hooks.example.com", Secret: "env://HOOK_SECRET"}}
+		cfg := &config.Config{
+			Benchmark: config.Benchmark{Name: "bench", OutputDir: outputDir, Webhooks: webhooks},
+			Stages:    []config.Stage{{Name: "run", Command: "echo ok"}},
+		}
+		metadata := &RunMetadata{Config: cfg}
+		prepareMetadataForSave(metadata, "1", runDir, nil)
+
+		if got := metadata.Config.Benchmark.Webhooks; got[0].Secret != redacted || got[1].Secret != "env://HOOK_SECRET" {
+			t.Fatalf("unexpected webhooks in metadata: %+v", got)
+		}
+		if webhooks[0].Secret != "s3cret" {
+			t.Fatal("expected the webhooks of the run to keep the secret")
+		}
+	})
 }
 
 func TestCollectStageOutputs(t *testing.T) {
@@ -195,7 +255,7 @@ func TestCollectStageOutputs(t *testing.T) {
 		}
 		env := map[string]string{EnvHost: "host-a"}
 
-		if err := collectStageOutputs(context.Background(), client, runDir, stage, logger, env); err != nil {
+		if _, err := collectStageOutputs(context.Background(), client, runDir, stage, logger, env, time.Time{}); err != nil {
 			t.Fatalf("collectStageOutputs: %v", err)
 		}
 		expected := filepath.Join(runDir, "host-a-metrics.csv")
@@ -226,7 +286,7 @@ func TestCollectStageOutputs(t *testing.T) {
 			}},
 		}
 
-		if err := collectStageOutputs(context.Background(), client, runDir, stage, logger, env); err != nil {
+		if _, err := collectStageOutputs(context.Background(), client, runDir, stage, logger, env, time.Time{}); err != nil {
 			t.Fatalf("collectStageOutputs: %v", err)
 		}
 		expected := filepath.Join(runDir, "openfaas-sustained.csv")
@@ -234,4 +294,190 @@ func TestCollectStageOutputs(t *testing.T) {
 			t.Fatalf("expected %s: %v", expected, err)
 		}
 	})
+
+	t.Run("cleanup_remote removes collected files", func(t *testing.T) {
+		remoteDir := t.TempDir()
+		runDir := t.TempDir()
+		stage := config.Stage{Name: "run"}
+		for _, compress := range []string{"", "gzip"} {
+			remotePath := filepath.Join(remoteDir, "latency"+compress+".csv")
+			if err := os.WriteFile(remotePath, []byte("latency_ms\n1\n"), 0644); err != nil {
+				t.Fatalf("write remote file: %v", err)
+			}
+			stage.Outputs = append(stage.Outputs, config.Output{
+				Name:          "latency" + compress,
+				RemotePath:    remotePath,
+				Compress:      compress,
+				CleanupRemote: true,
+			})
+		}
+
+		if _, err := collectStageOutputs(context.Background(), client, runDir, stage, logger, nil, time.Time{}); err != nil {
+			t.Fatalf("collectStageOutputs: %v", err)
+		}
+		for _, name := range []string{"latency.csv", "latencygzip.csv.gz"} {
+			if _, err := os.Stat(filepath.Join(runDir, name)); err != nil {
+				t.Fatalf("expected %s: %v", name, err)
+			}
+		}
+		if entries, _ := os.ReadDir(remoteDir); len(entries) != 0 {
+			t.Fatalf("expected remote files to be removed, found %v", entries)
+		}
+	})
+
+	t.Run("remote_path pattern collects every match", func(t *testing.T) {
+		remoteDir := t.TempDir()
+		runDir := t.TempDir()
+		for _, name := range []string{"node-1/latency.csv", "node 2/latency.csv", "node-3/latency.txt"} {
+			remotePath := filepath.Join(remoteDir, name)
+			if err := os.MkdirAll(filepath.Dir(remotePath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(remotePath, []byte("latency_ms\n1\n"), 0644); err != nil {
+				t.Fatalf("write remote file: %v", err)
+			}
+		}
+		stage := config.Stage{
+			Name:    "run",
+			Outputs: []config.Output{{Name: "latency", RemotePath: filepath.Join(remoteDir, "node*", "*.csv")}},
+		}
+
+		collected, err := collectStageOutputs(context.Background(), client, runDir, stage, logger, nil, time.Time{})
+		if err != nil {
+			t.Fatalf("collectStageOutputs: %v", err)
+		}
+		if len(collected) != 2 || collected[0].name != "latency.node 2.latency" || collected[1].file != "latency/node-1/latency.csv" {
+			t.Fatalf("collected = %+v", collected)
+		}
+		for _, name := range []string{"latency/node-1/latency.csv", "latency/node 2/latency.csv"} {
+			if _, err := os.Stat(filepath.Join(runDir, name)); err != nil {
+				t.Fatalf("expected %s: %v", name, err)
+			}
+		}
+
+		stage.Outputs[0].RemotePath = filepath.Join(remoteDir, "*.json")
+		if _, err := collectStageOutputs(context.Background(), client, runDir, stage, logger, nil, time.Time{}); err == nil || !strings.Contains(err.Error(), "no files match") {
+			t.Fatalf("expected a pattern without matches to fail, got %v", err)
+		}
+	})
+}
+
+func TestShellGlobQuotesLiteralText(t *testing.T) {
+	tests := map[string]string{
+		"/var/log/bench/*.csv":  `'/var/log/bench/'*'.csv'`,
+		"/tmp/run-?/out[0-9]":   `'/tmp/run-'?'/out'['0'-'9']`,
+		"/tmp/[!a]$(reboot)*":   `'/tmp/'[!'a']'$(reboot)'*`,
+		"/tmp/unclosed[x/*.log": `'/tmp/unclosed[x/'*'.log'`,
+	}
+	for pattern, want := range tests {
+		if got := shellGlob(pattern); got != want {
+			t.Errorf("shellGlob(%q) = %s, want %s", pattern, got, want)
+		}
+	}
+}
+
+func TestCollectStageOutputsDetectsStaleFiles(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	client := execution.NewLocalClient()
+	t.Cleanup(func() { _ = client.Close() })
+	remoteDir := t.TempDir()
+	stalePath := filepath.Join(remoteDir, "stale.csv")
+	freshPath := filepath.Join(remoteDir, "fresh.csv")
+	for _, path := range []string{stalePath, freshPath} {
+		if err := os.WriteFile(path, []byte("latency_ms\n1\n"), 0644); err != nil {
+			t.Fatalf("write remote file: %v", err)
+		}
+	}
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	if err := os.Chtimes(stalePath, lastWeek, lastWeek); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	startedAt := time.Now().Add(-time.Minute)
+
+	modTime, stale, err := outputIsStale(context.Background(), client, stalePath, startedAt)
+	if err != nil || !stale || modTime.Unix() != lastWeek.Unix() {
+		t.Fatalf("outputIsStale(stale) = %v, %v, %v", modTime, stale, err)
+	}
+	if _, stale, err := outputIsStale(context.Background(), client, freshPath, startedAt); err != nil || stale {
+		t.Fatalf("outputIsStale(fresh) = %v, %v", stale, err)
+	}
+
+	runDir := t.TempDir()
+	stage := config.Stage{Name: "run", Outputs: []config.Output{
+		{Name: "warned", RemotePath: stalePath},
+		{Name: "ignored", RemotePath: stalePath, OnStale: "ignore"},
+		{Name: "failed", RemotePath: stalePath, OnStale: "fail"},
+		{Name: "fresh", RemotePath: freshPath, OnStale: "fail"},
+		{Name: "matched", RemotePath: filepath.Join(remoteDir, "*.csv"), OnStale: "fail"},
+		{Name: "missing", RemotePath: filepath.Join(remoteDir, "missing.csv")},
+	}}
+	_, err = collectStageOutputs(context.Background(), client, runDir, stage, logger, nil, startedAt)
+	if err == nil || !strings.Contains(err.Error(), "output failed for stage run is stale") || !strings.Contains(err.Error(), "output matched.stale for stage run is stale") {
+		t.Fatalf("expected stale output errors, got %v", err)
+	}
+	for name, want := range map[string]bool{"warned.csv": true, "ignored.csv": true, "failed.csv": false, "fresh.csv": true, "matched/stale.csv": false, "matched/fresh.csv": true} {
+		if _, err := os.Stat(filepath.Join(runDir, name)); (err == nil) != want {
+			t.Fatalf("%s collected = %v, want %v", name, err == nil, want)
+		}
+	}
+	if !strings.Contains(logs.String(), `msg="output age not checked" output=missing`) {
+		t.Fatalf("expected a warning for the output whose age could not be checked, got logs:\n%s", logs.String())
+	}
+}
+
+func TestVerifyTransfer(t *testing.T) {
+	client := execution.NewLocalClient()
+	t.Cleanup(func() { _ = client.Close() })
+	dir := t.TempDir()
+	remotePath := filepath.Join(dir, "remote.csv")
+	localPath := filepath.Join(dir, "local.csv")
+	if err := os.WriteFile(remotePath, []byte("a\n1\n"), 0644); err != nil {
+		t.Fatalf("write remote file: %v", err)
+	}
+	if err := os.WriteFile(localPath, []byte("a\n1\n"), 0644); err != nil {
+		t.Fatalf("write local file: %v", err)
+	}
+	if err := verifyTransfer(context.Background(), client, remotePath, localPath); err != nil {
+		t.Fatalf("verifyTransfer: %v", err)
+	}
+
+	if err := os.WriteFile(localPath, []byte("a\n"), 0644); err != nil {
+		t.Fatalf("truncate local file: %v", err)
+	}
+	err := verifyTransfer(context.Background(), client, remotePath, localPath)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestOutputLocalPathKeepsIterationsApart(t *testing.T) {
+	remoteDir := t.TempDir()
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "sweep", OutputDir: t.TempDir()},
+		Cases:     []config.Case{{Name: "small", Env: map[string]string{"THREADS": "2"}}, {Name: "large", Env: map[string]string{"THREADS": "16"}}},
+		Stages: []config.Stage{{
+			Name:    "load",
+			Command: "echo $BENCHCTL_ITERATION-$THREADS > '" + remoteDir + "/results.csv'; mkdir -p '" + remoteDir + "/logs'; echo $THREADS > '" + remoteDir + "/logs/client.log'",
+			Outputs: []config.Output{
+				{Name: "results", RemotePath: filepath.Join(remoteDir, "results.csv"), LocalPath: "results_${BENCHCTL_ITERATION}_${THREADS}.csv"},
+				{Name: "logs", RemotePath: filepath.Join(remoteDir, "logs", "*.log"), LocalPath: "logs/${BENCHCTL_CASE_NAME}"},
+			},
+		}},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	for file, want := range map[string]string{
+		"results_1_2.csv":       "1-2",
+		"results_2_16.csv":      "2-16",
+		"logs/small/client.log": "2",
+		"logs/large/client.log": "16",
+	} {
+		data, err := os.ReadFile(filepath.Join(result.RunDir, filepath.FromSlash(file)))
+		if err != nil || strings.TrimSpace(string(data)) != want {
+			t.Errorf("%s = %q, %v, want %q", file, data, err, want)
+		}
+	}
 }
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// stagePipe streams the stdout of a stage into the stdin of the stage naming it in
+// pipe_from.
+type stagePipe struct {
+	reader *io.PipeReader
+	writer *io.PipeWriter
+	// stop cancels the command of the producer, which runs concurrently with the
+	// stages after it.
+	stopCtx context.Context
+	stop    context.CancelFunc
+	started bool
+	done    chan error
+	// stopped is set once the consumer finished, after which the producer failing
+	// to write, or being canceled, is expected.
+	stopped atomic.Bool
+	finish  sync.Once
+	err     error
+}
+
+// stagePipes are the pipes of the stages of a case, keyed by producer and by
+// consumer stage name.
+type stagePipes struct {
+	producers map[string]*stagePipe
+	consumers map[string]*stagePipe
+}
+
+// newStagePipes creates the pipes of the pipe_from stages, fresh for every case.
+func newStagePipes(stages []config.Stage) *stagePipes {
+	pipes := &stagePipes{producers: map[string]*stagePipe{}, consumers: map[string]*stagePipe{}}
+	for _, stage := range stages {
+		if stage.PipeFrom == "" {
+			continue
+		}
+		reader, writer := io.Pipe()
+		stopCtx, stop := context.WithCancel(context.Background())
+		pipe := &stagePipe{reader: reader, writer: writer, stopCtx: stopCtx, stop: stop, done: make(chan error, 1)}
+		pipes.producers[stage.PipeFrom] = pipe
+		pipes.consumers[stage.Name] = pipe
+	}
+	return pipes
+}
+
+// wrap runs producers concurrently with the stages after them, and waits for the
+// producer once its consumer finished, reporting failures of both.
+func (p *stagePipes) wrap(run func(ctx context.Context, i int, stage config.Stage) error) func(ctx context.Context, i int, stage config.Stage) error {
+	return func(ctx context.Context, i int, stage config.Stage) error {
+		if pipe := p.producers[stage.Name]; pipe != nil {
+			pipe.started = true
+			go func() {
+				err := run(ctx, i, stage)
+				// A skipped or failed producer ends the input of the consumer.
+				_ = pipe.writer.Close()
+				pipe.done <- err
+			}()
+			return nil
+		}
+		err := run(ctx, i, stage)
+		if pipe := p.consumers[stage.Name]; pipe != nil {
+			err = errors.Join(err, pipe.wait())
+		}
+		return err
+	}
+}
+
+// wait stops the producer of a finished consumer and returns its error.
+func (s *stagePipe) wait() error {
+	s.finish.Do(func() {
+		s.stopped.Store(true)
+		_ = s.reader.Close()
+		s.stop()
+		if s.started {
+			s.err = <-s.done
+		}
+	})
+	return s.err
+}
+
+// close stops the producers whose consumer never ran, as when the case was aborted.
+func (p *stagePipes) close() {
+	for _, pipe := range p.producers {
+		_ = pipe.wait()
+	}
+}
+
+// connect points the command of stage at its pipes. The stream bypasses the PTY
+// and the captured output.
+func (p *stagePipes) connect(stage string, request *execution.CommandRequest) {
+	if pipe := p.producers[stage]; pipe != nil {
+		request.Stdout = pipe.writer
+		request.UsePTY = false
+		request.DisableCapture = true
+	}
+	if pipe := p.consumers[stage]; pipe != nil {
+		request.Stdin = pipe.reader
+		request.UsePTY = false
+	}
+}
+
+// commandContext returns the context to run the command of stage in, which a
+// producer loses once its consumer finished.
+func (p *stagePipes) commandContext(ctx context.Context, stage string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if pipe := p.producers[stage]; pipe != nil {
+		context.AfterFunc(pipe.stopCtx, cancel)
+	}
+	return ctx, cancel
+}
+
+// stoppedByConsumer reports whether stage is a producer stopped because its
+// consumer finished.
+func (p *stagePipes) stoppedByConsumer(stage string) bool {
+	pipe := p.producers[stage]
+	return pipe != nil && pipe.stopped.Load()
+}
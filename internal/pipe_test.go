@@ -0,0 +1,74 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestPipedStageReadsProducerStdout(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "pipe", OutputDir: t.TempDir()},
+		Stages: []config.Stage{
+			{Name: "generate", Command: "seq 1 5"},
+			{
+				Name:              "consume",
+				Command:           "echo \"lines: $(wc -l)\"",
+				PipeFrom:          "generate",
+				MetricsFromOutput: []config.OutputMetric{{Name: "lines", Pattern: `lines:\s+(\d+)`}},
+			},
+		},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if result.Metadata.Custom["lines"] != "5" {
+		t.Fatalf("expected the consumer to read 5 lines, got metrics %v", result.Metadata.Custom)
+	}
+}
+
+func TestPipedStageStopsProducerWhenDone(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "pipe", OutputDir: t.TempDir()},
+		Stages: []config.Stage{
+			{Name: "generate", Command: "while true; do echo request; done"},
+			{
+				Name:              "consume",
+				Command:           "echo \"lines: $(head -n 3 | wc -l)\"",
+				PipeFrom:          "generate",
+				MetricsFromOutput: []config.OutputMetric{{Name: "lines", Pattern: `lines:\s+(\d+)`}},
+			},
+		},
+	}
+	started := time.Now()
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("expected the producer to be stopped, the run took %s", elapsed)
+	}
+	if result.Metadata.Status != "success" || result.Metadata.Custom["lines"] != "3" {
+		t.Fatalf("metadata: status %s metrics %v", result.Metadata.Status, result.Metadata.Custom)
+	}
+}
+
+func TestPipedStageReportsFailedProducer(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "pipe", OutputDir: t.TempDir()},
+		Stages: []config.Stage{
+			{Name: "generate", Command: "echo partial; exit 2"},
+			{Name: "consume", Command: "cat >/dev/null", PipeFrom: "generate"},
+		},
+	}
+	_, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "stage generate failed") {
+		t.Fatalf("expected the producer failure, got %v", err)
+	}
+}
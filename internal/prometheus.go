@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// promSample is one sample line of the Prometheus text exposition format.
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// isPrometheusOutput reports whether a collected output is parsed as Prometheus text:
+// format prometheus, or a .prom remote path when no format is set.
+func isPrometheusOutput(output config.Output, remotePath string) bool {
+	if output.Format != "" {
+		return output.Format == "prometheus"
+	}
+	return filepath.Ext(remotePath) == ".prom"
+}
+
+// prometheusMetrics reads the exposition file at path and returns its samples as run
+// metrics named <output>_<metric>{label="value",...}, with labels sorted by name.
+func prometheusMetrics(outputName, path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return readPrometheusMetrics(outputName, filepath.Base(path), file)
+}
+
+// readPrometheusMetrics is prometheusMetrics for the file name, which is closed.
+func readPrometheusMetrics(outputName, name string, file io.ReadCloser) (map[string]string, error) {
+	content, err := decompressed(name, file)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	samples, err := parsePrometheusText(content)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+	metrics := make(map[string]string, len(samples))
+	for _, sample := range samples {
+		metrics[outputName+"_"+sample.name+formatSampleLabels(sample.labels)] = strconv.FormatFloat(sample.value, 'g', -1, 64)
+	}
+	return metrics, nil
+}
+
+func formatSampleLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// parsePrometheusText parses the sample lines of the text exposition format.
+// Comments, HELP and TYPE lines, and the optional timestamp are ignored.
+func parsePrometheusText(r io.Reader) ([]promSample, error) {
+	var samples []promSample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, err := parsePrometheusLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+func parsePrometheusLine(line string) (promSample, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return promSample{}, fmt.Errorf("missing value in %q", line)
+	}
+	sample := promSample{name: line[:end]}
+	rest := line[end:]
+	if strings.HasPrefix(rest, "{") {
+		labels, remaining, err := parsePrometheusLabels(rest[1:])
+		if err != nil {
+			return promSample{}, err
+		}
+		sample.labels = labels
+		rest = remaining
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return promSample{}, fmt.Errorf("expected a value and an optional timestamp after %s", sample.name)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return promSample{}, fmt.Errorf("invalid value %q for %s", fields[0], sample.name)
+	}
+	sample.value = value
+	return sample, nil
+}
+
+// parsePrometheusLabels parses `name="value",...}` and returns the text after the brace.
+func parsePrometheusLabels(s string) (map[string]string, string, error) {
+	labels := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+			return nil, "", fmt.Errorf("invalid label in %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		var value strings.Builder
+		i := eq + 2
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, "", fmt.Errorf("unterminated value of label %s", name)
+		}
+		labels[name] = value.String()
+		s = s[i+1:]
+	}
+}
@@ -0,0 +1,89 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+const exposition = `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 1027 1395066363000
+http_requests_total{code="500",method="get"} 3
+process_resident_memory_bytes 2.5e+07
+label_escapes{path="C:\\tmp \"a\""} 1
+`
+
+func TestParsePrometheusText(t *testing.T) {
+	samples, err := parsePrometheusText(strings.NewReader(exposition))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("expected 4 samples, got %+v", samples)
+	}
+	if samples[0].name != "http_requests_total" || samples[0].labels["code"] != "200" || samples[0].value != 1027 {
+		t.Fatalf("unexpected first sample: %+v", samples[0])
+	}
+	if samples[3].labels["path"] != `C:\tmp "a"` {
+		t.Fatalf("unexpected escaped label: %q", samples[3].labels["path"])
+	}
+
+	if _, err := parsePrometheusText(strings.NewReader("broken{code=200} 1\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected parse error with line number, got %v", err)
+	}
+}
+
+func TestCollectStageOutputsParsesPrometheusOutputs(t *testing.T) {
+	remoteDir, runDir := t.TempDir(), t.TempDir()
+	remotePath := filepath.Join(remoteDir, "metrics.prom")
+	if err := os.WriteFile(remotePath, []byte(exposition), 0644); err != nil {
+		t.Fatalf("write exposition: %v", err)
+	}
+	stage := config.Stage{Name: "scrape", Outputs: []config.Output{{Name: "server", RemotePath: remotePath}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	collected, err := collectStageOutputs(context.Background(), execution.NewLocalClient(), runDir, stage, logger, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("collectStageOutputs: %v", err)
+	}
+	metrics, err := outputMetrics(runDir, stage, collected, logger)
+	if err != nil {
+		t.Fatalf("outputMetrics: %v", err)
+	}
+	want := map[string]string{
+		`server_http_requests_total{code="200",method="get"}`: "1027",
+		`server_http_requests_total{code="500",method="get"}`: "3",
+		"server_process_resident_memory_bytes":                "2.5e+07",
+	}
+	for key, value := range want {
+		if metrics[key] != value {
+			t.Fatalf("metric %s = %q, want %q (all: %v)", key, metrics[key], value, metrics)
+		}
+	}
+
+	expectation, err := config.ParseExpectation(`server_http_requests_total{code="500",method="get"} < 10`)
+	if err != nil || expectation.Metric != `server_http_requests_total{code="500",method="get"}` {
+		t.Fatalf("expected labeled metric expectation to parse, got %+v %v", expectation, err)
+	}
+
+	stage.Outputs[0].Format = "raw"
+	collected, err = collectStageOutputs(context.Background(), execution.NewLocalClient(), runDir, stage, logger, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("collectStageOutputs: %v", err)
+	}
+	metrics, err = outputMetrics(runDir, stage, collected, logger)
+	if err != nil || len(metrics) != 0 {
+		t.Fatalf("expected raw output not to be parsed, got %v %v", metrics, err)
+	}
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// provisionPollInterval is the time between checks of a new instance.
+var provisionPollInterval = 2 * time.Second
+
+// ProvisionedInstance records a cloud instance created for a provisioned host.
+type ProvisionedInstance struct {
+	Host      string     `json:"host"`
+	Provider  string     `json:"provider"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Region    string     `json:"region"`
+	Image     string     `json:"image"`
+	IP        string     `json:"ip,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // unset when the instance was not deleted
+}
+
+// cloudProvider creates and deletes the instances of one provider.
+type cloudProvider interface {
+	// create starts an instance and returns once it runs with a public IP.
+	create(ctx context.Context, name, runID string, p config.Provision) (ProvisionedInstance, error)
+	delete(ctx context.Context, id string) error
+}
+
+// cloudProviders opens the provider of a provision block by name.
+var cloudProviders = map[string]func(p config.Provision) (cloudProvider, error){
+	"hetzner": newHetznerProvider,
+}
+
+// instanceNameInvalid matches the characters not allowed in instance names.
+var instanceNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// provisionHosts creates the instances of the provisioned hosts of cfg in
+// parallel and waits until each accepts SSH connections. It returns cfg with the
+// public IPs of the instances filled in, the instances, and the function deleting
+// them, which must be called even when provisioning fails.
+func provisionHosts(ctx context.Context, cfg *config.Config, runID string, logger *slog.Logger) (*config.Config, []ProvisionedInstance, func() error, error) {
+	var aliases []string
+	for _, alias := range slices.Sorted(maps.Keys(cfg.Hosts)) {
+		if cfg.Hosts[alias].Provision != nil {
+			aliases = append(aliases, alias)
+		}
+	}
+	if len(aliases) == 0 {
+		return cfg, nil, func() error { return nil }, nil
+	}
+
+	instances := make([]ProvisionedInstance, len(aliases))
+	providers := make([]cloudProvider, len(aliases))
+	errs := make([]error, len(aliases))
+	var wg sync.WaitGroup
+	for i, alias := range aliases {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instances[i], providers[i], errs[i] = provisionHost(ctx, alias, cfg.Hosts[alias], runID, logger)
+		}()
+	}
+	wg.Wait()
+
+	hosts := maps.Clone(cfg.Hosts)
+	var created []ProvisionedInstance
+	var createdBy []cloudProvider
+	for i, instance := range instances {
+		if instance.ID != "" {
+			created = append(created, instance)
+			createdBy = append(createdBy, providers[i])
+		}
+		host := hosts[instance.Host]
+		host.IP = instance.IP
+		if host.Username == "" {
+			host.Username = "root"
+		}
+		hosts[instance.Host] = host
+	}
+
+	// teardown marks the deleted instances in created, which the run metadata shares.
+	teardown := func() error {
+		var errs []error
+		for i := range created {
+			instance := &created[i]
+			if instance.DeletedAt != nil {
+				continue
+			}
+			// Instances are deleted even after the run was cancelled.
+			deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+			err := createdBy[i].delete(deleteCtx, instance.ID)
+			cancel()
+			if err != nil {
+				err = fmt.Errorf("delete instance %s of host %s: %w", instance.ID, instance.Host, err)
+				logError(logger, "instance teardown failed; delete it manually", err, "host", instance.Host, "provider", instance.Provider, "id", instance.ID)
+				errs = append(errs, err)
+				continue
+			}
+			deletedAt := clockFrom(ctx).Now()
+			instance.DeletedAt = &deletedAt
+			logger.Info("instance deleted", "host", instance.Host, "provider", instance.Provider, "id", instance.ID)
+		}
+		return errors.Join(errs...)
+	}
+	provisioned := *cfg
+	provisioned.Hosts = hosts
+	return &provisioned, created, teardown, errors.Join(errs...)
+}
+
+// provisionHost creates the instance of one host and waits for its SSH server.
+// The instance is returned with its ID whenever it was created.
+func provisionHost(ctx context.Context, alias string, host config.Host, runID string, logger *slog.Logger) (ProvisionedInstance, cloudProvider, error) {
+	p := *host.Provision
+	instance := ProvisionedInstance{Host: alias, Provider: p.Provider}
+	provider, err := cloudProviders[p.Provider](p)
+	if err != nil {
+		return instance, nil, fmt.Errorf("provision host %s: %w", alias, err)
+	}
+	timeout, err := time.ParseDuration(p.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name := strings.Trim(instanceNameInvalid.ReplaceAllString(strings.ToLower("benchctl-"+runID+"-"+alias), "-"), "-")
+	logger.Info("provisioning instance", "host", alias, "provider", p.Provider, "type", p.Type, "region", p.Region, "image", p.Image)
+	created, err := provider.create(ctx, name, runID, p)
+	if created.ID != "" {
+		instance = created
+		instance.Host = alias
+		instance.Provider = p.Provider
+	}
+	if err != nil {
+		return instance, provider, fmt.Errorf("provision host %s: %w", alias, err)
+	}
+	host.IP = instance.IP
+	address := sshAddress(host)
+	for {
+		err := probeSSH(ctx, address, 5*time.Second)
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return instance, provider, fmt.Errorf("provision host %s: instance %s at %s did not accept SSH connections within %s: %w", alias, instance.ID, address, timeout, err)
+		case <-time.After(provisionPollInterval):
+		}
+	}
+	logger.Info("instance provisioned", "host", alias, "provider", p.Provider, "id", instance.ID, "ip", instance.IP, "type", instance.Type, "region", instance.Region)
+	return instance, provider, nil
+}
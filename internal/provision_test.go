@@ -0,0 +1,130 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// fakeHetzner serves the server endpoints of the Hetzner Cloud API for servers at
+// 127.0.0.1, and returns the requests it received.
+func fakeHetzner(t *testing.T, createStatus int) *[]string {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		entry := r.Method + " " + r.URL.Path
+		if r.Method == http.MethodPost {
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			entry += " " + body["name"].(string) + " " + body["server_type"].(string) + " " + body["location"].(string)
+		}
+		requests = append(requests, entry)
+		server := `{"server": {"id": 42, "status": "%s", "public_net": {"ipv4": {"ip": "127.0.0.1"}}, "server_type": {"name": "cx22"}, "datacenter": {"location": {"name": "fsn1"}}}}`
+		switch {
+		case r.Method == http.MethodPost && createStatus != http.StatusCreated:
+			w.WriteHeader(createStatus)
+			_, _ = w.Write([]byte(`{"error": {"code": "resource_unavailable", "message": "server type cx22 is unavailable in fsn1"}}`))
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(strings.Replace(server, "%s", "initializing", 1)))
+		case r.Method == http.MethodGet:
+			_, _ = w.Write([]byte(strings.Replace(server, "%s", "running", 1)))
+		case r.Method == http.MethodDelete:
+			_, _ = w.Write([]byte(`{"action": {"id": 7}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	previousAPI, previousInterval := hetznerAPI, provisionPollInterval
+	hetznerAPI, provisionPollInterval = server.URL, time.Millisecond
+	t.Cleanup(func() { hetznerAPI, provisionPollInterval = previousAPI, previousInterval })
+	t.Setenv("HCLOUD_TOKEN", "secret-token")
+	return &requests
+}
+
+// sshBanner listens on 127.0.0.1 and greets every connection like an SSH server,
+// and returns the port.
+func sshBanner(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			conn.Close()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func provisionConfig(t *testing.T, port int) *config.Config {
+	return &config.Config{
+		Benchmark: config.Benchmark{Name: "cloud", OutputDir: t.TempDir()},
+		Hosts: map[string]config.Host{"server": {
+			Port:      port,
+			Provision: &config.Provision{Provider: "hetzner", Type: "cx22", Region: "fsn1", Image: "ubuntu-24.04"},
+		}},
+		Stages: []config.Stage{{Name: "load", Host: "server", Command: "true"}},
+	}
+}
+
+func TestProvisionedHostsRunOnNewInstances(t *testing.T) {
+	requests := fakeHetzner(t, http.StatusCreated)
+	cfg := provisionConfig(t, sshBanner(t))
+	var dialed []config.Host
+	ctx := WithClientFactory(context.Background(), func(host config.Host) (execution.ExecutionClient, error) {
+		dialed = append(dialed, host)
+		return execution.NewLocalClient(), nil
+	})
+	result, err := RunWorkflow(ctx, cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if len(dialed) == 0 || dialed[0].IP != "127.0.0.1" || dialed[0].Username != "root" {
+		t.Fatalf("expected the stage to connect to the instance as root, got %+v", dialed)
+	}
+	instances := result.Metadata.Instances
+	if len(instances) != 1 || instances[0].ID != "42" || instances[0].Type != "cx22" || instances[0].Region != "fsn1" || instances[0].DeletedAt == nil {
+		t.Fatalf("instances = %+v", instances)
+	}
+	got := strings.Join(*requests, "\n")
+	if !strings.HasPrefix(got, "POST /servers benchctl-1-server cx22 fsn1\nGET /servers/42") || !strings.HasSuffix(got, "DELETE /servers/42") {
+		t.Fatalf("unexpected API requests:\n%s", got)
+	}
+}
+
+func TestProvisioningFailureFailsTheRun(t *testing.T) {
+	requests := fakeHetzner(t, http.StatusUnprocessableEntity)
+	cfg := provisionConfig(t, sshBanner(t))
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "server type cx22 is unavailable in fsn1") {
+		t.Fatalf("expected the provider error, got %v", err)
+	}
+	if len(result.Metadata.Instances) != 0 || len(*requests) != 1 {
+		t.Fatalf("expected no instance, got %+v after %v", result.Metadata.Instances, *requests)
+	}
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"path/filepath"
+
+	"github.com/goccy/go-yaml"
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// redacted replaces credentials in rendered configs.
+const redacted = "<redacted>"
+
+// renderRunID stands in for the run ID, which is only assigned when a run starts.
+const renderRunID = "${" + EnvRunID + "}"
+
+// RenderConfig resolves the templates of a validated config the way a run would and
+// returns it as YAML with plaintext host passwords and webhook secrets redacted.
+// cfg is modified in place.
+func RenderConfig(cfg *config.Config, envVars map[string]string) ([]byte, error) {
+	resolveConfigTemplates(cfg, renderRunID, filepath.Join(cfg.Benchmark.OutputDir, renderRunID), envVars)
+	cfg.Hosts = redactHosts(cfg.Hosts)
+	cfg.Benchmark.Webhooks = redactWebhooks(cfg.Benchmark.Webhooks)
+	return yaml.Marshal(cfg)
+}
+
+// redactWebhooks returns a copy of webhooks with plaintext secrets redacted, like
+// redactHosts. Validation rejects them, but configs built in Go skip it.
+func redactWebhooks(webhooks []config.Webhook) []config.Webhook {
+	if webhooks == nil {
+		return nil
+	}
+	redactedWebhooks := make([]config.Webhook, len(webhooks))
+	for i, webhook := range webhooks {
+		if webhook.Secret != "" && !config.IsSecretRef(webhook.Secret) {
+			webhook.Secret = redacted
+		}
+		redactedWebhooks[i] = webhook
+	}
+	return redactedWebhooks
+}
+
+// redactHosts returns a copy of hosts with plaintext passwords redacted. Secret
+// references are kept, since they only name where the secret lives.
+func redactHosts(hosts map[string]config.Host) map[string]config.Host {
+	if hosts == nil {
+		return nil
+	}
+	redactedHosts := make(map[string]config.Host, len(hosts))
+	for alias, host := range hosts {
+		if host.Password != "" && !config.IsSecretRef(host.Password) {
+			host.Password = redacted
+		}
+		if host.KeyPassword != "" && !config.IsSecretRef(host.KeyPassword) {
+			host.KeyPassword = redacted
+		}
+		if host.BecomePassword != "" && !config.IsSecretRef(host.BecomePassword) {
+			host.BecomePassword = redacted
+		}
+		redactedHosts[alias] = host
+	}
+	return redactedHosts
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// ResetRecord describes one reset hook executed before a case.
+type ResetRecord struct {
+	BeforeCase      string    `json:"before_case"`
+	Hook            string    `json:"hook"`
+	Host            string    `json:"host"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// resetHosts runs the benchmark reset hooks in order, stopping at the first failure.
+func resetHosts(
+	ctx context.Context,
+	cfg *config.Config,
+	runID, runDir string,
+	envVars map[string]string,
+	benchmarkCase config.Case,
+	logger *slog.Logger,
+) ([]ResetRecord, error) {
+	clock := clockFrom(ctx)
+	var records []ResetRecord
+	for _, hook := range cfg.Benchmark.Reset {
+		hostAlias := hook.Host
+		if hostAlias == "" {
+			hostAlias = "local"
+		}
+		record := ResetRecord{BeforeCase: benchmarkCase.Name, Hook: hook.Name, Host: hostAlias, StartedAt: clock.Now()}
+		logger.Info("reset started", "reset", hook.Name, "case", benchmarkCase.Name, "host", hostAlias)
+
+		err := runResetHook(ctx, cfg, hook, runID, runDir, envVars, benchmarkCase, hostAlias)
+		record.DurationSeconds = clock.Now().Sub(record.StartedAt).Seconds()
+		records = append(records, record)
+		if err != nil {
+			err = fmt.Errorf("reset %s before case %s: %w", hook.Name, benchmarkCase.Name, err)
+			logError(logger, "reset failed", err, "reset", hook.Name, "host", hostAlias)
+			return records, err
+		}
+		logger.Info("reset completed", "reset", hook.Name, "host", hostAlias)
+	}
+	return records, nil
+}
+
+func runResetHook(
+	ctx context.Context,
+	cfg *config.Config,
+	hook config.ResetHook,
+	runID, runDir string,
+	envVars map[string]string,
+	benchmarkCase config.Case,
+	hostAlias string,
+) error {
+	client, err := openExecutionClient(ctx, cfg.Hosts[hostAlias])
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	command := resetCommand(hook)
+	if hook.Type == "command" {
+		env := buildStageEnv(runID, runDir, cfg, envVars, benchmarkCase, hostAlias)
+		command = envPrefixFromMap(env) + wrapWithShell(hook.Command, resolveItemShell(cfg, hostAlias, ""))
+	}
+	result, err := client.RunCommand(ctx, execution.CommandRequest{Command: command})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("command exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	return err
+}
+
+// resetCommand returns the command of a built-in reset hook type.
+func resetCommand(hook config.ResetHook) string {
+	target := shellQuote(hook.Target)
+	switch hook.Type {
+	case "restart_container":
+		return "docker restart " + target
+	case "libvirt_snapshot":
+		return fmt.Sprintf("virsh snapshot-revert --domain %s --snapshotname %s --running", target, shellQuote(hook.Snapshot))
+	case "k8s_deployment":
+		namespace := ""
+		if hook.Namespace != "" {
+			namespace = " -n " + shellQuote(hook.Namespace)
+		}
+		deployment := shellQuote("deployment/" + hook.Target)
+		return fmt.Sprintf("kubectl rollout restart %s%s && kubectl rollout status %s%s --timeout=%s",
+			deployment, namespace, deployment, namespace, hook.Timeout)
+	}
+	return hook.Command
+}
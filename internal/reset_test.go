@@ -0,0 +1,59 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestExecuteStagesRunsResetHooksBetweenCases(t *testing.T) {
+	tempDir := t.TempDir()
+	logPath := filepath.Join(tempDir, "resets.txt")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{
+			Name:      "reset",
+			OutputDir: tempDir,
+			Shell:     "sh -c",
+			Reset: []config.ResetHook{{
+				Name:    "restore",
+				Type:    "command",
+				Command: "echo \"$BENCHCTL_CASE_NAME\" >> '" + logPath + "'",
+			}},
+		},
+		Cases:  []config.Case{{Name: "first"}, {Name: "second"}, {Name: "third"}},
+		Stages: []config.Stage{{Name: "noop", Command: "true"}},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metadata := &RunMetadata{RunID: "1"}
+	if err := executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), nil); err != nil {
+		t.Fatalf("executeStages: %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read reset log: %v", err)
+	}
+	if got := strings.Fields(string(data)); strings.Join(got, ",") != "second,third" {
+		t.Fatalf("expected resets before every case after the first, got %v", got)
+	}
+	if len(metadata.Resets) != 2 || metadata.Resets[0].Hook != "restore" || metadata.Resets[0].Host != "local" {
+		t.Fatalf("unexpected reset records: %+v", metadata.Resets)
+	}
+}
+
+func TestResetCommand(t *testing.T) {
+	hook := config.ResetHook{Type: "k8s_deployment", Target: "api", Namespace: "bench", Timeout: "5m"}
+	want := "kubectl rollout restart 'deployment/api' -n 'bench' && kubectl rollout status 'deployment/api' -n 'bench' --timeout=5m"
+	if got := resetCommand(hook); got != want {
+		t.Fatalf("resetCommand() = %q, want %q", got, want)
+	}
+}
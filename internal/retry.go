@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// TransferAttempts is how often a file transfer is tried before it fails.
+const TransferAttempts = 4
+
+// transferBackoff is the wait before the first retry of a transfer; it doubles
+// with every further attempt.
+var transferBackoff = time.Second
+
+// retryTransfer runs transfer until it succeeds, TransferAttempts are used up, or
+// ctx is done. Transient network errors during Scp/Upload would otherwise fail a
+// run whose measurements already succeeded. The transfer logs its progress and is
+// recorded in the run metadata.
+func retryTransfer(ctx context.Context, logger *slog.Logger, description string, transfer func(ctx context.Context) error) (err error) {
+	started := clockFrom(ctx).Now()
+	var bytes int64
+	attempt := 1
+	defer func() {
+		record := TransferRecord{
+			Transfer:        description,
+			StartedAt:       started,
+			DurationSeconds: clockFrom(ctx).Now().Sub(started).Seconds(),
+			Bytes:           bytes,
+			Attempts:        attempt,
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		recordTransfer(ctx, record)
+	}()
+	transferCtx := logTransferProgress(ctx, logger, description, &bytes)
+	backoff := transferBackoff
+	for ; ; attempt++ {
+		if err = transfer(transferCtx); err == nil {
+			return nil
+		}
+		if attempt == TransferAttempts {
+			return fmt.Errorf("%w (after %d attempts)", err, attempt)
+		}
+		logger.Warn("transfer failed, retrying", "transfer", description, "attempt", attempt, "backoff", backoff, "error", err)
+		if sleepErr := sleepContext(ctx, backoff); sleepErr != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
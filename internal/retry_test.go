@@ -0,0 +1,105 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// flakyClient fails the first failures Scp calls for every remote path.
+type flakyClient struct {
+	execution.ExecutionClient
+	failures int
+	calls    map[string]int
+}
+
+func (c *flakyClient) Scp(ctx context.Context, remotePath, localPath string) error {
+	c.calls[remotePath]++
+	if c.calls[remotePath] <= c.failures {
+		return errors.New("connection reset by peer")
+	}
+	return c.ExecutionClient.Scp(ctx, remotePath, localPath)
+}
+
+func TestCollectStageOutputsRetriesTransfers(t *testing.T) {
+	previous := transferBackoff
+	transferBackoff = time.Millisecond
+	t.Cleanup(func() { transferBackoff = previous })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	remoteDir := t.TempDir()
+	for _, name := range []string{"a.csv", "b.csv"} {
+		if err := os.WriteFile(filepath.Join(remoteDir, name), []byte("x"), 0644); err != nil {
+			t.Fatalf("write remote file: %v", err)
+		}
+	}
+	stage := config.Stage{
+		Name: "collect",
+		Outputs: []config.Output{
+			{Name: "missing", RemotePath: filepath.Join(remoteDir, "missing.csv")},
+			{Name: "a", RemotePath: filepath.Join(remoteDir, "a.csv")},
+			{Name: "b", RemotePath: filepath.Join(remoteDir, "b.csv")},
+		},
+	}
+
+	t.Run("transient failures", func(t *testing.T) {
+		runDir := t.TempDir()
+		client := &flakyClient{ExecutionClient: execution.NewLocalClient(), failures: TransferAttempts - 1, calls: map[string]int{}}
+		onlyPresent := stage
+		onlyPresent.Outputs = stage.Outputs[1:]
+		if _, err := collectStageOutputs(context.Background(), client, runDir, onlyPresent, logger, nil, time.Time{}); err != nil {
+			t.Fatalf("collectStageOutputs: %v", err)
+		}
+		if client.calls[filepath.Join(remoteDir, "a.csv")] != TransferAttempts {
+			t.Fatalf("expected %d attempts, got %v", TransferAttempts, client.calls)
+		}
+	})
+
+	t.Run("transfers are recorded", func(t *testing.T) {
+		client := &flakyClient{ExecutionClient: execution.NewLocalClient(), failures: 1, calls: map[string]int{}}
+		ctx, transfers := withTransferLog(context.Background())
+		_, err := collectStageOutputs(ctx, client, t.TempDir(), stage, logger, nil, time.Time{})
+		if err == nil {
+			t.Fatal("expected missing output error")
+		}
+		records := transfers.records()
+		if len(records) != 3 {
+			t.Fatalf("expected 3 transfers, got %+v", records)
+		}
+		for _, record := range records {
+			failed := record.Transfer == "output missing"
+			attempts := 2
+			if failed {
+				attempts = TransferAttempts
+			}
+			if record.Attempts != attempts || failed != (record.Error != "") {
+				t.Fatalf("unexpected transfer record %+v", record)
+			}
+		}
+	})
+
+	t.Run("failed output does not stop collection", func(t *testing.T) {
+		runDir := t.TempDir()
+		client := &flakyClient{ExecutionClient: execution.NewLocalClient(), calls: map[string]int{}}
+		_, err := collectStageOutputs(context.Background(), client, runDir, stage, logger, nil, time.Time{})
+		if err == nil || !strings.Contains(err.Error(), "failed to collect output missing") || !strings.Contains(err.Error(), "after 4 attempts") {
+			t.Fatalf("expected missing output error, got %v", err)
+		}
+		for _, name := range []string{"a.csv", "b.csv"} {
+			if _, statErr := os.Stat(filepath.Join(runDir, name)); statErr != nil {
+				t.Fatalf("expected %s to be collected: %v", name, statErr)
+			}
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// scrapeOutputMetrics applies the stage's metrics_from_output rules to its console
+// output. Tools usually print their summary last, so the last match of a pattern
+// wins; rules that do not match are logged and skipped.
+func scrapeOutputMetrics(stage config.Stage, output string, logger *slog.Logger) map[string]string {
+	if len(stage.MetricsFromOutput) == 0 {
+		return nil
+	}
+	metrics := make(map[string]string, len(stage.MetricsFromOutput))
+	for _, rule := range stage.MetricsFromOutput {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			logger.Warn("output metric pattern invalid", "stage", stage.Name, "metric", rule.Name, "error", err)
+			continue
+		}
+		matches := pattern.FindAllStringSubmatch(output, -1)
+		if len(matches) == 0 {
+			logger.Warn("output metric not found", "stage", stage.Name, "metric", rule.Name, "pattern", rule.Pattern)
+			continue
+		}
+		metrics[rule.Name] = strings.TrimSpace(matches[len(matches)-1][1])
+	}
+	if len(metrics) > 0 {
+		logger.Info("output metrics scraped", "stage", stage.Name, "metrics", len(metrics))
+	}
+	return metrics
+}
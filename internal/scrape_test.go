@@ -0,0 +1,37 @@
+//go:build unit
+
+package internal
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestScrapeOutputMetrics(t *testing.T) {
+	stage := config.Stage{
+		Name: "load",
+		MetricsFromOutput: []config.OutputMetric{
+			{Name: "rps", Pattern: `Requests/sec:\s+(\d+\.\d+)`},
+			{Name: "p99_ms", Pattern: `99%\s+([\d.]+)ms`},
+			{Name: "errors", Pattern: `Non-2xx responses:\s+(\d+)`},
+		},
+	}
+	output := "warmup\r\nRequests/sec:   100.50\r\n" +
+		"Latency Distribution\r\n     99%   12.40ms\r\n" +
+		"Requests/sec:  2412.73\r\n"
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	metrics := scrapeOutputMetrics(stage, output, logger)
+	want := map[string]string{"rps": "2412.73", "p99_ms": "12.40"}
+	if len(metrics) != len(want) {
+		t.Fatalf("expected %v, got %v", want, metrics)
+	}
+	for name, value := range want {
+		if metrics[name] != value {
+			t.Fatalf("metric %s = %q, want %q", name, metrics[name], value)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/luccadibe/benchctl/pkg/run"
+)
+
+// SetDownloadRate limits every artifact and archive download to bytesPerSecond;
+// zero or less removes the limit.
+func (s *Server) SetDownloadRate(bytesPerSecond int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.downloadRate = max(bytesPerSecond, 0)
+}
+
+// downloadWriter wraps w with the download rate limit of the server.
+func (s *Server) downloadWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	s.mu.Lock()
+	rate := s.downloadRate
+	s.mu.Unlock()
+	if rate == 0 {
+		return w
+	}
+	return &rateLimitedWriter{ResponseWriter: w, ctx: r.Context(), rate: rate, start: time.Now()}
+}
+
+// rateLimitedWriter writes at most rate bytes per second on average, in chunks of
+// at most a tenth of a second's worth.
+type rateLimitedWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	rate    int64
+	start   time.Time
+	written int64
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		chunk := p[:min(int64(len(p)), max(w.rate/10, 1))]
+		due := w.start.Add(time.Duration(float64(w.written) / float64(w.rate) * float64(time.Second)))
+		if wait := time.Until(due); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-w.ctx.Done():
+				return total, w.ctx.Err()
+			}
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		total += n
+		w.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// attachment sets the Content-Disposition of a download of a file named name.
+func attachment(w http.ResponseWriter, name string) {
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+}
+
+// modTime returns the modification time of an opened artifact, or the zero time
+// when the store does not provide one.
+func modTime(file io.ReadSeekCloser) time.Time {
+	if stater, ok := file.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if info, err := stater.Stat(); err == nil {
+			return info.ModTime()
+		}
+	}
+	return time.Time{}
+}
+
+// archive streams the run directory of a job run as a zip file built on the fly.
+func (s *Server) archive(w http.ResponseWriter, r *http.Request) {
+	_, snapshot, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	runID := r.PathValue("run_id")
+	var jobRun *JobRun
+	for i := range snapshot.Runs {
+		if snapshot.Runs[i].RunID == runID {
+			jobRun = &snapshot.Runs[i]
+		}
+	}
+	if jobRun == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown run %s", runID))
+		return
+	}
+	store := jobRun.store()
+	artifacts, err := store.ListArtifacts(r.Context(), runID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	attachment(w, fmt.Sprintf("%s-%s.zip", snapshot.Benchmark, runID))
+	archive := zip.NewWriter(s.downloadWriter(w, r))
+	for _, artifact := range artifacts {
+		if err := addToArchive(r.Context(), archive, store, runID, artifact.Name, artifact.ModTime); err != nil {
+			// The status line is sent; dropping the connection tells the client the
+			// archive is incomplete.
+			if r.Context().Err() == nil {
+				s.logger.Error("archive failed", "job", snapshot.ID, "run", runID, "file", artifact.Name, "error", err)
+			}
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func addToArchive(ctx context.Context, archive *zip.Writer, store run.ResultStore, runID, name string, modified time.Time) error {
+	file, err := store.OpenArtifact(ctx, runID, name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: path.Join(runID, name), Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/luccadibe/benchctl/pkg/run"
+)
+
+// WatchResults adds output directories whose stored runs GET /metrics reports on,
+// besides the directories of the runs of the server's own jobs.
+func (s *Server) WatchResults(dirs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchResults(dirs...)
+}
+
+// watchResults adds output directories to s.results. The caller holds s.mu.
+func (s *Server) watchResults(dirs ...string) {
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		if !slices.Contains(s.results, dir) {
+			s.results = append(s.results, dir)
+			s.stores = append(s.stores, run.NewLocalStore(dir))
+		}
+	}
+}
+
+// metrics serves the jobs of the server by status and the stored runs of the
+// watched output directories in the Prometheus text format.
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := map[string]int{}
+	for _, j := range s.jobs {
+		jobs[j.Status]++
+	}
+	stores := slices.Clone(s.stores)
+	s.mu.Unlock()
+
+	stored, err := s.storeMetrics.Format(r.Context(), stores...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var out strings.Builder
+	out.WriteString("# HELP benchctl_server_jobs Jobs of the server by status.\n# TYPE benchctl_server_jobs gauge\n")
+	for _, status := range []string{StatusQueued, StatusRunning, StatusSucceeded, StatusFailed, StatusCanceled} {
+		fmt.Fprintf(&out, "benchctl_server_jobs{status=%q} %d\n", status, jobs[status])
+	}
+	out.WriteString(stored)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(out.String())) // the client went away; nothing left to report to
+}
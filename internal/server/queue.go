@@ -0,0 +1,188 @@
+package server
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// targetHosts returns the machines the stages of cfg run on, identified by IP so
+// aliases of the same machine in different configs share a queue. Stages on the
+// server itself count as the host "local".
+func targetHosts(cfg *config.Config, skip []string) []string {
+	var hosts []string
+	for _, stage := range cfg.Stages {
+		if stage.Skip || slices.Contains(skip, stage.Name) {
+			continue
+		}
+		aliases := stage.Hosts
+		if len(aliases) == 0 {
+			aliases = []string{cmp.Or(strings.TrimSpace(stage.Host), "local")}
+		}
+		for _, alias := range aliases {
+			host := cmp.Or(strings.TrimSpace(cfg.Hosts[alias].IP), "local")
+			if !slices.Contains(hosts, host) {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	slices.Sort(hosts)
+	return hosts
+}
+
+// schedule starts the queued jobs whose hosts run fewer than s.concurrency jobs.
+// A job waiting for a host also holds back the later jobs on that host, so jobs
+// start in submission order per host. The caller holds s.mu.
+func (s *Server) schedule() {
+	if s.closed {
+		return
+	}
+	running := map[string]int{}
+	for _, j := range s.jobs {
+		if j.Status == StatusRunning {
+			for _, host := range j.Hosts {
+				running[host]++
+			}
+		}
+	}
+	blocked := map[string]bool{}
+	waiting := s.queue[:0]
+	for _, j := range s.queue {
+		free := !slices.ContainsFunc(j.Hosts, func(host string) bool {
+			return blocked[host] || running[host] >= s.concurrency
+		})
+		if free {
+			s.start(j)
+			for _, host := range j.Hosts {
+				running[host]++
+			}
+			continue
+		}
+		for _, host := range j.Hosts {
+			blocked[host] = true
+		}
+		waiting = append(waiting, j)
+	}
+	clear(s.queue[len(waiting):])
+	s.queue = waiting
+}
+
+// dequeue cancels a queued job. The caller holds s.mu.
+func (s *Server) dequeue(j *job) {
+	s.queue = slices.DeleteFunc(s.queue, func(queued *job) bool { return queued == j })
+	finishedAt := time.Now()
+	j.Status = StatusCanceled
+	j.FinishedAt = &finishedAt
+	j.bench, j.opts = nil, nil
+	close(j.done)
+	s.logger.Info("job canceled while queued", "job", j.ID)
+}
+
+// snapshot copies a job for a response, with its queue position and estimated
+// start while it is queued. The caller holds s.mu.
+func (s *Server) snapshot(j *job) Job {
+	snapshot := j.Job
+	snapshot.Hosts = slices.Clone(j.Hosts)
+	snapshot.Runs = slices.Clone(j.Runs)
+	if j.Status != StatusQueued {
+		return snapshot
+	}
+	index := slices.Index(s.queue, j)
+	for _, ahead := range s.queue[:index] {
+		if sharesHost(ahead.Hosts, j.Hosts) {
+			snapshot.QueuePosition++
+		}
+	}
+	snapshot.QueuePosition++
+	if start, ok := s.estimateStarts(time.Now())[j]; ok {
+		snapshot.EstimatedStart = &start
+	}
+	return snapshot
+}
+
+// estimateStarts replays the queue with the mean durations of finished jobs of
+// the same benchmark. Jobs behind a job of unknown duration have no estimate.
+func (s *Server) estimateStarts(now time.Time) map[*job]time.Time {
+	slots := map[string][]time.Time{} // when each of a host's concurrency slots frees up
+	unknown := map[string]bool{}
+	// earliest returns the slot of host that frees up first.
+	earliest := func(host string) *time.Time {
+		if slots[host] == nil {
+			slots[host] = slices.Repeat([]time.Time{now}, s.concurrency)
+		}
+		index := 0
+		for i, free := range slots[host] {
+			if free.Before(slots[host][index]) {
+				index = i
+			}
+		}
+		return &slots[host][index]
+	}
+	occupy := func(hosts []string, until time.Time) {
+		for _, host := range hosts {
+			*earliest(host) = until
+		}
+	}
+
+	for _, j := range s.jobs {
+		if j.Status != StatusRunning {
+			continue
+		}
+		duration, ok := s.meanDuration(j.Benchmark)
+		if !ok {
+			for _, host := range j.Hosts {
+				unknown[host] = true
+			}
+			continue
+		}
+		occupy(j.Hosts, maxTime(j.StartedAt.Add(duration), now))
+	}
+
+	starts := map[*job]time.Time{}
+	floor := map[string]time.Time{} // queued jobs start in order per host
+	for _, j := range s.queue {
+		duration, ok := s.meanDuration(j.Benchmark)
+		if !ok || slices.ContainsFunc(j.Hosts, func(host string) bool { return unknown[host] }) {
+			for _, host := range j.Hosts {
+				unknown[host] = true
+			}
+			continue
+		}
+		start := now
+		for _, host := range j.Hosts {
+			start = maxTime(start, maxTime(*earliest(host), floor[host]))
+		}
+		occupy(j.Hosts, start.Add(duration))
+		for _, host := range j.Hosts {
+			floor[host] = start
+		}
+		starts[j] = start
+	}
+	return starts
+}
+
+func (s *Server) meanDuration(benchmark string) (time.Duration, bool) {
+	durations := s.durations[benchmark]
+	if len(durations) == 0 {
+		return 0, false
+	}
+	var total time.Duration
+	for _, duration := range durations {
+		total += duration
+	}
+	return total / time.Duration(len(durations)), true
+}
+
+func sharesHost(a, b []string) bool {
+	return slices.ContainsFunc(a, func(host string) bool { return slices.Contains(b, host) })
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,98 @@
+//go:build unit
+
+package server
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestTargetHosts(t *testing.T) {
+	cfg := &config.Config{
+		Hosts: map[string]config.Host{
+			"server": {IP: "10.0.0.1"},
+			"alias":  {IP: "10.0.0.1"},
+			"client": {IP: "10.0.0.2"},
+		},
+		Stages: []config.Stage{
+			{Name: "setup", Host: "server"},
+			{Name: "load", Hosts: []string{"alias", "client"}},
+			{Name: "report"},
+			{Name: "skipped", Host: "other", Skip: true},
+		},
+	}
+	if got := targetHosts(cfg, nil); !slices.Equal(got, []string{"10.0.0.1", "10.0.0.2", "local"}) {
+		t.Fatalf("targetHosts = %v", got)
+	}
+	if got := targetHosts(cfg, []string{"load", "report"}); !slices.Equal(got, []string{"10.0.0.1"}) {
+		t.Fatalf("targetHosts with skip = %v", got)
+	}
+}
+
+func TestEstimateStarts(t *testing.T) {
+	now := time.Now()
+	s := New("", 1, nil)
+	s.durations["bench"] = []time.Duration{8 * time.Second, 12 * time.Second}
+
+	startedAt := now.Add(-4 * time.Second)
+	running := &job{Job: Job{ID: "1", Benchmark: "bench", Status: StatusRunning, Hosts: []string{"a"}, StartedAt: &startedAt}}
+	first := &job{Job: Job{ID: "2", Benchmark: "bench", Status: StatusQueued, Hosts: []string{"a"}}}
+	other := &job{Job: Job{ID: "3", Benchmark: "bench", Status: StatusQueued, Hosts: []string{"b"}}}
+	both := &job{Job: Job{ID: "4", Benchmark: "bench", Status: StatusQueued, Hosts: []string{"a", "b"}}}
+	unknown := &job{Job: Job{ID: "5", Benchmark: "new", Status: StatusQueued, Hosts: []string{"b"}}}
+	behind := &job{Job: Job{ID: "6", Benchmark: "bench", Status: StatusQueued, Hosts: []string{"b"}}}
+	for _, j := range []*job{running, first, other, both, unknown, behind} {
+		s.jobs[j.ID] = j
+	}
+	s.queue = []*job{first, other, both, unknown, behind}
+
+	starts := s.estimateStarts(now)
+	want := map[*job]time.Duration{first: 6 * time.Second, other: 0, both: 16 * time.Second}
+	for j, offset := range want {
+		if !starts[j].Equal(now.Add(offset)) {
+			t.Fatalf("job %s starts at +%s, want +%s", j.ID, starts[j].Sub(now), offset)
+		}
+	}
+	if _, ok := starts[unknown]; ok {
+		t.Fatal("expected no estimate for a benchmark without finished jobs")
+	}
+	if _, ok := starts[behind]; ok {
+		t.Fatal("expected no estimate behind a job of unknown duration")
+	}
+	if position := s.snapshot(behind).QueuePosition; position != 4 {
+		t.Fatalf("queue position = %d, want 4", position)
+	}
+}
+
+func TestServerQueuesJobsOnSharedHosts(t *testing.T) {
+	ts := newTestServer(t, "")
+	blocker := submitJob(t, ts, "", Submission{Config: testConfig(t.TempDir(), "sleep 1")})
+	next := submitJob(t, ts, "", Submission{Config: testConfig(t.TempDir(), "true")})
+	last := submitJob(t, ts, "", Submission{Config: testConfig(t.TempDir(), "true")})
+
+	if blocker.Status != StatusRunning || blocker.StartedAt == nil {
+		t.Fatalf("expected first job to start, got %+v", blocker)
+	}
+	if next.Status != StatusQueued || next.QueuePosition != 1 || last.QueuePosition != 2 {
+		t.Fatalf("expected queued jobs at positions 1 and 2, got %+v and %+v", next, last)
+	}
+	if !slices.Equal(next.Hosts, []string{"local"}) {
+		t.Fatalf("hosts = %v", next.Hosts)
+	}
+
+	status, data := request(t, ts, http.MethodPost, "/api/v1/jobs/"+last.ID+"/cancel", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("cancel returned %d: %s", status, data)
+	}
+	if job := waitForJob(t, ts, last.ID); job.Status != StatusCanceled || job.StartedAt != nil {
+		t.Fatalf("expected queued job to be canceled without starting, got %+v", job)
+	}
+
+	if job := waitForJob(t, ts, next.ID); job.Status != StatusQueued {
+		t.Fatalf("expected second job to stay queued, got %+v", job)
+	}
+}
@@ -0,0 +1,519 @@
+// Package server exposes benchmark runs over an HTTP API, so other services can
+// submit configs, follow and cancel runs, and fetch their artifacts.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/pkg/bench"
+	"github.com/luccadibe/benchctl/pkg/run"
+)
+
+// maxSubmissionBytes bounds the size of a submitted job.
+const maxSubmissionBytes = 4 << 20
+
+// DefaultResultsDir is the directory the runs of submitted jobs are stored in
+// unless SetResultsDir chooses another.
+const DefaultResultsDir = "server-results"
+
+// Job states.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// Submission is the body of POST /api/v1/jobs.
+type Submission struct {
+	// Config is the benchmark YAML. Relative paths in it resolve against the
+	// working directory of the server, and its output_dir is replaced by a
+	// directory of the server's results directory.
+	Config string `json:"config"`
+	// Profiles are merged over Config in order, before Set is applied.
+	Profiles []string          `json:"profiles,omitempty"`
+	Set      []string          `json:"set,omitempty"`
+	Vars     map[string]string `json:"vars,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Skip     []string          `json:"skip,omitempty"`
+	Cases    []string          `json:"cases,omitempty"`
+	NoCache  bool              `json:"no_cache,omitempty"`
+	// SkipAnalysis only executes and collects; see benchctl run --skip-analysis.
+	SkipAnalysis bool   `json:"skip_analysis,omitempty"`
+	Timeout      string `json:"timeout,omitempty"`
+}
+
+// Job is one submitted benchmark, executed as one run or one run per matrix combination.
+type Job struct {
+	ID        string `json:"id"`
+	Benchmark string `json:"benchmark"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	// Hosts are the machines the job's stages run on; jobs sharing a host are queued.
+	Hosts []string `json:"hosts"`
+	// QueuePosition counts the queued jobs ahead of this one on its hosts, from 1.
+	QueuePosition int `json:"queue_position,omitempty"`
+	// EstimatedStart is derived from the durations of finished jobs of the same
+	// benchmarks and is omitted until each of them has finished once.
+	EstimatedStart *time.Time `json:"estimated_start,omitempty"`
+	SubmittedAt    time.Time  `json:"submitted_at"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	Runs           []JobRun   `json:"runs,omitempty"`
+}
+
+// JobRun is a completed run of a job.
+type JobRun struct {
+	RunID  string `json:"run_id"`
+	RunDir string `json:"run_dir"`
+	Status string `json:"status"`
+}
+
+// Artifact is a file in the run directory of a job.
+type Artifact struct {
+	Path string `json:"path"` // <run_id>/<file>
+	Size int64  `json:"size"`
+}
+
+type job struct {
+	Job
+	bench  *bench.Bench
+	opts   []run.Option
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Server runs submitted jobs and serves the HTTP API.
+type Server struct {
+	token       string
+	concurrency int
+	logger      *slog.Logger
+	ctx         context.Context
+	stop        context.CancelFunc
+	wg          sync.WaitGroup
+
+	mu        sync.Mutex
+	closed    bool
+	nextID    int
+	jobs      map[string]*job
+	order     []string
+	queue     []*job // queued jobs in submission order
+	durations map[string][]time.Duration
+	// results are the output directories /metrics reports on, and stores their
+	// stores, kept so that storeMetrics remembers the disk usage of their runs.
+	results      []string
+	stores       []run.ResultStore
+	storeMetrics *run.StoreMetrics
+	// resultsDir holds the output directories of submitted jobs, one per benchmark.
+	resultsDir string
+	// downloadRate limits downloads to bytes per second; zero means no limit.
+	downloadRate int64
+}
+
+// New returns a server that runs at most concurrency jobs at a time on each host.
+// Requests must carry "Authorization: Bearer <token>" unless token is empty.
+func New(token string, concurrency int, logger *slog.Logger) *Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &Server{
+		token:        token,
+		concurrency:  max(concurrency, 1),
+		logger:       logger,
+		ctx:          ctx,
+		stop:         stop,
+		jobs:         map[string]*job{},
+		durations:    map[string][]time.Duration{},
+		resultsDir:   DefaultResultsDir,
+		storeMetrics: run.NewStoreMetrics(),
+	}
+}
+
+// SetResultsDir stores the runs of submitted jobs below dir, in a directory
+// named after the benchmark, whatever output_dir their configs set, so clients
+// cannot make the server write elsewhere.
+func (s *Server) SetResultsDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resultsDir = dir
+}
+
+// jobOutputDir returns the output directory of the submitted jobs of benchmark.
+func (s *Server) jobOutputDir(benchmark string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '-'
+		}
+		return r
+	}, benchmark)
+	if name == "." || name == ".." {
+		name = "benchmark"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return filepath.Join(s.resultsDir, name)
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/jobs", s.submit)
+	mux.HandleFunc("GET /api/v1/jobs", s.list)
+	mux.HandleFunc("GET /api/v1/jobs/{id}", s.status)
+	mux.HandleFunc("POST /api/v1/jobs/{id}/cancel", s.cancelJob)
+	mux.HandleFunc("GET /api/v1/jobs/{id}/artifacts", s.artifacts)
+	mux.HandleFunc("GET /api/v1/jobs/{id}/artifacts/{path...}", s.artifact)
+	mux.HandleFunc("GET /api/v1/jobs/{id}/archive/{run_id}", s.archive)
+	mux.HandleFunc("GET /metrics", s.metrics)
+	return s.authenticate(mux)
+}
+
+// ListenAndServe serves the API on address until ctx is done, then cancels the
+// running jobs and waits for them to record their results. Without a token it
+// only listens on loopback addresses, since every submitted config runs commands
+// on this machine.
+func (s *Server) ListenAndServe(ctx context.Context, address string) error {
+	if s.token == "" && !isLoopback(address) {
+		return fmt.Errorf("refusing to listen on %s without a bearer token: set a token or listen on a loopback address", address)
+	}
+	httpServer := &http.Server{Addr: address, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.ListenAndServe()
+	}()
+	s.logger.Info("server listening", "address", address)
+
+	select {
+	case err := <-errCh:
+		s.Close()
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := httpServer.Shutdown(shutdownCtx)
+	s.Close()
+	return err
+}
+
+// Close cancels the queued and running jobs and waits for them to finish.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for len(s.queue) > 0 {
+		s.dequeue(s.queue[0])
+	}
+	s.mu.Unlock()
+	s.stop()
+	s.wg.Wait()
+}
+
+// isLoopback reports whether the host of address is localhost or a loopback IP.
+// An empty host listens on every interface.
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	var submission Submission
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxSubmissionBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&submission); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode submission: %w", err))
+		return
+	}
+	b, opts, err := prepare(submission)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// Render validates the config with the options applied, so a bad submission
+	// is rejected here instead of failing as a job.
+	if _, err := run.Render(b, opts...); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	b.Config().Benchmark.OutputDir = s.jobOutputDir(b.Config().Benchmark.Name)
+
+	hosts := targetHosts(b.Config(), submission.Skip)
+	snapshot, err := s.enqueue(b, opts, hosts)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// prepare loads the submitted config and converts the submission to run options.
+func prepare(submission Submission) (*bench.Bench, []run.Option, error) {
+	if strings.TrimSpace(submission.Config) == "" {
+		return nil, nil, errors.New("config is required")
+	}
+	data, err := config.ApplyProfiles([]byte(submission.Config), submission.Profiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err = config.ApplyOverrides(data, submission.Set)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := bench.FromYAMLWithVars(data, submission.Vars)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := []run.Option{run.WithEnvMap(submission.Env), run.WithMetadataMap(submission.Metadata)}
+	for _, stageName := range submission.Skip {
+		opts = append(opts, run.Skip(stageName))
+	}
+	for _, caseName := range submission.Cases {
+		opts = append(opts, run.OnlyCase(caseName))
+	}
+	if submission.NoCache {
+		opts = append(opts, run.NoCache())
+	}
+	if submission.SkipAnalysis {
+		opts = append(opts, run.SkipAnalysis())
+	}
+	if submission.Timeout != "" {
+		timeout, err := time.ParseDuration(submission.Timeout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		opts = append(opts, run.WithTimeout(timeout))
+	}
+	return b, opts, nil
+}
+
+// enqueue registers a job and starts it once its hosts are free.
+func (s *Server) enqueue(b *bench.Bench, opts []run.Option, hosts []string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Job{}, errors.New("server is shutting down")
+	}
+	s.nextID++
+	j := &job{
+		Job: Job{
+			ID:          strconv.Itoa(s.nextID),
+			Benchmark:   b.Config().Benchmark.Name,
+			Status:      StatusQueued,
+			Hosts:       hosts,
+			SubmittedAt: time.Now(),
+		},
+		bench: b,
+		opts:  opts,
+		done:  make(chan struct{}),
+	}
+	s.jobs[j.ID] = j
+	s.order = append(s.order, j.ID)
+	s.queue = append(s.queue, j)
+	s.logger.Info("job queued", "job", j.ID, "benchmark", j.Benchmark, "hosts", strings.Join(hosts, ","))
+	s.schedule()
+	return s.snapshot(j), nil
+}
+
+// start executes a job in the background. The caller holds s.mu.
+func (s *Server) start(j *job) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	startedAt := time.Now()
+	j.Status = StatusRunning
+	j.StartedAt = &startedAt
+	j.cancel = cancel
+	s.logger.Info("job started", "job", j.ID, "benchmark", j.Benchmark)
+	s.wg.Go(func() {
+		defer close(j.done)
+		defer cancel()
+		results, err := run.RunMatrix(ctx, j.bench, j.opts...)
+		s.finish(ctx, j, results, err)
+	})
+}
+
+func (s *Server) finish(ctx context.Context, j *job, results []*run.Result, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.schedule()
+	for _, result := range results {
+		status := ""
+		if result.Metadata != nil {
+			status = result.Metadata.Status
+		}
+		j.Runs = append(j.Runs, JobRun{RunID: result.RunID, RunDir: result.RunDir, Status: status})
+		s.watchResults(filepath.Dir(result.RunDir))
+	}
+	finishedAt := time.Now()
+	j.FinishedAt = &finishedAt
+	switch {
+	case err == nil:
+		j.Status = StatusSucceeded
+	case ctx.Err() != nil:
+		j.Status = StatusCanceled
+		j.Error = err.Error()
+	default:
+		j.Status = StatusFailed
+		j.Error = err.Error()
+	}
+	if j.Status != StatusCanceled {
+		s.durations[j.Benchmark] = append(s.durations[j.Benchmark], finishedAt.Sub(*j.StartedAt))
+	}
+	j.bench, j.opts = nil, nil
+	s.logger.Info("job finished", "job", j.ID, "status", j.Status)
+}
+
+// lookup returns a snapshot of the job with the id in the request path.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*job, Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown job %s", r.PathValue("id")))
+		return nil, Job{}, false
+	}
+	return j, s.snapshot(j), true
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := make([]Job, 0, len(s.order))
+	for _, id := range s.order {
+		jobs = append(jobs, s.snapshot(s.jobs[id]))
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	if _, snapshot, ok := s.lookup(w, r); ok {
+		writeJSON(w, http.StatusOK, snapshot)
+	}
+}
+
+// cancelJob removes a queued job from the queue, or cancels a running job and
+// waits until it has recorded its results.
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
+	j, snapshot, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	if snapshot.Status == StatusQueued {
+		s.mu.Lock()
+		if j.Status == StatusQueued {
+			s.dequeue(j)
+			s.schedule()
+		}
+		s.mu.Unlock()
+		_, snapshot, _ = s.lookup(w, r)
+	}
+	if snapshot.Status == StatusRunning {
+		j.cancel()
+		select {
+		case <-j.done:
+		case <-r.Context().Done():
+			return
+		}
+		_, snapshot, _ = s.lookup(w, r)
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+func (s *Server) artifacts(w http.ResponseWriter, r *http.Request) {
+	_, snapshot, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	artifacts := []Artifact{}
+	for _, jobRun := range snapshot.Runs {
+		stored, err := jobRun.store().ListArtifacts(r.Context(), jobRun.RunID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, artifact := range stored {
+			artifacts = append(artifacts, Artifact{Path: path.Join(jobRun.RunID, artifact.Name), Size: artifact.Size})
+		}
+	}
+	writeJSON(w, http.StatusOK, artifacts)
+}
+
+// artifact serves one file of a job run, addressed as <run_id>/<file>, with range
+// requests so interrupted downloads can resume.
+func (s *Server) artifact(w http.ResponseWriter, r *http.Request) {
+	_, snapshot, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	runID, name, _ := strings.Cut(r.PathValue("path"), "/")
+	index := slices.IndexFunc(snapshot.Runs, func(jobRun JobRun) bool { return jobRun.RunID == runID })
+	if index < 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown artifact %s", r.PathValue("path")))
+		return
+	}
+	file, err := snapshot.Runs[index].store().OpenArtifact(r.Context(), runID, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown artifact %s", r.PathValue("path")))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+	attachment(w, path.Base(name))
+	http.ServeContent(s.downloadWriter(w, r), r, name, modTime(file), file)
+}
+
+// store returns the result store holding the run.
+func (jobRun JobRun) store() run.ResultStore {
+	return run.NewLocalStore(filepath.Dir(jobRun.RunDir))
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value) // the client went away; nothing left to report to
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,284 @@
+//go:build unit
+
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfig(outputDir, command string) string {
+	return fmt.Sprintf(`benchmark:
+  name: api
+  output_dir: %s
+  shell: sh -c
+vars:
+  greeting: hello
+stages:
+  - name: run
+    command: %s
+`, outputDir, command)
+}
+
+func newTestServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	s := New(token, 1, nil)
+	s.SetResultsDir(t.TempDir())
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return ts
+}
+
+func request(t *testing.T, ts *httptest.Server, method, path, token string, body any) (int, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	return resp.StatusCode, data
+}
+
+func submitJob(t *testing.T, ts *httptest.Server, token string, submission Submission) Job {
+	t.Helper()
+	status, data := request(t, ts, http.MethodPost, "/api/v1/jobs", token, submission)
+	if status != http.StatusAccepted {
+		t.Fatalf("submit returned %d: %s", status, data)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	return job
+}
+
+func waitForJob(t *testing.T, ts *httptest.Server, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		_, data := request(t, ts, http.MethodGet, "/api/v1/jobs/"+id, "", nil)
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			t.Fatalf("decode job: %v", err)
+		}
+		if job.Status != StatusRunning {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestServerRunsSubmittedJob(t *testing.T) {
+	ts := newTestServer(t, "")
+	job := submitJob(t, ts, "", Submission{
+		Config: testConfig(t.TempDir(), `echo "${greeting} $TARGET" > "$BENCHCTL_RUN_DIR/out.txt"`),
+		Vars:   map[string]string{"greeting": "hi"},
+		Env:    map[string]string{"TARGET": "api"},
+	})
+	if job.Status != StatusRunning || job.Benchmark != "api" {
+		t.Fatalf("unexpected submitted job: %+v", job)
+	}
+
+	job = waitForJob(t, ts, job.ID)
+	if job.Status != StatusSucceeded || len(job.Runs) != 1 || job.Runs[0].Status != "success" {
+		t.Fatalf("unexpected finished job: %+v", job)
+	}
+
+	_, data := request(t, ts, http.MethodGet, "/api/v1/jobs/"+job.ID+"/artifacts", "", nil)
+	if !strings.Contains(string(data), `"path":"1/out.txt"`) || !strings.Contains(string(data), `"path":"1/metadata.json"`) {
+		t.Fatalf("artifacts missing files: %s", data)
+	}
+	status, data := request(t, ts, http.MethodGet, "/api/v1/jobs/"+job.ID+"/artifacts/1/out.txt", "", nil)
+	if status != http.StatusOK || strings.TrimSpace(string(data)) != "hi api" {
+		t.Fatalf("artifact returned %d %q", status, data)
+	}
+	for _, path := range []string{"2/out.txt", "1/missing.txt", "1"} {
+		if status, _ := request(t, ts, http.MethodGet, "/api/v1/jobs/"+job.ID+"/artifacts/"+path, "", nil); status != http.StatusNotFound {
+			t.Fatalf("artifact %s returned %d, want 404", path, status)
+		}
+	}
+
+	status, data = request(t, ts, http.MethodGet, "/metrics", "", nil)
+	if status != http.StatusOK || !strings.Contains(string(data), `benchctl_server_jobs{status="succeeded"} 1`) ||
+		!strings.Contains(string(data), `benchctl_stored_runs{benchmark="api",status="success"} 1`) {
+		t.Fatalf("metrics returned %d:\n%s", status, data)
+	}
+
+	_, data = request(t, ts, http.MethodGet, "/api/v1/jobs", "", nil)
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil || len(jobs) != 1 {
+		t.Fatalf("list returned %s (%v)", data, err)
+	}
+}
+
+func TestServerCancelsJob(t *testing.T) {
+	ts := newTestServer(t, "")
+	job := submitJob(t, ts, "", Submission{Config: testConfig(t.TempDir(), "sleep 30")})
+
+	status, data := request(t, ts, http.MethodPost, "/api/v1/jobs/"+job.ID+"/cancel", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("cancel returned %d: %s", status, data)
+	}
+	if err := json.Unmarshal(data, &job); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	if job.Status != StatusCanceled || job.FinishedAt == nil {
+		t.Fatalf("expected canceled job, got %+v", job)
+	}
+}
+
+func TestServerRejectsRequests(t *testing.T) {
+	ts := newTestServer(t, "secret")
+
+	if status, _ := request(t, ts, http.MethodGet, "/api/v1/jobs", "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("missing token returned %d", status)
+	}
+	if status, _ := request(t, ts, http.MethodGet, "/api/v1/jobs", "wrong", nil); status != http.StatusUnauthorized {
+		t.Fatalf("wrong token returned %d", status)
+	}
+
+	tests := []struct {
+		name       string
+		submission any
+		contain    string
+	}{
+		{name: "missing config", submission: Submission{}, contain: "config is required"},
+		{name: "invalid config", submission: Submission{Config: "benchmark:\n  name: x\nstages: []\n"}, contain: "output_dir must be set"},
+		{name: "unknown stage", submission: Submission{Config: testConfig(t.TempDir(), "true"), Skip: []string{"missing"}}, contain: "unknown stage"},
+		{name: "unknown field", submission: map[string]string{"yaml": "x"}, contain: "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, data := request(t, ts, http.MethodPost, "/api/v1/jobs", "secret", tt.submission)
+			if status != http.StatusBadRequest || !strings.Contains(string(data), tt.contain) {
+				t.Fatalf("expected 400 containing %q, got %d: %s", tt.contain, status, data)
+			}
+		})
+	}
+
+	if status, _ := request(t, ts, http.MethodGet, "/api/v1/jobs/42", "secret", nil); status != http.StatusNotFound {
+		t.Fatalf("unknown job returned %d", status)
+	}
+}
+
+func TestServerDownloads(t *testing.T) {
+	s := New("", 1, nil)
+	s.SetResultsDir(t.TempDir())
+	s.SetDownloadRate(1 << 20)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	job := waitForJob(t, ts, submitJob(t, ts, "", Submission{
+		Config: testConfig(t.TempDir(), `printf 0123456789 > "$BENCHCTL_RUN_DIR/data.bin"`),
+	}).ID)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/jobs/"+job.ID+"/artifacts/1/data.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=4-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("range request: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(data) != "456789" {
+		t.Fatalf("range request returned %d %q", resp.StatusCode, data)
+	}
+	if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename=data.bin` {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+	if resp.Header.Get("Last-Modified") == "" {
+		t.Fatalf("expected Last-Modified for resumable downloads")
+	}
+
+	status, data := request(t, ts, http.MethodGet, "/api/v1/jobs/"+job.ID+"/archive/1", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("archive returned %d: %s", status, data)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	if got := strings.Join(names, ","); !strings.Contains(got, "1/data.bin") || !strings.Contains(got, "1/metadata.json") {
+		t.Fatalf("archive files = %s", got)
+	}
+	if status, _ := request(t, ts, http.MethodGet, "/api/v1/jobs/"+job.ID+"/archive/2", "", nil); status != http.StatusNotFound {
+		t.Fatalf("unknown run archive returned %d", status)
+	}
+}
+
+func TestServerConfinesJobsToResultsDir(t *testing.T) {
+	resultsDir := t.TempDir()
+	s := New("", 1, nil)
+	s.SetResultsDir(resultsDir)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	elsewhere := t.TempDir()
+	job := waitForJob(t, ts, submitJob(t, ts, "", Submission{Config: testConfig(elsewhere, "true")}).ID)
+	if len(job.Runs) != 1 || job.Runs[0].RunDir != filepath.Join(resultsDir, "api", "1") {
+		t.Fatalf("expected the run below %s, got %+v", resultsDir, job.Runs)
+	}
+	if entries, _ := os.ReadDir(elsewhere); len(entries) != 0 {
+		t.Fatalf("expected nothing in the submitted output_dir, found %d entries", len(entries))
+	}
+}
+
+func TestServerRequiresTokenOffLoopback(t *testing.T) {
+	s := New("", 1, nil)
+	defer s.Close()
+	err := s.ListenAndServe(context.Background(), "0.0.0.0:0")
+	if err == nil || !strings.Contains(err.Error(), "without a bearer token") {
+		t.Fatalf("ListenAndServe() = %v, want a refusal without token", err)
+	}
+	for address, want := range map[string]bool{"127.0.0.1:8080": true, "localhost:80": true, "[::1]:8080": true, ":8080": false, "10.0.0.2:8080": false} {
+		if got := isLoopback(address); got != want {
+			t.Fatalf("isLoopback(%q) = %v, want %v", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// sessionRunner returns a replacement for the RunCommand of client that drives
+// the command of a stage with session set: it waits for the prompt, sends each
+// step and waits for its reply and the next prompt, then closes the stdin of the
+// command and waits for it to exit. The result holds the complete output of the
+// session, so metrics_from_output applies to it as to any stage output. A step
+// that fails stops the command.
+func sessionRunner(client execution.ExecutionClient, session *config.Session, logger *slog.Logger) func(context.Context, execution.CommandRequest) (execution.CommandResult, error) {
+	return func(ctx context.Context, req execution.CommandRequest) (execution.CommandResult, error) {
+		timeout, _ := time.ParseDuration(session.Timeout)
+		startTimeout, _ := time.ParseDuration(session.StartTimeout)
+		var prompt *regexp.Regexp
+		if session.Prompt != "" {
+			prompt = regexp.MustCompile(session.Prompt)
+		}
+		s, err := execution.StartSession(ctx, client, req)
+		if err != nil {
+			return execution.CommandResult{ExitCode: -1}, err
+		}
+		// The first wait, for the prompt or else the first reply, is bounded by
+		// startTimeout, and every later one by timeout.
+		waitTimeout := startTimeout
+		expect := func(pattern *regexp.Regexp) error {
+			expectCtx, cancel := context.WithTimeout(ctx, waitTimeout)
+			waitTimeout = timeout
+			defer cancel()
+			_, err := s.Expect(expectCtx, pattern)
+			return err
+		}
+		fail := func(err error) (execution.CommandResult, error) {
+			result, _ := s.Stop()
+			return result, err
+		}
+
+		if prompt != nil {
+			if err := expect(prompt); err != nil {
+				return fail(fmt.Errorf("session: %w", err))
+			}
+		}
+		for j, step := range session.Steps {
+			logger.Debug("session step", "step", j, "send", step.Send)
+			if err := s.Send(step.Send); err != nil {
+				return fail(fmt.Errorf("session.steps[%d]: %w", j, err))
+			}
+			if step.Expect != "" {
+				if err := expect(regexp.MustCompile(step.Expect)); err != nil {
+					return fail(fmt.Errorf("session.steps[%d]: %w", j, err))
+				}
+			}
+			if prompt != nil {
+				if err := expect(prompt); err != nil {
+					return fail(fmt.Errorf("session.steps[%d]: %w", j, err))
+				}
+			}
+		}
+		if err := s.CloseInput(); err != nil {
+			return fail(fmt.Errorf("session: close input: %w", err))
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		result, err := s.Wait(waitCtx)
+		if waitCtx.Err() != nil && ctx.Err() == nil {
+			return result, fmt.Errorf("session: command did not exit within %s after its stdin closed", timeout)
+		}
+		return result, err
+	}
+}
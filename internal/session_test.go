@@ -0,0 +1,71 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// counterConsole is an interactive console answering INCR with the new value of a
+// counter and COUNT with its value.
+const counterConsole = `n=0; printf 'console> '; while read -r cmd; do case "$cmd" in INCR) n=$((n+1)); echo "(integer) $n";; COUNT) echo "count: $n";; *) echo "ERR unknown command $cmd";; esac; printf 'console> '; done`
+
+func TestSessionStageDrivesInteractiveCommand(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "session", OutputDir: t.TempDir()},
+		Stages: []config.Stage{{
+			Name:    "console",
+			Command: counterConsole,
+			Session: &config.Session{
+				Prompt:       `console> `,
+				Timeout:      "30s",
+				StartTimeout: "30s",
+				Steps: []config.SessionStep{
+					{Send: "INCR", Expect: `\(integer\) 1`},
+					{Send: "INCR", Expect: `\(integer\) 2`},
+					{Send: "COUNT"},
+				},
+			},
+			MetricsFromOutput: []config.OutputMetric{{Name: "count", Pattern: `count: (\d+)`}},
+		}},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if result.Metadata.Custom["count"] != "2" {
+		t.Fatalf("expected count 2 from the session output, got metrics %v", result.Metadata.Custom)
+	}
+}
+
+func TestSessionStageFailsOnUnexpectedReply(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "session", OutputDir: t.TempDir()},
+		Stages: []config.Stage{{
+			Name:    "console",
+			Command: counterConsole,
+			Session: &config.Session{
+				Prompt:       `console> `,
+				Timeout:      "3s",
+				StartTimeout: "30s",
+				Steps: []config.SessionStep{
+					{Send: "INCR", Expect: `\(integer\) 1`},
+					{Send: "DECR", Expect: `\(integer\) 0`},
+				},
+			},
+		}},
+	}
+	started := time.Now()
+	_, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "session.steps[1]") {
+		t.Fatalf("expected session.steps[1] to fail, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("expected the session to stop after its timeout, the run took %s", elapsed)
+	}
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/luccadibe/benchctl/internal/config"
@@ -15,7 +16,12 @@ const (
 	EnvConfigPath = "BENCHCTL_CONFIG_PATH"
 	EnvBenchctl   = "BENCHCTL_BIN"
 	EnvCaseName   = "BENCHCTL_CASE_NAME"
+	EnvIteration  = "BENCHCTL_ITERATION" // number of the case in the order the run executes them
+	EnvTrial      = "BENCHCTL_TRIAL"     // number of the trial with benchmark.trials
+	EnvWarmup     = "BENCHCTL_WARMUP"    // "true" in the benchmark.warmup_trials
 	EnvHost       = "BENCHCTL_HOST"
+	EnvGOOS       = "BENCHCTL_GOOS"   // target OS of a per_platform build
+	EnvGOARCH     = "BENCHCTL_GOARCH" // target architecture of a per_platform build
 	DefaultShell  = "bash -lic"
 )
 
@@ -48,22 +54,45 @@ func buildStageEnv(
 	for key, value := range benchmarkCase.Env {
 		env[key] = value
 	}
+	if iteration := caseIteration(cfg, benchmarkCase); iteration > 0 {
+		env[EnvIteration] = strconv.Itoa(iteration)
+	}
 	if alias := strings.TrimSpace(hostAlias); alias != "" {
 		env[EnvHost] = alias
 	}
 	return env
 }
 
+// caseIteration returns the number of benchmarkCase among the cases of cfg, which
+// are in execution order, starting at 1, or 0 for the steps outside any case. A
+// config without cases runs a single iteration.
+func caseIteration(cfg *config.Config, benchmarkCase config.Case) int {
+	if len(cfg.Cases) == 0 {
+		return 1
+	}
+	for i, c := range cfg.Cases {
+		if c.Name == benchmarkCase.Name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
 func envPrefixFromMap(env map[string]string) string {
+	return "export " + strings.Join(envAssignments(env), " ") + "; "
+}
+
+// envAssignments returns the variables of env as quoted KEY='value' words, sorted by key.
+func envAssignments(env map[string]string) []string {
 	keys := make([]string, 0, len(env))
 	for key := range env {
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
 
-	exports := make([]string, 0, len(keys))
+	assignments := make([]string, 0, len(keys))
 	for _, key := range keys {
-		exports = append(exports, key+"="+shellQuote(env[key]))
+		assignments = append(assignments, key+"="+shellQuote(env[key]))
 	}
-	return "export " + strings.Join(exports, " ") + "; "
+	return assignments
 }
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// uploadStageFiles uploads the files of stage to its host before the command runs,
+// creating the remote directories. Remote paths expand like output paths.
+func uploadStageFiles(ctx context.Context, client execution.ExecutionClient, host config.Host, stage config.Stage, env map[string]string, logger *slog.Logger) error {
+	for _, file := range stage.Files {
+		remotePath, err := expandTemplate(file.RemotePath, env)
+		if err != nil {
+			return fmt.Errorf("file %s for stage %s: remote_path: %w", file.LocalPath, stage.Name, err)
+		}
+		if _, err := os.Stat(file.LocalPath); err != nil {
+			return fmt.Errorf("file %s for stage %s: %w", file.LocalPath, stage.Name, err)
+		}
+		if dir := path.Dir(remotePath); dir != "." && dir != "/" {
+			result, err := client.RunCommand(ctx, execution.CommandRequest{Command: mkdirCommand(host, dir)})
+			if err == nil && result.ExitCode != 0 {
+				err = fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+			}
+			if err != nil {
+				return fmt.Errorf("file %s for stage %s: create %s: %w", file.LocalPath, stage.Name, dir, err)
+			}
+		}
+		err = retryTransfer(ctx, logger, "file "+file.LocalPath, func(ctx context.Context) error {
+			return client.Upload(ctx, file.LocalPath, remotePath)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upload file %s for stage %s: %w", file.LocalPath, stage.Name, err)
+		}
+		logger.Info("file uploaded", "stage", stage.Name, "local_path", file.LocalPath, "remote_path", remotePath)
+	}
+	return nil
+}
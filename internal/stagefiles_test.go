@@ -0,0 +1,52 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestStageFilesAreUploadedBeforeTheCommand(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "workload.conf")
+	if err := os.WriteFile(localPath, []byte("threads: 8\n"), 0644); err != nil {
+		t.Fatalf("write local file: %v", err)
+	}
+	remoteDir := t.TempDir()
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "files", OutputDir: t.TempDir()},
+		Stages: []config.Stage{{
+			Name:              "load",
+			Command:           "cat " + remoteDir + "/run-$BENCHCTL_RUN_ID/workload.conf",
+			Files:             []config.StageFile{{LocalPath: localPath, RemotePath: remoteDir + "/run-${BENCHCTL_RUN_ID}/workload.conf"}},
+			MetricsFromOutput: []config.OutputMetric{{Name: "threads", Pattern: `threads:\s+(\d+)`}},
+		}},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if result.Metadata.Custom["threads"] != "8" {
+		t.Fatalf("expected the command to read the uploaded file, got metrics %v", result.Metadata.Custom)
+	}
+}
+
+func TestStageFilesFailOnMissingLocalFile(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "files", OutputDir: t.TempDir()},
+		Stages: []config.Stage{{
+			Name:    "load",
+			Command: "true",
+			Files:   []config.StageFile{{LocalPath: filepath.Join(t.TempDir(), "missing.conf"), RemotePath: filepath.Join(t.TempDir(), "missing.conf")}},
+		}},
+	}
+	_, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "missing.conf for stage load") {
+		t.Fatalf("expected a missing file error, got %v", err)
+	}
+}
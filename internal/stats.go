@@ -0,0 +1,106 @@
+package internal
+
+import "math"
+
+// Sample summarizes repeated observations of one metric.
+type Sample struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"` // sample standard deviation, 0 for fewer than two values
+}
+
+func summarize(values []float64) Sample {
+	sample := Sample{N: len(values)}
+	if sample.N == 0 {
+		return sample
+	}
+	for _, value := range values {
+		sample.Mean += value
+	}
+	sample.Mean /= float64(sample.N)
+	if sample.N < 2 {
+		return sample
+	}
+	var squares float64
+	for _, value := range values {
+		squares += (value - sample.Mean) * (value - sample.Mean)
+	}
+	sample.StdDev = math.Sqrt(squares / float64(sample.N-1))
+	return sample
+}
+
+// welchTTest returns the two-sided p-value of Welch's unequal-variance t-test.
+// ok is false when either sample has fewer than two values.
+func welchTTest(a, b Sample) (p float64, ok bool) {
+	if a.N < 2 || b.N < 2 {
+		return 0, false
+	}
+	varA := a.StdDev * a.StdDev / float64(a.N)
+	varB := b.StdDev * b.StdDev / float64(b.N)
+	if varA+varB == 0 {
+		if a.Mean == b.Mean {
+			return 1, true
+		}
+		return 0, true
+	}
+	t := (a.Mean - b.Mean) / math.Sqrt(varA+varB)
+	df := (varA + varB) * (varA + varB) /
+		(varA*varA/float64(a.N-1) + varB*varB/float64(b.N-1))
+	return regularizedIncompleteBeta(df/2, 0.5, df/(df+t*t)), true
+}
+
+// regularizedIncompleteBeta evaluates I_x(a, b) with the continued fraction from
+// Numerical Recipes (betacf), which converges quickly for the t-distribution.
+func regularizedIncompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lgA, _ := math.Lgamma(a)
+	lgB, _ := math.Lgamma(b)
+	lgAB, _ := math.Lgamma(a + b)
+	front := math.Exp(lgAB - lgA - lgB + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	result := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		for _, numerator := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + numerator*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + numerator/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			result *= d * c
+		}
+		if math.Abs(d*c-1) < epsilon {
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metadataFile is the artifact holding the metadata of a run.
+const metadataFile = "metadata.json"
+
+// ResultStore reads and writes the metadata and artifacts of runs.
+//
+// Runs execute in a directory below benchmark.output_dir. Everything that reads or
+// updates runs afterwards (inspect, annotate, notes, compare, diff-output, and the
+// server) goes through a ResultStore, so backends such as object storage or a
+// database can serve runs without the local directory layout.
+type ResultStore interface {
+	// ListRuns returns the IDs of the stored runs, oldest first.
+	ListRuns(ctx context.Context) ([]string, error)
+	// LoadMetadata returns the metadata of a run. The error wraps fs.ErrNotExist
+	// when the run does not exist.
+	LoadMetadata(ctx context.Context, runID string) (*RunMetadata, error)
+	// SaveMetadata replaces the metadata of a run.
+	SaveMetadata(ctx context.Context, runID string, metadata *RunMetadata) error
+	// ListArtifacts returns the files of a run sorted by name, metadata.json included.
+	ListArtifacts(ctx context.Context, runID string) ([]Artifact, error)
+	// OpenArtifact opens a file of a run by its slash-separated name. The error
+	// wraps fs.ErrNotExist when the file does not exist.
+	OpenArtifact(ctx context.Context, runID, name string) (io.ReadSeekCloser, error)
+	// WriteArtifact creates or replaces a file of a run.
+	WriteArtifact(ctx context.Context, runID, name string, content io.Reader) error
+	// AppendArtifact appends content to a file of a run, creating it when it is
+	// missing. Concurrent appends must all be kept, each in one piece.
+	AppendArtifact(ctx context.Context, runID, name string, content io.Reader) error
+}
+
+// Artifact describes a stored file of a run.
+type Artifact struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// LocalStore keeps runs in numbered directories below an output directory.
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore returns the store of the runs below dir, the benchmark.output_dir.
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+// localRun returns the store and run ID of the run directory runPath.
+func localRun(runPath string) (*LocalStore, string) {
+	runPath = filepath.Clean(runPath)
+	return NewLocalStore(filepath.Dir(runPath)), filepath.Base(runPath)
+}
+
+// RunDir returns the directory of a run.
+func (s *LocalStore) RunDir(runID string) string {
+	return filepath.Join(s.dir, runID)
+}
+
+func (s *LocalStore) ListRuns(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list runs: %w", err)
+	}
+	var runIDs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(s.dir, entry.Name(), metadataFile)); err == nil {
+			runIDs = append(runIDs, entry.Name())
+		}
+	}
+	slices.SortFunc(runIDs, compareRunIDs)
+	return runIDs, nil
+}
+
+// compareRunIDs orders numeric run IDs by value and others after them by name.
+func compareRunIDs(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return na - nb
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func (s *LocalStore) LoadMetadata(ctx context.Context, runID string) (*RunMetadata, error) {
+	file, err := s.OpenArtifact(ctx, runID, metadataFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading run metadatafile: %w", err)
+	}
+	defer file.Close()
+	var runmd RunMetadata
+	if err := json.NewDecoder(file).Decode(&runmd); err != nil {
+		return nil, fmt.Errorf("error unmarshalling run metadata: %w", err)
+	}
+	return &runmd, nil
+}
+
+func (s *LocalStore) SaveMetadata(ctx context.Context, runID string, metadata *RunMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal metadata: %w", err)
+	}
+	return s.WriteArtifact(ctx, runID, metadataFile, bytes.NewReader(data))
+}
+
+func (s *LocalStore) ListArtifacts(ctx context.Context, runID string) ([]Artifact, error) {
+	root, err := s.openRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	var artifacts []Artifact
+	err = fs.WalkDir(root.FS(), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, Artifact{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list run %s: %w", runID, err)
+	}
+	return artifacts, nil
+}
+
+func (s *LocalStore) OpenArtifact(ctx context.Context, runID, name string) (io.ReadSeekCloser, error) {
+	if !validArtifactName(name) {
+		return nil, fmt.Errorf("artifact %q: %w", name, fs.ErrNotExist)
+	}
+	root, err := s.openRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	// files opened from the root stay usable after it is closed, and the root keeps
+	// symlinks in the run directory from reaching files outside of it.
+	file, err := root.Open(filepath.FromSlash(name))
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		_ = file.Close()
+		return nil, fmt.Errorf("artifact %q: %w", name, fs.ErrNotExist)
+	}
+	return file, nil
+}
+
+// WriteArtifact writes to a temporary file first, so readers never see a partial file.
+func (s *LocalStore) WriteArtifact(ctx context.Context, runID, name string, content io.Reader) error {
+	if !validArtifactName(name) {
+		return fmt.Errorf("invalid artifact name %q", name)
+	}
+	root, err := s.openRun(runID)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	name = filepath.FromSlash(name)
+	if dir := filepath.Dir(name); dir != "." {
+		if err := root.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := name + ".tmp"
+	file, err := root.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		_ = file.Close()
+		_ = root.Remove(tmp)
+		return err
+	}
+	// Synced before the rename, so that a power loss leaves the old or the new file.
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		_ = root.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = root.Remove(tmp)
+		return err
+	}
+	return root.Rename(tmp, name)
+}
+
+// AppendArtifact writes content with a single write to a file opened with
+// O_APPEND, so that concurrent appends neither overwrite nor interleave.
+func (s *LocalStore) AppendArtifact(ctx context.Context, runID, name string, content io.Reader) error {
+	if !validArtifactName(name) {
+		return fmt.Errorf("invalid artifact name %q", name)
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	root, err := s.openRun(runID)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	name = filepath.FromSlash(name)
+	if dir := filepath.Dir(name); dir != "." {
+		if err := root.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	file, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *LocalStore) openRun(runID string) (*os.Root, error) {
+	if runID == "" || runID == "." || runID == ".." || strings.ContainsAny(runID, `/\`) {
+		return nil, fmt.Errorf("run %q: %w", runID, fs.ErrNotExist)
+	}
+	root, err := os.OpenRoot(s.RunDir(runID))
+	if err != nil {
+		return nil, fmt.Errorf("run %s: %w", runID, err)
+	}
+	return root, nil
+}
+
+func validArtifactName(name string) bool {
+	return name != "." && fs.ValidPath(name) && path.Clean(name) == name
+}
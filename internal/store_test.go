@@ -0,0 +1,88 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewLocalStore(dir)
+	for _, runID := range []string{"10", "2", "1", "incomplete"} {
+		if err := os.MkdirAll(store.RunDir(runID), 0755); err != nil {
+			t.Fatalf("create run dir: %v", err)
+		}
+		if runID != "incomplete" {
+			if err := store.SaveMetadata(ctx, runID, &RunMetadata{RunID: runID, Status: "success"}); err != nil {
+				t.Fatalf("save metadata: %v", err)
+			}
+		}
+	}
+
+	runIDs, err := store.ListRuns(ctx)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if !slices.Equal(runIDs, []string{"1", "2", "10"}) {
+		t.Fatalf("runs = %v", runIDs)
+	}
+	metadata, err := store.LoadMetadata(ctx, "10")
+	if err != nil || metadata.RunID != "10" {
+		t.Fatalf("load metadata = %+v, %v", metadata, err)
+	}
+
+	if err := store.WriteArtifact(ctx, "1", "plots/latency.csv", strings.NewReader("ms\n1\n")); err != nil {
+		t.Fatalf("write artifact: %v", err)
+	}
+	file, err := store.OpenArtifact(ctx, "1", "plots/latency.csv")
+	if err != nil {
+		t.Fatalf("open artifact: %v", err)
+	}
+	data, _ := io.ReadAll(file)
+	_ = file.Close()
+	if string(data) != "ms\n1\n" {
+		t.Fatalf("artifact = %q", data)
+	}
+	artifacts, err := store.ListArtifacts(ctx, "1")
+	if err != nil {
+		t.Fatalf("list artifacts: %v", err)
+	}
+	var names []string
+	for _, artifact := range artifacts {
+		names = append(names, artifact.Name)
+	}
+	if !slices.Equal(names, []string{"metadata.json", "plots/latency.csv"}) {
+		t.Fatalf("artifacts = %v", names)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("outside"), 0644); err != nil {
+		t.Fatalf("write outside file: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(store.RunDir("1"), "link.txt")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	for _, tt := range []struct{ runID, name string }{
+		{"1", "missing.csv"},
+		{"1", "../secret.txt"},
+		{"1", "plots"},
+		{"3", "metadata.json"},
+		{"..", "secret.txt"},
+	} {
+		if _, err := store.OpenArtifact(ctx, tt.runID, tt.name); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("open %s/%s: expected not exist error, got %v", tt.runID, tt.name, err)
+		}
+	}
+	if _, err := store.OpenArtifact(ctx, "1", "link.txt"); err == nil {
+		t.Fatal("expected symlink leaving the run directory to be rejected")
+	}
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// throttledWriter passes at most limit lines per second to out and counts the rest.
+// It keeps the console of a stage that prints thousands of lines per second usable;
+// the complete output is still captured for the run log.
+type throttledWriter struct {
+	mu          sync.Mutex
+	out         io.Writer
+	limit       int
+	now         func() time.Time
+	window      time.Time
+	lines       int  // lines started in the current window
+	suppressed  int  // lines dropped since the last notice
+	lineStart   bool // the next byte starts a new line
+	droppingRow bool // the current line is being dropped
+}
+
+// throttleConsole wraps the console sinks of a stage with stages[].console set.
+// Without a console there is nothing to throttle and the returned writer is nil.
+func throttleConsole(stage config.Stage, stdout, stderr io.Writer) (io.Writer, io.Writer, *throttledWriter) {
+	if stage.Console == nil || stdout == nil {
+		return stdout, stderr, nil
+	}
+	throttle := newThrottledWriter(stdout, stage.Console.MaxLinesPerSecond)
+	return throttle, throttle, throttle
+}
+
+func newThrottledWriter(out io.Writer, limit int) *throttledWriter {
+	return &throttledWriter{out: out, limit: limit, now: time.Now, lineStart: true}
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for rest := p; len(rest) > 0; {
+		segment := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			segment = rest[:i+1]
+		}
+		rest = rest[len(segment):]
+
+		if w.lineStart {
+			if err := w.startLine(); err != nil {
+				return 0, err
+			}
+		}
+		if !w.droppingRow {
+			if _, err := w.out.Write(segment); err != nil {
+				return 0, err
+			}
+		}
+		w.lineStart = segment[len(segment)-1] == '\n'
+	}
+	return len(p), nil
+}
+
+// startLine decides whether the line about to be written is shown.
+func (w *throttledWriter) startLine() error {
+	if now := w.now(); now.Sub(w.window) >= time.Second {
+		w.window = now
+		w.lines = 0
+		if err := w.notice(); err != nil {
+			return err
+		}
+	}
+	w.droppingRow = w.lines >= w.limit
+	if w.droppingRow {
+		w.suppressed++
+	} else {
+		w.lines++
+	}
+	return nil
+}
+
+func (w *throttledWriter) notice() error {
+	if w.suppressed == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w.out, "[benchctl] console throttled: %d line(s) suppressed, see the run log\n", w.suppressed)
+	w.suppressed = 0
+	return err
+}
+
+// Flush reports lines suppressed since the last notice. It is safe on a nil writer.
+func (w *throttledWriter) Flush() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.suppressed > 0 && !w.lineStart && !w.droppingRow {
+		_, _ = io.WriteString(w.out, "\n")
+	}
+	_ = w.notice()
+	w.lineStart = true
+}
@@ -0,0 +1,34 @@
+//go:build unit
+
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottledWriterLimitsLinesPerSecond(t *testing.T) {
+	var out strings.Builder
+	now := time.Unix(0, 0)
+	w := newThrottledWriter(&out, 2)
+	w.now = func() time.Time { return now }
+
+	// Writes split lines at arbitrary points, like a PTY does.
+	for _, chunk := range []string{"one\ntw", "o\nthree\nfo", "ur\n"} {
+		if n, err := w.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("write %q: n=%d err=%v", chunk, n, err)
+		}
+	}
+	now = now.Add(time.Second)
+	_, _ = w.Write([]byte("five\nsix\nseven\n"))
+	w.Flush()
+
+	want := "one\ntwo\n" +
+		"[benchctl] console throttled: 2 line(s) suppressed, see the run log\n" +
+		"five\nsix\n" +
+		"[benchctl] console throttled: 1 line(s) suppressed, see the run log\n"
+	if out.String() != want {
+		t.Fatalf("console output:\n%q\nwant:\n%q", out.String(), want)
+	}
+}
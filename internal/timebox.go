@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// timeBoxCommand runs the shell invocation of a stage with a duration for at most
+// that long. The command runs in its own process group, which gets a SIGTERM when
+// the duration elapses and a SIGKILL BackgroundTerminationGrace later, like a
+// background stage. Stopping it that way counts as success; exiting earlier keeps
+// the exit code of the command.
+//
+// Stdin is passed on through fd 3, since the shell reads the stdin of background
+// commands from /dev/null, and the marker file tells a stopped command from one
+// that exited by itself. Hosts without setsid, such as macOS, start the command
+// with job control enabled instead, which also gives it its own process group.
+// A shell that refuses job control without a terminal, such as dash, leaves the
+// command in the group of the shell, and then only the command itself is signalled.
+func timeBoxCommand(commandBody string, stage config.Stage, duration time.Duration) string {
+	kill := killCommand(stage)
+	script := fmt.Sprintf(`marker=$(mktemp) || exit 1
+exec 3<&0
+if command -v setsid >/dev/null 2>&1; then
+setsid %[1]s <&3 3<&- &
+else
+set -m 2>/dev/null
+%[1]s <&3 3<&- &
+set +m 2>/dev/null
+fi
+pid=$!
+exec 3<&-
+(
+trap 'kill $s 2>/dev/null; exit 0' TERM
+sleep %[2]s & s=$!; wait $s
+rm -f "$marker"
+%[4]s -TERM -$pid 2>/dev/null || %[4]s -TERM $pid 2>/dev/null
+sleep %[3]s & s=$!; wait $s
+%[4]s -KILL -$pid 2>/dev/null || %[4]s -KILL $pid 2>/dev/null
+) >/dev/null 2>&1 </dev/null &
+timer=$!
+wait $pid
+status=$?
+kill -TERM $timer 2>/dev/null
+if [ -e "$marker" ]; then rm -f "$marker"; exit $status; fi
+exit 0`, commandBody, seconds(duration), seconds(BackgroundTerminationGrace), kill)
+	return "sh -c " + shellQuote(script)
+}
+
+// seconds formats d as an argument of sleep.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
@@ -0,0 +1,103 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestTimeBoxedStageIsStoppedAfterItsDuration(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "timebox", OutputDir: t.TempDir()},
+		Stages: []config.Stage{
+			{
+				Name:              "load",
+				Command:           "echo 'Requests/sec: 1500'; sleep 30",
+				Duration:          "500ms",
+				MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}},
+			},
+			{
+				Name:     "stubborn",
+				Command:  "trap '' TERM; sleep 30",
+				Duration: "100ms",
+			},
+		},
+	}
+	started := time.Now()
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("expected the stages to be stopped, the run took %s", elapsed)
+	}
+	if result.Metadata.Status != "success" || result.Metadata.Custom["rps"] != "1500" {
+		t.Fatalf("metadata: status %s metrics %v", result.Metadata.Status, result.Metadata.Custom)
+	}
+}
+
+func TestTimeBoxedStageKeepsEarlyExitCode(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "timebox", OutputDir: t.TempDir()},
+		Stages:    []config.Stage{{Name: "load", Command: "exit 3", Duration: "30s"}},
+	}
+	started := time.Now()
+	_, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "exit code: 3") {
+		t.Fatalf("expected the exit code of the command, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("expected the run not to wait for the duration, it took %s", elapsed)
+	}
+}
+
+func TestTimeBoxStopsProcessGroupWithoutSetsid(t *testing.T) {
+	// A PATH without setsid whose sh is bash, as on macOS.
+	bin := t.TempDir()
+	for tool, name := range map[string]string{"sh": "bash", "mktemp": "mktemp", "rm": "rm", "sleep": "sleep"} {
+		target, err := exec.LookPath(name)
+		if err != nil {
+			t.Skipf("%s not found: %v", name, err)
+		}
+		if err := os.Symlink(target, filepath.Join(bin, tool)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	body := "sh -c " + shellQuote("sleep 30 & echo $! > "+shellQuote(pidFile)+"; wait")
+	cmd := exec.Command(filepath.Join(bin, "sh"), "-c", timeBoxCommand(body, config.Stage{}, 300*time.Millisecond))
+	cmd.Env = []string{"PATH=" + bin}
+	started := time.Now()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("time-boxed command failed: %v: %s", err, output)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("expected the command to be stopped, it took %s", elapsed)
+	}
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("read child pid: %v", err)
+	}
+	child, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	// A killed child may linger as a zombie until it is reaped.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(child) + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("child %d of the command survived the time box: %s", child, stat)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
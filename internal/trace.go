@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// traceFile is the command trace in the run directory of runs with WithCommandTrace.
+const traceFile = "trace.log"
+
+const traceTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+type commandTraceKey struct{}
+
+// WithCommandTrace returns a context whose runs write every command they execute
+// to trace.log in the run directory, exactly as sent to the host: after the
+// environment exports, templating, shell wrapping, and quoting. Each command is
+// preceded by a comment with its start time, host, duration, and exit code, so it
+// can be copied into a shell on that host to reproduce it.
+func WithCommandTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commandTraceKey{}, true)
+}
+
+// commandTracer writes the trace of a run.
+type commandTracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+type commandTracerKey struct{}
+
+// startCommandTrace opens the trace of the run in runDir when ctx asks for one,
+// and returns the context whose execution clients write to it and the func that
+// closes it.
+func startCommandTrace(ctx context.Context, runDir string) (context.Context, func(), error) {
+	if enabled, _ := ctx.Value(commandTraceKey{}).(bool); !enabled {
+		return ctx, func() {}, nil
+	}
+	file, err := os.Create(filepath.Join(runDir, traceFile))
+	if err != nil {
+		return ctx, nil, fmt.Errorf("create command trace: %w", err)
+	}
+	tracer := &commandTracer{w: file}
+	return context.WithValue(ctx, commandTracerKey{}, tracer), func() { _ = file.Close() }, nil
+}
+
+// traceClient wraps client to trace its commands when the run of ctx is traced.
+func traceClient(ctx context.Context, client execution.ExecutionClient, host config.Host) execution.ExecutionClient {
+	tracer, ok := ctx.Value(commandTracerKey{}).(*commandTracer)
+	if !ok {
+		return client
+	}
+	return &tracedClient{ExecutionClient: client, tracer: tracer, host: traceHost(host), clock: clockFrom(ctx)}
+}
+
+// traceHost names host in the trace, as [user@]ip[:port] with its jump hosts.
+func traceHost(host config.Host) string {
+	if k8s := host.Kubernetes; host.Type == "kubernetes" && k8s != nil {
+		pod := k8s.Pod
+		if pod == "" {
+			pod = k8s.Selector
+		}
+		return "kubernetes " + path.Join(k8s.Context, k8s.Namespace, pod)
+	}
+	if strings.TrimSpace(host.IP) == "" {
+		return "local"
+	}
+	name := host.IP
+	if host.Username != "" {
+		name = host.Username + "@" + name
+	}
+	if host.Port != 0 && host.Port != execution.DEFAULT_SSH_PORT {
+		name = fmt.Sprintf("%s:%d", name, host.Port)
+	}
+	if host.ProxyJump != "" {
+		name += " via " + host.ProxyJump
+	}
+	return name
+}
+
+func (t *commandTracer) write(start time.Time, host, summary, command string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "# %s %s %s\n", start.UTC().Format(traceTimeFormat), host, summary)
+	if command != "" {
+		fmt.Fprintf(t.w, "%s\n", command)
+	}
+	fmt.Fprintln(t.w)
+}
+
+type tracedClient struct {
+	execution.ExecutionClient
+	tracer *commandTracer
+	host   string
+	clock  Clock
+}
+
+func (c *tracedClient) RunCommand(ctx context.Context, req execution.CommandRequest) (execution.CommandResult, error) {
+	start := c.clock.Now()
+	result, err := c.ExecutionClient.RunCommand(ctx, req)
+	summary := fmt.Sprintf("exit=%d duration=%s", result.ExitCode, c.clock.Now().Sub(start))
+	if err != nil && result.ExitCode == -1 {
+		summary += fmt.Sprintf(" error=%q", err.Error())
+	}
+	c.tracer.write(start, c.host, summary, req.Command)
+	return result, err
+}
+
+func (c *tracedClient) CheckPort(ctx context.Context, port string, timeout time.Duration) (bool, error) {
+	start := c.clock.Now()
+	open, err := c.ExecutionClient.CheckPort(ctx, port, timeout)
+	c.tracer.write(start, c.host, fmt.Sprintf("check port %s open=%t duration=%s%s", port, open, c.clock.Now().Sub(start), traceError(err)), "")
+	return open, err
+}
+
+func (c *tracedClient) Scp(ctx context.Context, remotePath, localPath string) error {
+	start := c.clock.Now()
+	err := c.ExecutionClient.Scp(ctx, remotePath, localPath)
+	c.tracer.write(start, c.host, fmt.Sprintf("download %s to %s duration=%s%s", remotePath, localPath, c.clock.Now().Sub(start), traceError(err)), "")
+	return err
+}
+
+func (c *tracedClient) Upload(ctx context.Context, localPath, remotePath string) error {
+	start := c.clock.Now()
+	err := c.ExecutionClient.Upload(ctx, localPath, remotePath)
+	c.tracer.write(start, c.host, fmt.Sprintf("upload %s to %s duration=%s%s", localPath, remotePath, c.clock.Now().Sub(start), traceError(err)), "")
+	return err
+}
+
+func traceError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return fmt.Sprintf(" error=%q", err.Error())
+}
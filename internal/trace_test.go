@@ -0,0 +1,44 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestCommandTraceRecordsExecutedCommands(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "trace", OutputDir: t.TempDir(), Shell: "sh -c"},
+		Stages: []config.Stage{
+			{Name: "greet", Command: "echo \"hello $TARGET\""},
+			{Name: "fail", Command: "exit 3"},
+		},
+	}
+	result, err := RunWorkflow(WithCommandTrace(context.Background()), cfg, nil, map[string]string{"TARGET": "it's me"})
+	if err == nil {
+		t.Fatal("expected the failing stage to fail the run")
+	}
+	trace, err := os.ReadFile(filepath.Join(result.RunDir, traceFile))
+	if err != nil {
+		t.Fatalf("read trace: %v", err)
+	}
+	for _, pattern := range []string{
+		`(?m)^# \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}Z local exit=0 duration=\S+\nexport .*TARGET='it'"'"'s me'; sh -c 'echo "hello \$TARGET"'$`,
+		`(?m)^# \S+ local exit=3 duration=\S+\nexport .*; sh -c 'exit 3'$`,
+	} {
+		if !regexp.MustCompile(pattern).Match(trace) {
+			t.Fatalf("trace does not match %s:\n%s", pattern, trace)
+		}
+	}
+
+	result, _ = RunWorkflow(context.Background(), cfg, nil, nil)
+	if _, err := os.Stat(filepath.Join(result.RunDir, traceFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected no trace without WithCommandTrace, got %v", err)
+	}
+}
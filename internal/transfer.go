@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// TransferRecord is a file transfer of a run: an uploaded script or build artifact,
+// or a collected output.
+type TransferRecord struct {
+	Transfer        string    `json:"transfer"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	// Bytes is the size of the transfer, when the host reports progress.
+	Bytes    int64  `json:"bytes,omitempty"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// transferLog collects the transfers of a run, made concurrently by stages on
+// several hosts.
+type transferLog struct {
+	mu      sync.Mutex
+	entries []TransferRecord
+}
+
+type transferLogKey struct{}
+
+// withTransferLog returns a context whose transfers are recorded in the returned log.
+func withTransferLog(ctx context.Context) (context.Context, *transferLog) {
+	log := &transferLog{}
+	return context.WithValue(ctx, transferLogKey{}, log), log
+}
+
+// recordTransfer adds record to the transfer log of ctx, if any.
+func recordTransfer(ctx context.Context, record TransferRecord) {
+	log, ok := ctx.Value(transferLogKey{}).(*transferLog)
+	if !ok {
+		return
+	}
+	log.mu.Lock()
+	log.entries = append(log.entries, record)
+	log.mu.Unlock()
+}
+
+// records returns the recorded transfers in the order they started.
+func (l *transferLog) records() []TransferRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := slices.Clone(l.entries)
+	slices.SortStableFunc(records, func(a, b TransferRecord) int { return a.StartedAt.Compare(b.StartedAt) })
+	return records
+}
+
+// logTransferProgress returns a context whose transfers log their bytes, rate, and
+// remaining time while they run, so a large collection does not look like a hang.
+// The last reported size is stored in bytes.
+func logTransferProgress(ctx context.Context, logger *slog.Logger, description string, bytes *int64) context.Context {
+	return execution.WithTransferProgress(ctx, func(progress execution.TransferProgress) {
+		*bytes = progress.Bytes
+		if progress.Done {
+			return
+		}
+		rate := float64(progress.Bytes) / progress.Elapsed.Seconds()
+		args := []any{"transfer", description, "bytes", progress.Bytes, "total", progress.Total, "rate", formatRate(rate)}
+		if rate > 0 && progress.Total > progress.Bytes {
+			eta := time.Duration(float64(progress.Total-progress.Bytes) / rate * float64(time.Second))
+			args = append(args, "eta", eta.Round(time.Second))
+		}
+		logger.Info("transfer progress", args...)
+	})
+}
+
+// formatRate formats a transfer rate in bytes per second.
+func formatRate(rate float64) string {
+	for _, unit := range []string{"B/s", "KiB/s", "MiB/s"} {
+		if rate < 1024 {
+			return fmt.Sprintf("%.1f %s", rate, unit)
+		}
+		rate /= 1024
+	}
+	return fmt.Sprintf("%.1f GiB/s", rate)
+}
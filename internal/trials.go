@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// TrialRecord is one execution of the stage pipeline in a run with
+// benchmark.trials.
+type TrialRecord struct {
+	Trial int `json:"trial"`
+	// Warmup is set for the benchmark.warmup_trials, numbered apart from the trials.
+	Warmup bool `json:"warmup,omitempty"`
+	// Dir holds the outputs and console logs of the trial, relative to the run directory.
+	Dir string `json:"dir"`
+	// Metrics are the custom metadata the trial recorded.
+	Metrics map[string]string `json:"metrics,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// TrialStats summarizes the values of one numeric metric across the successful
+// trials of a run.
+type TrialStats struct {
+	Sample
+	Min float64 `json:"min"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	Max float64 `json:"max"`
+}
+
+// executeTrials executes the stage pipeline benchmark.trials times, each trial
+// into trial-<n>/ of the run directory with BENCHCTL_TRIAL set, and replaces the
+// metrics of the trials in the run metadata by their aggregates. The
+// benchmark.warmup_trials go first, into warmup-<n>/ with BENCHCTL_WARMUP set;
+// their expectations are not checked and their metrics not aggregated. Reset
+// hooks and the cooldown run before every trial after the first, as before cases.
+// The first failed trial ends the run; the metrics of the trials before it are
+// aggregated.
+func executeTrials(
+	ctx context.Context,
+	cfg *config.Config,
+	runID, runDir string,
+	logger *slog.Logger,
+	logWriter io.Writer,
+	metadata *RunMetadata,
+	envVars map[string]string,
+) error {
+	trials, warmups := max(cfg.Benchmark.Trials, 1), cfg.Benchmark.WarmupTrials
+	if trials == 1 && warmups == 0 {
+		return executePipeline(ctx, cfg, runID, runDir, logger, logWriter, metadata, envVars)
+	}
+	before := maps.Clone(metadata.Custom)
+	defer func() {
+		metadata.Custom, metadata.TrialStats = aggregateTrials(before, metadata.Trials)
+	}()
+	for i := range warmups + trials {
+		trialCtx := ctx
+		trialEnv := maps.Clone(envVars)
+		if trialEnv == nil {
+			trialEnv = map[string]string{}
+		}
+		var record TrialRecord
+		var name string
+		if i < warmups {
+			record = TrialRecord{Trial: i + 1, Warmup: true, Dir: fmt.Sprintf("warmup-%d", i+1)}
+			name = fmt.Sprintf("warmup trial %d", record.Trial)
+			trialCtx = withWarmupTrial(ctx)
+			trialEnv[EnvWarmup] = "true"
+		} else {
+			record = TrialRecord{Trial: i - warmups + 1, Dir: fmt.Sprintf("trial-%d", i-warmups+1)}
+			name = fmt.Sprintf("trial %d", record.Trial)
+			trialEnv[EnvTrial] = strconv.Itoa(record.Trial)
+		}
+		trialDir := filepath.Join(runDir, record.Dir)
+		if err := os.MkdirAll(trialDir, 0755); err != nil {
+			return fmt.Errorf("create trial directory: %w", err)
+		}
+		if i > 0 {
+			if err := prepareTrial(trialCtx, cfg, runID, trialDir, trialEnv, metadata, logger); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+
+		metadata.Custom = maps.Clone(before)
+		logger.Info("trial started", "trial", record.Trial, "warmup", record.Warmup, "trials", trials, "dir", trialDir)
+		err := executePipeline(trialCtx, cfg, runID, trialDir, logger, logWriter, metadata, trialEnv)
+		record.Metrics = changedMetrics(before, metadata.Custom)
+		if err != nil {
+			record.Error = err.Error()
+			metadata.Trials = append(metadata.Trials, record)
+			logError(logger, "trial failed", err, "trial", record.Trial, "warmup", record.Warmup)
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		metadata.Trials = append(metadata.Trials, record)
+		logger.Info("trial completed", "trial", record.Trial, "warmup", record.Warmup, "trials", trials)
+	}
+	return nil
+}
+
+// prepareTrial runs the reset hooks and the cooldown before a trial after the
+// first, so that its first case starts from the same state as the other cases.
+func prepareTrial(ctx context.Context, cfg *config.Config, runID, trialDir string, envVars map[string]string, metadata *RunMetadata, logger *slog.Logger) error {
+	firstCase := workflowCases(cfg)[0]
+	if len(cfg.Benchmark.Reset) > 0 {
+		records, err := resetHosts(ctx, cfg, runID, trialDir, envVars, firstCase, logger)
+		metadata.Resets = append(metadata.Resets, records...)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.Benchmark.Cooldown != nil {
+		record, err := coolDown(ctx, cfg, firstCase, logger)
+		metadata.Cooldowns = append(metadata.Cooldowns, *record)
+		if err != nil {
+			logError(logger, "cooldown failed", err, "case", firstCase.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// changedMetrics returns the entries of after that are new or differ from before.
+func changedMetrics(before, after map[string]string) map[string]string {
+	changed := map[string]string{}
+	for key, value := range after {
+		if previous, ok := before[key]; !ok || previous != value {
+			changed[key] = value
+		}
+	}
+	return changed
+}
+
+// aggregateTrials returns the custom metadata of a run from the metadata before
+// its trials and the metrics of its successful trials other than warmup trials:
+// the mean of every metric that is numeric in each trial recording it, with its
+// statistics, and the value of the last trial for the others.
+func aggregateTrials(before map[string]string, trials []TrialRecord) (map[string]string, map[string]TrialStats) {
+	custom := maps.Clone(before)
+	values := map[string][]float64{}
+	nonNumeric := map[string]bool{}
+	for _, trial := range trials {
+		if trial.Error != "" || trial.Warmup {
+			continue
+		}
+		for key, raw := range trial.Metrics {
+			if custom == nil {
+				custom = map[string]string{}
+			}
+			custom[key] = raw
+			if value, ok := parseFloat(raw); ok {
+				values[key] = append(values[key], *value)
+			} else {
+				nonNumeric[key] = true
+			}
+		}
+	}
+	var stats map[string]TrialStats
+	for key, samples := range values {
+		if nonNumeric[key] {
+			continue
+		}
+		slices.Sort(samples)
+		if stats == nil {
+			stats = map[string]TrialStats{}
+		}
+		stats[key] = TrialStats{
+			Sample: summarize(samples),
+			Min:    samples[0],
+			P50:    quantile(samples, 0.5),
+			P95:    quantile(samples, 0.95),
+			Max:    samples[len(samples)-1],
+		}
+		custom[key] = strconv.FormatFloat(stats[key].Mean, 'g', -1, 64)
+	}
+	return custom, stats
+}
@@ -0,0 +1,74 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestRunWorkflowAggregatesTrials(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "trials", OutputDir: t.TempDir(), Trials: 4},
+		Stages: []config.Stage{{
+			Name:              "load",
+			Command:           `echo "Requests/sec: $((BENCHCTL_TRIAL * 100))"; echo "version: v$BENCHCTL_TRIAL"`,
+			MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}, {Name: "version", Pattern: `version: (\S+)`}},
+			Expect:            []string{"rps >= 100"},
+		}},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, map[string]string{"tag": "nightly"}, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	metadata := result.Metadata
+	if len(metadata.Trials) != 4 {
+		t.Fatalf("trials = %+v", metadata.Trials)
+	}
+	for _, trial := range metadata.Trials {
+		if _, err := os.Stat(filepath.Join(result.RunDir, trial.Dir, "console", "load", "local.log")); err != nil {
+			t.Errorf("trial %d console output: %v", trial.Trial, err)
+		}
+	}
+	if got := metadata.Trials[2].Metrics; !reflect.DeepEqual(got, map[string]string{"rps": "300", "version": "v3"}) {
+		t.Errorf("trial 3 metrics = %v", got)
+	}
+	if got, want := metadata.Custom, map[string]string{"tag": "nightly", "rps": "250", "version": "v4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("custom = %v, want %v", got, want)
+	}
+	stats, ok := metadata.TrialStats["rps"]
+	if !ok || stats.N != 4 || stats.Min != 100 || stats.Max != 400 || stats.P50 != 250 || stats.P95 != 385 {
+		t.Errorf("rps stats = %+v", stats)
+	}
+	if _, ok := metadata.TrialStats["version"]; ok {
+		t.Error("non-numeric metric has trial stats")
+	}
+}
+
+func TestRunWorkflowStopsAtFailedTrial(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "trials", OutputDir: t.TempDir(), Trials: 3},
+		Stages: []config.Stage{{
+			Name:              "load",
+			Command:           `echo "Requests/sec: $((BENCHCTL_TRIAL * 100))"`,
+			MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}},
+			Expect:            []string{"rps < 150"},
+		}},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err == nil {
+		t.Fatal("expected the second trial to fail")
+	}
+	metadata := result.Metadata
+	if len(metadata.Trials) != 2 || metadata.Trials[1].Error == "" {
+		t.Fatalf("trials = %+v", metadata.Trials)
+	}
+	if metadata.Custom["rps"] != "100" || metadata.TrialStats["rps"].N != 1 {
+		t.Errorf("aggregate of the successful trial: custom %v, stats %+v", metadata.Custom, metadata.TrialStats)
+	}
+}
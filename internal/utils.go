@@ -17,7 +17,7 @@ func CallWithRetry[T any](ctx context.Context, fn func() (T, error), maxAttempts
 		}
 		lastErr = err
 		if i < maxAttempts-1 { // Don't sleep after the last attempt
-			time.Sleep(backoff)
+			<-clockFrom(ctx).After(backoff)
 		}
 	}
 	var zero T
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// versionScript defines a function printing the version of a package or command
+// as NAME=source:version, asking dpkg, rpm, and apk first and else the command
+// itself. It is POSIX sh like capabilityScript, and bounds each command with
+// timeout where available.
+const versionScript = `version() {
+	if command -v dpkg-query >/dev/null 2>&1 && v=$(dpkg-query -W -f='${Version}' "$1" 2>/dev/null) && [ -n "$v" ]; then echo "$1=dpkg:$v"; return; fi
+	if command -v rpm >/dev/null 2>&1 && v=$(rpm -q --qf '%{VERSION}-%{RELEASE}' "$1" 2>/dev/null); then echo "$1=rpm:$v"; return; fi
+	if command -v apk >/dev/null 2>&1 && v=$(apk info -e -v "$1" 2>/dev/null) && [ -n "$v" ]; then echo "$1=apk:${v#"$1"-}"; return; fi
+	command -v "$1" >/dev/null 2>&1 || return 0
+	t=; if command -v timeout >/dev/null 2>&1; then t="timeout 5"; fi
+	for flag in --version -v -V version; do
+		if v=$($t "$1" $flag 2>&1 </dev/null) && [ -n "$v" ]; then echo "$1=command:$v"; return; fi
+	done
+}
+`
+
+// versionNumber matches the version in the output of a command, such as 1.24.0
+// in "nginx version: nginx/1.24.0 (Ubuntu)".
+var versionNumber = regexp.MustCompile(`\d+(?:\.\d+)+[0-9A-Za-z.+~-]*`)
+
+// captureVersions records the versions of benchmark.capture_versions on every
+// stage host, by host alias. Packages found neither by a package manager nor as a
+// command are logged and left out.
+func captureVersions(ctx context.Context, cfg *config.Config, logger *slog.Logger) (map[string]map[string]string, error) {
+	names := cfg.Benchmark.CaptureVersions
+	if len(names) == 0 {
+		return nil, nil
+	}
+	script := versionScript
+	for _, name := range names {
+		script += "version " + shellQuote(name) + "\n"
+	}
+	hostAliases := stageHostAliases(cfg)
+	versions := make(map[string]map[string]string, len(hostAliases))
+	for _, hostAlias := range hostAliases {
+		client, err := openExecutionClient(ctx, cfg.Hosts[hostAlias])
+		if err != nil {
+			return nil, fmt.Errorf("capture versions on host %s: %w", hostAlias, err)
+		}
+		result, err := client.RunCommand(ctx, execution.CommandRequest{Command: "sh -c " + shellQuote(script)})
+		_ = client.Close()
+		if err == nil && result.ExitCode != 0 {
+			err = fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("capture versions on host %s: %w", hostAlias, err)
+		}
+		versions[hostAlias] = parseVersions(result.Output, names)
+		for _, name := range names {
+			if _, ok := versions[hostAlias][name]; !ok {
+				logger.Warn("package version not found", "host", hostAlias, "package", name)
+			}
+		}
+		logger.Info("package versions captured", "host", hostAlias, "versions", versions[hostAlias])
+	}
+	return versions, nil
+}
+
+// parseVersions reads the NAME=source:version lines of the version output for the
+// names asked for. The version printed by a command is reduced to its version
+// number when it has one.
+func parseVersions(output string, names []string) map[string]string {
+	versions := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || !slices.Contains(names, name) {
+			continue
+		}
+		if _, seen := versions[name]; seen {
+			continue
+		}
+		source, version, _ := strings.Cut(value, ":")
+		if source == "command" {
+			if number := versionNumber.FindString(version); number != "" {
+				version = number
+			}
+		}
+		if version = strings.TrimSpace(version); version != "" {
+			versions[name] = version
+		}
+	}
+	return versions
+}
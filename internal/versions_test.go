@@ -0,0 +1,46 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestCaptureVersionsRecordsCommandVersions(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = --version ] || exit 2\necho 'benchctl-fake-server version 2.3.1 (build 7)'\n"
+	if err := os.WriteFile(filepath.Join(bin, "benchctl-fake-server"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{
+			Name:            "versions",
+			OutputDir:       t.TempDir(),
+			CaptureVersions: []string{"benchctl-fake-server", "benchctl-missing-package"},
+		},
+		Stages: []config.Stage{{Name: "run", Command: "true"}},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if got, want := result.Metadata.Versions["local"], map[string]string{"benchctl-fake-server": "2.3.1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("versions = %v, want %v", got, want)
+	}
+}
+
+func TestParseVersions(t *testing.T) {
+	output := "Last login: today\nnginx=dpkg:1.24.0-2ubuntu7\nopenssl=command:OpenSSL 3.0.13 30 Jan 2024 (Library: OpenSSL 3.0.13)\npostgres=rpm:16.1-1.el9\nredis=command:unknown\nother=dpkg:9\n"
+	got := parseVersions(output, []string{"nginx", "openssl", "postgres", "redis"})
+	want := map[string]string{"nginx": "1.24.0-2ubuntu7", "openssl": "3.0.13", "postgres": "16.1-1.el9", "redis": "unknown"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseVersions() = %v, want %v", got, want)
+	}
+}
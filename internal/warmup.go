@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"context"
+	"maps"
+	"path/filepath"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+// warmupDir holds the outputs of warmup stages.
+const warmupDir = "warmup"
+
+type warmupTrialKey struct{}
+
+// withWarmupTrial marks ctx as executing a warmup trial.
+func withWarmupTrial(ctx context.Context) context.Context {
+	return context.WithValue(ctx, warmupTrialKey{}, true)
+}
+
+// inWarmupTrial reports whether ctx executes a warmup trial, whose expectations
+// are not checked.
+func inWarmupTrial(ctx context.Context) bool {
+	warmup, _ := ctx.Value(warmupTrialKey{}).(bool)
+	return warmup
+}
+
+// stageOutputDir returns the directory the outputs of stage are collected into:
+// warmup/ of the run directory for warmup stages, and the run directory otherwise.
+func stageOutputDir(runDir string, stage config.Stage) string {
+	if stage.Warmup {
+		return filepath.Join(runDir, warmupDir)
+	}
+	return runDir
+}
+
+// addStageMetrics records metrics derived from the output of stage, keeping those
+// of warmup stages out of the custom metadata that comparisons and summaries read.
+func addStageMetrics(metadata *RunMetadata, stage config.Stage, metrics map[string]string) {
+	if !stage.Warmup {
+		addDerivedMetrics(metadata, metrics)
+		return
+	}
+	if len(metrics) == 0 {
+		return
+	}
+	if metadata.Warmup == nil {
+		metadata.Warmup = map[string]string{}
+	}
+	maps.Copy(metadata.Warmup, metrics)
+}
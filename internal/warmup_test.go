@@ -0,0 +1,80 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestRunWorkflowKeepsWarmupStagesApart(t *testing.T) {
+	tempDir := t.TempDir()
+	warmupCSV := filepath.Join(tempDir, "warmup.csv")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "warmup", OutputDir: filepath.Join(tempDir, "results")},
+		Stages: []config.Stage{
+			{
+				Name:              "warm",
+				Warmup:            true,
+				Command:           "echo 'Requests/sec: 10'; echo 'latency' > '" + warmupCSV + "'",
+				MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}},
+				Outputs:           []config.Output{{Name: "warm", RemotePath: warmupCSV}},
+			},
+			{
+				Name:              "load",
+				Command:           "echo 'Requests/sec: 900'",
+				MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}},
+				Expect:            []string{"rps > 500"},
+			},
+		},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if got := result.Metadata.Custom["rps"]; got != "900" {
+		t.Errorf("rps = %q, want the measured value", got)
+	}
+	if got := result.Metadata.Warmup; !reflect.DeepEqual(got, map[string]string{"rps": "10"}) {
+		t.Errorf("warmup metrics = %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(result.RunDir, "warmup", "warm.csv")); err != nil {
+		t.Errorf("warmup output: %v", err)
+	}
+	for _, input := range result.Metadata.Analysis.Inputs {
+		if input.Stage == "warm" {
+			t.Errorf("warmup stage recorded as analysis input %+v", input)
+		}
+	}
+}
+
+func TestRunWorkflowLeavesWarmupTrialsOutOfAggregates(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "warmup", OutputDir: t.TempDir(), Trials: 2, WarmupTrials: 1},
+		Stages: []config.Stage{{
+			Name:              "load",
+			Command:           `if [ "$BENCHCTL_WARMUP" = true ]; then echo "Requests/sec: 5"; else echo "Requests/sec: $((BENCHCTL_TRIAL * 100))"; fi`,
+			MetricsFromOutput: []config.OutputMetric{{Name: "rps", Pattern: `Requests/sec:\s+(\d+)`}},
+			Expect:            []string{"rps >= 100"},
+		}},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	trials := result.Metadata.Trials
+	if len(trials) != 3 || !trials[0].Warmup || trials[0].Dir != "warmup-1" || trials[0].Metrics["rps"] != "5" || trials[2].Dir != "trial-2" {
+		t.Fatalf("trials = %+v", trials)
+	}
+	if got := result.Metadata.Custom["rps"]; got != "150" {
+		t.Errorf("rps = %q, want the mean of the measured trials", got)
+	}
+	if stats := result.Metadata.TrialStats["rps"]; stats.N != 2 || stats.Min != 100 {
+		t.Errorf("rps stats = %+v", stats)
+	}
+}
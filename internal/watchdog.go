@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// hostWatchdog probes the remote hosts of a run in the background and cancels the
+// run context as soon as one of them stops answering, so a stage fails fast instead
+// of hanging until the TCP timeout.
+type hostWatchdog struct {
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	// stages lists the running stages in the order they started, and running
+	// those of each host alias; stages of a dependency graph or parallel group
+	// run at once.
+	stages  []string
+	running map[string][]string
+	err     error
+}
+
+// startWatchdog starts probing the remote stage hosts. It returns ctx unchanged and a
+// nil watchdog when the watchdog is disabled or every stage runs locally.
+func startWatchdog(ctx context.Context, cfg *config.Config, logger *slog.Logger) (context.Context, *hostWatchdog) {
+	settings := cfg.Benchmark.Watchdog
+	hosts := watchdogHosts(cfg)
+	if settings == nil || len(hosts) == 0 {
+		return ctx, nil
+	}
+	interval, _ := time.ParseDuration(settings.Interval)
+	timeout, _ := time.ParseDuration(settings.Timeout)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	w := &hostWatchdog{cancel: cancel, running: map[string][]string{}}
+	for _, hostAlias := range hosts {
+		address := sshAddress(cfg.Hosts[hostAlias])
+		w.wg.Go(func() {
+			w.watch(ctx, hostAlias, address, interval, timeout, settings.Failures, logger)
+		})
+	}
+	return ctx, w
+}
+
+// StartStage records that the stage name runs on hosts until the returned func is
+// called, for the failure message of a host that stops answering meanwhile.
+func (w *hostWatchdog) StartStage(name string, hosts []string) func() {
+	if w == nil {
+		return func() {}
+	}
+	w.mu.Lock()
+	w.stages = append(w.stages, name)
+	for _, hostAlias := range hosts {
+		w.running[hostAlias] = append(w.running[hostAlias], name)
+	}
+	w.mu.Unlock()
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.stages = removeStage(w.stages, name)
+		for _, hostAlias := range hosts {
+			w.running[hostAlias] = removeStage(w.running[hostAlias], name)
+		}
+	}
+}
+
+func removeStage(stages []string, name string) []string {
+	if i := slices.Index(stages, name); i >= 0 {
+		return slices.Delete(stages, i, i+1)
+	}
+	return stages
+}
+
+// Err returns the unreachable host error once the watchdog has fired.
+func (w *hostWatchdog) Err() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Stop ends the probes.
+func (w *hostWatchdog) Stop() {
+	if w == nil {
+		return
+	}
+	w.cancel(nil)
+	w.wg.Wait()
+}
+
+func (w *hostWatchdog) watch(ctx context.Context, hostAlias, address string, interval, timeout time.Duration, failures int, logger *slog.Logger) {
+	failed := 0
+	for {
+		if err := sleepContext(ctx, interval); err != nil {
+			return
+		}
+		err := probeSSH(ctx, address, timeout)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			failed = 0
+			continue
+		}
+		failed++
+		logger.Warn("host check failed", "host", hostAlias, "attempt", failed, "error", err)
+		if failed >= failures {
+			w.fire(hostAlias, err, logger)
+			return
+		}
+	}
+}
+
+func (w *hostWatchdog) fire(hostAlias string, cause error, logger *slog.Logger) {
+	w.mu.Lock()
+	if w.err == nil {
+		// The stages on other hosts fail as well once the run is canceled.
+		stages := w.running[hostAlias]
+		if len(stages) == 0 {
+			stages = w.stages
+		}
+		switch len(stages) {
+		case 0:
+			w.err = fmt.Errorf("host %s became unreachable: %w", hostAlias, cause)
+		case 1:
+			w.err = fmt.Errorf("host %s became unreachable during stage %s: %w", hostAlias, stages[0], cause)
+		default:
+			w.err = fmt.Errorf("host %s became unreachable during stages %s: %w", hostAlias, strings.Join(stages, ", "), cause)
+		}
+		logError(logger, "host unreachable", w.err, "host", hostAlias, "stages", stages)
+		w.cancel(w.err)
+	}
+	w.mu.Unlock()
+}
+
+// probeSSH connects to address and waits for the SSH identification line.
+func probeSSH(ctx context.Context, address string, timeout time.Duration) error {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read ssh banner: %w", err)
+	}
+	if !strings.HasPrefix(banner, "SSH-") {
+		return fmt.Errorf("unexpected ssh banner %q", strings.TrimSpace(banner))
+	}
+	return nil
+}
+
+// watchdogHosts returns the sorted remote hosts used by the stages that will run.
+// Hosts behind a proxy_jump are left out, as their SSH port is not reachable
+// directly.
+func watchdogHosts(cfg *config.Config) []string {
+	var hosts []string
+	for _, stage := range cfg.Stages {
+		if stage.Skip {
+			continue
+		}
+		for _, hostAlias := range resolveStageHosts(stage) {
+			host, ok := cfg.Hosts[hostAlias]
+			if ok && strings.TrimSpace(host.IP) != "" && host.ProxyJump == "" && !slices.Contains(hosts, hostAlias) {
+				hosts = append(hosts, hostAlias)
+			}
+		}
+	}
+	slices.Sort(hosts)
+	return hosts
+}
+
+func sshAddress(host config.Host) string {
+	port := host.Port
+	if port == 0 {
+		port = execution.DEFAULT_SSH_PORT
+	}
+	return net.JoinHostPort(host.IP, strconv.Itoa(port))
+}
@@ -0,0 +1,104 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestProbeSSH(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("SSH-2.0-test\r\n"))
+			_ = conn.Close()
+		}
+	}()
+
+	if err := probeSSH(context.Background(), listener.Addr().String(), time.Second); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+	if err := probeSSH(context.Background(), address, time.Second); err == nil {
+		t.Fatalf("expected probe of closed port to fail")
+	}
+}
+
+func TestExecuteStagesFailsFastOnUnreachableHost(t *testing.T) {
+	// The listener accepts connections but never sends an SSH banner.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{
+			Name:      "watchdog",
+			OutputDir: tempDir,
+			Watchdog:  &config.Watchdog{Interval: "20ms", Timeout: "100ms", Failures: 2},
+		},
+		Hosts: map[string]config.Host{"server": {IP: "127.0.0.1", Port: port, Username: "bench"}},
+		Stages: []config.Stage{
+			{Name: "load", Command: "sleep 30"},
+			{Name: "collect", Host: "server", Command: "true"},
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	started := time.Now()
+	err = executeStages(context.Background(), cfg, "1", tempDir, logger, io.Discard, &RunMetadata{RunID: "1"}, newBackgroundManager(logger), newNetemManager(logger), nil)
+	if err == nil || !strings.Contains(err.Error(), "host server became unreachable during stage load") {
+		t.Fatalf("expected unreachable host error, got %v", err)
+	}
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Name != "load" {
+		t.Fatalf("expected stage error for load, got %#v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("watchdog took %s to abort the stage", elapsed)
+	}
+}
+
+func TestWatchdogReportsConcurrentStagesOfHost(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	w := &hostWatchdog{cancel: cancel, running: map[string][]string{}}
+	doneSetup := w.StartStage("setup", []string{"client"})
+	w.StartStage("load-a", []string{"server"})
+	w.StartStage("load-b", []string{"server", "client"})
+	doneSetup()
+
+	w.fire("server", errors.New("timeout"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := w.Err(); err == nil || !strings.Contains(err.Error(), "host server became unreachable during stages load-a, load-b") {
+		t.Fatalf("expected both stages on the server, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+const (
+	// WebhookSchemaVersion is the version of WebhookPayload. It changes only when
+	// fields are removed or change meaning; new fields may be added at any time.
+	WebhookSchemaVersion = 1
+	webhookEvent         = "run.completed"
+	webhookSignature     = "X-Benchctl-Signature"
+	webhookTimestamp     = "X-Benchctl-Timestamp"
+)
+
+// WebhookPayload is the JSON body POSTed to benchmark.webhooks when a run finishes.
+type WebhookPayload struct {
+	SchemaVersion   int               `json:"schema_version"`
+	Event           string            `json:"event"`
+	RunID           string            `json:"run_id"`
+	Benchmark       string            `json:"benchmark"`
+	Status          string            `json:"status"`
+	Error           string            `json:"error,omitempty"`
+	StartTime       time.Time         `json:"start_time"`
+	EndTime         time.Time         `json:"end_time"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	Metrics         map[string]string `json:"metrics,omitempty"`
+	Failures        []StageFailure    `json:"failures,omitempty"`
+	Artifacts       []WebhookArtifact `json:"artifacts"`
+}
+
+// WebhookArtifact is a stored file of the run and where to fetch it.
+type WebhookArtifact struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	URL  string `json:"url"`
+}
+
+// sendWebhooks POSTs the finished run to every configured webhook. Failures are
+// logged and do not change the outcome of the run, whose metadata is already saved.
+func sendWebhooks(ctx context.Context, cfg *config.Config, metadata *RunMetadata, runDir string, logger *slog.Logger) {
+	if len(cfg.Benchmark.Webhooks) == 0 {
+		return
+	}
+	// an interrupted run still reports its result
+	ctx = context.WithoutCancel(ctx)
+	store, runID := localRun(runDir)
+	artifacts, err := store.ListArtifacts(ctx, runID)
+	if err != nil {
+		logError(logger, "webhook artifacts listing failed", err, "run_id", metadata.RunID)
+	}
+	for _, webhook := range cfg.Benchmark.Webhooks {
+		payload := webhookPayload(metadata, artifacts, webhook.ArtifactURL, store.RunDir(runID))
+		if err := sendWebhook(ctx, webhook, payload); err != nil {
+			logError(logger, "webhook failed", err, "run_id", metadata.RunID, "url", webhook.URL)
+			continue
+		}
+		logger.Info("webhook sent", "run_id", metadata.RunID, "url", webhook.URL)
+	}
+}
+
+func webhookPayload(metadata *RunMetadata, artifacts []Artifact, artifactURL, runDir string) WebhookPayload {
+	payload := WebhookPayload{
+		SchemaVersion:   WebhookSchemaVersion,
+		Event:           webhookEvent,
+		RunID:           metadata.RunID,
+		Benchmark:       metadata.BenchmarkName,
+		Status:          metadata.Status,
+		Error:           metadata.Error,
+		StartTime:       metadata.StartTime,
+		EndTime:         metadata.EndTime,
+		DurationSeconds: metadata.EndTime.Sub(metadata.StartTime).Seconds(),
+		Metrics:         metadata.Custom,
+		Failures:        metadata.Failures,
+		Artifacts:       make([]WebhookArtifact, 0, len(artifacts)),
+	}
+	for _, artifact := range artifacts {
+		payload.Artifacts = append(payload.Artifacts, WebhookArtifact{
+			Name: artifact.Name,
+			Size: artifact.Size,
+			URL:  webhookArtifactURL(artifactURL, runDir, metadata.RunID, artifact.Name),
+		})
+	}
+	return payload
+}
+
+// webhookArtifactURL expands the artifact_url template of a webhook, or returns a
+// file:// URL of the artifact below runDir when there is none.
+func webhookArtifactURL(template, runDir, runID, name string) string {
+	if template == "" {
+		path, err := filepath.Abs(filepath.Join(runDir, filepath.FromSlash(name)))
+		if err != nil {
+			path = filepath.Join(runDir, filepath.FromSlash(name))
+		}
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	}
+	return strings.NewReplacer("{run_id}", url.PathEscape(runID), "{name}", (&url.URL{Path: name}).EscapedPath()).Replace(template)
+}
+
+func sendWebhook(ctx context.Context, webhook config.Webhook, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %w", err)
+	}
+	timeout, err := time.ParseDuration(webhook.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Benchctl-Event", webhookEvent)
+	if webhook.Secret != "" {
+		secret, err := config.ResolveSecret(webhook.Secret)
+		if err != nil {
+			return err
+		}
+		timestamp := strconv.FormatInt(clockFrom(ctx).Now().Unix(), 10)
+		req.Header.Set(webhookTimestamp, timestamp)
+		req.Header.Set(webhookSignature, signWebhook(secret, timestamp, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook: server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// signWebhook returns the X-Benchctl-Signature value of body sent at timestamp:
+// "sha256=" and the hex HMAC-SHA256 of timestamp, ".", and the body keyed with
+// secret. Signing the timestamp lets receivers reject replayed deliveries.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,85 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luccadibe/benchctl/internal/config"
+)
+
+func TestRunWorkflowSendsSignedWebhook(t *testing.T) {
+	type delivery struct {
+		event, signature, timestamp string
+		body                        []byte
+	}
+	deliveries := make(chan delivery, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r.Header.Get("X-Benchctl-Event"), r.Header.Get(webhookSignature), r.Header.Get(webhookTimestamp), body}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	t.Setenv("TEST_WEBHOOK_SECRET", "s3cret")
+
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{
+			Name:      "webhook",
+			OutputDir: t.TempDir(),
+			Webhooks: []config.Webhook{{
+				URL:         server.URL,
+				Secret:      "env://TEST_WEBHOOK_SECRET",
+				ArtifactURL: "https://results.example.com/runs/{run_id}/{name}",
+			}},
+		},
+		Stages: []config.Stage{{Name: "run", Command: "true"}},
+	}
+	result, err := RunWorkflow(context.Background(), cfg, map[string]string{"rps": "100"}, nil)
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+
+	got := <-deliveries
+	if got.event != "run.completed" {
+		t.Fatalf("event = %q", got.event)
+	}
+	if got.timestamp == "" {
+		t.Fatal("expected a timestamp header")
+	}
+	if want := signWebhook("s3cret", got.timestamp, got.body); got.signature != want {
+		t.Fatalf("signature = %q, want %q", got.signature, want)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if payload.SchemaVersion != WebhookSchemaVersion || payload.RunID != result.RunID || payload.Benchmark != "webhook" || payload.Status != "success" {
+		t.Fatalf("payload = %+v", payload)
+	}
+	if payload.Metrics["rps"] != "100" {
+		t.Fatalf("metrics = %v", payload.Metrics)
+	}
+	var metadataURL string
+	for _, artifact := range payload.Artifacts {
+		if artifact.Name == metadataFile {
+			metadataURL = artifact.URL
+		}
+	}
+	if want := "https://results.example.com/runs/" + result.RunID + "/metadata.json"; metadataURL != want {
+		t.Fatalf("metadata.json url = %q, want %q (artifacts %+v)", metadataURL, want, payload.Artifacts)
+	}
+}
+
+func TestWebhookArtifactURL(t *testing.T) {
+	if got := webhookArtifactURL("", "/results/3", "3", "logs/run log.txt"); got != "file:///results/3/logs/run%20log.txt" {
+		t.Fatalf("default url = %q", got)
+	}
+	if got := webhookArtifactURL("https://r.example.com/{run_id}/{name}", "/results/3", "3", "a b.csv"); got != "https://r.example.com/3/a%20b.csv" {
+		t.Fatalf("template url = %q", got)
+	}
+}
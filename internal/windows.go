@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// isWindowsHost reports whether host is a Windows host, whose execution client
+// runs every command as a PowerShell script.
+func isWindowsHost(host config.Host) bool {
+	return host.OS == "windows"
+}
+
+// hostEnvPrefix returns the prefix of a command on host exporting env: an export
+// for sh, or $env assignments on windows hosts.
+func hostEnvPrefix(host config.Host, env map[string]string) string {
+	if !isWindowsHost(host) {
+		return envPrefixFromMap(env)
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString("$env:" + key + " = " + execution.PowerShellQuote(env[key]) + "; ")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// hostShellCommand wraps commandBody with shell, except on windows hosts whose
+// commands already are PowerShell scripts.
+func hostShellCommand(host config.Host, commandBody, shell string) string {
+	if isWindowsHost(host) {
+		return commandBody
+	}
+	return wrapWithShell(commandBody, shell)
+}
+
+// mkdirCommand returns the command creating dir and its parents on host.
+func mkdirCommand(host config.Host, dir string) string {
+	if isWindowsHost(host) {
+		return "New-Item -ItemType Directory -Force -Path " + execution.PowerShellQuote(dir) + " | Out-Null"
+	}
+	return "mkdir -p -- " + shellQuote(dir)
+}
+
+// windowsScriptCommand returns the command running an uploaded script on a windows
+// host. Scripts are uploaded below the home directory of the SSH user, where
+// OpenSSH starts the session.
+func windowsScriptCommand(remoteScriptPath string) string {
+	return "& " + execution.PowerShellQuote("./"+path.Base(remoteScriptPath))
+}
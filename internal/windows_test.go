@@ -0,0 +1,94 @@
+//go:build unit
+
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+)
+
+// powerShellRecorder records the PowerShell scripts a windows host is asked to
+// run and the files uploaded to it.
+type powerShellRecorder struct {
+	execution.ExecutionClient
+	mu      sync.Mutex
+	scripts []string
+	uploads []string
+}
+
+func (c *powerShellRecorder) RunCommand(_ context.Context, req execution.CommandRequest) (execution.CommandResult, error) {
+	fields := strings.Fields(req.Command)
+	data, err := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+	if err != nil {
+		return execution.CommandResult{ExitCode: 1}, err
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scripts = append(c.scripts, fields[0]+": "+string(utf16.Decode(units)))
+	return execution.CommandResult{}, nil
+}
+
+func (c *powerShellRecorder) Upload(_ context.Context, _, remotePath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uploads = append(c.uploads, remotePath)
+	return nil
+}
+
+func (c *powerShellRecorder) Close() error { return nil }
+
+func TestWindowsHostsRunPowerShellScripts(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "warmup.ps1")
+	if err := os.WriteFile(script, []byte("Write-Output warm\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "windows", OutputDir: t.TempDir()},
+		Hosts:     map[string]config.Host{"win": {IP: "10.0.0.9", Username: "bench", OS: "windows", Shell: "pwsh"}},
+		Stages: []config.Stage{
+			{Name: "warmup", Host: "win", Script: script},
+			{Name: "load", Host: "win", Command: `& C:/bench/load.exe --target "$env:TARGET"`},
+		},
+	}
+	recorder := &powerShellRecorder{}
+	ctx := WithClientFactory(context.Background(), func(host config.Host) (execution.ExecutionClient, error) {
+		if host.IP == "" {
+			return execution.NewLocalClient(), nil
+		}
+		return recorder, nil
+	})
+	if _, err := RunWorkflow(ctx, cfg, nil, map[string]string{"TARGET": "it's"}); err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	all := strings.Join(recorder.scripts, "\n---\n")
+	for _, want := range []string{
+		"pwsh: $env:",
+		"$env:TARGET = 'it''s'; ",
+		"$env:" + EnvHost + " = 'win'; ",
+		"& './benchctl-",
+		"\n& C:/bench/load.exe --target \"$env:TARGET\"",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected a script containing %q, got:\n%s", want, all)
+		}
+	}
+	if strings.Contains(all, "sh -c") || strings.Contains(all, "export ") {
+		t.Errorf("expected no POSIX shell commands, got:\n%s", all)
+	}
+	if len(recorder.uploads) != 1 || strings.Contains(recorder.uploads[0], "/") || !strings.HasSuffix(recorder.uploads[0], "-warmup.ps1") {
+		t.Errorf("expected the script uploaded to the home directory, got %v", recorder.uploads)
+	}
+}
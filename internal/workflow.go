@@ -2,14 +2,17 @@ package internal
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/luccadibe/benchctl/internal/config"
@@ -21,6 +24,9 @@ import (
 type RunMetadata struct {
 	RunID         string                 `json:"run_id"`
 	BenchmarkName string                 `json:"benchmark_name"`
+	Description   string                 `json:"description,omitempty"`
+	Owner         string                 `json:"owner,omitempty"`
+	Links         []config.Link          `json:"links,omitempty"`
 	StartTime     time.Time              `json:"start_time"`
 	EndTime       time.Time              `json:"end_time"`
 	Config        *config.Config         `json:"config"`
@@ -28,8 +34,55 @@ type RunMetadata struct {
 	Cases         []config.Case          `json:"cases,omitempty"`
 	Custom        map[string]string      `json:"custom,omitempty"`
 	Git           *GitMetadata           `json:"git,omitempty"`
-	Status        string                 `json:"status"`          // "success" or "failed"
-	Error         string                 `json:"error,omitempty"` // empty on success, contains error string on failure
+	CI            *CIMetadata            `json:"ci,omitempty"`
+	CachedStages  []string               `json:"cached_stages,omitempty"` // stages skipped on a cache hit
+	Artifacts     []ArtifactMetadata     `json:"artifacts,omitempty"`
+	Chaos         []ChaosEvent           `json:"chaos,omitempty"` // faults injected during stages
+	Seed          *int64                 `json:"seed,omitempty"`  // seed of the random case order
+	Cooldowns     []CooldownRecord       `json:"cooldowns,omitempty"`
+	Resets        []ResetRecord          `json:"resets,omitempty"`
+	Transfers     []TransferRecord       `json:"transfers,omitempty"` // uploaded scripts and artifacts, collected outputs
+	// Capabilities holds the BENCHCTL_CAP_* variables detected on each stage host.
+	Capabilities map[string]map[string]string `json:"capabilities,omitempty"`
+	// Versions holds the versions of benchmark.capture_versions found on each stage host.
+	Versions map[string]map[string]string `json:"versions,omitempty"`
+	Failures []StageFailure               `json:"failures,omitempty"`
+	Status   string                       `json:"status"`          // "success" or "failed"
+	Error    string                       `json:"error,omitempty"` // empty on success, contains error string on failure
+	// Instances records the cloud instances created for provisioned hosts.
+	Instances []ProvisionedInstance `json:"instances,omitempty"`
+	// Trials records every trial of a run with benchmark.trials, and TrialStats
+	// the numeric metrics across them; Custom holds their means.
+	Trials     []TrialRecord         `json:"trials,omitempty"`
+	TrialStats map[string]TrialStats `json:"trial_stats,omitempty"`
+	// Warmup holds the metrics of warmup stages, which are not run metrics.
+	Warmup map[string]string `json:"warmup,omitempty"`
+	// Stages records when every stage ran, in the order the stages returned.
+	Stages []StageRecord `json:"stages,omitempty"`
+	// Analysis records the inputs of metric derivation and expectation checks,
+	// which benchctl analyze repeats, or completes after benchmark.skip_analysis.
+	Analysis *Analysis `json:"analysis,omitempty"`
+}
+
+// StageError reports the failure of one stage or cleanup step on one host.
+type StageError struct {
+	Kind  string // "stage" or "cleanup"
+	Index int    // index into cfg.Stages or cfg.Cleanup
+	Name  string
+	Host  string
+	Err   error
+}
+
+func newStageError(kind string, index int, name, host string, err error) *StageError {
+	return &StageError{Kind: kind, Index: index, Name: name, Host: host, Err: err}
+}
+
+func (e *StageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
 }
 
 // RunResult describes a completed workflow invocation.
@@ -39,21 +92,28 @@ type RunResult struct {
 	Metadata *RunMetadata
 }
 
-// generateRunID creates a unique run ID as a simple increasing counter
+// generateRunID creates a unique run ID as a simple increasing counter and claims
+// its run directory, so concurrent runs sharing an output directory never collide.
 func generateRunID(outputDir string) (string, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", err
+	}
 	runNum := 1
 	for {
 		runID := fmt.Sprintf("%d", runNum)
-		runDir := filepath.Join(outputDir, runID)
-		if _, err := os.Stat(runDir); os.IsNotExist(err) {
+		err := os.Mkdir(filepath.Join(outputDir, runID), 0755)
+		if err == nil {
 			return runID, nil
 		}
+		if !os.IsExist(err) {
+			return "", err
+		}
 		runNum++
 	}
 }
 
 // RunWorkflow executes a benchmark workflow with run ID tracking.
-func RunWorkflow(ctx context.Context, cfg *config.Config, customMetadata map[string]string, envVars map[string]string) (*RunResult, error) {
+func RunWorkflow(ctx context.Context, cfg *config.Config, customMetadata map[string]string, envVars map[string]string) (_ *RunResult, runErr error) {
 	// Generate run ID and create run directory
 	runID, err := generateRunID(cfg.Benchmark.OutputDir)
 	if err != nil {
@@ -65,15 +125,25 @@ func RunWorkflow(ctx context.Context, cfg *config.Config, customMetadata map[str
 		return nil, fmt.Errorf("create run directory: %w", err)
 	}
 
+	var seed *int64
+	if cfg.Benchmark.Order == "random" {
+		cfg, seed = shuffleCases(cfg)
+	}
+
 	metadata := &RunMetadata{
 		RunID:         runID,
 		BenchmarkName: cfg.Benchmark.Name,
-		StartTime:     time.Now(),
+		Description:   cfg.Benchmark.Description,
+		Owner:         cfg.Benchmark.Owner,
+		Links:         cfg.Benchmark.Links,
+		StartTime:     clockFrom(ctx).Now(),
 		Status:        "success",
 		Config:        cfg,
 		Hosts:         cfg.Hosts,
 		Cases:         cfg.Cases,
 		Custom:        customMetadata,
+		Seed:          seed,
+		Analysis:      &Analysis{Skipped: cfg.Benchmark.SkipAnalysis},
 	}
 
 	result := &RunResult{
@@ -87,10 +157,19 @@ func RunWorkflow(ctx context.Context, cfg *config.Config, customMetadata map[str
 		return result, err
 	}
 	defer closeLogger()
+	ctx = withRunLogger(ctx, logger)
+	ctx, closeConnections := withConnectionPool(ctx)
+	defer closeConnections()
+	ctx, transfers := withTransferLog(ctx)
+	ctx, closeTrace, err := startCommandTrace(ctx, runDir)
+	if err != nil {
+		return result, err
+	}
+	defer closeTrace()
 
-	var runErr error
 	defer func() {
-		metadata.EndTime = time.Now()
+		metadata.EndTime = clockFrom(ctx).Now()
+		metadata.Transfers = transfers.records()
 		if runErr != nil {
 			metadata.Status = "failed"
 			metadata.Error = runErr.Error()
@@ -99,9 +178,30 @@ func RunWorkflow(ctx context.Context, cfg *config.Config, customMetadata map[str
 		if err := saveMetadata(metadata, runDir); err != nil {
 			logError(logger, "save metadata failed", err, "run_id", runID)
 		}
+		if err := appendHistory(cfg.Benchmark.OutputDir, metadata); err != nil {
+			logError(logger, "history append failed", err, "run_id", runID)
+		}
+		if cfg.Benchmark.Influx != nil && runErr == nil {
+			// A sink that is down must not fail a run whose results are stored.
+			if err := WriteInflux(ctx, cfg, metadata, runDir); err != nil {
+				logError(logger, "influx write failed", err, "run_id", runID)
+			} else {
+				logger.Info("results written to influx", "run_id", runID, "bucket", cfg.Benchmark.Influx.Bucket)
+			}
+		}
+		sendWebhooks(ctx, cfg, metadata, runDir, logger)
 	}()
 
 	logger.Info("run started", "run_id", runID, "run_dir", runDir)
+	if metadata.Analysis.skipped() {
+		logger.Info("analysis skipped; run benchctl analyze to derive metrics and check expectations", "run_id", runID)
+	}
+	for _, warning := range config.StageOrderWarnings(cfg) {
+		logger.Warn("stage order warning", "warning", warning)
+	}
+	if seed != nil {
+		logger.Info("case order randomized", "seed", *seed, "cases", caseNames(cfg.Cases))
+	}
 	gitMetadata, err := CaptureGitMetadata(ctx, cfg, runDir)
 	if err != nil {
 		logError(logger, "git metadata capture failed", err, "run_id", runID)
@@ -112,13 +212,47 @@ func RunWorkflow(ctx context.Context, cfg *config.Config, customMetadata map[str
 	if gitMetadata != nil {
 		logger.Info("git metadata captured", "commit", gitMetadata.Commit, "branch", gitMetadata.Branch, "dirty", gitMetadata.Dirty)
 	}
+	metadata.CI = DetectCI()
+	if metadata.CI != nil {
+		logger.Info("ci metadata captured", "provider", metadata.CI.Provider, "job_url", metadata.CI.JobURL, "pull_request", metadata.CI.PullRequest)
+	}
 
-	backgroundMgr := newBackgroundManager(logger)
+	provisioned, instances, teardown, err := provisionHosts(ctx, cfg, runID, logger)
+	metadata.Instances = instances
+	defer func() {
+		// Deleted before the metadata is saved, which records the deletions.
+		if err := teardown(); err != nil {
+			runErr = errors.Join(runErr, err)
+		}
+	}()
+	if err != nil {
+		logError(logger, "provisioning failed", err, "run_id", runID)
+		runErr = err
+		return result, runErr
+	}
+	cfg = provisioned
+	metadata.Hosts = cfg.Hosts
+
+	metadata.Capabilities, err = detectCapabilities(ctx, cfg, logger)
+	if err != nil {
+		logError(logger, "capability detection failed", err, "run_id", runID)
+		runErr = err
+		return result, runErr
+	}
+	metadata.Versions, err = captureVersions(ctx, cfg, logger)
+	if err != nil {
+		logError(logger, "version capture failed", err, "run_id", runID)
+		runErr = err
+		return result, runErr
+	}
 
-	stageErr := executeStages(ctx, cfg, runID, runDir, logger, logWriter, metadata, backgroundMgr, envVars)
-	stopErr := backgroundMgr.StopAll(ctx, runDir)
-	cleanupErr := executeCleanup(ctx, cfg, runID, runDir, logger, logWriter, envVars)
-	joined := errors.Join(stageErr, stopErr, cleanupErr)
+	ctx = withCheckpoints(ctx, runID, runDir, envVars, transfers, logger)
+	saveCheckpoint(ctx, metadata)
+	pipelineErr := executeTrials(ctx, cfg, runID, runDir, logger, logWriter, metadata, envVars)
+	teardownCtx, cancelTeardown := teardownContext(ctx, logger)
+	cleanupErr := executeCleanup(teardownCtx, cfg, runID, runDir, logger, logWriter, envVars)
+	cancelTeardown()
+	joined := errors.Join(pipelineErr, cleanupErr)
 	if joined != nil {
 		logError(logger, "workflow failed", joined, "run_id", runID)
 		runErr = fmt.Errorf("workflow failed: %w", joined)
@@ -129,6 +263,30 @@ func RunWorkflow(ctx context.Context, cfg *config.Config, customMetadata map[str
 	return result, nil
 }
 
+// executePipeline executes the stages of the benchmark into runDir, then stops
+// their background processes and removes their network emulation.
+func executePipeline(
+	ctx context.Context,
+	cfg *config.Config,
+	runID, runDir string,
+	logger *slog.Logger,
+	logWriter io.Writer,
+	metadata *RunMetadata,
+	envVars map[string]string,
+) error {
+	backgroundMgr := newBackgroundManager(logger)
+	backgroundMgr.analysis = metadata.Analysis
+	netemMgr := newNetemManager(logger)
+
+	stageErr := executeStages(ctx, cfg, runID, runDir, logger, logWriter, metadata, backgroundMgr, netemMgr, envVars)
+	teardownCtx, cancelTeardown := teardownContext(ctx, logger)
+	defer cancelTeardown()
+	stopErr := backgroundMgr.StopAll(teardownCtx, runDir)
+	addDerivedMetrics(metadata, backgroundMgr.metrics)
+	netemErr := netemMgr.RemoveAll(teardownCtx)
+	return errors.Join(stageErr, stopErr, netemErr)
+}
+
 // executeStages executes the stages of the benchmark
 // it returns an error if any stage fails,
 // nil if all stages succeed.
@@ -140,118 +298,378 @@ func executeStages(
 	logWriter io.Writer,
 	metadata *RunMetadata,
 	backgroundMgr *backgroundManager,
+	netemMgr *netemManager,
 	envVars map[string]string,
-) error {
+) (err error) {
 	if len(cfg.Stages) == 0 {
 		return nil
 	}
 
+	ctx, watchdog := startWatchdog(ctx, cfg, logger)
+	defer watchdog.Stop()
+	defer func() {
+		// A stage aborted by the watchdog only sees a canceled context; report the
+		// unreachable host instead. Failures collected before it keep their own errors.
+		if watchdogErr := watchdog.Err(); err != nil && watchdogErr != nil {
+			if stageErrs := stageErrors(err); len(stageErrs) > 0 {
+				stageErrs[len(stageErrs)-1].Err = watchdogErr
+			} else {
+				err = watchdogErr
+			}
+		}
+	}()
+
 	consoleSink := resolveConsoleWriter()
 	stdoutSink := consoleSink
 	stderrSink := consoleSink
 	usePTY := consoleSink != nil
 	logStageOutput := consoleSink == nil || !writersReferToSameFD(consoleSink, logWriter)
+	failures := newFailureTracker(cfg, metadata, logger)
+	// Stages of a dependency graph run concurrently and share the run metadata.
+	var metadataMu sync.Mutex
 
-	for _, benchmarkCase := range workflowCases(cfg) {
-		for i, stage := range cfg.Stages {
+	for caseIndex, benchmarkCase := range workflowCases(cfg) {
+		failures.startCase()
+		fanOut := fanOutMetrics{}
+		if caseIndex > 0 && len(cfg.Benchmark.Reset) > 0 {
+			records, err := resetHosts(ctx, cfg, runID, runDir, envVars, benchmarkCase, logger)
+			metadata.Resets = append(metadata.Resets, records...)
+			if err != nil {
+				return failures.abort(err)
+			}
+		}
+		if caseIndex > 0 && cfg.Benchmark.Cooldown != nil {
+			record, err := coolDown(ctx, cfg, benchmarkCase, logger)
+			metadata.Cooldowns = append(metadata.Cooldowns, *record)
+			if err != nil {
+				logError(logger, "cooldown failed", err, "case", benchmarkCase.Name)
+				return failures.abort(err)
+			}
+		}
+		pipes := newStagePipes(cfg.Stages)
+		runStage := func(ctx context.Context, i int, stage config.Stage) (err error) {
 			if stage.Skip {
 				logger.Info("stage skipped", "stage", stage.Name, "case", benchmarkCase.Name, "index", i+1, "total", len(cfg.Stages))
-				continue
+				return nil
 			}
 			if !stageAppliesToCase(stage, benchmarkCase) {
 				logger.Info("stage skipped for case", "stage", stage.Name, "case", benchmarkCase.Name)
-				continue
+				return nil
+			}
+			conditionEnv := buildStageEnv(runID, runDir, cfg, envVars, benchmarkCase, "")
+			maps.Copy(conditionEnv, stageCapabilities(metadata.Capabilities, resolveStageHosts(stage)))
+			metadataMu.Lock()
+			holds, whenErr := stageConditionHolds(stage, conditionEnv, metadata.Custom)
+			metadataMu.Unlock()
+			if whenErr != nil {
+				logError(logger, "stage failed", whenErr, "stage", stage.Name, "case", benchmarkCase.Name)
+				return failures.fail(ctx, newStageError("stage", i, stage.Name, "", whenErr), stage.Name, benchmarkCase.Name, "", 1)
+			}
+			if !holds {
+				logger.Info("stage skipped by condition", "stage", stage.Name, "case", benchmarkCase.Name, "when", stage.When)
+				return nil
+			}
+			startedArgs := []any{"stage", stage.Name, "case", benchmarkCase.Name, "index", i + 1, "total", len(cfg.Stages)}
+			if stage.Description != "" {
+				startedArgs = append(startedArgs, "description", stage.Description)
+			}
+			logger.Info("stage started", startedArgs...)
+			defer watchdog.StartStage(stage.Name, resolveStageHosts(stage))()
+			stageStarted := clockFrom(ctx).Now()
+			defer func() {
+				record := StageRecord{Stage: stage.Name, Case: benchmarkCase.Name, StartedAt: stageStarted, EndedAt: clockFrom(ctx).Now()}
+				if err != nil {
+					record.Error = err.Error()
+				}
+				metadataMu.Lock()
+				recordStage(ctx, metadata, record)
+				metadataMu.Unlock()
+			}()
+			if stage.Type == "build" {
+				var artifacts []ArtifactMetadata
+				attempts, err := failures.run(ctx, stage.Name, "", func() (err error) {
+					artifacts, err = executeBuildStage(ctx, buildStageRun{
+						cfg:           cfg,
+						stage:         stage,
+						benchmarkCase: benchmarkCase,
+						runID:         runID,
+						runDir:        runDir,
+						envVars:       envVars,
+						logger:        logger,
+						console:       consoleSink,
+						logOutput:     logStageOutput,
+					})
+					return err
+				})
+				if err != nil {
+					logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name)
+					return failures.fail(ctx, newStageError("stage", i, stage.Name, "", err), stage.Name, benchmarkCase.Name, "", attempts)
+				}
+				metadataMu.Lock()
+				for _, artifact := range artifacts {
+					metadata.Artifacts = append(metadata.Artifacts, artifact)
+					addRunMetrics(metadata, artifact.metrics())
+				}
+				err = checkStageExpectations(ctx, stage, metadata)
+				metadataMu.Unlock()
+				if err != nil {
+					logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name)
+					return failures.fail(ctx, newStageError("stage", i, stage.Name, "", err), stage.Name, benchmarkCase.Name, "", 1)
+				}
+				logger.Info("stage completed", "stage", stage.Name)
+				return nil
 			}
-			logger.Info("stage started", "stage", stage.Name, "case", benchmarkCase.Name, "index", i+1, "total", len(cfg.Stages))
 			hostAliases := resolveStageHosts(stage)
-			for _, hostAlias := range hostAliases {
+			runOnHost := func(hostAlias string) error {
 				host, ok := cfg.Hosts[hostAlias]
 				if !ok {
 					if hostAlias != "local" {
 						err := fmt.Errorf("stage %s references unknown host %s", stage.Name, hostAlias)
 						logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
-						return err
+						return newStageError("stage", i, stage.Name, hostAlias, err)
 					}
 					host = config.Host{}
 				}
 
-				client, err := openExecutionClient(host)
+				var cacheKey, cachePath string
+				if stage.Cache != nil {
+					key, err := stageCacheKey(cfg, stage, benchmarkCase, hostAlias, envVars)
+					if err != nil {
+						logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
+						return newStageError("stage", i, stage.Name, hostAlias, err)
+					}
+					cacheKey = key
+					cachePath = stageCachePath(cfg.Benchmark.OutputDir, stage, benchmarkCase, hostAlias)
+					if stageCacheHit(cachePath, cacheKey) {
+						logger.Info("stage cached", "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
+						metadataMu.Lock()
+						if !slices.Contains(metadata.CachedStages, stage.Name) {
+							metadata.CachedStages = append(metadata.CachedStages, stage.Name)
+						}
+						metadataMu.Unlock()
+						return nil
+					}
+				}
+
+				client, err := openExecutionClient(ctx, host)
 				if err != nil {
 					err = fmt.Errorf("error creating execution client for stage %s: %w", stage.Name, err)
 					logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
-					return err
+					return newStageError("stage", i, stage.Name, hostAlias, err)
 				}
 
-				commandBody, err := prepareStageCommand(ctx, stage, host, runID, client)
+				commandBody, err := prepareStageCommand(ctx, stage, host, runID, client, logger)
 				if err != nil {
 					_ = client.Close()
 					logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
-					return err
+					return newStageError("stage", i, stage.Name, hostAlias, err)
 				}
 
-				commandBody = wrapWithShell(commandBody, resolveStageShell(cfg, stage))
+				commandBody = hostShellCommand(host, commandBody, resolveStageShell(cfg, stage, hostAlias))
 
 				stageEnv := buildStageEnv(runID, runDir, cfg, envVars, benchmarkCase, hostAlias)
-				envPrefix := envPrefixFromMap(stageEnv)
+				maps.Copy(stageEnv, metadata.Capabilities[hostAlias])
+				envPrefix := hostEnvPrefix(host, stageEnv)
+
+				if err := uploadStageFiles(ctx, client, host, stage, stageEnv, logger); err != nil {
+					_ = client.Close()
+					logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
+					return newStageError("stage", i, stage.Name, hostAlias, err)
+				}
+
+				var becomePassword string
+				if stage.Become {
+					becomePassword, err = checkBecome(ctx, client, stage, host, hostAlias)
+					if err != nil {
+						_ = client.Close()
+						logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
+						return newStageError("stage", i, stage.Name, hostAlias, err)
+					}
+					commandBody = becomeCommand(commandBody, stage, stageEnv, becomePassword != "")
+				}
+				if stage.Duration != "" {
+					duration, _ := time.ParseDuration(stage.Duration)
+					commandBody = timeBoxCommand(commandBody, stage, duration)
+				}
+
+				if err := netemMgr.Apply(ctx, client, stage, hostAlias, host); err != nil {
+					_ = client.Close()
+					logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
+					return newStageError("stage", i, stage.Name, hostAlias, err)
+				}
 
+				startedAt := clockFrom(ctx).Now()
 				if stage.Background {
 					pid, err := startBackgroundStage(ctx, client, envPrefix, commandBody, stage)
 					_ = client.Close()
 					if err != nil {
 						logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
-						return err
+						return newStageError("stage", i, stage.Name, hostAlias, err)
 					}
-					backgroundMgr.Add(backgroundStage{stage: stage, host: host, outputEnv: stageEnv, pid: pid})
+					backgroundMgr.Add(backgroundStage{stage: stage, host: host, outputEnv: stageEnv, pid: pid, startedAt: startedAt})
 					logger.Info("stage running in background", "stage", stage.Name)
-					continue
+					return nil
 				}
 
-				result, err := client.RunCommand(ctx, execution.CommandRequest{
+				stdout, stderr, throttle := throttleConsole(stage, stdoutSink, stderrSink)
+				request := execution.CommandRequest{
 					Command: envPrefix + commandBody,
-					Stdout:  stdoutSink,
-					Stderr:  stderrSink,
+					Stdout:  stdout,
+					Stderr:  stderr,
 					UsePTY:  usePTY,
-				})
+				}
+				if becomePassword != "" {
+					// sudo reads the password from stdin; a PTY would echo it.
+					request.Stdin = strings.NewReader(becomePassword + "\n")
+					request.UsePTY = false
+				}
+				pipes.connect(stage.Name, &request)
+				runner := client
+				if stage.Runtime == "docker" {
+					runner = execution.NewDockerClient(client, execution.DockerOptions{
+						Image:   stage.Container.Image,
+						Mounts:  stage.Container.Mounts,
+						Network: stage.Container.Network,
+					})
+				}
+				run := runner.RunCommand
+				if stage.Session != nil {
+					run = sessionRunner(runner, stage.Session, logger)
+				}
+				commandCtx, cancelCommand := pipes.commandContext(ctx, stage.Name)
+				result, err := run(commandCtx, request)
+				cancelCommand()
+				throttle.Flush()
 				if err == nil && result.ExitCode != 0 {
 					err = fmt.Errorf("command exited with code %d", result.ExitCode)
 				}
+				if err != nil && pipes.stoppedByConsumer(stage.Name) {
+					logger.Info("stage stopped after its consumer finished", "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
+					err = nil
+				}
 				if err != nil {
-					if logStageOutput && strings.TrimSpace(result.Output) != "" {
+					if (logStageOutput || throttle != nil) && strings.TrimSpace(result.Output) != "" {
 						logger.Info("stage captured output", "stage", stage.Name, "output", result.Output)
 					}
+					snapshotFailedStage(ctx, client, runDir, stage, benchmarkCase, hostAlias, stageEnv, result.Output, logger)
 					_ = client.Close()
 					stageErr := fmt.Errorf("stage %s failed: %w (exit code: %d)", stage.Name, err, result.ExitCode)
 					logError(logger, "stage failed", stageErr, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias, "exit_code", result.ExitCode)
-					return stageErr
+					return newStageError("stage", i, stage.Name, hostAlias, stageErr)
+				}
+				if err := netemMgr.Remove(ctx, client, stage.Name, hostAlias); err != nil {
+					_ = client.Close()
+					return newStageError("stage", i, stage.Name, hostAlias, err)
 				}
 
-				if logStageOutput {
+				// Output dropped from a throttled console must still reach the log.
+				if logStageOutput || throttle != nil {
 					logger.Info("stage output", "stage", stage.Name, "output", result.Output)
 				}
 				logger.Info("stage completed", "stage", stage.Name, "exit_code", result.ExitCode)
+				if len(stage.MetricsFromOutput) > 0 && metadata.Analysis != nil && !stage.Warmup {
+					input, err := saveConsoleOutput(runDir, stage, benchmarkCase, hostAlias, result.Output)
+					if err != nil {
+						_ = client.Close()
+						logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
+						return newStageError("stage", i, stage.Name, hostAlias, err)
+					}
+					metadataMu.Lock()
+					metadata.Analysis.Inputs = append(metadata.Analysis.Inputs, input)
+					metadataMu.Unlock()
+				}
+				if !metadata.Analysis.skipped() {
+					scraped := scrapeOutputMetrics(stage, result.Output, logger)
+					metadataMu.Lock()
+					addStageMetrics(metadata, stage, fanOut.add(stage, hostAliases, hostAlias, scraped))
+					metadataMu.Unlock()
+				}
 
 				if stage.HealthCheck != nil {
 					if err := runHealthCheck(ctx, client, stage, logger); err != nil {
+						snapshotFailedStage(ctx, client, runDir, stage, benchmarkCase, hostAlias, stageEnv, result.Output, logger)
 						_ = client.Close()
 						logError(logger, "health check failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
-						return err
+						return newStageError("stage", i, stage.Name, hostAlias, err)
 					}
 				}
 
 				if len(stage.Outputs) > 0 {
-					if err := collectStageOutputs(ctx, client, runDir, stage, logger, stageEnv); err != nil {
+					outputDir := stageOutputDir(runDir, stage)
+					collected, err := collectStageOutputs(ctx, client, outputDir, stage, logger, stageEnv, startedAt)
+					metadataMu.Lock()
+					if !stage.Warmup {
+						metadata.Analysis.addOutputs(stage, collected)
+					}
+					metadataMu.Unlock()
+					if !metadata.Analysis.skipped() {
+						metrics, parseErr := outputMetrics(outputDir, stage, collected, logger)
+						err = errors.Join(err, parseErr)
+						metadataMu.Lock()
+						addStageMetrics(metadata, stage, metrics)
+						metadataMu.Unlock()
+					}
+					if err != nil {
 						_ = client.Close()
 						logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
-						return err
+						return newStageError("stage", i, stage.Name, hostAlias, err)
+					}
+				}
+
+				if cachePath != "" {
+					if err := writeStageCache(cachePath, cacheKey); err != nil {
+						logger.Warn("stage cache not updated", "stage", stage.Name, "error", err)
 					}
 				}
 
 				_ = client.Close()
+				return nil
+			}
+			// Chaos runs once per stage, timed from its start, while the stage
+			// command runs on each of its hosts.
+			chaos := startChaos(ctx, cfg, stage, benchmarkCase, logger)
+			err = func() error {
+				for _, hostAlias := range hostAliases {
+					if failures.hostFailed(hostAlias) {
+						logger.Warn("stage skipped on failed host", "stage", stage.Name, "case", benchmarkCase.Name, "host", hostAlias)
+						continue
+					}
+					attempts, err := failures.run(ctx, stage.Name, hostAlias, func() error { return runOnHost(hostAlias) })
+					if err != nil {
+						if err := failures.fail(ctx, err, stage.Name, benchmarkCase.Name, hostAlias, attempts); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			}()
+			chaosEvents, chaosErr := chaos.Stop()
+			metadataMu.Lock()
+			metadata.Chaos = append(metadata.Chaos, chaosEvents...)
+			metadataMu.Unlock()
+			if err != nil {
+				return err
 			}
+			if chaosErr != nil {
+				return failures.fail(ctx, newStageError("stage", i, stage.Name, "", chaosErr), stage.Name, benchmarkCase.Name, "", 1)
+			}
+			metadataMu.Lock()
+			err = checkStageExpectations(ctx, stage, metadata)
+			metadataMu.Unlock()
+			if err != nil {
+				logError(logger, "stage failed", err, "stage", stage.Name, "case", benchmarkCase.Name)
+				return failures.fail(ctx, newStageError("stage", i, stage.Name, "", err), stage.Name, benchmarkCase.Name, "", 1)
+			}
+			return nil
+		}
+		err := runCaseStages(ctx, cfg.Stages, benchmarkCase, logger, pipes.wrap(runStage))
+		pipes.close()
+		if err != nil {
+			return err
 		}
 	}
 
-	return nil
+	return failures.Err()
 }
 
 // executeCleanup runs workflow cleanup steps after all stages finish, even on stage failure.
@@ -282,28 +700,28 @@ func executeCleanup(
 				if hostAlias != "local" {
 					err := fmt.Errorf("cleanup %s references unknown host %s", step.Name, hostAlias)
 					logError(logger, "cleanup failed", err, "cleanup", step.Name, "host", hostAlias)
-					return err
+					return newStageError("cleanup", i, step.Name, hostAlias, err)
 				}
 				host = config.Host{}
 			}
 
-			client, err := openExecutionClient(host)
+			client, err := openExecutionClient(ctx, host)
 			if err != nil {
 				err = fmt.Errorf("error creating execution client for cleanup %s: %w", step.Name, err)
 				logError(logger, "cleanup failed", err, "cleanup", step.Name, "host", hostAlias)
-				return err
+				return newStageError("cleanup", i, step.Name, hostAlias, err)
 			}
 
-			commandBody, err := prepareNamedCommand(ctx, step.Name, step.Command, step.Script, host, runID, client, "cleanup")
+			commandBody, err := prepareNamedCommand(ctx, step.Name, step.Command, step.Script, host, runID, client, "cleanup", logger)
 			if err != nil {
 				_ = client.Close()
 				logError(logger, "cleanup failed", err, "cleanup", step.Name, "host", hostAlias)
-				return err
+				return newStageError("cleanup", i, step.Name, hostAlias, err)
 			}
 
-			commandBody = wrapWithShell(commandBody, resolveCleanupShell(cfg, step))
+			commandBody = hostShellCommand(host, commandBody, resolveCleanupShell(cfg, step, hostAlias))
 			stepEnv := buildStageEnv(runID, runDir, cfg, envVars, config.Case{}, hostAlias)
-			envPrefix := envPrefixFromMap(stepEnv)
+			envPrefix := hostEnvPrefix(host, stepEnv)
 
 			result, err := client.RunCommand(ctx, execution.CommandRequest{
 				Command: envPrefix + commandBody,
@@ -321,7 +739,7 @@ func executeCleanup(
 				_ = client.Close()
 				cleanupErr := fmt.Errorf("cleanup %s failed: %w (exit code: %d)", step.Name, err, result.ExitCode)
 				logError(logger, "cleanup failed", cleanupErr, "cleanup", step.Name, "host", hostAlias, "exit_code", result.ExitCode)
-				return cleanupErr
+				return newStageError("cleanup", i, step.Name, hostAlias, cleanupErr)
 			}
 
 			if logStepOutput {
@@ -342,10 +760,68 @@ func workflowCases(cfg *config.Config) []config.Case {
 	return cfg.Cases
 }
 
+// shuffleCases returns a copy of cfg with its cases in a random order and the seed used.
+func shuffleCases(cfg *config.Config) (*config.Config, *int64) {
+	seed := OrderSeed(cfg)
+	shuffled := cfg.Clone()
+	shuffleSeeded(shuffled.Cases, seed)
+	return shuffled, &seed
+}
+
+// OrderSeed returns benchmark.seed, or a new seed when it is unset.
+func OrderSeed(cfg *config.Config) int64 {
+	if cfg.Benchmark.Seed != nil {
+		return *cfg.Benchmark.Seed
+	}
+	return time.Now().UnixNano()
+}
+
+// ShuffleCombinations puts matrix combinations in the random order given by seed,
+// as benchmark.order random does with cases.
+func ShuffleCombinations(combinations []map[string]string, seed int64) {
+	shuffleSeeded(combinations, seed)
+}
+
+func shuffleSeeded[T any](items []T, seed int64) {
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
+	rng.Shuffle(len(items), func(i, j int) {
+		items[i], items[j] = items[j], items[i]
+	})
+}
+
+func caseNames(cases []config.Case) []string {
+	names := make([]string, 0, len(cases))
+	for _, benchmarkCase := range cases {
+		names = append(names, benchmarkCase.Name)
+	}
+	return names
+}
+
 func stageAppliesToCase(stage config.Stage, benchmarkCase config.Case) bool {
 	return strings.TrimSpace(stage.ExecuteOnlyFor) == "" || stage.ExecuteOnlyFor == benchmarkCase.Name
 }
 
+// stageConditionHolds evaluates the when condition of a stage. References resolve
+// against env first, then custom run metadata, then the environment of benchctl.
+func stageConditionHolds(stage config.Stage, env, custom map[string]string) (bool, error) {
+	if strings.TrimSpace(stage.When) == "" {
+		return true, nil
+	}
+	condition, err := config.ParseCondition(stage.When)
+	if err != nil {
+		return false, fmt.Errorf("stage %s: %w", stage.Name, err)
+	}
+	return condition.Holds(func(name string) (string, bool) {
+		if value, ok := env[name]; ok {
+			return value, true
+		}
+		if value, ok := custom[name]; ok {
+			return value, true
+		}
+		return os.LookupEnv(name)
+	}), nil
+}
+
 func resolveStageHosts(stage config.Stage) []string {
 	return resolveCommandHosts(stage.Host, stage.Hosts)
 }
@@ -360,11 +836,11 @@ func resolveCommandHosts(host string, hosts []string) []string {
 	return []string{"local"}
 }
 
-func prepareStageCommand(ctx context.Context, stage config.Stage, host config.Host, runID string, client execution.ExecutionClient) (string, error) {
-	return prepareNamedCommand(ctx, stage.Name, stage.Command, stage.Script, host, runID, client, "stage")
+func prepareStageCommand(ctx context.Context, stage config.Stage, host config.Host, runID string, client execution.ExecutionClient, logger *slog.Logger) (string, error) {
+	return prepareNamedCommand(ctx, stage.Name, stage.Command, stage.Script, host, runID, client, "stage", logger)
 }
 
-func prepareNamedCommand(ctx context.Context, name, command, script string, host config.Host, runID string, client execution.ExecutionClient, kind string) (string, error) {
+func prepareNamedCommand(ctx context.Context, name, command, script string, host config.Host, runID string, client execution.ExecutionClient, kind string, logger *slog.Logger) (string, error) {
 	if strings.TrimSpace(command) != "" {
 		return command, nil
 	}
@@ -372,7 +848,7 @@ func prepareNamedCommand(ctx context.Context, name, command, script string, host
 		return "", fmt.Errorf("%s %s has no command or script", kind, name)
 	}
 
-	if strings.TrimSpace(host.IP) == "" {
+	if isLocalHost(host) {
 		return fmt.Sprintf("bash ./%s", script), nil
 	}
 
@@ -383,9 +859,18 @@ func prepareNamedCommand(ctx context.Context, name, command, script string, host
 		}
 	}
 	remoteScriptPath := filepath.Join("/tmp", fmt.Sprintf("benchctl-%s-%s", runID, filepath.Base(localScriptPath)))
-	if err := client.Upload(ctx, localScriptPath, remoteScriptPath); err != nil {
+	if isWindowsHost(host) {
+		remoteScriptPath = fmt.Sprintf("benchctl-%s-%s", runID, filepath.Base(localScriptPath))
+	}
+	err := retryTransfer(ctx, logger, "script "+filepath.Base(localScriptPath), func(ctx context.Context) error {
+		return client.Upload(ctx, localScriptPath, remoteScriptPath)
+	})
+	if err != nil {
 		return "", fmt.Errorf("failed to upload script for %s %s: %w", kind, name, err)
 	}
+	if isWindowsHost(host) {
+		return windowsScriptCommand(remoteScriptPath), nil
+	}
 	return fmt.Sprintf("chmod +x '%s' && bash '%s'", remoteScriptPath, remoteScriptPath), nil
 }
 
@@ -506,12 +991,8 @@ func createLogger(cfg *config.Config, runDir string) (*slog.Logger, io.Writer, f
 
 // saveMetadata saves the metadata to a file
 func saveMetadata(metadata *RunMetadata, runDir string) error {
-	metadataPath := filepath.Join(runDir, "metadata.json")
-	metadataBytes, err := json.MarshalIndent(metadata, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %v", err)
-	}
-	if err := os.WriteFile(metadataPath, metadataBytes, 0644); err != nil {
+	store, runID := localRun(runDir)
+	if err := store.SaveMetadata(context.Background(), runID, metadata); err != nil {
 		return fmt.Errorf("failed to save metadata: %v", err)
 	}
 	return nil
@@ -535,22 +1016,49 @@ func writersReferToSameFD(a, b io.Writer) bool {
 	return false
 }
 
-func resolveStageShell(cfg *config.Config, stage config.Stage) string {
-	return resolveItemShell(cfg.Benchmark.Shell, stage.Shell)
+// shellCommands are the invocations of the shells that may be named by themselves
+// in a shell setting.
+var shellCommands = map[string]string{
+	"bash": "bash -lic",
+	"sh":   "sh -c",
+	"zsh":  "zsh -lic",
+	"pwsh": "pwsh -NoLogo -NonInteractive -Command",
 }
 
-func resolveCleanupShell(cfg *config.Config, step config.Cleanup) string {
-	return resolveItemShell(cfg.Benchmark.Shell, step.Shell)
+// resolveStageShell returns the shell of a stage on a host. The host and benchmark
+// shells do not apply inside a container, where the stage runs with sh unless it
+// sets its own shell.
+func resolveStageShell(cfg *config.Config, stage config.Stage, hostAlias string) string {
+	if stage.Runtime == "docker" && strings.TrimSpace(stage.Shell) == "" {
+		return "sh"
+	}
+	return resolveItemShell(cfg, hostAlias, stage.Shell)
 }
 
-func resolveItemShell(benchmarkShell, itemShell string) string {
+func resolveCleanupShell(cfg *config.Config, step config.Cleanup, hostAlias string) string {
+	return resolveItemShell(cfg, hostAlias, step.Shell)
+}
+
+// resolveItemShell returns the shell command of a stage, cleanup step, or reset
+// hook on a host: its own shell, else the shell of the host, else sh on kubernetes
+// hosts, whose images rarely ship bash, else benchmark.shell.
+func resolveItemShell(cfg *config.Config, hostAlias, itemShell string) string {
 	shell := strings.TrimSpace(itemShell)
 	if shell == "" {
-		shell = strings.TrimSpace(benchmarkShell)
+		shell = strings.TrimSpace(cfg.Hosts[hostAlias].Shell)
+	}
+	if shell == "" && cfg.Hosts[hostAlias].Type == "kubernetes" {
+		shell = "sh"
+	}
+	if shell == "" {
+		shell = strings.TrimSpace(cfg.Benchmark.Shell)
 	}
 	if shell == "" {
 		shell = DefaultShell
 	}
+	if command, ok := shellCommands[shell]; ok {
+		return command
+	}
 	return shell
 }
 
@@ -562,3 +1070,23 @@ func wrapWithShell(command, shell string) string {
 	return fmt.Sprintf("%s %s", shell, shellQuote(command))
 }
 
+// checkStageExpectations records that stage ran and checks its expectations,
+// unless the run skips analysis or is in a warmup trial.
+func checkStageExpectations(ctx context.Context, stage config.Stage, metadata *RunMetadata) error {
+	metadata.Analysis.addStage(stage)
+	if metadata.Analysis.skipped() || inWarmupTrial(ctx) {
+		return nil
+	}
+	return checkExpectations(stage, metadata)
+}
+
+// addRunMetrics records metrics derived during the run in the custom metadata.
+func addRunMetrics(metadata *RunMetadata, metrics map[string]string) {
+	if len(metrics) == 0 {
+		return
+	}
+	if metadata.Custom == nil {
+		metadata.Custom = map[string]string{}
+	}
+	maps.Copy(metadata.Custom, metrics)
+}
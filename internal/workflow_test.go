@@ -52,7 +52,7 @@ func TestExecuteStagesFailsFastAcrossHosts(t *testing.T) {
 	backgroundMgr := newBackgroundManager(logger)
 	ctx := context.Background()
 
-	err := executeStages(ctx, cfg, "1", runDir, logger, io.Discard, metadata, backgroundMgr, nil)
+	err := executeStages(ctx, cfg, "1", runDir, logger, io.Discard, metadata, backgroundMgr, newNetemManager(logger), nil)
 	if err == nil {
 		t.Fatalf("expected executeStages to fail on second host")
 	}
@@ -108,7 +108,7 @@ func TestExecuteStagesSkipsMarkedStage(t *testing.T) {
 	backgroundMgr := newBackgroundManager(logger)
 	ctx := context.Background()
 
-	err := executeStages(ctx, cfg, "1", runDir, logger, io.Discard, metadata, backgroundMgr, nil)
+	err := executeStages(ctx, cfg, "1", runDir, logger, io.Discard, metadata, backgroundMgr, newNetemManager(logger), nil)
 	if err != nil {
 		t.Fatalf("unexpected error executing stages: %v", err)
 	}
@@ -147,7 +147,7 @@ func TestExecuteStagesRunsCasesWithEnv(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	backgroundMgr := newBackgroundManager(logger)
 
-	if err := executeStages(context.Background(), cfg, "1", runDir, logger, io.Discard, metadata, backgroundMgr, nil); err != nil {
+	if err := executeStages(context.Background(), cfg, "1", runDir, logger, io.Discard, metadata, backgroundMgr, newNetemManager(logger), nil); err != nil {
 		t.Fatalf("unexpected error executing stages: %v", err)
 	}
 
@@ -165,3 +165,136 @@ func TestExecuteStagesRunsCasesWithEnv(t *testing.T) {
 		t.Fatalf("execute_only_for stage ran for wrong case: %q", got)
 	}
 }
+
+func TestExecuteStagesEvaluatesWhenConditions(t *testing.T) {
+	tempDir := t.TempDir()
+	runDir := filepath.Join(tempDir, "run")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatalf("failed to create run dir: %v", err)
+	}
+
+	outputPath := filepath.Join(tempDir, "when.txt")
+	record := func(name string) string {
+		return "echo " + name + " >> '" + outputPath + "'"
+	}
+	t.Setenv("BENCHCTL_TEST_PROFILE", "true")
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Name: "when", OutputDir: runDir},
+		Hosts:     map[string]config.Host{"local": {}},
+		Cases: []config.Case{
+			{Name: "a", Env: map[string]string{"ENGINE": "postgres"}},
+			{Name: "b", Env: map[string]string{"ENGINE": "mysql"}},
+		},
+		Stages: []config.Stage{
+			{Name: "case-env", When: "$ENGINE == postgres", Command: record("case-env:$BENCHCTL_CASE_NAME")},
+			{Name: "cli-env", When: "${TARGET} != 'prod'", Command: record("cli-env:$BENCHCTL_CASE_NAME")},
+			{Name: "metadata", When: "${ticket} && !$BENCHCTL_TEST_UNSET", Command: record("metadata:$BENCHCTL_CASE_NAME")},
+			{Name: "process-env", When: "${BENCHCTL_TEST_PROFILE}", Command: record("process-env:$BENCHCTL_CASE_NAME")},
+			{Name: "never", When: "${ticket} == PERF-1 || $TARGET == prod", Command: record("never")},
+		},
+	}
+
+	metadata := &RunMetadata{RunID: "1", BenchmarkName: "when", Hosts: cfg.Hosts, Custom: map[string]string{"ticket": "PERF-12"}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	envVars := map[string]string{"TARGET": "staging"}
+
+	if err := executeStages(context.Background(), cfg, "1", runDir, logger, io.Discard, metadata, newBackgroundManager(logger), newNetemManager(logger), envVars); err != nil {
+		t.Fatalf("unexpected error executing stages: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	want := "case-env:a\ncli-env:a\nmetadata:a\nprocess-env:a\ncli-env:b\nmetadata:b\nprocess-env:b\n"
+	if string(data) != want {
+		t.Fatalf("executed stages = %q, want %q", data, want)
+	}
+}
+
+func TestShuffleCasesIsReproducibleAndDoesNotMutateConfig(t *testing.T) {
+	seed := int64(7)
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Order: "random", Seed: &seed},
+		Cases:     []config.Case{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}},
+	}
+
+	first, firstSeed := shuffleCases(cfg)
+	second, _ := shuffleCases(cfg)
+	if *firstSeed != seed {
+		t.Fatalf("expected configured seed to be used, got %d", *firstSeed)
+	}
+	if got, want := strings.Join(caseNames(first.Cases), ","), strings.Join(caseNames(second.Cases), ","); got != want {
+		t.Fatalf("expected the same order for the same seed, got %s and %s", got, want)
+	}
+	if got := strings.Join(caseNames(cfg.Cases), ","); got != "a,b,c,d,e" {
+		t.Fatalf("expected original config order to be preserved, got %s", got)
+	}
+}
+
+func TestResolveItemShell(t *testing.T) {
+	cfg := &config.Config{
+		Benchmark: config.Benchmark{Shell: "sh"},
+		Hosts: map[string]config.Host{
+			"windows": {IP: "10.0.0.2", Shell: "pwsh"},
+			"custom":  {IP: "10.0.0.3", Shell: "bash -c"},
+			"pod":     {Type: "kubernetes", Kubernetes: &config.KubernetesHost{Pod: "server-0"}},
+		},
+	}
+	tests := []struct {
+		host, itemShell, want string
+	}{
+		{host: "local", want: "sh -c"},
+		{host: "windows", want: "pwsh -NoLogo -NonInteractive -Command"},
+		{host: "custom", want: "bash -c"},
+		{host: "custom", itemShell: "zsh", want: "zsh -lic"},
+		{host: "pod", want: "sh -c"},
+	}
+	for _, tt := range tests {
+		if got := resolveItemShell(cfg, tt.host, tt.itemShell); got != tt.want {
+			t.Fatalf("resolveItemShell(%s, %q) = %q, want %q", tt.host, tt.itemShell, got, tt.want)
+		}
+	}
+	if got := resolveItemShell(&config.Config{}, "local", ""); got != DefaultShell {
+		t.Fatalf("expected the default shell, got %q", got)
+	}
+	if got := resolveItemShell(&config.Config{Hosts: cfg.Hosts}, "pod", ""); got != "sh -c" {
+		t.Fatalf("expected kubernetes hosts to default to sh, got %q", got)
+	}
+}
+
+func TestEnvironmentFlagBeatsUndeclaredPlaceholders(t *testing.T) {
+	t.Setenv("THREADS", "2")
+	t.Setenv("API_TOKEN", "s3cr3t")
+	data, err := config.ApplyVars([]byte(`benchmark:
+  name: vars
+  output_dir: `+t.TempDir()+`
+stages:
+  - name: load
+    command: echo "threads=${THREADS} token=${#API_TOKEN}"
+    metrics_from_output:
+      - name: threads
+        pattern: threads=(\d+)
+`), nil)
+	if err != nil {
+		t.Fatalf("ApplyVars: %v", err)
+	}
+	cfg, err := config.ParseYAML(data)
+	if err != nil {
+		t.Fatalf("ParseYAML: %v", err)
+	}
+	result, err := RunWorkflow(context.Background(), cfg, nil, map[string]string{"THREADS": "8"})
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if got := result.Metadata.Custom["threads"]; got != "8" {
+		t.Fatalf("threads = %q, want the -e value 8", got)
+	}
+	metadata, err := os.ReadFile(filepath.Join(result.RunDir, "metadata.json"))
+	if err != nil {
+		t.Fatalf("read metadata: %v", err)
+	}
+	if strings.Contains(string(metadata), "s3cr3t") {
+		t.Fatalf("metadata.json records the environment of benchctl:\n%s", metadata)
+	}
+}
@@ -4,22 +4,37 @@ package bench
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/luccadibe/benchctl/internal/config"
 )
 
 type (
-	Config        = config.Config
-	Benchmark     = config.Benchmark
-	LoggingConfig = config.LoggingConfig
-	GitConfig     = config.GitConfig
-	SyncConfig    = config.SyncConfig
-	HostConfig    = config.Host
-	Case          = config.Case
-	StageConfig   = config.Stage
-	CleanupConfig = config.Cleanup
-	HealthConfig  = config.HealthCheck
-	OutputConfig  = config.Output
+	Config         = config.Config
+	Benchmark      = config.Benchmark
+	LoggingConfig  = config.LoggingConfig
+	GitConfig      = config.GitConfig
+	SyncConfig     = config.SyncConfig
+	InfluxConfig   = config.InfluxConfig
+	WebhookConfig  = config.Webhook
+	Link           = config.Link
+	HostConfig     = config.Host
+	SSHOptions     = config.SSHOptions
+	KubernetesHost = config.KubernetesHost
+	TerraformHosts = config.TerraformHosts
+	Case           = config.Case
+	StageConfig    = config.Stage
+	CacheConfig    = config.StageCache
+	ArtifactConfig = config.Artifact
+	NetemConfig    = config.Netem
+	ChaosConfig    = config.ChaosAction
+	CleanupConfig  = config.Cleanup
+	HealthConfig   = config.HealthCheck
+	OutputConfig   = config.Output
+	SessionConfig  = config.Session
+	SessionStep    = config.SessionStep
+	// MetricComparison is a benchmark.compare rule.
+	MetricComparison = config.MetricComparison
 )
 
 // Bench is a benchmark definition that can be run one or more times.
@@ -44,8 +59,22 @@ func FromConfig(cfg *Config) *Bench {
 	return &Bench{cfg: cfg}
 }
 
-// FromYAML loads a benchmark definition from YAML bytes.
+// FromYAML loads a benchmark definition from YAML bytes, substituting its vars.
 func FromYAML(data []byte) (*Bench, error) {
+	return FromYAMLWithVars(data, nil)
+}
+
+// FromYAMLWithVars loads a benchmark definition from YAML bytes. vars take
+// precedence over the vars section and environment variables of the same name.
+func FromYAMLWithVars(data []byte, vars map[string]string) (*Bench, error) {
+	data, err := config.ApplyProfiles(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err = config.ApplyVars(data, vars)
+	if err != nil {
+		return nil, err
+	}
 	cfg, err := config.ParseYAML(data)
 	if err != nil {
 		return nil, err
@@ -53,13 +82,19 @@ func FromYAML(data []byte) (*Bench, error) {
 	return &Bench{cfg: cfg}, nil
 }
 
-// FromFile loads a benchmark definition from a YAML file.
+// FromFile loads a benchmark definition from a YAML file. Relative cache inputs
+// resolve against the directory of the file.
 func FromFile(path string) (*Bench, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	return FromYAML(data)
+	b, err := FromYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	config.ResolveCacheInputs(b.cfg, filepath.Dir(path))
+	return b, nil
 }
 
 // Config returns the underlying validated config shape used by YAML workflows.
@@ -78,6 +113,16 @@ func (b *Bench) Validate() error {
 	return b.cfg.Validate()
 }
 
+// Warnings returns the problems of a valid benchmark definition that do not stop
+// it from running, such as a stage reading a file of the run directory before
+// the stage collecting it has run. Runs log them before the first stage.
+func (b *Bench) Warnings() []string {
+	if b == nil || b.cfg == nil {
+		return nil
+	}
+	return config.StageOrderWarnings(b.cfg)
+}
+
 // WithResultsPath sets benchmark.output_dir.
 func WithResultsPath(path string) Option {
 	return func(cfg *config.Config) {
@@ -85,6 +130,27 @@ func WithResultsPath(path string) Option {
 	}
 }
 
+// WithDescription sets benchmark.description.
+func WithDescription(description string) Option {
+	return func(cfg *config.Config) {
+		cfg.Benchmark.Description = description
+	}
+}
+
+// WithOwner sets benchmark.owner.
+func WithOwner(owner string) Option {
+	return func(cfg *config.Config) {
+		cfg.Benchmark.Owner = owner
+	}
+}
+
+// WithLink adds a named entry to benchmark.links.
+func WithLink(name, url string) Option {
+	return func(cfg *config.Config) {
+		cfg.Benchmark.Links = append(cfg.Benchmark.Links, config.Link{Name: name, URL: url})
+	}
+}
+
 // WithShell sets the default shell for stages.
 func WithShell(shell string) Option {
 	return func(cfg *config.Config) {
@@ -113,6 +179,27 @@ func WithSync(sync SyncConfig) Option {
 	}
 }
 
+// WithWebhook adds an endpoint that receives a signed JSON summary of every run.
+func WithWebhook(webhook WebhookConfig) Option {
+	return func(cfg *config.Config) {
+		cfg.Benchmark.Webhooks = append(cfg.Benchmark.Webhooks, webhook)
+	}
+}
+
+// WithComparison adds a rule deciding how compare judges the metrics it matches.
+func WithComparison(rule MetricComparison) Option {
+	return func(cfg *config.Config) {
+		cfg.Benchmark.Compare = append(cfg.Benchmark.Compare, rule)
+	}
+}
+
+// WithInflux sets the InfluxDB results sink configuration.
+func WithInflux(influx InfluxConfig) Option {
+	return func(cfg *config.Config) {
+		cfg.Benchmark.Influx = &influx
+	}
+}
+
 // WithHost adds or replaces a host alias.
 func WithHost(alias string, host HostConfig) Option {
 	return func(cfg *config.Config) {
@@ -123,6 +210,32 @@ func WithHost(alias string, host HostConfig) Option {
 	}
 }
 
+// WithHostGroup adds a host group that stage Hosts can name instead of its members.
+func WithHostGroup(name string, aliases ...string) Option {
+	return func(cfg *config.Config) {
+		if cfg.HostGroups == nil {
+			cfg.HostGroups = map[string][]string{}
+		}
+		cfg.HostGroups[name] = append([]string(nil), aliases...)
+	}
+}
+
+// WithHostsFrom imports the hosts of an Ansible inventory, with its groups as host
+// groups. Hosts added with WithHost take precedence.
+func WithHostsFrom(path string) Option {
+	return func(cfg *config.Config) {
+		cfg.HostsFrom = path
+	}
+}
+
+// WithTerraformHosts imports hosts whose addresses are Terraform outputs. Hosts
+// added with WithHost take precedence.
+func WithTerraformHosts(tf TerraformHosts) Option {
+	return func(cfg *config.Config) {
+		cfg.HostsFromTerraform = &tf
+	}
+}
+
 // WithCases replaces the benchmark cases.
 func WithCases(cases ...Case) Option {
 	return func(cfg *config.Config) {
@@ -130,6 +243,14 @@ func WithCases(cases ...Case) Option {
 	}
 }
 
+// WithParameter adds a matrix parameter; run.RunMatrix executes one run per
+// combination of all parameter values.
+func WithParameter(name string, values ...string) Option {
+	return func(cfg *config.Config) {
+		cfg.Matrix = append(cfg.Matrix, config.Parameter{Name: name, Values: append([]string(nil), values...)})
+	}
+}
+
 // WithStages replaces the benchmark stage list.
 func WithStages(stages ...StageConfig) Option {
 	return func(cfg *config.Config) {
@@ -154,6 +275,32 @@ func SSH(ip, username, keyFile string) HostConfig {
 	return config.SSHHost(ip, username, keyFile)
 }
 
+// SSHAlias creates a remote host configuration resolved from a Host entry of
+// ~/.ssh/config.
+func SSHAlias(alias string) HostConfig {
+	return config.Host{SSHAlias: alias}
+}
+
+// Kubernetes creates a host configuration running commands in a pod of a cluster
+// through kubectl.
+func Kubernetes(pod KubernetesHost) HostConfig {
+	return config.Host{Type: "kubernetes", Kubernetes: &pod}
+}
+
+// Windows creates a remote Windows host configuration reached through its
+// OpenSSH server, whose commands run as PowerShell scripts.
+func Windows(ip, username, keyFile string) HostConfig {
+	host := config.SSHHost(ip, username, keyFile)
+	host.OS = "windows"
+	return host
+}
+
+// Hetzner creates a host provisioned as a Hetzner Cloud server of serverType in
+// location when the run starts, which sshKeys may log in to, and deleted when it ends.
+func Hetzner(serverType, location, image string, sshKeys ...string) HostConfig {
+	return config.Host{Provision: &config.Provision{Provider: "hetzner", Type: serverType, Region: location, Image: image, SSHKeys: sshKeys}}
+}
+
 // Bool returns a pointer to value for optional config booleans.
 func Bool(value bool) *bool {
 	return config.Bool(value)
@@ -3,6 +3,9 @@
 package bench
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -60,3 +63,28 @@ stages:
 		t.Fatalf("expected yaml benchmark name")
 	}
 }
+
+func TestFromFileResolvesCacheInputsAgainstConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "benchmark.yaml")
+	if err := os.WriteFile(path, []byte(`
+benchmark:
+  name: yaml
+  output_dir: ./results
+stages:
+  - name: build
+    command: make
+    cache:
+      inputs: [src/*.c, /etc/hostname]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := FromFile(path)
+	if err != nil {
+		t.Fatalf("from file: %v", err)
+	}
+	want := []string{filepath.Join(dir, "src/*.c"), "/etc/hostname"}
+	if got := b.Config().Stages[0].Cache.Inputs; !reflect.DeepEqual(got, want) {
+		t.Fatalf("cache inputs = %v, want %v", got, want)
+	}
+}
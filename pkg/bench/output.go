@@ -20,3 +20,49 @@ func RemotePath(path string) OutputOption {
 		output.RemotePath = path
 	}
 }
+
+// LocalPath sets where the collected file is stored, relative to the run directory.
+func LocalPath(path string) OutputOption {
+	return func(output *config.Output) {
+		output.LocalPath = path
+	}
+}
+
+// Format sets how the collected file is read: "prometheus", "raw", or "gobench".
+func Format(format string) OutputOption {
+	return func(output *config.Output) {
+		output.Format = format
+	}
+}
+
+// Compress compresses the output on the host with "gzip" or "zstd" before the
+// transfer and stores it compressed.
+func Compress(format string) OutputOption {
+	return func(output *config.Output) {
+		output.Compress = format
+	}
+}
+
+// Decompress stores a compressed output uncompressed, so Compress only shrinks
+// the transfer.
+func Decompress() OutputOption {
+	return func(output *config.Output) {
+		output.Decompress = true
+	}
+}
+
+// CleanupRemote deletes the output from the host after it was collected and its
+// checksum verified.
+func CleanupRemote() OutputOption {
+	return func(output *config.Output) {
+		output.CleanupRemote = true
+	}
+}
+
+// OnStale sets what happens when the output on the host predates its stage:
+// "warn" (default), "fail", or "ignore".
+func OnStale(action string) OutputOption {
+	return func(output *config.Output) {
+		output.OnStale = action
+	}
+}
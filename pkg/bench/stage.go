@@ -60,6 +60,14 @@ func Shell(shell string) StageOption {
 	}
 }
 
+// Become runs the stage command through sudo, as user or as root when user is empty.
+func Become(user string) StageOption {
+	return func(stage *config.Stage) {
+		stage.Become = true
+		stage.BecomeUser = user
+	}
+}
+
 // OnlyFor limits a stage to one benchmark case name.
 func OnlyFor(caseName string) StageOption {
 	return func(stage *config.Stage) {
@@ -67,6 +75,47 @@ func OnlyFor(caseName string) StageOption {
 	}
 }
 
+// Describe sets stages[].description.
+func Describe(description string) StageOption {
+	return func(stage *config.Stage) {
+		stage.Description = description
+	}
+}
+
+// When skips the stage unless the condition, such as "${PROFILE} == 'true'", holds.
+func When(condition string) StageOption {
+	return func(stage *config.Stage) {
+		stage.When = condition
+	}
+}
+
+// BuildStage creates a build stage: the command runs locally and the artifact
+// is installed at remotePath on every stage host.
+func BuildStage(name, path, remotePath string, opts ...StageOption) StageConfig {
+	stage := Stage(name, opts...)
+	stage.Type = "build"
+	stage.Artifact = &config.Artifact{Path: path, RemotePath: remotePath}
+	return stage
+}
+
+// PerPlatformBuildStage creates a build stage that runs once for every OS and
+// architecture among the stage hosts, with GOOS and GOARCH set for the command.
+// path and remotePath may reference ${BENCHCTL_GOOS} and ${BENCHCTL_GOARCH}.
+func PerPlatformBuildStage(name, path, remotePath string, opts ...StageOption) StageConfig {
+	stage := BuildStage(name, path, remotePath, opts...)
+	stage.Artifact.PerPlatform = true
+	return stage
+}
+
+// ImageBuildStage creates a build stage producing a container image that is
+// loaded into docker on every remote stage host.
+func ImageBuildStage(name, image string, opts ...StageOption) StageConfig {
+	stage := Stage(name, opts...)
+	stage.Type = "build"
+	stage.Artifact = &config.Artifact{Image: image}
+	return stage
+}
+
 // Background marks a stage as a background stage.
 func Background() StageOption {
 	return func(stage *config.Stage) {
@@ -74,6 +123,28 @@ func Background() StageOption {
 	}
 }
 
+// Warmup marks a stage whose outputs and metrics are kept apart from the run's.
+func Warmup() StageOption {
+	return func(stage *config.Stage) {
+		stage.Warmup = true
+	}
+}
+
+// RunFor stops the stage command after d, counting it as a success.
+func RunFor(d time.Duration) StageOption {
+	return func(stage *config.Stage) {
+		stage.Duration = d.String()
+	}
+}
+
+// UploadFile uploads the local file to remotePath on the stage hosts before the
+// stage runs.
+func UploadFile(localPath, remotePath string) StageOption {
+	return func(stage *config.Stage) {
+		stage.Files = append(stage.Files, config.StageFile{LocalPath: localPath, RemotePath: remotePath})
+	}
+}
+
 // Outputs appends output collection rules.
 func Outputs(outputs ...OutputConfig) StageOption {
 	return func(stage *config.Stage) {
@@ -81,11 +152,170 @@ func Outputs(outputs ...OutputConfig) StageOption {
 	}
 }
 
+// FailureLogs appends remote log files whose last lines are saved when the stage fails.
+func FailureLogs(paths ...string) StageOption {
+	return func(stage *config.Stage) {
+		stage.FailureLogs = append(stage.FailureLogs, paths...)
+	}
+}
+
 // Output creates and appends one output collection rule.
 func Output(name string, opts ...OutputOption) StageOption {
 	return Outputs(NewOutput(name, opts...))
 }
 
+// Cache skips the stage when its command, input files, and key are unchanged
+// since its last successful execution.
+func Cache(key string, inputs ...string) StageOption {
+	return func(stage *config.Stage) {
+		stage.Cache = &config.StageCache{Key: key, Inputs: append([]string(nil), inputs...)}
+	}
+}
+
+// Netem emulates network conditions on iface of the stage hosts while the stage runs.
+func Netem(iface string, opts ...NetemOption) StageOption {
+	return func(stage *config.Stage) {
+		netem := config.Netem{Interface: iface}
+		for _, opt := range opts {
+			opt(&netem)
+		}
+		stage.Netem = &netem
+	}
+}
+
+// Docker runs the stage command inside a fresh container of image on the stage hosts.
+func Docker(image string, opts ...ContainerOption) StageOption {
+	return func(stage *config.Stage) {
+		container := config.Container{Image: image}
+		for _, opt := range opts {
+			opt(&container)
+		}
+		stage.Runtime = "docker"
+		stage.Container = &container
+	}
+}
+
+// ContainerOption configures the container of a stage.
+type ContainerOption func(*config.Container)
+
+// Mount binds a host path into the container, as host:container[:ro].
+func Mount(mount string) ContainerOption {
+	return func(container *config.Container) {
+		container.Mounts = append(container.Mounts, mount)
+	}
+}
+
+// ContainerNetwork joins the container to a docker network, such as "host".
+func ContainerNetwork(network string) ContainerOption {
+	return func(container *config.Container) {
+		container.Network = network
+	}
+}
+
+// NetemOption configures emulated network conditions.
+type NetemOption func(*config.Netem)
+
+// NetemDelay adds delay with the given jitter (zero for none) to outgoing packets.
+func NetemDelay(delay, jitter time.Duration) NetemOption {
+	return func(netem *config.Netem) {
+		netem.Delay = delay.String()
+		netem.Jitter = ""
+		if jitter > 0 {
+			netem.Jitter = jitter.String()
+		}
+	}
+}
+
+// NetemLoss drops the given percentage of outgoing packets.
+func NetemLoss(percent float64) NetemOption {
+	return func(netem *config.Netem) {
+		netem.Loss = percent
+	}
+}
+
+// NetemRate caps outgoing bandwidth, e.g. "100mbit".
+func NetemRate(rate string) NetemOption {
+	return func(netem *config.Netem) {
+		netem.Rate = rate
+	}
+}
+
+// NetemSudo runs tc through sudo -n.
+func NetemSudo() NetemOption {
+	return func(netem *config.Netem) {
+		netem.Sudo = true
+	}
+}
+
+// Chaos injects faults at time offsets while the stage command runs.
+func Chaos(actions ...ChaosConfig) StageOption {
+	return func(stage *config.Stage) {
+		stage.Chaos = append(stage.Chaos, actions...)
+	}
+}
+
+// DependsOn makes the stage wait until the named stages have completed. Stages of
+// a benchmark using DependsOn run concurrently once their dependencies are done;
+// those without DependsOn wait for the stage before them, and DependsOn() without
+// names starts a stage right away.
+func DependsOn(stages ...string) StageOption {
+	return func(stage *config.Stage) {
+		stage.DependsOn = append(config.StageNames{}, append(stage.DependsOn, stages...)...)
+	}
+}
+
+// Parallel adds the stage to the named group of consecutive stages that start
+// together; the stage after the group waits for all of them.
+func Parallel(group string) StageOption {
+	return func(stage *config.Stage) {
+		stage.Parallel = group
+	}
+}
+
+// PipeFrom streams the stdout of the named earlier stage into the stdin of the stage.
+func PipeFrom(producer string) StageOption {
+	return func(stage *config.Stage) {
+		stage.PipeFrom = producer
+	}
+}
+
+// Session drives the stage command interactively: it waits for the prompt, sends
+// the steps one after the other, and closes the stdin of the command.
+func Session(session SessionConfig) StageOption {
+	return func(stage *config.Stage) {
+		stage.Session = &session
+	}
+}
+
+// Send is a session step sending line and waiting for output matching expect,
+// if set.
+func Send(line, expect string) SessionStep {
+	return SessionStep{Send: line, Expect: expect}
+}
+
+// Expect adds expectations such as "error_rate < 0.01" checked after the stage completes.
+func Expect(exprs ...string) StageOption {
+	return func(stage *config.Stage) {
+		stage.Expect = append(stage.Expect, exprs...)
+	}
+}
+
+// MetricFromOutput records the first capture group of the last match of pattern,
+// e.g. `Requests/sec:\s+(\d+\.\d+)`, in the stage output as the run metric name.
+func MetricFromOutput(name, pattern string) StageOption {
+	return func(stage *config.Stage) {
+		stage.MetricsFromOutput = append(stage.MetricsFromOutput, config.OutputMetric{Name: name, Pattern: pattern})
+	}
+}
+
+// ThrottleConsole shows at most linesPerSecond lines of the stage output on the
+// console; the run log still receives everything.
+func ThrottleConsole(linesPerSecond int) StageOption {
+	return func(stage *config.Stage) {
+		stage.Console = &config.ConsoleThrottle{MaxLinesPerSecond: linesPerSecond}
+	}
+}
+
 // HealthCheck sets a stage health check.
 func HealthCheck(healthCheck HealthConfig) StageOption {
 	return func(stage *config.Stage) {
@@ -0,0 +1,262 @@
+// Package benchctltest runs benchmarks against fake hosts, so benchmark configs
+// and the hooks they call can be tested with go test, without SSH access or the
+// real workloads.
+//
+// Every command of a run, on local and remote hosts alike, is answered by the
+// Hosts instead of being executed:
+//
+//	hosts := benchctltest.New()
+//	hosts.Handle(`wrk `, benchctltest.Response{Output: "Requests/sec: 2412.73\n"})
+//	hosts.WriteFile("10.0.0.1", "/tmp/latency.csv", []byte("p99_ms\n12.4\n"))
+//	results, err := hosts.Run(ctx, b)
+//
+// With a fake Clock, waits take no time and run timestamps are deterministic:
+//
+//	clock := benchctltest.NewClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+//	results, err := hosts.Run(benchctltest.WithClock(ctx, clock), b)
+package benchctltest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal"
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/internal/execution"
+	"github.com/luccadibe/benchctl/pkg/bench"
+	"github.com/luccadibe/benchctl/pkg/run"
+)
+
+// Local is the host name of commands of stages without a remote host.
+const Local = "local"
+
+// Call is a command a run sent to a host.
+type Call struct {
+	// Host is the IP of the host, or Local.
+	Host string
+	// Command is the command as executed, with the environment exports of the
+	// stage and the shell wrapper (bash -lic '...' by default) included.
+	Command string
+}
+
+// Response is the result of a faked command.
+type Response struct {
+	Output   string
+	ExitCode int
+	// Err is returned as a failure to run the command at all, like a lost SSH
+	// connection.
+	Err error
+}
+
+// Hosts fakes the hosts of runs. A command is answered by the last handler
+// registered for a pattern it matches, and succeeds without output otherwise.
+// Output collection copies the files given to WriteFile, and uploads are kept
+// for ReadFile. Hosts is safe for concurrent use.
+type Hosts struct {
+	mu       sync.Mutex
+	handlers []handler
+	files    map[string][]byte
+	calls    []Call
+}
+
+type handler struct {
+	pattern *regexp.Regexp
+	respond func(Call) Response
+}
+
+// New returns fake hosts without files on which every command succeeds.
+func New() *Hosts {
+	return &Hosts{files: map[string][]byte{}}
+}
+
+// Handle answers the commands matching the regular expression pattern with response.
+func (h *Hosts) Handle(pattern string, response Response) {
+	h.HandleFunc(pattern, func(Call) Response { return response })
+}
+
+// HandleFunc answers the commands matching the regular expression pattern with
+// the result of respond.
+func (h *Hosts) HandleFunc(pattern string, respond func(Call) Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers = append(h.handlers, handler{pattern: regexp.MustCompile(pattern), respond: respond})
+}
+
+// WriteFile creates or replaces a file on a host, such as an output a stage
+// command would have written.
+func (h *Hosts) WriteFile(host, path string, content []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.files[fileKey(host, path)] = bytes.Clone(content)
+}
+
+// ReadFile returns a file of a host, such as an uploaded build artifact.
+func (h *Hosts) ReadFile(host, path string) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	content, ok := h.files[fileKey(host, path)]
+	return bytes.Clone(content), ok
+}
+
+// Calls returns the commands sent to the hosts so far, in order.
+func (h *Hosts) Calls() []Call {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.calls)
+}
+
+// Ran reports whether a command matching the regular expression pattern was sent
+// to a host.
+func (h *Hosts) Ran(pattern string) bool {
+	re := regexp.MustCompile(pattern)
+	return slices.ContainsFunc(h.Calls(), func(call Call) bool { return re.MatchString(call.Command) })
+}
+
+// Context returns a context whose runs, started with run.Run, run.RunMatrix, or
+// run.RunAB, use the fake hosts.
+func (h *Hosts) Context(ctx context.Context) context.Context {
+	return internal.WithClientFactory(ctx, func(host config.Host) (execution.ExecutionClient, error) {
+		name := host.IP
+		if strings.TrimSpace(name) == "" {
+			name = Local
+		}
+		return &client{hosts: h, host: name}, nil
+	})
+}
+
+// Run executes b with run.RunMatrix against the fake hosts. Results are stored in
+// benchmark.output_dir as usual, so point it at t.TempDir().
+func (h *Hosts) Run(ctx context.Context, b *bench.Bench, opts ...run.Option) ([]*run.Result, error) {
+	return run.RunMatrix(h.Context(ctx), b, opts...)
+}
+
+// Clock is a fake clock for runs. It stands still until a run waits on it; every
+// wait returns at once and advances the clock by the waited duration, so cooldown
+// periods, chaos delays, and retries take no time, and timestamps in the run
+// metadata are deterministic. Clock is safe for concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a fake clock reading start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After advances the clock by d and returns a channel holding the new time.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	fired := make(chan time.Time, 1)
+	fired <- c.Advance(d)
+	return fired
+}
+
+// Advance moves the clock forward by d, if d is positive, and returns the new time.
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+	return c.now
+}
+
+// WithClock returns a context whose runs read the time from clock. Combine it with
+// Hosts.Context or Hosts.Run.
+func WithClock(ctx context.Context, clock *Clock) context.Context {
+	return internal.WithClock(ctx, clock)
+}
+
+func (h *Hosts) respond(call Call) Response {
+	h.mu.Lock()
+	h.calls = append(h.calls, call)
+	var respond func(Call) Response
+	for _, handler := range slices.Backward(h.handlers) {
+		if handler.pattern.MatchString(call.Command) {
+			respond = handler.respond
+			break
+		}
+	}
+	h.mu.Unlock()
+	if respond == nil {
+		return Response{}
+	}
+	return respond(call)
+}
+
+func fileKey(host, path string) string {
+	return host + ":" + path
+}
+
+// client is the execution client of one fake host.
+type client struct {
+	hosts *Hosts
+	host  string
+}
+
+func (c *client) RunCommand(ctx context.Context, req execution.CommandRequest) (execution.CommandResult, error) {
+	if err := ctx.Err(); err != nil {
+		return execution.CommandResult{ExitCode: -1}, err
+	}
+	response := c.hosts.respond(Call{Host: c.host, Command: req.Command})
+	if response.Err != nil {
+		return execution.CommandResult{ExitCode: -1}, response.Err
+	}
+	if req.Stdout != nil {
+		_, _ = io.WriteString(req.Stdout, response.Output)
+	}
+	result := execution.CommandResult{ExitCode: response.ExitCode}
+	if !req.DisableCapture {
+		result.Output = response.Output
+	}
+	if response.ExitCode != 0 {
+		return result, fmt.Errorf("exit status %d", response.ExitCode)
+	}
+	return result, nil
+}
+
+// CheckPort reports every port as open.
+func (c *client) CheckPort(ctx context.Context, port string, timeout time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (c *client) Scp(ctx context.Context, remotePath, localPath string) error {
+	content, ok := c.hosts.ReadFile(c.host, remotePath)
+	if !ok {
+		return fmt.Errorf("%s:%s: %w", c.host, remotePath, fs.ErrNotExist)
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(localPath, content, 0644)
+}
+
+func (c *client) Upload(ctx context.Context, localPath, remotePath string) error {
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	c.hosts.WriteFile(c.host, remotePath, content)
+	return nil
+}
+
+func (c *client) Close() error {
+	return nil
+}
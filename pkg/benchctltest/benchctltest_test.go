@@ -0,0 +1,122 @@
+//go:build unit
+
+package benchctltest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luccadibe/benchctl/internal/config"
+	"github.com/luccadibe/benchctl/pkg/bench"
+	"github.com/luccadibe/benchctl/pkg/run"
+)
+
+func TestHostsRunBenchmark(t *testing.T) {
+	b := bench.New("fake",
+		bench.WithResultsPath(t.TempDir()),
+		bench.WithGit(bench.DisableGit()),
+		bench.WithHost("server", bench.SSH("10.0.0.1", "bench", "")),
+		bench.WithStages(
+			bench.Stage("load",
+				bench.Host("server"),
+				bench.Command("wrk -t2 http://localhost:8080"),
+				bench.MetricFromOutput("rps", `Requests/sec:\s+([\d.]+)`),
+				bench.Output("latency", bench.RemotePath("/tmp/latency.csv")),
+				bench.Expect("rps > 1000"),
+			),
+			bench.Stage("report", bench.Command("./report.sh")),
+		),
+	)
+
+	hosts := New()
+	hosts.Handle(`wrk `, Response{Output: "Requests/sec: 2412.73\n"})
+	hosts.WriteFile("10.0.0.1", "/tmp/latency.csv", []byte("p99_ms\n12.4\n"))
+	results, err := hosts.Run(context.Background(), b)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	metadata := results[0].Metadata
+	if metadata.Custom["rps"] != "2412.73" {
+		t.Fatalf("rps = %q", metadata.Custom["rps"])
+	}
+	latency, err := run.Results(b).OpenArtifact(context.Background(), results[0].RunID, "latency.csv")
+	if err != nil {
+		t.Fatalf("expected the output to be collected: %v", err)
+	}
+	latency.Close()
+	if !hosts.Ran(`report\.sh`) {
+		t.Fatalf("expected report to run locally, calls: %+v", hosts.Calls())
+	}
+	for _, call := range hosts.Calls() {
+		if strings.Contains(call.Command, "report.sh") && call.Host != Local {
+			t.Fatalf("report ran on %s", call.Host)
+		}
+	}
+
+	hosts.Handle(`wrk `, Response{Output: "Requests/sec: 512.00\n"})
+	if _, err := hosts.Run(context.Background(), b); err == nil || !strings.Contains(err.Error(), "rps > 1000 (got 512.00)") {
+		t.Fatalf("expected the expectation to fail, got %v", err)
+	}
+
+	hosts.Handle(`report\.sh`, Response{Output: "boom\n", ExitCode: 2})
+	hosts.Handle(`wrk `, Response{Output: "Requests/sec: 2412.73\n"})
+	if _, err := hosts.Run(context.Background(), b); err == nil || !strings.Contains(err.Error(), "exit code: 2") {
+		t.Fatalf("expected the failing report to fail the run, got %v", err)
+	}
+}
+
+func TestClockMakesWaitsInstantAndTimestampsDeterministic(t *testing.T) {
+	b := bench.New("clocked",
+		bench.WithResultsPath(t.TempDir()),
+		bench.WithGit(bench.DisableGit()),
+		bench.WithCases(bench.NewCase("a"), bench.NewCase("b")),
+		bench.WithStages(bench.Stage("load", bench.Command("./load.sh"))),
+	)
+	b.Config().Benchmark.Cooldown = &config.Cooldown{Period: "10m"}
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	begun := time.Now()
+	results, err := New().Run(WithClock(context.Background(), clock), b)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if elapsed := time.Since(begun); elapsed > time.Minute {
+		t.Fatalf("expected the cooldown to take no time, took %s", elapsed)
+	}
+	metadata := results[0].Metadata
+	if !metadata.StartTime.Equal(start) || !metadata.EndTime.Equal(start.Add(10*time.Minute)) {
+		t.Fatalf("run from %s to %s", metadata.StartTime, metadata.EndTime)
+	}
+	if len(metadata.Cooldowns) != 1 || metadata.Cooldowns[0].DurationSeconds != 600 {
+		t.Fatalf("cooldowns = %+v", metadata.Cooldowns)
+	}
+}
+
+func TestBecomeRunsStageThroughSudo(t *testing.T) {
+	b := bench.New("become",
+		bench.WithResultsPath(t.TempDir()),
+		bench.WithGit(bench.DisableGit()),
+		bench.WithHost("db", bench.SSH("10.0.0.2", "bench", "")),
+		bench.WithStages(bench.Stage("vacuum", bench.Host("db"), bench.Become("postgres"), bench.Command("vacuumdb --all"))),
+	)
+
+	hosts := New()
+	if _, err := hosts.Run(context.Background(), b); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !hosts.Ran(`^sudo -n -u 'postgres' -- true$`) {
+		t.Fatalf("expected a NOPASSWD check, calls: %+v", hosts.Calls())
+	}
+	if !hosts.Ran(`; sudo -n -u 'postgres' -- env .*BENCHCTL_RUN_ID='[^']+'.* bash -lic 'vacuumdb --all'$`) {
+		t.Fatalf("expected the command to run through sudo with the stage env, calls: %+v", hosts.Calls())
+	}
+
+	hosts.Handle(`^sudo -n -u 'postgres' -- true$`, Response{Output: "sudo: a password is required\n", ExitCode: 1})
+	_, err := hosts.Run(context.Background(), b)
+	if err == nil || !strings.Contains(err.Error(), "requires a password") || !strings.Contains(err.Error(), "hosts.db.become_password") {
+		t.Fatalf("expected a missing password error, got %v", err)
+	}
+}
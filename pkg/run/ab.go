@@ -0,0 +1,76 @@
+package run
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/luccadibe/benchctl/internal"
+	"github.com/luccadibe/benchctl/pkg/bench"
+)
+
+type ABComparison = internal.ABComparison
+
+// ABResult holds the runs of an A/B comparison and the statistics across them.
+type ABResult struct {
+	A          []*Result
+	B          []*Result
+	Comparison []ABComparison
+}
+
+// RunAB runs a and b repeat times each and compares their numeric custom metadata.
+// Runs are interleaved in ABBA order so linear environmental drift affects both
+// configurations equally. Every run is tagged with ab_variant=a or ab_variant=b.
+// On failure the runs completed so far are returned together with the error.
+func RunAB(ctx context.Context, a, b *bench.Bench, repeat int, opts ...Option) (*ABResult, error) {
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("benchmark is nil")
+	}
+	if repeat < 1 {
+		return nil, fmt.Errorf("repeat must be >= 1")
+	}
+
+	result := &ABResult{}
+	runVariant := func(variant string) error {
+		target, runs := a, &result.A
+		if variant == "b" {
+			target, runs = b, &result.B
+		}
+		index := len(*runs) + 1
+		res, err := Run(ctx, target, append(opts[:len(opts):len(opts)], WithMetadata("ab_variant", variant))...)
+		if res != nil {
+			*runs = append(*runs, res)
+		}
+		if err != nil {
+			return fmt.Errorf("%s run %d: %w", variant, index, err)
+		}
+		return nil
+	}
+
+	for i := range repeat {
+		order := []string{"a", "b"}
+		if i%2 == 1 {
+			order = []string{"b", "a"}
+		}
+		for _, variant := range order {
+			if err := runVariant(variant); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	result.Comparison = internal.CompareAB(runMetadata(result.A), runMetadata(result.B))
+	return result, nil
+}
+
+// FormatABComparison renders an A/B comparison for CLI-style output.
+func FormatABComparison(comparisons []ABComparison) string {
+	return internal.FormatABComparison(comparisons)
+}
+
+func runMetadata(results []*Result) []*RunMetadata {
+	metadata := make([]*RunMetadata, 0, len(results))
+	for _, result := range results {
+		metadata = append(metadata, result.Metadata)
+	}
+	return metadata
+}
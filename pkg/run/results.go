@@ -9,7 +9,23 @@ import (
 	"github.com/luccadibe/benchctl/pkg/bench"
 )
 
-type ComparisonResult = internal.ComparisonResult
+type (
+	ComparisonResult = internal.ComparisonResult
+	RunNote          = internal.RunNote
+	HistoryEntry     = internal.HistoryEntry
+	OutputDiff       = internal.OutputDiff
+	GoBenchTable     = internal.GoBenchTable
+	Analysis         = internal.Analysis
+	AnalysisInput    = internal.AnalysisInput
+	StoreMetrics     = internal.StoreMetrics
+	// WebhookPayload is the body benchmark.webhooks receive; decode it with
+	// encoding/json after checking the X-Benchctl-Signature header.
+	WebhookPayload  = internal.WebhookPayload
+	WebhookArtifact = internal.WebhookArtifact
+)
+
+// WebhookSchemaVersion is the schema_version of WebhookPayload.
+const WebhookSchemaVersion = internal.WebhookSchemaVersion
 
 // Inspect returns the human-readable inspection for a run directory.
 func Inspect(runDir string, verbose bool) string {
@@ -21,6 +37,16 @@ func Annotate(runDir string, metadata map[string]string) error {
 	return internal.AddMetadata(runDir, metadata)
 }
 
+// Note appends a timestamped free-text note to a run directory.
+func Note(runDir, text string) error {
+	return internal.AddNote(runDir, text)
+}
+
+// Notes returns the notes of a run directory in the order they were added.
+func Notes(runDir string) ([]RunNote, error) {
+	return internal.LoadNotes(runDir)
+}
+
 // LoadMetadata loads metadata.json from a run directory.
 func LoadMetadata(runDir string) (*RunMetadata, error) {
 	return internal.LoadRunMetadata(filepath.Join(runDir, "metadata.json"))
@@ -31,11 +57,46 @@ func Compare(first, second *RunMetadata) ([]ComparisonResult, error) {
 	return internal.CompareRunMetadata(first, second)
 }
 
+// ApplyComparisonRules judges the results that the benchmark.compare rules match,
+// with the first run as the baseline, and returns the regressed metrics.
+func ApplyComparisonRules(results []ComparisonResult, rules []bench.MetricComparison) []string {
+	return internal.ApplyComparisonRules(results, rules)
+}
+
 // FormatComparison renders comparison results for CLI-style output.
 func FormatComparison(results []ComparisonResult) string {
 	return internal.PrintComparisonResults(results)
 }
 
+// DiffOutput compares the CSV output named output of two run directories, keeping
+// the topK most changed buckets per column.
+func DiffOutput(firstRunDir, secondRunDir, output string, topK int) (*OutputDiff, error) {
+	return internal.DiffOutput(firstRunDir, secondRunDir, output, topK)
+}
+
+// FormatOutputDiff renders an output diff for CLI-style output.
+func FormatOutputDiff(diff *OutputDiff) string {
+	return internal.FormatOutputDiff(diff)
+}
+
+// SelectRun returns the ID of the latest stored run other than exclude matching a
+// query such as "latest tag=nightly branch=main". Only successful runs match
+// unless the query sets a status.
+func SelectRun(ctx context.Context, store ResultStore, query, exclude string) (string, error) {
+	return internal.SelectRun(ctx, store, query, exclude)
+}
+
+// CompareGoBenchmarks compares the format: gobench outputs that two stored runs both
+// collected, like benchstat.
+func CompareGoBenchmarks(ctx context.Context, store ResultStore, firstRunID, secondRunID string) ([]GoBenchTable, error) {
+	return internal.CompareGoBenchmarks(ctx, store, firstRunID, secondRunID)
+}
+
+// FormatGoBenchmarks renders Go benchmark comparisons in the layout of benchstat.
+func FormatGoBenchmarks(tables []GoBenchTable) string {
+	return internal.FormatGoBenchmarks(tables)
+}
+
 // SyncPush syncs benchmark results according to benchmark.sync.
 func SyncPush(ctx context.Context, b *bench.Bench) error {
 	if b == nil {
@@ -43,3 +104,39 @@ func SyncPush(ctx context.Context, b *bench.Bench) error {
 	}
 	return internal.SyncResults(ctx, b.Config())
 }
+
+// FormatOpenMetrics renders the numeric custom metadata of a run as OpenMetrics text.
+func FormatOpenMetrics(metadata *RunMetadata) string {
+	return internal.FormatOpenMetrics(metadata)
+}
+
+// FormatStoreMetrics renders Prometheus gauges about the stored runs of stores per
+// benchmark: run counts by status, the latest run, and disk usage.
+func FormatStoreMetrics(ctx context.Context, stores ...ResultStore) (string, error) {
+	return internal.FormatStoreMetrics(ctx, stores...)
+}
+
+// NewStoreMetrics returns a StoreMetrics that remembers the disk usage of finished
+// runs between calls, for exporters that are scraped repeatedly.
+func NewStoreMetrics() *StoreMetrics {
+	return internal.NewStoreMetrics()
+}
+
+// PushMetrics pushes the numeric custom metadata of a run to a Prometheus Pushgateway.
+func PushMetrics(ctx context.Context, gatewayURL, job string, metadata *RunMetadata) error {
+	return internal.PushMetrics(ctx, gatewayURL, job, metadata)
+}
+
+// GitHubAnnotations returns GitHub Actions ::error commands for the stage and cleanup
+// failures in err, pointing at their line in configData, the content of the config
+// file at configPath that the run was loaded from. Steps are found by name, so the
+// lines stay right when profiles or overrides were applied to the content, and a
+// step only a profile defines gets no line.
+func GitHubAnnotations(err error, configPath string, configData []byte) []string {
+	return internal.GitHubAnnotations(err, configPath, configData)
+}
+
+// InGitHubActions reports whether the process runs inside a GitHub Actions job.
+func InGitHubActions() bool {
+	return internal.InGitHubActions()
+}
@@ -3,7 +3,9 @@ package run
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"strings"
 	"time"
 
@@ -19,11 +21,18 @@ type (
 )
 
 type runParams struct {
-	metadata map[string]string
-	env      map[string]string
-	skip     []string
-	cases    []string
-	timeout  time.Duration
+	metadata     map[string]string
+	env          map[string]string
+	skip         []string
+	cases        []string
+	timeout      time.Duration
+	noCache      bool
+	shuffle      bool
+	seed         *int64
+	skipAnalysis bool
+	trials       int
+	verbose      bool
+	traceExec    bool
 }
 
 // Option configures one invocation of Run.
@@ -43,39 +52,183 @@ func RunConfig(ctx context.Context, cfg *bench.Config, opts ...Option) (*Result,
 }
 
 func runConfig(ctx context.Context, cfg *config.Config, opts ...Option) (*Result, error) {
-	if cfg == nil {
-		return nil, fmt.Errorf("benchmark is nil")
+	cloned, params, err := effectiveConfig(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(cloned.Matrix) > 0 {
+		return nil, fmt.Errorf("benchmark %s defines a matrix; use RunMatrix", cloned.Benchmark.Name)
 	}
+	return execute(ctx, cloned, params)
+}
 
-	params := runParams{}
-	for _, opt := range opts {
-		if err := opt(&params); err != nil {
+// RunMatrix executes one run per combination of the benchmark matrix, or a single
+// run when no matrix is configured. Each run exports its combination as environment
+// variables and records it in the custom metadata. With benchmark.order random, the
+// combinations run in the random order of one seed, which every run uses for its
+// cases as well and records in its metadata. The sweep stops at the first failed
+// run unless benchmark.failure_policy.on_failure is continue.
+func RunMatrix(ctx context.Context, b *bench.Bench, opts ...Option) ([]*Result, error) {
+	if b == nil {
+		return nil, fmt.Errorf("benchmark is nil")
+	}
+	cloned, params, err := effectiveConfig(b.Config(), opts)
+	if err != nil {
+		return nil, err
+	}
+	combinations := cloned.Combinations()
+	if len(combinations) == 0 {
+		result, err := execute(ctx, cloned, params)
+		if result == nil {
 			return nil, err
 		}
+		return []*Result{result}, err
 	}
 
+	if cloned.Benchmark.Order == "random" {
+		seed := internal.OrderSeed(cloned)
+		cloned.Benchmark.Seed = &seed
+		internal.ShuffleCombinations(combinations, seed)
+	}
+
+	keepGoing := cloned.Benchmark.FailurePolicy != nil && cloned.Benchmark.FailurePolicy.OnFailure == "continue"
+	var results []*Result
+	var errs []error
+	for _, combination := range combinations {
+		combinationParams := params
+		combinationParams.env = maps.Clone(params.env)
+		combinationParams.metadata = maps.Clone(params.metadata)
+		if combinationParams.env == nil {
+			combinationParams.env = map[string]string{}
+		}
+		if combinationParams.metadata == nil {
+			combinationParams.metadata = map[string]string{}
+		}
+		maps.Copy(combinationParams.env, combination)
+		maps.Copy(combinationParams.metadata, combination)
+
+		result, err := execute(ctx, cloned.Clone(), combinationParams)
+		if result != nil {
+			results = append(results, result)
+		}
+		if err != nil {
+			err = fmt.Errorf("matrix %s: %w", formatCombination(cloned.Matrix, combination), err)
+			if !keepGoing || ctx.Err() != nil {
+				return results, errors.Join(append(errs, err)...)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+func execute(ctx context.Context, cfg *config.Config, params runParams) (*Result, error) {
 	runCtx := ctx
 	if params.timeout > 0 {
 		var cancel context.CancelFunc
 		runCtx, cancel = context.WithTimeout(ctx, params.timeout)
 		defer cancel()
 	}
+	if params.traceExec {
+		runCtx = internal.WithCommandTrace(runCtx)
+	}
+	return internal.RunWorkflow(runCtx, cfg, params.metadata, params.env)
+}
+
+// formatCombination renders a combination in matrix order, e.g. "RATE=100 SIZE=small".
+func formatCombination(matrix []config.Parameter, combination map[string]string) string {
+	parts := make([]string, 0, len(matrix))
+	for _, parameter := range matrix {
+		parts = append(parts, parameter.Name+"="+combination[parameter.Name])
+	}
+	return strings.Join(parts, " ")
+}
+
+// Render returns the config a Run with the same options would execute as YAML:
+// defaults filled in, runtime options applied, and $VAR templates in commands and
+// outputs expanded where they resolve the same way for every case and host.
+// The run ID is not known yet, so ${BENCHCTL_RUN_ID} is left in place.
+func Render(b *bench.Bench, opts ...Option) ([]byte, error) {
+	if b == nil {
+		return nil, fmt.Errorf("benchmark is nil")
+	}
+	cloned, params, err := effectiveConfig(b.Config(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return internal.RenderConfig(cloned, params.env)
+}
+
+// StageEnv returns the environment variables, as export lines, and the vars, as
+// comments, that a stage on host receives in the first selected case of a run with
+// the same options: the run runID, or the next run when runID is empty. Matrix
+// parameters take the first value that WithEnv does not override, and an empty host
+// stands for the local host.
+func StageEnv(b *bench.Bench, runID, host string, opts ...Option) (string, error) {
+	if b == nil {
+		return "", fmt.Errorf("benchmark is nil")
+	}
+	cloned, params, err := effectiveConfig(b.Config(), opts)
+	if err != nil {
+		return "", err
+	}
+	env := map[string]string{}
+	if combinations := cloned.Combinations(); len(combinations) > 0 {
+		maps.Copy(env, combinations[0])
+	}
+	maps.Copy(env, params.env)
+	stageEnv, err := internal.StageEnvironment(cloned, runID, host, env)
+	if err != nil {
+		return "", err
+	}
+	return internal.FormatEnvironment(stageEnv) + internal.FormatVars(cloned), nil
+}
+
+// effectiveConfig applies the options to a validated copy of cfg.
+func effectiveConfig(cfg *config.Config, opts []Option) (*config.Config, runParams, error) {
+	params := runParams{}
+	if cfg == nil {
+		return nil, params, fmt.Errorf("benchmark is nil")
+	}
+	for _, opt := range opts {
+		if err := opt(&params); err != nil {
+			return nil, params, err
+		}
+	}
 
 	// we make a copy to avoid modifying the original config.
 	// this allows re-using the same config for multiple runs while
 	// applying different runtime options for each run.
 	cloned := cfg.Clone()
 	if err := applyRuntimeSkip(cloned, params.skip); err != nil {
-		return nil, err
+		return nil, params, err
 	}
 	if err := applyRuntimeCases(cloned, params.cases); err != nil {
-		return nil, err
+		return nil, params, err
+	}
+	if params.noCache {
+		applyRuntimeNoCache(cloned)
+	}
+	if params.shuffle {
+		cloned.Benchmark.Order = "random"
+		cloned.Benchmark.Seed = params.seed
+	}
+	if params.skipAnalysis {
+		cloned.Benchmark.SkipAnalysis = true
+	}
+	if params.trials > 0 {
+		cloned.Benchmark.Trials = params.trials
+	}
+	if params.verbose {
+		if cloned.Benchmark.Logging == nil {
+			cloned.Benchmark.Logging = &config.LoggingConfig{}
+		}
+		cloned.Benchmark.Logging.Level = "debug"
 	}
 	if err := cloned.Validate(); err != nil {
-		return nil, err
+		return nil, params, err
 	}
-
-	return internal.RunWorkflow(runCtx, cloned, params.metadata, params.env)
+	return cloned, params, nil
 }
 
 // WithMetadata adds a custom metadata key-value pair for this run.
@@ -171,6 +324,71 @@ func WithTimeout(timeout time.Duration) Option {
 	}
 }
 
+// NoCache ignores stage caches for this run, so cached stages execute again.
+func NoCache() Option {
+	return func(params *runParams) error {
+		params.noCache = true
+		return nil
+	}
+}
+
+// Verbose logs at debug level in this run, including the details of every SSH
+// connection.
+func Verbose() Option {
+	return func(params *runParams) error {
+		params.verbose = true
+		return nil
+	}
+}
+
+// TraceCommands writes every command of this run, as executed, with its host,
+// timing, and exit code to trace.log in the run directory.
+func TraceCommands() Option {
+	return func(params *runParams) error {
+		params.traceExec = true
+		return nil
+	}
+}
+
+// SkipAnalysis only executes the stages and collects their outputs in this run.
+// AnalyzeStored derives the metrics and checks the expectations later.
+func SkipAnalysis() Option {
+	return func(params *runParams) error {
+		params.skipAnalysis = true
+		return nil
+	}
+}
+
+// WithTrials executes the stage pipeline n times in this run and aggregates the
+// metrics across the trials, overriding benchmark.trials.
+func WithTrials(n int) Option {
+	return func(params *runParams) error {
+		if n < 1 {
+			return fmt.Errorf("trials must be >= 1")
+		}
+		params.trials = n
+		return nil
+	}
+}
+
+// ShuffleCases runs the cases in a random order for this run only.
+func ShuffleCases() Option {
+	return func(params *runParams) error {
+		params.shuffle = true
+		return nil
+	}
+}
+
+// WithSeed runs the cases in the random order given by seed, e.g. to reproduce
+// the order recorded in an earlier run's metadata.
+func WithSeed(seed int64) Option {
+	return func(params *runParams) error {
+		params.shuffle = true
+		params.seed = &seed
+		return nil
+	}
+}
+
 func applyRuntimeCases(cfg *config.Config, caseNames []string) error {
 	if len(caseNames) == 0 {
 		return nil
@@ -229,3 +447,9 @@ func applyRuntimeSkip(cfg *config.Config, skipStages []string) error {
 	}
 	return nil
 }
+
+func applyRuntimeNoCache(cfg *config.Config) {
+	for i := range cfg.Stages {
+		cfg.Stages[i].Cache = nil
+	}
+}
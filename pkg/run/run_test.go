@@ -3,8 +3,13 @@
 package run
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/luccadibe/benchctl/internal"
 	"github.com/luccadibe/benchctl/pkg/bench"
 )
 
@@ -103,3 +108,133 @@ func TestRuntimeCaseFilterPreservesConfigOrder(t *testing.T) {
 		t.Fatalf("expected config order [a b], got %#v", cfg.Cases)
 	}
 }
+
+func TestRenderResolvesEffectiveConfig(t *testing.T) {
+	b := bench.New("render",
+		bench.WithResultsPath("./results"),
+		bench.WithStages(
+			bench.Stage("setup", bench.Command("echo setup")),
+			bench.Stage("load", bench.Command("./load --target $TARGET --out ${BENCHCTL_RUN_DIR}/load.csv")),
+		),
+	)
+
+	rendered, err := Render(b, Skip("setup"), WithEnv("TARGET", "10.0.0.2"))
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	out := string(rendered)
+	for _, want := range []string{
+		"skip: true",
+		"command: ./load --target 10.0.0.2 --out results/${BENCHCTL_RUN_ID}/load.csv",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected rendered config to contain %q:\n%s", want, out)
+		}
+	}
+	if b.Config().Stages[0].Skip || strings.Contains(b.Config().Stages[1].Command, "10.0.0.2") {
+		t.Fatalf("expected render to leave the bench unchanged")
+	}
+}
+
+func TestStageEnvPrintsStageVariables(t *testing.T) {
+	resultsDir := t.TempDir()
+	b := bench.New("env",
+		bench.WithResultsPath(resultsDir),
+		bench.WithHost("server", bench.SSH("10.0.0.1", "bench", "")),
+		bench.WithParameter("RATE", "100", "500"),
+		bench.WithParameter("SIZE", "small", "large"),
+		bench.WithCases(bench.NewCase("a"), bench.NewCase("b")),
+		bench.WithStages(bench.Stage("load", bench.Command("./load"))),
+	)
+
+	env, err := StageEnv(b, "", "server", OnlyCase("b"), WithEnv("SIZE", "large"))
+	if err != nil {
+		t.Fatalf("StageEnv: %v", err)
+	}
+	for _, want := range []string{
+		"export BENCHCTL_RUN_ID='1'\n",
+		"export BENCHCTL_RUN_DIR='" + filepath.Join(resultsDir, "1") + "'\n",
+		"export BENCHCTL_CASE_NAME='b'\n",
+		"export BENCHCTL_HOST='server'\n",
+		"export RATE='100'\n",
+		"export SIZE='large'\n",
+	} {
+		if !strings.Contains(env, want) {
+			t.Fatalf("expected %q in:\n%s", want, env)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(resultsDir, "1")); !os.IsNotExist(err) {
+		t.Fatalf("expected no run directory to be created, got %v", err)
+	}
+
+	if _, err := StageEnv(b, "3", ""); err == nil || !strings.Contains(err.Error(), "run 3 not found") {
+		t.Fatalf("expected a missing run to fail, got %v", err)
+	}
+	if _, err := StageEnv(b, "", "client"); err == nil || !strings.Contains(err.Error(), "unknown host client") {
+		t.Fatalf("expected an unknown host to fail, got %v", err)
+	}
+}
+
+func TestRunMatrixRunsEveryCombination(t *testing.T) {
+	resultsDir := t.TempDir()
+	b := bench.New("sweep",
+		bench.WithResultsPath(resultsDir),
+		bench.WithShell("sh -c"),
+		bench.WithParameter("RATE", "100", "500"),
+		bench.WithParameter("SIZE", "small", "large"),
+		bench.WithStages(bench.Stage("load", bench.Command(`echo "$RATE $SIZE" > "$BENCHCTL_RUN_DIR/params.txt"`))),
+	)
+
+	if _, err := Run(context.Background(), b); err == nil || !strings.Contains(err.Error(), "use RunMatrix") {
+		t.Fatalf("expected Run to reject a matrix benchmark, got %v", err)
+	}
+	results, err := RunMatrix(context.Background(), b)
+	if err != nil {
+		t.Fatalf("run matrix: %v", err)
+	}
+
+	want := []string{"100 small", "100 large", "500 small", "500 large"}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d runs, got %d", len(want), len(results))
+	}
+	for i, result := range results {
+		data, err := os.ReadFile(filepath.Join(result.RunDir, "params.txt"))
+		if err != nil {
+			t.Fatalf("read params of run %s: %v", result.RunID, err)
+		}
+		if strings.TrimSpace(string(data)) != want[i] {
+			t.Fatalf("run %d exported %q, want %q", i, strings.TrimSpace(string(data)), want[i])
+		}
+		rate, size, _ := strings.Cut(want[i], " ")
+		if result.Metadata.Custom["RATE"] != rate || result.Metadata.Custom["SIZE"] != size {
+			t.Fatalf("run %d custom metadata = %v", i, result.Metadata.Custom)
+		}
+	}
+}
+
+func TestRunMatrixShufflesCombinationsWithSeed(t *testing.T) {
+	b := bench.New("sweep",
+		bench.WithResultsPath(t.TempDir()),
+		bench.WithShell("sh -c"),
+		bench.WithParameter("RATE", "100", "200", "300", "400", "500"),
+		bench.WithStages(bench.Stage("load", bench.Command("true"))),
+	)
+
+	results, err := RunMatrix(context.Background(), b, WithSeed(7))
+	if err != nil {
+		t.Fatalf("run matrix: %v", err)
+	}
+	want := b.Config().Combinations()
+	internal.ShuffleCombinations(want, 7)
+	if len(results) != len(want) {
+		t.Fatalf("expected %d runs, got %d", len(want), len(results))
+	}
+	for i, result := range results {
+		if result.Metadata.Custom["RATE"] != want[i]["RATE"] {
+			t.Fatalf("run %d has RATE=%s, want RATE=%s of the seeded order", i, result.Metadata.Custom["RATE"], want[i]["RATE"])
+		}
+		if result.Metadata.Seed == nil || *result.Metadata.Seed != 7 {
+			t.Fatalf("run %d recorded seed %v, want 7", i, result.Metadata.Seed)
+		}
+	}
+}
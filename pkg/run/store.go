@@ -0,0 +1,66 @@
+package run
+
+import (
+	"context"
+
+	"github.com/luccadibe/benchctl/internal"
+	"github.com/luccadibe/benchctl/pkg/bench"
+)
+
+type (
+	ResultStore = internal.ResultStore
+	Artifact    = internal.Artifact
+	LocalStore  = internal.LocalStore
+)
+
+// NewLocalStore returns the store of the run directories below outputDir.
+func NewLocalStore(outputDir string) *LocalStore {
+	return internal.NewLocalStore(outputDir)
+}
+
+// Results returns the store of the runs of a benchmark, its benchmark.output_dir.
+func Results(b *bench.Bench) *LocalStore {
+	return internal.NewLocalStore(b.Config().Benchmark.OutputDir)
+}
+
+// History returns the status and final metrics of every run of b, oldest run
+// first, from history.jsonl in benchmark.output_dir.
+func History(b *bench.Bench) ([]HistoryEntry, error) {
+	return internal.LoadHistory(b.Config().Benchmark.OutputDir)
+}
+
+// InspectStored returns the human-readable inspection for a stored run.
+func InspectStored(ctx context.Context, store ResultStore, runID string, verbose bool) string {
+	return internal.InspectStoredRun(ctx, store, runID, verbose)
+}
+
+// AnnotateStored adds metadata to a stored run.
+func AnnotateStored(ctx context.Context, store ResultStore, runID string, metadata map[string]string) error {
+	return internal.AnnotateStoredRun(ctx, store, runID, metadata)
+}
+
+// AnalyzeStored derives the metrics of a stored run from its collected data again
+// and checks its expectations, using the stage definitions of b, or those the run
+// recorded when b is nil, and returns the updated metadata.
+func AnalyzeStored(ctx context.Context, store ResultStore, runID string, b *bench.Bench) (*RunMetadata, error) {
+	var cfg *bench.Config
+	if b != nil {
+		cfg = b.Config()
+	}
+	return internal.AnalyzeStoredRun(ctx, store, runID, cfg)
+}
+
+// NoteStored appends a timestamped free-text note to a stored run.
+func NoteStored(ctx context.Context, store ResultStore, runID, text string) error {
+	return internal.AddStoredNote(ctx, store, runID, text)
+}
+
+// NotesStored returns the notes of a stored run in the order they were added.
+func NotesStored(ctx context.Context, store ResultStore, runID string) ([]RunNote, error) {
+	return internal.LoadStoredNotes(ctx, store, runID)
+}
+
+// DiffStoredOutput compares the CSV output named output of two stored runs.
+func DiffStoredOutput(ctx context.Context, store ResultStore, firstRunID, secondRunID, output string, topK int) (*OutputDiff, error) {
+	return internal.DiffStoredOutput(ctx, store, firstRunID, secondRunID, output, topK)
+}
@@ -186,6 +186,45 @@ func TestWorkflowBackgroundStage(t *testing.T) {
 	}
 }
 
+func TestWorkflowLeavesUndeclaredPlaceholdersToRemoteShell(t *testing.T) {
+	setupWorkflowTest(t)
+	t.Setenv("HOME", "/controller-home")
+
+	data, err := config.ApplyVars([]byte(`
+benchmark:
+  name: remote-home-test
+  output_dir: /tmp/benchctl-test-output
+hosts:
+  test-host:
+    ip: localhost
+    port: 2222
+    username: testuser
+    key_file: ./testdata/ssh/test_key
+stages:
+  - name: home
+    host: test-host
+    command: echo "home=${HOME}"
+    metrics_from_output:
+      - name: home
+        pattern: home=(\S+)
+`), nil)
+	if err != nil {
+		t.Fatalf("apply vars: %v", err)
+	}
+	cfg, err := config.ParseYAML(data)
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+
+	result, err := internal.RunWorkflow(context.Background(), cfg, customMetadata, nil)
+	if err != nil {
+		t.Fatalf("workflow failed: %v", err)
+	}
+	if home := result.Metadata.Custom["home"]; home == "" || home == "/controller-home" {
+		t.Fatalf("home = %q, want the home directory of the remote user", home)
+	}
+}
+
 func TestWorkflowCommandFailure(t *testing.T) {
 	setupWorkflowTest(t)
 